@@ -0,0 +1,84 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bhojpur/render/pkg/document/markdown"
+	"github.com/spf13/cobra"
+)
+
+var markdownCmdOpts struct {
+	Output      string
+	Theme       string
+	PageSize    string
+	Orientation string
+	Unit        string
+}
+
+// markdownCmd represents the markdown command
+var markdownCmd = &cobra.Command{
+	Use:   "markdown <file.md>",
+	Short: "Converts a Markdown document into a PDF document",
+	Long: `Converts a Markdown document into a PDF document. The styling can be changed
+with a JSON theme file, whose fields override those of the default theme.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		src, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		theme := markdown.DefaultTheme()
+		if markdownCmdOpts.Theme != "" {
+			data, err := os.ReadFile(markdownCmdOpts.Theme)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(data, theme); err != nil {
+				return fmt.Errorf("cannot read theme %s: %w", markdownCmdOpts.Theme, err)
+			}
+		}
+		out := markdownCmdOpts.Output
+		if out == "" {
+			out = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + ".pdf"
+		}
+		pdf, err := markdown.New(src, markdownCmdOpts.Orientation, markdownCmdOpts.Unit, markdownCmdOpts.PageSize,
+			markdown.Options{Theme: theme, BaseDir: filepath.Dir(args[0])})
+		if err != nil {
+			return err
+		}
+		return pdf.OutputFileAndClose(out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(markdownCmd)
+	markdownCmd.Flags().StringVarP(&markdownCmdOpts.Output, "output", "o", "", "PDF file to write (defaults to the input file with a .pdf extension)")
+	markdownCmd.Flags().StringVar(&markdownCmdOpts.Theme, "theme", "", "JSON file holding the theme")
+	markdownCmd.Flags().StringVar(&markdownCmdOpts.PageSize, "page-size", "A4", "page size such as A4, A5, Letter or Legal")
+	markdownCmd.Flags().StringVar(&markdownCmdOpts.Orientation, "orientation", "P", "page orientation, P for portrait or L for landscape")
+	markdownCmd.Flags().StringVar(&markdownCmdOpts.Unit, "unit", "mm", "unit of measure of the document")
+}
@@ -0,0 +1,90 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bhojpur/render/pkg/document/merge"
+	"github.com/spf13/cobra"
+)
+
+var mergeCmdOpts struct {
+	Output  string
+	Each    string
+	Workers int
+}
+
+// mergeCmd represents the merge command
+var mergeCmd = &cobra.Command{
+	Use:   "merge <layout.yaml> <data.csv|data.json>",
+	Short: "Generates PDF documents from a layout and a dataset",
+	Long: `Generates PDF documents from a YAML or JSON layout and the records of a CSV or
+JSON dataset. By default the pages of all records are combined in one document;
+with --each a document is written for every record to a path in which
+placeholders such as {{id}} or {{#}} are replaced by the fields of the record.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		layout, err := merge.LoadLayout(args[0])
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		var records []merge.Record
+		switch strings.ToLower(filepath.Ext(args[1])) {
+		case ".csv":
+			records, err = merge.ReadCSV(f)
+		case ".json":
+			records, err = merge.ReadJSON(f)
+		default:
+			return fmt.Errorf("unknown data format %s, expecting .csv or .json", args[1])
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %w", args[1], err)
+		}
+		if mergeCmdOpts.Each != "" {
+			return layout.WriteFiles(records, mergeCmdOpts.Workers, mergeCmdOpts.Each)
+		}
+		out := mergeCmdOpts.Output
+		if out == "" {
+			out = strings.TrimSuffix(args[1], filepath.Ext(args[1])) + ".pdf"
+		}
+		pdf, err := layout.Merge(records, mergeCmdOpts.Workers)
+		if err != nil {
+			return err
+		}
+		return pdf.OutputFileAndClose(out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+	mergeCmd.Flags().StringVarP(&mergeCmdOpts.Output, "output", "o", "", "combined PDF file to write (defaults to the data file with a .pdf extension)")
+	mergeCmd.Flags().StringVar(&mergeCmdOpts.Each, "each", "", "write a PDF file per record to this path template instead")
+	mergeCmd.Flags().IntVar(&mergeCmdOpts.Workers, "workers", 0, "number of records generated concurrently (defaults to the number of CPUs)")
+}
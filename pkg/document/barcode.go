@@ -0,0 +1,693 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// code128Patterns holds the widths of the alternating bars and spaces of the
+// Code 128 symbols, the last one being the stop pattern
+var code128Patterns = []string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312",
+	"132212", "221213", "221312", "231212", "112232", "122132", "122231", "113222",
+	"123122", "123221", "223211", "221132", "221231", "213212", "223112", "312131",
+	"311222", "321122", "321221", "312212", "322112", "322211", "212123", "212321",
+	"232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121",
+	"313121", "211331", "231131", "213113", "213311", "213131", "311123", "311321",
+	"331121", "312113", "312311", "332111", "314111", "221411", "431111", "111224",
+	"111422", "121124", "121421", "141122", "141221", "112214", "112412", "122114",
+	"122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112",
+	"421211", "212141", "214121", "412121", "111143", "111341", "131141", "114113",
+	"114311", "411113", "411311", "113141", "114131", "311141", "411131", "211412",
+	"211214", "211232", "2331112",
+}
+
+const (
+	code128CodeC  = 99
+	code128CodeB  = 100
+	code128CodeA  = 101
+	code128StartA = 103
+	code128Stop   = 106
+)
+
+// code128Digits returns the number of consecutive digits of s starting at i
+func code128Digits(s string, i int) (n int) {
+	for i+n < len(s) && s[i+n] >= '0' && s[i+n] <= '9' {
+		n++
+	}
+	return
+}
+
+// code128Symbols returns the symbol values of code, including the start
+// symbol and the check symbol. Code set C is used for runs of digits, code
+// set A for control characters and code set B otherwise.
+func code128Symbols(code string) (list []int, ok bool) {
+	if code == "" {
+		return nil, false
+	}
+	for j := 0; j < len(code); j++ {
+		if code[j] >= 128 {
+			return nil, false
+		}
+	}
+	set := 0
+	for i := 0; i < len(code); {
+		digits := code128Digits(code, i)
+		// runs of digits are encoded in pairs with code set C when this
+		// saves symbols; an odd run started in another set leaves its first
+		// digit to that set
+		useC := (set == 'C' && digits >= 2) || digits >= 4 ||
+			(set == 0 && digits == len(code) && digits%2 == 0)
+		if useC && digits%2 == 1 && set != 'C' && set != 0 {
+			useC = false
+		}
+		if useC {
+			if set == 0 {
+				list = append(list, code128StartA+2)
+			} else if set != 'C' {
+				list = append(list, code128CodeC)
+			}
+			set = 'C'
+			for k := 0; k+1 < digits; k += 2 {
+				list = append(list, int(code[i+k]-'0')*10+int(code[i+k+1]-'0'))
+			}
+			i += digits - digits%2
+			continue
+		}
+		c := code[i]
+		want := byte('B')
+		if c < 32 || (set == 'A' && c < 96) {
+			want = 'A'
+		}
+		if set != int(want) {
+			switch {
+			case set == 0 && want == 'A':
+				list = append(list, code128StartA)
+			case set == 0:
+				list = append(list, code128StartA+1)
+			case want == 'A':
+				list = append(list, code128CodeA)
+			default:
+				list = append(list, code128CodeB)
+			}
+			set = int(want)
+		}
+		if c < 32 {
+			list = append(list, int(c)+64)
+		} else {
+			list = append(list, int(c)-32)
+		}
+		i++
+	}
+	sum := list[0]
+	for j, v := range list[1:] {
+		sum += (j + 1) * v
+	}
+	return append(list, sum%103, code128Stop), true
+}
+
+// BarcodeCode128 draws a Code 128 barcode of code in the rectangle of width w
+// and height h with its upper left corner at (x, y). The bars are filled with
+// the current fill color; the quiet zone of ten times the width of a bar on
+// either side is left to the caller. code may hold ASCII characters only.
+func (f *Bdf) BarcodeCode128(x, y, w, h float64, code string) {
+	if f.err != nil {
+		return
+	}
+	symbols, ok := code128Symbols(code)
+	if !ok {
+		f.SetErrorf("cannot encode %q as Code 128", code)
+		return
+	}
+	modules := 0
+	for _, s := range symbols {
+		for _, c := range code128Patterns[s] {
+			modules += int(c - '0')
+		}
+	}
+	unit := w / float64(modules)
+	pos := 0
+	for _, s := range symbols {
+		for j, c := range code128Patterns[s] {
+			n := int(c - '0')
+			if j%2 == 0 {
+				f.Rect(x+float64(pos)*unit, y, float64(n)*unit, h, "F")
+			}
+			pos += n
+		}
+	}
+}
+
+// qrEccCodewords and qrEccBlocks hold the number of error correction
+// codewords per block and the number of blocks for the levels L, M, Q and H
+// and the versions 1 to 40
+var qrEccCodewords = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var qrEccBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// qrFormatLevel holds the bits identifying the levels L, M, Q and H in the
+// format information
+var qrFormatLevel = [4]int{1, 0, 3, 2}
+
+const qrAlphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// qrBits accumulates the bits of an encoded QR code
+type qrBits []byte
+
+func (b *qrBits) put(val, n int) {
+	for j := n - 1; j >= 0; j-- {
+		*b = append(*b, byte(val>>uint(j)&1))
+	}
+}
+
+// qrRawCodewords returns the number of codewords of version ver
+func qrRawCodewords(ver int) int {
+	n := (16*ver+128)*ver + 64
+	if ver >= 2 {
+		align := ver/7 + 2
+		n -= (25*align-10)*align - 55
+		if ver >= 7 {
+			n -= 36
+		}
+	}
+	return n / 8
+}
+
+// qrDataCodewords returns the number of data codewords of version ver at
+// error correction level lvl
+func qrDataCodewords(ver, lvl int) int {
+	return qrRawCodewords(ver) - qrEccCodewords[lvl][ver]*qrEccBlocks[lvl][ver]
+}
+
+// qrSegment returns the mode of text, 1 for numeric, 2 for alphanumeric and 4
+// for bytes, and the number of bits of its data for each range of versions
+func qrSegment(text string) (mode int, countBits [3]int, data qrBits) {
+	numeric, alpha := true, true
+	for j := 0; j < len(text); j++ {
+		c := text[j]
+		numeric = numeric && c >= '0' && c <= '9'
+		alpha = alpha && strings.IndexByte(qrAlphanumeric, c) >= 0
+	}
+	switch {
+	case numeric:
+		for j := 0; j < len(text); j += 3 {
+			k := j + 3
+			if k > len(text) {
+				k = len(text)
+			}
+			val := 0
+			for _, c := range text[j:k] {
+				val = val*10 + int(c-'0')
+			}
+			data.put(val, 3*(k-j)+1)
+		}
+		return 1, [3]int{10, 12, 14}, data
+	case alpha:
+		for j := 0; j < len(text); j += 2 {
+			val := strings.IndexByte(qrAlphanumeric, text[j])
+			if j+1 < len(text) {
+				data.put(val*45+strings.IndexByte(qrAlphanumeric, text[j+1]), 11)
+			} else {
+				data.put(val, 6)
+			}
+		}
+		return 2, [3]int{9, 11, 13}, data
+	}
+	for j := 0; j < len(text); j++ {
+		data.put(int(text[j]), 8)
+	}
+	return 4, [3]int{8, 16, 16}, data
+}
+
+// qrMul multiplies in the Galois field of QR codes
+func qrMul(x, y byte) byte {
+	var z byte
+	for j := 7; j >= 0; j-- {
+		hi := z >> 7
+		z = z<<1 ^ hi*0x1D
+		z ^= (y >> uint(j) & 1) * x
+	}
+	return z
+}
+
+// qrDivisor returns the Reed-Solomon generator polynomial of degree n
+func qrDivisor(n int) []byte {
+	div := make([]byte, n)
+	div[n-1] = 1
+	root := byte(1)
+	for j := 0; j < n; j++ {
+		for k := range div {
+			div[k] = qrMul(div[k], root)
+			if k+1 < n {
+				div[k] ^= div[k+1]
+			}
+		}
+		root = qrMul(root, 2)
+	}
+	return div
+}
+
+// qrRemainder returns the error correction codewords of data
+func qrRemainder(data, div []byte) []byte {
+	rem := make([]byte, len(div))
+	for _, b := range data {
+		factor := b ^ rem[0]
+		copy(rem, rem[1:])
+		rem[len(rem)-1] = 0
+		for j, d := range div {
+			rem[j] ^= qrMul(d, factor)
+		}
+	}
+	return rem
+}
+
+// qrCodewords returns the data codewords of text for the smallest version
+// that holds them at level lvl
+func qrCodewords(text string, lvl int) (ver int, data []byte, ok bool) {
+	mode, countBits, seg := qrSegment(text)
+	count := len(text)
+	for ver = 1; ver <= 40; ver++ {
+		cb := countBits[0]
+		if ver >= 27 {
+			cb = countBits[2]
+		} else if ver >= 10 {
+			cb = countBits[1]
+		}
+		capacity := qrDataCodewords(ver, lvl) * 8
+		if count >= 1<<uint(cb) || 4+cb+len(seg) > capacity {
+			continue
+		}
+		var bits qrBits
+		bits.put(mode, 4)
+		bits.put(count, cb)
+		bits = append(bits, seg...)
+		for j := 0; j < 4 && len(bits) < capacity; j++ {
+			bits = append(bits, 0)
+		}
+		for len(bits)%8 != 0 {
+			bits = append(bits, 0)
+		}
+		for j := 0; len(bits) < capacity; j++ {
+			bits.put([]int{0xEC, 0x11}[j%2], 8)
+		}
+		data = make([]byte, len(bits)/8)
+		for j, b := range bits {
+			data[j/8] |= b << uint(7-j%8)
+		}
+		return ver, data, true
+	}
+	return 0, nil, false
+}
+
+// qrInterleave adds the error correction codewords to data and interleaves
+// the blocks
+func qrInterleave(data []byte, ver, lvl int) []byte {
+	numBlocks, eccLen := qrEccBlocks[lvl][ver], qrEccCodewords[lvl][ver]
+	raw := qrRawCodewords(ver)
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+	div := qrDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for j := range blocks {
+		n := shortLen - eccLen
+		if j >= numShort {
+			n++
+		}
+		dat := data[k : k+n]
+		k += n
+		block := append([]byte(nil), dat...)
+		if j < numShort {
+			// a placeholder aligns the codewords of short and long blocks
+			block = append(block, 0)
+		}
+		blocks[j] = append(block, qrRemainder(dat, div)...)
+	}
+	out := make([]byte, 0, raw)
+	for j := range blocks[0] {
+		for b, block := range blocks {
+			if j != shortLen-eccLen || b >= numShort {
+				out = append(out, block[j])
+			}
+		}
+	}
+	return out
+}
+
+// qrMatrix holds the modules of a QR code and marks the function patterns
+type qrMatrix struct {
+	size     int
+	dark     [][]bool
+	function [][]bool
+}
+
+func (m *qrMatrix) set(x, y int, dark bool) {
+	m.dark[y][x] = dark
+	m.function[y][x] = true
+}
+
+// qrFormatBits returns the format information of level lvl and mask
+func qrFormatBits(lvl, mask int) int {
+	data := qrFormatLevel[lvl]<<3 | mask
+	rem := data
+	for j := 0; j < 10; j++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// qrVersionBits returns the version information of version ver
+func qrVersionBits(ver int) int {
+	rem := ver
+	for j := 0; j < 12; j++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return ver<<12 | rem
+}
+
+// functions draws the function patterns of version ver
+func (m *qrMatrix) functions(ver int) {
+	size := m.size
+	for j := 0; j < size; j++ {
+		m.set(6, j, j%2 == 0)
+		m.set(j, 6, j%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					d := qrDist(dx, dy)
+					m.set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	pos := qrAlignment(ver)
+	last := len(pos) - 1
+	for i, px := range pos {
+		for j, py := range pos {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					m.set(px+dx, py+dy, qrDist(dx, dy) != 1)
+				}
+			}
+		}
+	}
+	// reserve the format information, drawn once the mask is chosen
+	m.format(0)
+	if ver >= 7 {
+		bits := qrVersionBits(ver)
+		for j := 0; j < 18; j++ {
+			dark := bits>>uint(j)&1 == 1
+			a, b := size-11+j%3, j/3
+			m.set(a, b, dark)
+			m.set(b, a, dark)
+		}
+	}
+}
+
+// format draws the format information bits
+func (m *qrMatrix) format(bits int) {
+	size := m.size
+	bit := func(j int) bool { return bits>>uint(j)&1 == 1 }
+	for j := 0; j <= 5; j++ {
+		m.set(8, j, bit(j))
+	}
+	m.set(8, 7, bit(6))
+	m.set(8, 8, bit(7))
+	m.set(7, 8, bit(8))
+	for j := 9; j < 15; j++ {
+		m.set(14-j, 8, bit(j))
+	}
+	for j := 0; j < 8; j++ {
+		m.set(size-1-j, 8, bit(j))
+	}
+	for j := 8; j < 15; j++ {
+		m.set(8, size-15+j, bit(j))
+	}
+	m.set(8, size-8, true)
+}
+
+func qrDist(dx, dy int) int {
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	if dx > dy {
+		return dx
+	}
+	return dy
+}
+
+// qrAlignment returns the positions of the alignment patterns of version ver
+func qrAlignment(ver int) []int {
+	if ver == 1 {
+		return nil
+	}
+	n := ver/7 + 2
+	step := (ver*8 + n*3 + 5) / (n*4 - 4) * 2
+	pos := make([]int, n)
+	pos[0] = 6
+	for j, p := n-1, ver*4+10; j >= 1; j, p = j-1, p-step {
+		pos[j] = p
+	}
+	return pos
+}
+
+// codewords places the codewords in the modules not taken by function
+// patterns, in the zigzag order of the specification
+func (m *qrMatrix) codewords(data []byte) {
+	size := m.size
+	k := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = size - 1 - vert
+				}
+				if !m.function[y][x] && k < len(data)*8 {
+					m.dark[y][x] = data[k>>3]>>uint(7-k&7)&1 == 1
+					k++
+				}
+			}
+		}
+	}
+}
+
+// qrMasked reports whether mask inverts the module at (x, y)
+func qrMasked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	}
+	return ((x+y)%2+x*y%3)%2 == 0
+}
+
+// mask inverts the data modules selected by mask
+func (m *qrMatrix) mask(mask int) {
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if !m.function[y][x] && qrMasked(mask, x, y) {
+				m.dark[y][x] = !m.dark[y][x]
+			}
+		}
+	}
+}
+
+// penalty rates how hard the symbol is to read, following the four rules of
+// the specification
+func (m *qrMatrix) penalty() (score int) {
+	size := m.size
+	finder := func(line []bool) {
+		run, prev := 0, false
+		for j, d := range line {
+			if j > 0 && d == prev {
+				run++
+			} else {
+				if run >= 5 {
+					score += run - 2
+				}
+				run, prev = 1, d
+			}
+		}
+		if run >= 5 {
+			score += run - 2
+		}
+		// a 1:1:3:1:1 pattern with four light modules on either side
+		pattern := []bool{true, false, true, true, true, false, true}
+		for j := 0; j+7 <= len(line); j++ {
+			match := true
+			for k, p := range pattern {
+				match = match && line[j+k] == p
+			}
+			if !match {
+				continue
+			}
+			for _, side := range [][2]int{{j - 4, j}, {j + 7, j + 11}} {
+				light := true
+				for k := side[0]; k < side[1]; k++ {
+					light = light && (k < 0 || k >= len(line) || !line[k])
+				}
+				if light {
+					score += 40
+				}
+			}
+		}
+	}
+	col := make([]bool, size)
+	dark := 0
+	for y := 0; y < size; y++ {
+		finder(m.dark[y])
+		for x := 0; x < size; x++ {
+			col[x] = m.dark[x][y]
+			if m.dark[y][x] {
+				dark++
+			}
+			if x+1 < size && y+1 < size {
+				d := m.dark[y][x]
+				if m.dark[y][x+1] == d && m.dark[y+1][x] == d && m.dark[y+1][x+1] == d {
+					score += 3
+				}
+			}
+		}
+		finder(col)
+	}
+	total := size * size
+	diff := dark*20 - total*10
+	if diff < 0 {
+		diff = -diff
+	}
+	if k := (diff + total - 1) / total; k > 1 {
+		score += (k - 1) * 10
+	}
+	return score
+}
+
+// qrEncode returns the modules of the QR code of text at error correction
+// level lvl (0 to 3 for L, M, Q and H), choosing the mask with the lowest
+// penalty
+func qrEncode(text string, lvl int) (*qrMatrix, bool) {
+	ver, data, ok := qrCodewords(text, lvl)
+	if !ok {
+		return nil, false
+	}
+	data = qrInterleave(data, ver, lvl)
+	var best *qrMatrix
+	bestScore := 0
+	for mask := 0; mask < 8; mask++ {
+		size := ver*4 + 17
+		m := &qrMatrix{size: size, dark: make([][]bool, size), function: make([][]bool, size)}
+		for j := range m.dark {
+			m.dark[j] = make([]bool, size)
+			m.function[j] = make([]bool, size)
+		}
+		m.functions(ver)
+		m.codewords(data)
+		m.mask(mask)
+		m.format(qrFormatBits(lvl, mask))
+		if score := m.penalty(); best == nil || score < bestScore {
+			best, bestScore = m, score
+		}
+	}
+	return best, true
+}
+
+// BarcodeQR draws a QR code of text as a square of the specified size with
+// its upper left corner at (x, y). levelStr selects the error correction
+// level: "L", "M" (the default), "Q" or "H". The dark modules are filled with
+// the current fill color; the quiet zone of four modules around the symbol is
+// left to the caller. Text that consists of digits or of the upper case
+// alphanumeric characters of QR codes is encoded compactly, other text is
+// encoded as UTF-8 bytes.
+func (f *Bdf) BarcodeQR(x, y, size float64, text, levelStr string) {
+	if f.err != nil {
+		return
+	}
+	lvl := strings.Index("LMQH", strings.ToUpper(levelStr))
+	if levelStr == "" {
+		lvl = 1
+	}
+	if lvl < 0 || len(levelStr) > 1 {
+		f.SetErrorf("invalid QR code error correction level %q", levelStr)
+		return
+	}
+	if !utf8.ValidString(text) {
+		f.SetErrorf("QR code text is not valid UTF-8")
+		return
+	}
+	m, ok := qrEncode(text, lvl)
+	if !ok {
+		f.SetErrorf("text of %d bytes is too long for a QR code", len(text))
+		return
+	}
+	unit := size / float64(m.size)
+	for row := 0; row < m.size; row++ {
+		for col := 0; col < m.size; {
+			if !m.dark[row][col] {
+				col++
+				continue
+			}
+			end := col
+			for end < m.size && m.dark[row][end] {
+				end++
+			}
+			f.Rect(x+float64(col)*unit, y+float64(row)*unit, float64(end-col)*unit, unit, "F")
+			col = end
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCode128(t *testing.T) {
+	for j, p := range code128Patterns {
+		sum := 0
+		for _, c := range p {
+			sum += int(c - '0')
+		}
+		if (j < code128Stop && sum != 11) || (j == code128Stop && sum != 13) {
+			t.Fatalf("pattern %d has %d modules", j, sum)
+		}
+	}
+	for _, tc := range []struct {
+		code string
+		want []int
+	}{
+		{"Wikipedia", []int{104, 55, 73, 75, 73, 80, 69, 68, 73, 65, 88, 106}},
+		{"1234567890", []int{105, 12, 34, 56, 78, 90, 85, 106}},
+		{"12345", []int{105, 12, 34, 100, 21, 54, 106}},
+		{"AB12345", []int{104, 33, 34, 17, 99, 23, 45, 7, 106}},
+		{"\tx", []int{103, 73, 100, 88, 22, 106}},
+	} {
+		got, ok := code128Symbols(tc.code)
+		if !ok || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q encoded as %v", tc.code, got)
+		}
+	}
+	pdf := New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.BarcodeCode128(10, 10, 60, 15, "é")
+	if !pdf.Err() {
+		t.Fatal("expected error for non-ASCII text")
+	}
+}
+
+func TestQRCode(t *testing.T) {
+	// the example of the tutorial at thonky.com
+	ver, data, ok := qrCodewords("HELLO WORLD", 2)
+	want := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236}
+	if !ok || ver != 1 || !bytes.Equal(data, want) {
+		t.Fatalf("version %d data %v", ver, data)
+	}
+	ecc := qrRemainder(data, qrDivisor(13))
+	if want := []byte{168, 72, 22, 82, 217, 54, 156, 0, 46, 15, 180, 122, 16}; !bytes.Equal(ecc, want) {
+		t.Fatalf("error correction %v", ecc)
+	}
+	if bits := qrFormatBits(0, 4); bits != 0x662F {
+		t.Fatalf("format bits %015b", bits)
+	}
+	if bits := qrVersionBits(7); bits != 0x07C94 {
+		t.Fatalf("version bits %018b", bits)
+	}
+	if pos := qrAlignment(32); !reflect.DeepEqual(pos, []int{6, 34, 60, 86, 112, 138}) {
+		t.Fatalf("alignment positions %v", pos)
+	}
+	// capacities of the smallest and the largest versions
+	for _, tc := range []struct {
+		text     string
+		lvl, ver int
+	}{
+		{strings.Repeat("1", 41), 0, 1},
+		{strings.Repeat("1", 42), 0, 2},
+		{strings.Repeat("A", 25), 0, 1},
+		{strings.Repeat("a", 7), 3, 1},
+		{strings.Repeat("1", 7089), 0, 40},
+		{strings.Repeat("A", 1852), 3, 40},
+		{strings.Repeat("a", 2953), 0, 40},
+		{strings.Repeat("a", 2954), 0, 0},
+	} {
+		if ver, _, _ := qrCodewords(tc.text, tc.lvl); ver != tc.ver {
+			t.Errorf("%d characters at level %d need version %d, not %d", len(tc.text), tc.lvl, ver, tc.ver)
+		}
+	}
+	m, _ := qrEncode("https://bhojpur.net", 1)
+	if m.size != 25 || !m.dark[0][0] || m.dark[1][1] || !m.dark[m.size-8][8] {
+		t.Fatal("unexpected symbol layout")
+	}
+
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.AddPage()
+	pdf.BarcodeQR(10, 10, 25, "https://bhojpur.net", "")
+	if pdf.Err() {
+		t.Fatal(pdf.Error())
+	}
+	pdf.BarcodeQR(10, 10, 25, "x", "Z")
+	if !pdf.Err() {
+		t.Fatal("expected error for invalid level")
+	}
+}
@@ -0,0 +1,583 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"golang.org/x/text/unicode/bidi"
+)
+
+// The functions in this file implement the parts of the Unicode
+// Bidirectional Algorithm (UAX #9) needed to lay out a single line of text:
+// resolution of embedding levels, including explicit embeddings, overrides
+// and isolates, and reordering of runs for display.
+
+const bidiMaxDepth = 125
+
+type bidiStatus struct {
+	level    int8
+	override bidi.Class // ON when there is no override
+	isolate  bool
+}
+
+// bidiClasses returns the bidirectional character types of text.
+func bidiClasses(text []rune) []bidi.Class {
+	types := make([]bidi.Class, len(text))
+	for i, r := range text {
+		p, _ := bidi.LookupRune(r)
+		types[i] = p.Class()
+	}
+	return types
+}
+
+func bidiIsIsolateInitiator(c bidi.Class) bool {
+	return c == bidi.LRI || c == bidi.RLI || c == bidi.FSI
+}
+
+func bidiIsRemoved(c bidi.Class) bool {
+	switch c {
+	case bidi.LRE, bidi.RLE, bidi.LRO, bidi.RLO, bidi.PDF, bidi.BN:
+		return true
+	}
+	return false
+}
+
+func bidiIsNeutral(c bidi.Class) bool {
+	switch c {
+	case bidi.B, bidi.S, bidi.WS, bidi.ON, bidi.LRI, bidi.RLI, bidi.FSI, bidi.PDI:
+		return true
+	}
+	return false
+}
+
+// bidiMatchingPDI pairs every isolate initiator with its matching PDI
+// (rule BD9). Unmatched initiators map to len(types).
+func bidiMatchingPDI(types []bidi.Class) (match []int, opener []int) {
+	match = make([]int, len(types))
+	opener = make([]int, len(types))
+	var stack []int
+	for i, c := range types {
+		match[i] = -1
+		opener[i] = -1
+		switch {
+		case bidiIsIsolateInitiator(c):
+			stack = append(stack, i)
+		case c == bidi.PDI && len(stack) > 0:
+			o := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			match[o] = i
+			opener[i] = o
+		case c == bidi.B:
+			stack = stack[:0]
+		}
+	}
+	for _, o := range stack {
+		match[o] = len(types)
+	}
+	return
+}
+
+// bidiFirstStrong applies rules P2 and P3 to types[from:to] and returns
+// the resulting level, or -1 if there is no strong character.
+func bidiFirstStrong(types []bidi.Class, match []int, from, to int) int8 {
+	for i := from; i < to; i++ {
+		switch c := types[i]; {
+		case c == bidi.L:
+			return 0
+		case c == bidi.R || c == bidi.AL:
+			return 1
+		case bidiIsIsolateInitiator(c):
+			if match[i] < 0 || match[i] >= to {
+				return -1
+			}
+			i = match[i]
+		}
+	}
+	return -1
+}
+
+// bidiLevels resolves the embedding level of every rune of a line of text.
+// The paragraph level is 1 when rtl is set; otherwise it is determined by
+// the first strong character. The resolved paragraph level is returned
+// along with the levels.
+func bidiLevels(text []rune, rtl bool) (levels []int8, paraLevel int8) {
+	n := len(text)
+	orig := bidiClasses(text)
+	types := make([]bidi.Class, n)
+	copy(types, orig)
+	match, opener := bidiMatchingPDI(types)
+	if !rtl {
+		paraLevel = bidiFirstStrong(types, match, 0, n)
+		if paraLevel < 0 {
+			paraLevel = 0
+		}
+	} else {
+		paraLevel = 1
+	}
+	levels = make([]int8, n)
+
+	// X1-X8: explicit levels and directions
+	stack := []bidiStatus{{level: paraLevel, override: bidi.ON}}
+	overflowIsolates, overflowEmbeddings, validIsolates := 0, 0, 0
+	for i := 0; i < n; i++ {
+		top := stack[len(stack)-1]
+		switch c := types[i]; c {
+		case bidi.RLE, bidi.LRE, bidi.RLO, bidi.LRO:
+			levels[i] = top.level
+			var next int8
+			if c == bidi.RLE || c == bidi.RLO {
+				next = (top.level + 1) | 1
+			} else {
+				next = (top.level + 2) &^ 1
+			}
+			if next <= bidiMaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				st := bidiStatus{level: next, override: bidi.ON}
+				if c == bidi.RLO {
+					st.override = bidi.R
+				} else if c == bidi.LRO {
+					st.override = bidi.L
+				}
+				stack = append(stack, st)
+			} else if overflowIsolates == 0 {
+				overflowEmbeddings++
+			}
+		case bidi.RLI, bidi.LRI, bidi.FSI:
+			levels[i] = top.level
+			if top.override != bidi.ON {
+				types[i] = top.override
+			}
+			isRTL := c == bidi.RLI
+			if c == bidi.FSI {
+				end := match[i]
+				if end < 0 {
+					end = n
+				}
+				isRTL = bidiFirstStrong(orig, match, i+1, end) == 1
+			}
+			var next int8
+			if isRTL {
+				next = (top.level + 1) | 1
+			} else {
+				next = (top.level + 2) &^ 1
+			}
+			if next <= bidiMaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				validIsolates++
+				stack = append(stack, bidiStatus{level: next, override: bidi.ON, isolate: true})
+			} else {
+				overflowIsolates++
+			}
+		case bidi.PDI:
+			if overflowIsolates > 0 {
+				overflowIsolates--
+			} else if validIsolates > 0 {
+				overflowEmbeddings = 0
+				for !stack[len(stack)-1].isolate {
+					stack = stack[:len(stack)-1]
+				}
+				stack = stack[:len(stack)-1]
+				validIsolates--
+			}
+			top = stack[len(stack)-1]
+			levels[i] = top.level
+			if top.override != bidi.ON {
+				types[i] = top.override
+			}
+		case bidi.PDF:
+			levels[i] = top.level
+			if overflowIsolates > 0 {
+				// nothing to do
+			} else if overflowEmbeddings > 0 {
+				overflowEmbeddings--
+			} else if !top.isolate && len(stack) >= 2 {
+				stack = stack[:len(stack)-1]
+			}
+		case bidi.B:
+			levels[i] = paraLevel
+		case bidi.BN:
+			levels[i] = top.level
+		default:
+			levels[i] = top.level
+			if top.override != bidi.ON {
+				types[i] = top.override
+			}
+		}
+	}
+
+	// X9, X10: level runs and isolating run sequences
+	var runs [][]int
+	var cur []int
+	for i := 0; i < n; i++ {
+		if bidiIsRemoved(orig[i]) {
+			continue
+		}
+		if len(cur) > 0 && levels[cur[len(cur)-1]] != levels[i] {
+			runs = append(runs, cur)
+			cur = nil
+		}
+		cur = append(cur, i)
+	}
+	if len(cur) > 0 {
+		runs = append(runs, cur)
+	}
+	runOf := make(map[int]int)
+	for k, run := range runs {
+		runOf[run[0]] = k
+	}
+	for _, run := range runs {
+		first := run[0]
+		if orig[first] == bidi.PDI && opener[first] >= 0 {
+			// continuation of a sequence started by an isolate initiator
+			continue
+		}
+		seq := append([]int(nil), run...)
+		for {
+			last := seq[len(seq)-1]
+			if !bidiIsIsolateInitiator(orig[last]) || match[last] < 0 || match[last] >= n {
+				break
+			}
+			k, ok := runOf[match[last]]
+			if !ok {
+				break
+			}
+			seq = append(seq, runs[k]...)
+		}
+		bidiResolveSequence(text, orig, types, levels, seq, match, paraLevel)
+	}
+
+	// removed characters take the level of the preceding character
+	for i := 0; i < n; i++ {
+		if bidiIsRemoved(orig[i]) {
+			if i > 0 {
+				levels[i] = levels[i-1]
+			} else {
+				levels[i] = paraLevel
+			}
+		}
+	}
+
+	// L1: separators and trailing whitespace revert to the paragraph level
+	trailing := true
+	for i := n - 1; i >= 0; i-- {
+		switch c := orig[i]; {
+		case c == bidi.B || c == bidi.S:
+			levels[i] = paraLevel
+			trailing = true
+		case c == bidi.WS || bidiIsIsolateInitiator(c) || c == bidi.PDI || bidiIsRemoved(c):
+			if trailing {
+				levels[i] = paraLevel
+			}
+		default:
+			trailing = false
+		}
+	}
+	return
+}
+
+// bidiResolveSequence applies the weak, neutral and implicit rules to one
+// isolating run sequence whose character indexes are given by seq.
+func bidiResolveSequence(text []rune, orig, types []bidi.Class, levels []int8, seq, match []int, paraLevel int8) {
+	level := levels[seq[0]]
+	dirOf := func(l int8) bidi.Class {
+		if l&1 == 1 {
+			return bidi.R
+		}
+		return bidi.L
+	}
+	// sos and eos
+	prevLevel := paraLevel
+	for i := seq[0] - 1; i >= 0; i-- {
+		if !bidiIsRemoved(orig[i]) {
+			prevLevel = levels[i]
+			break
+		}
+	}
+	nextLevel := paraLevel
+	last := seq[len(seq)-1]
+	if !(bidiIsIsolateInitiator(orig[last]) && (match[last] < 0 || match[last] >= len(orig))) {
+		for i := last + 1; i < len(orig); i++ {
+			if !bidiIsRemoved(orig[i]) {
+				nextLevel = levels[i]
+				break
+			}
+		}
+	}
+	if prevLevel < level {
+		prevLevel = level
+	}
+	if nextLevel < level {
+		nextLevel = level
+	}
+	sos, eos := dirOf(prevLevel), dirOf(nextLevel)
+	t := make([]bidi.Class, len(seq))
+	for k, i := range seq {
+		t[k] = types[i]
+	}
+
+	// W1
+	prev := sos
+	for k := range t {
+		if t[k] == bidi.NSM {
+			if bidiIsIsolateInitiator(prev) || prev == bidi.PDI {
+				t[k] = bidi.ON
+			} else {
+				t[k] = prev
+			}
+		}
+		prev = t[k]
+	}
+	// W2, W3
+	strong := sos
+	for k := range t {
+		switch t[k] {
+		case bidi.L, bidi.R, bidi.AL:
+			strong = t[k]
+		case bidi.EN:
+			if strong == bidi.AL {
+				t[k] = bidi.AN
+			}
+		}
+	}
+	for k := range t {
+		if t[k] == bidi.AL {
+			t[k] = bidi.R
+		}
+	}
+	// W4
+	for k := 1; k+1 < len(t); k++ {
+		if t[k] == bidi.ES && t[k-1] == bidi.EN && t[k+1] == bidi.EN {
+			t[k] = bidi.EN
+		} else if t[k] == bidi.CS && t[k-1] == t[k+1] && (t[k-1] == bidi.EN || t[k-1] == bidi.AN) {
+			t[k] = t[k-1]
+		}
+	}
+	// W5
+	for k := 0; k < len(t); k++ {
+		if t[k] != bidi.ET {
+			continue
+		}
+		end := k
+		for end < len(t) && t[end] == bidi.ET {
+			end++
+		}
+		if (k > 0 && t[k-1] == bidi.EN) || (end < len(t) && t[end] == bidi.EN) {
+			for j := k; j < end; j++ {
+				t[j] = bidi.EN
+			}
+		}
+		k = end - 1
+	}
+	// W6
+	for k := range t {
+		switch t[k] {
+		case bidi.ES, bidi.ET, bidi.CS:
+			t[k] = bidi.ON
+		}
+	}
+	// W7
+	strong = sos
+	for k := range t {
+		switch t[k] {
+		case bidi.L, bidi.R:
+			strong = t[k]
+		case bidi.EN:
+			if strong == bidi.L {
+				t[k] = bidi.L
+			}
+		}
+	}
+
+	// N0: paired brackets
+	embedding := dirOf(level)
+	strongOf := func(c bidi.Class) bidi.Class {
+		switch c {
+		case bidi.L:
+			return bidi.L
+		case bidi.R, bidi.EN, bidi.AN:
+			return bidi.R
+		}
+		return bidi.ON
+	}
+	type bracketPair struct{ open, close int }
+	var pairs []bracketPair
+	type opening struct {
+		pos   int
+		match rune
+	}
+	var openers []opening
+	for k, i := range seq {
+		if t[k] != bidi.ON {
+			continue
+		}
+		p, _ := bidi.LookupRune(text[i])
+		if !p.IsBracket() {
+			continue
+		}
+		if p.IsOpeningBracket() {
+			if len(openers) == 63 {
+				break
+			}
+			openers = append(openers, opening{k, bidiMirror(text[i])})
+			continue
+		}
+		for j := len(openers) - 1; j >= 0; j-- {
+			if openers[j].match == text[i] {
+				pairs = append(pairs, bracketPair{openers[j].pos, k})
+				openers = openers[:j]
+				break
+			}
+		}
+	}
+	// pairs are processed in order of their opening brackets
+	for a := 1; a < len(pairs); a++ {
+		for b := a; b > 0 && pairs[b].open < pairs[b-1].open; b-- {
+			pairs[b], pairs[b-1] = pairs[b-1], pairs[b]
+		}
+	}
+	for _, pr := range pairs {
+		found := bidi.ON
+		for k := pr.open + 1; k < pr.close; k++ {
+			if s := strongOf(t[k]); s == embedding {
+				found = embedding
+				break
+			} else if s != bidi.ON {
+				found = s
+			}
+		}
+		if found == bidi.ON {
+			continue
+		}
+		if found != embedding {
+			ctx := sos
+			for k := pr.open - 1; k >= 0; k-- {
+				if s := strongOf(t[k]); s != bidi.ON {
+					ctx = s
+					break
+				}
+			}
+			if ctx != found {
+				found = embedding
+			}
+		}
+		t[pr.open], t[pr.close] = found, found
+		for _, k := range []int{pr.open, pr.close} {
+			for j := k + 1; j < len(t) && orig[seq[j]] == bidi.NSM; j++ {
+				t[j] = found
+			}
+		}
+	}
+
+	// N1, N2
+	for k := 0; k < len(t); k++ {
+		if !bidiIsNeutral(t[k]) {
+			continue
+		}
+		end := k
+		for end < len(t) && bidiIsNeutral(t[end]) {
+			end++
+		}
+		before := sos
+		if k > 0 {
+			before = strongOf(t[k-1])
+		}
+		after := eos
+		if end < len(t) {
+			after = strongOf(t[end])
+		}
+		dir := embedding
+		if before == after && before != bidi.ON {
+			dir = before
+		}
+		for j := k; j < end; j++ {
+			t[j] = dir
+		}
+		k = end - 1
+	}
+
+	// I1, I2
+	for k, i := range seq {
+		l := levels[i]
+		if l&1 == 0 {
+			switch t[k] {
+			case bidi.R:
+				levels[i] = l + 1
+			case bidi.AN, bidi.EN:
+				levels[i] = l + 2
+			}
+		} else {
+			switch t[k] {
+			case bidi.L, bidi.EN, bidi.AN:
+				levels[i] = l + 1
+			}
+		}
+		types[i] = t[k]
+	}
+}
+
+// bidiReorder applies rule L2 to a sequence of items with the given levels
+// and returns the item indexes in visual order.
+func bidiReorder(levels []int8) []int {
+	order := make([]int, len(levels))
+	var high, low int8 = 0, 127
+	for i, l := range levels {
+		order[i] = i
+		if l > high {
+			high = l
+		}
+		if l&1 == 1 && l < low {
+			low = l
+		}
+	}
+	for l := high; l >= low && l > 0; l-- {
+		for i := 0; i < len(order); i++ {
+			if levels[order[i]] < l {
+				continue
+			}
+			j := i
+			for j < len(order) && levels[order[j]] >= l {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				order[a], order[b] = order[b], order[a]
+			}
+			i = j
+		}
+	}
+	return order
+}
+
+var bidiMirrors = map[rune]rune{
+	'<': '>', '>': '<', '«': '»', '»': '«', '‹': '›', '›': '‹',
+	'≤': '≥', '≥': '≤', '≪': '≫', '≫': '≪', '⊂': '⊃', '⊃': '⊂',
+	'⊆': '⊇', '⊇': '⊆', '∈': '∋', '∋': '∈',
+}
+
+// bidiMirror returns the mirrored counterpart of r, used for characters
+// displayed at an odd embedding level, or r itself when it has none.
+func bidiMirror(r rune) rune {
+	if m, ok := bidiMirrors[r]; ok {
+		return m
+	}
+	if p, _ := bidi.LookupRune(r); p.IsBracket() {
+		if rs := []rune(bidi.ReverseString(string(r))); len(rs) == 1 {
+			return rs[0]
+		}
+	}
+	return r
+}
@@ -0,0 +1,269 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// A minimal builder for the Cryptographic Message Syntax (RFC 5652) signed
+// data used by PDF signatures and RFC 3161 time-stamp tokens.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+var (
+	oidData                  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttrContentType       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningCertV2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidAttrTimeStampToken    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	oidTSTInfo               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidSHA256                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidRSAWithSHA256         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidRSAWithSHA384         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidRSAWithSHA512         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSAWithSHA256       = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384       = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512       = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	asn1Null                 = []byte{0x05, 0x00}
+	errUnsupportedSignerHash = fmt.Errorf("unsupported signature hash; use SHA-256, SHA-384 or SHA-512")
+)
+
+// der wraps content in a DER element with the given identifier octet
+func der(tag byte, content ...[]byte) []byte {
+	n := 0
+	for _, c := range content {
+		n += len(c)
+	}
+	out := []byte{tag}
+	switch {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n < 0x100:
+		out = append(out, 0x81, byte(n))
+	case n < 0x10000:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	for _, c := range content {
+		out = append(out, c...)
+	}
+	return out
+}
+
+// derSeq returns a DER SEQUENCE of the encoded elements
+func derSeq(elems ...[]byte) []byte {
+	return der(0x30, elems...)
+}
+
+// derSet returns a DER SET OF the encoded elements, sorted as DER requires
+func derSet(tag byte, elems ...[]byte) []byte {
+	sorted := append([][]byte(nil), elems...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	return der(tag, sorted...)
+}
+
+// mustMarshal encodes values whose encoding cannot fail
+func mustMarshal(v interface{}) []byte {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func derOctets(b []byte) []byte {
+	return der(0x04, b)
+}
+
+// digestAlgorithm returns the algorithm identifier of h
+func digestAlgorithm(h crypto.Hash) ([]byte, error) {
+	var oid asn1.ObjectIdentifier
+	switch h {
+	case crypto.SHA256:
+		oid = oidSHA256
+	case crypto.SHA384:
+		oid = oidSHA384
+	case crypto.SHA512:
+		oid = oidSHA512
+	default:
+		return nil, errUnsupportedSignerHash
+	}
+	return derSeq(mustMarshal(oid), asn1Null), nil
+}
+
+// digestHash returns the hash function identified by oid
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+// signatureAlgorithm returns the algorithm identifier of signatures made by
+// signer with digests of type h
+func signatureAlgorithm(signer crypto.Signer, h crypto.Hash) ([]byte, error) {
+	idx := map[crypto.Hash]int{crypto.SHA256: 0, crypto.SHA384: 1, crypto.SHA512: 2}
+	j, ok := idx[h]
+	if !ok {
+		return nil, errUnsupportedSignerHash
+	}
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		oid := []asn1.ObjectIdentifier{oidRSAWithSHA256, oidRSAWithSHA384, oidRSAWithSHA512}[j]
+		return derSeq(mustMarshal(oid), asn1Null), nil
+	case *ecdsa.PublicKey:
+		oid := []asn1.ObjectIdentifier{oidECDSAWithSHA256, oidECDSAWithSHA384, oidECDSAWithSHA512}[j]
+		return derSeq(mustMarshal(oid)), nil
+	}
+	return nil, fmt.Errorf("unsupported signer key type %T", signer.Public())
+}
+
+// cmsAttribute encodes an attribute with a single value
+func cmsAttribute(oid asn1.ObjectIdentifier, value []byte) []byte {
+	return derSeq(mustMarshal(oid), derSet(0x31, value))
+}
+
+// signingCertificateV2 encodes the ESS attribute value binding the signer's
+// certificate to the signature (RFC 5035)
+func signingCertificateV2(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.Raw)
+	issuerSerial := derSeq(
+		derSeq(der(0xa4, cert.RawIssuer)), // GeneralNames with a directoryName
+		mustMarshal(cert.SerialNumber))
+	return derSeq(derSeq(derSeq(derOctets(sum[:]), issuerSerial)))
+}
+
+// cmsSigner describes the parties and parameters of a signed data structure
+type cmsSigner struct {
+	signer   crypto.Signer
+	certs    []*x509.Certificate // signer certificate first
+	hash     crypto.Hash
+	unsigned func(signature []byte) ([][]byte, error)
+}
+
+// sign returns a DER encoded ContentInfo holding signed data over content.
+// The content is embedded unless detached is set.
+func (s cmsSigner) sign(contentType asn1.ObjectIdentifier, content []byte, detached bool) ([]byte, error) {
+	if s.signer == nil || len(s.certs) == 0 {
+		return nil, fmt.Errorf("a signer and its certificate are required")
+	}
+	digestAlg, err := digestAlgorithm(s.hash)
+	if err != nil {
+		return nil, err
+	}
+	sigAlg, err := signatureAlgorithm(s.signer, s.hash)
+	if err != nil {
+		return nil, err
+	}
+	h := s.hash.New()
+	h.Write(content)
+	attrs := [][]byte{
+		cmsAttribute(oidAttrContentType, mustMarshal(contentType)),
+		cmsAttribute(oidAttrMessageDigest, derOctets(h.Sum(nil))),
+		cmsAttribute(oidAttrSigningCertV2, signingCertificateV2(s.certs[0])),
+	}
+	// the signature covers the DER encoding of the attributes as a SET
+	signedAttrs := derSet(0x31, attrs...)
+	h = s.hash.New()
+	h.Write(signedAttrs)
+	signature, err := s.signer.Sign(rand.Reader, h.Sum(nil), s.hash)
+	if err != nil {
+		return nil, err
+	}
+	cert := s.certs[0]
+	signerInfo := [][]byte{
+		mustMarshal(1),
+		derSeq(cert.RawIssuer, mustMarshal(cert.SerialNumber)),
+		digestAlg,
+		der(0xa0, signedAttrs[headerLen(signedAttrs):]),
+		sigAlg,
+		derOctets(signature),
+	}
+	if s.unsigned != nil {
+		unsigned, err := s.unsigned(signature)
+		if err != nil {
+			return nil, err
+		}
+		if len(unsigned) > 0 {
+			signerInfo = append(signerInfo, derSet(0xa1, unsigned...))
+		}
+	}
+	encap := [][]byte{mustMarshal(contentType)}
+	if !detached {
+		encap = append(encap, der(0xa0, derOctets(content)))
+	}
+	var certs [][]byte
+	for _, c := range s.certs {
+		certs = append(certs, c.Raw)
+	}
+	// RFC 5652: version 3 when the encapsulated content is not id-data
+	version := 1
+	if !contentType.Equal(oidData) {
+		version = 3
+	}
+	signedData := derSeq(
+		mustMarshal(version),
+		derSet(0x31, digestAlg),
+		derSeq(encap...),
+		derSet(0xa0, certs...),
+		derSet(0x31, derSeq(signerInfo...)),
+	)
+	return derSeq(mustMarshal(oidSignedData), der(0xa0, signedData)), nil
+}
+
+// headerLen returns the size of the identifier and length octets of a DER
+// element
+func headerLen(b []byte) int {
+	if b[1] < 0x80 {
+		return 2
+	}
+	return 2 + int(b[1]&0x7f)
+}
+
+// randomSerial returns a positive 64-bit serial number
+func randomSerial() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+	return n.Add(n, big.NewInt(1))
+}
+
+// generalizedTime encodes t in UTC with second precision
+func generalizedTime(t time.Time) []byte {
+	return der(0x18, []byte(t.UTC().Format("20060102150405Z")))
+}
@@ -0,0 +1,340 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"sort"
+)
+
+// colorProfileType is an ICC profile registered with AddColorProfile
+type colorProfileType struct {
+	id   int
+	n    int // number of color components
+	data []byte
+}
+
+// iccComponents returns the number of color components of the ICC profile,
+// taken from the data color space field of its header
+func iccComponents(profile []byte) (n int, err error) {
+	if len(profile) < 128 || string(profile[36:40]) != "acsp" {
+		return 0, fmt.Errorf("invalid ICC profile")
+	}
+	switch string(profile[16:20]) {
+	case "GRAY":
+		n = 1
+	case "RGB ", "Lab ", "XYZ ", "CMY ":
+		n = 3
+	case "CMYK":
+		n = 4
+	default:
+		err = fmt.Errorf("unsupported ICC profile color space \"%s\"", profile[16:20])
+	}
+	return
+}
+
+func iccKey(profile []byte) string {
+	return fmt.Sprintf("%x", sha1.Sum(profile))
+}
+
+// AddColorProfile adds the ICC profile to the Bdf instance and associates it
+// with the specified name. The profile defines an ICC-based color space that
+// can be used with SetDrawColorICC(), SetFillColorICC() and SetTextColorICC()
+// and assigned to images with the ColorProfile field of ImageOptions.
+// Profiles for gray, RGB, Lab and CMYK data are supported. An error occurs if
+// the profile is not valid or if the name is already associated with a
+// profile.
+func (f *Bdf) AddColorProfile(nameStr string, profile []byte) {
+	if f.err != nil {
+		return
+	}
+	if _, ok := f.colorProfiles[nameStr]; ok {
+		f.err = fmt.Errorf("name \"%s\" is already associated with a color profile", nameStr)
+		return
+	}
+	n, err := iccComponents(profile)
+	if err != nil {
+		f.err = err
+		return
+	}
+	f.colorProfiles[nameStr] = colorProfileType{
+		id:   len(f.colorProfiles) + 1,
+		n:    n,
+		data: append([]byte(nil), profile...),
+	}
+}
+
+func (f *Bdf) getColorProfile(nameStr string) (prof colorProfileType, ok bool) {
+	if f.err == nil {
+		prof, ok = f.colorProfiles[nameStr]
+		if !ok {
+			f.err = fmt.Errorf("color profile name \"%s\" is not registered", nameStr)
+		}
+	}
+	return
+}
+
+func (f *Bdf) applyDrawColor(clr colorType) {
+	f.color.draw = clr
+	if f.page > 0 {
+		f.out(f.color.draw.str)
+	}
+}
+
+func (f *Bdf) applyFillColor(clr colorType) {
+	f.color.fill = clr
+	f.colorFlag = f.color.fill.str != f.color.text.str
+	if f.page > 0 {
+		f.out(f.color.fill.str)
+	}
+}
+
+func (f *Bdf) applyTextColor(clr colorType) {
+	f.color.text = clr
+	f.colorFlag = f.color.fill.str != f.color.text.str
+}
+
+func cmykColorValue(c, m, y, k byte, op string) (clr colorType) {
+	clr.mode = colorModeCMYK
+	clr.cmyk = cmykColorType{c: byteBound(c), m: byteBound(m), y: byteBound(y), k: byteBound(k)}
+	clr.str = sprintf("%.3f %.3f %.3f %.3f %s", float64(clr.cmyk.c)/100, float64(clr.cmyk.m)/100,
+		float64(clr.cmyk.y)/100, float64(clr.cmyk.k)/100, op)
+	return
+}
+
+// SetDrawColorCMYK defines the color used for all drawing operations as a
+// device CMYK color. The individual components specify ink percentages
+// ranging from 0 to 100. Values above this are quietly capped to 100. Unlike
+// SetDrawColor(), the color is written to the document as is, so it reaches
+// the printer without conversion from RGB.
+func (f *Bdf) SetDrawColorCMYK(c, m, y, k byte) {
+	f.pdfa.cmyk = true
+	f.applyDrawColor(cmykColorValue(c, m, y, k, "K"))
+}
+
+// SetFillColorCMYK defines the color used for all filling operations as a
+// device CMYK color. See SetDrawColorCMYK() for the range of the components.
+func (f *Bdf) SetFillColorCMYK(c, m, y, k byte) {
+	f.pdfa.cmyk = true
+	f.applyFillColor(cmykColorValue(c, m, y, k, "k"))
+}
+
+// SetTextColorCMYK defines the color used for text as a device CMYK color.
+// See SetDrawColorCMYK() for the range of the components.
+func (f *Bdf) SetTextColorCMYK(c, m, y, k byte) {
+	f.pdfa.cmyk = true
+	f.applyTextColor(cmykColorValue(c, m, y, k, "k"))
+}
+
+// GetDrawColorCMYK returns the most recently set CMYK draw color as ink
+// percentages. This will not be the current value if a draw color of some
+// other type has been more recently set.
+func (f *Bdf) GetDrawColorCMYK() (c, m, y, k byte) {
+	clr := f.color.draw.cmyk
+	return clr.c, clr.m, clr.y, clr.k
+}
+
+// GetFillColorCMYK returns the most recently set CMYK fill color as ink
+// percentages. This will not be the current value if a fill color of some
+// other type has been more recently set.
+func (f *Bdf) GetFillColorCMYK() (c, m, y, k byte) {
+	clr := f.color.fill.cmyk
+	return clr.c, clr.m, clr.y, clr.k
+}
+
+// GetTextColorCMYK returns the most recently set CMYK text color as ink
+// percentages. This will not be the current value if a text color of some
+// other type has been more recently set.
+func (f *Bdf) GetTextColorCMYK() (c, m, y, k byte) {
+	clr := f.color.text.cmyk
+	return clr.c, clr.m, clr.y, clr.k
+}
+
+func (f *Bdf) grayColorValue(level int, grayStr string) (clr colorType) {
+	clr = f.rgbColorValue(level, level, level, grayStr, "")
+	clr.mode = colorModeGray
+	return
+}
+
+// SetDrawColorGray defines the color used for all drawing operations as a
+// level of device gray ranging from 0 (black) to 255 (white). GetDrawColor()
+// returns the level in each of its components.
+func (f *Bdf) SetDrawColorGray(level int) {
+	f.applyDrawColor(f.grayColorValue(level, "G"))
+}
+
+// SetFillColorGray defines the color used for all filling operations as a
+// level of device gray ranging from 0 (black) to 255 (white).
+func (f *Bdf) SetFillColorGray(level int) {
+	f.applyFillColor(f.grayColorValue(level, "g"))
+}
+
+// SetTextColorGray defines the color used for text as a level of device gray
+// ranging from 0 (black) to 255 (white).
+func (f *Bdf) SetTextColorGray(level int) {
+	f.applyTextColor(f.grayColorValue(level, "g"))
+}
+
+func (f *Bdf) iccColorValue(nameStr string, comps []float64, csOp, scOp string) (clr colorType, ok bool) {
+	var prof colorProfileType
+	prof, ok = f.getColorProfile(nameStr)
+	if !ok {
+		return
+	}
+	if len(comps) != prof.n {
+		f.err = fmt.Errorf("color profile \"%s\" requires %d components, got %d", nameStr, prof.n, len(comps))
+		return clr, false
+	}
+	var buf fmtBuffer
+	buf.printf("/ICC%d %s", prof.id, csOp)
+	for _, v := range comps {
+		if v < 0 {
+			v = 0
+		} else if v > 1 {
+			v = 1
+		}
+		buf.printf(" %.3f", v)
+	}
+	buf.printf(" %s", scOp)
+	clr.mode = colorModeICC
+	clr.spotStr = nameStr
+	clr.str = buf.String()
+	return
+}
+
+// SetDrawColorICC sets the current draw color to a color in the ICC-based
+// color space of the profile associated with nameStr by AddColorProfile().
+// One component ranging from 0 to 1 must be given for each component of the
+// profile, for example four for a CMYK profile. Values outside this range are
+// quietly bounded. An error occurs if the name is not associated with a
+// profile.
+func (f *Bdf) SetDrawColorICC(nameStr string, comps ...float64) {
+	if clr, ok := f.iccColorValue(nameStr, comps, "CS", "SCN"); ok {
+		f.applyDrawColor(clr)
+	}
+}
+
+// SetFillColorICC sets the current fill color to a color in the ICC-based
+// color space of the profile associated with nameStr. See SetDrawColorICC().
+func (f *Bdf) SetFillColorICC(nameStr string, comps ...float64) {
+	if clr, ok := f.iccColorValue(nameStr, comps, "cs", "scn"); ok {
+		f.applyFillColor(clr)
+	}
+}
+
+// SetTextColorICC sets the current text color to a color in the ICC-based
+// color space of the profile associated with nameStr. See SetDrawColorICC().
+func (f *Bdf) SetTextColorICC(nameStr string, comps ...float64) {
+	if clr, ok := f.iccColorValue(nameStr, comps, "cs", "scn"); ok {
+		f.applyTextColor(clr)
+	}
+}
+
+// imageColors returns the number of color components of the image's color
+// space; the base space of indexed images is RGB
+func imageColors(info *ImageInfoType) int {
+	switch info.cs {
+	case "DeviceGray":
+		return 1
+	case "DeviceCMYK":
+		return 4
+	}
+	return 3
+}
+
+// imageColorProfile assigns the named profile to the image or, if nameStr is
+// empty, checks that a profile embedded in the image fits its color space and
+// drops it otherwise
+func (f *Bdf) imageColorProfile(info *ImageInfoType, nameStr string) {
+	if nameStr == "" {
+		if len(info.icc) > 0 {
+			if n, err := iccComponents(info.icc); err != nil || n != imageColors(info) {
+				info.icc = nil
+			}
+		}
+		return
+	}
+	prof, ok := f.getColorProfile(nameStr)
+	if !ok {
+		return
+	}
+	if prof.n != imageColors(info) {
+		f.err = fmt.Errorf("color profile \"%s\" has %d components, image color space %s has %d",
+			nameStr, prof.n, info.cs, imageColors(info))
+		return
+	}
+	info.icc = prof.data
+}
+
+// putColorProfiles writes the registered ICC profiles and those of the images
+// as streams; identical profiles are written once
+func (f *Bdf) putColorProfiles() {
+	f.iccObjs = make(map[string]int)
+	var names []string
+	for name := range f.colorProfiles {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return f.colorProfiles[names[i]].id < f.colorProfiles[names[j]].id
+	})
+	for _, name := range names {
+		f.putICCProfile(f.colorProfiles[name].data)
+	}
+	var keys []string
+	for key, info := range f.images {
+		if len(info.icc) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f.putICCProfile(f.images[key].icc)
+	}
+}
+
+func (f *Bdf) putICCProfile(profile []byte) {
+	key := iccKey(profile)
+	if _, ok := f.iccObjs[key]; ok {
+		return
+	}
+	n, _ := iccComponents(profile)
+	alt := map[int]string{1: "DeviceGray", 3: "DeviceRGB", 4: "DeviceCMYK"}[n]
+	mem := xmem.compress(profile)
+	data := mem.bytes()
+	f.newobj()
+	f.iccObjs[key] = f.n
+	f.outf("<</N %d /Alternate /%s /Filter /FlateDecode /Length %d>>", n, alt, len(data))
+	f.putstream(data)
+	f.out("endobj")
+	mem.release()
+}
+
+// colorSpacePutResourceDict writes the named color spaces of spot colors and
+// ICC profiles
+func (f *Bdf) colorSpacePutResourceDict() {
+	f.out("/ColorSpace <<")
+	f.spotColorPutResourceDict()
+	for _, prof := range f.colorProfiles {
+		f.outf("/ICC%d [/ICCBased %d 0 R]", prof.id, f.iccObjs[iccKey(prof.data)])
+	}
+	f.out(">>")
+}
@@ -0,0 +1,245 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func cmykTestProfile() []byte {
+	return iccProfile("CMYK", []iccTagType{
+		{"desc", iccDesc("Test CMYK")},
+		{"wtpt", iccXYZ(0.9642, 1.0, 0.8249)},
+	})
+}
+
+func grayTestProfile() []byte {
+	return iccProfile("GRAY", []iccTagType{
+		{"desc", iccDesc("Test gray")},
+		{"wtpt", iccXYZ(0.9642, 1.0, 0.8249)},
+		{"kTRC", iccCurve([]float64{0, 1})},
+	})
+}
+
+func colorTestOutput(t *testing.T, pdf *Bdf) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestColorCMYKGray(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.SetDrawColorCMYK(10, 20, 30, 40)
+	pdf.AddPage()
+	pdf.SetFillColorCMYK(0, 100, 100, 120)
+	pdf.SetTextColorGray(51)
+	pdf.SetDrawColorGray(255)
+	pdf.CellFormat(40, 10, "Ink", "1", 0, "", true, 0, "")
+	if c, m, y, k := pdf.GetFillColorCMYK(); c != 0 || m != 100 || y != 100 || k != 100 {
+		t.Fatalf("fill color %d %d %d %d", c, m, y, k)
+	}
+	if r, g, b := pdf.GetDrawColor(); r != 255 || g != 255 || b != 255 {
+		t.Fatalf("draw color %d %d %d", r, g, b)
+	}
+	s := colorTestOutput(t, pdf)
+	for _, want := range []string{"0.100 0.200 0.300 0.400 K", "0.000 1.000 1.000 1.000 k",
+		"1.000 G", "0.200 g"} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("output lacks %q", want)
+		}
+	}
+}
+
+func TestColorCMYKRestore(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.AddPage()
+	pdf.SetDrawColorCMYK(10, 20, 30, 40)
+	pdf.SetFillColorCMYK(0, 100, 100, 0)
+	pdf.SetTextColorCMYK(50, 0, 0, 10)
+	check := func(what string) {
+		t.Helper()
+		if c, m, y, k := pdf.GetDrawColorCMYK(); c != 10 || m != 20 || y != 30 || k != 40 {
+			t.Fatalf("draw color after %s: %d %d %d %d", what, c, m, y, k)
+		}
+		if c, m, y, k := pdf.GetFillColorCMYK(); c != 0 || m != 100 || y != 100 || k != 0 {
+			t.Fatalf("fill color after %s: %d %d %d %d", what, c, m, y, k)
+		}
+		if c, m, y, k := pdf.GetTextColorCMYK(); c != 50 || m != 0 || y != 0 || k != 10 {
+			t.Fatalf("text color after %s: %d %d %d %d", what, c, m, y, k)
+		}
+	}
+	tbl := NewTable(TableColumnType{}, TableColumnType{})
+	tbl.ZebraFill = &RGBType{R: 230, G: 230, B: 230}
+	tbl.AddTextRow("Item", "Amount")
+	tbl.AddTextRow("Tea", "1.00")
+	tbl.Draw(pdf)
+	check("table")
+	h := pdf.HTMLNew()
+	h.Write(`<p>Before</p><hr><p>After</p>`)
+	check("hr")
+	if pdf.Err() {
+		t.Fatal(pdf.Error())
+	}
+}
+
+func TestColorICC(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.AddColorProfile("press", cmykTestProfile())
+	pdf.AddColorProfile("screen", srgbProfile())
+	pdf.AddPage()
+	pdf.SetFillColorICC("press", 0, 0.5, 1, 2)
+	pdf.SetDrawColorICC("screen", 1, 0, 0)
+	pdf.Rect(10, 10, 20, 20, "FD")
+	s := colorTestOutput(t, pdf)
+	for _, want := range []string{"/ICC1 cs 0.000 0.500 1.000 1.000 scn", "/ICC2 CS 1.000 0.000 0.000 SCN",
+		"/N 4 /Alternate /DeviceCMYK", "/N 3 /Alternate /DeviceRGB", "/ICC1 [/ICCBased ", "/ICC2 [/ICCBased "} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("output lacks %q", want)
+		}
+	}
+
+	pdf = New("P", "mm", "A4", "")
+	pdf.AddColorProfile("press", cmykTestProfile())
+	pdf.SetFillColorICC("press", 1, 1, 1)
+	if !pdf.Err() {
+		t.Fatal("expected error for wrong number of components")
+	}
+	pdf = New("P", "mm", "A4", "")
+	pdf.SetTextColorICC("missing", 1)
+	if !pdf.Err() {
+		t.Fatal("expected error for unknown profile")
+	}
+	pdf = New("P", "mm", "A4", "")
+	pdf.AddColorProfile("bad", []byte("not a profile"))
+	if !pdf.Err() {
+		t.Fatal("expected error for invalid profile")
+	}
+}
+
+// colorTestPNG inserts an iCCP chunk holding profile after the header of a
+// gray PNG image
+func colorTestPNG(t *testing.T, profile []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write(profile)
+	zw.Close()
+	body := append([]byte("iCCPgray\x00\x00"), zbuf.Bytes()...)
+	chunk := make([]byte, 4, len(body)+8)
+	binary.BigEndian.PutUint32(chunk, uint32(len(body)-4))
+	chunk = append(chunk, body...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(body))
+	data := buf.Bytes()
+	const ihdrEnd = 8 + 25
+	return append(append(append([]byte(nil), data[:ihdrEnd]...), chunk...), data[ihdrEnd:]...)
+}
+
+// colorTestJPEG inserts the profile after the start marker of a gray JPEG
+// image, split over APP2 segments of at most size bytes
+func colorTestJPEG(t *testing.T, profile []byte, size int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	img := image.NewGray(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.Gray{Y: 200})
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	out := append([]byte(nil), data[:2]...)
+	count := (len(profile) + size - 1) / size
+	for j := 0; j < count; j++ {
+		chunk := profile[j*size:]
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		seg := append([]byte("ICC_PROFILE\x00"), byte(j+1), byte(count))
+		seg = append(seg, chunk...)
+		out = append(out, 0xFF, 0xE2, byte((len(seg)+2)>>8), byte(len(seg)+2))
+		out = append(out, seg...)
+	}
+	return append(out, data[2:]...)
+}
+
+func TestImageColorProfile(t *testing.T) {
+	gray := grayTestProfile()
+	pngData := colorTestPNG(t, gray)
+	jpgData := colorTestJPEG(t, gray, 100)
+	if !bytes.Equal(jpegICCProfile(jpgData), gray) {
+		t.Fatal("JPEG profile not reassembled")
+	}
+
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.AddColorProfile("press", cmykTestProfile())
+	pdf.AddPage()
+	pngInfo := pdf.RegisterImageOptionsReader("a", ImageOptions{ImageType: "png"}, bytes.NewReader(pngData))
+	jpgInfo := pdf.RegisterImageOptionsReader("b", ImageOptions{ImageType: "jpg"}, bytes.NewReader(jpgData))
+	if pdf.Err() {
+		t.Fatal(pdf.Error())
+	}
+	if !bytes.Equal(pngInfo.icc, gray) || !bytes.Equal(jpgInfo.icc, gray) {
+		t.Fatal("embedded profiles not read")
+	}
+	// a profile that does not fit the image is dropped
+	pdf.RegisterImageOptionsReader("c", ImageOptions{ImageType: "png"},
+		bytes.NewReader(colorTestPNG(t, srgbProfile())))
+	if info := pdf.GetImageInfo("c"); len(info.icc) != 0 {
+		t.Fatal("mismatched embedded profile kept")
+	}
+	pdf.Image("a", 10, 10, 10, 0, false, "", 0, "")
+	pdf.Image("b", 30, 10, 10, 0, false, "", 0, "")
+	s := colorTestOutput(t, pdf)
+	if n := strings.Count(s, "/N 1 /Alternate /DeviceGray"); n != 1 {
+		t.Fatalf("gray profile written %d times", n)
+	}
+	if n := strings.Count(s, "/ColorSpace [/ICCBased "); n != 2 {
+		t.Fatalf("%d images with ICC color space", n)
+	}
+
+	pdf = New("P", "mm", "A4", "")
+	pdf.AddColorProfile("press", cmykTestProfile())
+	pdf.RegisterImageOptionsReader("a", ImageOptions{ImageType: "png", ColorProfile: "press"},
+		bytes.NewReader(pngData))
+	if !pdf.Err() {
+		t.Fatal("expected error for profile that does not fit the image")
+	}
+}
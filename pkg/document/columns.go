@@ -0,0 +1,376 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// FrameType is a rectangular area of a page, in user units, through which
+// text flows. See SetFrames().
+type FrameType struct {
+	X, Y, Wd, Ht float64
+}
+
+// columnRecType holds the state of a column or frame layout
+type columnRecType struct {
+	active bool
+	count  int         // number of columns, zero for a frame layout
+	gap    float64     // space between columns
+	layout []FrameType // frames given to SetFrames(), repeated on every page
+	frames []FrameType // frames of the current page in flow order
+	index  int         // current frame
+	bottom float64     // lowest position reached on the current page
+	page   int         // page of the layout, 1 for the page it started on
+	// The balanced page of BalanceColumns() and the height of its columns
+	balancePage int
+	balanceHt   float64
+	// Page settings replaced by the frames
+	lMargin, rMargin, pageBreakTrigger float64
+}
+
+// SetColumns starts a layout of count columns separated by gap, in user
+// units, between the left and right margins. The columns begin at the current
+// position and end at the page break threshold. Text written with Cell(),
+// MultiCell() and Write(), and images placed in flowing mode, fill the current
+// column and then continue at the top of the next one. When the last column
+// of a page is full, a page is added and the flow continues in the first
+// column of the new page, below its header. The left and right margins and
+// the page break threshold follow the current column until EndColumns() is
+// called.
+func (f *Bdf) SetColumns(count int, gap float64) {
+	if count < 1 {
+		count = 1
+	}
+	f.beginColumns(count, gap, nil)
+}
+
+// SetFrames starts a layout in which text flows through the specified frames
+// in order, like it flows through columns with SetColumns(). The first frame
+// becomes current. When the last frame is full, a page is added and the flow
+// continues through the same frames on the new page. End the layout with
+// EndColumns().
+func (f *Bdf) SetFrames(frames ...FrameType) {
+	if len(frames) == 0 {
+		f.SetErrorf("at least one frame is required")
+		return
+	}
+	f.beginColumns(0, 0, append([]FrameType(nil), frames...))
+}
+
+// EndColumns ends the current column or frame layout. The margins and the
+// page break threshold are restored and the position is set to the left
+// margin, below the lowest text written on the current page of the layout.
+func (f *Bdf) EndColumns() {
+	c := &f.columns
+	if !c.active {
+		return
+	}
+	bottom := math.Max(c.bottom, f.y)
+	f.lMargin, f.rMargin, f.pageBreakTrigger = c.lMargin, c.rMargin, c.pageBreakTrigger
+	*c = columnRecType{}
+	f.x = f.lMargin
+	f.y = bottom
+}
+
+// ColumnIndex returns the zero-based index of the current column or frame,
+// or -1 if no column or frame layout is active.
+func (f *Bdf) ColumnIndex() int {
+	if !f.columns.active {
+		return -1
+	}
+	return f.columns.index
+}
+
+// NextColumn moves the flow to the top of the next column or frame, adding a
+// page if the current one is the last on the page.
+func (f *Bdf) NextColumn() {
+	if f.columns.active {
+		f.nextFrame()
+	}
+}
+
+// BalanceColumns lays out the content written by fnc in count columns
+// separated by gap, as SetColumns() does, and balances the columns on the
+// last page so that they end at about the same height. The layout is ended
+// when BalanceColumns returns, with the position below the columns.
+//
+// fnc is called several times to find the balanced height, and the output of
+// all but the last call is discarded, so it should only write content to the
+// page: text, images, links, bookmarks and table of contents entries.
+func (f *Bdf) BalanceColumns(count int, gap float64, fnc func()) {
+	if f.err != nil {
+		return
+	}
+	if f.page == 0 {
+		f.AddPage()
+	}
+	// The trials are rolled back, so their pages are not streamed
+	f.stream.hold++
+	defer func() { f.stream.hold-- }()
+	run := func(page int, ht float64) (pages int, fullHt float64) {
+		f.SetColumns(count, gap)
+		f.columns.balancePage, f.columns.balanceHt = page, ht
+		fnc()
+		pages = f.columns.page
+		if len(f.columns.frames) > 0 {
+			fullHt = f.columns.pageBreakTrigger - f.columns.frames[0].Y
+		}
+		f.EndColumns()
+		return
+	}
+	// A trial with columns of full height gives the number of pages
+	cp := f.checkpoint()
+	pages, fullHt := run(0, 0)
+	if f.err != nil {
+		return
+	}
+	f.rollback(cp)
+	// Search the smallest column height that keeps the content on these pages
+	lo, hi := 0.0, fullHt
+	for hi-lo > 0.25/f.k {
+		mid := (lo + hi) / 2
+		cp = f.checkpoint()
+		n, _ := run(pages, mid)
+		if f.err != nil {
+			return
+		}
+		f.rollback(cp)
+		if n > pages {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	run(pages, hi)
+}
+
+// beginColumns starts a column layout if count is positive, otherwise a
+// layout of the specified frames
+func (f *Bdf) beginColumns(count int, gap float64, frames []FrameType) {
+	if f.err != nil {
+		return
+	}
+	f.EndColumns()
+	if f.page == 0 {
+		f.AddPage()
+		if f.err != nil {
+			return
+		}
+	}
+	f.columns = columnRecType{active: true, count: count, gap: gap, layout: frames}
+	f.columnsPage()
+}
+
+// columnsPage sets up the frames of a new page of the layout, starting at the
+// current vertical position
+func (f *Bdf) columnsPage() {
+	c := &f.columns
+	c.lMargin, c.rMargin, c.pageBreakTrigger = f.lMargin, f.rMargin, f.pageBreakTrigger
+	c.page++
+	c.index = 0
+	c.bottom = f.y
+	if c.layout != nil {
+		c.frames = append(c.frames[:0], c.layout...)
+	} else {
+		bottom := f.pageBreakTrigger
+		if c.page == c.balancePage {
+			bottom = math.Min(bottom, f.y+c.balanceHt)
+		}
+		left, right := f.lMargin, f.w-f.rMargin
+		wd := (right - left - float64(c.count-1)*c.gap) / float64(c.count)
+		c.frames = c.frames[:0]
+		for j := 0; j < c.count; j++ {
+			c.frames = append(c.frames, FrameType{X: left + float64(j)*(wd+c.gap), Y: f.y, Wd: wd, Ht: bottom - f.y})
+		}
+	}
+	f.applyFrame()
+	f.y = c.frames[0].Y
+}
+
+// applyFrame sets the margins and the page break threshold to those of the
+// current frame
+func (f *Bdf) applyFrame() {
+	fr := f.columns.frames[f.columns.index]
+	f.lMargin = fr.X
+	f.rMargin = f.w - fr.X - fr.Wd
+	f.pageBreakTrigger = fr.Y + fr.Ht
+	f.x = fr.X
+}
+
+// columnsSuspend restores the page settings while a page is closed and the
+// next one is started, so that footers and headers are laid out on the page
+func (f *Bdf) columnsSuspend() {
+	c := &f.columns
+	if c.active {
+		c.bottom = math.Max(c.bottom, f.y)
+		f.lMargin, f.rMargin, f.pageBreakTrigger = c.lMargin, c.rMargin, c.pageBreakTrigger
+	}
+}
+
+// columnsResume continues the layout on a page that has just been started
+func (f *Bdf) columnsResume() {
+	if f.columns.active {
+		f.columnsPage()
+	}
+}
+
+// nextFrame moves the flow to the next frame of the layout, adding a page
+// after the last frame of a page. It returns false if no layout is active,
+// in which case the caller handles the page break.
+func (f *Bdf) nextFrame() bool {
+	c := &f.columns
+	if !c.active || f.inHeader || f.inFooter {
+		return false
+	}
+	c.bottom = math.Max(c.bottom, f.y)
+	if c.index+1 < len(c.frames) {
+		c.index++
+		f.applyFrame()
+		f.y = c.frames[c.index].Y
+		return true
+	}
+	if !f.acceptPageBreak() {
+		return true
+	}
+	ws := f.ws
+	if ws > 0 {
+		f.ws = 0
+		f.out("0 Tw")
+	}
+	f.AddPageFormat(f.curOrientation, f.curPageSize)
+	if ws > 0 && f.err == nil {
+		f.ws = ws
+		f.putF64(ws*f.k, 3)
+		f.put(" Tw\n")
+	}
+	return true
+}
+
+// SpanImage places an image across span columns, starting with the current
+// one, at the current position. A span of zero or one larger than the number
+// of columns left on the page extends the image to the last column. The image
+// is scaled to the width of the spanned columns. If it does not fit in the
+// space left in the current column, it is placed at the top of the next
+// column. Text continues below the image in the current column, and the other
+// spanned columns start below it as well. In a frame layout the image spans
+// the current frame. The image is registered with options as with
+// RegisterImageOptions().
+func (f *Bdf) SpanImage(imageNameStr string, span int, options ImageOptions) {
+	if f.err != nil {
+		return
+	}
+	c := &f.columns
+	if !c.active {
+		f.err = fmt.Errorf("SpanImage requires a column or frame layout")
+		return
+	}
+	info := f.RegisterImageOptions(imageNameStr, options)
+	if f.err != nil {
+		return
+	}
+	extent := func() (last int, wd, ht float64) {
+		last = c.index
+		if c.layout == nil {
+			last = len(c.frames) - 1
+			if span > 0 && c.index+span-1 < last {
+				last = c.index + span - 1
+			}
+		}
+		first := c.frames[c.index]
+		end := c.frames[last]
+		wd = end.X + end.Wd - first.X
+		ht = wd * info.Height() / info.Width()
+		return
+	}
+	last, wd, ht := extent()
+	if f.y+ht > f.pageBreakTrigger && f.y > c.frames[c.index].Y {
+		f.nextFrame()
+		last, wd, ht = extent()
+	}
+	x, y := c.frames[c.index].X, f.y
+	f.ImageOptions(imageNameStr, x, y, wd, ht, false, options, 0, "")
+	top := y + ht + c.gap
+	for j := c.index; j <= last; j++ {
+		fr := &c.frames[j]
+		if top > fr.Y {
+			fr.Ht -= top - fr.Y
+			fr.Y = top
+		}
+	}
+	c.bottom = math.Max(c.bottom, top)
+	f.applyFrame()
+	f.y = top
+}
+
+// checkpointType is the state of a document recorded by checkpoint()
+type checkpointType struct {
+	doc     Bdf
+	pageLen int // length of the content of the current page
+}
+
+// checkpoint records the state of the document so that content written
+// afterwards can be discarded with rollback(). It is used to lay out content
+// on trial.
+func (f *Bdf) checkpoint() *checkpointType {
+	cp := &checkpointType{doc: *f, pageLen: f.pages[f.page].Len()}
+	cp.doc.pages = append([]*bytes.Buffer(nil), f.pages...)
+	cp.doc.pageLinks = append([][]linkType(nil), f.pageLinks...)
+	cp.doc.pageAttachments = append([][]annotationAttach(nil), f.pageAttachments...)
+	cp.doc.columns.frames = append([]FrameType(nil), f.columns.frames...)
+	// Registries that are changed in place or whose entries index slices
+	// that are rolled back are copied as well
+	if f.blendMap != nil {
+		cp.doc.blendMap = make(map[string]int, len(f.blendMap))
+		for k, v := range f.blendMap {
+			cp.doc.blendMap[k] = v
+		}
+	}
+	if f.form.names != nil {
+		cp.doc.form.names = make(map[string]*formFieldType, len(f.form.names))
+		for k, v := range f.form.names {
+			cp.doc.form.names[k] = v
+		}
+	}
+	st := &cp.doc.structTree
+	st.elems = append([]structElemType(nil), f.structTree.elems...)
+	st.stack = append([]int(nil), f.structTree.stack...)
+	if f.structTree.pageMCIDs != nil {
+		st.pageMCIDs = make(map[int][]int, len(f.structTree.pageMCIDs))
+		for k, v := range f.structTree.pageMCIDs {
+			st.pageMCIDs[k] = append([]int(nil), v...)
+		}
+	}
+	return cp
+}
+
+// rollback restores the state recorded by checkpoint(), removing the pages
+// added and the content written since
+func (f *Bdf) rollback(cp *checkpointType) {
+	for p := len(cp.doc.pages); p < len(f.pages); p++ {
+		delete(f.pageSizes, p)
+		delete(f.pageBoxes, p)
+	}
+	*f = cp.doc
+	f.pages[f.page].Truncate(cp.pageLen)
+}
@@ -0,0 +1,245 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var columnTestText = strings.Repeat("The quick brown fox jumps over the lazy dog. ", 40)
+
+// columnTestLines returns the positions, in user units, of the text lines on
+// page n
+func columnTestLines(pdf *Bdf, n int) (xs map[float64]int, maxY float64) {
+	xs = make(map[float64]int)
+	re := regexp.MustCompile(`BT ([0-9.]+) ([0-9.]+) Td`)
+	for _, m := range re.FindAllStringSubmatch(pdf.pages[n].String(), -1) {
+		x, _ := strconv.ParseFloat(m[1], 64)
+		y, _ := strconv.ParseFloat(m[2], 64)
+		xs[float64(int(x/pdf.k+0.5))]++
+		if y := pdf.h - y/pdf.k; y > maxY {
+			maxY = y
+		}
+	}
+	return
+}
+
+func TestColumns(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.AddPage()
+	pdf.Cell(0, 10, "Title")
+	pdf.Ln(10)
+	pdf.SetColumns(3, 10)
+	if pdf.ColumnIndex() != 0 {
+		t.Fatalf("column index %d", pdf.ColumnIndex())
+	}
+	for j := 0; j < 4; j++ {
+		pdf.MultiCell(0, 5, columnTestText, "", "L", false)
+	}
+	pdf.Write(5, columnTestText)
+	pdf.EndColumns()
+	if pdf.ColumnIndex() != -1 {
+		t.Errorf("layout not ended")
+	}
+	if pdf.lMargin != pdf.x || pdf.rMargin != pdf.lMargin || pdf.pageBreakTrigger != pdf.h-pdf.bMargin {
+		t.Errorf("page settings not restored: %.2f %.2f %.2f", pdf.lMargin, pdf.pageBreakTrigger, pdf.x)
+	}
+	if pdf.PageCount() < 2 {
+		t.Fatalf("text did not continue on a new page")
+	}
+	// Columns are 56.67 mm wide; text starts at the cell margin
+	wd := (190 - 20) / 3.0
+	for p := 1; p <= pdf.PageCount(); p++ {
+		xs, maxY := columnTestLines(pdf, p)
+		for j := 0; j < 3; j++ {
+			x := float64(int(10 + float64(j)*(wd+10) + pdf.cMargin + 0.5))
+			if p < pdf.PageCount() && xs[x] == 0 {
+				t.Errorf("page %d: no text in column %d", p, j)
+			}
+		}
+		if maxY > pdf.h-20 {
+			t.Errorf("page %d: text below the page break threshold", p)
+		}
+	}
+	if pdf.y <= pdf.tMargin {
+		t.Errorf("position %.2f is not below the columns", pdf.y)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.SetFrames(FrameType{X: 20, Y: 20, Wd: 80, Ht: 50}, FrameType{X: 110, Y: 150, Wd: 60, Ht: 40})
+	pdf.MultiCell(0, 5, columnTestText, "", "L", false)
+	pdf.EndColumns()
+	if pdf.PageCount() < 2 {
+		t.Fatalf("got %d pages", pdf.PageCount())
+	}
+	xs, maxY := columnTestLines(pdf, 1)
+	if xs[21] != 10 || xs[111] != 8 || len(xs) != 2 {
+		t.Errorf("unexpected lines %v", xs)
+	}
+	if maxY > 190 {
+		t.Errorf("text below the second frame")
+	}
+	if xs, _ = columnTestLines(pdf, 2); xs[21] == 0 {
+		t.Errorf("flow does not continue in the first frame of the next page")
+	}
+	pdf.SetFrames()
+	if pdf.Error() == nil {
+		t.Errorf("empty frame list accepted")
+	}
+}
+
+func TestBalanceColumns(t *testing.T) {
+	layout := func(balance bool) *Bdf {
+		pdf := New("P", "mm", "A4", "")
+		pdf.SetCompression(false)
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.AddPage()
+		pdf.Bookmark("Start", 0, -1)
+		fnc := func() {
+			for j := 0; j < 5; j++ {
+				pdf.Bookmark("Part", 1, -1)
+				pdf.MultiCell(0, 5, columnTestText, "", "L", false)
+			}
+		}
+		if balance {
+			pdf.BalanceColumns(3, 5, fnc)
+		} else {
+			pdf.SetColumns(3, 5)
+			fnc()
+			pdf.EndColumns()
+		}
+		pdf.Cell(0, 5, "After")
+		if err := pdf.Output(&bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+		return pdf
+	}
+	plain := layout(false)
+	balanced := layout(true)
+	// Unbalanced, the columns fill the second page and the following text
+	// goes to a third one
+	if plain.PageCount() != 3 || balanced.PageCount() != 2 {
+		t.Fatalf("got %d and %d pages", plain.PageCount(), balanced.PageCount())
+	}
+	if len(balanced.outlines) != 6 {
+		t.Errorf("got %d bookmarks", len(balanced.outlines))
+	}
+	n := balanced.PageCount()
+	_, plainY := columnTestLines(plain, n)
+	xs, balancedY := columnTestLines(balanced, n)
+	if xs[11] < 30 || xs[11]-xs[76] > 2 || xs[76]-xs[141] > 1 {
+		t.Errorf("unexpected lines %v", xs)
+	}
+	if balancedY >= plainY-20 {
+		t.Errorf("columns are not balanced: %.2f and %.2f", plainY, balancedY)
+	}
+	content := balanced.pages[n].String()
+	if strings.Count(content, "(After)") != 1 {
+		t.Errorf("discarded layout left content on the page")
+	}
+}
+
+func TestSpanImage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.AddPage()
+	pdf.RegisterImageOptionsReader("img", ImageOptions{ImageType: "png"}, &buf)
+	pdf.SpanImage("img", 2, ImageOptions{})
+	if pdf.Error() == nil {
+		t.Fatalf("image placed without a layout")
+	}
+	pdf.ClearError()
+	pdf.SetColumns(3, 10)
+	pdf.Write(5, "Above")
+	pdf.Ln(5)
+	pdf.SpanImage("img", 2, ImageOptions{})
+	// Two columns of 56.67 mm and a gap, scaled to half the height
+	if !strings.Contains(pdf.pages[1].String(), "349.60451 0 0 174.80226 28.35000 624.56451 cm") {
+		t.Errorf("unexpected image placement:\n%s", pdf.pages[1].String())
+	}
+	if y := pdf.tMargin + 5 + 123.33/2 + 10; pdf.y < y-0.01 || pdf.y > y+0.01 {
+		t.Errorf("text continues at %.2f, expected %.2f", pdf.y, y)
+	}
+	pdf.NextColumn()
+	if pdf.ColumnIndex() != 1 || pdf.y < 86 {
+		t.Errorf("second column starts at %.2f", pdf.y)
+	}
+	pdf.NextColumn()
+	if pdf.ColumnIndex() != 2 || pdf.y != pdf.tMargin {
+		t.Errorf("third column starts at %.2f", pdf.y)
+	}
+	pdf.EndColumns()
+}
+
+func TestBalanceColumnsRegistries(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetTagged(true)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.AddPage()
+	pdf.BalanceColumns(2, 5, func() {
+		for j := 0; j < 3; j++ {
+			pdf.BeginStructElem("P")
+			pdf.SetAlpha(0.5, "Normal")
+			pdf.MultiCell(0, 5, columnTestText, "", "L", false)
+			pdf.SetAlpha(1, "Multiply")
+			pdf.EndStructElem()
+		}
+	})
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, m := range regexp.MustCompile(`/GS(\d+) gs`).FindAllStringSubmatch(out, -1) {
+		if !regexp.MustCompile(`/GS` + m[1] + ` \d+ 0 R`).MatchString(out) {
+			t.Fatalf("graphics state %s used but not defined", m[1])
+		}
+	}
+	if n := strings.Count(out, "/S /P "); n != 3 {
+		t.Errorf("%d paragraph elements, expected 3", n)
+	}
+	// each marked content sequence has one entry in the parent tree
+	m := regexp.MustCompile(`/ParentTree <</Nums \[(.*)\]>>`).FindStringSubmatch(out)
+	if m == nil {
+		t.Fatal("parent tree not found")
+	}
+	if n, mcids := strings.Count(m[1], " 0 R"), strings.Count(out, ">> BDC"); n != mcids {
+		t.Errorf("%d parent tree entries for %d marked content sequences", n, mcids)
+	}
+}
@@ -23,6 +23,7 @@ package document
 import (
 	"bytes"
 	"fmt"
+	"image"
 	"io"
 	"os"
 	"sort"
@@ -148,3 +149,94 @@ func ComparePDFFiles(file1Str, file2Str string, printDiff bool) (err error) {
 	}
 	return
 }
+
+// CompareImages compares img1 and img2 pixel by pixel. Nil is returned if the
+// images have the same size and no color channel of any pixel differs by more
+// than tolerance, otherwise an error that reports the number of differing
+// pixels and the first of them.
+func CompareImages(img1, img2 *image.RGBA, tolerance uint8) (err error) {
+	b1, b2 := img1.Bounds(), img2.Bounds()
+	if b1.Dx() != b2.Dx() || b1.Dy() != b2.Dy() {
+		return fmt.Errorf("image sizes differ: %dx%d and %dx%d", b1.Dx(), b1.Dy(), b2.Dx(), b2.Dy())
+	}
+	var count int
+	var first image.Point
+	for y := 0; y < b1.Dy(); y++ {
+		p1 := img1.Pix[y*img1.Stride:]
+		p2 := img2.Pix[y*img2.Stride:]
+		for x := 0; x < b1.Dx()*4; x++ {
+			d := int(p1[x]) - int(p2[x])
+			if d < 0 {
+				d = -d
+			}
+			if d > int(tolerance) {
+				if count == 0 {
+					first = image.Pt(x/4, y)
+				}
+				count++
+				x |= 3
+			}
+		}
+	}
+	if count > 0 {
+		err = fmt.Errorf("images differ in %d pixels, first at (%d, %d)", count, first.X, first.Y)
+	}
+	return
+}
+
+// ComparePDFRasters renders every page of the documents read from rdr1 and
+// rdr2 with the specified options and compares the images with
+// CompareImages. Unlike ComparePDFs, differences that do not change the
+// appearance of the pages, such as the creation date or the order of
+// objects, are ignored. Nil is returned if the pages look the same,
+// otherwise an error.
+func ComparePDFRasters(rdr1, rdr2 io.Reader, options RasterOptions, tolerance uint8) (err error) {
+	var r1, r2 *PDFReader
+	r1, err = NewPDFReader(rdr1)
+	if err == nil {
+		r2, err = NewPDFReader(rdr2)
+		if err == nil {
+			err = comparePDFReaderRasters(r1, r2, options, tolerance)
+		}
+	}
+	return
+}
+
+// ComparePDFRasterFiles renders and compares the pages of the two specified
+// files as ComparePDFRasters does. Nil is returned if the pages look the same,
+// or if the second file is missing, otherwise an error.
+func ComparePDFRasterFiles(file1Str, file2Str string, options RasterOptions, tolerance uint8) (err error) {
+	var r1, r2 *PDFReader
+	r1, err = NewPDFReaderFromFile(file1Str)
+	if err == nil {
+		if _, err = os.Stat(file2Str); err != nil {
+			// Second file is missing; treat this as success
+			return nil
+		}
+		r2, err = NewPDFReaderFromFile(file2Str)
+		if err == nil {
+			err = comparePDFReaderRasters(r1, r2, options, tolerance)
+		}
+	}
+	return
+}
+
+func comparePDFReaderRasters(r1, r2 *PDFReader, options RasterOptions, tolerance uint8) error {
+	if r1.NumPages() != r2.NumPages() {
+		return fmt.Errorf("page counts differ: %d and %d", r1.NumPages(), r2.NumPages())
+	}
+	for n := 1; n <= r1.NumPages(); n++ {
+		img1, err := r1.RasterizePage(n, options)
+		if err != nil {
+			return err
+		}
+		img2, err := r2.RasterizePage(n, options)
+		if err != nil {
+			return err
+		}
+		if err = CompareImages(img1, img2, tolerance); err != nil {
+			return fmt.Errorf("page %d: %s", n, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// This file holds the CSS subset understood by the HTML renderer: declaration
+// blocks, style sheets with simple and descendant selectors, colors and
+// lengths.
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// cssProp is a single property declaration
+type cssProp struct {
+	name, value string
+}
+
+// cssCompound is a selector without combinators such as "td.total"
+type cssCompound struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+// cssRule associates a selector, made of compound selectors joined by the
+// descendant combinator, with declarations
+type cssRule struct {
+	sel   []cssCompound
+	spec  int
+	order int
+	decls []cssProp
+}
+
+// cssDeclarations parses a declaration block such as "color: red; margin: 0".
+// Property names are returned in lower case and !important is ignored.
+func cssDeclarations(s string) (list []cssProp) {
+	for _, decl := range strings.Split(s, ";") {
+		pos := strings.Index(decl, ":")
+		if pos < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(decl[:pos]))
+		value := strings.TrimSpace(decl[pos+1:])
+		value = strings.TrimSpace(strings.TrimSuffix(value, "!important"))
+		if name != "" && value != "" {
+			list = append(list, cssProp{name, value})
+		}
+	}
+	return
+}
+
+// cssStripComments removes /* */ comments
+func cssStripComments(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "/*")
+		if start < 0 {
+			break
+		}
+		b.WriteString(s[:start])
+		end := strings.Index(s[start+2:], "*/")
+		if end < 0 {
+			return b.String()
+		}
+		s = s[start+2+end+2:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// cssParseSelector parses a selector of compound selectors separated by
+// white space. Selectors using other combinators, attributes or pseudo
+// classes are not supported and reported as not ok.
+func cssParseSelector(s string) (sel []cssCompound, spec int, ok bool) {
+	if strings.ContainsAny(s, ">+~[:") {
+		return nil, 0, false
+	}
+	for _, part := range strings.Fields(s) {
+		var c cssCompound
+		for len(part) > 0 {
+			end := strings.IndexAny(part[1:], ".#") + 1
+			if end == 0 {
+				end = len(part)
+			}
+			tok := part[:end]
+			part = part[end:]
+			switch tok[0] {
+			case '.':
+				c.classes = append(c.classes, tok[1:])
+				spec += 10
+			case '#':
+				c.id = tok[1:]
+				spec += 100
+			default:
+				if tok != "*" {
+					c.tag = strings.ToLower(tok)
+					spec++
+				}
+			}
+		}
+		sel = append(sel, c)
+	}
+	return sel, spec, len(sel) > 0
+}
+
+// cssParseSheet appends the rules of a style sheet to list. At-rules such as
+// @media are skipped.
+func cssParseSheet(list []cssRule, s string) []cssRule {
+	s = cssStripComments(s)
+	for {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			break
+		}
+		open := strings.Index(s, "{")
+		if open < 0 {
+			break
+		}
+		prelude := strings.TrimSpace(s[:open])
+		if strings.HasPrefix(prelude, "@") {
+			// skip the block including nested blocks
+			depth, j := 0, open
+			for ; j < len(s); j++ {
+				if s[j] == '{' {
+					depth++
+				} else if s[j] == '}' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if j >= len(s) {
+				break
+			}
+			s = s[j+1:]
+			continue
+		}
+		end := strings.Index(s[open:], "}")
+		if end < 0 {
+			break
+		}
+		decls := cssDeclarations(s[open+1 : open+end])
+		for _, selStr := range strings.Split(prelude, ",") {
+			sel, spec, ok := cssParseSelector(selStr)
+			if ok {
+				list = append(list, cssRule{sel: sel, spec: spec, order: len(list), decls: decls})
+			}
+		}
+		s = s[open+end+1:]
+	}
+	return list
+}
+
+// cssSortRules orders rules by specificity and then by position
+func cssSortRules(list []cssRule) {
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].spec != list[j].spec {
+			return list[i].spec < list[j].spec
+		}
+		return list[i].order < list[j].order
+	})
+}
+
+// htmlAttr returns the value of the named attribute of n
+func htmlAttr(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func (c cssCompound) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if c.tag != "" && c.tag != n.Data {
+		return false
+	}
+	if c.id != "" {
+		if id, _ := htmlAttr(n, "id"); id != c.id {
+			return false
+		}
+	}
+	if len(c.classes) > 0 {
+		attr, _ := htmlAttr(n, "class")
+		have := strings.Fields(attr)
+		for _, want := range c.classes {
+			found := false
+			for _, cls := range have {
+				if cls == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (r cssRule) matches(n *html.Node) bool {
+	last := len(r.sel) - 1
+	if !r.sel[last].matches(n) {
+		return false
+	}
+	j := last - 1
+	for p := n.Parent; p != nil && j >= 0; p = p.Parent {
+		if r.sel[j].matches(p) {
+			j--
+		}
+	}
+	return j < 0
+}
+
+// cssNamedColors holds the basic color keywords
+var cssNamedColors = map[string]RGBType{
+	"black": {0, 0, 0}, "silver": {192, 192, 192}, "gray": {128, 128, 128},
+	"grey": {128, 128, 128}, "white": {255, 255, 255}, "maroon": {128, 0, 0},
+	"red": {255, 0, 0}, "purple": {128, 0, 128}, "fuchsia": {255, 0, 255},
+	"green": {0, 128, 0}, "lime": {0, 255, 0}, "olive": {128, 128, 0},
+	"yellow": {255, 255, 0}, "navy": {0, 0, 128}, "blue": {0, 0, 255},
+	"teal": {0, 128, 128}, "aqua": {0, 255, 255}, "orange": {255, 165, 0},
+	"lightgray": {211, 211, 211}, "lightgrey": {211, 211, 211},
+	"darkgray": {169, 169, 169}, "darkgrey": {169, 169, 169},
+	"whitesmoke": {245, 245, 245}, "gainsboro": {220, 220, 220},
+}
+
+// cssColor parses a color given as a keyword, #rgb, #rrggbb or rgb(). The
+// keyword "transparent" is reported as not ok.
+func cssColor(s string) (clr RGBType, ok bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, ok := cssNamedColors[s]; ok {
+		return c, true
+	}
+	if strings.HasPrefix(s, "#") {
+		hex := s[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) != 6 {
+			return
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return
+		}
+		return RGBType{int(v >> 16), int(v >> 8 & 0xff), int(v & 0xff)}, true
+	}
+	if strings.HasPrefix(s, "rgb(") || strings.HasPrefix(s, "rgba(") {
+		open, end := strings.Index(s, "("), strings.LastIndex(s, ")")
+		if end < open {
+			return
+		}
+		args := strings.Split(s[open+1:end], ",")
+		if len(args) < 3 {
+			return
+		}
+		var c [3]int
+		for j := 0; j < 3; j++ {
+			a := strings.TrimSpace(args[j])
+			if strings.HasSuffix(a, "%") {
+				v, err := strconv.ParseFloat(a[:len(a)-1], 64)
+				if err != nil {
+					return
+				}
+				c[j] = int(v*255/100 + 0.5)
+			} else {
+				v, err := strconv.ParseFloat(a, 64)
+				if err != nil {
+					return
+				}
+				c[j] = int(v + 0.5)
+			}
+			if c[j] < 0 {
+				c[j] = 0
+			} else if c[j] > 255 {
+				c[j] = 255
+			}
+		}
+		return RGBType{c[0], c[1], c[2]}, true
+	}
+	return
+}
+
+// cssLength converts a length to points. emPt is the font size used for em
+// units and ref the length, in points, that percentages refer to. A unitless
+// number is taken as pixels, as for HTML width and height attributes.
+func cssLength(s string, emPt, ref float64) (pt float64, ok bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		scale  float64
+	}{
+		{"em", emPt}, {"px", 0.75}, {"pt", 1}, {"pc", 12},
+		{"mm", 72 / 25.4}, {"cm", 72 / 2.54}, {"in", 72}, {"%", ref / 100},
+	}
+	scale := 0.75
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, scale = s[:len(s)-len(u.suffix)], u.scale
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, false
+	}
+	return v * scale, true
+}
+
+// cssBoxValues expands the one to four values of a box shorthand such as
+// margin into top, right, bottom and left values
+func cssBoxValues(s string) (list [4]string, ok bool) {
+	f := strings.Fields(s)
+	switch len(f) {
+	case 1:
+		return [4]string{f[0], f[0], f[0], f[0]}, true
+	case 2:
+		return [4]string{f[0], f[1], f[0], f[1]}, true
+	case 3:
+		return [4]string{f[0], f[1], f[2], f[1]}, true
+	case 4:
+		return [4]string{f[0], f[1], f[2], f[3]}, true
+	}
+	return
+}
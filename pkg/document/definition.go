@@ -125,13 +125,17 @@ type colorMode int
 const (
 	colorModeRGB colorMode = iota
 	colorModeSpot
+	colorModeCMYK
+	colorModeGray
+	colorModeICC
 )
 
 type colorType struct {
 	r, g, b    float64
 	ir, ig, ib int
 	mode       colorMode
-	spotStr    string // name of current spot color
+	spotStr    string // name of current spot color or ICC profile
+	cmyk       cmykColorType
 	gray       bool
 	str        string
 }
@@ -181,6 +185,8 @@ type ImageInfoType struct {
 	trns  []int   // Transparency mask
 	scale float64 // Document scale factor
 	dpi   float64 // Dots-per-inch found from image file (png only)
+	dcd   string  // Decode array, empty for the default of the color space
+	icc   []byte  // ICC profile describing the color space, if any
 	i     string  // SHA-1 checksum of the above values.
 }
 
@@ -192,7 +198,7 @@ func generateImageID(info *ImageInfoType) (string, error) {
 // GobEncode encodes the receiving image to a byte slice.
 func (info *ImageInfoType) GobEncode() (buf []byte, err error) {
 	fields := []interface{}{info.data, info.smask, info.n, info.w, info.h, info.cs,
-		info.pal, info.bpc, info.f, info.dp, info.trns, info.scale, info.dpi}
+		info.pal, info.bpc, info.f, info.dp, info.trns, info.scale, info.dpi, info.dcd, info.icc}
 	w := new(bytes.Buffer)
 	encoder := gob.NewEncoder(w)
 	for j := 0; j < len(fields) && err == nil; j++ {
@@ -208,7 +214,7 @@ func (info *ImageInfoType) GobEncode() (buf []byte, err error) {
 // the receiving image.
 func (info *ImageInfoType) GobDecode(buf []byte) (err error) {
 	fields := []interface{}{&info.data, &info.smask, &info.n, &info.w, &info.h,
-		&info.cs, &info.pal, &info.bpc, &info.f, &info.dp, &info.trns, &info.scale, &info.dpi}
+		&info.cs, &info.pal, &info.bpc, &info.f, &info.dp, &info.trns, &info.scale, &info.dpi, &info.dcd, &info.icc}
 	r := bytes.NewBuffer(buf)
 	decoder := gob.NewDecoder(r)
 	for j := 0; j < len(fields) && err == nil; j++ {
@@ -270,12 +276,14 @@ type fontFileType struct {
 	embedded         bool
 	content          []byte
 	fontType         string
+	tag              string // subset tag prefixed to the font name
 }
 
 type linkType struct {
 	x, y, wd, ht float64
 	link         int    // Auto-generated internal link ID or...
 	linkStr      string // ...application-provided external link string
+	annot        int    // 1-based index of the annotation in the structure tree, 0 if untagged
 }
 
 type intLinkType struct {
@@ -503,6 +511,9 @@ type PageBox struct {
 type Bdf struct {
 	isCurrentUTF8    bool                       // is current font used in utf-8 mode
 	isRTL            bool                       // is is right to left mode enabled
+	noShaping        bool                       // shaping and bidi reordering of UTF-8 text disabled
+	noFontSubset     bool                       // embedded TrueType fonts written whole
+	shapeCache       shapeCacheType             // most recently shaped text
 	page             int                        // current page number
 	n                int                        // current object number
 	offsets          []int                      // array of object offsets
@@ -603,8 +614,24 @@ type Bdf struct {
 		// Composite values of colors
 		draw, fill, text colorType
 	}
-	spotColorMap           map[string]spotColorType // Map of named ink-based colors
-	userUnderlineThickness float64                  // A custom user underline thickness multiplier.
+	spotColorMap           map[string]spotColorType    // Map of named ink-based colors
+	colorProfiles          map[string]colorProfileType // ICC profiles registered by name
+	iccObjs                map[string]int              // object numbers of written ICC profiles by checksum
+	userUnderlineThickness float64                     // A custom user underline thickness multiplier.
+	structTree             structRecType               // logical structure of tagged documents
+	pageObjNums            []int                       // page object numbers, set when pages are written; 1-based
+	xmpObjNum              int                         // object number of the XMP metadata stream
+	pdfa                   pdfaRecType                 // PDF/A conformance settings
+	form                   formRecType                 // interactive form fields
+	sign                   signRecType                 // digital signature settings
+	importedPDFs           map[*PDFReader]map[int]int  // object numbers of objects copied from imported documents
+	toc                    tocRecType                  // table of contents
+	columns                columnRecType               // column or frame layout of the text flow
+	watermarks             []WatermarkType             // watermarks drawn on the pages when the document is closed
+	footnotes              footnoteRecType             // footnotes of the current page and collected endnotes
+	stream                 streamRecType               // writer and state of streaming output
+	objStreams             bool                        // write object streams and a cross-reference stream
+	linearize              bool                        // write a linearized document
 
 	fmt struct {
 		buf []byte       // buffer used to format numbers.
@@ -713,6 +740,7 @@ type fontDefType struct {
 	Cw           []int         // Character width by ordinal
 	Enc          string        // "cp1252", ...
 	Diff         string        // Differences from reference encoding
+	Uv           []int         `json:",omitempty"` // Unicode value by ordinal, -1 if undefined
 	File         string        // "Redressed.z"
 	Size1, Size2 int           // Type1 values
 	OriginalSize int           // Size of uncompressed font file
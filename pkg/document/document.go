@@ -37,6 +37,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/image/webp"
 )
 
 var gl struct {
@@ -118,17 +120,8 @@ func bdfNew(orientationStr, unitStr, sizeStr, fontDirStr string, size SizeType)
 		"zapfdingbats": true,
 	}
 	// Scale factor
-	switch unitStr {
-	case "pt", "point":
-		f.k = 1.0
-	case "mm":
-		f.k = 72.0 / 25.4
-	case "cm":
-		f.k = 72.0 / 2.54
-	case "in", "inch":
-		f.k = 72.0
-	default:
-		f.err = fmt.Errorf("incorrect unit %s", unitStr)
+	f.k, f.err = unitScale(unitStr)
+	if f.err != nil {
 		return
 	}
 	f.unitStr = unitStr
@@ -190,6 +183,7 @@ func bdfNew(orientationStr, unitStr, sizeStr, fontDirStr string, size SizeType)
 	// Enable compression
 	f.SetCompression(!gl.noCompress)
 	f.spotColorMap = make(map[string]spotColorType)
+	f.colorProfiles = make(map[string]colorProfileType)
 	f.blendList = make([]blendModeType, 0, 8)
 	f.blendList = append(f.blendList, blendModeType{}) // blendList[0] is unused (1-based)
 	f.blendMap = make(map[string]int)
@@ -245,6 +239,21 @@ func New(orientationStr, unitStr, sizeStr, fontDirStr string) (f *Bdf) {
 	return bdfNew(orientationStr, unitStr, sizeStr, fontDirStr, SizeType{0, 0})
 }
 
+// unitScale returns the number of points in the unit of measure unitStr
+func unitScale(unitStr string) (float64, error) {
+	switch unitStr {
+	case "pt", "point":
+		return 1.0, nil
+	case "mm":
+		return 72.0 / 25.4, nil
+	case "cm":
+		return 72.0 / 2.54, nil
+	case "in", "inch":
+		return 72.0, nil
+	}
+	return 0, fmt.Errorf("incorrect unit %s", unitStr)
+}
+
 // Ok returns true if no processing errors have occurred.
 func (f *Bdf) Ok() bool {
 	return f.err == nil
@@ -401,6 +410,10 @@ func (f *Bdf) SetPageBox(t string, x, y, wd, ht float64) {
 // pageNum is one-based. The SetPage() example demonstrates this method.
 func (f *Bdf) SetPage(pageNum int) {
 	if (pageNum > 0) && (pageNum < len(f.pages)) {
+		if pageNum <= f.stream.pages {
+			f.err = fmt.Errorf("page %d has already been written to the output stream", pageNum)
+			return
+		}
 		f.page = pageNum
 	}
 }
@@ -507,7 +520,8 @@ func (f *Bdf) GetAutoPageBreak() (auto bool, margin float64) {
 func (f *Bdf) SetAutoPageBreak(auto bool, margin float64) {
 	f.autoPageBreak = auto
 	f.bMargin = margin
-	f.pageBreakTrigger = f.h - margin
+	// the space taken by the footnotes of the page stays reserved
+	f.pageBreakTrigger = f.h - margin - f.footnotes.reserved
 }
 
 // SetDisplayMode sets advisory display directives for the document viewer.
@@ -640,7 +654,10 @@ func (f *Bdf) AliasNbPages(aliasStr string) {
 	f.aliasNbPagesStr = aliasStr
 }
 
-// RTL enables right-to-left mode
+// RTL enables right-to-left mode. Text drawn with a UTF-8 font is then laid
+// out with a right-to-left paragraph direction; runs of left-to-right text
+// and numbers keep their order as described by the Unicode Bidirectional
+// Algorithm. See SetTextShaping().
 func (f *Bdf) RTL() {
 	f.isRTL = true
 }
@@ -658,7 +675,9 @@ func (f *Bdf) open() {
 // Close terminates the PDF document. It is not necessary to call this method
 // explicitly because Output(), OutputAndClose() and OutputFileAndClose() do it
 // automatically. If the document contains no page, AddPage() is called to
-// prevent the generation of an invalid document.
+// prevent the generation of an invalid document. When the document is
+// streamed, see SetStreamOutput(), Close() writes the remaining pages and the
+// shared resources and must be called to finish it.
 func (f *Bdf) Close() {
 	if f.err == nil {
 		if f.clipNest > 0 {
@@ -679,6 +698,19 @@ func (f *Bdf) Close() {
 			return
 		}
 	}
+	f.EndColumns()
+	// Endnotes that have not been printed
+	f.Endnotes()
+	// Footnotes carried over from the last page
+	for len(f.footnotes.carry) > 0 && f.err == nil {
+		f.AddPageFormat(f.curOrientation, f.curPageSize)
+	}
+	// Table of contents, now that the page of every entry is known
+	f.putTOC()
+	if f.err != nil {
+		return
+	}
+	f.putFootnotes()
 	// Page footer
 	f.inFooter = true
 	if f.footerFnc != nil {
@@ -687,11 +719,15 @@ func (f *Bdf) Close() {
 		f.footerFncLpi(true)
 	}
 	f.inFooter = false
+	f.EndLayer()
+	f.putWatermarks()
 
 	// Close page
 	f.endpage()
+	f.streamPage()
 	// Close document
 	f.enddoc()
+	f.streamFlush()
 }
 
 // PageSize returns the width and height of the specified page in the units
@@ -727,6 +763,7 @@ func (f *Bdf) AddPageFormat(orientationStr string, size SizeType) {
 	if f.state == 0 {
 		f.open()
 	}
+	f.columnsSuspend()
 	familyStr := f.fontFamily
 	style := f.fontStyle
 	if f.underline {
@@ -743,6 +780,7 @@ func (f *Bdf) AddPageFormat(orientationStr string, size SizeType) {
 	cf := f.colorFlag
 
 	if f.page > 0 {
+		f.putFootnotes()
 		f.inFooter = true
 		// Page footer avoid double call on footer.
 		if f.footerFnc != nil {
@@ -754,6 +792,8 @@ func (f *Bdf) AddPageFormat(orientationStr string, size SizeType) {
 		f.inFooter = false
 		// Close page
 		f.endpage()
+		// Write the completed pages when streaming
+		f.streamPage()
 	}
 	// Start new page
 	f.beginpage(orientationStr, size)
@@ -819,6 +859,10 @@ func (f *Bdf) AddPageFormat(orientationStr string, size SizeType) {
 	}
 	f.color.text = tc
 	f.colorFlag = cf
+	// Continue a column layout
+	f.columnsResume()
+	// Footnotes carried over from the previous page
+	f.footnotesPage()
 }
 
 // AddPage adds a new page to the document. If a page is already present, the
@@ -979,6 +1023,9 @@ func (f *Bdf) GetStringSymbolWidth(s string) int {
 	if f.err != nil {
 		return 0
 	}
+	if glyphs := f.shapedText(s); glyphs != nil {
+		return int(math.Round(shapedWidth(glyphs)))
+	}
 	w := 0
 	if f.isCurrentUTF8 {
 		for _, char := range s {
@@ -1593,6 +1640,7 @@ func (f *Bdf) ClipText(x, y float64, txtStr string, outline bool) {
 	f.put(" Td ")
 	f.putInt(intIf(outline, 5, 7))
 	f.put(" Tr (")
+	f.useFontBytes(txtStr)
 	f.put(f.escape(txtStr))
 	f.put(") Tj ET\n")
 }
@@ -2130,6 +2178,10 @@ func (f *Bdf) addFontFromBytes(familyStr, styleStr string, jsonFileBytes, zFileB
 			info.DiffN = n
 		}
 
+		if info.Tp == "TrueType" {
+			info.usedRunes = make(map[int]int)
+		}
+
 		// embed font
 		if len(info.File) > 0 {
 			if info.Tp == "TrueType" {
@@ -2196,6 +2248,9 @@ func (f *Bdf) AddFontFromReader(familyStr, styleStr string, r io.Reader) {
 		}
 		info.DiffN = n
 	}
+	if info.Tp == "TrueType" {
+		info.usedRunes = make(map[int]int)
+	}
 	// dbg("font [%s], type [%s]", info.File, info.Tp)
 	if len(info.File) > 0 {
 		// Embedded font
@@ -2331,6 +2386,26 @@ func (f *Bdf) SetFontStyle(styleStr string) {
 	f.SetFont(f.fontFamily, styleStr, f.fontSizePt)
 }
 
+// setFontIfChanged calls SetFont() unless the requested font is already
+// current, which keeps redundant font operators out of the page content
+func (f *Bdf) setFontIfChanged(familyStr, styleStr string, size float64) {
+	styleStr = strings.ToUpper(styleStr)
+	underline := strings.Contains(styleStr, "U")
+	strikeout := strings.Contains(styleStr, "S")
+	base := ""
+	if strings.Contains(styleStr, "B") {
+		base += "B"
+	}
+	if strings.Contains(styleStr, "I") {
+		base += "I"
+	}
+	if f.fontFamily == strings.ToLower(familyStr) && f.fontStyle == base && f.fontSizePt == size &&
+		f.underline == underline && f.strikeout == strikeout {
+		return
+	}
+	f.SetFont(familyStr, styleStr, size)
+}
+
 // SetFontSize defines the size of the current font. Size is specified in
 // points (1/ 72 inch). See also SetFontUnitSize().
 func (f *Bdf) SetFontSize(size float64) {
@@ -2386,7 +2461,7 @@ func (f *Bdf) newLink(x, y, w, h float64, link int, linkStr string) {
 	// f.pageLinks[f.page] = linkList
 	// }
 	f.pageLinks[f.page] = append(f.pageLinks[f.page],
-		linkType{x * f.k, f.hPt - y*f.k, w * f.k, h * f.k, link, linkStr})
+		linkType{x * f.k, f.hPt - y*f.k, w * f.k, h * f.k, link, linkStr, f.structLink()})
 }
 
 // Link puts a link on a rectangular area of the page. Text or image links are
@@ -2426,7 +2501,13 @@ func (f *Bdf) Bookmark(txtStr string, level int, y float64) {
 // or Write() which are the standard methods to print text.
 func (f *Bdf) Text(x, y float64, txtStr string) {
 	var txt2 string
-	if f.isCurrentUTF8 {
+	var ops string
+	if glyphs := f.shapedText(txtStr); glyphs != nil {
+		if f.isRTL {
+			x -= f.GetStringWidth(txtStr)
+		}
+		ops = f.shapedOps(glyphs, 0)
+	} else if f.isCurrentUTF8 {
 		if f.isRTL {
 			txtStr = reverseText(txtStr)
 			x -= f.GetStringWidth(txtStr)
@@ -2436,9 +2517,13 @@ func (f *Bdf) Text(x, y float64, txtStr string) {
 			f.currentFont.usedRunes[int(uni)] = int(uni)
 		}
 	} else {
+		f.useFontBytes(txtStr)
 		txt2 = f.escape(txtStr)
 	}
-	s := sprintf("BT %.2f %.2f Td (%s) Tj ET", x*f.k, (f.h-y)*f.k, txt2)
+	if ops == "" {
+		ops = sprintf("(%s) Tj", txt2)
+	}
+	s := sprintf("BT %.2f %.2f Td %s ET", x*f.k, (f.h-y)*f.k, ops)
 	if f.underline && txtStr != "" {
 		s += " " + f.dounderline(x, y, txtStr)
 	}
@@ -2448,7 +2533,7 @@ func (f *Bdf) Text(x, y float64, txtStr string) {
 	if f.colorFlag {
 		s = sprintf("q %s %s Q", f.color.text.str, s)
 	}
-	f.out(s)
+	f.out(f.structMarkContent(s, StructP))
 }
 
 // SetWordSpacing sets spacing between words of following text. See the
@@ -2542,7 +2627,7 @@ func (f *Bdf) CellFormat(w, h float64, txtStr, borderStr string, ln int,
 
 	borderStr = strings.ToUpper(borderStr)
 	k := f.k
-	if f.y+h > f.pageBreakTrigger && !f.inHeader && !f.inFooter && f.acceptPageBreak() {
+	if f.y+h > f.pageBreakTrigger && !f.inHeader && !f.inFooter && !f.nextFrame() && f.acceptPageBreak() {
 		// Automatic page break
 		x := f.x
 		ws := f.ws
@@ -2605,6 +2690,7 @@ func (f *Bdf) CellFormat(w, h float64, txtStr, borderStr string, ln int,
 			s.printf("%.2f %.2f m %.2f %.2f l S ", left, bottom, right, bottom)
 		}
 	}
+	textStart := s.Len()
 	if len(txtStr) > 0 {
 		var dx, dy float64
 		// Horizontal alignment
@@ -2640,7 +2726,25 @@ func (f *Bdf) CellFormat(w, h float64, txtStr, borderStr string, ln int,
 			s.printf("q %s ", f.color.text.str)
 		}
 		//If multibyte, Tw has no effect - do word spacing using an adjustment before each space
-		if (f.ws != 0 || alignStr == "J") && f.isCurrentUTF8 { // && f.ws != 0
+		if glyphs := f.shapedText(txtStr); glyphs != nil {
+			var shift float64
+			if f.ws != 0 || alignStr == "J" {
+				spaces := 0
+				for _, g := range glyphs {
+					if g.space {
+						spaces++
+					}
+				}
+				if spaces > 0 {
+					wmax := math.Ceil((w - 2*f.cMargin) * 1000 / f.fontSize)
+					shift = (wmax - shapedWidth(glyphs)) / float64(spaces)
+					dx = f.cMargin
+				}
+			}
+			bt := (f.x + dx) * k
+			td := (f.h - (f.y + dy + .5*h + .3*f.fontSize)) * k
+			s.printf("BT 0 Tw %.2f %.2f Td %s ET", bt, td, f.shapedOps(glyphs, shift))
+		} else if (f.ws != 0 || alignStr == "J") && f.isCurrentUTF8 { // && f.ws != 0
 			if f.isRTL {
 				txtStr = reverseText(txtStr)
 			}
@@ -2674,7 +2778,7 @@ func (f *Bdf) CellFormat(w, h float64, txtStr, borderStr string, ln int,
 					f.currentFont.usedRunes[int(uni)] = int(uni)
 				}
 			} else {
-
+				f.useFontBytes(txtStr)
 				txt2 = strings.Replace(txtStr, "\\", "\\\\", -1)
 				txt2 = strings.Replace(txt2, "(", "\\(", -1)
 				txt2 = strings.Replace(txt2, ")", "\\)", -1)
@@ -2699,6 +2803,15 @@ func (f *Bdf) CellFormat(w, h float64, txtStr, borderStr string, ln int,
 		}
 	}
 	str := s.String()
+	if f.structTree.enabled {
+		// The text of a link belongs to its Link element
+		linked := txtStr != "" && (link > 0 || len(linkStr) > 0) && f.structEnterLink(txtStr)
+		str = strings.TrimSpace(f.structMarkArtifact(strings.TrimSpace(str[:textStart])) + " " +
+			f.structMarkContent(str[textStart:], StructP))
+		if linked {
+			f.structTree.stack = f.structTree.stack[:len(f.structTree.stack)-1]
+		}
+	}
 	if len(str) > 0 {
 		f.out(str)
 	}
@@ -2819,6 +2932,9 @@ func (f *Bdf) MultiCell(w, h float64, txtStr, borderStr, alignStr string, fill b
 	if f.err != nil {
 		return
 	}
+	if f.structBeginImplicit(StructP) {
+		defer f.EndStructElem()
+	}
 	// dbg("MultiCell")
 	if alignStr == "" {
 		alignStr = "J"
@@ -3009,6 +3125,9 @@ func (f *Bdf) MultiCell(w, h float64, txtStr, borderStr, alignStr string, fill b
 // write outputs text in flowing mode
 func (f *Bdf) write(h float64, txtStr string, link int, linkStr string) {
 	// dbg("Write")
+	if f.structBeginImplicit(StructP) {
+		defer f.EndStructElem()
+	}
 	cw := f.currentFont.Cw
 	w := f.w - f.rMargin - f.x
 	wmax := (w - 2*f.cMargin) * 1000 / f.fontSize
@@ -3104,7 +3223,11 @@ func (f *Bdf) write(h float64, txtStr string, link int, linkStr string) {
 	// Last chunk
 	if i != j {
 		if f.isCurrentUTF8 {
-			f.CellFormat(l/1000*f.fontSize, h, string([]rune(s)[j:]), "", 0, "", false, link, linkStr)
+			chunk := string([]rune(s)[j:])
+			if f.shapedText(chunk) != nil {
+				l = float64(f.GetStringSymbolWidth(chunk))
+			}
+			f.CellFormat(l/1000*f.fontSize, h, chunk, "", 0, "", false, link, linkStr)
 		} else {
 			f.CellFormat(l/1000*f.fontSize, h, s[j:], "", 0, "", false, link, linkStr)
 		}
@@ -3258,7 +3381,7 @@ func (f *Bdf) imageOut(info *ImageInfoType, x, y, w, h float64, allowNegativeX,
 	}
 	// Flowing mode
 	if flow {
-		if f.y+h > f.pageBreakTrigger && !f.inHeader && !f.inFooter && f.acceptPageBreak() {
+		if f.y+h > f.pageBreakTrigger && !f.inHeader && !f.inFooter && !f.nextFrame() && f.acceptPageBreak() {
 			// Automatic page break
 			x2 := f.x
 			f.AddPageFormat(f.curOrientation, f.curPageSize)
@@ -3279,15 +3402,21 @@ func (f *Bdf) imageOut(info *ImageInfoType, x, y, w, h float64, allowNegativeX,
 	// q 85.04 0 0 NaN 28.35 NaN cm /I2 Do Q
 	// f.outf("q %.5f 0 0 %.5f %.5f %.5f cm /I%s Do Q", w*f.k, h*f.k, x*f.k, (f.h-(y+h))*f.k, info.i)
 	const prec = 5
-	f.put("q ")
-	f.putF64(w*f.k, prec)
-	f.put(" 0 0 ")
-	f.putF64(h*f.k, prec)
-	f.put(" ")
-	f.putF64(x*f.k, prec)
-	f.put(" ")
-	f.putF64((f.h-(y+h))*f.k, prec)
-	f.put(" cm /I" + info.i + " Do Q\n")
+	if f.structTree.enabled {
+		f.out(f.structMarkContent(sprintf("q %s 0 0 %s %s %s cm /I%s Do Q",
+			f.fmtF64(w*f.k, prec), f.fmtF64(h*f.k, prec), f.fmtF64(x*f.k, prec),
+			f.fmtF64((f.h-(y+h))*f.k, prec), info.i), StructFigure))
+	} else {
+		f.put("q ")
+		f.putF64(w*f.k, prec)
+		f.put(" 0 0 ")
+		f.putF64(h*f.k, prec)
+		f.put(" ")
+		f.putF64(x*f.k, prec)
+		f.put(" ")
+		f.putF64((f.h-(y+h))*f.k, prec)
+		f.put(" cm /I" + info.i + " Do Q\n")
+	}
 	if link > 0 || len(linkStr) > 0 {
 		f.newLink(x, y, w, h, link, linkStr)
 	}
@@ -3305,7 +3434,7 @@ func (f *Bdf) Image(imageNameStr string, x, y, w, h float64, flow bool, tp strin
 	f.ImageOptions(imageNameStr, x, y, w, h, flow, options, link, linkStr)
 }
 
-// ImageOptions puts a JPEG, PNG or GIF image in the current page. The size it
+// ImageOptions puts a JPEG, PNG, GIF, TIFF or WebP image in the current page. The size it
 // will take on the page can be specified in different ways. If both w and h
 // are 0, the image is rendered at 96 dpi. If either w or h is zero, it will be
 // calculated from the other dimension so that the aspect ratio is maintained.
@@ -3318,10 +3447,14 @@ func (f *Bdf) Image(imageNameStr string, x, y, w, h float64, flow bool, tp strin
 // If w and h are any other negative value, their absolute values
 // indicate their dpi extents.
 //
-// Supported JPEG formats are 24 bit, 32 bit and gray scale. Supported PNG
-// formats are 24 bit, indexed color, and 8 bit indexed gray scale. If a GIF
-// image is animated, only the first frame is rendered. Transparency is
-// supported. It is possible to put a link on the image.
+// Supported JPEG formats are 24 bit, 32 bit (CMYK, including the inverted
+// samples written by Adobe applications) and gray scale. PNG images may be
+// gray, RGB or indexed at any bit depth up to 16, with or without alpha
+// channel and interlacing. TIFF images may be bilevel, gray, RGB, CMYK or
+// indexed; CCITT Group 4, Flate and LZW data is embedded without decoding
+// where possible. If a GIF image is animated, only the first frame is
+// rendered. WebP images are decoded. Transparency is supported. It is
+// possible to put a link on the image.
 //
 // imageNameStr may be the name of an image as registered with a call to either
 // RegisterImageReader() or RegisterImage(). In the first case, the image is
@@ -3349,7 +3482,9 @@ func (f *Bdf) ImageOptions(imageNameStr string, x, y, w, h float64, flow bool, o
 	if f.err != nil {
 		return
 	}
+	f.structTree.imageAlt = options.AltText
 	f.imageOut(info, x, y, w, h, options.AllowNegativePosition, flow, link, linkStr)
+	f.structTree.imageAlt = ""
 }
 
 // RegisterImageReader registers an image, reading it from Reader r, adding it
@@ -3368,8 +3503,13 @@ func (f *Bdf) RegisterImageReader(imgName, tp string, r io.Reader) (info *ImageI
 // parsing an image.
 //
 // ImageType's possible values are (case insensitive):
-// "JPG", "JPEG", "PNG" and "GIF". If empty, the type is inferred from
-// the file extension.
+// "JPG", "JPEG", "PNG", "GIF", "TIF", "TIFF" and "WEBP". If empty, the type
+// is inferred from the file extension.
+//
+// Page selects the page of a multi-page TIFF image, counting from 1; zero
+// selects the first page. Pages after the first are registered under the
+// image name followed by "#" and the page number, for example "scan.tif#2".
+// See TIFFPageCount().
 //
 // ReadDpi defines whether to attempt to automatically read the image
 // dpi information from the image file. Normally, this should be set
@@ -3379,10 +3519,28 @@ func (f *Bdf) RegisterImageReader(imgName, tp string, r io.Reader) (info *ImageI
 //
 // AllowNegativePosition can be set to true in order to prevent the default
 // coercion of negative x values to the current x position.
+//
+// ColorProfile names an ICC profile, added with AddColorProfile(), that
+// describes the colors of the image. Its number of components must match the
+// image. If empty, an ICC profile embedded in a JPEG, PNG or TIFF image is
+// used when it fits; otherwise the image is written with a device color
+// space.
 type ImageOptions struct {
 	ImageType             string
 	ReadDpi               bool
 	AllowNegativePosition bool
+	AltText               string // alternate description used in tagged documents
+	Page                  int    // page of a multi-page TIFF image
+	ColorProfile          string // name of an ICC profile added with AddColorProfile
+}
+
+// imageKey returns the name under which the image or the selected page of a
+// multi-page image is registered
+func imageKey(imgName string, options ImageOptions) string {
+	if options.Page > 1 {
+		return imgName + "#" + strconv.Itoa(options.Page)
+	}
+	return imgName
 }
 
 // RegisterImageOptionsReader registers an image, reading it from Reader r, adding it
@@ -3396,7 +3554,7 @@ func (f *Bdf) RegisterImageOptionsReader(imgName string, options ImageOptions, r
 	if f.err != nil {
 		return
 	}
-	info, ok := f.images[imgName]
+	info, ok := f.images[imageKey(imgName, options)]
 	if ok {
 		return
 	}
@@ -3417,17 +3575,25 @@ func (f *Bdf) RegisterImageOptionsReader(imgName string, options ImageOptions, r
 		info = f.parsepng(r, options.ReadDpi)
 	case "gif":
 		info = f.parsegif(r)
+	case "tif", "tiff":
+		info = f.parsetiff(r, options.Page, options.ReadDpi)
+	case "webp":
+		info = f.parsewebp(r)
 	default:
 		f.err = fmt.Errorf("unsupported image type: %s", options.ImageType)
 	}
 	if f.err != nil {
 		return
 	}
+	f.imageColorProfile(info, options.ColorProfile)
+	if f.err != nil {
+		return
+	}
 
 	if info.i, f.err = generateImageID(info); f.err != nil {
 		return
 	}
-	f.images[imgName] = info
+	f.images[imageKey(imgName, options)] = info
 
 	return
 }
@@ -3453,7 +3619,7 @@ func (f *Bdf) RegisterImage(fileStr, tp string) (info *ImageInfoType) {
 // necessary if you need information about the image before placing it. See
 // Image() for restrictions on the image and the "tp" parameters.
 func (f *Bdf) RegisterImageOptions(fileStr string, options ImageOptions) (info *ImageInfoType) {
-	info, ok := f.images[fileStr]
+	info, ok := f.images[imageKey(fileStr, options)]
 	if ok {
 		return
 	}
@@ -3653,6 +3819,9 @@ func (f *Bdf) SetXY(x, y float64) {
 // full access to the document regardless of the actionFlag value. An empty
 // string for this argument will be replaced with a random value, effectively
 // prohibiting full access to the document.
+//
+// SetProtection uses 40-bit RC4 encryption. Use SetProtectionOptions to select
+// AES-128 or AES-256 encryption.
 func (f *Bdf) SetProtection(actionFlag byte, userPassStr, ownerPassStr string) {
 	if f.err != nil {
 		return
@@ -3706,6 +3875,10 @@ func (f *Bdf) Output(w io.Writer) error {
 	if f.err != nil {
 		return f.err
 	}
+	if f.stream.w != nil {
+		f.err = fmt.Errorf("the document is written to the writer given to SetStreamOutput; call Close to finish it")
+		return f.err
+	}
 	// dbg("Output")
 	if f.state < 3 {
 		f.Close()
@@ -3826,8 +3999,10 @@ func (f *Bdf) escape(s string) string {
 // textstring formats a text string
 func (f *Bdf) textstring(s string) string {
 	if f.protect.encrypted {
-		b := []byte(s)
-		f.protect.rc4(uint32(f.n), &b)
+		b := f.protect.encrypt(f.n, []byte(s))
+		if f.protect.algorithm != EncryptRC4 {
+			return fmt.Sprintf("<%X>", b)
+		}
 		s = string(b)
 	}
 	return "(" + f.escape(s) + ")"
@@ -3902,13 +4077,84 @@ func (f *Bdf) parsejpg(r io.Reader) (info *ImageInfoType) {
 		info.cs = "DeviceRGB"
 	case color.CMYKModel:
 		info.cs = "DeviceCMYK"
+		if jpegAdobe(info.data) {
+			// Adobe applications store CMYK JPEG samples inverted
+			info.dcd = "[1 0 1 0 1 0 1 0]"
+		}
 	default:
 		f.err = fmt.Errorf("image JPEG buffer has unsupported color space (%v)", config.ColorModel)
 		return
 	}
+	info.icc = jpegICCProfile(info.data)
 	return
 }
 
+// jpegICCProfile returns the ICC profile stored in the APP2 segments of the
+// JPEG data, or nil if there is none or it is incomplete
+func jpegICCProfile(data []byte) []byte {
+	const sig = "ICC_PROFILE\x00"
+	var chunks [][]byte
+	count := 0
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		n := int(data[pos+2])<<8 | int(data[pos+3])
+		if pos+2+n > len(data) {
+			break
+		}
+		seg := data[pos+4 : pos+2+n]
+		if marker == 0xE2 && len(seg) > len(sig)+2 && string(seg[:len(sig)]) == sig {
+			seq, total := int(seg[len(sig)]), int(seg[len(sig)+1])
+			if chunks == nil {
+				count = total
+				chunks = make([][]byte, total)
+			}
+			if total != count || seq < 1 || seq > count {
+				return nil
+			}
+			chunks[seq-1] = seg[len(sig)+2:]
+		}
+		pos += 2 + n
+	}
+	var profile []byte
+	for _, chunk := range chunks {
+		if chunk == nil {
+			return nil
+		}
+		profile = append(profile, chunk...)
+	}
+	return profile
+}
+
+// jpegAdobe reports whether the JPEG data carries the APP14 marker written by
+// Adobe applications, which store CMYK and YCCK samples inverted
+func jpegAdobe(data []byte) bool {
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		n := int(data[pos+2])<<8 | int(data[pos+3])
+		if marker == 0xEE && n >= 12 && pos+9 <= len(data) && string(data[pos+4:pos+9]) == "Adobe" {
+			return true
+		}
+		pos += 2 + n
+	}
+	return false
+}
+
 // parsepng extracts info from a PNG data
 func (f *Bdf) parsepng(r io.Reader, readdpi bool) (info *ImageInfoType) {
 	buf, err := newRBuffer(r)
@@ -3941,6 +4187,22 @@ func (f *Bdf) parsegif(r io.Reader) (info *ImageInfoType) {
 	return f.parsepngstream(&rbuffer{p: pngBuf.Bytes()}, false)
 }
 
+// parsewebp extracts info from WebP data (via PNG conversion)
+func (f *Bdf) parsewebp(r io.Reader) (info *ImageInfoType) {
+	img, err := webp.Decode(r)
+	if err != nil {
+		f.err = err
+		return
+	}
+	pngBuf := new(bytes.Buffer)
+	err = png.Encode(pngBuf, img)
+	if err != nil {
+		f.err = err
+		return
+	}
+	return f.parsepngstream(&rbuffer{p: pngBuf.Bytes()}, false)
+}
+
 // newobj begins a new object
 func (f *Bdf) newobj() {
 	// dbg("newobj")
@@ -3948,20 +4210,101 @@ func (f *Bdf) newobj() {
 	for j := len(f.offsets); j <= f.n; j++ {
 		f.offsets = append(f.offsets, 0)
 	}
-	f.offsets[f.n] = f.buffer.Len()
+	f.offsets[f.n] = f.outputOffset()
 	f.outf("%d 0 obj", f.n)
 }
 
 func (f *Bdf) putstream(b []byte) {
 	// dbg("putstream")
 	if f.protect.encrypted {
-		f.protect.rc4(uint32(f.n), &b)
+		enc := f.protect.encrypt(f.n, b)
+		if len(enc) != len(b) {
+			f.setStreamLength(len(b), len(enc))
+		}
+		b = enc
 	}
 	f.out("stream")
 	f.out(string(b))
 	f.out("endstream")
 }
 
+// setStreamLength replaces the /Length entry of the current object's
+// dictionary when encryption has changed the size of its stream
+func (f *Bdf) setStreamLength(oldLen, newLen int) {
+	start := f.offsets[f.n] - f.stream.offset
+	dict := f.buffer.Bytes()[start:]
+	key := []byte("/Length " + strconv.Itoa(oldLen))
+	pos := -1
+	for off := 0; ; {
+		j := bytes.Index(dict[off:], key)
+		if j < 0 {
+			break
+		}
+		end := off + j + len(key)
+		if end == len(dict) || dict[end] < '0' || dict[end] > '9' {
+			pos = off + j
+		}
+		off = end
+	}
+	if pos < 0 {
+		f.err = fmt.Errorf("stream length of object %d not found", f.n)
+		return
+	}
+	tail := append([]byte(nil), dict[pos+len(key):]...)
+	f.buffer.Truncate(start + pos)
+	f.buffer.WriteString("/Length " + strconv.Itoa(newLen))
+	f.buffer.Write(tail)
+}
+
+// drawStateType holds the position, page and graphics settings saved by
+// saveDrawState()
+type drawStateType struct {
+	page                  int
+	x, y                  float64
+	w, h, wPt, hPt        float64
+	fontFamily, fontStyle string
+	fontSizePt            float64
+	underline, strikeout  bool
+	color                 struct{ draw, fill, text colorType }
+	colorFlag             bool
+	lineWidth             float64
+	cMargin               float64
+	autoPageBreak         bool
+	alpha                 float64
+	blendMode             string
+}
+
+// saveDrawState records the current page, position and graphics settings
+// before content is drawn outside of the text flow
+func (f *Bdf) saveDrawState() (st drawStateType) {
+	st.page, st.x, st.y = f.page, f.x, f.y
+	st.w, st.h, st.wPt, st.hPt = f.w, f.h, f.wPt, f.hPt
+	st.fontFamily, st.fontStyle, st.fontSizePt = f.fontFamily, f.fontStyle, f.fontSizePt
+	st.underline, st.strikeout = f.underline, f.strikeout
+	st.color, st.colorFlag, st.lineWidth = f.color, f.colorFlag, f.lineWidth
+	st.cMargin, st.autoPageBreak = f.cMargin, f.autoPageBreak
+	st.alpha, st.blendMode = f.alpha, f.blendMode
+	return
+}
+
+// restoreDrawState returns to the state recorded by saveDrawState(). The
+// content drawn in between must be enclosed in q and Q, so the settings are
+// restored without writing them to the page.
+func (f *Bdf) restoreDrawState(st drawStateType) {
+	f.page, f.x, f.y = st.page, st.x, st.y
+	f.w, f.h, f.wPt, f.hPt = st.w, st.h, st.wPt, st.hPt
+	if st.fontFamily != "" {
+		f.fontFamily, f.fontStyle, f.fontSizePt = st.fontFamily, st.fontStyle, st.fontSizePt
+		f.fontSize = st.fontSizePt / f.k
+		f.currentFont = f.fonts[st.fontFamily+st.fontStyle]
+		f.isCurrentUTF8 = f.currentFont.Tp == "UTF8"
+	}
+	f.underline, f.strikeout = st.underline, st.strikeout
+	f.color, f.colorFlag, f.lineWidth = st.color, st.colorFlag, st.lineWidth
+	f.cMargin, f.autoPageBreak = st.cMargin, st.autoPageBreak
+	f.alpha, f.blendMode = st.alpha, st.blendMode
+}
+
 // out; Add a line to the document
 func (f *Bdf) out(s string) {
 	if f.state == 2 {
@@ -4097,7 +4440,7 @@ func (f *Bdf) replaceAliases() {
 				alias = utf8toutf16(alias, false)
 				replacement = utf8toutf16(replacement, false)
 			}
-			for n := 1; n <= f.page; n++ {
+			for n := f.stream.pages + 1; n <= f.page; n++ {
 				s := f.pages[n].String()
 				if strings.Contains(s, alias) {
 					s = strings.Replace(s, alias, replacement, -1)
@@ -4109,92 +4452,35 @@ func (f *Bdf) replaceAliases() {
 	}
 }
 
+// defPageSizePt returns the size in points of a page in the default
+// orientation and size
+func (f *Bdf) defPageSizePt() (wPt, hPt float64) {
+	if f.defOrientation == "P" {
+		return f.defPageSize.Wd * f.k, f.defPageSize.Ht * f.k
+	}
+	return f.defPageSize.Ht * f.k, f.defPageSize.Wd * f.k
+}
+
 func (f *Bdf) putpages() {
-	var wPt, hPt float64
-	var pageSize SizeType
-	var ok bool
 	nb := f.page
 	if len(f.aliasNbPagesStr) > 0 {
 		// Replace number of pages
 		f.RegisterAlias(f.aliasNbPagesStr, sprintf("%d", nb))
 	}
 	f.replaceAliases()
-	if f.defOrientation == "P" {
-		wPt = f.defPageSize.Wd * f.k
-		hPt = f.defPageSize.Ht * f.k
-	} else {
-		wPt = f.defPageSize.Ht * f.k
-		hPt = f.defPageSize.Wd * f.k
-	}
-	pagesObjectNumbers := make([]int, nb+1) // 1-based
-	for n := 1; n <= nb; n++ {
-		// Page
-		f.newobj()
-		pagesObjectNumbers[n] = f.n // save for /Kids
-		f.out("<</Type /Page")
-		f.out("/Parent 1 0 R")
-		pageSize, ok = f.pageSizes[n]
-		if ok {
-			f.outf("/MediaBox [0 0 %.2f %.2f]", pageSize.Wd, pageSize.Ht)
-		}
-		for t, pb := range f.pageBoxes[n] {
-			f.outf("/%s [%.2f %.2f %.2f %.2f]", t, pb.X, pb.Y, pb.Wd, pb.Ht)
-		}
-		f.out("/Resources 2 0 R")
-		// Links
-		if len(f.pageLinks[n])+len(f.pageAttachments[n]) > 0 {
-			var annots fmtBuffer
-			annots.printf("/Annots [")
-			for _, pl := range f.pageLinks[n] {
-				annots.printf("<</Type /Annot /Subtype /Link /Rect [%.2f %.2f %.2f %.2f] /Border [0 0 0] ",
-					pl.x, pl.y, pl.x+pl.wd, pl.y-pl.ht)
-				if pl.link == 0 {
-					annots.printf("/A <</S /URI /URI %s>>>>", f.textstring(pl.linkStr))
-				} else {
-					l := f.links[pl.link]
-					var sz SizeType
-					var h float64
-					sz, ok = f.pageSizes[l.page]
-					if ok {
-						h = sz.Ht
-					} else {
-						h = hPt
-					}
-					// dbg("h [%.2f], l.y [%.2f] f.k [%.2f]\n", h, l.y, f.k)
-					annots.printf("/Dest [%d 0 R /XYZ 0 %.2f null]>>", 1+2*l.page, h-l.y*f.k)
-				}
-			}
-			f.putAttachmentAnnotationLinks(&annots, n)
-			annots.printf("]")
-			f.out(annots.String())
-		}
-		if f.pdfVersion > "1.3" {
-			f.out("/Group <</Type /Group /S /Transparency /CS /DeviceRGB>>")
-		}
-		f.outf("/Contents %d 0 R>>", f.n+1)
-		f.out("endobj")
-		// Page content
-		f.newobj()
-		if f.compress {
-			mem := xmem.compress(f.pages[n].Bytes())
-			data := mem.bytes()
-			f.outf("<</Filter /FlateDecode /Length %d>>", len(data))
-			f.putstream(data)
-			mem.release()
-		} else {
-			f.outf("<</Length %d>>", f.pages[n].Len())
-			f.putstream(f.pages[n].Bytes())
-		}
-		f.out("endobj")
+	wPt, hPt := f.defPageSizePt()
+	f.numberPages(f.stream.pages+1, nb)
+	for n := f.stream.pages + 1; n <= nb; n++ {
+		f.putpage(n, hPt)
 	}
 	// Pages root
-	f.offsets[1] = f.buffer.Len()
+	f.offsets[1] = f.outputOffset()
 	f.out("1 0 obj")
 	f.out("<</Type /Pages")
 	var kids fmtBuffer
 	kids.printf("/Kids [")
 	for i := 1; i <= nb; i++ {
-		kids.printf("%d 0 R ", pagesObjectNumbers[i])
+		kids.printf("%d 0 R ", f.pageObjNums[i])
 	}
 	kids.printf("]")
 	f.out(kids.String())
@@ -4204,6 +4490,116 @@ func (f *Bdf) putpages() {
 	f.out("endobj")
 }
 
+// numberPages assigns object numbers to pages from to last, which are
+// written next, so that links and bookmarks can refer to pages that have not
+// been written yet. Other objects, such as form fields, may precede the
+// pages.
+func (f *Bdf) numberPages(from, last int) {
+	for len(f.pageObjNums) <= last {
+		f.pageObjNums = append(f.pageObjNums, 0) // 1-based
+	}
+	num := f.n + 1
+	for n := from; n <= last; n++ {
+		f.pageObjNums[n] = num
+		num += 2 + f.structLinkCount(n) // page, content stream and tagged links
+	}
+}
+
+// putpage writes the page object and the content stream of page n, which
+// must have been numbered with numberPages(). hPt is the height in points of
+// a page of the default size.
+func (f *Bdf) putpage(n int, hPt float64) {
+	// Page
+	f.newobj()
+	f.out("<</Type /Page")
+	f.out("/Parent 1 0 R")
+	pageSize, ok := f.pageSizes[n]
+	if ok {
+		f.outf("/MediaBox [0 0 %.2f %.2f]", pageSize.Wd, pageSize.Ht)
+	}
+	for t, pb := range f.pageBoxes[n] {
+		f.outf("/%s [%.2f %.2f %.2f %.2f]", t, pb.X, pb.Y, pb.Wd, pb.Ht)
+	}
+	f.out("/Resources 2 0 R")
+	f.structPutPage(n)
+	// Links
+	if len(f.pageLinks[n])+len(f.pageAttachments[n])+len(f.form.pageWidgets[n]) > 0 {
+		var annots fmtBuffer
+		annots.printf("/Annots [")
+		tagged := 0
+		for _, pl := range f.pageLinks[n] {
+			if pl.annot > 0 {
+				// Written as an object after the page content
+				tagged++
+				annots.printf("%d 0 R ", f.n+1+tagged)
+				continue
+			}
+			annots.printf("%s", f.linkAnnot(pl, hPt))
+		}
+		f.putAttachmentAnnotationLinks(&annots, n)
+		f.formPutAnnots(&annots, n)
+		annots.printf("]")
+		f.out(annots.String())
+	}
+	if f.pdfVersion > "1.3" && f.pdfa.level != PDFA1B {
+		f.out("/Group <</Type /Group /S /Transparency /CS /DeviceRGB>>")
+	}
+	f.outf("/Contents %d 0 R>>", f.n+1)
+	f.out("endobj")
+	// Page content
+	f.newobj()
+	if f.compress {
+		mem := xmem.compress(f.pages[n].Bytes())
+		data := mem.bytes()
+		f.outf("<</Filter /FlateDecode /Length %d>>", len(data))
+		f.putstream(data)
+		mem.release()
+	} else {
+		f.outf("<</Length %d>>", f.pages[n].Len())
+		f.putstream(f.pages[n].Bytes())
+	}
+	f.out("endobj")
+	// Link annotations of a tagged document
+	for _, pl := range f.pageLinks[n] {
+		if pl.annot > 0 {
+			f.newobj()
+			f.out(f.linkAnnot(pl, hPt))
+			f.out("endobj")
+		}
+	}
+}
+
+// linkAnnot returns the dictionary of link annotation pl. hPt is the height
+// in points of a page of the default size.
+func (f *Bdf) linkAnnot(pl linkType, hPt float64) string {
+	var annot fmtBuffer
+	annot.printf("<</Type /Annot /Subtype /Link /Rect [%.2f %.2f %.2f %.2f] /Border [0 0 0] ",
+		pl.x, pl.y, pl.x+pl.wd, pl.y-pl.ht)
+	if f.pdfa.level != PDFANone {
+		annot.printf("/F 4 ")
+	}
+	if pl.annot > 0 {
+		annot.printf("%s ", f.structPutAnnot(pl.annot, pl.linkStr))
+	}
+	if pl.link == 0 {
+		annot.printf("/A <</S /URI /URI %s>>>>", f.textstring(pl.linkStr))
+	} else if f.stream.w != nil {
+		// The target of the link may not be known yet
+		annot.printf("/Dest %s>>", f.textstring(streamDestName(pl.link)))
+	} else if l := f.links[pl.link]; l.page > 0 && l.page < len(f.pageObjNums) {
+		h := hPt
+		if sz, ok := f.pageSizes[l.page]; ok {
+			h = sz.Ht
+		}
+		// dbg("h [%.2f], l.y [%.2f] f.k [%.2f]\n", h, l.y, f.k)
+		annot.printf("/Dest [%d 0 R /XYZ 0 %.2f null]>>", f.pageObjNums[l.page], h-l.y*f.k)
+	} else {
+		// The link was never set
+		annot.printf(">>")
+	}
+	return annot.String()
+}
+
 func (f *Bdf) putfonts() {
 	if f.err != nil {
 		return
@@ -4245,6 +4641,13 @@ func (f *Bdf) putfonts() {
 					}
 				}
 				compressed := file[len(file)-2:] == ".z"
+				if !f.noFontSubset && info.length2 == 0 {
+					if data, length1, tag, ok := f.subsetFontFile(file, font, compressed); ok {
+						font, compressed = data, true
+						info.length1, info.tag = int64(length1), tag
+						f.fontFiles[file] = info
+					}
+				}
 				if !compressed && info.length2 > 0 {
 					buf := font[6:info.length1]
 					buf = append(buf, font[6+info.length1+6:info.length2]...)
@@ -4297,6 +4700,9 @@ func (f *Bdf) putfonts() {
 				fallthrough
 			case "TrueType":
 				// Additional Type1 or TrueType/OpenType font
+				if tag := f.fontFiles[font.File].tag; tag != "" {
+					name = tag + "+" + name
+				}
 				f.newobj()
 				f.out("<</Type /Font")
 				f.outf("/BaseFont /%s", name)
@@ -4363,9 +4769,10 @@ func (f *Bdf) putfonts() {
 				f.out("/CIDToGIDMap " + strconv.Itoa(f.n+4) + " 0 R>>")
 				f.out("endobj")
 
+				cmap := font.utf8File.toUnicodeCMap()
 				f.newobj()
-				f.out("<</Length " + strconv.Itoa(len(toUnicode)) + ">>")
-				f.putstream([]byte(toUnicode))
+				f.out("<</Length " + strconv.Itoa(len(cmap)) + ">>")
+				f.putstream([]byte(cmap))
 				f.out("endobj")
 
 				// CIDInfo
@@ -4389,6 +4796,9 @@ func (f *Bdf) putfonts() {
 				s.printf(" /StemV %d", font.Desc.StemV)
 				s.printf(" /MissingWidth %d", font.Desc.MissingWidth)
 				s.printf("/FontFile2 %d 0 R", f.n+2)
+				if f.pdfa.level == PDFA1B {
+					s.printf(" /CIDSet %d 0 R", f.n+3)
+				}
 				s.printf(">>")
 				f.out(s.String())
 				f.out("endobj")
@@ -4420,6 +4830,24 @@ func (f *Bdf) putfonts() {
 				f.putstream(compressedFontStream)
 				f.out("endobj")
 				mem.release()
+
+				// CIDSet, required by PDF/A-1 for subset fonts
+				if f.pdfa.level == PDFA1B {
+					cidSet := make([]byte, (font.utf8File.LastRune+8)/8)
+					cidSet[0] = 0x80 // CID 0
+					for cc := range CodeSignDictionary {
+						if cc/8 < len(cidSet) {
+							cidSet[cc/8] |= 0x80 >> uint(cc%8)
+						}
+					}
+					mem = xmem.compress(cidSet)
+					data := mem.bytes()
+					f.newobj()
+					f.outf("<</Length %d /Filter /FlateDecode>>", len(data))
+					f.putstream(data)
+					f.out("endobj")
+					mem.release()
+				}
 			default:
 				f.err = fmt.Errorf("unsupported font type: %s", tp)
 				return
@@ -4621,13 +5049,20 @@ func (f *Bdf) putimage(info *ImageInfoType) {
 	f.out("/Subtype /Image")
 	f.outf("/Width %d", int(info.w))
 	f.outf("/Height %d", int(info.h))
+	cs := "/" + info.cs
+	if len(info.icc) > 0 {
+		cs = sprintf("[/ICCBased %d 0 R]", f.iccObjs[iccKey(info.icc)])
+	}
 	if info.cs == "Indexed" {
-		f.outf("/ColorSpace [/Indexed /DeviceRGB %d %d 0 R]", len(info.pal)/3-1, f.n+1)
-	} else {
-		f.outf("/ColorSpace /%s", info.cs)
-		if info.cs == "DeviceCMYK" {
-			f.out("/Decode [1 0 1 0 1 0 1 0]")
+		if len(info.icc) == 0 {
+			cs = "/DeviceRGB"
 		}
+		f.outf("/ColorSpace [/Indexed %s %d %d 0 R]", cs, len(info.pal)/3-1, f.n+1)
+	} else {
+		f.outf("/ColorSpace %s", cs)
+	}
+	if info.dcd != "" {
+		f.outf("/Decode %s", info.dcd)
 	}
 	f.outf("/BitsPerComponent %d", info.bpc)
 	if len(info.f) > 0 {
@@ -4758,7 +5193,7 @@ func (f *Bdf) putresourcedict() {
 	}
 	// Layers
 	f.layerPutResourceDict()
-	f.spotColorPutResourceDict()
+	f.colorSpacePutResourceDict()
 }
 
 func (f *Bdf) putBlendModes() {
@@ -4825,6 +5260,7 @@ func (f *Bdf) putresources() {
 	f.putBlendModes()
 	f.putGradients()
 	f.putSpotColors()
+	f.putColorProfiles()
 	f.putfonts()
 	if f.err != nil {
 		return
@@ -4833,23 +5269,19 @@ func (f *Bdf) putresources() {
 	f.putTemplates()
 	f.putImportedTemplates() // gofpdi
 	// 	Resource dictionary
-	f.offsets[2] = f.buffer.Len()
+	f.offsets[2] = f.outputOffset()
 	f.out("2 0 obj")
 	f.out("<<")
 	f.putresourcedict()
 	f.out(">>")
 	f.out("endobj")
 	f.putjavascript()
+	f.pdfaPutOutputIntent()
 	if f.protect.encrypted {
 		f.newobj()
 		f.protect.objNum = f.n
 		f.out("<<")
-		f.out("/Filter /Standard")
-		f.out("/V 1")
-		f.out("/R 2")
-		f.outf("/O (%s)", f.escape(string(f.protect.oValue)))
-		f.outf("/U (%s)", f.escape(string(f.protect.uValue)))
-		f.outf("/P %d", f.protect.pValue)
+		f.protect.putEncryptDict(f)
 		f.out(">>")
 		f.out("endobj")
 	}
@@ -4893,11 +5325,11 @@ func (f *Bdf) putcatalog() {
 	f.out("/Pages 1 0 R")
 	switch f.zoomMode {
 	case "fullpage":
-		f.out("/OpenAction [3 0 R /Fit]")
+		f.outf("/OpenAction [%d 0 R /Fit]", f.pageObjNums[1])
 	case "fullwidth":
-		f.out("/OpenAction [3 0 R /FitH null]")
+		f.outf("/OpenAction [%d 0 R /FitH null]", f.pageObjNums[1])
 	case "real":
-		f.out("/OpenAction [3 0 R /XYZ null null 1]")
+		f.outf("/OpenAction [%d 0 R /XYZ null null 1]", f.pageObjNums[1])
 	}
 	// } 	else if !is_string($this->zoomMode))
 	// 		$this->out('/OpenAction [3 0 R /XYZ null null '.sprintf('%.2f',$this->zoomMode/100).']');
@@ -4923,6 +5355,17 @@ func (f *Bdf) putcatalog() {
 	}
 	// Layers
 	f.layerPutCatalog()
+	// Metadata
+	if f.xmpObjNum > 0 {
+		f.outf("/Metadata %d 0 R", f.xmpObjNum)
+	}
+	// Logical structure
+	f.structPutCatalog()
+	f.protectPutCatalog()
+	// Interactive form
+	f.formPutCatalog()
+	// Output intent
+	f.pdfaPutCatalog()
 	// Name dictionary :
 	//	-> Javascript
 	//	-> Embedded files
@@ -4932,8 +5375,13 @@ func (f *Bdf) putcatalog() {
 		f.outf("/JavaScript %d 0 R", f.nJs)
 	}
 	// Embedded files
-	f.outf("/EmbeddedFiles %s", f.getEmbeddedFiles())
+	if len(f.attachments) > 0 || f.pdfa.level == PDFANone {
+		f.outf("/EmbeddedFiles %s", f.getEmbeddedFiles())
+	}
+	// Destinations of internal links in a streamed document
+	f.streamPutDests()
 	f.out(">>")
+	f.streamPutCatalog()
 }
 
 func (f *Bdf) putheader() {
@@ -4941,6 +5389,10 @@ func (f *Bdf) putheader() {
 		f.pdfVersion = "1.4"
 	}
 	f.outf("%%PDF-%s", f.pdfVersion)
+	if f.pdfa.level != PDFANone {
+		// binary marker comment required by PDF/A
+		f.out("%\xe2\xe3\xcf\xd3")
+	}
 }
 
 func (f *Bdf) puttrailer() {
@@ -4949,15 +5401,21 @@ func (f *Bdf) puttrailer() {
 	f.outf("/Info %d 0 R", f.n-1)
 	if f.protect.encrypted {
 		f.outf("/Encrypt %d 0 R", f.protect.objNum)
-		f.out("/ID [()()]")
+		f.protect.putID(f)
+	} else if f.pdfa.level != PDFANone {
+		f.pdfaPutID()
 	}
 }
 
 func (f *Bdf) putxmp() {
+	if f.xmpNeeded() {
+		f.xmp = f.xmpGenerate()
+	}
 	if len(f.xmp) == 0 {
 		return
 	}
 	f.newobj()
+	f.xmpObjNum = f.n
 	f.outf("<< /Type /Metadata /Subtype /XML /Length %d >>", len(f.xmp))
 	f.putstream(f.xmp)
 	f.out("endobj")
@@ -5004,7 +5462,7 @@ func (f *Bdf) putbookmarks() {
 			if o.last != -1 {
 				f.outf("/Last %d 0 R", n+o.last)
 			}
-			f.outf("/Dest [%d 0 R /XYZ 0 %.2f null]", 1+2*o.p, (f.h-o.y)*f.k)
+			f.outf("/Dest [%d 0 R /XYZ 0 %.2f null]", f.pageObjNums[o.p], (f.h-o.y)*f.k)
 			f.out("/Count 0>>")
 			f.out("endobj")
 		}
@@ -5021,15 +5479,26 @@ func (f *Bdf) enddoc() {
 		return
 	}
 	f.layerEndDoc()
-	f.putheader()
+	f.structEndDoc()
+	f.pdfaEndDoc()
+	if f.err != nil {
+		return
+	}
+	if f.stream.w == nil {
+		f.putheader()
+	}
 	// Embedded files
 	f.putAttachments()
 	f.putAnnotationsAttachments()
+	// Form fields
+	f.formPutFields()
 	f.putpages()
 	f.putresources()
 	if f.err != nil {
 		return
 	}
+	// Structure tree
+	f.structPutTree()
 	// Bookmarks
 	f.putbookmarks()
 	// Metadata
@@ -5047,7 +5516,7 @@ func (f *Bdf) enddoc() {
 	f.out(">>")
 	f.out("endobj")
 	// Cross-ref
-	o := f.buffer.Len()
+	o := f.outputOffset()
 	f.out("xref")
 	f.outf("0 %d", f.n+1)
 	f.out("0000000000 65535 f ")
@@ -5062,6 +5531,9 @@ func (f *Bdf) enddoc() {
 	f.out("startxref")
 	f.outf("%d", o)
 	f.out("%%EOF")
+	f.rewriteOutput()
+	// Signature
+	f.signApply()
 	f.state = 3
 }
 
@@ -52,31 +52,35 @@ func loadMap(encodingFileStr string) (encList encListType, err error) {
 	f, err = os.Open(encodingFileStr)
 	if err == nil {
 		defer f.Close()
-		for j := range encList {
-			encList[j].uv = -1
-			encList[j].name = ".notdef"
-		}
-		scanner := bufio.NewScanner(f)
-		var enc encType
-		var pos int
-		for scanner.Scan() {
-			// "!3F U+003F question"
-			_, err = fmt.Sscanf(scanner.Text(), "!%x U+%x %s", &pos, &enc.uv, &enc.name)
-			if err == nil {
-				if pos < 256 {
-					encList[pos] = enc
-				} else {
-					err = fmt.Errorf("map position 0x%2X exceeds 0xFF", pos)
-					return
-				}
+		encList, err = readMap(f)
+	}
+	return
+}
+
+// readMap parses a code page file such as cp1252.map from r
+func readMap(r io.Reader) (encList encListType, err error) {
+	for j := range encList {
+		encList[j].uv = -1
+		encList[j].name = ".notdef"
+	}
+	scanner := bufio.NewScanner(r)
+	var enc encType
+	var pos int
+	for scanner.Scan() {
+		// "!3F U+003F question"
+		_, err = fmt.Sscanf(scanner.Text(), "!%x U+%x %s", &pos, &enc.uv, &enc.name)
+		if err == nil {
+			if pos < 256 {
+				encList[pos] = enc
 			} else {
+				err = fmt.Errorf("map position 0x%2X exceeds 0xFF", pos)
 				return
 			}
-		}
-		if err = scanner.Err(); err != nil {
+		} else {
 			return
 		}
 	}
+	err = scanner.Err()
 	return
 }
 
@@ -351,6 +355,13 @@ func makeDefinitionFile(fileStr, tpStr, encodingFileStr string, embed bool, encL
 	if err != nil {
 		return err
 	}
+	if tpStr == "TrueType" {
+		// Unicode values let the document subset the embedded font
+		def.Uv = make([]int, len(encList))
+		for j, enc := range encList {
+			def.Uv[j] = enc.uv
+		}
+	}
 	def.File = info.File
 	def.Size1 = int(info.Size1)
 	def.Size2 = int(info.Size2)
@@ -401,7 +412,10 @@ func makeDefinitionFile(fileStr, tpStr, encodingFileStr string, embed bool, encL
 // msgWriter is the writer that is called to display messages throughout the
 // process. Use nil to turn off messages.
 //
-// embed is true if the font is to be embedded in the PDF files.
+// embed is true if the font is to be embedded in the PDF files. The
+// definition of an embedded TrueType font lists the Unicode value of every
+// code of the encoding, which lets Bdf embed only the glyphs a document
+// prints. See SetFontSubsetting() for details.
 func MakeFont(fontFileStr, encodingFileStr, dstDirStr string, msgWriter io.Writer, embed bool) error {
 	if msgWriter == nil {
 		msgWriter = ioutil.Discard
@@ -0,0 +1,178 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Glyph subsetting of TrueType fonts used with a single-byte encoding
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"sort"
+)
+
+// SetFontSubsetting controls whether TrueType fonts added with AddFont or
+// AddFontFromBytes are reduced on output to the glyphs actually printed with
+// them. Subsetting is on by default; a subset font keeps the widths and the
+// encoding of its definition file, so only the size of the embedded font
+// program changes. Turn it off when the document is meant to be edited
+// further with other text in the same font.
+func (f *Bdf) SetFontSubsetting(enabled bool) {
+	f.noFontSubset = !enabled
+}
+
+// useFontBytes records the codes of txtStr as printed with the current
+// font when that font is a subsettable TrueType font
+func (f *Bdf) useFontBytes(txtStr string) {
+	if f.currentFont.Tp != "TrueType" || f.currentFont.usedRunes == nil {
+		return
+	}
+	for j := 0; j < len(txtStr); j++ {
+		c := int(txtStr[j])
+		f.currentFont.usedRunes[c] = c
+	}
+}
+
+// useFontEncoding records every printable code of the encoding of the
+// current font as used when that font is a subsettable TrueType font
+func (f *Bdf) useFontEncoding() {
+	if f.currentFont.Tp != "TrueType" || f.currentFont.usedRunes == nil {
+		return
+	}
+	for c := 32; c < 256; c++ {
+		f.currentFont.usedRunes[c] = c
+	}
+}
+
+// fontUnicodes returns the Unicode value of each code of the encoding of
+// font. Definition files without this table fall back to the code page file
+// named by the Enc field, looked up among the embedded maps first and then
+// through the font loader or font directory. Nil is returned if neither is
+// available.
+func (f *Bdf) fontUnicodes(font fontDefType) []int {
+	if len(font.Uv) == 256 {
+		return font.Uv
+	}
+	if font.Enc == "" {
+		return nil
+	}
+	var encList encListType
+	emb, err := embFS.Open("font_embed/" + font.Enc + ".map")
+	if err == nil {
+		encList, err = readMap(emb)
+		emb.Close()
+	} else {
+		var buf []byte
+		if buf, err = f.loadFontFile(font.Enc + ".map"); err == nil {
+			encList, err = readMap(bytes.NewReader(buf))
+		}
+	}
+	if err != nil {
+		return nil
+	}
+	uv := make([]int, len(encList))
+	for j, enc := range encList {
+		uv[j] = enc.uv
+	}
+	return uv
+}
+
+// subsetFontFile reduces the TrueType font program stored as file to the
+// glyphs of the characters printed with the fonts that embed it. The glyphs
+// are renumbered and reached through a new Unicode cmap, so the font keeps
+// working with the WinAnsi or Differences encoding written in the font
+// dictionary. The returned program is zlib compressed; ok is false if the
+// font cannot be subset, in which case it is embedded unchanged.
+func (f *Bdf) subsetFontFile(file string, font []byte, compressed bool) (data []byte, length1 int, tag string, ok bool) {
+	runes := make(map[int]int)
+	trueType := false
+	for _, def := range f.fonts {
+		if def.File != file {
+			continue
+		}
+		if def.Tp != "TrueType" || def.usedRunes == nil {
+			return
+		}
+		trueType = true
+		uv := f.fontUnicodes(def)
+		if uv == nil {
+			return
+		}
+		codes := make([]int, 0, len(def.usedRunes))
+		for c := range def.usedRunes {
+			codes = append(codes, c)
+		}
+		// Aliases such as the page count are replaced after the text has
+		// been recorded, so their replacements may be printed in any font
+		for _, replacement := range f.aliasMap {
+			for j := 0; j < len(replacement); j++ {
+				codes = append(codes, int(replacement[j]))
+			}
+		}
+		for _, c := range codes {
+			if c >= 0 && c < len(uv) && uv[c] > 0 {
+				runes[uv[c]] = uv[c]
+			}
+		}
+	}
+	if !trueType {
+		return
+	}
+	if compressed {
+		mem, err := xmem.uncompress(font)
+		if err != nil {
+			return
+		}
+		font = mem.copy()
+		mem.release()
+	}
+	utf := newUTF8Font(&fileReader{readerPosition: 0, array: font})
+	if utf.parseFile() != nil {
+		return
+	}
+	cut := utf.GenerateCutFont(runes)
+	if len(cut) == 0 {
+		return
+	}
+	mem := xmem.compress(cut)
+	data = mem.copy()
+	mem.release()
+	return data, len(cut), subsetTag(runes), true
+}
+
+// subsetTag derives the six letter tag that marks a subset font name from
+// the characters it contains, so that identical subsets share a tag
+func subsetTag(runes map[int]int) string {
+	list := make([]int, 0, len(runes))
+	for r := range runes {
+		list = append(list, r)
+	}
+	sort.Ints(list)
+	var s fmtBuffer
+	for _, r := range list {
+		s.printf("%d ", r)
+	}
+	sum := sha1.Sum([]byte(s.String()))
+	tag := make([]byte, 6)
+	for j := range tag {
+		tag[j] = 'A' + sum[j]%26
+	}
+	return string(tag)
+}
@@ -0,0 +1,187 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+const subsetFontDir = "../g2d/resource/font"
+
+// subsetOutput returns the BaseFont name and the character to glyph map of
+// the single embedded TrueType font of pdf
+func subsetOutput(t *testing.T, pdf *Bdf) (name string, length1 int, chars map[int]int) {
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.Bytes()
+	m := regexp.MustCompile(`/BaseFont /(\S+)\s+/Subtype /TrueType`).FindSubmatch(doc)
+	if m == nil {
+		t.Fatal("TrueType font dictionary not found")
+	}
+	name = string(m[1])
+	m = regexp.MustCompile(`/FontFile2 (\d+) 0 R`).FindSubmatch(doc)
+	if m == nil {
+		t.Fatal("font file reference not found")
+	}
+	obj := regexp.MustCompile(`(?s)\n` + string(m[1]) + ` 0 obj\n<<.*?/Length1 (\d+)\n>>\nstream\n`).FindSubmatchIndex(doc)
+	if obj == nil {
+		t.Fatal("font file object not found")
+	}
+	length1, _ = strconv.Atoi(string(doc[obj[2]:obj[3]]))
+	r, err := zlib.NewReader(bytes.NewReader(doc[obj[1]:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := ioutil.ReadAll(r)
+	if err != nil && len(font) < length1 {
+		t.Fatal(err)
+	}
+	utf := newUTF8Font(&fileReader{readerPosition: 0, array: font[:length1]})
+	if err = utf.parseFile(); err != nil {
+		t.Fatal(err)
+	}
+	utf.generateCMAP()
+	return name, length1, utf.charSymbolDictionary
+}
+
+func subsetDoc(t *testing.T, fontDir string) *Bdf {
+	pdf := New("P", "mm", "A4", fontDir)
+	pdf.SetCompression(false)
+	pdf.AddPage()
+	return pdf
+}
+
+func TestFontSubsetDefinition(t *testing.T) {
+	jsonBytes, err := ioutil.ReadFile(filepath.Join(subsetFontDir, "luximbi.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zBytes, err := ioutil.ReadFile(filepath.Join(subsetFontDir, "luximbi.z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf := subsetDoc(t, "")
+	pdf.AddFontFromBytes("luxi", "BI", jsonBytes, zBytes)
+	pdf.SetFont("luxi", "BI", 12)
+	pdf.Cell(40, 10, "Invoice 42")
+	pdf.Text(20, 40, "Total \x80")
+	name, length1, chars := subsetOutput(t, pdf)
+	if !regexp.MustCompile(`^[A-Z]{6}\+LuxiMono-BoldOblique$`).MatchString(name) {
+		t.Fatalf("unexpected subset font name %s", name)
+	}
+	if length1 >= 69872/4 {
+		t.Fatalf("subset font program has %d bytes", length1)
+	}
+	for _, r := range "Invoice42Tal€" {
+		if chars[int(r)] == 0 {
+			t.Fatalf("character %q missing from subset", r)
+		}
+	}
+	for _, r := range "Zxq" {
+		if _, ok := chars[int(r)]; ok {
+			t.Fatalf("unused character %q kept in subset", r)
+		}
+	}
+}
+
+func TestFontSubsetMakeFont(t *testing.T) {
+	if !fileExist(shapingDevanagariFont) {
+		t.Skip("font not available")
+	}
+	dir, err := ioutil.TempDir("", "subset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = MakeFont(shapingDevanagariFont, "font_embed/cp1250.map", dir, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var def fontDefType
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "FreeSans.json"))
+	if err == nil {
+		err = json.Unmarshal(buf, &def)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(def.Uv) != 256 || def.Uv[0x8A] != 0x160 {
+		t.Fatalf("definition lacks the encoding's Unicode values")
+	}
+	pdf := subsetDoc(t, dir)
+	pdf.AddFont("free", "", "FreeSans.json")
+	pdf.SetFont("free", "", 12)
+	pdf.Write(6, "\x8Akoda \x9A")
+	name, _, chars := subsetOutput(t, pdf)
+	if !regexp.MustCompile(`^[A-Z]{6}\+FreeSans$`).MatchString(name) {
+		t.Fatalf("unexpected subset font name %s", name)
+	}
+	// Š and š differ from cp1252 and are reached through /Differences
+	for _, r := range "Škoda š" {
+		if chars[int(r)] == 0 {
+			t.Fatalf("character %q missing from subset", r)
+		}
+	}
+	if _, ok := chars[0x8A]; ok {
+		t.Fatal("code point used instead of Unicode value")
+	}
+}
+
+func TestFontSubsetDisabled(t *testing.T) {
+	jsonBytes, _ := ioutil.ReadFile(filepath.Join(subsetFontDir, "luximbi.json"))
+	zBytes, _ := ioutil.ReadFile(filepath.Join(subsetFontDir, "luximbi.z"))
+	pdf := subsetDoc(t, "")
+	pdf.SetFontSubsetting(false)
+	pdf.AddFontFromBytes("luxi", "BI", jsonBytes, zBytes)
+	pdf.SetFont("luxi", "BI", 12)
+	pdf.Cell(40, 10, "Invoice 42")
+	name, length1, _ := subsetOutput(t, pdf)
+	if name != "LuxiMono-BoldOblique" || length1 != 69872 {
+		t.Fatalf("font subset although disabled: %s, %d bytes", name, length1)
+	}
+}
+
+func TestFontSubsetFormField(t *testing.T) {
+	jsonBytes, _ := ioutil.ReadFile(filepath.Join(subsetFontDir, "luximbi.json"))
+	zBytes, _ := ioutil.ReadFile(filepath.Join(subsetFontDir, "luximbi.z"))
+	pdf := subsetDoc(t, "")
+	pdf.AddFontFromBytes("luxi", "BI", jsonBytes, zBytes)
+	pdf.SetFont("luxi", "BI", 12)
+	pdf.TextField("name", 20, 20, 60, 8, "Ann", FormFieldOptions{Border: true})
+	_, _, chars := subsetOutput(t, pdf)
+	// text typed into the field in a viewer may use any character of the
+	// encoding
+	for _, r := range "AnZxq€é" {
+		if chars[int(r)] == 0 {
+			t.Fatalf("character %q missing from form field font", r)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"math"
+	"strconv"
+)
+
+// FootnoteOptions sets up the notes added with Footnote().
+//
+// The notes are printed with FontFamily, FontStyle and FontSize in points,
+// which default to the font current when the note is added, at 80 percent
+// of its size, and with Color. Lines are LineHeight apart, zero selecting
+// 1.25 times the font size, and the text of a note is indented by Indent,
+// zero leaving room for a two-digit number. MarkerSize is the size in points
+// of the superscript marker in the text, zero selecting 60 percent of the
+// current font size.
+//
+// Footnotes are separated from the text of the page by a rule of RuleWidth,
+// zero selecting a third of the width between the margins and a negative
+// value omitting the rule.
+//
+// With Endnotes set the notes are collected rather than placed at the bottom
+// of their page, and printed by Endnotes() below EndnoteTitle, if not empty.
+type FootnoteOptions struct {
+	FontFamily   string
+	FontStyle    string
+	FontSize     float64
+	Color        RGBType
+	LineHeight   float64
+	Indent       float64
+	MarkerSize   float64
+	RuleWidth    float64
+	Endnotes     bool
+	EndnoteTitle string
+}
+
+// footnoteRecType holds the footnotes of the current page and the endnotes
+type footnoteRecType struct {
+	options  FootnoteOptions
+	count    int            // number of notes so far
+	page     []footnoteType // footnotes printed at the bottom of the current page
+	carry    []footnoteType // footnotes continued on the next page
+	reserved float64        // height reserved for footnotes on the current page
+	endnotes []footnoteType
+}
+
+// footnoteType is a note, or the part of a footnote printed on one page
+type footnoteType struct {
+	label    string
+	text     string   // text of an endnote
+	lines    []string // wrapped lines of a footnote
+	cont     bool     // continuation of a footnote started on a previous page
+	link     int      // link target of the marker
+	family   string
+	style    string
+	sizePt   float64
+	lineHt   float64
+	indent   float64
+	rule     float64
+	color    RGBType
+	ruleSkip float64 // space above the notes holding the rule
+}
+
+// SetFootnoteOptions sets the options of the notes added after this call.
+func (f *Bdf) SetFootnoteOptions(options FootnoteOptions) {
+	f.footnotes.options = options
+}
+
+// Footnote adds a note with the text txtStr. Notes are numbered from 1
+// through the document. The number is written at the current position as a
+// superscript, in the manner of SubWrite(), so a note is usually added
+// between calls to Write(). The marker links to the note.
+//
+// A footnote is printed at the bottom of the page, above the bottom margin
+// and therefore above a footer printed in it. The space it takes is reserved
+// as soon as the note is added, so that the text that follows breaks to the
+// next page earlier. Lines of a note that do not fit on the page are carried
+// over to the next one. Footnotes are not available in a column layout.
+//
+// In endnote mode, see SetFootnoteOptions(), the notes are printed by
+// Endnotes() instead. Endnotes that have not been printed when the document
+// is closed are printed after its content.
+func (f *Bdf) Footnote(txtStr string) {
+	if f.err != nil {
+		return
+	}
+	if f.page == 0 {
+		f.SetErrorf("cannot add a footnote without first adding a page")
+		return
+	}
+	n := f.newNote(txtStr)
+	ht := f.lasth
+	if ht <= 0 {
+		ht = 1.25 * f.fontSize
+	}
+	markerPt := f.footnotes.options.MarkerSize
+	if markerPt <= 0 {
+		markerPt = 0.6 * f.fontSizePt
+	}
+	f.SubWrite(ht, n.label, markerPt, 0.4*f.fontSizePt, n.link, "")
+	f.addNote(n, txtStr, f.y+ht)
+}
+
+// AddFootnote adds a note like Footnote() but does not write its number,
+// which it returns so that it can be included in text printed by Cell() or
+// MultiCell(). A footnote is placed on the current page, below the current
+// position.
+func (f *Bdf) AddFootnote(txtStr string) string {
+	if f.err != nil {
+		return ""
+	}
+	if f.page == 0 {
+		f.SetErrorf("cannot add a footnote without first adding a page")
+		return ""
+	}
+	n := f.newNote(txtStr)
+	f.addNote(n, txtStr, f.y)
+	return n.label
+}
+
+// newNote numbers a note and sets it up with the current options
+func (f *Bdf) newNote(txtStr string) (n footnoteType) {
+	opt := f.footnotes.options
+	f.footnotes.count++
+	n.label = strconv.Itoa(f.footnotes.count)
+	n.text = txtStr
+	n.link = f.AddLink()
+	n.family, n.style, n.sizePt = opt.FontFamily, opt.FontStyle, opt.FontSize
+	if n.family == "" {
+		n.family = f.fontFamily
+	}
+	if n.sizePt <= 0 {
+		n.sizePt = 0.8 * f.fontSizePt
+	}
+	n.lineHt = opt.LineHeight
+	if n.lineHt <= 0 {
+		n.lineHt = 1.25 * n.sizePt / f.k
+	}
+	n.color = opt.Color
+	n.rule = opt.RuleWidth
+	if n.rule == 0 {
+		n.rule = (f.w - f.lMargin - f.rMargin) / 3
+	}
+	n.ruleSkip = n.lineHt
+	return
+}
+
+// addNote records a note; a footnote reserves space on the current page
+// below the position bottom
+func (f *Bdf) addNote(n footnoteType, txtStr string, bottom float64) {
+	fn := &f.footnotes
+	if fn.options.Endnotes {
+		fn.endnotes = append(fn.endnotes, n)
+		return
+	}
+	if f.columns.active {
+		f.SetErrorf("footnotes are not supported in a column layout")
+		return
+	}
+	family, style, sizePt := f.fontFamily, f.fontStyle, f.fontSizePt
+	if f.underline {
+		style += "U"
+	}
+	if f.strikeout {
+		style += "S"
+	}
+	cMargin := f.cMargin
+	f.cMargin = 0
+	f.SetFont(n.family, n.style, n.sizePt)
+	n.indent = fn.options.Indent
+	if n.indent <= 0 {
+		n.indent = f.GetStringWidth("00 ")
+	}
+	n.lines = f.tocLines(txtStr, f.w-f.lMargin-f.rMargin-n.indent)
+	f.cMargin = cMargin
+	if family != "" {
+		f.SetFont(family, style, sizePt)
+	}
+	if f.err != nil {
+		return
+	}
+	if len(fn.carry) > 0 {
+		// keep the notes in order
+		fn.carry = append(fn.carry, n)
+		return
+	}
+	f.placeNote(n, f.pageBreakTrigger-bottom)
+}
+
+// placeNote puts as many lines of a footnote on the current page as fit in
+// avail and carries the others over to the next page
+func (f *Bdf) placeNote(n footnoteType, avail float64) {
+	fn := &f.footnotes
+	skip := 0.0
+	if len(fn.page) == 0 {
+		skip = n.ruleSkip
+	}
+	count := int(math.Floor((avail-skip)/n.lineHt + 1e-9))
+	if count <= 0 {
+		fn.carry = append(fn.carry, n)
+		return
+	}
+	if count < len(n.lines) {
+		rest := n
+		rest.lines = n.lines[count:]
+		rest.cont = true
+		fn.carry = append(fn.carry, rest)
+		n.lines = n.lines[:count]
+	}
+	ht := skip + float64(len(n.lines))*n.lineHt
+	fn.reserved += ht
+	f.pageBreakTrigger -= ht
+	fn.page = append(fn.page, n)
+}
+
+// footnotesPage places the footnotes carried over from the previous page on
+// a page that has just been started. They take at most half of the space
+// left on the page.
+func (f *Bdf) footnotesPage() {
+	fn := &f.footnotes
+	if len(fn.carry) == 0 {
+		return
+	}
+	avail := (f.pageBreakTrigger - f.y) / 2
+	carry := fn.carry
+	fn.carry = nil
+	for j, n := range carry {
+		if len(fn.carry) > 0 {
+			fn.carry = append(fn.carry, carry[j:]...)
+			break
+		}
+		before := fn.reserved
+		f.placeNote(n, avail)
+		avail -= fn.reserved - before
+	}
+	if len(fn.page) == 0 {
+		f.SetErrorf("footnote %s does not fit on the page", carry[0].label)
+	}
+}
+
+// putFootnotes prints the footnotes of the current page above its bottom
+// margin. It is called before the footer of the page.
+func (f *Bdf) putFootnotes() {
+	fn := &f.footnotes
+	if len(fn.page) == 0 || f.err != nil {
+		return
+	}
+	// The notes are enclosed in q and Q
+	st := f.saveDrawState()
+	defer f.restoreDrawState(st)
+	f.cMargin = 0
+	f.autoPageBreak = false
+	f.underline, f.strikeout = false, false
+
+	f.out("q")
+	f.y = f.pageBreakTrigger
+	for j, n := range fn.page {
+		if j == 0 {
+			if n.rule > 0 {
+				ruleY := f.y + n.ruleSkip/2
+				f.SetDrawColor(n.color.R, n.color.G, n.color.B)
+				f.SetLineWidth(0.5 / f.k)
+				f.Line(f.lMargin, ruleY, f.lMargin+n.rule, ruleY)
+			}
+			f.y += n.ruleSkip
+		}
+		if f.structTree.enabled {
+			f.BeginStructElem(StructNote)
+		}
+		f.SetFont(n.family, n.style, n.sizePt)
+		f.SetTextColor(n.color.R, n.color.G, n.color.B)
+		f.x = f.lMargin
+		if !n.cont {
+			f.SetLink(n.link, f.y, -1)
+			f.CellFormat(n.indent, n.lineHt, n.label, "", 0, "L", false, 0, "")
+		}
+		for _, line := range n.lines {
+			f.x = f.lMargin + n.indent
+			f.CellFormat(f.w-f.rMargin-f.x, n.lineHt, line, "", 2, "L", false, 0, "")
+		}
+		if f.structTree.enabled {
+			f.EndStructElem()
+		}
+	}
+	f.out("Q")
+	f.pageBreakTrigger += fn.reserved
+	fn.reserved = 0
+	fn.page = nil
+}
+
+// Endnotes prints the notes collected in endnote mode at the current
+// position, below the title set with SetFootnoteOptions(), and starts a new
+// collection. See Footnote().
+func (f *Bdf) Endnotes() {
+	fn := &f.footnotes
+	if f.err != nil || len(fn.endnotes) == 0 {
+		return
+	}
+	notes := fn.endnotes
+	fn.endnotes = nil
+	lMargin := f.lMargin
+	if title := fn.options.EndnoteTitle; title != "" {
+		n := notes[0]
+		f.SetFont(n.family, "B", 1.2*n.sizePt)
+		f.SetTextColor(n.color.R, n.color.G, n.color.B)
+		f.Ln(0)
+		f.MultiCell(0, 1.2*n.lineHt, title, "", "L", false)
+		f.Ln(n.lineHt / 2)
+	}
+	for _, n := range notes {
+		f.SetFont(n.family, n.style, n.sizePt)
+		f.SetTextColor(n.color.R, n.color.G, n.color.B)
+		indent := f.footnotes.options.Indent
+		if indent <= 0 {
+			indent = f.GetStringWidth("00 ")
+		}
+		if f.y+n.lineHt > f.pageBreakTrigger && !f.nextFrame() && f.acceptPageBreak() {
+			f.AddPageFormat(f.curOrientation, f.curPageSize)
+		}
+		if f.structTree.enabled {
+			f.BeginStructElem(StructNote)
+		}
+		f.x = f.lMargin
+		f.SetLink(n.link, f.y, -1)
+		f.CellFormat(indent, n.lineHt, n.label, "", 0, "L", false, 0, "")
+		f.SetLeftMargin(lMargin + indent)
+		f.MultiCell(0, n.lineHt, n.text, "", "L", false)
+		f.SetLeftMargin(lMargin)
+		if f.structTree.enabled {
+			f.EndStructElem()
+		}
+		if f.err != nil {
+			return
+		}
+	}
+}
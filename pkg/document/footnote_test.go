@@ -0,0 +1,182 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// footnoteLines returns the vertical position, in points from the bottom of
+// the page, of each text line of page n that contains str
+func footnoteLines(pdf *Bdf, n int, str string) (list []float64) {
+	for _, line := range strings.Split(pdf.pages[n].String(), "\n") {
+		if !strings.Contains(line, str) {
+			continue
+		}
+		var x, y float64
+		if pos := strings.Index(line, "BT "); pos >= 0 {
+			if _, err := fmt.Sscanf(line[pos:], "BT %f %f Td", &x, &y); err == nil {
+				list = append(list, y)
+			}
+		}
+	}
+	return
+}
+
+const footnoteText = "Lorem ipsum dolor sit amet, consectetur adipiscing elit. "
+
+func TestFootnote(t *testing.T) {
+	pdf := New("P", "mm", "A5", "")
+	pdf.SetFont("Times", "", 11)
+	pdf.AddPage()
+	for j := 1; j <= 6; j++ {
+		pdf.Write(5, strings.Repeat(footnoteText, 8))
+		pdf.Footnote(fmt.Sprintf("Note %d.", j))
+		pdf.Ln(8)
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if pdf.PageCount() != 2 {
+		t.Fatalf("got %d pages", pdf.PageCount())
+	}
+	bottom := 20 * pdf.k
+	for n := 1; n <= 2; n++ {
+		body := footnoteLines(pdf, n, "Lorem")
+		notes := footnoteLines(pdf, n, "(Note ")
+		if len(notes) == 0 {
+			t.Fatalf("page %d has no notes", n)
+		}
+		for _, y := range notes {
+			if y < bottom || y > body[len(body)-1] {
+				t.Fatalf("page %d: note at %.2f, text ends at %.2f", n, y, body[len(body)-1])
+			}
+		}
+	}
+	// The markers link to the notes
+	if pdf.links[1].page != 1 || pdf.links[6].page != 2 {
+		t.Fatalf("notes linked to pages %d and %d", pdf.links[1].page, pdf.links[6].page)
+	}
+}
+
+func TestFootnoteCarry(t *testing.T) {
+	pdf := New("P", "mm", "A5", "")
+	pdf.SetFont("Times", "", 11)
+	pdf.AddPage()
+	pdf.SetY(160)
+	pdf.Write(5, "Text close to the bottom")
+	note := strings.Repeat("A long note that goes on and on. ", 20) + "Last words."
+	pdf.Footnote(note)
+	pdf.Ln(5)
+	pdf.Write(5, "Next line")
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if pdf.PageCount() != 2 {
+		t.Fatalf("got %d pages", pdf.PageCount())
+	}
+	first, second := footnoteLines(pdf, 1, "A long note"), footnoteLines(pdf, 2, "A long note")
+	if len(first) == 0 || len(second) == 0 {
+		t.Fatalf("note is not split: %d lines, then %d lines", len(first), len(second))
+	}
+	if len(footnoteLines(pdf, 2, "Last words")) != 1 || len(footnoteLines(pdf, 2, "(1)")) != 0 {
+		t.Fatalf("continued note is not printed as expected")
+	}
+	if next := footnoteLines(pdf, 2, "Next line"); len(next) != 1 || next[0] < second[0] {
+		t.Fatalf("text does not continue on the second page above the note")
+	}
+}
+
+func TestEndnotes(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.SetFootnoteOptions(FootnoteOptions{Endnotes: true, EndnoteTitle: "Notes", FontSize: 9})
+	pdf.AddPage()
+	pdf.Write(5, "First chapter")
+	pdf.Footnote("Note A")
+	pdf.Write(5, " continues")
+	pdf.Footnote("Note B")
+	pdf.Ln(10)
+	pdf.Endnotes()
+	pdf.AddPage()
+	pdf.Write(5, "Second chapter")
+	pdf.Footnote("Note C")
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	first := pdf.pages[1].String()
+	a, b := strings.Index(first, "(Note A)"), strings.Index(first, "(Note B)")
+	title := strings.Index(first, "(Notes)")
+	if title < 0 || a < title || b < a {
+		t.Fatalf("endnotes of the first chapter are not printed in order")
+	}
+	if strings.Contains(first, "Note C") || !strings.Contains(pdf.pages[2].String(), "(Note C)") {
+		t.Fatalf("remaining endnote is not printed at the end")
+	}
+	if !strings.Contains(pdf.pages[2].String(), "(3)Tj") {
+		t.Fatalf("endnotes are not numbered through the document")
+	}
+}
+
+func TestFootnoteAutoPageBreak(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.AddPage()
+	pdf.Write(5, "Text")
+	pdf.Footnote("Note")
+	reserved := pdf.footnotes.reserved
+	if reserved <= 0 {
+		t.Fatalf("no space reserved")
+	}
+	pdf.SetAutoPageBreak(true, 20)
+	if got, want := pdf.pageBreakTrigger, pdf.h-20-reserved; math.Abs(got-want) > 1e-9 {
+		t.Errorf("trigger %.2f on the page of the note, expected %.2f", got, want)
+	}
+	pdf.AddPage()
+	if got := pdf.pageBreakTrigger; math.Abs(got-(pdf.h-20)) > 1e-9 {
+		t.Errorf("trigger %.2f on the next page, expected %.2f", got, pdf.h-20)
+	}
+}
+
+func TestFootnoteErrors(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.Footnote("Too early")
+	if pdf.Error() == nil {
+		t.Fatalf("footnote without a page did not fail")
+	}
+	pdf = New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.AddPage()
+	pdf.SetColumns(2, 5)
+	pdf.Write(5, "Text")
+	pdf.Footnote("In a column")
+	if pdf.Error() == nil {
+		t.Fatalf("footnote in a column layout did not fail")
+	}
+}
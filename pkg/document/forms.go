@@ -0,0 +1,645 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Field flags shared by all form field types
+const (
+	formFlagReadOnly = 1 << 0
+	formFlagRequired = 1 << 1
+	formFlagNoExport = 1 << 2
+	// text fields
+	formFlagMultiline = 1 << 12
+	formFlagPassword  = 1 << 13
+	// button fields
+	formFlagNoToggleToOff = 1 << 14
+	formFlagRadio         = 1 << 15
+	formFlagPushButton    = 1 << 16
+	// choice fields
+	formFlagCombo = 1 << 17
+	formFlagEdit  = 1 << 18
+)
+
+// FormFieldOptions holds the settings of an interactive form field. Options
+// that do not apply to a field type are ignored.
+type FormFieldOptions struct {
+	// Tooltip is shown by viewers when the pointer rests on the field
+	Tooltip string
+	// ReadOnly prevents the user from changing the value
+	ReadOnly bool
+	// Required marks the field as mandatory when the form is submitted
+	Required bool
+	// NoExport excludes the field from form submission
+	NoExport bool
+	// Border draws a border with the current draw color and line width
+	Border bool
+	// Fill paints the background with the current fill color
+	Fill bool
+	// Align positions the text of text fields and combo boxes: "L" (the
+	// default), "C" or "R"
+	Align string
+	// Multiline allows a text field to hold several lines
+	Multiline bool
+	// Password hides the characters typed into a text field
+	Password bool
+	// MaxLen limits the number of characters of a text field when positive
+	MaxLen int
+	// Editable allows a combo box to accept values not in its option list
+	Editable bool
+}
+
+// formFieldType is a terminal field with a single widget, or a radio group
+// whose kids are the widgets of its buttons
+type formFieldType struct {
+	kind     string // field type: Tx, Btn, Ch or Sig
+	name     string
+	utf8     bool // strings are UTF-8 encoded
+	page     int
+	rect     [4]float64 // widget rectangle in points
+	flags    int
+	value    string // text value, or name of the "on" state of buttons
+	opts     []string
+	da       string
+	mk       string // appearance characteristics dictionary
+	q        int    // quadding: 0 left, 1 centered, 2 right
+	maxLen   int
+	tooltip  string
+	action   string // JavaScript action of push buttons
+	onState  string // appearance state name of checkboxes and radio buttons
+	selected bool
+	normal   []byte // normal appearance ("on" state of buttons)
+	off      []byte // "off" appearance of checkboxes and radio buttons
+	kids     []*formFieldType
+	objNum   int
+}
+
+type formRecType struct {
+	fields      []*formFieldType
+	names       map[string]*formFieldType
+	pageWidgets map[int][]int // widget object numbers by page
+	sig         bool          // the form contains signature fields
+}
+
+// formAdd validates and registers a new terminal field on the current page
+func (f *Bdf) formAdd(fld *formFieldType, x, y, w, h float64, opts FormFieldOptions) bool {
+	if f.err != nil {
+		return false
+	}
+	if f.page == 0 {
+		f.err = fmt.Errorf("form field %q requires a page", fld.name)
+		return false
+	}
+	if fld.name == "" || strings.ContainsRune(fld.name, '.') {
+		f.err = fmt.Errorf("invalid form field name %q", fld.name)
+		return false
+	}
+	if f.form.names == nil {
+		f.form.names = make(map[string]*formFieldType)
+		f.form.pageWidgets = make(map[int][]int)
+	}
+	if _, ok := f.form.names[fld.name]; ok {
+		f.err = fmt.Errorf("form field %q is already defined", fld.name)
+		return false
+	}
+	if f.currentFont.Name == "" && fld.kind != "Sig" {
+		f.err = fmt.Errorf("font has not been set; unable to create form field %q", fld.name)
+		return false
+	}
+	fld.utf8 = f.isCurrentUTF8
+	fld.page = f.page
+	fld.rect = [4]float64{x * f.k, f.hPt - (y+h)*f.k, (x + w) * f.k, f.hPt - y*f.k}
+	fld.tooltip = opts.Tooltip
+	if opts.ReadOnly {
+		fld.flags |= formFlagReadOnly
+	}
+	if opts.Required {
+		fld.flags |= formFlagRequired
+	}
+	if opts.NoExport {
+		fld.flags |= formFlagNoExport
+	}
+	switch opts.Align {
+	case "C":
+		fld.q = 1
+	case "R":
+		fld.q = 2
+	}
+	if f.currentFont.Name != "" {
+		fld.da = fmt.Sprintf("/F%s %.2f Tf %s", f.currentFont.i, f.fontSizePt, f.color.text.str)
+		if fld.kind == "Tx" || fld.kind == "Ch" {
+			// viewers draw typed or selected text with the default
+			// appearance font, so it must not be cut to the printed glyphs
+			f.useFontEncoding()
+		}
+	}
+	var mk []string
+	if opts.Border {
+		mk = append(mk, "/BC "+formColorArray(f.color.draw))
+	}
+	if opts.Fill {
+		mk = append(mk, "/BG "+formColorArray(f.color.fill))
+	}
+	fld.mk = strings.Join(mk, " ")
+	f.form.names[fld.name] = fld
+	f.form.fields = append(f.form.fields, fld)
+	return true
+}
+
+func formColorArray(clr colorType) string {
+	if clr.gray {
+		return fmt.Sprintf("[%.3f]", clr.r)
+	}
+	return fmt.Sprintf("[%.3f %.3f %.3f]", clr.r, clr.g, clr.b)
+}
+
+// formBackground returns the operators painting the background and border of
+// a w by h point widget appearance
+func (f *Bdf) formBackground(w, h float64, opts FormFieldOptions) string {
+	var s fmtBuffer
+	if opts.Fill {
+		s.printf("%s 0 0 %.2f %.2f re f\n", f.color.fill.str, w, h)
+	}
+	if opts.Border {
+		lw := f.lineWidth * f.k
+		s.printf("%s %.2f w %.2f %.2f %.2f %.2f re S\n", f.color.draw.str, lw, lw/2, lw/2, w-lw, h-lw)
+	}
+	return s.String()
+}
+
+// formEncode returns the escaped content stream form of s in the current
+// font, recording the glyphs it uses
+func (f *Bdf) formEncode(s string) string {
+	if f.isCurrentUTF8 {
+		for _, r := range s {
+			f.currentFont.usedRunes[int(r)] = int(r)
+		}
+		return f.escape(utf8toutf16(s, false))
+	}
+	f.useFontBytes(s)
+	return f.escape(s)
+}
+
+// formTextLine returns the operators showing one line of text whose
+// baseline is at y, aligned within a box of width w
+func (f *Bdf) formTextLine(s string, y, w float64, q int) string {
+	const pad = 2.0
+	x := pad
+	switch q {
+	case 1:
+		x = (w - f.GetStringWidth(s)*f.k) / 2
+	case 2:
+		x = w - pad - f.GetStringWidth(s)*f.k
+	}
+	return fmt.Sprintf("%.2f %.2f Td (%s) Tj\n", x, y, f.formEncode(s))
+}
+
+// formTextAppearance lays out lines of text in a variable text appearance
+func (f *Bdf) formTextAppearance(lines []string, w, h float64, q int, multiline bool, opts FormFieldOptions) []byte {
+	var s fmtBuffer
+	s.printf("%s/Tx BMC\nq 1 1 %.2f %.2f re W n\n", f.formBackground(w, h, opts), w-2, h-2)
+	size := f.fontSizePt
+	lead := size * 1.15
+	y := (h-size)/2 + size*0.22
+	if multiline {
+		y = h - 2 - size
+	}
+	for j, line := range lines {
+		s.printf("BT /F%s %.2f Tf %s\n", f.currentFont.i, size, f.color.text.str)
+		s.printf("%sET\n", f.formTextLine(line, y-float64(j)*lead, w, q))
+	}
+	s.printf("Q\nEMC")
+	return s.Bytes()
+}
+
+// TextField adds a fillable text field named name to the current page. The
+// field occupies the rectangle at (x, y) with width w and height h, and
+// value is its initial and default value. The current font, font size and
+// text color are used to display the value. Multiline, Password and MaxLen
+// of opts control the behavior of the field.
+func (f *Bdf) TextField(name string, x, y, w, h float64, value string, opts FormFieldOptions) {
+	fld := &formFieldType{kind: "Tx", name: name, value: value, maxLen: opts.MaxLen}
+	if !f.formAdd(fld, x, y, w, h, opts) {
+		return
+	}
+	if opts.Multiline {
+		fld.flags |= formFlagMultiline
+	}
+	if opts.Password {
+		fld.flags |= formFlagPassword
+	}
+	wd, ht := w*f.k, h*f.k
+	var lines []string
+	switch {
+	case value == "":
+	case opts.Password:
+		lines = []string{strings.Repeat("*", len([]rune(value)))}
+	case opts.Multiline:
+		lines = f.SplitText(value, (wd-4)/f.k+2*f.cMargin)
+	default:
+		lines = []string{value}
+	}
+	fld.normal = f.formTextAppearance(lines, wd, ht, fld.q, opts.Multiline, opts)
+}
+
+// CheckBox adds a checkbox named name to the current page. The box is a
+// square of the given size with its upper left corner at (x, y). The check
+// mark is drawn with the current text color. The field has the value "Yes"
+// when checked and "Off" otherwise.
+func (f *Bdf) CheckBox(name string, x, y, size float64, checked bool, opts FormFieldOptions) {
+	fld := &formFieldType{kind: "Btn", name: name, onState: "Yes", selected: checked}
+	if !f.formAdd(fld, x, y, size, size, opts) {
+		return
+	}
+	s := size * f.k
+	bg := f.formBackground(s, s, opts)
+	fld.off = []byte(bg)
+	fld.normal = []byte(fmt.Sprintf("%sq %s %.2f w 1 J 1 j %.2f %.2f m %.2f %.2f l %.2f %.2f l S Q",
+		bg, strings.ToUpper(f.color.text.str), s*0.1, s*0.2, s*0.5, s*0.42, s*0.25, s*0.8, s*0.78))
+}
+
+// RadioButton adds a button to the radio group named group on the current
+// page. Buttons of a group are mutually exclusive; value names the button and
+// becomes the value of the group when it is selected. The button is a circle
+// of the given diameter with its bounding square's upper left corner at (x,
+// y); the selection mark is drawn with the current text color. The settings
+// of opts that apply to the whole group are taken from its first button.
+func (f *Bdf) RadioButton(group, value string, x, y, size float64, selected bool, opts FormFieldOptions) {
+	if f.err != nil {
+		return
+	}
+	parent, ok := f.form.names[group]
+	if ok && (parent.kind != "Btn" || parent.flags&formFlagRadio == 0) {
+		f.err = fmt.Errorf("form field %q is not a radio group", group)
+		return
+	}
+	if ok {
+		for _, kid := range parent.kids {
+			if kid.onState == value {
+				f.err = fmt.Errorf("radio group %q already has a button %q", group, value)
+				return
+			}
+		}
+	}
+	if value == "" || value == "Off" {
+		f.err = fmt.Errorf("invalid radio button value %q", value)
+		return
+	}
+	kid := &formFieldType{kind: "Btn", name: group, onState: value, selected: selected}
+	if !ok {
+		parent = &formFieldType{kind: "Btn", name: group, flags: formFlagRadio | formFlagNoToggleToOff}
+		if !f.formAdd(parent, x, y, size, size, opts) {
+			return
+		}
+	}
+	kid.page = f.page
+	kid.rect = [4]float64{x * f.k, f.hPt - (y+size)*f.k, (x + size) * f.k, f.hPt - y*f.k}
+	kid.da = parent.da
+	kid.mk = parent.mk
+	if selected {
+		for _, k := range parent.kids {
+			k.selected = false
+		}
+		parent.value = value
+	}
+	s := size * f.k
+	r := s / 2
+	var bg fmtBuffer
+	if opts.Fill {
+		bg.printf("%s %s f\n", f.color.fill.str, formCirclePath(r, r, r))
+	}
+	if opts.Border {
+		lw := f.lineWidth * f.k
+		bg.printf("%s %.2f w %s S\n", f.color.draw.str, lw, formCirclePath(r, r, r-lw/2))
+	}
+	kid.off = bg.Bytes()
+	kid.normal = []byte(fmt.Sprintf("%s%s %s f", bg.String(), f.color.text.str, formCirclePath(r, r, r/2)))
+	parent.kids = append(parent.kids, kid)
+}
+
+// formCirclePath returns a closed path approximating a circle with four
+// Bézier curves
+func formCirclePath(cx, cy, r float64) string {
+	const kappa = 0.5523
+	c := r * kappa
+	return fmt.Sprintf("%.2f %.2f m %.2f %.2f %.2f %.2f %.2f %.2f c %.2f %.2f %.2f %.2f %.2f %.2f c "+
+		"%.2f %.2f %.2f %.2f %.2f %.2f c %.2f %.2f %.2f %.2f %.2f %.2f c h",
+		cx+r, cy,
+		cx+r, cy+c, cx+c, cy+r, cx, cy+r,
+		cx-c, cy+r, cx-r, cy+c, cx-r, cy,
+		cx-r, cy-c, cx-c, cy-r, cx, cy-r,
+		cx+c, cy-r, cx+r, cy-c, cx+r, cy)
+}
+
+// ComboBox adds a drop-down list named name to the current page. options
+// lists the choices and value is the initial selection. When opts.Editable
+// is set the user may also type a value of their own.
+func (f *Bdf) ComboBox(name string, x, y, w, h float64, options []string, value string, opts FormFieldOptions) {
+	fld := &formFieldType{kind: "Ch", name: name, value: value, opts: options, flags: formFlagCombo}
+	if !f.formAdd(fld, x, y, w, h, opts) {
+		return
+	}
+	if opts.Editable {
+		fld.flags |= formFlagEdit
+	}
+	var lines []string
+	if value != "" {
+		lines = []string{value}
+	}
+	fld.normal = f.formTextAppearance(lines, w*f.k, h*f.k, fld.q, false, opts)
+}
+
+// ListBox adds a scrollable list of choices named name to the current page.
+// value is the initially selected option.
+func (f *Bdf) ListBox(name string, x, y, w, h float64, options []string, value string, opts FormFieldOptions) {
+	fld := &formFieldType{kind: "Ch", name: name, value: value, opts: options}
+	if !f.formAdd(fld, x, y, w, h, opts) {
+		return
+	}
+	wd, ht := w*f.k, h*f.k
+	size := f.fontSizePt
+	lead := size * 1.15
+	var s fmtBuffer
+	s.printf("%s/Tx BMC\nq 1 1 %.2f %.2f re W n\n", f.formBackground(wd, ht, opts), wd-2, ht-2)
+	for j, opt := range options {
+		top := ht - 1 - float64(j)*lead
+		if top-lead < 0 {
+			break
+		}
+		if opt == value {
+			s.printf("0.600 0.757 0.855 rg 1 %.2f %.2f %.2f re f\n", top-lead, wd-2, lead)
+		}
+		s.printf("BT /F%s %.2f Tf %s\n", f.currentFont.i, size, f.color.text.str)
+		s.printf("%sET\n", f.formTextLine(opt, top-lead+(lead-size)/2+size*0.22, wd, fld.q))
+	}
+	s.printf("Q\nEMC")
+	fld.normal = s.Bytes()
+}
+
+// PushButton adds a button labeled caption to the current page. The caption
+// is centered in the current font and text color. script, if not empty, is
+// JavaScript run when the button is activated.
+func (f *Bdf) PushButton(name string, x, y, w, h float64, caption, script string, opts FormFieldOptions) {
+	fld := &formFieldType{kind: "Btn", name: name, value: caption, action: script, flags: formFlagPushButton}
+	if !f.formAdd(fld, x, y, w, h, opts) {
+		return
+	}
+	wd, ht := w*f.k, h*f.k
+	size := f.fontSizePt
+	var s fmtBuffer
+	s.printf("%sq BT /F%s %.2f Tf %s\n", f.formBackground(wd, ht, opts), f.currentFont.i, size, f.color.text.str)
+	s.printf("%sET Q", f.formTextLine(caption, (ht-size)/2+size*0.22, wd, 1))
+	fld.normal = s.Bytes()
+}
+
+// SignatureField adds an unsigned signature field named name to the current
+// page. The rectangle marks where the visible signature is placed; pass zero
+// width and height for an invisible signature.
+func (f *Bdf) SignatureField(name string, x, y, w, h float64, opts FormFieldOptions) {
+	fld := &formFieldType{kind: "Sig", name: name}
+	if !f.formAdd(fld, x, y, w, h, opts) {
+		return
+	}
+	f.form.sig = true
+	fld.normal = []byte(f.formBackground(w*f.k, h*f.k, opts))
+}
+
+// formPutAppearance writes a form XObject holding the appearance stream data
+// for a widget of the given rectangle and returns its object number
+func (f *Bdf) formPutAppearance(rect [4]float64, data []byte) int {
+	f.newobj()
+	f.outf("<</Type /XObject /Subtype /Form /BBox [0 0 %.2f %.2f] /Resources 2 0 R",
+		math.Abs(rect[2]-rect[0]), math.Abs(rect[3]-rect[1]))
+	if f.compress {
+		mem := xmem.compress(data)
+		buf := mem.bytes()
+		f.outf("/Filter /FlateDecode /Length %d>>", len(buf))
+		f.putstream(buf)
+		mem.release()
+	} else {
+		f.outf("/Length %d>>", len(data))
+		f.putstream(data)
+	}
+	f.out("endobj")
+	return f.n
+}
+
+// formString returns s as a PDF text string
+func (f *Bdf) formString(s string, utf8 bool) string {
+	if utf8 {
+		for _, r := range s {
+			if r > 0x7e {
+				return f.textstring(utf8toutf16(s))
+			}
+		}
+	}
+	return f.textstring(s)
+}
+
+// formName returns s as a PDF name object
+func formName(s string) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	for j := 0; j < len(s); j++ {
+		c := s[j]
+		if c < '!' || c > '~' || strings.IndexByte("#()<>[]{}/%", c) >= 0 {
+			fmt.Fprintf(&b, "#%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// formPutWidget writes the widget annotation entries of fld
+func (f *Bdf) formPutWidget(fld *formFieldType, normal, off int) {
+	f.outf("/Type /Annot /Subtype /Widget /F 4 /Rect [%.2f %.2f %.2f %.2f]",
+		fld.rect[0], fld.rect[1], fld.rect[2], fld.rect[3])
+	if fld.da != "" {
+		f.outf("/DA %s", f.textstring(fld.da))
+	}
+	mk := fld.mk
+	if fld.flags&formFlagPushButton != 0 {
+		mk = strings.TrimSpace(mk + " /CA " + f.formString(fld.value, fld.utf8))
+	}
+	if mk != "" {
+		f.outf("/MK <<%s>>", mk)
+	}
+	if fld.onState != "" {
+		f.outf("/AP <</N <<%s %d 0 R /Off %d 0 R>>>>", formName(fld.onState), normal, off)
+		if fld.selected {
+			f.outf("/AS %s", formName(fld.onState))
+		} else {
+			f.out("/AS /Off")
+		}
+	} else {
+		f.outf("/AP <</N %d 0 R>>", normal)
+	}
+	if fld.action != "" {
+		f.outf("/A <</S /JavaScript /JS %s>>", f.textstring(fld.action))
+	}
+}
+
+// formPutFieldDict writes the field entries of fld
+func (f *Bdf) formPutFieldDict(fld *formFieldType) {
+	f.outf("/FT /%s /T %s", fld.kind, f.formString(fld.name, fld.utf8))
+	if fld.flags != 0 {
+		f.outf("/Ff %d", fld.flags)
+	}
+	if fld.tooltip != "" {
+		f.outf("/TU %s", f.formString(fld.tooltip, fld.utf8))
+	}
+	if fld.kind == "Tx" || fld.kind == "Ch" {
+		f.outf("/Q %d", fld.q)
+	}
+	if fld.maxLen > 0 {
+		f.outf("/MaxLen %d", fld.maxLen)
+	}
+	if len(fld.opts) > 0 {
+		var s fmtBuffer
+		s.printf("/Opt [")
+		for _, opt := range fld.opts {
+			s.printf("%s ", f.formString(opt, fld.utf8))
+		}
+		s.printf("]")
+		f.out(s.String())
+	}
+	switch {
+	case fld.flags&formFlagRadio != 0:
+		if fld.value != "" {
+			f.outf("/V %s /DV %s", formName(fld.value), formName(fld.value))
+		} else {
+			f.out("/V /Off /DV /Off")
+		}
+	case fld.onState != "":
+		v := "/Off"
+		if fld.selected {
+			v = formName(fld.onState)
+		}
+		f.outf("/V %s /DV %s", v, v)
+	case fld == f.sign.field:
+		f.outf("/V %d 0 R", f.sign.objNum)
+	case fld.kind == "Tx" || fld.kind == "Ch":
+		if fld.value != "" {
+			v := f.formString(fld.value, fld.utf8)
+			f.outf("/V %s /DV %s", v, v)
+		}
+	}
+}
+
+// formPutFields writes the fields and their widgets; it is called before the
+// pages so that the page /Annots arrays can refer to the widgets
+func (f *Bdf) formPutFields() {
+	for _, fld := range f.form.fields {
+		if len(fld.kids) > 0 {
+			f.formPutRadioGroup(fld)
+			continue
+		}
+		if fld == f.sign.field {
+			f.signPutDict()
+		}
+		normal := f.formPutAppearance(fld.rect, fld.normal)
+		off := 0
+		if fld.onState != "" {
+			off = f.formPutAppearance(fld.rect, fld.off)
+		}
+		f.newobj()
+		fld.objNum = f.n
+		f.out("<<")
+		f.formPutFieldDict(fld)
+		f.formPutWidget(fld, normal, off)
+		f.out(">>")
+		f.out("endobj")
+		f.form.pageWidgets[fld.page] = append(f.form.pageWidgets[fld.page], fld.objNum)
+	}
+}
+
+// formPutRadioGroup writes the field of a radio group followed by the widgets
+// of its buttons
+func (f *Bdf) formPutRadioGroup(fld *formFieldType) {
+	aps := make([][2]int, len(fld.kids))
+	for j, kid := range fld.kids {
+		aps[j][0] = f.formPutAppearance(kid.rect, kid.normal)
+		aps[j][1] = f.formPutAppearance(kid.rect, kid.off)
+	}
+	f.newobj()
+	fld.objNum = f.n
+	f.out("<<")
+	f.formPutFieldDict(fld)
+	var kids fmtBuffer
+	kids.printf("/Kids [")
+	for j := range fld.kids {
+		kids.printf("%d 0 R ", fld.objNum+1+j)
+	}
+	kids.printf("]")
+	f.out(kids.String())
+	f.out(">>")
+	f.out("endobj")
+	for j, kid := range fld.kids {
+		f.newobj()
+		kid.objNum = f.n
+		f.outf("<</Parent %d 0 R", fld.objNum)
+		f.formPutWidget(kid, aps[j][0], aps[j][1])
+		f.out(">>")
+		f.out("endobj")
+		f.form.pageWidgets[kid.page] = append(f.form.pageWidgets[kid.page], kid.objNum)
+	}
+}
+
+// formPutAnnots appends the widget references of page n to an /Annots array
+func (f *Bdf) formPutAnnots(annots *fmtBuffer, n int) {
+	for _, obj := range f.form.pageWidgets[n] {
+		annots.printf("%d 0 R ", obj)
+	}
+}
+
+// formPutCatalog writes the interactive form dictionary
+func (f *Bdf) formPutCatalog() {
+	if len(f.form.fields) == 0 {
+		return
+	}
+	var s fmtBuffer
+	s.printf("/AcroForm <</Fields [")
+	for _, fld := range f.form.fields {
+		s.printf("%d 0 R ", fld.objNum)
+	}
+	s.printf("] /DR 2 0 R")
+	for _, fld := range f.form.fields {
+		if fld.da != "" {
+			s.printf(" /DA %s", f.textstring(fld.da))
+			break
+		}
+	}
+	switch {
+	case f.sign.field != nil:
+		// SignaturesExist | AppendOnly
+		s.printf(" /SigFlags 3")
+	case f.form.sig:
+		// SignaturesExist
+		s.printf(" /SigFlags 1")
+	}
+	s.printf(">>")
+	f.out(s.String())
+}
@@ -0,0 +1,149 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFormFields(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.SetDrawColor(0, 0, 128)
+	pdf.SetFillColor(240, 240, 255)
+	opts := FormFieldOptions{Border: true, Fill: true}
+	pdf.TextField("name", 20, 20, 80, 8, "Jane Doe", FormFieldOptions{Border: true, MaxLen: 40, Required: true})
+	pdf.TextField("notes", 20, 32, 80, 24, "First line of notes that is long enough to wrap", FormFieldOptions{Multiline: true})
+	pdf.CheckBox("agree", 20, 60, 5, true, opts)
+	pdf.RadioButton("plan", "Basic", 20, 70, 5, false, opts)
+	pdf.RadioButton("plan", "Premium", 40, 70, 5, true, opts)
+	pdf.ComboBox("country", 20, 80, 50, 8, []string{"India", "Japan", "Kenya"}, "Japan", opts)
+	pdf.ListBox("size", 80, 80, 30, 20, []string{"S", "M", "L"}, "M", opts)
+	pdf.PushButton("print", 20, 105, 30, 10, "Print", "print();", opts)
+	pdf.SignatureField("approval", 20, 120, 60, 20, FormFieldOptions{Border: true})
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, w := range []string{
+		"/FT /Tx /T (name)\n/Ff 2\n/Q 0\n/MaxLen 40\n/V (Jane Doe) /DV (Jane Doe)",
+		"/FT /Tx /T (notes)\n/Ff 4096",
+		"/FT /Btn /T (agree)\n/V /Yes /DV /Yes",
+		"/AP <</N <</Yes ",
+		"/FT /Btn /T (plan)\n/Ff 49152\n/V /Premium /DV /Premium",
+		"/FT /Ch /T (country)\n/Ff 131072\n/Q 0\n/Opt [(India) (Japan) (Kenya) ]",
+		"/FT /Btn /T (print)\n/Ff 65536",
+		"/MK <</BC [0.000 0.000 0.502] /BG [0.941 0.941 1.000] /CA (Print)>>",
+		"/A <</S /JavaScript /JS (print\\(\\);)>>",
+		"/FT /Sig /T (approval)",
+		"/SigFlags 1",
+		"/Type /Annot /Subtype /Widget /F 4 ",
+	} {
+		if !strings.Contains(out, w) {
+			t.Errorf("output does not contain %q", w)
+		}
+	}
+	if strings.Count(out, "/Subtype /Widget") != 9 {
+		t.Errorf("expected 9 widgets, got %d", strings.Count(out, "/Subtype /Widget"))
+	}
+	m := regexp.MustCompile(`/AcroForm <</Fields \[((?:\d+ 0 R )+)\]`).FindStringSubmatch(out)
+	if m == nil || strings.Count(m[1], " 0 R") != 8 {
+		t.Fatalf("bad AcroForm field list %q", m)
+	}
+	annots := regexp.MustCompile(`/Annots \[([^\]]*)\]`).FindStringSubmatch(out)
+	if annots == nil || strings.Count(annots[1], " 0 R") != 9 {
+		t.Errorf("bad page annotations %q", annots)
+	}
+	if !strings.Contains(out, "(Jane Doe) Tj") {
+		t.Error("text field appearance does not show its value")
+	}
+}
+
+func TestFormFieldErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(pdf *Bdf)
+	}{
+		{"duplicate", func(pdf *Bdf) {
+			pdf.TextField("a", 10, 10, 50, 8, "", FormFieldOptions{})
+			pdf.CheckBox("a", 10, 20, 5, false, FormFieldOptions{})
+		}},
+		{"dotted name", func(pdf *Bdf) {
+			pdf.TextField("a.b", 10, 10, 50, 8, "", FormFieldOptions{})
+		}},
+		{"radio value", func(pdf *Bdf) {
+			pdf.RadioButton("g", "Off", 10, 10, 5, false, FormFieldOptions{})
+		}},
+		{"radio group clash", func(pdf *Bdf) {
+			pdf.TextField("g", 10, 10, 50, 8, "", FormFieldOptions{})
+			pdf.RadioButton("g", "One", 10, 20, 5, false, FormFieldOptions{})
+		}},
+	}
+	for _, tt := range tests {
+		pdf := New("P", "mm", "A4", "")
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "", 11)
+		tt.fn(pdf)
+		if pdf.Err() == false {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestFormFieldLinks(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.AddPage()
+	link := pdf.AddLink()
+	pdf.TextField("name", 20, 20, 80, 8, "", FormFieldOptions{Border: true})
+	pdf.SetY(40)
+	pdf.WriteLinkID(5, "Next page", link)
+	pdf.AddPage()
+	pdf.SetLink(link, 0, -1)
+	pdf.Bookmark("Second page", 0, 0)
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	kids := regexp.MustCompile(`/Kids \[(\d+) 0 R (\d+) 0 R \]`).FindStringSubmatch(out)
+	if kids == nil {
+		t.Fatal("page tree not found")
+	}
+	// The field objects precede the pages, so the link and the bookmark
+	// must refer to the object of the second page
+	dests := regexp.MustCompile(`/Dest \[(\d+) 0 R `).FindAllStringSubmatch(out, -1)
+	if len(dests) != 2 {
+		t.Fatalf("found %d destinations", len(dests))
+	}
+	for _, d := range dests {
+		if d[1] != kids[2] {
+			t.Fatalf("destination is object %s, second page is object %s", d[1], kids[2])
+		}
+	}
+}
@@ -43,7 +43,7 @@ type RGBAType struct {
 // StateType holds various commonly used drawing values for convenient
 // retrieval (StateGet()) and restore (Put) methods.
 type StateType struct {
-	clrDraw, clrText, clrFill RGBType
+	clrDraw, clrText, clrFill colorType
 	lineWd                    float64
 	fontSize                  float64
 	alpha                     float64
@@ -53,9 +53,7 @@ type StateType struct {
 
 // StateGet returns a variable that contains common state values.
 func StateGet(pdf *Bdf) (st StateType) {
-	st.clrDraw.R, st.clrDraw.G, st.clrDraw.B = pdf.GetDrawColor()
-	st.clrFill.R, st.clrFill.G, st.clrFill.B = pdf.GetFillColor()
-	st.clrText.R, st.clrText.G, st.clrText.B = pdf.GetTextColor()
+	st.clrDraw, st.clrFill, st.clrText = pdf.color.draw, pdf.color.fill, pdf.color.text
 	st.lineWd = pdf.GetLineWidth()
 	_, st.fontSize = pdf.GetFontSize()
 	st.alpha, st.blendStr = pdf.GetAlpha()
@@ -66,9 +64,9 @@ func StateGet(pdf *Bdf) (st StateType) {
 // Put sets the common state values contained in the state structure
 // specified by st.
 func (st StateType) Put(pdf *Bdf) {
-	pdf.SetDrawColor(st.clrDraw.R, st.clrDraw.G, st.clrDraw.B)
-	pdf.SetFillColor(st.clrFill.R, st.clrFill.G, st.clrFill.B)
-	pdf.SetTextColor(st.clrText.R, st.clrText.G, st.clrText.B)
+	pdf.applyDrawColor(st.clrDraw)
+	pdf.applyFillColor(st.clrFill)
+	pdf.applyTextColor(st.clrText)
 	pdf.SetLineWidth(st.lineWd)
 	pdf.SetFontUnitSize(st.fontSize)
 	pdf.SetAlpha(st.alpha, st.blendStr)
@@ -0,0 +1,1671 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// htmlDefaultCSS holds the default presentation of the supported elements
+const htmlDefaultCSS = `
+h1 { font-size: 2em; font-weight: bold; margin: 0.67em 0 }
+h2 { font-size: 1.5em; font-weight: bold; margin: 0.83em 0 }
+h3 { font-size: 1.17em; font-weight: bold; margin: 1em 0 }
+h4 { font-weight: bold; margin: 1.33em 0 }
+h5 { font-size: 0.83em; font-weight: bold; margin: 1.67em 0 }
+h6 { font-size: 0.67em; font-weight: bold; margin: 2.33em 0 }
+p, dl { margin: 1em 0 }
+ul, ol { margin: 1em 0; padding-left: 30pt }
+ul { list-style-type: disc }
+ol { list-style-type: decimal }
+ul ul, ol ul { list-style-type: circle; margin: 0 }
+ol ol, ul ol { margin: 0 }
+dd { margin-left: 30pt }
+blockquote { margin: 1em 30pt }
+pre { font-family: monospace; white-space: pre; margin: 1em 0 }
+code, kbd, samp, tt { font-family: monospace }
+b, strong, th, dt { font-weight: bold }
+i, em, cite, var, address { font-style: italic }
+u, ins { text-decoration: underline }
+s, strike, del { text-decoration: line-through }
+a { color: #000080; text-decoration: underline }
+center { text-align: center }
+th { text-align: center }
+hr { margin: 0.5em 0; border-top: 0.75pt solid gray }
+small { font-size: 0.83em }
+big { font-size: 1.17em }
+table { margin: 0.5em 0 }
+`
+
+// htmlBlockTags are the elements laid out as blocks
+var htmlBlockTags = map[string]bool{
+	"html": true, "body": true, "div": true, "p": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "ul": true, "ol": true,
+	"blockquote": true, "pre": true, "section": true, "article": true,
+	"header": true, "footer": true, "main": true, "nav": true, "aside": true,
+	"center": true, "address": true, "figure": true, "figcaption": true,
+	"form": true, "dl": true, "dt": true, "dd": true, "caption": true,
+}
+
+// htmlHiddenTags are the elements that are never rendered
+var htmlHiddenTags = map[string]bool{
+	"head": true, "script": true, "style": true, "title": true, "meta": true,
+	"link": true, "template": true, "noscript": true,
+}
+
+// HTMLType renders a subset of HTML and CSS using the cell and text methods
+// of the document. It supersedes HTMLBasicType.
+//
+// The supported elements are headings, paragraphs and other block elements,
+// ordered and unordered lists, tables, images, hyperlinks, line breaks,
+// horizontal rules and the usual inline elements such as b, i, u, span and
+// code. Styles are taken from the style attribute, from style elements and
+// from StyleSheet. Selectors may combine element names, classes and ids
+// with the descendant combinator.
+//
+// The supported properties are font, font-family, font-size, font-weight,
+// font-style, text-decoration, color, background-color, text-align,
+// vertical-align, line-height, margin, padding, border, width, height,
+// display (none, block, inline and list-item), list-style-type, white-space
+// and the page-break-before, page-break-after and page-break-inside hints
+// together with their break-* equivalents.
+//
+// Table cells are laid out with TableType and their content is rendered as
+// text in the style of the cell.
+type HTMLType struct {
+	pdf *Bdf
+	// StyleSheet holds CSS rules applied after the default styles and before
+	// the style elements of the document.
+	StyleSheet string
+	// LineHeight is the default line height as a multiple of the font size.
+	LineHeight float64
+	// LoadImage opens the image referenced by the src attribute of an img
+	// element and returns its type ("png", "jpg", "gif", "webp" or "tiff").
+	// The default supports data URIs and files below ImageDir. When an image
+	// cannot be loaded its alternate text is rendered instead.
+	LoadImage func(src string) (r io.Reader, imgType string, err error)
+	// ImageDir is the directory the default image loader reads local files
+	// from. Only relative paths that stay inside it are accepted. When it is
+	// empty, no local files are read.
+	ImageDir string
+	// Bookmarks adds an outline entry for each heading element. The entries
+	// are nested by heading level and point to the first line of the heading.
+	Bookmarks bool
+}
+
+// HTMLNew returns an instance that renders HTML into the PDF document.
+func (f *Bdf) HTMLNew() (h HTMLType) {
+	h.pdf = f
+	h.LineHeight = 1.2
+	return
+}
+
+// htmlBorder is one side of the border of a box
+type htmlBorder struct {
+	width float64
+	color RGBType
+}
+
+// htmlStyle is the computed style of an element. Lengths are in user units.
+type htmlStyle struct {
+	// inherited properties
+	family                          string
+	bold, italic, underline, strike bool
+	sizePt                          float64
+	color                           RGBType
+	align                           string
+	lineHt                          float64
+	listStyle                       string
+	pre                             bool
+	// properties that apply to the element only
+	display                             string
+	background                          *RGBType
+	margin, padding                     [4]float64 // top, right, bottom, left
+	border                              [4]htmlBorder
+	width, widthPct, height             float64
+	valign                              string
+	breakBefore, breakAfter, avoidBreak bool
+}
+
+// htmlItem is a word, line break or image of an inline formatting context
+type htmlItem struct {
+	kind    byte // 'T' text, 'B' forced line break, 'I' image
+	text    string
+	st      *htmlStyle
+	space   bool    // preceded by white space
+	w, sp   float64 // width of the item and of the preceding space
+	h       float64 // height of an image
+	img     string
+	alt     string
+	link    int
+	linkStr string
+}
+
+// htmlLine is a laid out line of inline content
+type htmlLine struct {
+	items         []htmlItem
+	w             float64
+	textHt, maxFs float64
+	ht            float64
+}
+
+// htmlMark records where the box of a block starts in the page content
+type htmlMark struct {
+	page, offset int
+	y            float64
+}
+
+// htmlRender holds the state of a single Write() call
+type htmlRender struct {
+	h            *HTMLType
+	pdf          *Bdf
+	rules        []cssRule
+	tr           func(string) string
+	baseFamily   string
+	baseUTF8     bool
+	basePt       float64
+	lineHt       float64
+	left, right  float64
+	items        []htmlItem
+	space        bool
+	block        *htmlStyle
+	margin       float64
+	fresh        bool
+	breakPending bool
+	lists        []int
+	marker       string
+	markerSt     *htmlStyle
+	markerRight  float64
+	link         int
+	linkStr      string
+	anchors      map[string]int
+	anchorSet    map[string]bool
+	outline      *outlineType
+	ranks        []int
+}
+
+// Write renders htmlStr from the current vertical position between the left
+// and right margins, breaking pages as needed. On return the current position
+// is at the left margin below the rendered content. The font family, size and
+// colors in effect when Write() is called serve as the defaults of the
+// document and are restored afterwards.
+func (h *HTMLType) Write(htmlStr string) {
+	pdf := h.pdf
+	if pdf.err != nil {
+		return
+	}
+	if pdf.currentFont.Name == "" {
+		pdf.SetErrorf("font has not been set; unable to render HTML")
+		return
+	}
+	if pdf.page == 0 {
+		pdf.SetErrorf("a page must be added before rendering HTML")
+		return
+	}
+	doc, err := html.Parse(strings.NewReader(htmlStr))
+	if err != nil {
+		pdf.SetErrorf("unable to parse HTML: %s", err)
+		return
+	}
+	state := StateGet(pdf)
+	family, style, sizePt := pdf.fontFamily, pdf.fontStyle, pdf.fontSizePt
+	if pdf.underline {
+		style += "U"
+	}
+	if pdf.strikeout {
+		style += "S"
+	}
+	defer func() {
+		pdf.SetFont(family, style, sizePt)
+		state.Put(pdf)
+	}()
+
+	r := &htmlRender{
+		h:          h,
+		pdf:        pdf,
+		baseFamily: family,
+		baseUTF8:   pdf.isCurrentUTF8,
+		basePt:     sizePt,
+		left:       pdf.lMargin,
+		right:      pdf.w - pdf.rMargin,
+		fresh:      pdf.y <= pdf.tMargin,
+		anchors:    make(map[string]int),
+		anchorSet:  make(map[string]bool),
+	}
+	r.tr = pdf.UnicodeTranslatorFromDescriptor("")
+	r.rules = cssParseSheet(nil, htmlDefaultCSS)
+	r.rules = cssParseSheet(r.rules, h.StyleSheet)
+	var sheets func(n *html.Node)
+	sheets = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "style" && n.FirstChild != nil {
+			r.rules = cssParseSheet(r.rules, n.FirstChild.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			sheets(c)
+		}
+	}
+	sheets(doc)
+	cssSortRules(r.rules)
+
+	lineHt := h.LineHeight
+	if lineHt <= 0 {
+		lineHt = 1.2
+	}
+	r.lineHt = lineHt
+	root := &htmlStyle{family: family, sizePt: sizePt, lineHt: lineHt, align: "L",
+		listStyle: "disc", display: "block"}
+	root.color.R, root.color.G, root.color.B = pdf.GetTextColor()
+	r.block = root
+	r.children(doc, root)
+	r.flush()
+	// links to anchors that do not exist point to the end of the content
+	for name, link := range r.anchors {
+		if !r.anchorSet[name] {
+			pdf.SetLink(link, pdf.y, pdf.page)
+		}
+	}
+	pdf.x = pdf.lMargin
+}
+
+// children renders the child nodes of n
+func (r *htmlRender) children(n *html.Node, st *htmlStyle) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.node(c, st)
+	}
+}
+
+// node renders n, parent being the computed style of its parent element
+func (r *htmlRender) node(n *html.Node, parent *htmlStyle) {
+	if r.pdf.err != nil {
+		return
+	}
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data, parent)
+		return
+	case html.DocumentNode:
+		r.children(n, parent)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if htmlHiddenTags[n.Data] {
+		return
+	}
+	st := r.style(n, parent)
+	if st.display == "none" {
+		return
+	}
+	for _, key := range []string{"id", "name"} {
+		if name, ok := htmlAttr(n, key); ok && name != "" && (key == "id" || n.Data == "a") {
+			r.setAnchor(name)
+		}
+	}
+	switch n.Data {
+	case "br":
+		r.items = append(r.items, htmlItem{kind: 'B', st: parent})
+		r.space = false
+		return
+	case "img":
+		r.image(n, st)
+		return
+	case "table":
+		r.table(n, st)
+		return
+	case "hr":
+		r.hr(st)
+		return
+	case "ul", "ol":
+		start := 0
+		if v, ok := htmlAttr(n, "start"); ok && n.Data == "ol" {
+			if k, err := strconv.Atoi(v); err == nil {
+				start = k - 1
+			}
+		}
+		r.lists = append(r.lists, start)
+		r.box(n, st)
+		r.lists = r.lists[:len(r.lists)-1]
+		return
+	}
+	if st.display == "block" || st.display == "list-item" {
+		r.box(n, st)
+		return
+	}
+	link, linkStr := r.link, r.linkStr
+	if n.Data == "a" {
+		if href, ok := htmlAttr(n, "href"); ok {
+			if strings.HasPrefix(href, "#") {
+				r.link, r.linkStr = r.anchor(href[1:]), ""
+			} else {
+				r.link, r.linkStr = 0, href
+			}
+		}
+	}
+	r.children(n, st)
+	r.link, r.linkStr = link, linkStr
+}
+
+// anchor returns the internal link of a named destination
+func (r *htmlRender) anchor(name string) int {
+	link, ok := r.anchors[name]
+	if !ok {
+		link = r.pdf.AddLink()
+		r.anchors[name] = link
+	}
+	return link
+}
+
+// setAnchor places a named destination at the current position
+func (r *htmlRender) setAnchor(name string) {
+	if !r.anchorSet[name] {
+		r.anchorSet[name] = true
+		r.pdf.SetLink(r.anchor(name), r.pdf.y, r.pdf.page)
+	}
+}
+
+// text adds the words of s to the inline content
+func (r *htmlRender) text(s string, st *htmlStyle) {
+	if st.pre {
+		s = strings.Replace(s, "\r", "", -1)
+		s = strings.Replace(s, "\t", "    ", -1)
+		for j, line := range strings.Split(s, "\n") {
+			if j > 0 {
+				r.items = append(r.items, htmlItem{kind: 'B', st: st})
+			}
+			if line != "" {
+				r.items = append(r.items, r.textItem(line, st, false))
+			}
+		}
+		return
+	}
+	start := -1
+	for j, c := range s {
+		if strings.ContainsRune(" \t\n\r\f", c) {
+			if start >= 0 {
+				r.items = append(r.items, r.textItem(s[start:j], st, r.space))
+				start = -1
+			}
+			r.space = true
+		} else if start < 0 {
+			start = j
+		}
+	}
+	if start >= 0 {
+		r.items = append(r.items, r.textItem(s[start:], st, r.space))
+		r.space = false
+	}
+}
+
+func (r *htmlRender) textItem(s string, st *htmlStyle, space bool) htmlItem {
+	s = strings.Replace(s, " ", " ", -1)
+	return htmlItem{kind: 'T', text: s, st: st, space: space, link: r.link, linkStr: r.linkStr}
+}
+
+// font selects the font of st, dropping bold or italic for families that were
+// not registered with these styles
+func (r *htmlRender) font(st *htmlStyle) {
+	pdf := r.pdf
+	style := ""
+	if st.bold {
+		style += "B"
+	}
+	if st.italic {
+		style += "I"
+	}
+	if !pdf.coreFonts[st.family] && st.family != "arial" {
+		for _, try := range []string{style, strings.Replace(style, "I", "", 1), ""} {
+			if _, ok := pdf.fonts[getFontKey(st.family, try)]; ok {
+				style = try
+				break
+			}
+		}
+	}
+	if st.underline {
+		style += "U"
+	}
+	if st.strike {
+		style += "S"
+	}
+	pdf.setFontIfChanged(st.family, style, st.sizePt)
+}
+
+// encode converts s for the current font
+func (r *htmlRender) encode(s string) string {
+	if r.pdf.isCurrentUTF8 {
+		return s
+	}
+	return r.tr(s)
+}
+
+// length converts a CSS length to user units
+func (r *htmlRender) length(s string, emPt, refPt float64) (float64, bool) {
+	pt, ok := cssLength(s, emPt, refPt)
+	return pt / r.pdf.k, ok
+}
+
+// family selects the first available family of a font-family list
+func (r *htmlRender) family(list, cur string) string {
+	pdf := r.pdf
+	generic := map[string]string{"serif": "times", "sans-serif": "helvetica", "monospace": "courier"}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.Trim(strings.TrimSpace(name), `"'`))
+		if core, ok := generic[name]; ok {
+			if r.baseUTF8 {
+				return r.baseFamily
+			}
+			return core
+		}
+		if pdf.coreFonts[name] || name == "arial" {
+			if r.baseUTF8 {
+				// a core font cannot show the text of a Unicode font
+				continue
+			}
+			return name
+		}
+		for _, style := range []string{"", "B", "I", "BI"} {
+			if _, ok := pdf.fonts[getFontKey(name, style)]; ok {
+				return name
+			}
+		}
+	}
+	return cur
+}
+
+// setProp records a declaration, expanding shorthand properties
+func (r *htmlRender) setProp(props map[string]string, name, value string) {
+	sides := []string{"top", "right", "bottom", "left"}
+	switch name {
+	case "margin", "padding":
+		if v, ok := cssBoxValues(value); ok {
+			for j, side := range sides {
+				props[name+"-"+side] = v[j]
+			}
+		}
+	case "border", "border-top", "border-right", "border-bottom", "border-left":
+		list := sides
+		if name != "border" {
+			list = []string{name[len("border-"):]}
+		}
+		width, color := "medium", ""
+		for _, tok := range strings.Fields(value) {
+			switch tok {
+			case "none", "hidden":
+				width = "0"
+			case "solid", "dashed", "dotted", "double", "groove", "ridge", "inset", "outset":
+			default:
+				if _, ok := cssColor(tok); ok {
+					color = tok
+				} else {
+					width = tok
+				}
+			}
+		}
+		for _, side := range list {
+			props["border-"+side+"-width"] = width
+			if color != "" {
+				props["border-"+side+"-color"] = color
+			}
+		}
+	case "border-width", "border-color":
+		if v, ok := cssBoxValues(value); ok {
+			for j, side := range sides {
+				props["border-"+side+name[len("border"):]] = v[j]
+			}
+		}
+	case "border-style":
+		if strings.Contains(value, "none") || strings.Contains(value, "hidden") {
+			for _, side := range sides {
+				props["border-"+side+"-width"] = "0"
+			}
+		}
+	case "background":
+		for _, tok := range strings.Fields(value) {
+			if _, ok := cssColor(tok); ok {
+				props["background-color"] = tok
+			}
+		}
+	case "font":
+		fields := strings.Fields(value)
+		for j, tok := range fields {
+			switch tok {
+			case "bold", "bolder", "normal", "lighter":
+				if tok != "normal" {
+					props["font-weight"] = tok
+				}
+			case "italic", "oblique":
+				props["font-style"] = tok
+			default:
+				if tok[0] >= '0' && tok[0] <= '9' || tok[0] == '.' {
+					if _, err := strconv.Atoi(tok); err == nil && len(tok) == 3 {
+						props["font-weight"] = tok
+						continue
+					}
+					size := tok
+					if pos := strings.Index(tok, "/"); pos >= 0 {
+						size = tok[:pos]
+						props["line-height"] = tok[pos+1:]
+					}
+					props["font-size"] = size
+					if rest := strings.Join(fields[j+1:], " "); rest != "" {
+						props["font-family"] = rest
+					}
+					return
+				}
+			}
+		}
+	case "list-style":
+		for _, tok := range strings.Fields(value) {
+			props["list-style-type"] = tok
+		}
+	case "text-decoration-line":
+		props["text-decoration"] = value
+	case "break-before", "break-after", "break-inside":
+		props["page-"+name] = value
+	default:
+		props[name] = value
+	}
+}
+
+// style computes the style of element n
+func (r *htmlRender) style(n *html.Node, parent *htmlStyle) *htmlStyle {
+	st := *parent
+	st.display = "inline"
+	if htmlBlockTags[n.Data] {
+		st.display = "block"
+	} else if n.Data == "li" {
+		st.display = "list-item"
+	}
+	st.background = nil
+	st.margin, st.padding, st.border = [4]float64{}, [4]float64{}, [4]htmlBorder{}
+	st.width, st.widthPct, st.height = 0, 0, 0
+	st.valign = ""
+	st.breakBefore, st.breakAfter, st.avoidBreak = false, false, false
+
+	props := make(map[string]string)
+	// presentational attributes have the lowest priority
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "align":
+			props["text-align"] = a.Val
+		case "valign":
+			props["vertical-align"] = a.Val
+		case "bgcolor":
+			props["background-color"] = a.Val
+		case "color":
+			if n.Data == "font" {
+				props["color"] = a.Val
+			}
+		case "face":
+			if n.Data == "font" {
+				props["font-family"] = a.Val
+			}
+		case "width", "height":
+			if n.Data == "img" || n.Data == "table" || n.Data == "td" || n.Data == "th" || n.Data == "col" {
+				props[a.Key] = a.Val
+			}
+		}
+	}
+	for _, rule := range r.rules {
+		if rule.matches(n) {
+			for _, d := range rule.decls {
+				r.setProp(props, d.name, d.value)
+			}
+		}
+	}
+	if attr, ok := htmlAttr(n, "style"); ok {
+		for _, d := range cssDeclarations(attr) {
+			r.setProp(props, d.name, d.value)
+		}
+	}
+	if len(props) == 0 {
+		return &st
+	}
+
+	// the font size is needed to resolve em units of the other properties
+	if v, ok := props["font-size"]; ok {
+		keywords := map[string]float64{"xx-small": 0.6, "x-small": 0.75, "small": 0.89,
+			"medium": 1, "large": 1.2, "x-large": 1.5, "xx-large": 2}
+		switch {
+		case keywords[v] > 0:
+			st.sizePt = r.basePt * keywords[v]
+		case v == "smaller":
+			st.sizePt = parent.sizePt / 1.2
+		case v == "larger":
+			st.sizePt = parent.sizePt * 1.2
+		default:
+			if pt, ok := cssLength(v, parent.sizePt, parent.sizePt); ok && pt > 0 {
+				st.sizePt = pt
+			}
+		}
+	}
+	em := st.sizePt
+	refPt := (r.right - r.left) * r.pdf.k
+	for name, v := range props {
+		switch name {
+		case "font-family":
+			st.family = r.family(v, st.family)
+		case "font-weight":
+			switch v {
+			case "bold", "bolder", "600", "700", "800", "900":
+				st.bold = true
+			case "normal", "lighter", "100", "200", "300", "400", "500":
+				st.bold = false
+			}
+		case "font-style":
+			st.italic = v == "italic" || v == "oblique"
+		case "text-decoration":
+			st.underline = strings.Contains(v, "underline")
+			st.strike = strings.Contains(v, "line-through")
+		case "color":
+			if c, ok := cssColor(v); ok {
+				st.color = c
+			}
+		case "background-color":
+			if c, ok := cssColor(v); ok {
+				st.background = &c
+			}
+		case "text-align":
+			switch strings.ToLower(v) {
+			case "center":
+				st.align = "C"
+			case "right":
+				st.align = "R"
+			case "left", "justify":
+				st.align = "L"
+			}
+		case "vertical-align":
+			switch strings.ToLower(v) {
+			case "top":
+				st.valign = "T"
+			case "middle":
+				st.valign = "M"
+			case "bottom":
+				st.valign = "B"
+			}
+		case "line-height":
+			if v == "normal" {
+				st.lineHt = r.lineHt
+			} else if f, err := strconv.ParseFloat(v, 64); err == nil {
+				st.lineHt = f
+			} else if pt, ok := cssLength(v, em, em); ok && em > 0 {
+				st.lineHt = pt / em
+			}
+		case "width":
+			if strings.HasSuffix(v, "%") {
+				st.widthPct, _ = strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+			} else if w, ok := r.length(v, em, refPt); ok {
+				st.width = w
+			}
+		case "height":
+			if h, ok := r.length(v, em, 0); ok && !strings.HasSuffix(v, "%") {
+				st.height = h
+			}
+		case "display":
+			switch v {
+			case "none", "block", "inline", "list-item":
+				st.display = v
+			case "inline-block":
+				st.display = "inline"
+			}
+		case "list-style-type":
+			st.listStyle = v
+		case "white-space":
+			st.pre = strings.HasPrefix(v, "pre")
+		case "page-break-before", "page-break-after":
+			brk := v == "always" || v == "page" || v == "left" || v == "right"
+			if name == "page-break-before" {
+				st.breakBefore = brk
+			} else {
+				st.breakAfter = brk
+			}
+		case "page-break-inside":
+			st.avoidBreak = strings.HasPrefix(v, "avoid")
+		}
+	}
+	for j, side := range []string{"top", "right", "bottom", "left"} {
+		if v, ok := props["margin-"+side]; ok {
+			st.margin[j], _ = r.length(v, em, refPt)
+		}
+		if v, ok := props["padding-"+side]; ok {
+			st.padding[j], _ = r.length(v, em, refPt)
+		}
+		if v, ok := props["border-"+side+"-width"]; ok {
+			widths := map[string]string{"thin": "0.75pt", "medium": "2.25pt", "thick": "3.75pt"}
+			if w, ok := widths[v]; ok {
+				v = w
+			}
+			st.border[j].width, _ = r.length(v, em, 0)
+			st.border[j].color = st.color
+		}
+		if v, ok := props["border-"+side+"-color"]; ok {
+			if c, ok := cssColor(v); ok {
+				st.border[j].color = c
+			}
+		}
+		if st.margin[j] < 0 {
+			st.margin[j] = 0
+		}
+	}
+	return &st
+}
+
+// collapse merges a vertical margin with the pending one
+func (r *htmlRender) collapse(m float64) {
+	if m > r.margin {
+		r.margin = m
+	}
+}
+
+// begin prepares the page for content: a pending page break is taken and the
+// pending vertical margin is applied, except at the top of a page
+func (r *htmlRender) begin() {
+	if r.breakPending {
+		r.breakPending = false
+		if !r.fresh {
+			r.addPage()
+		}
+	}
+	if !r.fresh {
+		r.pdf.y += r.margin
+	}
+	r.margin = 0
+}
+
+// addPage starts a new page
+func (r *htmlRender) addPage() {
+	pdf := r.pdf
+	pdf.AddPageFormat(pdf.curOrientation, pdf.curPageSize)
+	r.fresh = true
+	r.margin = 0
+}
+
+// fits breaks the page when ht does not fit in the space left on it
+func (r *htmlRender) fits(ht float64) {
+	pdf := r.pdf
+	if pdf.y+ht > pdf.pageBreakTrigger && !r.fresh && pdf.acceptPageBreak() {
+		r.addPage()
+	}
+}
+
+// box renders a block element and its content
+func (r *htmlRender) box(n *html.Node, st *htmlStyle) {
+	pdf := r.pdf
+	r.flush()
+	if st.breakBefore {
+		r.breakPending = true
+	}
+	r.collapse(st.margin[0])
+	deco := st.background != nil
+	for _, b := range st.border {
+		deco = deco || b.width > 0
+	}
+	closed := deco || st.padding[0] > 0
+	if closed {
+		r.begin()
+	}
+	left, right := r.left, r.right
+	boxLeft, boxRight := left+st.margin[3], right-st.margin[1]
+	width := st.width
+	if st.widthPct > 0 {
+		width = (right - left) * st.widthPct / 100
+	}
+	if width > 0 {
+		width += st.padding[1] + st.padding[3] + st.border[1].width + st.border[3].width
+		if boxLeft+width < boxRight {
+			boxRight = boxLeft + width
+		}
+	}
+	r.left = boxLeft + st.border[3].width + st.padding[3]
+	r.right = boxRight - st.border[1].width - st.padding[1]
+	var mark htmlMark
+	if deco {
+		mark = htmlMark{page: pdf.page, offset: pdf.pages[pdf.page].Len(), y: pdf.y}
+		// The pages of the box are decorated when it is closed
+		pdf.stream.hold++
+	}
+	if closed {
+		pdf.y += st.border[0].width + st.padding[0]
+		r.fresh = false
+	}
+	if st.display == "list-item" {
+		count := 0
+		if len(r.lists) > 0 {
+			r.lists[len(r.lists)-1]++
+			count = r.lists[len(r.lists)-1]
+		}
+		r.marker = htmlMarker(st.listStyle, count, r.baseUTF8)
+		r.markerSt, r.markerRight = st, r.left
+	}
+	if r.h.Bookmarks && len(n.Data) == 2 && n.Data[0] == 'h' && n.Data[1] >= '1' && n.Data[1] <= '6' {
+		r.heading(n, int(n.Data[1]-'0'))
+	}
+	block := r.block
+	r.block = st
+	r.children(n, st)
+	r.flush()
+	r.block = block
+	r.outline = nil
+	if st.display == "list-item" {
+		r.marker = ""
+	}
+	if deco || st.padding[2] > 0 {
+		if !r.fresh {
+			pdf.y += r.margin
+		}
+		r.margin = 0
+		pdf.y += st.padding[2] + st.border[2].width
+		if st.height > 0 && mark.page == pdf.page && pdf.y < mark.y+st.height {
+			pdf.y = mark.y + st.height
+		}
+	}
+	if deco {
+		pdf.stream.hold--
+		r.decorate(mark, st, boxLeft, boxRight)
+	}
+	r.left, r.right = left, right
+	r.collapse(st.margin[2])
+	if st.breakAfter {
+		r.breakPending = true
+	}
+}
+
+// heading prepares the outline entry of a heading of the specified rank. It
+// is added to the document when the first line of the heading is placed.
+func (r *htmlRender) heading(n *html.Node, rank int) {
+	for len(r.ranks) > 0 && r.ranks[len(r.ranks)-1] >= rank {
+		r.ranks = r.ranks[:len(r.ranks)-1]
+	}
+	level := len(r.ranks)
+	r.ranks = append(r.ranks, rank)
+	txt := strings.Join(strings.Fields(r.cellText(n)), " ")
+	if r.baseUTF8 {
+		txt = utf8toutf16(txt)
+	} else {
+		txt = r.tr(txt)
+	}
+	r.outline = &outlineType{text: txt, level: level, prev: -1, last: -1, next: -1, first: -1}
+}
+
+// decorate inserts the background and borders of a box into the content of
+// each page the box extends over, ahead of the content of the box
+func (r *htmlRender) decorate(mark htmlMark, st *htmlStyle, x0, x1 float64) {
+	pdf := r.pdf
+	endY := pdf.y
+	k, pageHt := pdf.k, pdf.h
+	for p := mark.page; p <= pdf.page; p++ {
+		y0, y1, offset := pdf.tMargin, pdf.pageBreakTrigger, 0
+		if p == mark.page {
+			y0, offset = mark.y, mark.offset
+		}
+		if p == pdf.page {
+			y1 = endY
+		}
+		if y1 <= y0 {
+			continue
+		}
+		var ops bytes.Buffer
+		ops.WriteString("q\n")
+		if bg := st.background; bg != nil {
+			fmt.Fprintf(&ops, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n",
+				float64(bg.R)/255, float64(bg.G)/255, float64(bg.B)/255,
+				x0*k, (pageHt-y0)*k, (x1-x0)*k, (y0-y1)*k)
+		}
+		for j, b := range st.border {
+			if b.width <= 0 || (j == 0 && p != mark.page) || (j == 2 && p != pdf.page) {
+				continue
+			}
+			// the border is drawn inside the box
+			half := b.width / 2
+			lines := [4][4]float64{
+				{x0, y0 + half, x1, y0 + half},
+				{x1 - half, y0, x1 - half, y1},
+				{x0, y1 - half, x1, y1 - half},
+				{x0 + half, y0, x0 + half, y1},
+			}
+			l := lines[j]
+			fmt.Fprintf(&ops, "%.2f w %.3f %.3f %.3f RG %.2f %.2f m %.2f %.2f l S\n", b.width*k,
+				float64(b.color.R)/255, float64(b.color.G)/255, float64(b.color.B)/255,
+				l[0]*k, (pageHt-l[1])*k, l[2]*k, (pageHt-l[3])*k)
+		}
+		ops.WriteString("Q")
+		content := pdf.structMarkArtifact(ops.String()) + "\n"
+		page := pdf.pages[p].Bytes()
+		var buf bytes.Buffer
+		buf.Grow(len(page) + len(content))
+		buf.Write(page[:offset])
+		buf.WriteString(content)
+		buf.Write(page[offset:])
+		pdf.pages[p] = &buf
+	}
+}
+
+// htmlMarker returns the marker of item n of a list
+func htmlMarker(style string, n int, utf8 bool) string {
+	switch style {
+	case "none":
+		return ""
+	case "circle":
+		if utf8 {
+			return "◦"
+		}
+		return "o"
+	case "square":
+		if utf8 {
+			return "▪"
+		}
+		return "•"
+	case "decimal":
+		return strconv.Itoa(n) + "."
+	case "lower-alpha", "lower-latin":
+		return htmlAlpha(n) + "."
+	case "upper-alpha", "upper-latin":
+		return strings.ToUpper(htmlAlpha(n)) + "."
+	case "lower-roman":
+		return strings.ToLower(htmlRoman(n)) + "."
+	case "upper-roman":
+		return htmlRoman(n) + "."
+	}
+	return "•"
+}
+
+func htmlAlpha(n int) (s string) {
+	for n > 0 {
+		n--
+		s = string(rune('a'+n%26)) + s
+		n /= 26
+	}
+	return
+}
+
+func htmlRoman(n int) (s string) {
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+	for j, v := range values {
+		for n >= v {
+			s += symbols[j]
+			n -= v
+		}
+	}
+	return
+}
+
+// layout breaks the inline content into lines of at most avail width
+func (r *htmlRender) layout(items []htmlItem, avail float64) (lines []htmlLine) {
+	pdf := r.pdf
+	var line htmlLine
+	finish := func(st *htmlStyle) {
+		if len(line.items) == 0 {
+			// an empty line has the height of its font
+			fs := st.sizePt / pdf.k
+			line.maxFs, line.textHt = fs, fs*st.lineHt
+		}
+		line.ht = math.Max(line.ht, line.textHt)
+		lines = append(lines, line)
+		line = htmlLine{}
+	}
+	add := func(it htmlItem) {
+		if it.kind == 'T' {
+			fs := it.st.sizePt / pdf.k
+			line.maxFs = math.Max(line.maxFs, fs)
+			line.textHt = math.Max(line.textHt, fs*it.st.lineHt)
+		} else {
+			line.ht = math.Max(line.ht, it.h)
+		}
+		if len(line.items) == 0 {
+			it.sp = 0
+		}
+		line.w += it.sp + it.w
+		line.items = append(line.items, it)
+	}
+	for _, it := range items {
+		switch it.kind {
+		case 'B':
+			finish(it.st)
+			continue
+		case 'T':
+			r.font(it.st)
+			it.text = r.encode(it.text)
+			it.w = pdf.GetStringWidth(it.text)
+			if it.space {
+				it.sp = pdf.GetStringWidth(" ")
+			}
+		case 'I':
+			if it.space {
+				r.font(it.st)
+				it.sp = pdf.GetStringWidth(" ")
+			}
+		}
+		if len(line.items) > 0 && line.w+it.sp+it.w > avail && !it.st.pre {
+			finish(it.st)
+		}
+		if it.kind == 'T' && it.w > avail && !it.st.pre {
+			// a word longer than the line is broken at any character; text
+			// for single byte fonts is already encoded
+			var units []string
+			if pdf.isCurrentUTF8 {
+				for _, c := range it.text {
+					units = append(units, string(c))
+				}
+			} else {
+				for j := 0; j < len(it.text); j++ {
+					units = append(units, it.text[j:j+1])
+				}
+			}
+			for len(units) > 0 {
+				j := 1
+				for j < len(units) && pdf.GetStringWidth(strings.Join(units[:j+1], "")) <= avail {
+					j++
+				}
+				part := it
+				part.text = strings.Join(units[:j], "")
+				part.w = pdf.GetStringWidth(part.text)
+				units = units[j:]
+				add(part)
+				if len(units) > 0 {
+					finish(it.st)
+				}
+				it.sp = 0
+			}
+			continue
+		}
+		add(it)
+	}
+	if len(line.items) > 0 {
+		finish(line.items[0].st)
+	}
+	return
+}
+
+// flush lays out and draws the pending inline content
+func (r *htmlRender) flush() {
+	items := r.items
+	r.items = nil
+	r.space = false
+	if len(items) == 0 {
+		return
+	}
+	pdf := r.pdf
+	r.begin()
+	lines := r.layout(items, r.right-r.left)
+	if r.block.avoidBreak {
+		var total float64
+		for _, line := range lines {
+			total += line.ht
+		}
+		if total <= pdf.pageBreakTrigger-pdf.tMargin {
+			r.fits(total)
+		}
+	}
+	accept := pdf.acceptPageBreak
+	for _, line := range lines {
+		pdf.acceptPageBreak = accept
+		r.fits(line.ht)
+		pdf.acceptPageBreak = func() bool { return false }
+		if r.outline != nil {
+			r.outline.y, r.outline.p = pdf.y, pdf.page
+			pdf.outlines = append(pdf.outlines, *r.outline)
+			r.outline = nil
+		}
+		r.drawLine(line)
+		r.fresh = false
+	}
+	pdf.acceptPageBreak = accept
+}
+
+// drawLine draws a line of inline content at the current vertical position
+func (r *htmlRender) drawLine(line htmlLine) {
+	pdf := r.pdf
+	y := pdf.y
+	x := r.left
+	switch r.block.align {
+	case "C":
+		x += (r.right - r.left - line.w) / 2
+	case "R":
+		x += r.right - r.left - line.w
+	}
+	band := y + line.ht - line.textHt
+	if r.marker != "" {
+		st := r.markerSt
+		r.font(st)
+		pdf.SetTextColor(st.color.R, st.color.G, st.color.B)
+		marker := r.encode(r.marker)
+		w := pdf.GetStringWidth(marker)
+		fs := st.sizePt / pdf.k
+		d := 0.3 * (math.Max(line.maxFs, fs) - fs)
+		pdf.SetXY(r.markerRight-w-fs/2, band+2*d)
+		pdf.CellFormat(w, line.textHt-2*d, marker, "", 0, "L", false, 0, "")
+		r.marker = ""
+	}
+	for j := 0; j < len(line.items); {
+		it := line.items[j]
+		x += it.sp
+		if it.kind == 'I' {
+			pdf.ImageOptions(it.img, x, y+line.ht-it.h, it.w, it.h, false,
+				ImageOptions{AltText: it.alt}, it.link, it.linkStr)
+			x += it.w
+			j++
+			continue
+		}
+		// consecutive words of the same style are written together
+		text, w := it.text, it.w
+		k := j + 1
+		for ; k < len(line.items); k++ {
+			next := line.items[k]
+			if next.kind != 'T' || next.st != it.st || next.link != it.link || next.linkStr != it.linkStr {
+				break
+			}
+			if next.sp > 0 {
+				text += " "
+			}
+			text += next.text
+			w += next.sp + next.w
+		}
+		st := it.st
+		r.font(st)
+		pdf.SetTextColor(st.color.R, st.color.G, st.color.B)
+		fill := st.background != nil && st.display == "inline"
+		if fill {
+			pdf.SetFillColor(st.background.R, st.background.G, st.background.B)
+		}
+		fs := st.sizePt / pdf.k
+		d := 0.3 * (line.maxFs - fs)
+		pdf.SetXY(x, band+2*d)
+		pdf.CellFormat(w, line.textHt-2*d, text, "", 0, "L", fill, it.link, it.linkStr)
+		x += w
+		j = k
+	}
+	pdf.SetXY(r.left, y+line.ht)
+}
+
+// hr draws a horizontal rule
+func (r *htmlRender) hr(st *htmlStyle) {
+	pdf := r.pdf
+	r.flush()
+	r.collapse(st.margin[0])
+	r.begin()
+	b := st.border[0]
+	if b.width <= 0 {
+		b = htmlBorder{width: 0.75 / pdf.k, color: RGBType{128, 128, 128}}
+	}
+	left, right := r.left+st.margin[3], r.right-st.margin[1]
+	if st.width > 0 && left+st.width < right {
+		right = left + st.width
+	}
+	lineWd := pdf.GetLineWidth()
+	drawColor := pdf.color.draw
+	pdf.BeginArtifact()
+	pdf.SetLineWidth(b.width)
+	pdf.SetDrawColor(b.color.R, b.color.G, b.color.B)
+	y := pdf.y + b.width/2
+	pdf.Line(left, y, right, y)
+	pdf.EndArtifact()
+	pdf.SetLineWidth(lineWd)
+	pdf.applyDrawColor(drawColor)
+	pdf.y += b.width
+	r.fresh = false
+	r.collapse(st.margin[2])
+}
+
+// htmlLoadImage is the default image loader. It supports data URIs and
+// relative paths of files below dir.
+func htmlLoadImage(dir, src string) (io.Reader, string, error) {
+	if strings.HasPrefix(src, "data:") {
+		pos := strings.Index(src, ",")
+		if pos < 0 {
+			return nil, "", fmt.Errorf("invalid data URI")
+		}
+		meta, data := src[5:pos], src[pos+1:]
+		tp := strings.TrimPrefix(strings.Split(meta, ";")[0], "image/")
+		if strings.HasSuffix(meta, ";base64") {
+			b, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				return nil, "", err
+			}
+			return bytes.NewReader(b), tp, nil
+		}
+		s, err := url.PathUnescape(data)
+		if err != nil {
+			return nil, "", err
+		}
+		return strings.NewReader(s), tp, nil
+	}
+	if strings.Contains(src, "://") {
+		return nil, "", fmt.Errorf("remote image %s is not supported", src)
+	}
+	if dir == "" {
+		return nil, "", fmt.Errorf("local image %s is not allowed without an image directory", src)
+	}
+	name := filepath.Clean(filepath.FromSlash(src))
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" || name == ".." ||
+		strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return nil, "", fmt.Errorf("image %s is outside the image directory", src)
+	}
+	fl, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return nil, "", err
+	}
+	return fl, strings.TrimPrefix(strings.ToLower(filepath.Ext(src)), "."), nil
+}
+
+// image adds an img element to the inline content
+func (r *htmlRender) image(n *html.Node, st *htmlStyle) {
+	pdf := r.pdf
+	src, _ := htmlAttr(n, "src")
+	alt, _ := htmlAttr(n, "alt")
+	name := fmt.Sprintf("html:%x", sha1.Sum([]byte(src)))
+	info, ok := pdf.images[name]
+	if !ok {
+		load := r.h.LoadImage
+		if load == nil {
+			load = func(src string) (io.Reader, string, error) {
+				return htmlLoadImage(r.h.ImageDir, src)
+			}
+		}
+		rd, tp, err := load(src)
+		if err == nil {
+			switch tp {
+			case "png", "jpg", "jpeg", "gif", "webp", "tif", "tiff":
+			default:
+				err = fmt.Errorf("unsupported image type %s", tp)
+			}
+		}
+		if err != nil {
+			if alt != "" {
+				r.text(alt, st)
+			}
+			return
+		}
+		if cl, ok := rd.(io.Closer); ok {
+			defer cl.Close()
+		}
+		info = pdf.RegisterImageOptionsReader(name, ImageOptions{ImageType: tp}, rd)
+		if pdf.err != nil {
+			return
+		}
+	}
+	avail := r.right - r.left
+	w, h := st.width, st.height
+	if st.widthPct > 0 {
+		w = avail * st.widthPct / 100
+	}
+	iw, ih := info.Extent()
+	switch {
+	case w == 0 && h == 0:
+		w, h = iw, ih
+	case w == 0:
+		w = h * iw / ih
+	case h == 0:
+		h = w * ih / iw
+	}
+	if w > avail {
+		w, h = avail, h*avail/w
+	}
+	r.items = append(r.items, htmlItem{kind: 'I', st: st, space: r.space, w: w, h: h,
+		img: name, alt: alt, link: r.link, linkStr: r.linkStr})
+	r.space = false
+}
+
+// cellText returns the text of a table cell. Line breaks and block elements
+// start new lines.
+func (r *htmlRender) cellText(n *html.Node) string {
+	var b strings.Builder
+	space := false
+	var walk func(n *html.Node)
+	newline := func() {
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+		space = false
+	}
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			for _, c := range n.Data {
+				if strings.ContainsRune(" \t\n\r\f", c) {
+					space = true
+					continue
+				}
+				if space && b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+					b.WriteByte(' ')
+				}
+				space = false
+				if c == ' ' {
+					c = ' '
+				}
+				b.WriteRune(c)
+			}
+			return
+		case html.ElementNode:
+			if htmlHiddenTags[n.Data] {
+				return
+			}
+			switch n.Data {
+			case "br":
+				b.WriteString("\n")
+				space = false
+				return
+			case "img":
+				if alt, ok := htmlAttr(n, "alt"); ok {
+					b.WriteString(alt)
+				}
+				return
+			}
+		}
+		block := n.Type == html.ElementNode && (htmlBlockTags[n.Data] || n.Data == "li" || n.Data == "tr")
+		if block {
+			newline()
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if block {
+			newline()
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// table renders a table element with TableType
+func (r *htmlRender) table(n *html.Node, st *htmlStyle) {
+	pdf := r.pdf
+	r.flush()
+	r.collapse(st.margin[0])
+	type htmlRow struct {
+		node *html.Node
+		st   *htmlStyle
+	}
+	var rows []htmlRow
+	var colWidths []*htmlStyle
+	header := 0
+	explicitHeader := false
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.Data {
+		case "caption":
+			r.box(c, r.style(c, st))
+		case "colgroup", "col":
+			cols := []*html.Node{c}
+			if c.Data == "colgroup" {
+				cols = nil
+				for col := c.FirstChild; col != nil; col = col.NextSibling {
+					if col.Type == html.ElementNode && col.Data == "col" {
+						cols = append(cols, col)
+					}
+				}
+			}
+			for _, col := range cols {
+				colWidths = append(colWidths, r.style(col, st))
+			}
+		case "thead", "tbody", "tfoot":
+			sec := r.style(c, st)
+			for tr := c.FirstChild; tr != nil; tr = tr.NextSibling {
+				if tr.Type == html.ElementNode && tr.Data == "tr" {
+					rows = append(rows, htmlRow{tr, r.style(tr, sec)})
+					if c.Data == "thead" {
+						header++
+						explicitHeader = true
+					}
+				}
+			}
+		case "tr":
+			rows = append(rows, htmlRow{c, r.style(c, st)})
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+	if !explicitHeader {
+		// leading rows made of th cells form the header
+		for _, row := range rows {
+			all := false
+			for c := row.node.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.ElementNode {
+					if c.Data != "th" {
+						all = false
+						break
+					}
+					all = true
+				}
+			}
+			if !all {
+				break
+			}
+			header++
+		}
+	}
+	if header == len(rows) {
+		header = 0
+	}
+
+	border := ""
+	if v, ok := htmlAttr(n, "border"); ok && v != "0" {
+		border = "1"
+	}
+	padding := 0.0
+	if v, ok := htmlAttr(n, "cellpadding"); ok {
+		padding, _ = r.length(v, st.sizePt, 0)
+	}
+	width := r.right - r.left - st.margin[1] - st.margin[3]
+	if st.widthPct > 0 {
+		width = width * st.widthPct / 100
+	} else if st.width > 0 && st.width < width {
+		width = st.width
+	}
+
+	var cells [][]TableCellType
+	var firstWidths []*htmlStyle
+	ncol := 0
+	pending := map[int]int{} // rows still covered by a row span, per column
+	for ri, row := range rows {
+		var list []TableCellType
+		col := 0
+		for c := row.node.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || (c.Data != "td" && c.Data != "th") {
+				continue
+			}
+			for pending[col] > 0 {
+				col++
+			}
+			cst := r.style(c, row.st)
+			// a cell holding a single styled element takes its style
+			inner, ist := c, cst
+			for {
+				var only *html.Node
+				count := 0
+				for k := inner.FirstChild; k != nil; k = k.NextSibling {
+					if k.Type == html.TextNode && strings.TrimSpace(k.Data) == "" {
+						continue
+					}
+					count++
+					only = k
+				}
+				if count != 1 || only.Type != html.ElementNode || only.Data == "br" || only.Data == "img" {
+					break
+				}
+				inner, ist = only, r.style(only, ist)
+			}
+			span := func(key string) int {
+				v, _ := htmlAttr(c, key)
+				k, err := strconv.Atoi(v)
+				if err != nil || k < 1 {
+					return 1
+				}
+				return k
+			}
+			colSpan, rowSpan := span("colspan"), span("rowspan")
+			if ri == 0 && colSpan == 1 {
+				firstWidths = append(firstWidths, cst)
+			} else if ri == 0 {
+				for k := 0; k < colSpan; k++ {
+					firstWidths = append(firstWidths, &htmlStyle{})
+				}
+			}
+			ts := r.tableStyle(ist, cst, row.st, border, padding)
+			text := r.cellText(c)
+			list = append(list, TableCellType{Text: text, ColSpan: colSpan, RowSpan: rowSpan, Style: ts})
+			for k := col; k < col+colSpan; k++ {
+				if rowSpan > 1 {
+					pending[k] = rowSpan
+				}
+			}
+			col += colSpan
+		}
+		for k := range pending {
+			if k >= col && pending[k] > 0 {
+				col = k + 1
+			}
+		}
+		if col > ncol {
+			ncol = col
+		}
+		for k := range pending {
+			if pending[k] > 0 {
+				pending[k]--
+			}
+		}
+		cells = append(cells, list)
+	}
+	if ncol == 0 {
+		return
+	}
+	if len(colWidths) == 0 {
+		colWidths = firstWidths
+	}
+	cols := make([]TableColumnType, ncol)
+	var fixed float64
+	for j := range cols {
+		if j < len(colWidths) {
+			if colWidths[j].widthPct > 0 {
+				cols[j].Percent = colWidths[j].widthPct
+			} else if colWidths[j].width > 0 {
+				cols[j].Width = colWidths[j].width
+			}
+		}
+		fixed += cols[j].Width + width*cols[j].Percent/100
+	}
+	if fixed > width {
+		// the widths are hints, scale them to the table
+		for j := range cols {
+			cols[j].Width *= width / fixed
+			cols[j].Percent *= width / fixed
+		}
+	}
+	tbl := NewTable(cols...)
+	tbl.Width = width
+	tbl.HeaderRows = header
+	for _, list := range cells {
+		tbl.AddRow(list...)
+	}
+	// the encoding of the text depends on the font of the table
+	r.font(st)
+	if !pdf.isCurrentUTF8 {
+		for _, list := range tbl.rows {
+			for j := range list {
+				list[j].Text = r.tr(list[j].Text)
+			}
+		}
+	}
+	r.begin()
+	pdf.SetXY(r.left+st.margin[3], pdf.y)
+	tbl.Draw(pdf)
+	r.fresh = false
+	r.collapse(st.margin[2])
+	if st.breakAfter {
+		r.breakPending = true
+	}
+}
+
+// tableStyle converts the computed style of a cell to a table style. ist is
+// the style of the content, cst that of the cell and rst that of the row.
+func (r *htmlRender) tableStyle(ist, cst, rst *htmlStyle, border string, padding float64) *TableStyleType {
+	ts := &TableStyleType{
+		TextColor: ist.color,
+		FontSize:  ist.sizePt,
+		Align:     ist.align,
+		VAlign:    cst.valign,
+		Padding:   padding,
+	}
+	if ts.VAlign == "" {
+		ts.VAlign = rst.valign
+	}
+	if ts.VAlign == "" {
+		ts.VAlign = "M"
+	}
+	if ist.bold {
+		ts.FontStyle += "B"
+	}
+	if ist.italic {
+		ts.FontStyle += "I"
+	}
+	if ist.underline {
+		ts.FontStyle += "U"
+	}
+	if ist.strike {
+		ts.FontStyle += "S"
+	}
+	for _, bg := range []*RGBType{ist.background, cst.background, rst.background} {
+		if bg != nil {
+			ts.Fill = bg
+			break
+		}
+	}
+	for _, p := range cst.padding {
+		if p > ts.Padding {
+			ts.Padding = p
+		}
+	}
+	sides := ""
+	for j, b := range cst.border {
+		if b.width > 0 {
+			sides += "TRBL"[j : j+1]
+			if b.width > ts.LineWidth {
+				ts.LineWidth, ts.BorderColor = b.width, b.color
+			}
+		}
+	}
+	switch {
+	case len(sides) == 4:
+		ts.Border = "1"
+	case sides != "":
+		ts.Border = sides
+	default:
+		ts.Border = border
+	}
+	return ts
+}
@@ -96,7 +96,8 @@ func HTMLBasicTokenize(htmlStr string) (list []HTMLBasicSegmentType) {
 // only hyperlinks and bold, italic and underscore attributes. In the Link
 // structure, the ClrR, ClrG and ClrB fields (0 through 255) define the color
 // of hyperlinks. The Bold, Italic and Underscore values define the hyperlink
-// style.
+// style. See HTMLNew() for a renderer that supports a much larger subset of
+// HTML and CSS.
 type HTMLBasicType struct {
 	pdf  *Bdf
 	Link struct {
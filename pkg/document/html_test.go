@@ -0,0 +1,300 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCSSValues(t *testing.T) {
+	colors := map[string]RGBType{
+		"#f00":             {255, 0, 0},
+		"#102030":          {16, 32, 48},
+		"rgb(1, 2, 3)":     {1, 2, 3},
+		"rgb(100%,0%,50%)": {255, 0, 128},
+		"Navy":             {0, 0, 128},
+	}
+	for s, want := range colors {
+		if got, ok := cssColor(s); !ok || got != want {
+			t.Errorf("cssColor(%q) = %v, %v; want %v", s, got, ok, want)
+		}
+	}
+	for _, s := range []string{"transparent", "#12", "rgb(1,2)", "rgb(1,2,3"} {
+		if _, ok := cssColor(s); ok {
+			t.Errorf("cssColor(%q) should fail", s)
+		}
+	}
+	lengths := map[string]float64{"12pt": 12, "16px": 12, "2em": 20, "50%": 100, "1in": 72, "8": 6}
+	for s, want := range lengths {
+		if got, ok := cssLength(s, 10, 200); !ok || got != want {
+			t.Errorf("cssLength(%q) = %v, %v; want %v", s, got, ok, want)
+		}
+	}
+	if v, ok := cssBoxValues("1px 2px 3px"); !ok || v != [4]string{"1px", "2px", "3px", "2px"} {
+		t.Errorf("unexpected box values %v", v)
+	}
+}
+
+func TestCSSSelectors(t *testing.T) {
+	rules := cssParseSheet(nil, `
+		/* comment */ p { color: red }
+		@media print { p { color: green } }
+		.note, a:hover { color: blue !important }
+		div p.note { color: gray }
+		#total { color: black }`)
+	cssSortRules(rules)
+	if len(rules) != 4 {
+		t.Fatalf("expected 4 rules, got %d", len(rules))
+	}
+	var specs []int
+	for _, r := range rules {
+		specs = append(specs, r.spec)
+	}
+	if want := []int{1, 10, 12, 100}; !equalInts(specs, want) {
+		t.Fatalf("rules are not ordered by specificity: %v", specs)
+	}
+	if rules[1].decls[0].value != "blue" {
+		t.Fatalf("!important was not removed: %q", rules[1].decls[0].value)
+	}
+	doc, err := html.Parse(strings.NewReader(`<div><span><p class="x note" id="total">t</p></span></div><p class="note">u</p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ps []*html.Node
+	var find func(n *html.Node)
+	find = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "p" {
+			ps = append(ps, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	want := [][]bool{{true, true, true, true}, {true, true, false, false}}
+	for j, p := range ps {
+		for k, r := range rules {
+			if r.matches(p) != want[j][k] {
+				t.Errorf("paragraph %d, rule %d: expected match %v", j, k, want[j][k])
+			}
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for j := range a {
+		if a[j] != b[j] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHTMLWrite(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.SetTextColor(10, 20, 30)
+	h := pdf.HTMLNew()
+	h.StyleSheet = ".total { font-weight: bold; background-color: #eeeeee }"
+	logo := "data:image/png;base64," + base64.StdEncoding.EncodeToString(testPNG(t))
+	h.Write(`<html><head><style>
+		h1 { color: #336699; text-align: center }
+		p.small { font-size: 8pt }
+		.box { border: 1px solid #ff0000; padding: 2mm; background: #fafafa }
+	</style></head><body>
+	<p><img src="` + logo + `" width="32" alt="Logo"> Receipt for <span style="color: red">Priya</span></p>
+	<h1>Receipt</h1>
+	<p class="small">Thank you for your order. Visit <a href="https://example.com/">our shop</a>
+	or read the <a href="#terms">terms</a>.</p>
+	<ul><li>First item</li><li>Second item</li></ul>
+	<ol start="3"><li>Third</li></ol>
+	<div class="box">Boxed text</div>
+	<table border="1" style="width: 100%">
+	<thead><tr><th width="70%">Item</th><th>Price</th></tr></thead>
+	<tr><td>Tea &amp; biscuits</td><td align="right">120.00</td></tr>
+	<tr class="total"><td>Total</td><td align="right">120.00</td></tr>
+	</table>
+	<hr>
+	<p id="terms" style="page-break-before: always">Terms and conditions</p>
+	<pre>  indented
+line</pre>
+	</body></html>`)
+	if pdf.Err() {
+		t.Fatal(pdf.Error())
+	}
+	if pdf.PageNo() != 2 {
+		t.Fatalf("expected 2 pages, got %d", pdf.PageNo())
+	}
+	if r, g, b := pdf.GetTextColor(); r != 10 || g != 20 || b != 30 {
+		t.Fatalf("text color was not restored")
+	}
+	if _, size := pdf.GetFontSize(); size != 11/pdf.k {
+		t.Fatalf("font size was not restored")
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{
+		"(Receipt for)", "(Priya)", "(Receipt)", "(our shop)", "(\x95)", "(3.)",
+		"(Boxed text)", "(Tea & biscuits)", "(Total)", "(Terms and conditions)",
+		"(  indented)", "/URI (https://example.com/)", "/Subtype /Image",
+		"1.000 0.000 0.000 rg", "1.000 0.000 0.000 RG", "0.933 g", "/Dest [",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%q not found in output", s)
+		}
+	}
+	// the centered heading starts to the right of the left margin
+	m := regexp.MustCompile(`BT ([0-9.]+) [0-9.]+ Td \(Receipt\)Tj`).FindStringSubmatch(out)
+	if m == nil || len(m[1]) < 3 {
+		t.Errorf("heading is not centered: %v", m)
+	}
+}
+
+func TestHTMLWrap(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 10)
+	h := pdf.HTMLNew()
+	y := pdf.GetY()
+	h.Write("<p style='margin: 0'>" + strings.Repeat("word ", 20) + "</p>")
+	one := pdf.GetY() - y
+	y = pdf.GetY()
+	h.Write("<p style='margin: 0'>" + strings.Repeat("word ", 200) + "</p>")
+	many := pdf.GetY() - y
+	if one <= 0 || many < 5*one {
+		t.Fatalf("unexpected heights %.2f and %.2f", one, many)
+	}
+	y = pdf.GetY()
+	h.Write("<p style='margin: 0'>" + strings.Repeat("x", 500) + "</p>")
+	if pdf.GetY()-y < 2*one {
+		t.Fatal("long word was not broken")
+	}
+	h.Write("<div>" + strings.Repeat("<p>paragraph</p>", 100) + "</div>")
+	if pdf.Err() {
+		t.Fatal(pdf.Error())
+	}
+	if pdf.PageNo() < 2 {
+		t.Fatal("expected automatic page break")
+	}
+}
+
+func TestHTMLBookmarks(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 11)
+	h := pdf.HTMLNew()
+	h.Bookmarks = true
+	h.Write(`<h1>Guide</h1><h3>Setup &amp; use</h3><p>text</p>
+	<h2 style="page-break-before: always">Reference</h2><h1>Index</h1><h4></h4>`)
+	if pdf.Err() {
+		t.Fatal(pdf.Error())
+	}
+	want := []struct {
+		text        string
+		level, page int
+	}{{"Guide", 0, 1}, {"Setup & use", 1, 1}, {"Reference", 1, 2}, {"Index", 0, 2}}
+	if len(pdf.outlines) != len(want) {
+		t.Fatalf("%d outline entries", len(pdf.outlines))
+	}
+	for j, w := range want {
+		o := pdf.outlines[j]
+		if o.text != w.text || o.level != w.level || o.p != w.page {
+			t.Errorf("entry %d is %q level %d page %d", j, o.text, o.level, o.p)
+		}
+	}
+	if pdf.outlines[2].y != pdf.tMargin {
+		t.Errorf("heading moved to a new page points to %.2f", pdf.outlines[2].y)
+	}
+}
+
+func TestHTMLLoadImage(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "doc")
+	if err := os.MkdirAll(filepath.Join(dir, "img"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{filepath.Join(dir, "img", "a.png"), filepath.Join(root, "secret.png")} {
+		if err := os.WriteFile(name, testPNG(t), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		dir, src string
+		ok       bool
+	}{
+		{dir, "img/a.png", true},
+		{dir, "img/../img/a.png", true},
+		{"", "img/a.png", false},
+		{"", filepath.Join(dir, "img", "a.png"), false},
+		{dir, filepath.Join(dir, "img", "a.png"), false},
+		{dir, "../secret.png", false},
+		{dir, "img/../../secret.png", false},
+		{dir, "..", false},
+		{dir, "file:///etc/passwd", false},
+	} {
+		rd, tp, err := htmlLoadImage(tc.dir, tc.src)
+		if (err == nil) != tc.ok {
+			t.Errorf("%q in %q: unexpected error %v", tc.src, tc.dir, err)
+		}
+		if c, ok := rd.(*os.File); ok {
+			c.Close()
+			if tp != "png" {
+				t.Errorf("%q: type %q", tc.src, tp)
+			}
+		}
+	}
+
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 11)
+	h := pdf.HTMLNew()
+	h.Write(`<p><img src="` + filepath.Join(root, "secret.png") + `" alt="Hidden"></p>`)
+	h.ImageDir = dir
+	h.Write(`<p><img src="img/a.png" alt="Shown"></p>`)
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "(Hidden)") || strings.Contains(out, "(Shown)") {
+		t.Fatal("image directory not applied")
+	}
+	if !strings.Contains(out, "/Subtype /Image") {
+		t.Fatal("image not loaded from the image directory")
+	}
+}
@@ -0,0 +1,158 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// iccTagType describes one entry of the tag table of an ICC profile
+type iccTagType struct {
+	sig  string
+	data []byte
+}
+
+var srgbICC struct {
+	once sync.Once
+	data []byte
+}
+
+// srgbProfile returns an ICC version 2 display profile describing the sRGB
+// (IEC 61966-2.1) color space with a D50 adapted white point. It is built
+// from the published primaries and transfer function rather than shipped as
+// a binary asset.
+func srgbProfile() []byte {
+	srgbICC.once.Do(func() {
+		trc := make([]float64, 1024)
+		for j := range trc {
+			v := float64(j) / float64(len(trc)-1)
+			if v <= 0.04045 {
+				trc[j] = v / 12.92
+			} else {
+				trc[j] = math.Pow((v+0.055)/1.055, 2.4)
+			}
+		}
+		curve := iccCurve(trc)
+		srgbICC.data = iccProfile("RGB ", []iccTagType{
+			{"desc", iccDesc("sRGB IEC61966-2.1")},
+			{"cprt", iccText("No copyright, use freely")},
+			{"wtpt", iccXYZ(0.9642, 1.0, 0.8249)},
+			{"rXYZ", iccXYZ(0.4361, 0.2225, 0.0139)},
+			{"gXYZ", iccXYZ(0.3851, 0.7169, 0.0971)},
+			{"bXYZ", iccXYZ(0.1431, 0.0606, 0.7141)},
+			{"rTRC", curve},
+			{"gTRC", curve},
+			{"bTRC", curve},
+		})
+	})
+	return srgbICC.data
+}
+
+// iccProfile assembles a monitor class profile for the given color space
+// signature. Identical tag data is stored once.
+func iccProfile(colorSpace string, tags []iccTagType) []byte {
+	const headerLen = 128
+	tableLen := 4 + 12*len(tags)
+	buf := make([]byte, headerLen+tableLen)
+	offsets := make([]int, len(tags))
+	for j, tag := range tags {
+		shared := false
+		for k := 0; k < j; k++ {
+			if string(tags[k].data) == string(tag.data) {
+				offsets[j] = offsets[k]
+				shared = true
+				break
+			}
+		}
+		if shared {
+			continue
+		}
+		offsets[j] = len(buf)
+		buf = append(buf, tag.data...)
+		for len(buf)%4 != 0 {
+			buf = append(buf, 0)
+		}
+	}
+	be := binary.BigEndian
+	be.PutUint32(buf[0:], uint32(len(buf)))
+	be.PutUint32(buf[8:], 0x02100000) // version 2.1
+	copy(buf[12:], "mntr")
+	copy(buf[16:], colorSpace)
+	copy(buf[20:], "XYZ ")
+	// creation date: 2000-01-01
+	be.PutUint16(buf[24:], 2000)
+	be.PutUint16(buf[26:], 1)
+	be.PutUint16(buf[28:], 1)
+	copy(buf[36:], "acsp")
+	// rendering intent 0 (perceptual) and D50 illuminant
+	copy(buf[68:], iccXYZ(0.9642, 1.0, 0.8249)[8:])
+	be.PutUint32(buf[headerLen:], uint32(len(tags)))
+	for j, tag := range tags {
+		entry := buf[headerLen+4+12*j:]
+		copy(entry, tag.sig)
+		be.PutUint32(entry[4:], uint32(offsets[j]))
+		be.PutUint32(entry[8:], uint32(len(tag.data)))
+	}
+	return buf
+}
+
+func iccS15Fixed16(v float64) uint32 {
+	return uint32(int32(math.Round(v * 65536)))
+}
+
+func iccXYZ(x, y, z float64) []byte {
+	b := make([]byte, 20)
+	copy(b, "XYZ ")
+	binary.BigEndian.PutUint32(b[8:], iccS15Fixed16(x))
+	binary.BigEndian.PutUint32(b[12:], iccS15Fixed16(y))
+	binary.BigEndian.PutUint32(b[16:], iccS15Fixed16(z))
+	return b
+}
+
+func iccCurve(values []float64) []byte {
+	b := make([]byte, 12+2*len(values))
+	copy(b, "curv")
+	binary.BigEndian.PutUint32(b[8:], uint32(len(values)))
+	for j, v := range values {
+		binary.BigEndian.PutUint16(b[12+2*j:], uint16(math.Round(v*65535)))
+	}
+	return b
+}
+
+func iccText(s string) []byte {
+	b := make([]byte, 8, 8+len(s)+1)
+	copy(b, "text")
+	b = append(b, s...)
+	return append(b, 0)
+}
+
+// iccDesc builds a textDescriptionType with empty Unicode and ScriptCode
+// descriptions
+func iccDesc(s string) []byte {
+	b := make([]byte, 12, 12+len(s)+1+8+3+67)
+	copy(b, "desc")
+	binary.BigEndian.PutUint32(b[8:], uint32(len(s)+1))
+	b = append(b, s...)
+	b = append(b, 0)
+	return append(b, make([]byte, 8+3+67)...)
+}
@@ -0,0 +1,247 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import "math"
+
+// ImposeOptions controls how Impose() arranges pages on sheets.
+//
+// Columns and Rows give the grid of pages on each sheet, zero counting as
+// one. Pages fill the grid from left to right and top to bottom. With
+// Booklet set the grid is two pages side by side and the pages are ordered
+// for a saddle-stitched booklet: the page count is padded with blank pages
+// to a multiple of four and each sheet holds four pages, two on its front
+// and two on its back. Print the sheets double-sided, flipping on the short
+// edge, fold them in the middle and nest them.
+//
+// Bleed is the width of the bleed area that surrounds the trimmed page in
+// each template, for example in pages imported with the "BleedBox". Gap is
+// the distance between adjacent trimmed pages on the sheet. The bleed of a
+// page is clipped where it would reach into a neighbouring page.
+//
+// CropMarks draws marks outside the pages at the position of each cut line,
+// MarkLength long (zero selects 6 mm) and MarkOffset away from the bleed
+// (zero selects 3 mm), with lines MarkWidth wide (zero selects 0.25 points).
+// All lengths are in user units.
+//
+// Scale is the factor applied to the pages. When zero, the pages are scaled
+// to fit the sheet together with their bleed and crop marks. The grid is
+// centered on the sheet.
+type ImposeOptions struct {
+	Columns    int
+	Rows       int
+	Booklet    bool
+	Bleed      float64
+	Gap        float64
+	CropMarks  bool
+	MarkLength float64
+	MarkOffset float64
+	MarkWidth  float64
+	Scale      float64
+}
+
+// Impose places the pages, given as templates such as those returned by
+// ImportPage(), several at a time on sheets. A sheet is a new page of the
+// current default size and orientation. A nil page leaves its cell empty.
+// Cells have the trimmed size of the first page; pages of other sizes are
+// scaled to fit their cell and centered in it.
+//
+// A typical 2-up booklet reads the pages of a PDF file and imposes them on
+// landscape sheets:
+//
+//	pdf := New("L", "mm", "A4", "")
+//	r, _ := NewPDFReaderFromFile("book.pdf")
+//	var pages []Template
+//	for n := 1; n <= r.NumPages(); n++ {
+//		pages = append(pages, pdf.ImportPage(r, n, "TrimBox"))
+//	}
+//	pdf.Impose(pages, ImposeOptions{Booklet: true})
+func (f *Bdf) Impose(pages []Template, options ImposeOptions) {
+	if f.err != nil {
+		return
+	}
+	cols, rows := options.Columns, options.Rows
+	if options.Booklet {
+		cols, rows = 2, 1
+		pages = bookletOrder(pages)
+	}
+	if cols <= 0 {
+		cols = 1
+	}
+	if rows <= 0 {
+		rows = 1
+	}
+	var first Template
+	for _, t := range pages {
+		if t != nil {
+			first = t
+			break
+		}
+	}
+	if first == nil {
+		f.SetErrorf("there are no pages to impose")
+		return
+	}
+	bleed := options.Bleed
+	_, sz := first.Size()
+	trimWd, trimHt := sz.Wd-2*bleed, sz.Ht-2*bleed
+	if bleed < 0 || trimWd <= 0 || trimHt <= 0 {
+		f.SetErrorf("bleed %.2f does not fit pages of %.2f by %.2f", bleed, sz.Wd, sz.Ht)
+		return
+	}
+	markLen, markOff, markWd := options.MarkLength, options.MarkOffset, options.MarkWidth
+	mm := 72 / 25.4 / f.k
+	if markLen <= 0 {
+		markLen = 6 * mm
+	}
+	if markOff <= 0 {
+		markOff = 3 * mm
+	}
+	if markWd <= 0 {
+		markWd = 0.25 / f.k
+	}
+	var markSpace float64
+	if options.CropMarks {
+		markSpace = markOff + markLen
+	}
+	sheetWd, sheetHt := f.pageDims(0)
+	gap := options.Gap
+	scale := options.Scale
+	if scale <= 0 {
+		// The bleed and the marks are only needed around the grid
+		scale = math.Min(
+			(sheetWd-float64(cols-1)*gap-2*markSpace)/(float64(cols)*trimWd+2*bleed),
+			(sheetHt-float64(rows-1)*gap-2*markSpace)/(float64(rows)*trimHt+2*bleed))
+		if scale <= 0 {
+			f.SetErrorf("the sheet is too small for %d by %d pages", cols, rows)
+			return
+		}
+	}
+	cellWd, cellHt, b := trimWd*scale, trimHt*scale, bleed*scale
+	gridWd := float64(cols)*cellWd + float64(cols-1)*gap
+	gridHt := float64(rows)*cellHt + float64(rows-1)*gap
+	left, top := (sheetWd-gridWd)/2, (sheetHt-gridHt)/2
+
+	perSheet := cols * rows
+	for start := 0; start < len(pages); start += perSheet {
+		f.AddPage()
+		if f.err != nil {
+			return
+		}
+		for j := 0; j < perSheet && start+j < len(pages); j++ {
+			if t := pages[start+j]; t != nil {
+				col, row := j%cols, j/cols
+				x := left + float64(col)*(cellWd+gap)
+				y := top + float64(row)*(cellHt+gap)
+				// The bleed extends at most half the gap towards a neighbour
+				inner := math.Min(b, gap/2)
+				bl, br, bt, bb := b, b, b, b
+				if col > 0 {
+					bl = inner
+				}
+				if col < cols-1 {
+					br = inner
+				}
+				if row > 0 {
+					bt = inner
+				}
+				if row < rows-1 {
+					bb = inner
+				}
+				f.ClipRect(x-bl, y-bt, cellWd+bl+br, cellHt+bt+bb, false)
+				f.imposePage(t, x, y, cellWd, cellHt, bleed)
+				f.ClipEnd()
+			}
+		}
+		if options.CropMarks {
+			f.cropMarks(left, top, cols, rows, cellWd, cellHt, gap, b+markOff, markLen, markWd)
+		}
+	}
+}
+
+// imposePage fits the trimmed area of template t, surrounded by bleed, into
+// the cell at (x, y) and centers it
+func (f *Bdf) imposePage(t Template, x, y, cellWd, cellHt, bleed float64) {
+	_, sz := t.Size()
+	wd, ht := sz.Wd-2*bleed, sz.Ht-2*bleed
+	if wd <= 0 || ht <= 0 {
+		f.SetErrorf("bleed %.2f does not fit pages of %.2f by %.2f", bleed, sz.Wd, sz.Ht)
+		return
+	}
+	scale := math.Min(cellWd/wd, cellHt/ht)
+	x += (cellWd - wd*scale) / 2
+	y += (cellHt - ht*scale) / 2
+	f.UseTemplateScaled(t, PointType{X: x - bleed*scale, Y: y - bleed*scale},
+		SizeType{Wd: sz.Wd * scale, Ht: sz.Ht * scale})
+}
+
+// cropMarks draws the marks of the cut lines around a grid of pages. The
+// marks start off away from the trimmed edge of the grid.
+func (f *Bdf) cropMarks(left, top float64, cols, rows int, cellWd, cellHt, gap, off, markLen, markWd float64) {
+	right := left + float64(cols)*cellWd + float64(cols-1)*gap
+	bottom := top + float64(rows)*cellHt + float64(rows-1)*gap
+	st := f.saveDrawState()
+	f.out("q")
+	f.SetDrawColor(0, 0, 0)
+	f.SetLineWidth(markWd)
+	for c := 0; c < cols; c++ {
+		x := left + float64(c)*(cellWd+gap)
+		for _, cut := range []float64{x, x + cellWd} {
+			if cut == x && c > 0 && gap == 0 {
+				// shared with the right edge of the previous column
+				continue
+			}
+			f.Line(cut, top-off-markLen, cut, top-off)
+			f.Line(cut, bottom+off, cut, bottom+off+markLen)
+		}
+	}
+	for r := 0; r < rows; r++ {
+		y := top + float64(r)*(cellHt+gap)
+		for _, cut := range []float64{y, y + cellHt} {
+			if cut == y && r > 0 && gap == 0 {
+				continue
+			}
+			f.Line(left-off-markLen, cut, left-off, cut)
+			f.Line(right+off, cut, right+off+markLen, cut)
+		}
+	}
+	f.out("Q")
+	f.restoreDrawState(st)
+}
+
+// bookletOrder returns the pages in the order in which they are imposed two
+// at a time for a saddle-stitched booklet. Blank pages are added at the end
+// to complete the last sheet.
+func bookletOrder(pages []Template) []Template {
+	n := (len(pages) + 3) / 4 * 4
+	page := func(j int) Template {
+		if j < len(pages) {
+			return pages[j]
+		}
+		return nil
+	}
+	list := make([]Template, 0, n)
+	for j := 0; j < n/2; j += 2 {
+		// front: last and first, back: second and second to last
+		list = append(list, page(n-1-j), page(j), page(j+1), page(n-2-j))
+	}
+	return list
+}
@@ -0,0 +1,143 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// imposeSource returns a document of count A6 pages, each showing its number
+func imposeSource(t *testing.T, count int) *PDFReader {
+	pdf := New("P", "mm", "A6", "")
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetFont("Helvetica", "B", 60)
+	for j := 1; j <= count; j++ {
+		pdf.AddPage()
+		pdf.SetFillColor(220, 230, 250)
+		pdf.Rect(0, 0, 105, 148, "F")
+		pdf.CellFormat(0, 120, strconv.Itoa(j), "", 0, "C", false, 0, "")
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewPDFReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestBookletOrder(t *testing.T) {
+	for count, want := range map[int]string{
+		1: "0 1 0 0",
+		4: "4 1 2 3",
+		6: "0 1 2 0 6 3 4 5",
+		8: "8 1 2 7 6 3 4 5",
+	} {
+		var pages []Template
+		for j := 1; j <= count; j++ {
+			pages = append(pages, &ImportedPage{page: j})
+		}
+		var list []string
+		for _, p := range bookletOrder(pages) {
+			if p == nil {
+				list = append(list, "0")
+			} else {
+				list = append(list, strconv.Itoa(p.(*ImportedPage).page))
+			}
+		}
+		if got := strings.Join(list, " "); got != want {
+			t.Errorf("%d pages: got %s, want %s", count, got, want)
+		}
+	}
+}
+
+func TestImpose(t *testing.T) {
+	r := imposeSource(t, 6)
+	for _, tc := range []struct {
+		orientation string
+		options     ImposeOptions
+		sheets      int
+		marks       int
+	}{
+		{"L", ImposeOptions{Booklet: true}, 4, 0},
+		{"P", ImposeOptions{Columns: 2, Rows: 2, CropMarks: true}, 2, 12},
+		{"P", ImposeOptions{Columns: 2, Rows: 2, Gap: 10, Bleed: 3, CropMarks: true}, 2, 16},
+		{"P", ImposeOptions{Columns: 2, Scale: 1}, 3, 0},
+	} {
+		pdf := New(tc.orientation, "mm", "A4", "")
+		var pages []Template
+		for n := 1; n <= r.NumPages(); n++ {
+			pages = append(pages, pdf.ImportPage(r, n, ""))
+		}
+		pdf.SetDrawColor(255, 0, 0)
+		pdf.SetLineWidth(1)
+		pdf.Impose(pages, tc.options)
+		if r, g, b := pdf.GetDrawColor(); r != 255 || g != 0 || b != 0 || pdf.GetLineWidth() != 1 {
+			t.Errorf("%+v: draw color or line width not restored", tc.options)
+		}
+		var buf bytes.Buffer
+		if err := pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if pdf.PageCount() != tc.sheets {
+			t.Fatalf("%+v: got %d sheets, want %d", tc.options, pdf.PageCount(), tc.sheets)
+		}
+		content := pdf.pages[1].String()
+		if got := strings.Count(content, " l S"); got != tc.marks {
+			t.Errorf("%+v: got %d crop marks, want %d", tc.options, got, tc.marks)
+		}
+		// A booklet page fills the height of the landscape sheet
+		var sx, sy, tx, ty float64
+		line := content[:strings.Index(content, "\n/TPL")]
+		line = line[strings.LastIndex(line, "\n")+1:]
+		if _, err := fmt.Sscanf(line, "q %f 0 0 %f %f %f cm", &sx, &sy, &tx, &ty); err != nil {
+			t.Fatalf("%+v: %s", tc.options, err)
+		}
+		if tc.options.Booklet && (ty < 0 || ty > 10) {
+			t.Errorf("%+v: page placed at %.2f", tc.options, ty)
+		}
+	}
+}
+
+func TestImposeErrors(t *testing.T) {
+	r := imposeSource(t, 1)
+	for _, options := range []ImposeOptions{
+		{Bleed: 60},
+		{Columns: 2, Gap: 300},
+	} {
+		pdf := New("P", "mm", "A4", "")
+		pdf.Impose([]Template{pdf.ImportPage(r, 1, "")}, options)
+		if err := pdf.Output(&bytes.Buffer{}); err == nil {
+			t.Errorf("%+v: no error", options)
+		}
+	}
+	pdf := New("P", "mm", "A4", "")
+	pdf.Impose([]Template{nil}, ImposeOptions{})
+	if pdf.Error() == nil {
+		t.Errorf("imposing no pages did not fail")
+	}
+}
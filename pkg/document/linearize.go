@@ -0,0 +1,448 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// linearLayout holds the objects of a linearized document in file order.
+// Object numbers are those of the source document.
+type linearLayout struct {
+	pageObj    []int         // page objects in page order
+	pageRefs   [][]int       // objects used by each page, page object first
+	owners     map[int][]int // pages using each object
+	catalog    []int         // part 4: catalog and document-level objects
+	first      []int         // part 6: first page and the objects it uses
+	pageGroups [][]int       // part 7: each other page and its private objects
+	shared     []int         // part 8: objects shared by pages other than the first
+	rest       []int         // part 9: all other objects
+}
+
+// linearOwnership walks the objects used by each page. The walk does not
+// follow parent links and does not enter other pages or the catalog.
+func linearOwnership(r *PDFReader, rootNum int) (l linearLayout, err error) {
+	l.pageObj = make([]int, len(r.pages))
+	for num, p := range r.pageNum {
+		l.pageObj[p-1] = num
+	}
+	for _, num := range l.pageObj {
+		if num == 0 {
+			return l, fmt.Errorf("page tree contains direct page objects")
+		}
+	}
+	l.owners = make(map[int][]int)
+	for p, pageNum := range l.pageObj {
+		seen := map[int]bool{pageNum: true}
+		list := []int{pageNum}
+		var walk func(obj interface{})
+		walk = func(obj interface{}) {
+			switch v := obj.(type) {
+			case pdfRef:
+				num := v.num
+				if _, ok := r.xref[num]; !ok || seen[num] || num == rootNum {
+					return
+				}
+				if _, ok := r.pageNum[num]; ok {
+					return
+				}
+				seen[num] = true
+				list = append(list, num)
+				walk(r.object(num))
+			case pdfArray:
+				for _, e := range v {
+					walk(e)
+				}
+			case pdfDict:
+				keys := make([]string, 0, len(v))
+				for key := range v {
+					if key != "Parent" {
+						keys = append(keys, string(key))
+					}
+				}
+				sort.Strings(keys)
+				for _, key := range keys {
+					walk(v[pdfName(key)])
+				}
+			case *pdfStream:
+				walk(v.dict)
+			}
+		}
+		walk(r.object(pageNum))
+		for _, num := range list {
+			l.owners[num] = append(l.owners[num], p)
+		}
+		l.pageRefs = append(l.pageRefs, list)
+	}
+	placed := map[int]bool{rootNum: true}
+	l.catalog = []int{rootNum}
+	if root, ok := r.object(rootNum).(pdfDict); ok {
+		if ref, ok := root["AcroForm"].(pdfRef); ok && len(l.owners[ref.num]) == 0 {
+			if _, ok := r.xref[ref.num]; ok {
+				l.catalog = append(l.catalog, ref.num)
+				placed[ref.num] = true
+			}
+		}
+	}
+	l.first = l.pageRefs[0]
+	for _, num := range l.first {
+		placed[num] = true
+	}
+	l.pageGroups = make([][]int, len(l.pageObj))
+	for p := 1; p < len(l.pageObj); p++ {
+		for _, num := range l.pageRefs[p] {
+			if !placed[num] && len(l.owners[num]) == 1 {
+				l.pageGroups[p] = append(l.pageGroups[p], num)
+				placed[num] = true
+			}
+		}
+	}
+	for p := 1; p < len(l.pageObj); p++ {
+		for _, num := range l.pageRefs[p] {
+			if !placed[num] {
+				l.shared = append(l.shared, num)
+				placed[num] = true
+			}
+		}
+	}
+	for _, num := range pdfObjectNumbers(r) {
+		if !placed[num] {
+			l.rest = append(l.rest, num)
+		}
+	}
+	return
+}
+
+// pdfBitWriter packs the bit fields of hint tables
+type pdfBitWriter struct {
+	buf bytes.Buffer
+	cur byte
+	n   uint
+}
+
+// write appends the low bits of v, most significant bit first
+func (w *pdfBitWriter) write(v, bits int) {
+	for j := bits - 1; j >= 0; j-- {
+		w.cur = w.cur<<1 | byte(v>>uint(j)&1)
+		w.n++
+		if w.n == 8 {
+			w.buf.WriteByte(w.cur)
+			w.cur, w.n = 0, 0
+		}
+	}
+}
+
+// align pads the last byte with zero bits
+func (w *pdfBitWriter) align() {
+	if w.n > 0 {
+		w.buf.WriteByte(w.cur << (8 - w.n))
+		w.cur, w.n = 0, 0
+	}
+}
+
+// pdfBits returns the number of bits needed to represent v
+func pdfBits(v int) (n int) {
+	for ; v > 0; v >>= 1 {
+		n++
+	}
+	return
+}
+
+// pdfIntRange returns the least and the greatest value of list
+func pdfIntRange(list []int) (least, greatest int) {
+	for j, v := range list {
+		if j == 0 || v < least {
+			least = v
+		}
+		if j == 0 || v > greatest {
+			greatest = v
+		}
+	}
+	return
+}
+
+// linearHints returns the page offset and shared object hint tables of a
+// linearized document, and the offset of the latter within the hint stream.
+// Offsets are those the objects would have without the hint stream.
+func linearHints(r *PDFReader, l linearLayout, renum map[int]int, off map[int]int,
+	body map[int][]byte) ([]byte, int) {
+	sharedID := make(map[int]int)
+	for j, num := range l.first {
+		sharedID[num] = j
+	}
+	for j, num := range l.shared {
+		sharedID[num] = len(l.first) + j
+	}
+	count := len(l.pageObj)
+	objCount := make([]int, count)
+	pageLen := make([]int, count)
+	contentOff := make([]int, count)
+	contentLen := make([]int, count)
+	sharedRefs := make([][]int, count)
+	var refCount []int
+	maxID := 0
+	for p := 0; p < count; p++ {
+		group := l.first
+		if p > 0 {
+			group = l.pageGroups[p]
+			for _, num := range l.pageRefs[p] {
+				if id, ok := sharedID[num]; ok {
+					sharedRefs[p] = append(sharedRefs[p], id)
+					if id > maxID {
+						maxID = id
+					}
+				}
+			}
+		}
+		refCount = append(refCount, len(sharedRefs[p]))
+		objCount[p] = len(group)
+		pageLen[p] = linearLength(group, body)
+		if page, ok := r.object(l.pageObj[p]).(pdfDict); ok {
+			if ref, ok := page["Contents"].(pdfRef); ok {
+				for _, num := range group {
+					if num == ref.num {
+						contentOff[p] = off[num] - off[group[0]]
+						contentLen[p] = len(body[num])
+					}
+				}
+			}
+		}
+	}
+	var w pdfBitWriter
+	leastObj, greatestObj := pdfIntRange(objCount)
+	leastLen, greatestLen := pdfIntRange(pageLen)
+	leastOff, greatestOff := pdfIntRange(contentOff)
+	leastCont, greatestCont := pdfIntRange(contentLen)
+	_, greatestRefs := pdfIntRange(refCount)
+	objBits := pdfBits(greatestObj - leastObj)
+	lenBits := pdfBits(greatestLen - leastLen)
+	offBits := pdfBits(greatestOff - leastOff)
+	contBits := pdfBits(greatestCont - leastCont)
+	refBits := pdfBits(greatestRefs)
+	idBits := pdfBits(maxID)
+	w.write(leastObj, 32)
+	w.write(off[l.pageObj[0]], 32)
+	w.write(objBits, 16)
+	w.write(leastLen, 32)
+	w.write(lenBits, 16)
+	w.write(leastOff, 32)
+	w.write(offBits, 16)
+	w.write(leastCont, 32)
+	w.write(contBits, 16)
+	w.write(refBits, 16)
+	w.write(idBits, 16)
+	w.write(0, 16) // no fractional positions of shared objects
+	w.write(1, 16)
+	items := []struct {
+		values []int
+		least  int
+		bits   int
+	}{{objCount, leastObj, objBits}, {pageLen, leastLen, lenBits}, {refCount, 0, refBits}}
+	for _, item := range items {
+		for _, v := range item.values {
+			w.write(v-item.least, item.bits)
+		}
+		w.align()
+	}
+	for _, refs := range sharedRefs {
+		for _, id := range refs {
+			w.write(id, idBits)
+		}
+	}
+	w.align()
+	for _, v := range contentOff {
+		w.write(v-leastOff, offBits)
+	}
+	w.align()
+	for _, v := range contentLen {
+		w.write(v-leastCont, contBits)
+	}
+	w.align()
+	// Shared object hint table with one object per group
+	sharedPos := w.buf.Len()
+	groups := append(append([]int(nil), l.first...), l.shared...)
+	groupLen := make([]int, len(groups))
+	for j, num := range groups {
+		groupLen[j] = len(body[num])
+	}
+	leastGroup, greatestGroup := pdfIntRange(groupLen)
+	groupBits := pdfBits(greatestGroup - leastGroup)
+	if len(l.shared) > 0 {
+		w.write(renum[l.shared[0]], 32)
+		w.write(off[l.shared[0]], 32)
+	} else {
+		w.write(0, 32)
+		w.write(0, 32)
+	}
+	w.write(len(l.first), 32)
+	w.write(len(groups), 32)
+	w.write(0, 16)
+	w.write(leastGroup, 32)
+	w.write(groupBits, 16)
+	for _, v := range groupLen {
+		w.write(v-leastGroup, groupBits)
+	}
+	w.align()
+	for range groups {
+		w.write(0, 1) // no MD5 signatures
+	}
+	w.align()
+	return w.buf.Bytes(), sharedPos
+}
+
+// linearizedOutput writes the objects of r as a linearized document
+func (f *Bdf) linearizedOutput(r *PDFReader) ([]byte, error) {
+	rootRef, _ := r.trailer["Root"].(pdfRef)
+	l, err := linearOwnership(r, rootRef.num)
+	if err != nil {
+		return nil, err
+	}
+	// Objects after the first page section are numbered from 1, those of
+	// the first page section follow
+	renum := make(map[int]int)
+	next := 1
+	var tail []int
+	for _, group := range l.pageGroups {
+		tail = append(tail, group...)
+	}
+	tail = append(append(tail, l.shared...), l.rest...)
+	for _, num := range tail {
+		renum[num] = next
+		next++
+	}
+	mainSize := next
+	linNum := next
+	next++
+	for _, num := range l.catalog {
+		renum[num] = next
+		next++
+	}
+	hintNum := next
+	next++
+	for _, num := range l.first {
+		renum[num] = next
+		next++
+	}
+	size := next
+	renumFnc := func(num int) int {
+		return renum[num]
+	}
+	body := make(map[int][]byte)
+	for num := range renum {
+		var b bytes.Buffer
+		pdfWriteIndirect(&b, renum[num], r.object(num), renumFnc)
+		body[num] = b.Bytes()
+	}
+	header := f.pdfHeader("1.2")
+	linObj := func(fileLen, hintOff, hintLen, end, mainXref int) string {
+		return fmt.Sprintf("%d 0 obj\n<< /Linearized 1 /L %010d /H [%010d %010d] /O %d /E %010d /N %d /T %010d >>\nendobj\n",
+			linNum, fileLen, hintOff, hintLen, renum[l.pageObj[0]], end, len(l.pageObj), mainXref)
+	}
+	firstXref := func(offsets []int, prev int) string {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "xref\n%d %d\n", linNum, size-linNum)
+		for _, o := range offsets {
+			fmt.Fprintf(&b, "%010d 00000 n \n", o)
+		}
+		fmt.Fprintf(&b, "trailer\n<< /Size %d /Root %d 0 R", size, renum[rootRef.num])
+		if ref, ok := r.trailer["Info"].(pdfRef); ok && renum[ref.num] > 0 {
+			fmt.Fprintf(&b, " /Info %d 0 R", renum[ref.num])
+		}
+		if id, ok := r.trailer["ID"]; ok {
+			b.WriteString(" /ID ")
+			pdfWriteObject(&b, id, renumFnc)
+		}
+		fmt.Fprintf(&b, " /Prev %010d >>\nstartxref\n0\n%%%%EOF\n", prev)
+		return b.String()
+	}
+	// Offsets without the hint stream
+	off := make(map[int]int)
+	pos := len(header) + len(linObj(0, 0, 0, 0, 0)) + len(firstXref(make([]int, size-linNum), 0))
+	for _, num := range l.catalog {
+		off[num] = pos
+		pos += len(body[num])
+	}
+	hintOff := pos
+	for _, list := range [][]int{l.first, tail} {
+		for _, num := range list {
+			off[num] = pos
+			pos += len(body[num])
+		}
+	}
+	hints, sharedPos := linearHints(r, l, renum, off, body)
+	mem := xmem.compress(hints)
+	var hb bytes.Buffer
+	pdfWriteIndirect(&hb, hintNum, &pdfStream{dict: pdfDict{"S": sharedPos, "Filter": pdfName("FlateDecode")},
+		data: mem.bytes()}, renumFnc)
+	mem.release()
+	hint := hb.Bytes()
+	for _, list := range [][]int{l.first, tail} {
+		for _, num := range list {
+			off[num] += len(hint)
+		}
+	}
+	end := pos + len(hint) - linearLength(tail, body)
+	mainXref := pos + len(hint)
+	var xb bytes.Buffer
+	fmt.Fprintf(&xb, "xref\n0 %d\n0000000000 65535 f \n", mainSize)
+	for _, num := range tail {
+		fmt.Fprintf(&xb, "%010d 00000 n \n", off[num])
+	}
+	firstXrefOff := len(header) + len(linObj(0, 0, 0, 0, 0))
+	fmt.Fprintf(&xb, "trailer\n<< /Size %d >>\nstartxref\n%d\n%%%%EOF\n", mainSize, firstXrefOff)
+	fileLen := mainXref + xb.Len()
+	offsets := []int{len(header)}
+	for _, num := range l.catalog {
+		offsets = append(offsets, off[num])
+	}
+	offsets = append(offsets, hintOff)
+	for _, num := range l.first {
+		offsets = append(offsets, off[num])
+	}
+	var b bytes.Buffer
+	b.WriteString(header)
+	b.WriteString(linObj(fileLen, hintOff, len(hint), end, mainXref+len(fmt.Sprintf("xref\n0 %d", mainSize))))
+	b.WriteString(firstXref(offsets, mainXref))
+	for _, num := range l.catalog {
+		b.Write(body[num])
+	}
+	b.Write(hint)
+	for _, list := range [][]int{l.first, tail} {
+		for _, num := range list {
+			b.Write(body[num])
+		}
+	}
+	b.Write(xb.Bytes())
+	if b.Len() != fileLen {
+		return nil, fmt.Errorf("linearized layout mismatch")
+	}
+	return b.Bytes(), nil
+}
+
+// linearLength returns the number of bytes of the objects in list
+func linearLength(list []int, body map[int][]byte) (n int) {
+	for _, num := range list {
+		n += len(body[num])
+	}
+	return
+}
@@ -0,0 +1,436 @@
+package markdown
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	entityRe   = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[A-Za-z][A-Za-z0-9]{1,31});`)
+	autolinkRe = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9+.-]{1,31}:[^<>\x00-\x20]*)>`)
+	emailRe    = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)>`)
+	rawHTMLRe  = regexp.MustCompile(`^(?:<[A-Za-z][A-Za-z0-9-]*(?:\s+[A-Za-z_:][A-Za-z0-9_.:-]*(?:\s*=\s*(?:[^\s"'=<>` + "`" + `]+|'[^']*'|"[^"]*"))?)*\s*/?>|</[A-Za-z][A-Za-z0-9-]*\s*>|<!--[\s\S]*?-->)`)
+	urlRe      = regexp.MustCompile(`^(?:https?://|www\.)[^\s<]*`)
+	tagRe      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// inlineNode is a piece of rendered inline content. Delimiter runs of
+// emphasis characters keep their character and remaining length until the
+// emphasis has been resolved.
+type inlineNode struct {
+	text          string
+	delim         byte
+	n, orig       int
+	open, close   bool
+	opens, closes string
+}
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// unescape resolves backslash escapes and entities of s
+func unescape(s string) string {
+	var b strings.Builder
+	for j := 0; j < len(s); j++ {
+		if s[j] == '\\' && j+1 < len(s) && s[j+1] < utf8.RuneSelf && isPunct(rune(s[j+1])) {
+			j++
+		}
+		b.WriteByte(s[j])
+	}
+	return html.UnescapeString(b.String())
+}
+
+// inline converts the inline content s to HTML
+func (p *parser) inline(s string) string {
+	var nodes []*inlineNode
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, &inlineNode{text: text.String()})
+			text.Reset()
+		}
+	}
+	emit := func(h string) {
+		flush()
+		nodes = append(nodes, &inlineNode{text: h})
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch c {
+		case '\\':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				emit("<br>\n")
+				i += 2
+				continue
+			}
+			if i+1 < len(s) && s[i+1] < utf8.RuneSelf && isPunct(rune(s[i+1])) {
+				text.WriteString(html.EscapeString(s[i+1 : i+2]))
+				i += 2
+				continue
+			}
+		case '`':
+			n := runLength(s, i)
+			if end := codeEnd(s, i+n, n); end >= 0 {
+				code := strings.Replace(s[i+n:end], "\n", " ", -1)
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+					code = code[1 : len(code)-1]
+				}
+				emit("<code>" + html.EscapeString(code) + "</code>")
+				i = end + n
+			} else {
+				text.WriteString(s[i : i+n])
+				i += n
+			}
+			continue
+		case '*', '_', '~':
+			n := runLength(s, i)
+			if c == '~' && n > 2 {
+				text.WriteString(s[i : i+n])
+				i += n
+				continue
+			}
+			before, _ := utf8.DecodeLastRuneInString(s[:i])
+			after, _ := utf8.DecodeRuneInString(s[i+n:])
+			if i == 0 {
+				before = ' '
+			}
+			if i+n == len(s) {
+				after = ' '
+			}
+			sb, sa := unicode.IsSpace(before), unicode.IsSpace(after)
+			left := !sa && (!isPunct(after) || sb || isPunct(before))
+			right := !sb && (!isPunct(before) || sa || isPunct(after))
+			d := &inlineNode{delim: c, n: n, orig: n, open: left, close: right}
+			if c == '_' {
+				d.open = left && (!right || isPunct(before))
+				d.close = right && (!left || isPunct(after))
+			}
+			flush()
+			nodes = append(nodes, d)
+			i += n
+			continue
+		case '!', '[':
+			if h, end, ok := p.link(s, i); ok {
+				emit(h)
+				i = end
+				continue
+			}
+			if c == '!' && i+1 < len(s) && s[i+1] == '[' {
+				text.WriteString("![")
+				i += 2
+				continue
+			}
+		case '<':
+			if m := autolinkRe.FindStringSubmatch(s[i:]); m != nil {
+				emit(`<a href="` + html.EscapeString(m[1]) + `">` + html.EscapeString(m[1]) + "</a>")
+				i += len(m[0])
+				continue
+			}
+			if m := emailRe.FindStringSubmatch(s[i:]); m != nil {
+				emit(`<a href="mailto:` + html.EscapeString(m[1]) + `">` + html.EscapeString(m[1]) + "</a>")
+				i += len(m[0])
+				continue
+			}
+			if m := rawHTMLRe.FindString(s[i:]); m != "" {
+				emit(m)
+				i += len(m)
+				continue
+			}
+		case '&':
+			if m := entityRe.FindString(s[i:]); m != "" {
+				text.WriteString(html.EscapeString(html.UnescapeString(m)))
+				i += len(m)
+				continue
+			}
+		case 'h', 'w':
+			if i == 0 || strings.ContainsRune(" \t\n(*_~", rune(s[i-1])) {
+				if m := urlRe.FindString(s[i:]); m != "" && strings.Contains(m, ".") {
+					m = strings.TrimRight(m, ".,:;!?\"'*_~")
+					for strings.HasSuffix(m, ")") && strings.Count(m, ")") > strings.Count(m, "(") {
+						m = m[:len(m)-1]
+					}
+					href := m
+					if strings.HasPrefix(m, "www.") {
+						href = "http://" + m
+					}
+					emit(`<a href="` + html.EscapeString(href) + `">` + html.EscapeString(m) + "</a>")
+					i += len(m)
+					continue
+				}
+			}
+		case ' ':
+			n := 0
+			for i+n < len(s) && s[i+n] == ' ' {
+				n++
+			}
+			if i+n < len(s) && s[i+n] == '\n' {
+				if n >= 2 {
+					emit("<br>")
+				}
+				i += n
+				continue
+			}
+		case '\n':
+			text.WriteByte('\n')
+			i++
+			for i < len(s) && s[i] == ' ' {
+				i++
+			}
+			continue
+		}
+		text.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+	flush()
+	emphasis(nodes)
+	var b strings.Builder
+	for _, nd := range nodes {
+		b.WriteString(nd.closes)
+		if nd.delim != 0 {
+			b.WriteString(strings.Repeat(string(nd.delim), nd.n))
+		} else {
+			b.WriteString(nd.text)
+		}
+		b.WriteString(nd.opens)
+	}
+	return b.String()
+}
+
+// emphasis matches the delimiter runs of nodes following the rules of
+// CommonMark, ~~ marking struck out text
+func emphasis(nodes []*inlineNode) {
+	for ci := 0; ci < len(nodes); ci++ {
+		c := nodes[ci]
+		if c.delim == 0 || !c.close || c.n == 0 {
+			continue
+		}
+		for oi := ci - 1; oi >= 0; oi-- {
+			o := nodes[oi]
+			if o.delim != c.delim || !o.open || o.n == 0 {
+				continue
+			}
+			if c.delim == '~' {
+				if o.n != c.n {
+					continue
+				}
+			} else if (o.close || c.open) && (o.orig+c.orig)%3 == 0 && (o.orig%3 != 0 || c.orig%3 != 0) {
+				continue
+			}
+			use, tag := 1, "em"
+			switch {
+			case c.delim == '~':
+				use, tag = c.n, "del"
+			case o.n >= 2 && c.n >= 2:
+				use, tag = 2, "strong"
+			}
+			o.n -= use
+			c.n -= use
+			o.opens = "<" + tag + ">" + o.opens
+			c.closes += "</" + tag + ">"
+			for _, nd := range nodes[oi+1 : ci] {
+				nd.open, nd.close = false, false
+			}
+			if c.n > 0 {
+				ci--
+			}
+			break
+		}
+	}
+}
+
+func runLength(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+// codeEnd returns the position of the backtick run of length n closing a code
+// span that starts at i, or -1
+func codeEnd(s string, i, n int) int {
+	for i < len(s) {
+		j := strings.IndexByte(s[i:], '`')
+		if j < 0 {
+			return -1
+		}
+		j += i
+		k := runLength(s, j)
+		if k == n {
+			return j
+		}
+		i = j + k
+	}
+	return -1
+}
+
+// closeBracket returns the position of the bracket closing the one at i, or
+// -1. Escaped brackets and brackets in code spans are skipped.
+func closeBracket(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			n := runLength(s, j)
+			if end := codeEnd(s, j+n, n); end >= 0 {
+				j = end + n - 1
+			} else {
+				j += n - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// linkDest parses an inline link destination and title starting after the
+// opening parenthesis at i. It returns the position after the closing
+// parenthesis.
+func linkDest(s string, i int) (dest, title string, end int, ok bool) {
+	skip := func() {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n') {
+			i++
+		}
+	}
+	skip()
+	if i < len(s) && s[i] == '<' {
+		j := strings.IndexAny(s[i+1:], ">\n")
+		if j < 0 || s[i+1+j] != '>' {
+			return
+		}
+		dest = s[i+1 : i+1+j]
+		i += j + 2
+	} else {
+		depth, start := 0, i
+		for ; i < len(s); i++ {
+			ch := s[i]
+			if ch == '\\' && i+1 < len(s) {
+				i++
+				continue
+			}
+			if ch == '(' {
+				depth++
+			} else if ch == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			} else if ch <= ' ' {
+				break
+			}
+		}
+		dest = s[start:i]
+	}
+	n := i
+	skip()
+	if i < len(s) && i > n && strings.IndexByte(`"'(`, s[i]) >= 0 {
+		closer := s[i]
+		if closer == '(' {
+			closer = ')'
+		}
+		j := i + 1
+		for ; j < len(s) && s[j] != closer; j++ {
+			if s[j] == '\\' {
+				j++
+			}
+		}
+		if j >= len(s) {
+			return
+		}
+		title = s[i+1 : j]
+		i = j + 1
+		skip()
+	}
+	if i >= len(s) || s[i] != ')' {
+		return
+	}
+	return unescape(dest), unescape(title), i + 1, true
+}
+
+// link converts the link or image starting at i
+func (p *parser) link(s string, i int) (out string, end int, ok bool) {
+	img := s[i] == '!'
+	open := i
+	if img {
+		if i+1 >= len(s) || s[i+1] != '[' {
+			return
+		}
+		open++
+	}
+	closing := closeBracket(s, open)
+	if closing < 0 {
+		return
+	}
+	label := s[open+1 : closing]
+	var ref linkRef
+	end = closing + 1
+	switch {
+	case end < len(s) && s[end] == '(':
+		if dest, title, e, found := linkDest(s, end+1); found {
+			ref, end, ok = linkRef{dest, title}, e, true
+		}
+	case end < len(s) && s[end] == '[':
+		if k := closeBracket(s, end); k >= 0 {
+			key := s[end+1 : k]
+			if key == "" {
+				key = label
+			}
+			ref, ok = p.refs[normalizeLabel(key)]
+			end = k + 1
+		}
+	}
+	if !ok && !(end < len(s) && s[end] == '(') {
+		ref, ok = p.refs[normalizeLabel(label)]
+		end = closing + 1
+	}
+	if !ok {
+		return
+	}
+	title := ""
+	if ref.title != "" {
+		title = ` title="` + html.EscapeString(ref.title) + `"`
+	}
+	if img {
+		alt := html.UnescapeString(tagRe.ReplaceAllString(p.inline(label), ""))
+		return `<img src="` + html.EscapeString(ref.dest) + `" alt="` +
+			html.EscapeString(alt) + `"` + title + `>`, end, true
+	}
+	inner := p.inline(label)
+	if strings.Contains(inner, "<a ") {
+		// links may not contain other links
+		return "", 0, false
+	}
+	return `<a href="` + html.EscapeString(ref.dest) + `"` + title + `>` + inner + "</a>", end, true
+}
@@ -0,0 +1,226 @@
+// Package markdown renders CommonMark documents into a Bdf document. Besides
+// the CommonMark syntax, pipe tables, strikethrough and bare URLs are
+// recognized as in GitHub Flavored Markdown.
+//
+// The Markdown is converted to HTML and laid out with the HTML renderer of
+// the document package, styled by a Theme. Each heading adds an entry to the
+// outline of the document and can be linked to as "#slug", where slug is the
+// heading text in lower case with spaces replaced by hyphens and other
+// punctuation removed.
+package markdown
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/bhojpur/render/pkg/document"
+)
+
+// Options controls the rendering of a Markdown document.
+type Options struct {
+	// Theme styles the document, nil selects DefaultTheme().
+	Theme *Theme
+	// BaseDir is the directory image files are read from. Only relative paths
+	// that stay inside it are loaded; when it is empty, images are limited to
+	// data URIs.
+	BaseDir string
+}
+
+// Render renders the Markdown document src into pdf, starting at the current
+// position. A page is added if the document has none. The font and text
+// color of the theme remain selected on return.
+func Render(pdf *document.Bdf, src []byte, options Options) error {
+	if pdf.Err() {
+		return pdf.Error()
+	}
+	theme := options.Theme
+	if theme == nil {
+		theme = DefaultTheme()
+	}
+	body := ToHTML(src)
+	pdf.SetFont(theme.FontFamily, "", theme.FontSize)
+	pdf.SetTextColor(theme.TextColor.R, theme.TextColor.G, theme.TextColor.B)
+	if pdf.PageNo() == 0 {
+		pdf.AddPage()
+	}
+	h := pdf.HTMLNew()
+	h.StyleSheet = theme.styleSheet()
+	h.LineHeight = theme.LineHeight
+	h.Bookmarks = true
+	h.ImageDir = options.BaseDir
+	h.Write(body)
+	return pdf.Error()
+}
+
+// New returns a document holding the rendered Markdown document src. The
+// arguments orientationStr, unitStr and sizeStr are those of document.New().
+// The title of the document is the text of the first heading of level one.
+func New(src []byte, orientationStr, unitStr, sizeStr string, options Options) (*document.Bdf, error) {
+	pdf := document.New(orientationStr, unitStr, sizeStr, "")
+	for _, b := range newParser().blocks(splitLines(string(src))) {
+		if b.kind == blockHeading && b.level == 1 {
+			pdf.SetTitle(plainText(newParser().inline(b.text)), true)
+			break
+		}
+	}
+	if err := Render(pdf, src, options); err != nil {
+		return nil, err
+	}
+	return pdf, nil
+}
+
+// ToHTML converts the Markdown document src to an HTML fragment.
+func ToHTML(src []byte) string {
+	p := newParser()
+	list := p.blocks(splitLines(string(src)))
+	var b strings.Builder
+	for _, blk := range list {
+		p.write(&b, blk, false, false)
+	}
+	return b.String()
+}
+
+func newParser() *parser {
+	return &parser{refs: make(map[string]linkRef), slugs: make(map[string]int)}
+}
+
+// write appends the HTML of blk to b. Paragraphs of tight list items are
+// written without their p element. The last block of a block quote, or of an
+// item of a tight list, is marked to drop its bottom margin.
+func (p *parser) write(b *strings.Builder, blk *block, tight, last bool) {
+	class := ""
+	if last {
+		class = ` class="last"`
+	}
+	switch blk.kind {
+	case blockParagraph:
+		if tight {
+			b.WriteString(p.inline(blk.text) + "\n")
+		} else {
+			b.WriteString("<p" + class + ">" + p.inline(blk.text) + "</p>\n")
+		}
+	case blockHeading:
+		content := p.inline(blk.text)
+		fmt.Fprintf(b, "<h%d id=\"%s\">%s</h%d>\n", blk.level, p.slug(plainText(content)), content, blk.level)
+	case blockCode:
+		if lang := strings.Fields(blk.info); len(lang) > 0 {
+			class = ` class="language-` + html.EscapeString(lang[0])
+			if last {
+				class += " last"
+			}
+			class += `"`
+		}
+		code := blk.text
+		if strings.HasPrefix(code, "\n") {
+			// the HTML parser drops a newline following the start tag
+			code = "\n" + code
+		}
+		b.WriteString("<pre" + class + ">" + html.EscapeString(code) + "</pre>\n")
+	case blockQuote:
+		b.WriteString("<blockquote" + class + ">\n")
+		for j, c := range blk.children {
+			p.write(b, c, false, j == len(blk.children)-1)
+		}
+		b.WriteString("</blockquote>\n")
+	case blockList:
+		tag := "ul"
+		if blk.ordered {
+			tag = "ol"
+		}
+		if blk.ordered && blk.start != 1 {
+			fmt.Fprintf(b, "<ol start=\"%d\"%s>\n", blk.start, class)
+		} else {
+			b.WriteString("<" + tag + class + ">\n")
+		}
+		for _, item := range blk.children {
+			b.WriteString("<li>")
+			for j, c := range item.children {
+				p.write(b, c, !blk.loose, !blk.loose && j == len(item.children)-1)
+			}
+			b.WriteString("</li>\n")
+		}
+		b.WriteString("</" + tag + ">\n")
+	case blockRule:
+		b.WriteString("<hr>\n")
+	case blockTable:
+		b.WriteString("<table" + class + ">\n")
+		for j, row := range blk.rows {
+			cell := "td"
+			if j == 0 {
+				cell = "th"
+				b.WriteString("<thead>\n")
+			} else if j == 1 {
+				b.WriteString("<tbody>\n")
+			}
+			b.WriteString("<tr>")
+			for k, align := range blk.align {
+				text := ""
+				if k < len(row) {
+					text = p.inline(row[k])
+				}
+				if align != "" {
+					fmt.Fprintf(b, "<%s style=\"text-align: %s\">%s</%s>", cell, align, text, cell)
+				} else {
+					fmt.Fprintf(b, "<%s>%s</%s>", cell, text, cell)
+				}
+			}
+			b.WriteString("</tr>\n")
+			if j == 0 {
+				b.WriteString("</thead>\n")
+			}
+		}
+		if len(blk.rows) > 1 {
+			b.WriteString("</tbody>\n")
+		}
+		b.WriteString("</table>\n")
+	case blockHTML:
+		b.WriteString(blk.text + "\n")
+	}
+}
+
+// slug returns the unique anchor name of a heading
+func (p *parser) slug(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	s := b.String()
+	n := p.slugs[s]
+	p.slugs[s] = n + 1
+	if n > 0 {
+		s = fmt.Sprintf("%s-%d", s, n)
+	}
+	return s
+}
+
+// plainText returns the text of an HTML fragment
+func plainText(s string) string {
+	return html.UnescapeString(tagRe.ReplaceAllString(s, ""))
+}
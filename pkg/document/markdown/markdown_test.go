@@ -0,0 +1,112 @@
+package markdown
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bhojpur/render/pkg/document"
+)
+
+func TestToHTML(t *testing.T) {
+	for _, tc := range []struct {
+		src, want string
+	}{
+		{"# Title #\n\nSub\n===", "<h1 id=\"title\">Title</h1>\n<h1 id=\"sub\">Sub</h1>\n"},
+		{"## A & B\n## A & B", "<h2 id=\"a--b\">A &amp; B</h2>\n<h2 id=\"a--b-1\">A &amp; B</h2>\n"},
+		{"one\ntwo  \nthree\\\nfour", "<p>one\ntwo<br>\nthree<br>\nfour</p>\n"},
+		{"*a* **b** ***c*** _d_ snake_case_name ~~e~~", "<p><em>a</em> <strong>b</strong> " +
+			"<em><strong>c</strong></em> <em>d</em> snake_case_name <del>e</del></p>\n"},
+		{"*foo**bar**baz*", "<p><em>foo<strong>bar</strong>baz</em></p>\n"},
+		{"**open *nested***", "<p><strong>open <em>nested</em></strong></p>\n"},
+		{"`a <b>` `` c`d ``", "<p><code>a &lt;b&gt;</code> <code>c`d</code></p>\n"},
+		{`\*not\* &copy; &bogus 1 < 2`, "<p>*not* © &amp;bogus 1 &lt; 2</p>\n"},
+		{"[x](/u \"T\") ![i](p.png) <http://a.b> <me@a.b> https://a.b/c).",
+			"<p><a href=\"/u\" title=\"T\">x</a> <img src=\"p.png\" alt=\"i\"> " +
+				"<a href=\"http://a.b\">http://a.b</a> <a href=\"mailto:me@a.b\">me@a.b</a> " +
+				"<a href=\"https://a.b/c\">https://a.b/c</a>).</p>\n"},
+		{"[Foo][] [bar] [baz][foo]\n\n[foo]: <http://f> 'F'\n[BAR]: http://b",
+			"<p><a href=\"http://f\" title=\"F\">Foo</a> <a href=\"http://b\">bar</a> " +
+				"<a href=\"http://f\" title=\"F\">baz</a></p>\n"},
+		{"- a\n- b\n  - c\n\n1) x", "<ul>\n<li>a\n</li>\n<li>b\n<ul class=\"last\">\n<li>c\n</li>\n</ul>\n</li>\n</ul>\n" +
+			"<ol>\n<li>x\n</li>\n</ol>\n"},
+		{"3. a\n\n4. b", "<ol start=\"3\">\n<li><p>a</p>\n</li>\n<li><p>b</p>\n</li>\n</ol>\n"},
+		{"> q\nlazy\n> > r", "<blockquote>\n<p>q\nlazy</p>\n<blockquote class=\"last\">\n<p class=\"last\">r</p>\n</blockquote>\n</blockquote>\n"},
+		{"```go extra\n<x>\n\n```\n\n    code\n\n    more", "<pre class=\"language-go\">&lt;x&gt;\n</pre>\n<pre>code\n\nmore</pre>\n"},
+		{"a | b\n--|:-:\n1 | `a\\|b` x\n\npara", "<table>\n<thead>\n<tr><th>a</th><th style=\"text-align: center\">b</th></tr>\n</thead>\n" +
+			"<tbody>\n<tr><td>1</td><td style=\"text-align: center\"><code>a|b</code> x</td></tr>\n</tbody>\n</table>\n<p>para</p>\n"},
+		{"***\npara\n---", "<hr>\n<h2 id=\"para\">para</h2>\n"},
+		{"<div>\n*raw*\n</div>\n\n<b>x</b> y\n\n<br>", "<div>\n*raw*\n</div>\n<p><b>x</b> y</p>\n<br>\n"},
+	} {
+		if got := ToHTML([]byte(tc.src)); got != tc.want {
+			t.Errorf("%q\ngot  %q\nwant %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	fl, err := os.Create(filepath.Join(dir, "dot.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(fl, image.NewGray(image.Rect(0, 0, 4, 4)))
+	fl.Close()
+	src := "# Release notes\n\nSee [usage](#usage) and [the site](https://example.com).\n\n" +
+		"![dot](dot.png) ![missing](none.png)\n\n## Usage\n\n```\nrun --fast\n```\n\n" +
+		"| Key | Value |\n|-----|------:|\n| a | 1 |\n\n### Details\n\n> quoted\n"
+	theme := DefaultTheme()
+	theme.LinkColor = document.RGBType{R: 255, G: 0, B: 0}
+	pdf, err := New([]byte(src), "P", "mm", "A4", Options{Theme: theme, BaseDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf.SetCompression(false)
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{
+		"/Title (Release notes)", "/Outlines", "/Title (Usage)", "/Title (Details)", "/Dest [",
+		"/URI (https://example.com)", "/Subtype /Image", "(missing)", "(run --fast)", "(Value)",
+		"1.000 0.000 0.000 rg", "(quoted)",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%q not found in output", s)
+		}
+	}
+	if n := strings.Count(out, "/Title ("); n != 4 {
+		t.Errorf("%d titles, expected the document title and three bookmarks", n)
+	}
+
+	pdf = document.New("P", "mm", "A4", "")
+	pdf.SetError(os.ErrInvalid)
+	if Render(pdf, []byte("text"), Options{}) != os.ErrInvalid {
+		t.Error("error of the document not returned")
+	}
+}
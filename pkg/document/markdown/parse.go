@@ -0,0 +1,485 @@
+package markdown
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	blockParagraph = iota
+	blockHeading
+	blockCode
+	blockQuote
+	blockList
+	blockItem
+	blockRule
+	blockTable
+	blockHTML
+)
+
+// block is a node of the block structure of a document
+type block struct {
+	kind  int
+	level int // heading level
+	// text is the inline content of paragraphs, headings and table cells or
+	// the literal content of code and HTML blocks
+	text     string
+	info     string // info string of a fenced code block
+	ordered  bool
+	start    int
+	loose    bool
+	blank    bool // preceded by a blank line
+	children []*block
+	align    []string
+	rows     [][]string
+}
+
+// linkRef is the target of a link reference definition
+type linkRef struct {
+	dest, title string
+}
+
+// parser holds the state of a conversion
+type parser struct {
+	refs  map[string]linkRef
+	slugs map[string]int
+}
+
+var (
+	atxRe      = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	fenceRe    = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^ \t]*).*$")
+	ruleRe     = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	setextRe   = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	bulletRe   = regexp.MustCompile(`^( {0,3})([-+*])( *)(.*)$`)
+	orderedRe  = regexp.MustCompile(`^( {0,3})([0-9]{1,9})([.)])( *)(.*)$`)
+	htmlTagRe  = regexp.MustCompile(`^ {0,3}<(?:/?([A-Za-z][A-Za-z0-9-]*)(?:[ \t/>]|$)|!--)`)
+	refDefRe   = regexp.MustCompile(`^ {0,3}\[((?:[^\]\\]|\\.)+)\]:[ \t]*(<[^>]*>|\S+)(?:[ \t]+("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|\((?:[^)\\]|\\.)*\)))?[ \t]*$`)
+	delimRowRe = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+)
+
+// expandTabs replaces the tabs of the indentation of line with spaces, using
+// tab stops of four columns
+func expandTabs(line string) string {
+	var b strings.Builder
+	col := 0
+	for j := 0; j < len(line); j++ {
+		switch line[j] {
+		case ' ':
+			b.WriteByte(' ')
+			col++
+		case '\t':
+			n := 4 - col%4
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+		default:
+			b.WriteString(line[j:])
+			return b.String()
+		}
+	}
+	return b.String()
+}
+
+// htmlBlockTags are the elements that start an HTML block even within a
+// paragraph
+var htmlBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "body": true,
+	"caption": true, "center": true, "col": true, "colgroup": true, "dd": true,
+	"details": true, "div": true, "dl": true, "dt": true, "fieldset": true,
+	"figcaption": true, "figure": true, "footer": true, "form": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "head": true,
+	"header": true, "hr": true, "html": true, "iframe": true, "legend": true,
+	"li": true, "main": true, "nav": true, "ol": true, "p": true, "pre": true,
+	"script": true, "section": true, "style": true, "summary": true, "table": true,
+	"tbody": true, "td": true, "tfoot": true, "th": true, "thead": true, "title": true,
+	"tr": true, "ul": true,
+}
+
+// htmlBlock reports whether line starts an HTML block. Other elements start
+// a block only when the line holds nothing but a tag and no paragraph is
+// interrupted.
+func htmlBlock(line string, interrupt bool) bool {
+	m := htmlTagRe.FindStringSubmatch(line)
+	if m == nil {
+		return false
+	}
+	if m[1] == "" || htmlBlockTags[strings.ToLower(m[1])] {
+		return true
+	}
+	t := strings.TrimSpace(line)
+	return !interrupt && rawHTMLRe.FindString(t) == t
+}
+
+func indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func blank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// unindent removes up to n leading spaces from line
+func unindent(line string, n int) string {
+	if k := indent(line); k < n {
+		n = k
+	}
+	return line[n:]
+}
+
+// listMarker reports whether line starts a list item. offset is the column of
+// the content of the item.
+type listMarker struct {
+	ordered bool
+	delim   byte
+	start   int
+	offset  int
+	empty   bool
+}
+
+func parseMarker(line string) (m listMarker, ok bool) {
+	var lead, marker, spaces, rest string
+	if sm := bulletRe.FindStringSubmatch(line); sm != nil {
+		lead, marker, spaces, rest = sm[1], sm[2], sm[3], sm[4]
+		m.delim = marker[0]
+	} else if sm := orderedRe.FindStringSubmatch(line); sm != nil {
+		lead, marker, spaces, rest = sm[1], sm[2]+sm[3], sm[4], sm[5]
+		m.ordered, m.delim = true, sm[3][0]
+		m.start, _ = strconv.Atoi(sm[2])
+	} else {
+		return
+	}
+	if spaces == "" && rest != "" {
+		return
+	}
+	m.empty = rest == ""
+	m.offset = len(lead) + len(marker) + len(spaces)
+	if m.empty || len(spaces) > 4 {
+		m.offset = len(lead) + len(marker) + 1
+	}
+	return m, true
+}
+
+// interrupts reports whether line starts a block that ends a paragraph
+func interrupts(line string) bool {
+	if indent(line) >= 4 {
+		return false
+	}
+	if atxRe.MatchString(line) || fenceRe.MatchString(line) || ruleRe.MatchString(line) ||
+		htmlBlock(line, true) || strings.HasPrefix(strings.TrimLeft(line, " "), ">") {
+		return true
+	}
+	if m, ok := parseMarker(line); ok && !m.empty && (!m.ordered || m.start == 1) {
+		return true
+	}
+	return false
+}
+
+// splitLines returns the lines of src with normalized line endings
+func splitLines(src string) []string {
+	src = strings.Replace(src, "\r\n", "\n", -1)
+	src = strings.Replace(src, "\r", "\n", -1)
+	lines := strings.Split(strings.TrimSuffix(src, "\n"), "\n")
+	for j, line := range lines {
+		lines[j] = expandTabs(line)
+	}
+	return lines
+}
+
+// blocks parses lines into a list of blocks
+func (p *parser) blocks(lines []string) (list []*block) {
+	wasBlank := false
+	add := func(b *block) {
+		b.blank = wasBlank && len(list) > 0
+		list = append(list, b)
+		wasBlank = false
+	}
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if blank(line) {
+			wasBlank = true
+			i++
+			continue
+		}
+		if indent(line) >= 4 {
+			var code []string
+			j := i
+			for ; j < len(lines) && (blank(lines[j]) || indent(lines[j]) >= 4); j++ {
+				code = append(code, unindent(lines[j], 4))
+			}
+			for len(code) > 0 && blank(code[len(code)-1]) {
+				code = code[:len(code)-1]
+				j--
+			}
+			add(&block{kind: blockCode, text: strings.Join(code, "\n")})
+			i = j
+			continue
+		}
+		if sm := fenceRe.FindStringSubmatch(line); sm != nil && !(sm[2][0] == '`' && strings.Contains(line[len(sm[1])+len(sm[2]):], "`")) {
+			ind, fence := len(sm[1]), sm[2]
+			var code []string
+			j := i + 1
+			for ; j < len(lines); j++ {
+				l := strings.TrimSpace(lines[j])
+				if indent(lines[j]) < 4 && strings.HasPrefix(l, fence) && strings.Trim(l, fence[:1]) == "" {
+					j++
+					break
+				}
+				code = append(code, unindent(lines[j], ind))
+			}
+			add(&block{kind: blockCode, text: strings.Join(code, "\n"), info: unescape(sm[3])})
+			i = j
+			continue
+		}
+		if sm := atxRe.FindStringSubmatch(line); sm != nil {
+			add(&block{kind: blockHeading, level: len(sm[1]), text: strings.TrimSpace(sm[2])})
+			i++
+			continue
+		}
+		if ruleRe.MatchString(line) {
+			add(&block{kind: blockRule})
+			i++
+			continue
+		}
+		if strings.HasPrefix(strings.TrimLeft(line, " "), ">") {
+			var inner []string
+			j := i
+			for ; j < len(lines); j++ {
+				l := lines[j]
+				if t := strings.TrimLeft(l, " "); indent(l) < 4 && strings.HasPrefix(t, ">") {
+					t = expandTabs(t[1:])
+					inner = append(inner, strings.TrimPrefix(t, " "))
+				} else if !blank(l) && len(inner) > 0 && !blank(inner[len(inner)-1]) && !interrupts(l) {
+					// lazy continuation of a paragraph
+					inner = append(inner, l)
+				} else {
+					break
+				}
+			}
+			add(&block{kind: blockQuote, children: p.blocks(inner)})
+			i = j
+			continue
+		}
+		if m, ok := parseMarker(line); ok {
+			b, next := p.list(lines, i, m)
+			add(b)
+			i = next
+			continue
+		}
+		if htmlBlock(line, false) {
+			j := i
+			for ; j < len(lines) && !blank(lines[j]); j++ {
+			}
+			add(&block{kind: blockHTML, text: strings.Join(lines[i:j], "\n")})
+			i = j
+			continue
+		}
+		if i+1 < len(lines) && strings.Contains(line, "|") && delimRowRe.MatchString(lines[i+1]) {
+			head := splitRow(line)
+			if aligns := tableAlign(lines[i+1]); len(aligns) == len(head) {
+				t := &block{kind: blockTable, align: aligns, rows: [][]string{head}}
+				j := i + 2
+				for ; j < len(lines) && !blank(lines[j]) && !interrupts(lines[j]); j++ {
+					t.rows = append(t.rows, splitRow(lines[j]))
+				}
+				add(t)
+				i = j
+				continue
+			}
+		}
+		// paragraph, possibly preceded by link reference definitions
+		var para []string
+		j := i
+		for ; j < len(lines); j++ {
+			l := lines[j]
+			if blank(l) {
+				break
+			}
+			if len(para) == 0 {
+				if sm := refDefRe.FindStringSubmatch(l); sm != nil {
+					p.define(sm[1], sm[2], sm[3])
+					continue
+				}
+			} else {
+				if sm := setextRe.FindStringSubmatch(l); sm != nil {
+					level := 1
+					if sm[1][0] == '-' {
+						level = 2
+					}
+					add(&block{kind: blockHeading, level: level, text: strings.Join(para, "\n")})
+					para = nil
+					j++
+					break
+				}
+				if interrupts(l) {
+					break
+				}
+			}
+			para = append(para, strings.TrimLeft(l, " "))
+		}
+		if len(para) > 0 {
+			para[len(para)-1] = strings.TrimRight(para[len(para)-1], " ")
+			add(&block{kind: blockParagraph, text: strings.Join(para, "\n")})
+		}
+		i = j
+	}
+	return
+}
+
+// list parses the list starting with the item at line i
+func (p *parser) list(lines []string, i int, m listMarker) (*block, int) {
+	lst := &block{kind: blockList, ordered: m.ordered, start: m.start}
+	for {
+		first := lines[i]
+		item := []string{strings.Repeat(" ", m.offset) + first[min(m.offset, len(first)):]}
+		if m.offset > len(first) {
+			item[0] = ""
+		}
+		j := i + 1
+		for ; j < len(lines); j++ {
+			l := lines[j]
+			switch {
+			case blank(l):
+				if m.empty && len(item) == 1 {
+					// an item can begin with at most one blank line
+					j = len(lines) + 1
+				} else {
+					item = append(item, "")
+				}
+				continue
+			case indent(l) >= m.offset:
+				item = append(item, l)
+				continue
+			case !blank(item[len(item)-1]) && !interrupts(l) && !ruleRe.MatchString(l) && !setextRe.MatchString(l):
+				// lazy continuation of a paragraph
+				if _, ok := parseMarker(l); !ok {
+					item = append(item, strings.Repeat(" ", m.offset)+strings.TrimLeft(l, " "))
+					continue
+				}
+			}
+			break
+		}
+		if j > len(lines) {
+			j = i + 1
+		}
+		trailing := 0
+		for len(item) > 1 && blank(item[len(item)-1]) {
+			item = item[:len(item)-1]
+			trailing++
+		}
+		for k := range item {
+			item[k] = unindent(item[k], m.offset)
+		}
+		it := &block{kind: blockItem, children: p.blocks(item)}
+		for _, c := range it.children[min(1, len(it.children)):] {
+			if c.blank {
+				lst.loose = true
+			}
+		}
+		lst.children = append(lst.children, it)
+		i = j
+		if i >= len(lines) || ruleRe.MatchString(lines[i]) {
+			break
+		}
+		next, ok := parseMarker(lines[i])
+		if !ok || next.ordered != m.ordered || next.delim != m.delim {
+			break
+		}
+		if trailing > 0 {
+			lst.loose = true
+		}
+		m = next
+	}
+	// blank lines ending the last item belong to the enclosing block
+	for i > 0 && blank(lines[i-1]) {
+		i--
+	}
+	return lst, i
+}
+
+// define records a link reference definition. The first definition of a
+// label takes precedence.
+func (p *parser) define(label, dest, title string) {
+	key := normalizeLabel(label)
+	if _, ok := p.refs[key]; ok {
+		return
+	}
+	if strings.HasPrefix(dest, "<") {
+		dest = dest[1 : len(dest)-1]
+	}
+	if title != "" {
+		title = title[1 : len(title)-1]
+	}
+	p.refs[key] = linkRef{dest: unescape(dest), title: unescape(title)}
+}
+
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// splitRow returns the cells of a table row
+func splitRow(line string) (cells []string) {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var b strings.Builder
+	for j := 0; j < len(line); j++ {
+		switch {
+		case line[j] == '\\' && j+1 < len(line) && line[j+1] == '|':
+			b.WriteByte('|')
+			j++
+		case line[j] == '|':
+			cells = append(cells, strings.TrimSpace(b.String()))
+			b.Reset()
+		default:
+			b.WriteByte(line[j])
+		}
+	}
+	return append(cells, strings.TrimSpace(b.String()))
+}
+
+// tableAlign returns the alignment of each column of a delimiter row
+func tableAlign(line string) (list []string) {
+	for _, cell := range splitRow(line) {
+		left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+		switch {
+		case left && right:
+			list = append(list, "center")
+		case right:
+			list = append(list, "right")
+		case left:
+			list = append(list, "left")
+		default:
+			list = append(list, "")
+		}
+	}
+	return
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
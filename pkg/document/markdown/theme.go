@@ -0,0 +1,161 @@
+package markdown
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bhojpur/render/pkg/document"
+)
+
+// HeadingStyle holds the appearance of a heading level. Sizes and spacing are
+// in points.
+type HeadingStyle struct {
+	FontSize     float64
+	Bold, Italic bool
+	Color        document.RGBType
+	SpaceBefore  float64
+	SpaceAfter   float64
+	// Rule draws a line in the rule color below the heading
+	Rule bool
+}
+
+// Theme holds the styling of a rendered Markdown document. Font sizes,
+// widths and spacing are in points. Font families must be core fonts or
+// fonts added to the document before rendering; when the body font is a
+// Unicode font, core fonts selected for code are replaced by it.
+type Theme struct {
+	FontFamily string
+	FontSize   float64
+	// LineHeight is the height of a line as a multiple of the font size
+	LineHeight float64
+	TextColor  document.RGBType
+	// ParagraphSpacing is the space below paragraphs, lists, tables, code
+	// blocks and block quotes
+	ParagraphSpacing float64
+	// Headings holds the styles of the heading levels one to six
+	Headings         [6]HeadingStyle
+	CodeFontFamily   string
+	CodeFontSize     float64
+	CodeColor        document.RGBType
+	CodeBackground   document.RGBType
+	CodePadding      float64
+	LinkColor        document.RGBType
+	LinkUnderline    bool
+	QuoteColor       document.RGBType
+	QuoteBarColor    document.RGBType
+	QuoteBarWidth    float64
+	QuoteIndent      float64
+	ListIndent       float64
+	RuleColor        document.RGBType
+	RuleWidth        float64
+	TableBorderColor document.RGBType
+	TableHeaderFill  document.RGBType
+	TablePadding     float64
+	// StyleSheet holds additional CSS rules for the elements of the HTML the
+	// document is converted to
+	StyleSheet string
+}
+
+// DefaultTheme returns a theme resembling the way Markdown is commonly
+// presented on the web.
+func DefaultTheme() *Theme {
+	gray := document.RGBType{R: 36, G: 41, B: 47}
+	return &Theme{
+		FontFamily:       "Helvetica",
+		FontSize:         10.5,
+		LineHeight:       1.4,
+		TextColor:        gray,
+		ParagraphSpacing: 8,
+		Headings: [6]HeadingStyle{
+			{FontSize: 22, Bold: true, Color: gray, SpaceBefore: 18, SpaceAfter: 10, Rule: true},
+			{FontSize: 17, Bold: true, Color: gray, SpaceBefore: 16, SpaceAfter: 8, Rule: true},
+			{FontSize: 14, Bold: true, Color: gray, SpaceBefore: 14, SpaceAfter: 6},
+			{FontSize: 12, Bold: true, Color: gray, SpaceBefore: 12, SpaceAfter: 6},
+			{FontSize: 10.5, Bold: true, Color: gray, SpaceBefore: 10, SpaceAfter: 4},
+			{FontSize: 10.5, Bold: true, Color: document.RGBType{R: 87, G: 96, B: 106}, SpaceBefore: 10, SpaceAfter: 4},
+		},
+		CodeFontFamily:   "Courier",
+		CodeFontSize:     9,
+		CodeColor:        gray,
+		CodeBackground:   document.RGBType{R: 246, G: 248, B: 250},
+		CodePadding:      6,
+		LinkColor:        document.RGBType{R: 9, G: 105, B: 218},
+		QuoteColor:       document.RGBType{R: 87, G: 96, B: 106},
+		QuoteBarColor:    document.RGBType{R: 208, G: 215, B: 222},
+		QuoteBarWidth:    3,
+		QuoteIndent:      10,
+		ListIndent:       18,
+		RuleColor:        document.RGBType{R: 208, G: 215, B: 222},
+		RuleWidth:        1,
+		TableBorderColor: document.RGBType{R: 208, G: 215, B: 222},
+		TableHeaderFill:  document.RGBType{R: 246, G: 248, B: 250},
+		TablePadding:     4,
+	}
+}
+
+func cssColor(c document.RGBType) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R&255, c.G&255, c.B&255)
+}
+
+// styleSheet returns the CSS rules of the theme
+func (t *Theme) styleSheet() string {
+	var b strings.Builder
+	space := t.ParagraphSpacing
+	fmt.Fprintf(&b, "p, ul, ol, pre, blockquote, table { margin: 0 0 %.2fpt 0 }\n", space)
+	b.WriteString("li ul, li ol, .last { margin-bottom: 0 }\n")
+	fmt.Fprintf(&b, "ul, ol { padding-left: %.2fpt }\n", t.ListIndent)
+	for j, h := range t.Headings {
+		weight, style := "normal", "normal"
+		if h.Bold {
+			weight = "bold"
+		}
+		if h.Italic {
+			style = "italic"
+		}
+		fmt.Fprintf(&b, "h%d { font-size: %.2fpt; font-weight: %s; font-style: %s; color: %s; margin: %.2fpt 0 %.2fpt 0",
+			j+1, h.FontSize, weight, style, cssColor(h.Color), h.SpaceBefore, h.SpaceAfter)
+		if h.Rule {
+			fmt.Fprintf(&b, "; padding-bottom: %.2fpt; border-bottom: %.2fpt solid %s",
+				h.FontSize/6, t.RuleWidth, cssColor(t.RuleColor))
+		}
+		b.WriteString(" }\n")
+	}
+	fmt.Fprintf(&b, "pre { font-family: %s; font-size: %.2fpt; color: %s; background-color: %s; padding: %.2fpt }\n",
+		t.CodeFontFamily, t.CodeFontSize, cssColor(t.CodeColor), cssColor(t.CodeBackground), t.CodePadding)
+	fmt.Fprintf(&b, "code { font-family: %s; font-size: %.3fem; color: %s; background-color: %s }\n",
+		t.CodeFontFamily, t.CodeFontSize/t.FontSize, cssColor(t.CodeColor), cssColor(t.CodeBackground))
+	decoration := "none"
+	if t.LinkUnderline {
+		decoration = "underline"
+	}
+	fmt.Fprintf(&b, "a { color: %s; text-decoration: %s }\n", cssColor(t.LinkColor), decoration)
+	fmt.Fprintf(&b, "blockquote { color: %s; padding-left: %.2fpt; border-left: %.2fpt solid %s }\n",
+		cssColor(t.QuoteColor), t.QuoteIndent, t.QuoteBarWidth, cssColor(t.QuoteBarColor))
+	fmt.Fprintf(&b, "hr { margin: %.2fpt 0; border-top: %.2fpt solid %s }\n",
+		space, t.RuleWidth, cssColor(t.RuleColor))
+	fmt.Fprintf(&b, "th, td { border: 0.75pt solid %s; padding: %.2fpt }\n",
+		cssColor(t.TableBorderColor), t.TablePadding)
+	fmt.Fprintf(&b, "th { font-weight: bold; text-align: left; background-color: %s }\n", cssColor(t.TableHeaderFill))
+	b.WriteString(t.StyleSheet)
+	return b.String()
+}
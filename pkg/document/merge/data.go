@@ -0,0 +1,147 @@
+package merge
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Record holds the fields of a data record. Values read from JSON keep
+// their structure: nested objects are maps and arrays are slices.
+type Record map[string]interface{}
+
+// placeholderRe matches the placeholders of a text
+var placeholderRe = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+// ReadCSV reads records from CSV data whose first line holds the names of
+// the fields.
+func ReadCSV(r io.Reader) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("CSV data has no header line")
+	}
+	header := rows[0]
+	list := make([]Record, 0, len(rows)-1)
+	for j, row := range rows[1:] {
+		if len(row) > len(header) {
+			return nil, fmt.Errorf("line %d has %d fields, the header %d", j+2, len(row), len(header))
+		}
+		rec := make(Record, len(header))
+		for k, name := range header {
+			if k < len(row) {
+				rec[strings.TrimSpace(name)] = row[k]
+			} else {
+				rec[strings.TrimSpace(name)] = ""
+			}
+		}
+		list = append(list, rec)
+	}
+	return list, nil
+}
+
+// ReadJSON reads records from a JSON array of objects.
+func ReadJSON(r io.Reader) ([]Record, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var list []Record
+	if err := dec.Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid JSON records: %w", err)
+	}
+	return list, nil
+}
+
+// lookup returns the value of the dotted field path in the first scope that
+// holds it
+func lookup(path string, scopes []interface{}) (interface{}, bool) {
+	for _, scope := range scopes {
+		val, ok := scope, true
+		for _, key := range strings.Split(path, ".") {
+			switch v := val.(type) {
+			case Record:
+				val, ok = v[key]
+			case map[string]interface{}:
+				val, ok = v[key]
+			case []interface{}:
+				k, err := strconv.Atoi(key)
+				ok = err == nil && k >= 0 && k < len(v)
+				if ok {
+					val = v[k]
+				}
+			default:
+				ok = false
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// format returns the text of a field value
+func format(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	}
+	return fmt.Sprint(val)
+}
+
+// expand replaces the placeholders of s with the values of the fields they
+// name. num is the number of the record.
+func expand(s string, num int, scopes ...interface{}) (string, error) {
+	var err error
+	out := placeholderRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := placeholderRe.FindStringSubmatch(m)[1]
+		if name == "#" {
+			return strconv.Itoa(num)
+		}
+		val, ok := lookup(name, scopes)
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("field %q not found", name)
+			}
+			return ""
+		}
+		return format(val)
+	})
+	return out, err
+}
@@ -0,0 +1,314 @@
+// Package merge generates PDF documents from a declarative layout and a
+// dataset, in the manner of a mail merge.
+//
+// A layout describes pages holding positioned elements: text, images,
+// tables, barcodes, lines and rectangles. Text, image paths, barcode values
+// and table cells may contain placeholders of the form {{field}} that are
+// replaced by the values of a record. Fields of nested JSON objects are
+// addressed as {{customer.name}} and elements of arrays as {{items.0}}. The
+// placeholder {{#}} stands for the number of the record, starting at 1.
+//
+// Layouts are written in YAML or JSON, for example:
+//
+//	size: A4
+//	font: {family: Helvetica, size: 11}
+//	pages:
+//	  - elements:
+//	      - {type: text, x: 20, y: 30, width: 120, text: "Dear {{name}},"}
+//	      - {type: barcode, symbology: qr, x: 160, y: 20, width: 30, value: "{{id}}"}
+//	      - type: table
+//	        x: 20
+//	        y: 60
+//	        rows: items
+//	        columns:
+//	          - {header: Item, text: "{{title}}"}
+//	          - {header: Price, text: "{{price}}", width: 30, align: R}
+//
+// Records are read from CSV files, whose first line names the fields, or
+// from JSON arrays of objects.
+package merge
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bhojpur/render/pkg/document"
+	"gopkg.in/yaml.v2"
+)
+
+// Font selects a font. Empty fields take the value of the layout font.
+type Font struct {
+	Family string  `yaml:"family" json:"family"`
+	Style  string  `yaml:"style" json:"style"`
+	Size   float64 `yaml:"size" json:"size"`
+}
+
+// FontFile is a UTF-8 font to be added to the documents. File is a path to a
+// TrueType font, relative to the directory of the layout.
+type FontFile struct {
+	Family string `yaml:"family" json:"family"`
+	Style  string `yaml:"style" json:"style"`
+	File   string `yaml:"file" json:"file"`
+}
+
+// Column is a column of a table element. Text is the content of the cells
+// of the column, Width a fixed width in user units or zero to size the column
+// from its content.
+type Column struct {
+	Header string  `yaml:"header" json:"header"`
+	Text   string  `yaml:"text" json:"text"`
+	Width  float64 `yaml:"width" json:"width"`
+	Align  string  `yaml:"align" json:"align"`
+}
+
+// Element is a positioned item of a page. Its coordinates and dimensions are
+// in the unit of the layout. The fields that apply depend on Type:
+//
+// "text" prints Text with Font, Color, Align ("L", "C" or "R"), Border and
+// Fill. Text wraps within Width, or up to the right margin when Width is
+// zero, with lines LineHeight apart. A text with a Height is printed on a
+// single line centered vertically in a cell of that height.
+//
+// "image" places the image file Src. A zero Width or Height is derived from
+// the proportions of the image.
+//
+// "barcode" draws Value with the Symbology "code128" or "qr". A QR code is a
+// square of size Width with the error correction Level "L", "M", "Q" or "H".
+//
+// "table" draws a table of Columns with a header row when a column has a
+// header. Rows names an array field of the record; its elements are objects
+// whose fields the column texts refer to in addition to those of the record.
+// Without Rows the table has a single row. Fill is the background of the
+// header row.
+//
+// "line" draws a line from (X, Y) to (X+Width, Y+Height) and "rect" a
+// rectangle, both with Color and LineWidth. A rectangle is filled when Fill
+// is set.
+type Element struct {
+	Type       string   `yaml:"type" json:"type"`
+	X          float64  `yaml:"x" json:"x"`
+	Y          float64  `yaml:"y" json:"y"`
+	Width      float64  `yaml:"width" json:"width"`
+	Height     float64  `yaml:"height" json:"height"`
+	Text       string   `yaml:"text" json:"text"`
+	Font       Font     `yaml:"font" json:"font"`
+	Color      string   `yaml:"color" json:"color"`
+	Fill       string   `yaml:"fill" json:"fill"`
+	Align      string   `yaml:"align" json:"align"`
+	Border     string   `yaml:"border" json:"border"`
+	LineHeight float64  `yaml:"lineHeight" json:"lineHeight"`
+	LineWidth  float64  `yaml:"lineWidth" json:"lineWidth"`
+	Src        string   `yaml:"src" json:"src"`
+	Symbology  string   `yaml:"symbology" json:"symbology"`
+	Value      string   `yaml:"value" json:"value"`
+	Level      string   `yaml:"level" json:"level"`
+	Rows       string   `yaml:"rows" json:"rows"`
+	Columns    []Column `yaml:"columns" json:"columns"`
+}
+
+// Page is a page of the layout. The elements are drawn in order; elements
+// following a table that continues on further pages are drawn on the last of
+// them.
+type Page struct {
+	Elements []Element `yaml:"elements" json:"elements"`
+}
+
+// Margins are the page margins in the unit of the layout. Text and tables
+// that reach the bottom margin continue on a new page.
+type Margins struct {
+	Left   float64 `yaml:"left" json:"left"`
+	Top    float64 `yaml:"top" json:"top"`
+	Right  float64 `yaml:"right" json:"right"`
+	Bottom float64 `yaml:"bottom" json:"bottom"`
+}
+
+// Layout describes the pages generated for each record. Orientation, Unit
+// and Size are those of document.New() and default to "P", "mm" and "A4";
+// a nonzero Width and Height select a custom page size instead of Size.
+type Layout struct {
+	Orientation string     `yaml:"orientation" json:"orientation"`
+	Unit        string     `yaml:"unit" json:"unit"`
+	Size        string     `yaml:"size" json:"size"`
+	Width       float64    `yaml:"width" json:"width"`
+	Height      float64    `yaml:"height" json:"height"`
+	Margins     Margins    `yaml:"margins" json:"margins"`
+	Font        Font       `yaml:"font" json:"font"`
+	Fonts       []FontFile `yaml:"fonts" json:"fonts"`
+	Pages       []Page     `yaml:"pages" json:"pages"`
+	// BaseDir is the directory relative font and image paths are resolved
+	// against. LoadLayout sets it to the directory of the layout file.
+	BaseDir string `yaml:"-" json:"-"`
+	once    sync.Once
+	err     error
+	fonts   map[string][]byte
+	images  map[string][]byte
+	unicode map[string]bool
+}
+
+// ParseLayout reads a layout in YAML or JSON format.
+func ParseLayout(data []byte) (*Layout, error) {
+	l := new(Layout)
+	if err := yaml.UnmarshalStrict(data, l); err != nil {
+		return nil, fmt.Errorf("invalid layout: %w", err)
+	}
+	if err := l.check(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// LoadLayout reads a layout file in YAML or JSON format.
+func LoadLayout(fileStr string) (*Layout, error) {
+	data, err := os.ReadFile(fileStr)
+	if err != nil {
+		return nil, err
+	}
+	l, err := ParseLayout(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileStr, err)
+	}
+	l.BaseDir = filepath.Dir(fileStr)
+	return l, nil
+}
+
+// check validates the layout and fills in defaults
+func (l *Layout) check() error {
+	if l.Orientation == "" {
+		l.Orientation = "P"
+	}
+	if l.Unit == "" {
+		l.Unit = "mm"
+	}
+	if l.Size == "" {
+		l.Size = "A4"
+	}
+	if l.Font.Family == "" {
+		l.Font.Family = "Helvetica"
+	}
+	if l.Font.Size <= 0 {
+		l.Font.Size = 11
+	}
+	if len(l.Pages) == 0 {
+		return fmt.Errorf("layout has no pages")
+	}
+	for p, page := range l.Pages {
+		for j, e := range page.Elements {
+			where := fmt.Sprintf("page %d, element %d", p+1, j+1)
+			for _, c := range []string{e.Color, e.Fill} {
+				if _, ok := parseColor(c); !ok && c != "" {
+					return fmt.Errorf("%s: invalid color %q", where, c)
+				}
+			}
+			switch e.Type {
+			case "text", "line", "rect":
+			case "image":
+				if e.Src == "" {
+					return fmt.Errorf("%s: image has no src", where)
+				}
+			case "barcode":
+				switch strings.ToLower(e.Symbology) {
+				case "code128", "qr":
+				default:
+					return fmt.Errorf("%s: unknown symbology %q", where, e.Symbology)
+				}
+				if e.Width <= 0 || (e.Height <= 0 && strings.ToLower(e.Symbology) != "qr") {
+					return fmt.Errorf("%s: barcode has no size", where)
+				}
+			case "table":
+				if len(e.Columns) == 0 {
+					return fmt.Errorf("%s: table has no columns", where)
+				}
+			default:
+				return fmt.Errorf("%s: unknown element type %q", where, e.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// prepare checks the layout and reads the font files and the images whose
+// path holds no placeholder. It runs once for each layout.
+func (l *Layout) prepare() error {
+	l.once.Do(func() {
+		if l.err = l.check(); l.err != nil {
+			return
+		}
+		l.fonts = make(map[string][]byte)
+		l.unicode = make(map[string]bool)
+		for _, f := range l.Fonts {
+			data, err := os.ReadFile(l.path(f.File))
+			if err != nil {
+				l.err = err
+				return
+			}
+			l.fonts[f.File] = data
+			l.unicode[strings.ToLower(f.Family)] = true
+		}
+		l.images = make(map[string][]byte)
+		for _, page := range l.Pages {
+			for _, e := range page.Elements {
+				if e.Type != "image" || placeholderRe.MatchString(e.Src) {
+					continue
+				}
+				if _, ok := l.images[e.Src]; !ok {
+					data, err := os.ReadFile(l.path(e.Src))
+					if err != nil {
+						l.err = err
+						return
+					}
+					l.images[e.Src] = data
+				}
+			}
+		}
+	})
+	return l.err
+}
+
+// parseColor converts a color of the form #rrggbb or #rgb
+func parseColor(s string) (c document.RGBType, ok bool) {
+	if !strings.HasPrefix(s, "#") || (len(s) != 7 && len(s) != 4) {
+		return
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return
+	}
+	if len(s) == 4 {
+		c.R, c.G, c.B = int(v>>8&15)*17, int(v>>4&15)*17, int(v&15)*17
+	} else {
+		c.R, c.G, c.B = int(v>>16&255), int(v>>8&255), int(v&255)
+	}
+	return c, true
+}
+
+// path resolves a path relative to the directory of the layout
+func (l *Layout) path(fileStr string) string {
+	if l.BaseDir == "" || filepath.IsAbs(fileStr) {
+		return fileStr
+	}
+	return filepath.Join(l.BaseDir, fileStr)
+}
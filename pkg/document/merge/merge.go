@@ -0,0 +1,384 @@
+package merge
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/bhojpur/render/pkg/document"
+)
+
+// resolved is an element whose placeholders have been replaced by the values
+// of a record
+type resolved struct {
+	*Element
+	text, src, value string
+	image            []byte
+	header           []string
+	rows             [][]string
+}
+
+// resolve replaces the placeholders of the elements of all pages with the
+// fields of rec, num being the number of the record, and reads the images
+// that depend on the record
+func (l *Layout) resolve(num int, rec Record) (pages [][]resolved, err error) {
+	for p := range l.Pages {
+		page := &l.Pages[p]
+		list := make([]resolved, len(page.Elements))
+		for j := range page.Elements {
+			e := &page.Elements[j]
+			r := resolved{Element: e}
+			if r.text, err = expand(e.Text, num, rec); err != nil {
+				return
+			}
+			if r.value, err = expand(e.Value, num, rec); err != nil {
+				return
+			}
+			if r.src, err = expand(e.Src, num, rec); err != nil {
+				return
+			}
+			if e.Type == "image" {
+				if data, ok := l.images[r.src]; ok {
+					r.image = data
+				} else if r.image, err = os.ReadFile(l.path(r.src)); err != nil {
+					return
+				}
+			}
+			if e.Type == "table" {
+				if err = r.table(num, rec); err != nil {
+					return
+				}
+			}
+			list[j] = r
+		}
+		pages = append(pages, list)
+	}
+	return
+}
+
+// table fills in the header and the rows of a table element
+func (r *resolved) table(num int, rec Record) error {
+	for _, c := range r.Columns {
+		if c.Header != "" {
+			r.header = make([]string, len(r.Columns))
+			break
+		}
+	}
+	for k, c := range r.Columns {
+		if r.header != nil {
+			h, err := expand(c.Header, num, rec)
+			if err != nil {
+				return err
+			}
+			r.header[k] = h
+		}
+	}
+	items := []interface{}{nil}
+	if r.Rows != "" {
+		val, ok := lookup(r.Rows, []interface{}{rec})
+		if list, isList := val.([]interface{}); ok && isList {
+			items = list
+		} else if !ok {
+			return fmt.Errorf("field %q not found", r.Rows)
+		} else {
+			return fmt.Errorf("field %q is not an array", r.Rows)
+		}
+	}
+	for _, item := range items {
+		row := make([]string, len(r.Columns))
+		for k, c := range r.Columns {
+			scopes := []interface{}{rec}
+			if item != nil {
+				scopes = []interface{}{item, rec}
+			}
+			txt, err := expand(c.Text, num, scopes...)
+			if err != nil {
+				return err
+			}
+			row[k] = txt
+		}
+		r.rows = append(r.rows, row)
+	}
+	return nil
+}
+
+// newDocument returns an empty document set up as specified by the layout
+func (l *Layout) newDocument() *document.Bdf {
+	init := &document.InitType{OrientationStr: l.Orientation, UnitStr: l.Unit, SizeStr: l.Size}
+	if l.Width > 0 && l.Height > 0 {
+		init.Size = document.SizeType{Wd: l.Width, Ht: l.Height}
+	}
+	pdf := document.NewCustom(init)
+	for _, f := range l.Fonts {
+		pdf.AddUTF8FontFromBytes(f.Family, f.Style, l.fonts[f.File])
+	}
+	m := l.Margins
+	if m != (Margins{}) {
+		pdf.SetMargins(m.Left, m.Top, m.Right)
+		pdf.SetAutoPageBreak(true, m.Bottom)
+	}
+	pdf.SetFont(l.Font.Family, l.Font.Style, l.Font.Size)
+	return pdf
+}
+
+// draw adds the pages of a resolved record to pdf
+func (l *Layout) draw(pdf *document.Bdf, pages [][]resolved) {
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	lineWd := pdf.GetLineWidth()
+	for _, page := range pages {
+		pdf.AddPage()
+		for _, e := range page {
+			l.drawElement(pdf, e, tr, lineWd)
+		}
+	}
+}
+
+// drawElement draws an element at its position on the current page
+func (l *Layout) drawElement(pdf *document.Bdf, e resolved, tr func(string) string, lineWd float64) {
+	font := e.Font
+	if font.Family == "" {
+		font.Family = l.Font.Family
+		if font.Style == "" {
+			font.Style = l.Font.Style
+		}
+	}
+	if font.Size <= 0 {
+		font.Size = l.Font.Size
+	}
+	pdf.SetFont(font.Family, font.Style, font.Size)
+	encode := func(s string) string {
+		if l.unicode[strings.ToLower(font.Family)] {
+			return s
+		}
+		return tr(s)
+	}
+	color, _ := parseColor(e.Color)
+	fillColor, fill := parseColor(e.Fill)
+	pdf.SetTextColor(color.R, color.G, color.B)
+	pdf.SetDrawColor(color.R, color.G, color.B)
+	pdf.SetFillColor(fillColor.R, fillColor.G, fillColor.B)
+	if e.LineWidth > 0 {
+		pdf.SetLineWidth(e.LineWidth)
+	} else {
+		pdf.SetLineWidth(lineWd)
+	}
+	align := strings.ToUpper(e.Align)
+	switch e.Type {
+	case "text":
+		pdf.SetXY(e.X, e.Y)
+		if e.Height > 0 {
+			pdf.CellFormat(e.Width, e.Height, encode(e.text), e.Border, 0, align, fill, 0, "")
+			break
+		}
+		lineHt := e.LineHeight
+		if lineHt <= 0 {
+			lineHt = pdf.PointConvert(font.Size) * 1.2
+		}
+		pdf.MultiCell(e.Width, lineHt, encode(e.text), e.Border, align, fill)
+	case "image":
+		tp := strings.TrimPrefix(strings.ToLower(filepath.Ext(e.src)), ".")
+		options := document.ImageOptions{ImageType: tp}
+		pdf.RegisterImageOptionsReader(e.src, options, bytes.NewReader(e.image))
+		pdf.ImageOptions(e.src, e.X, e.Y, e.Width, e.Height, false, options, 0, "")
+	case "barcode":
+		pdf.SetFillColor(color.R, color.G, color.B)
+		if strings.ToLower(e.Symbology) == "qr" {
+			pdf.BarcodeQR(e.X, e.Y, e.Width, e.value, e.Level)
+		} else {
+			pdf.BarcodeCode128(e.X, e.Y, e.Width, e.Height, e.value)
+		}
+	case "table":
+		cols := make([]document.TableColumnType, len(e.Columns))
+		for k, c := range e.Columns {
+			cols[k] = document.TableColumnType{Width: c.Width, Align: strings.ToUpper(c.Align)}
+		}
+		tbl := document.NewTable(cols...)
+		tbl.Width = e.Width
+		tbl.LineHeight = e.LineHeight
+		tbl.HeaderStyle.TextColor, tbl.BodyStyle.TextColor = color, color
+		tbl.HeaderStyle.BorderColor, tbl.BodyStyle.BorderColor = color, color
+		if fill {
+			tbl.HeaderStyle.Fill = &fillColor
+		}
+		if e.header != nil {
+			tbl.HeaderRows = 1
+			tbl.AddTextRow(encodeAll(e.header, encode)...)
+		}
+		for _, row := range e.rows {
+			tbl.AddTextRow(encodeAll(row, encode)...)
+		}
+		pdf.SetXY(e.X, e.Y)
+		tbl.Draw(pdf)
+	case "line":
+		pdf.Line(e.X, e.Y, e.X+e.Width, e.Y+e.Height)
+	case "rect":
+		style := "D"
+		if fill {
+			style = "FD"
+		}
+		pdf.Rect(e.X, e.Y, e.Width, e.Height, style)
+	}
+}
+
+func encodeAll(list []string, encode func(string) string) []string {
+	out := make([]string, len(list))
+	for j, s := range list {
+		out[j] = encode(s)
+	}
+	return out
+}
+
+// Render returns the document generated for a single record.
+func (l *Layout) Render(rec Record) (*document.Bdf, error) {
+	return l.render(0, rec)
+}
+
+// render generates the document of record j
+func (l *Layout) render(j int, rec Record) (*document.Bdf, error) {
+	if err := l.prepare(); err != nil {
+		return nil, err
+	}
+	pages, err := l.resolve(j+1, rec)
+	if err != nil {
+		return nil, fmt.Errorf("record %d: %w", j+1, err)
+	}
+	pdf := l.newDocument()
+	l.draw(pdf, pages)
+	if pdf.Err() {
+		return nil, fmt.Errorf("record %d: %w", j+1, pdf.Error())
+	}
+	return pdf, nil
+}
+
+// Merge returns a single document holding the pages of all records in
+// order. The records are resolved by at most workers goroutines, zero
+// selecting the number of CPUs, and then drawn one after another.
+func (l *Layout) Merge(records []Record, workers int) (*document.Bdf, error) {
+	if err := l.prepare(); err != nil {
+		return nil, err
+	}
+	all := make([][][]resolved, len(records))
+	err := run(len(records), workers, func(j int) (err error) {
+		all[j], err = l.resolve(j+1, records[j])
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	pdf := l.newDocument()
+	for j, pages := range all {
+		l.draw(pdf, pages)
+		if pdf.Err() {
+			return nil, fmt.Errorf("record %d: %w", j+1, pdf.Error())
+		}
+	}
+	return pdf, nil
+}
+
+// Generate renders a document for each record with at most workers
+// goroutines, zero selecting the number of CPUs, and passes it to fnc
+// together with the index of the record. fnc is called concurrently. The
+// first error returned by fnc or met while rendering stops the generation
+// and is returned.
+func (l *Layout) Generate(records []Record, workers int, fnc func(index int, pdf *document.Bdf) error) error {
+	if err := l.prepare(); err != nil {
+		return err
+	}
+	return run(len(records), workers, func(j int) error {
+		pdf, err := l.render(j, records[j])
+		if err != nil {
+			return err
+		}
+		if err = fnc(j, pdf); err != nil {
+			return fmt.Errorf("record %d: %w", j+1, err)
+		}
+		return nil
+	})
+}
+
+// WriteFiles writes a document for each record to the file named by
+// pathTemplate, in which placeholders are replaced by the fields of the
+// record, for example "out/invoice-{{id}}.pdf" or "letter-{{#}}.pdf".
+// Missing directories are created.
+func (l *Layout) WriteFiles(records []Record, workers int, pathTemplate string) error {
+	return l.Generate(records, workers, func(j int, pdf *document.Bdf) error {
+		fileStr, err := expand(pathTemplate, j+1, records[j])
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(fileStr), 0755); err != nil {
+			return err
+		}
+		return pdf.OutputFileAndClose(fileStr)
+	})
+}
+
+// run calls job for the indexes 0 to n-1 with a pool of workers goroutines.
+// After the first error no further jobs are started; the error of the
+// lowest index is returned.
+func run(n, workers int, job func(j int) error) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > n {
+		workers = n
+	}
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		first  error
+		failed = -1
+	)
+	jobs := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := job(j); err != nil {
+					mu.Lock()
+					if failed < 0 || j < failed {
+						first, failed = err, j
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for j := 0; j < n; j++ {
+		mu.Lock()
+		stop := failed >= 0
+		mu.Unlock()
+		if stop {
+			break
+		}
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+	return first
+}
@@ -0,0 +1,219 @@
+package merge
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bhojpur/render/pkg/document"
+)
+
+const testLayout = `
+size: A5
+margins: {left: 15, top: 15, right: 15, bottom: 15}
+pages:
+  - elements:
+      - {type: rect, x: 10, y: 10, width: 128, height: 20, fill: "#eef"}
+      - {type: image, x: 12, y: 12, width: 16, src: "{{logo}}"}
+      - {type: text, x: 30, y: 15, width: 80, text: "Invoice {{#}} for {{customer.name}}"}
+      - {type: barcode, symbology: qr, x: 115, y: 11, width: 18, value: "INV-{{id}}"}
+      - {type: barcode, symbology: code128, x: 15, y: 35, width: 60, height: 10, value: "{{id}}"}
+      - type: table
+        x: 15
+        y: 50
+        rows: items
+        fill: "#ddd"
+        columns:
+          - {header: Item, text: "{{title}}"}
+          - {header: Price, text: "{{price}}", width: 30, align: R}
+      - {type: line, x: 15, y: 190, width: 118, height: 0, color: "#888"}
+`
+
+const testData = `[
+	{"id": "1001", "logo": "logo.png", "customer": {"name": "Ada"},
+	 "items": [{"title": "Pen", "price": 2.5}, {"title": "Ink", "price": 4}]},
+	{"id": "1002", "logo": "logo.png", "customer": {"name": "Grace"},
+	 "items": [{"title": "Paper", "price": 7}]}
+]`
+
+// writeLogo writes a small PNG image to dir
+func writeLogo(t *testing.T, dir string) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for j := 0; j < 8; j++ {
+		img.Set(j, j, color.RGBA{200, 0, 0, 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "logo.png"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testSetup(t *testing.T) (*Layout, []Record) {
+	dir := t.TempDir()
+	writeLogo(t, dir)
+	l, err := ParseLayout([]byte(testLayout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.BaseDir = dir
+	records, err := ReadJSON(strings.NewReader(testData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, records
+}
+
+func TestReadCSV(t *testing.T) {
+	records, err := ReadCSV(strings.NewReader("id,name\n1,Ada\n2,\"Lovelace, Ada\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{{"id": "1", "name": "Ada"}, {"id": "2", "name": "Lovelace, Ada"}}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("got %v, want %v", records, want)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	records, err := ReadJSON(strings.NewReader(testData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ in, out string }{
+		{"{{ id }}/{{#}}", "1001/3"},
+		{"{{customer.name}}", "Ada"},
+		{"{{items.1.price}} {{items.0.title}}", "4 Pen"},
+		{"no fields", "no fields"},
+	} {
+		got, err := expand(tc.in, 3, records[0])
+		if err != nil {
+			t.Errorf("%q: %s", tc.in, err)
+		} else if got != tc.out {
+			t.Errorf("%q: got %q, want %q", tc.in, got, tc.out)
+		}
+	}
+	if _, err = expand("{{missing}}", 1, records[0]); err == nil {
+		t.Errorf("missing field was not reported")
+	}
+}
+
+func TestParseLayoutErrors(t *testing.T) {
+	for _, src := range []string{
+		"pages: []",
+		"pages: [{elements: [{type: circle}]}]",
+		"pages: [{elements: [{type: barcode, symbology: ean13, width: 10, height: 5}]}]",
+		"pages: [{elements: [{type: text, color: red}]}]",
+		"pages: [{elements: [{type: text, colour: \"#000\"}]}]",
+	} {
+		if _, err := ParseLayout([]byte(src)); err == nil {
+			t.Errorf("%s: no error", src)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	l, records := testSetup(t)
+	pdf, err := l.Render(records[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if pdf.PageCount() != 1 {
+		t.Fatalf("got %d pages, want 1", pdf.PageCount())
+	}
+	delete(records[1], "customer")
+	if _, err = l.Render(records[1]); err == nil || !strings.Contains(err.Error(), "customer.name") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	l, records := testSetup(t)
+	for j := 0; j < 20; j++ {
+		records = append(records, records[j%2])
+	}
+	pdf, err := l.Merge(records, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pdf.PageCount() != len(records) {
+		t.Fatalf("got %d pages, want %d", pdf.PageCount(), len(records))
+	}
+	var buf bytes.Buffer
+	if err = pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	l, records := testSetup(t)
+	var (
+		mu   sync.Mutex
+		seen = make(map[int]int)
+	)
+	err := l.Generate(records, 0, func(j int, pdf *document.Bdf) error {
+		var buf bytes.Buffer
+		if err := pdf.Output(&buf); err != nil {
+			return err
+		}
+		mu.Lock()
+		seen[j]++
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(records) || seen[0] != 1 || seen[1] != 1 {
+		t.Fatalf("records rendered %v", seen)
+	}
+	err = l.Generate(records, 2, func(j int, pdf *document.Bdf) error {
+		return fmt.Errorf("failed")
+	})
+	if err == nil || err.Error() != "record 1: failed" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	dir := t.TempDir()
+	if err = l.WriteFiles(records, 2, filepath.Join(dir, "out", "{{id}}.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1001", "1002"} {
+		if _, err = os.Stat(filepath.Join(dir, "out", id+".pdf")); err != nil {
+			t.Error(err)
+		}
+	}
+}
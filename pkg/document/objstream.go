@@ -0,0 +1,295 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// SetObjectStreams specifies whether the document is written with a
+// cross-reference stream and object streams, which are defined in PDF 1.5.
+// Objects other than streams are collected in compressed object streams,
+// which usually makes documents 20 to 40 percent smaller. The PDF version of
+// the document is raised to 1.5 if it is lower. Object streams cannot be
+// combined with linearization, protection, digital signatures or PDF/A-1.
+func (f *Bdf) SetObjectStreams(on bool) {
+	f.objStreams = on
+}
+
+// SetLinearization specifies whether the document is written linearized, or
+// optimized for fast web view, so that a viewer can display the first page
+// before the rest of the document has been downloaded. The objects of the
+// first page are written at the start of the file along with hint tables
+// that locate the objects of the other pages. Linearization cannot be
+// combined with object streams, protection or digital signatures.
+func (f *Bdf) SetLinearization(on bool) {
+	f.linearize = on
+}
+
+// rewriteOutput restructures the finished document in the buffer when object
+// streams or linearization have been requested
+func (f *Bdf) rewriteOutput() {
+	if f.err != nil || (!f.objStreams && !f.linearize) {
+		return
+	}
+	switch {
+	case f.objStreams && f.linearize:
+		f.err = fmt.Errorf("object streams cannot be combined with linearization")
+	case f.protect.encrypted:
+		f.err = fmt.Errorf("object streams and linearization cannot be combined with protection")
+	case f.sign.field != nil:
+		f.err = fmt.Errorf("object streams and linearization cannot be combined with a digital signature")
+	case f.objStreams && f.pdfa.level == PDFA1B:
+		f.err = fmt.Errorf("PDF/A-1 does not permit object streams")
+	}
+	if f.err != nil {
+		return
+	}
+	r, err := newPDFReader(append([]byte(nil), f.buffer.Bytes()...))
+	if err != nil {
+		f.err = err
+		return
+	}
+	var out []byte
+	if f.linearize {
+		out, err = f.linearizedOutput(r)
+	} else {
+		out, err = f.objStreamOutput(r)
+	}
+	if err != nil {
+		f.err = err
+		return
+	}
+	f.buffer.Reset()
+	f.buffer.Write(out)
+}
+
+// pdfObjectNumbers returns the numbers of the objects of a document in
+// ascending order
+func pdfObjectNumbers(r *PDFReader) (nums []int) {
+	for num, e := range r.xref {
+		if e.typ != 0 && num > 0 {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	return
+}
+
+// pdfHeader returns the header line and binary marker comment of a rewritten
+// document
+func (f *Bdf) pdfHeader(minVersion string) string {
+	version := f.pdfVersion
+	if version < minVersion {
+		version = minVersion
+	}
+	return "%PDF-" + version + "\n%\xe2\xe3\xcf\xd3\n"
+}
+
+// pdfWriteObject appends the PDF syntax of a direct object to b. The object
+// numbers of references are replaced with renum.
+func pdfWriteObject(b *bytes.Buffer, obj interface{}, renum func(int) int) {
+	switch v := obj.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case int:
+		b.WriteString(strconv.Itoa(v))
+	case float64:
+		b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case pdfName:
+		b.WriteString(formName(string(v)))
+	case pdfString:
+		binary := false
+		for _, c := range v {
+			if c < ' ' || c > '~' {
+				binary = true
+				break
+			}
+		}
+		if binary {
+			fmt.Fprintf(b, "<%X>", []byte(v))
+			break
+		}
+		b.WriteByte('(')
+		for _, c := range v {
+			if c == '(' || c == ')' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		}
+		b.WriteByte(')')
+	case pdfRef:
+		if num := renum(v.num); num > 0 {
+			fmt.Fprintf(b, "%d 0 R", num)
+		} else {
+			b.WriteString("null")
+		}
+	case pdfArray:
+		b.WriteByte('[')
+		for j, e := range v {
+			if j > 0 {
+				b.WriteByte(' ')
+			}
+			pdfWriteObject(b, e, renum)
+		}
+		b.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+		b.WriteString("<<")
+		for _, key := range keys {
+			b.WriteString(formName(key))
+			b.WriteByte(' ')
+			pdfWriteObject(b, v[pdfName(key)], renum)
+			b.WriteByte(' ')
+		}
+		b.WriteString(">>")
+	default:
+		b.WriteString("null")
+	}
+}
+
+// pdfWriteIndirect appends the indirect object num to b. The data of a
+// stream is copied as it is, still encoded.
+func pdfWriteIndirect(b *bytes.Buffer, num int, obj interface{}, renum func(int) int) {
+	fmt.Fprintf(b, "%d 0 obj\n", num)
+	if stm, ok := obj.(*pdfStream); ok {
+		dict := pdfDict{}
+		for key, val := range stm.dict {
+			dict[key] = val
+		}
+		dict["Length"] = len(stm.data)
+		pdfWriteObject(b, dict, renum)
+		b.WriteString("\nstream\n")
+		b.Write(stm.data)
+		b.WriteString("\nendstream")
+	} else {
+		pdfWriteObject(b, obj, renum)
+	}
+	b.WriteString("\nendobj\n")
+}
+
+// pdfKeepNumber is the renumbering function that leaves object numbers as
+// they are
+func pdfKeepNumber(num int) int {
+	return num
+}
+
+// objStreamOutput writes the objects of r with a cross-reference stream,
+// collecting objects other than streams in object streams. Object numbers
+// are kept.
+func (f *Bdf) objStreamOutput(r *PDFReader) ([]byte, error) {
+	const perStream = 100
+	nums := pdfObjectNumbers(r)
+	if len(nums) == 0 {
+		return nil, fmt.Errorf("document has no objects")
+	}
+	next := nums[len(nums)-1] + 1
+	type entry struct{ typ, field2, field3 int }
+	entries := map[int]entry{}
+	var b bytes.Buffer
+	b.WriteString(f.pdfHeader("1.5"))
+	var packed []int
+	for _, num := range nums {
+		obj := r.object(num)
+		if _, ok := obj.(*pdfStream); ok {
+			entries[num] = entry{1, b.Len(), 0}
+			pdfWriteIndirect(&b, num, obj, pdfKeepNumber)
+		} else {
+			packed = append(packed, num)
+		}
+	}
+	for start := 0; start < len(packed); start += perStream {
+		group := packed[start:]
+		if len(group) > perStream {
+			group = group[:perStream]
+		}
+		var head, body bytes.Buffer
+		for j, num := range group {
+			fmt.Fprintf(&head, "%d %d ", num, body.Len())
+			pdfWriteObject(&body, r.object(num), pdfKeepNumber)
+			body.WriteByte('\n')
+			entries[num] = entry{2, next, j}
+		}
+		data := append(head.Bytes(), body.Bytes()...)
+		mem := xmem.compress(data)
+		stm := &pdfStream{dict: pdfDict{"Type": pdfName("ObjStm"), "N": len(group), "First": head.Len(),
+			"Filter": pdfName("FlateDecode")}, data: mem.copy()}
+		mem.release()
+		entries[next] = entry{1, b.Len(), 0}
+		pdfWriteIndirect(&b, next, stm, pdfKeepNumber)
+		next++
+	}
+	// The cross-reference stream, which also lists itself
+	xrefNum := next
+	entries[xrefNum] = entry{1, b.Len(), 0}
+	size := xrefNum + 1
+	w2 := pdfByteWidth(b.Len())
+	w3 := pdfByteWidth(perStream)
+	var rows bytes.Buffer
+	for num := 0; num < size; num++ {
+		e, ok := entries[num]
+		if !ok {
+			e = entry{0, 0, 0}
+			if num == 0 {
+				e.field3 = 65535
+			}
+		}
+		rows.WriteByte(byte(e.typ))
+		pdfPutBytes(&rows, e.field2, w2)
+		pdfPutBytes(&rows, e.field3, w3)
+	}
+	mem := xmem.compress(rows.Bytes())
+	dict := pdfDict{"Type": pdfName("XRef"), "Size": size, "W": pdfArray{1, w2, w3},
+		"Filter": pdfName("FlateDecode")}
+	for _, key := range []pdfName{"Root", "Info", "ID"} {
+		if v, ok := r.trailer[key]; ok {
+			dict[key] = v
+		}
+	}
+	pdfWriteIndirect(&b, xrefNum, &pdfStream{dict: dict, data: mem.copy()}, pdfKeepNumber)
+	mem.release()
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", entries[xrefNum].field2)
+	return b.Bytes(), nil
+}
+
+// pdfByteWidth returns the number of bytes needed to store v
+func pdfByteWidth(v int) (n int) {
+	for n = 1; v > 255; n++ {
+		v >>= 8
+	}
+	return
+}
+
+// pdfPutBytes appends v to b as a big-endian number of n bytes
+func pdfPutBytes(b *bytes.Buffer, v, n int) {
+	for j := n - 1; j >= 0; j-- {
+		b.WriteByte(byte(v >> (8 * j)))
+	}
+}
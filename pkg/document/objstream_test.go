@@ -0,0 +1,184 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// objStreamTestDoc returns a document of several pages sharing fonts, with
+// links, bookmarks and a form field
+func objStreamTestDoc(t *testing.T, setup func(pdf *Bdf)) (*bytes.Buffer, error) {
+	t.Helper()
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCreationDate(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	pdf.SetTitle("Streams", true)
+	setup(pdf)
+	pdf.SetFont("Helvetica", "", 12)
+	for p := 1; p <= 4; p++ {
+		pdf.AddPage()
+		pdf.Bookmark("Page "+strconv.Itoa(p), 0, -1)
+		if p%2 == 0 {
+			pdf.SetFont("Times", "I", 14)
+		} else {
+			pdf.SetFont("Helvetica", "", 12)
+		}
+		pdf.MultiCell(0, 6, strings.Repeat("Lorem ipsum (dolor) sit amet. ", 40), "", "", false)
+		pdf.CellFormat(40, 10, "Link", "1", 1, "", false, 0, "https://example.com/"+strconv.Itoa(p))
+	}
+	var buf bytes.Buffer
+	err := pdf.Output(&buf)
+	return &buf, err
+}
+
+func TestObjectStreams(t *testing.T) {
+	plain, err := objStreamTestDoc(t, func(pdf *Bdf) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed, err := objStreamTestDoc(t, func(pdf *Bdf) { pdf.SetObjectStreams(true) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := packed.String()
+	if !strings.HasPrefix(s, "%PDF-1.5\n") {
+		t.Fatalf("header %q", s[:9])
+	}
+	for _, want := range []string{"/Type /ObjStm", "/Type /XRef"} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("output lacks %s", want)
+		}
+	}
+	if strings.Contains(s, "\nxref\n") || strings.Contains(s, "trailer") {
+		t.Fatal("classic cross-reference table written")
+	}
+	if packed.Len() >= plain.Len() {
+		t.Fatalf("object streams did not reduce size: %d >= %d", packed.Len(), plain.Len())
+	}
+	diff, err := DiffPDFs(bytes.NewReader(plain.Bytes()), bytes.NewReader(packed.Bytes()), PDFDiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) > 0 {
+		t.Fatalf("documents differ:\n%s", diff)
+	}
+}
+
+func TestLinearization(t *testing.T) {
+	plain, err := objStreamTestDoc(t, func(pdf *Bdf) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lin, err := objStreamTestDoc(t, func(pdf *Bdf) { pdf.SetLinearization(true) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := lin.Bytes()
+	head := string(data[:1024])
+	m := regexp.MustCompile(`(\d+) 0 obj\n<< /Linearized 1 /L (\d+) /H \[(\d+) (\d+)\] /O (\d+) /E (\d+) /N (\d+) /T (\d+) >>`).
+		FindStringSubmatch(head)
+	if m == nil {
+		t.Fatal("linearization dictionary not found at start of file")
+	}
+	num := func(j int) int {
+		v, _ := strconv.Atoi(m[j])
+		return v
+	}
+	if num(2) != len(data) {
+		t.Fatalf("/L %d, file length %d", num(2), len(data))
+	}
+	if num(7) != 4 {
+		t.Fatalf("/N %d", num(7))
+	}
+	if !bytes.HasPrefix(data[num(3)+num(4):], []byte(strconv.Itoa(num(5))+" 0 obj\n<<")) {
+		t.Fatal("first page object does not follow the hint stream")
+	}
+	if !bytes.HasPrefix(data[num(8):], []byte("\n0000000000 65535 f \n")) {
+		t.Fatal("/T does not locate the main cross-reference table")
+	}
+	if !bytes.Contains(data[:num(6)], []byte("/Type /Page ")) || bytes.Count(data[:num(6)], []byte("/Type /Page ")) != 1 {
+		t.Fatal("first page section should hold exactly one page")
+	}
+	r, err := newPDFReader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := r.xref[num(5)]; n.offset != num(3)+num(4) {
+		t.Fatalf("page object at %d", n.offset)
+	}
+	hint, ok := r.object(num(5) - 1).(*pdfStream)
+	if !ok {
+		t.Fatal("hint stream not found")
+	}
+	hdata, err := r.decode(hint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// least number of objects in a page and location of the first page
+	// without the hint stream
+	if loc := int(hdata[4])<<24 | int(hdata[5])<<16 | int(hdata[6])<<8 | int(hdata[7]); loc != num(3) {
+		t.Fatalf("first page location %d in hint table, want %d", loc, num(3))
+	}
+	if s, _ := hint.dict["S"].(int); s <= 36 || s >= len(hdata) {
+		t.Fatalf("shared object hint table at %d", s)
+	}
+	diff, err := DiffPDFs(bytes.NewReader(plain.Bytes()), bytes.NewReader(data), PDFDiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) > 0 {
+		t.Fatalf("documents differ:\n%s", diff)
+	}
+}
+
+func TestObjectStreamErrors(t *testing.T) {
+	for want, setup := range map[string]func(pdf *Bdf){
+		"combined with linearization": func(pdf *Bdf) {
+			pdf.SetObjectStreams(true)
+			pdf.SetLinearization(true)
+		},
+		"combined with protection": func(pdf *Bdf) {
+			pdf.SetProtection(0, "user", "owner")
+			pdf.SetLinearization(true)
+		},
+	} {
+		if _, err := objStreamTestDoc(t, setup); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error %q, got %v", want, err)
+		}
+	}
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetPDFA(PDFA1B)
+	pdf.SetObjectStreams(true)
+	pdf.AddUTF8FontFromBytes("go", "", goregular.TTF)
+	pdf.SetFont("go", "", 12)
+	pdf.AddPage()
+	pdf.Text(20, 20, "Archive")
+	if err := pdf.Output(&bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "PDF/A-1 does not permit") {
+		t.Fatalf("expected PDF/A-1 error, got %v", err)
+	}
+}
@@ -0,0 +1,1024 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"sort"
+	"strconv"
+)
+
+// This file holds a small OpenType layout engine: it reads the GDEF, GSUB
+// and GPOS tables of a TrueType font and applies their lookups to a buffer
+// of glyphs. The script specific logic that decides which features are
+// applied to which glyphs lives in shaping.go.
+
+// Lookup flags
+const (
+	otlRightToLeft         = 0x0001
+	otlIgnoreBaseGlyphs    = 0x0002
+	otlIgnoreLigatures     = 0x0004
+	otlIgnoreMarks         = 0x0008
+	otlUseMarkFilteringSet = 0x0010
+	otlMarkAttachmentType  = 0xFF00
+)
+
+// GDEF glyph classes
+const (
+	otlClassBase      = 1
+	otlClassLigature  = 2
+	otlClassMark      = 3
+	otlClassComponent = 4
+)
+
+// Attachment kinds recorded by GPOS lookups
+const (
+	otlAttachMark    = 1
+	otlAttachCursive = 2
+)
+
+// otLayout gives access to the layout tables of a font. Offsets are
+// absolute positions in data; zero means that the table is absent.
+type otLayout struct {
+	data            []byte
+	gsub            int
+	gpos            int
+	glyphClassDef   int
+	markAttachClass int
+	markGlyphSets   int
+	hmtx            int
+	numHMetrics     int
+	unitsPerEm      int
+	cmap            map[int]int   // rune to glyph
+	glyphRunes      map[int][]int // glyph to runes
+	lookups         map[int]*otLookup
+	features        map[[3]string][]int
+	substitutes     map[string]bool
+}
+
+type otLookup struct {
+	kind      int
+	flag      int
+	markSet   int
+	subtables []int
+	gpos      bool
+	mask      uint32
+}
+
+func (t *otLayout) u16(off int) int {
+	if off < 0 || off+2 > len(t.data) {
+		return 0
+	}
+	return int(t.data[off])<<8 | int(t.data[off+1])
+}
+
+func (t *otLayout) i16(off int) int {
+	return int(int16(t.u16(off)))
+}
+
+func (t *otLayout) u32(off int) int {
+	return t.u16(off)<<16 | t.u16(off+2)
+}
+
+func (t *otLayout) tag(off int) string {
+	if off < 0 || off+4 > len(t.data) {
+		return ""
+	}
+	return string(t.data[off : off+4])
+}
+
+// offset16 returns the absolute position of the table referenced by the
+// 16-bit offset stored at off relative to base, or zero for a null offset.
+func (t *otLayout) offset16(base, off int) int {
+	if v := t.u16(off); v != 0 {
+		return base + v
+	}
+	return 0
+}
+
+// advance returns the horizontal advance of gid in font units.
+func (t *otLayout) advance(gid int) int {
+	if t.numHMetrics == 0 {
+		return 0
+	}
+	if gid >= t.numHMetrics {
+		gid = t.numHMetrics - 1
+	}
+	return t.u16(t.hmtx + 4*gid)
+}
+
+// glyphClass returns the GDEF class of gid, or zero when the font has no
+// glyph class definitions.
+func (t *otLayout) glyphClass(gid int) int {
+	if t.glyphClassDef == 0 {
+		return 0
+	}
+	return t.classOf(t.glyphClassDef, gid)
+}
+
+// coverage returns the coverage index of gid in the coverage table at off,
+// or -1 when gid is not covered.
+func (t *otLayout) coverage(off, gid int) int {
+	if off == 0 {
+		return -1
+	}
+	switch t.u16(off) {
+	case 1:
+		n := t.u16(off + 2)
+		i := sort.Search(n, func(i int) bool { return t.u16(off+4+2*i) >= gid })
+		if i < n && t.u16(off+4+2*i) == gid {
+			return i
+		}
+	case 2:
+		n := t.u16(off + 2)
+		i := sort.Search(n, func(i int) bool { return t.u16(off+4+6*i+2) >= gid })
+		if i < n {
+			rec := off + 4 + 6*i
+			if start := t.u16(rec); gid >= start {
+				return t.u16(rec+4) + gid - start
+			}
+		}
+	}
+	return -1
+}
+
+// classOf returns the class of gid in the class definition table at off.
+func (t *otLayout) classOf(off, gid int) int {
+	if off == 0 {
+		return 0
+	}
+	switch t.u16(off) {
+	case 1:
+		start := t.u16(off + 2)
+		n := t.u16(off + 4)
+		if gid >= start && gid < start+n {
+			return t.u16(off + 6 + 2*(gid-start))
+		}
+	case 2:
+		n := t.u16(off + 2)
+		i := sort.Search(n, func(i int) bool { return t.u16(off+4+6*i+2) >= gid })
+		if i < n {
+			rec := off + 4 + 6*i
+			if gid >= t.u16(rec) {
+				return t.u16(rec + 4)
+			}
+		}
+	}
+	return 0
+}
+
+// inMarkSet reports whether gid belongs to the GDEF mark glyph set idx.
+func (t *otLayout) inMarkSet(idx, gid int) bool {
+	if t.markGlyphSets == 0 || idx >= t.u16(t.markGlyphSets+2) {
+		return false
+	}
+	cov := t.markGlyphSets + t.u32(t.markGlyphSets+4+4*idx)
+	return t.coverage(cov, gid) >= 0
+}
+
+// script returns the script table of the GSUB or GPOS table at table for
+// the first of tags present, falling back to the default script.
+func (t *otLayout) script(table int, tags ...string) int {
+	if table == 0 {
+		return 0
+	}
+	list := t.offset16(table, table+4)
+	if list == 0 {
+		return 0
+	}
+	n := t.u16(list)
+	for _, tag := range append(tags, "DFLT") {
+		for i := 0; i < n; i++ {
+			if t.tag(list+2+6*i) == tag {
+				return t.offset16(list, list+2+6*i+4)
+			}
+		}
+	}
+	return 0
+}
+
+// featureLookups returns the indexes of the lookups referenced by feature
+// in the default language system of script.
+func (t *otLayout) featureLookups(table, script int, feature string) []int {
+	if script == 0 {
+		return nil
+	}
+	key := [3]string{strconv.Itoa(table), strconv.Itoa(script), feature}
+	if indexes, ok := t.features[key]; ok {
+		return indexes
+	}
+	indexes := t.readFeatureLookups(table, script, feature)
+	t.features[key] = indexes
+	return indexes
+}
+
+func (t *otLayout) readFeatureLookups(table, script int, feature string) []int {
+	langSys := t.offset16(script, script)
+	if langSys == 0 {
+		return nil
+	}
+	features := t.offset16(table, table+6)
+	nFeatures := t.u16(features)
+	var indexes []int
+	count := t.u16(langSys + 4)
+	for i := 0; i < count; i++ {
+		fi := t.u16(langSys + 6 + 2*i)
+		if fi >= nFeatures {
+			continue
+		}
+		rec := features + 2 + 6*fi
+		if t.tag(rec) != feature {
+			continue
+		}
+		feat := t.offset16(features, rec+4)
+		n := t.u16(feat + 2)
+		for j := 0; j < n; j++ {
+			indexes = append(indexes, t.u16(feat+4+2*j))
+		}
+	}
+	return indexes
+}
+
+// lookup returns the lookup idx of the GSUB or GPOS table, resolving
+// extension subtables.
+func (t *otLayout) lookup(gpos bool, idx int) *otLookup {
+	key := idx
+	table := t.gsub
+	if gpos {
+		key = -idx - 1
+		table = t.gpos
+	}
+	if l, ok := t.lookups[key]; ok {
+		return l
+	}
+	l := &otLookup{gpos: gpos}
+	t.lookups[key] = l
+	list := t.offset16(table, table+8)
+	if list == 0 || idx >= t.u16(list) {
+		return l
+	}
+	off := t.offset16(list, list+2+2*idx)
+	if off == 0 {
+		return l
+	}
+	l.kind = t.u16(off)
+	l.flag = t.u16(off + 2)
+	n := t.u16(off + 4)
+	for i := 0; i < n; i++ {
+		sub := t.offset16(off, off+6+2*i)
+		if sub == 0 {
+			continue
+		}
+		if (!gpos && l.kind == 7) || (gpos && l.kind == 9) {
+			// extension subtable
+			if t.u16(sub) != 1 {
+				continue
+			}
+			kind := t.u16(sub + 2)
+			if len(l.subtables) == 0 {
+				l.kind = kind
+			}
+			sub += t.u32(sub + 4)
+		}
+		l.subtables = append(l.subtables, sub)
+	}
+	if l.flag&otlUseMarkFilteringSet != 0 {
+		l.markSet = t.u16(off + 6 + 2*n)
+	}
+	return l
+}
+
+// otGlyph is a glyph of a buffer being shaped. Positions are in font units.
+type otGlyph struct {
+	gid      int
+	cluster  int // index of the first rune the glyph was produced from
+	mask     uint32
+	class    int
+	cat      int  // shaper specific character category
+	flags    int  // shaper specific flags, merged when glyphs ligate
+	syllable int  // shaper specific cluster number
+	ligated  bool // produced by a ligature substitution
+	ligID    int
+	ligComp  int
+	xAdv     int
+	xOff     int
+	yOff     int
+	attach   int // index of the glyph this one is attached to
+	attKind  int
+}
+
+// otBuffer holds the glyphs of a run being shaped.
+type otBuffer struct {
+	t      *otLayout
+	g      []otGlyph
+	rtl    bool
+	depth  int
+	nextID int
+}
+
+// setClass refreshes the GDEF class of the glyph at i after a substitution.
+func (b *otBuffer) setClass(i int) {
+	if c := b.t.glyphClass(b.g[i].gid); c != 0 || b.t.glyphClassDef != 0 {
+		b.g[i].class = c
+	}
+}
+
+// skip reports whether the glyph at i is ignored by lookup l.
+func (b *otBuffer) skip(l *otLookup, i int) bool {
+	g := &b.g[i]
+	switch g.class {
+	case otlClassBase:
+		return l.flag&otlIgnoreBaseGlyphs != 0
+	case otlClassLigature:
+		return l.flag&otlIgnoreLigatures != 0
+	case otlClassMark:
+		if l.flag&otlIgnoreMarks != 0 {
+			return true
+		}
+		if l.flag&otlUseMarkFilteringSet != 0 {
+			return !b.t.inMarkSet(l.markSet, g.gid)
+		}
+		if c := l.flag & otlMarkAttachmentType; c != 0 {
+			return b.t.classOf(b.t.markAttachClass, g.gid) != c>>8
+		}
+	}
+	return false
+}
+
+// next returns the index of the first glyph after i not skipped by l, or
+// -1 if there is none.
+func (b *otBuffer) next(l *otLookup, i int) int {
+	for i++; i < len(b.g); i++ {
+		if !b.skip(l, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// prev returns the index of the last glyph before i not skipped by l, or
+// -1 if there is none.
+func (b *otBuffer) prev(l *otLookup, i int) int {
+	for i--; i >= 0; i-- {
+		if !b.skip(l, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// apply runs lookup l over the glyphs of the buffer whose masks intersect
+// the lookup mask.
+func (b *otBuffer) apply(l *otLookup) {
+	if !l.gpos && l.kind == 8 {
+		for i := len(b.g) - 1; i >= 0; i-- {
+			if b.g[i].mask&l.mask != 0 && !b.skip(l, i) {
+				b.applyAt(l, i)
+			}
+		}
+		return
+	}
+	for i := 0; i < len(b.g); {
+		if b.g[i].mask&l.mask == 0 || b.skip(l, i) {
+			i++
+			continue
+		}
+		if next, ok := b.applyAt(l, i); ok && next > i {
+			i = next
+		} else {
+			i++
+		}
+	}
+}
+
+// applyAt tries the subtables of l at glyph i and returns the index where
+// processing continues.
+func (b *otBuffer) applyAt(l *otLookup, i int) (int, bool) {
+	if b.depth > 8 || i >= len(b.g) {
+		return i, false
+	}
+	for _, sub := range l.subtables {
+		var next int
+		var ok bool
+		if l.gpos {
+			next, ok = b.position(l, sub, i)
+		} else {
+			next, ok = b.substitute(l, sub, i)
+		}
+		if ok {
+			return next, true
+		}
+	}
+	return i, false
+}
+
+func (b *otBuffer) substitute(l *otLookup, sub, i int) (int, bool) {
+	t := b.t
+	gid := b.g[i].gid
+	switch l.kind {
+	case 1: // single
+		idx := t.coverage(t.offset16(sub, sub+2), gid)
+		if idx < 0 {
+			return i, false
+		}
+		switch t.u16(sub) {
+		case 1:
+			b.g[i].gid = (gid + t.i16(sub+4)) & 0xFFFF
+		case 2:
+			if idx >= t.u16(sub+4) {
+				return i, false
+			}
+			b.g[i].gid = t.u16(sub + 6 + 2*idx)
+		default:
+			return i, false
+		}
+		b.setClass(i)
+		return i + 1, true
+	case 2: // multiple
+		idx := t.coverage(t.offset16(sub, sub+2), gid)
+		if idx < 0 || idx >= t.u16(sub+4) {
+			return i, false
+		}
+		seq := t.offset16(sub, sub+6+2*idx)
+		n := t.u16(seq)
+		glyphs := make([]otGlyph, n)
+		for k := range glyphs {
+			glyphs[k] = b.g[i]
+			glyphs[k].gid = t.u16(seq + 2 + 2*k)
+		}
+		b.g = append(b.g[:i], append(glyphs, b.g[i+1:]...)...)
+		for k := i; k < i+n; k++ {
+			b.setClass(k)
+		}
+		return i + n, true
+	case 3: // alternate
+		idx := t.coverage(t.offset16(sub, sub+2), gid)
+		if idx < 0 || idx >= t.u16(sub+4) {
+			return i, false
+		}
+		set := t.offset16(sub, sub+6+2*idx)
+		if t.u16(set) == 0 {
+			return i, false
+		}
+		b.g[i].gid = t.u16(set + 2)
+		b.setClass(i)
+		return i + 1, true
+	case 4: // ligature
+		idx := t.coverage(t.offset16(sub, sub+2), gid)
+		if idx < 0 || idx >= t.u16(sub+4) {
+			return i, false
+		}
+		set := t.offset16(sub, sub+6+2*idx)
+		n := t.u16(set)
+		for k := 0; k < n; k++ {
+			lig := t.offset16(set, set+2+2*k)
+			count := t.u16(lig + 2)
+			pos, ok := b.matchInput(l, i, count, func(c, gid int) bool {
+				return t.u16(lig+4+2*(c-1)) == gid
+			})
+			if !ok {
+				continue
+			}
+			b.ligate(pos, t.u16(lig))
+			return i + 1, true
+		}
+		return i, false
+	case 5, 6:
+		return b.context(l, sub, i)
+	case 8: // reverse chaining single
+		if t.u16(sub) != 1 {
+			return i, false
+		}
+		idx := t.coverage(t.offset16(sub, sub+2), gid)
+		if idx < 0 {
+			return i, false
+		}
+		nb := t.u16(sub + 4)
+		back := sub + 6
+		nl := t.u16(back + 2*nb)
+		ahead := back + 2*nb + 2
+		subst := ahead + 2*nl
+		if !b.matchBacktrack(l, i, nb, func(c, gid int) bool {
+			return t.coverage(t.offset16(sub, back+2*c), gid) >= 0
+		}) || !b.matchLookahead(l, i, nl, func(c, gid int) bool {
+			return t.coverage(t.offset16(sub, ahead+2*c), gid) >= 0
+		}) || idx >= t.u16(subst) {
+			return i, false
+		}
+		b.g[i].gid = t.u16(subst + 2 + 2*idx)
+		b.setClass(i)
+		return i, true
+	}
+	return i, false
+}
+
+// ligate replaces the glyphs at pos by the ligature gid. Skipped marks
+// between the components stay in place and remember the component they
+// follow.
+func (b *otBuffer) ligate(pos []int, gid int) {
+	first := pos[0]
+	g := &b.g[first]
+	b.nextID++
+	g.gid = gid
+	g.ligated = true
+	g.ligID = b.nextID
+	for _, p := range pos[1:] {
+		g.flags |= b.g[p].flags
+	}
+	b.setClass(first)
+	comp := 1
+	removed := 0
+	for k := first + 1; k <= pos[len(pos)-1]; k++ {
+		if comp < len(pos) && k == pos[comp] {
+			comp++
+			removed++
+			continue
+		}
+		b.g[k].ligID = b.nextID
+		b.g[k].ligComp = comp
+		b.g[k-removed] = b.g[k]
+	}
+	last := pos[len(pos)-1]
+	b.g = append(b.g[:last+1-removed], b.g[last+1:]...)
+}
+
+// matchInput matches count glyphs starting at i, the first of which is
+// already known to match, and returns their positions.
+func (b *otBuffer) matchInput(l *otLookup, i, count int, match func(c, gid int) bool) ([]int, bool) {
+	if count == 0 {
+		return nil, false
+	}
+	pos := []int{i}
+	j := i
+	for c := 1; c < count; c++ {
+		if j = b.next(l, j); j < 0 || !match(c, b.g[j].gid) {
+			return nil, false
+		}
+		pos = append(pos, j)
+	}
+	return pos, true
+}
+
+func (b *otBuffer) matchBacktrack(l *otLookup, i, count int, match func(c, gid int) bool) bool {
+	j := i
+	for c := 0; c < count; c++ {
+		if j = b.prev(l, j); j < 0 || !match(c, b.g[j].gid) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *otBuffer) matchLookahead(l *otLookup, last, count int, match func(c, gid int) bool) bool {
+	j := last
+	for c := 0; c < count; c++ {
+		if j = b.next(l, j); j < 0 || !match(c, b.g[j].gid) {
+			return false
+		}
+	}
+	return true
+}
+
+// context handles the contextual and chained contextual lookups of GSUB
+// (types 5 and 6) and GPOS (types 7 and 8).
+func (b *otBuffer) context(l *otLookup, sub, i int) (int, bool) {
+	t := b.t
+	gid := b.g[i].gid
+	chained := l.kind == 6 || (l.gpos && l.kind == 8)
+	format := t.u16(sub)
+	if !chained {
+		switch format {
+		case 1, 2:
+			idx := t.coverage(t.offset16(sub, sub+2), gid)
+			if idx < 0 {
+				return i, false
+			}
+			classDef := 0
+			setIdx := idx
+			if format == 2 {
+				classDef = t.offset16(sub, sub+4)
+				setIdx = t.classOf(classDef, gid)
+			}
+			base := sub + 4
+			if format == 2 {
+				base = sub + 6
+			}
+			if setIdx >= t.u16(base) {
+				return i, false
+			}
+			set := t.offset16(sub, base+2+2*setIdx)
+			if set == 0 {
+				return i, false
+			}
+			for k := 0; k < t.u16(set); k++ {
+				rule := t.offset16(set, set+2+2*k)
+				count := t.u16(rule)
+				nrec := t.u16(rule + 2)
+				pos, ok := b.matchInput(l, i, count, func(c, gid int) bool {
+					v := t.u16(rule + 4 + 2*(c-1))
+					if format == 2 {
+						return t.classOf(classDef, gid) == v
+					}
+					return v == gid
+				})
+				if ok {
+					return b.applyRecords(l, pos, rule+4+2*(count-1), nrec), true
+				}
+			}
+		case 3:
+			count := t.u16(sub + 2)
+			nrec := t.u16(sub + 4)
+			if count == 0 || t.coverage(t.offset16(sub, sub+6), gid) < 0 {
+				return i, false
+			}
+			pos, ok := b.matchInput(l, i, count, func(c, gid int) bool {
+				return t.coverage(t.offset16(sub, sub+6+2*c), gid) >= 0
+			})
+			if ok {
+				return b.applyRecords(l, pos, sub+6+2*count, nrec), true
+			}
+		}
+		return i, false
+	}
+	switch format {
+	case 1, 2:
+		idx := t.coverage(t.offset16(sub, sub+2), gid)
+		if idx < 0 {
+			return i, false
+		}
+		var backDef, inputDef, aheadDef int
+		setIdx := idx
+		base := sub + 4
+		if format == 2 {
+			backDef = t.offset16(sub, sub+4)
+			inputDef = t.offset16(sub, sub+6)
+			aheadDef = t.offset16(sub, sub+8)
+			setIdx = t.classOf(inputDef, gid)
+			base = sub + 10
+		}
+		if setIdx >= t.u16(base) {
+			return i, false
+		}
+		set := t.offset16(sub, base+2+2*setIdx)
+		if set == 0 {
+			return i, false
+		}
+		matcher := func(def, off int) func(c, gid int) bool {
+			return func(c, gid int) bool {
+				v := t.u16(off + 2*c)
+				if format == 2 {
+					return t.classOf(def, gid) == v
+				}
+				return v == gid
+			}
+		}
+		for k := 0; k < t.u16(set); k++ {
+			rule := t.offset16(set, set+2+2*k)
+			nb := t.u16(rule)
+			back := rule + 2
+			ni := t.u16(back + 2*nb)
+			input := back + 2*nb + 2
+			if ni == 0 {
+				continue
+			}
+			na := t.u16(input + 2*(ni-1))
+			ahead := input + 2*(ni-1) + 2
+			nrec := t.u16(ahead + 2*na)
+			pos, ok := b.matchInput(l, i, ni, func(c, gid int) bool {
+				return matcher(inputDef, input-2)(c, gid)
+			})
+			if !ok || !b.matchBacktrack(l, i, nb, matcher(backDef, back)) ||
+				!b.matchLookahead(l, pos[len(pos)-1], na, matcher(aheadDef, ahead)) {
+				continue
+			}
+			return b.applyRecords(l, pos, ahead+2*na+2, nrec), true
+		}
+	case 3:
+		nb := t.u16(sub + 2)
+		back := sub + 4
+		ni := t.u16(back + 2*nb)
+		input := back + 2*nb + 2
+		na := t.u16(input + 2*ni)
+		ahead := input + 2*ni + 2
+		nrec := t.u16(ahead + 2*na)
+		if ni == 0 || t.coverage(t.offset16(sub, input), gid) < 0 {
+			return i, false
+		}
+		cov := func(off int) func(c, gid int) bool {
+			return func(c, gid int) bool {
+				return t.coverage(t.offset16(sub, off+2*c), gid) >= 0
+			}
+		}
+		pos, ok := b.matchInput(l, i, ni, cov(input))
+		if !ok || !b.matchBacktrack(l, i, nb, cov(back)) ||
+			!b.matchLookahead(l, pos[len(pos)-1], na, cov(ahead)) {
+			return i, false
+		}
+		return b.applyRecords(l, pos, ahead+2*na+2, nrec), true
+	}
+	return i, false
+}
+
+// applyRecords applies the nested lookups of a matched context and returns
+// the index following the input sequence.
+func (b *otBuffer) applyRecords(l *otLookup, pos []int, recs, count int) int {
+	b.depth++
+	for r := 0; r < count; r++ {
+		seq := b.t.u16(recs + 4*r)
+		if seq >= len(pos) {
+			continue
+		}
+		nested := *b.t.lookup(l.gpos, b.t.u16(recs+4*r+2))
+		nested.mask = ^uint32(0)
+		p := pos[seq]
+		if p >= len(b.g) {
+			continue
+		}
+		before := len(b.g)
+		b.applyAt(&nested, p)
+		if delta := len(b.g) - before; delta != 0 {
+			for k := seq + 1; k < len(pos); k++ {
+				pos[k] += delta
+				if pos[k] <= p {
+					pos[k] = p + 1
+				}
+			}
+		}
+	}
+	b.depth--
+	end := pos[len(pos)-1] + 1
+	if end > len(b.g) {
+		end = len(b.g)
+	}
+	return end
+}
+
+// valueRecord reads a GPOS value record and returns its placement and
+// advance adjustments along with its size in bytes.
+func (t *otLayout) valueRecord(off, format int) (xPla, yPla, xAdv, size int) {
+	for bit := 0; bit < 8; bit++ {
+		if format&(1<<uint(bit)) == 0 {
+			continue
+		}
+		v := t.i16(off + size)
+		switch bit {
+		case 0:
+			xPla = v
+		case 1:
+			yPla = v
+		case 2:
+			xAdv = v
+		}
+		size += 2
+	}
+	return
+}
+
+func (b *otBuffer) adjust(i, off, format int) {
+	xPla, yPla, xAdv, _ := b.t.valueRecord(off, format)
+	b.g[i].xOff += xPla
+	b.g[i].yOff += yPla
+	b.g[i].xAdv += xAdv
+}
+
+func (t *otLayout) anchor(off int) (x, y int) {
+	return t.i16(off + 2), t.i16(off + 4)
+}
+
+func (b *otBuffer) position(l *otLookup, sub, i int) (int, bool) {
+	t := b.t
+	gid := b.g[i].gid
+	switch l.kind {
+	case 1: // single adjustment
+		idx := t.coverage(t.offset16(sub, sub+2), gid)
+		if idx < 0 {
+			return i, false
+		}
+		format := t.u16(sub + 4)
+		switch t.u16(sub) {
+		case 1:
+			b.adjust(i, sub+6, format)
+		case 2:
+			_, _, _, size := t.valueRecord(0, format)
+			if idx >= t.u16(sub+6) {
+				return i, false
+			}
+			b.adjust(i, sub+8+idx*size, format)
+		default:
+			return i, false
+		}
+		return i + 1, true
+	case 2: // pair adjustment
+		idx := t.coverage(t.offset16(sub, sub+2), gid)
+		if idx < 0 {
+			return i, false
+		}
+		j := b.next(l, i)
+		if j < 0 {
+			return i, false
+		}
+		f1, f2 := t.u16(sub+4), t.u16(sub+6)
+		_, _, _, s1 := t.valueRecord(0, f1)
+		_, _, _, s2 := t.valueRecord(0, f2)
+		second := b.g[j].gid
+		rec := 0
+		switch t.u16(sub) {
+		case 1:
+			if idx >= t.u16(sub+8) {
+				return i, false
+			}
+			set := t.offset16(sub, sub+10+2*idx)
+			n := t.u16(set)
+			size := 2 + s1 + s2
+			k := sort.Search(n, func(k int) bool { return t.u16(set+2+k*size) >= second })
+			if k >= n || t.u16(set+2+k*size) != second {
+				return i, false
+			}
+			rec = set + 2 + k*size + 2
+		case 2:
+			c1 := t.classOf(t.offset16(sub, sub+8), gid)
+			c2 := t.classOf(t.offset16(sub, sub+10), second)
+			n1, n2 := t.u16(sub+12), t.u16(sub+14)
+			if c1 >= n1 || c2 >= n2 {
+				return i, false
+			}
+			rec = sub + 16 + (c1*n2+c2)*(s1+s2)
+		default:
+			return i, false
+		}
+		b.adjust(i, rec, f1)
+		b.adjust(j, rec+s1, f2)
+		if f2 != 0 {
+			return j + 1, true
+		}
+		return j, true
+	case 3: // cursive attachment
+		if t.u16(sub) != 1 {
+			return i, false
+		}
+		cov := t.offset16(sub, sub+2)
+		idx := t.coverage(cov, gid)
+		if idx < 0 || idx >= t.u16(sub+4) {
+			return i, false
+		}
+		exit := t.offset16(sub, sub+6+4*idx+2)
+		j := b.next(l, i)
+		if exit == 0 || j < 0 {
+			return i, false
+		}
+		jdx := t.coverage(cov, b.g[j].gid)
+		if jdx < 0 || jdx >= t.u16(sub+4) {
+			return i, false
+		}
+		entry := t.offset16(sub, sub+6+4*jdx)
+		if entry == 0 {
+			return i, false
+		}
+		exitX, exitY := t.anchor(exit)
+		entryX, entryY := t.anchor(entry)
+		gi, gj := &b.g[i], &b.g[j]
+		if b.rtl {
+			d := exitX + gi.xOff
+			gi.xAdv -= d
+			gi.xOff -= d
+			gj.xAdv = entryX + gj.xOff
+		} else {
+			gi.xAdv = exitX + gi.xOff
+			d := entryX + gj.xOff
+			gj.xAdv -= d
+			gj.xOff -= d
+		}
+		child, parent := i, j
+		dy := entryY - exitY
+		if l.flag&otlRightToLeft == 0 {
+			child, parent = j, i
+			dy = -dy
+		}
+		b.g[child].yOff = dy
+		b.g[child].attach = parent
+		b.g[child].attKind = otlAttachCursive
+		return j, true
+	case 4, 5, 6: // mark attachment
+		if t.u16(sub) != 1 {
+			return i, false
+		}
+		markIdx := t.coverage(t.offset16(sub, sub+2), gid)
+		if markIdx < 0 {
+			return i, false
+		}
+		classes := t.u16(sub + 6)
+		markArray := t.offset16(sub, sub+8)
+		baseArray := t.offset16(sub, sub+10)
+		j := -1
+		switch l.kind {
+		case 4, 5:
+			for k := i - 1; k >= 0; k-- {
+				if b.g[k].class != otlClassMark {
+					j = k
+					break
+				}
+			}
+		case 6:
+			if k := b.prev(l, i); k >= 0 && b.g[k].class == otlClassMark {
+				j = k
+			}
+		}
+		if j < 0 {
+			return i, false
+		}
+		baseIdx := t.coverage(t.offset16(sub, sub+4), b.g[j].gid)
+		if baseIdx < 0 || baseIdx >= t.u16(baseArray) || markIdx >= t.u16(markArray) {
+			return i, false
+		}
+		class := t.u16(markArray + 2 + 4*markIdx)
+		markAnchor := t.offset16(markArray, markArray+2+4*markIdx+2)
+		if class >= classes || markAnchor == 0 {
+			return i, false
+		}
+		var baseAnchor int
+		if l.kind == 5 {
+			attach := t.offset16(baseArray, baseArray+2+2*baseIdx)
+			comps := t.u16(attach)
+			if comps == 0 {
+				return i, false
+			}
+			comp := comps
+			if g := b.g[i]; g.ligID == b.g[j].ligID && g.ligComp > 0 && g.ligComp <= comps {
+				comp = g.ligComp
+			}
+			baseAnchor = t.offset16(attach, attach+2+2*((comp-1)*classes+class))
+		} else {
+			baseAnchor = t.offset16(baseArray, baseArray+2+2*(baseIdx*classes+class))
+		}
+		if baseAnchor == 0 {
+			return i, false
+		}
+		mx, my := t.anchor(markAnchor)
+		bx, by := t.anchor(baseAnchor)
+		g := &b.g[i]
+		g.xOff = bx - mx
+		g.yOff = by - my
+		g.attach = j
+		g.attKind = otlAttachMark
+		return i + 1, true
+	case 7, 8:
+		return b.context(l, sub, i)
+	}
+	return i, false
+}
+
+// resolveAttachments turns the offsets of attached glyphs, which GPOS
+// expresses relative to the glyph they are attached to, into offsets
+// relative to their own pen position.
+func (b *otBuffer) resolveAttachments() {
+	done := make([]bool, len(b.g))
+	var resolve func(i int)
+	resolve = func(i int) {
+		if done[i] {
+			return
+		}
+		done[i] = true
+		g := &b.g[i]
+		p := g.attach
+		if g.attKind == 0 || p < 0 || p >= len(b.g) || p == i {
+			return
+		}
+		resolve(p)
+		g.yOff += b.g[p].yOff
+		if g.attKind == otlAttachCursive {
+			return
+		}
+		g.xOff += b.g[p].xOff
+		if p < i {
+			if b.rtl {
+				for k := p + 1; k <= i; k++ {
+					g.xOff += b.g[k].xAdv
+				}
+			} else {
+				for k := p; k < i; k++ {
+					g.xOff -= b.g[k].xAdv
+				}
+			}
+		}
+	}
+	for i := range b.g {
+		resolve(i)
+	}
+}
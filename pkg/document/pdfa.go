@@ -0,0 +1,168 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/md5"
+	"fmt"
+)
+
+// PDFALevel identifies a PDF/A conformance level
+type PDFALevel int
+
+const (
+	// PDFANone disables PDF/A conformance checks
+	PDFANone PDFALevel = iota
+	// PDFA1B selects PDF/A-1b (ISO 19005-1, level B conformance)
+	PDFA1B
+	// PDFA2B selects PDF/A-2b (ISO 19005-2, level B conformance)
+	PDFA2B
+)
+
+type pdfaRecType struct {
+	level     PDFALevel
+	iccObjNum int  // object number of the embedded sRGB output profile
+	cmyk      bool // a device CMYK color has been set
+}
+
+// SetPDFA enables archival conformance with the specified PDF/A level. In
+// this mode all fonts must be embedded, so the core fonts cannot be used and
+// a font must be added with AddFont() or AddUTF8Font() instead. An sRGB output
+// intent and XMP metadata matching the document information are written
+// (metadata supplied with SetXmpMetadata() is used unchanged). Since the
+// output intent is sRGB, device CMYK colors, spot colors and CMYK images
+// without an embedded color profile are rejected. Encryption, JavaScript and
+// attachments are rejected as well and PDF/A-1b additionally rejects
+// transparency, that is, SetAlpha() with an alpha below 1 or a blend mode
+// other than Normal, images with an alpha channel or 16 bits per component
+// and optional content layers. Violations are reported as an error when the
+// document is closed.
+func (f *Bdf) SetPDFA(level PDFALevel) {
+	if level < PDFANone || level > PDFA2B {
+		f.SetErrorf("unsupported PDF/A level %d", level)
+		return
+	}
+	f.pdfa.level = level
+}
+
+// pdfaEndDoc verifies that the document content can be represented at the
+// selected conformance level and adjusts the PDF version accordingly.
+func (f *Bdf) pdfaEndDoc() {
+	level := f.pdfa.level
+	if level == PDFANone {
+		return
+	}
+	name := [...]string{"", "PDF/A-1b", "PDF/A-2b"}[level]
+	for _, font := range f.fonts {
+		if font.Tp == "Core" {
+			f.err = fmt.Errorf("%s requires embedded fonts; core font %s cannot be used", name, font.Name)
+			return
+		}
+	}
+	switch {
+	case f.protect.encrypted:
+		f.err = fmt.Errorf("%s forbids encryption", name)
+	case f.javascript != nil:
+		f.err = fmt.Errorf("%s forbids JavaScript", name)
+	case len(f.attachments) > 0:
+		f.err = fmt.Errorf("%s forbids embedded files", name)
+	}
+	for _, fld := range f.form.fields {
+		if fld.action != "" {
+			f.err = fmt.Errorf("%s forbids JavaScript actions in form field %q", name, fld.name)
+		}
+	}
+	for _, list := range f.pageAttachments {
+		if len(list) > 0 {
+			f.err = fmt.Errorf("%s forbids file attachment annotations", name)
+		}
+	}
+	if f.pdfa.cmyk || len(f.spotColorMap) > 0 {
+		f.err = fmt.Errorf("%s with an sRGB output intent forbids device CMYK and spot colors", name)
+	}
+	for _, info := range f.images {
+		if info.cs == "DeviceCMYK" && len(info.icc) == 0 {
+			f.err = fmt.Errorf("%s with an sRGB output intent forbids CMYK images without a color profile", name)
+		}
+	}
+	if f.err != nil {
+		return
+	}
+	if level == PDFA1B {
+		for _, bl := range f.blendList[1:] {
+			if bl.fillStr != "1.000" || bl.strokeStr != "1.000" || (bl.modeStr != "Normal" && bl.modeStr != "") {
+				f.err = fmt.Errorf("%s forbids transparency", name)
+				return
+			}
+		}
+		for _, info := range f.images {
+			if len(info.smask) > 0 {
+				f.err = fmt.Errorf("%s forbids images with an alpha channel", name)
+				return
+			}
+			if info.bpc > 8 {
+				f.err = fmt.Errorf("%s forbids images with %d bits per component", name, info.bpc)
+				return
+			}
+		}
+		if len(f.layer.list) > 0 {
+			f.err = fmt.Errorf("%s forbids optional content", name)
+			return
+		}
+		f.pdfVersion = "1.4"
+	} else if f.pdfVersion < "1.7" {
+		f.pdfVersion = "1.7"
+	}
+}
+
+// pdfaPutOutputIntent writes the sRGB ICC profile referenced by the output
+// intent
+func (f *Bdf) pdfaPutOutputIntent() {
+	if f.pdfa.level == PDFANone {
+		return
+	}
+	profile := srgbProfile()
+	mem := xmem.compress(profile)
+	data := mem.bytes()
+	f.newobj()
+	f.pdfa.iccObjNum = f.n
+	f.outf("<</N 3 /Filter /FlateDecode /Length %d>>", len(data))
+	f.putstream(data)
+	f.out("endobj")
+	mem.release()
+}
+
+func (f *Bdf) pdfaPutCatalog() {
+	if f.pdfa.level == PDFANone {
+		return
+	}
+	// GTS_PDFA1 is also the output intent subtype of PDF/A-2
+	f.outf("/OutputIntents [<</Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB IEC61966-2.1) "+
+		"/RegistryName (http://www.color.org) /Info (sRGB IEC61966-2.1) /DestOutputProfile %d 0 R>>]",
+		f.pdfa.iccObjNum)
+}
+
+// pdfaPutID writes the file identifier required by PDF/A, derived from the
+// content written so far
+func (f *Bdf) pdfaPutID() {
+	sum := md5.Sum(f.buffer.Bytes())
+	f.outf("/ID [<%x> <%x>]", sum, sum)
+}
@@ -0,0 +1,140 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestPDFAOutput(t *testing.T) {
+	for _, level := range []PDFALevel{PDFA1B, PDFA2B} {
+		pdf := New("P", "mm", "A4", "")
+		pdf.SetCompression(false)
+		pdf.SetPDFA(level)
+		pdf.SetTitle("Statement", true)
+		pdf.AddUTF8FontFromBytes("go", "", goregular.TTF)
+		pdf.AddPage()
+		pdf.SetFont("go", "", 12)
+		pdf.CellFormat(0, 10, "Archived statement", "", 1, "", false, 0, "https://example.com")
+		var buf bytes.Buffer
+		if err := pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		want := []string{
+			"/OutputIntents [<</Type /OutputIntent /S /GTS_PDFA1",
+			"<pdfaid:conformance>B</pdfaid:conformance>",
+			"<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">Statement</rdf:li>",
+			"/Metadata ",
+			"/ID [<",
+			"/F 4 ",
+		}
+		if level == PDFA1B {
+			want = append(want, "%PDF-1.4", "<pdfaid:part>1</pdfaid:part>", "/CIDSet ")
+			if strings.Contains(out, "/S /Transparency") {
+				t.Error("PDF/A-1b output contains a transparency group")
+			}
+		} else {
+			want = append(want, "%PDF-1.7", "<pdfaid:part>2</pdfaid:part>")
+		}
+		for _, w := range want {
+			if !strings.Contains(out, w) {
+				t.Errorf("level %d: output does not contain %q", level, w)
+			}
+		}
+		if strings.Contains(out, "/EmbeddedFiles") {
+			t.Errorf("level %d: output contains an EmbeddedFiles entry", level)
+		}
+	}
+}
+
+func TestPDFAViolations(t *testing.T) {
+	tests := []struct {
+		name  string
+		level PDFALevel
+		fn    func(pdf *Bdf)
+	}{
+		{"core font", PDFA2B, func(pdf *Bdf) {
+			pdf.SetFont("Helvetica", "", 12)
+		}},
+		{"transparency", PDFA1B, func(pdf *Bdf) {
+			pdf.SetAlpha(0.5, "Normal")
+		}},
+		{"encryption", PDFA2B, func(pdf *Bdf) {
+			pdf.SetProtection(CnProtectPrint, "user", "owner")
+		}},
+		{"javascript", PDFA1B, func(pdf *Bdf) {
+			pdf.SetJavascript("print();")
+		}},
+		{"CMYK color", PDFA2B, func(pdf *Bdf) {
+			pdf.SetTextColorCMYK(0, 0, 0, 100)
+		}},
+		{"spot color", PDFA1B, func(pdf *Bdf) {
+			pdf.AddSpotColor("Blue", 100, 50, 0, 0)
+			pdf.SetFillSpotColor("Blue", 100)
+		}},
+		{"16-bit image", PDFA1B, func(pdf *Bdf) {
+			var buf bytes.Buffer
+			png.Encode(&buf, image.NewGray16(image.Rect(0, 0, 2, 2)))
+			pdf.RegisterImageOptionsReader("gray16", ImageOptions{ImageType: "png"}, &buf)
+		}},
+		{"CMYK image", PDFA2B, func(pdf *Bdf) {
+			pdf.RegisterImageOptionsReader("cmyk", ImageOptions{ImageType: "tiff"},
+				bytes.NewReader(pdfaTestCMYKImage()))
+		}},
+	}
+	for _, test := range tests {
+		pdf := New("P", "mm", "A4", "")
+		pdf.SetPDFA(test.level)
+		pdf.AddUTF8FontFromBytes("go", "", goregular.TTF)
+		pdf.AddPage()
+		pdf.SetFont("go", "", 12)
+		test.fn(pdf)
+		if err := pdf.Output(&bytes.Buffer{}); err == nil {
+			t.Errorf("%s: expected a conformance error", test.name)
+		}
+	}
+}
+
+// pdfaTestCMYKImage returns a TIFF image of 2 by 1 CMYK pixels
+func pdfaTestCMYKImage() []byte {
+	return tiffTestFile([]tiffTestPage{{tags: map[int][]int{256: {2}, 257: {1}, 258: {8, 8, 8, 8},
+		262: {5}, 277: {4}}, strips: [][]byte{{10, 20, 30, 40, 1, 1, 1, 1}}}})
+}
+
+func TestPDFACMYKImageProfile(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetPDFA(PDFA2B)
+	pdf.AddColorProfile("press", cmykTestProfile())
+	pdf.AddPage()
+	options := ImageOptions{ImageType: "tiff", ColorProfile: "press"}
+	pdf.RegisterImageOptionsReader("cmyk", options, bytes.NewReader(pdfaTestCMYKImage()))
+	pdf.ImageOptions("cmyk", 10, 10, 20, 0, false, options, 0, "")
+	if err := pdf.Output(&bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,782 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// PDFDiffOptions controls the comparison made by DiffPDFs().
+type PDFDiffOptions struct {
+	// Tolerance is the largest difference between two numbers, such as the
+	// operands of content stream operators, that are considered equal. Zero
+	// requires numbers to be equal.
+	Tolerance float64
+	// IgnoreInfo lists the entries of the document information dictionary
+	// that are not compared. A nil slice ignores CreationDate and ModDate.
+	// Dates and identifiers in XMP metadata are always ignored.
+	IgnoreInfo []string
+}
+
+// PDFDifference is a difference between two documents found by DiffPDFs().
+// Where locates the difference, for example "page 2 content, operator 14".
+// Old and New hold the lines of the first and second document that differ;
+// one of them is empty when lines were only added or removed.
+type PDFDifference struct {
+	Where    string
+	Old, New []string
+}
+
+// PDFDiff is the list of differences between two documents.
+type PDFDiff []PDFDifference
+
+// String returns a readable report of the differences, in which the lines of
+// the first document are marked with "-" and those of the second with "+".
+func (d PDFDiff) String() string {
+	var b strings.Builder
+	for _, diff := range d {
+		b.WriteString(diff.Where)
+		b.WriteString(":\n")
+		for _, line := range diff.Old {
+			b.WriteString("- ")
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+		for _, line := range diff.New {
+			b.WriteString("+ ")
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// DiffPDFs parses the documents read from rdr1 and rdr2 and compares their
+// structure rather than their bytes: the document information and XMP
+// metadata, the outline, the fonts and images used, and for each page its
+// boxes, its resources, the operators of its content stream and its
+// annotations. Numbers are compared with the tolerance of options, fonts and
+// images by the checksum of their decoded data, and resources by their
+// content rather than their names. Differences in timestamps, object order,
+// object numbers or compression are ignored. An error is returned if either
+// document cannot be read.
+func DiffPDFs(rdr1, rdr2 io.Reader, options PDFDiffOptions) (PDFDiff, error) {
+	r1, err := NewPDFReader(rdr1)
+	if err != nil {
+		return nil, err
+	}
+	r2, err := NewPDFReader(rdr2)
+	if err != nil {
+		return nil, err
+	}
+	return diffPDFReaders(r1, r2, options), nil
+}
+
+// ComparePDFStructures compares the two documents as DiffPDFs() does. Nil is
+// returned if no difference is found, otherwise an error holding the report
+// of the differences.
+func ComparePDFStructures(rdr1, rdr2 io.Reader, options PDFDiffOptions) error {
+	diff, err := DiffPDFs(rdr1, rdr2, options)
+	if err == nil && len(diff) > 0 {
+		err = fmt.Errorf("documents are different:\n%s", diff)
+	}
+	return err
+}
+
+// ComparePDFStructureFiles compares the two specified files as DiffPDFs()
+// does. Nil is returned if no difference is found, or if the second file is
+// missing, otherwise an error holding the report of the differences.
+func ComparePDFStructureFiles(file1Str, file2Str string, options PDFDiffOptions) (err error) {
+	var fl1, fl2 *os.File
+	fl1, err = os.Open(file1Str)
+	if err == nil {
+		defer fl1.Close()
+		fl2, err = os.Open(file2Str)
+		if err == nil {
+			defer fl2.Close()
+			err = ComparePDFStructures(fl1, fl2, options)
+		} else {
+			// Second file is missing; treat this as success
+			err = nil
+		}
+	}
+	return
+}
+
+// pdfDiffItem is a line compared by the diff: its text is reported and its
+// value is compared with the numeric tolerance
+type pdfDiffItem struct {
+	text  string
+	value interface{}
+}
+
+// pdfDiffer compares two documents and collects their differences
+type pdfDiffer struct {
+	r1, r2  *PDFReader
+	tol     float64
+	diff    PDFDiff
+	fprints map[*PDFReader]map[interface{}]string // fingerprints of objects
+}
+
+func diffPDFReaders(r1, r2 *PDFReader, options PDFDiffOptions) PDFDiff {
+	d := &pdfDiffer{r1: r1, r2: r2, tol: options.Tolerance,
+		fprints: map[*PDFReader]map[interface{}]string{r1: {}, r2: {}}}
+	ignore := options.IgnoreInfo
+	if ignore == nil {
+		ignore = []string{"CreationDate", "ModDate"}
+	}
+	if n1, n2 := r1.NumPages(), r2.NumPages(); n1 != n2 {
+		d.add("document", []string{fmt.Sprintf("%d pages", n1)}, []string{fmt.Sprintf("%d pages", n2)})
+	}
+	d.info(ignore)
+	d.lines("metadata", d.xmp(r1), d.xmp(r2))
+	d.lines("outline", d.outline(r1), d.outline(r2))
+	fonts1, images1 := d.usage(r1)
+	fonts2, images2 := d.usage(r2)
+	d.lines("fonts", fonts1, fonts2)
+	d.lines("images", images1, images2)
+	for n := 1; n <= r1.NumPages() && n <= r2.NumPages(); n++ {
+		d.page(n)
+	}
+	return d.diff
+}
+
+func (d *pdfDiffer) add(where string, old, new []string) {
+	d.diff = append(d.diff, PDFDifference{Where: where, Old: old, New: new})
+}
+
+// equal compares two values with the numeric tolerance
+func (d *pdfDiffer) equal(a, b interface{}) bool {
+	switch va := a.(type) {
+	case int, float64:
+		switch b.(type) {
+		case int, float64:
+			return math.Abs(pdfNumber(a)-pdfNumber(b)) <= d.tol
+		}
+		return false
+	case pdfString:
+		vb, ok := b.(pdfString)
+		return ok && string(va) == string(vb)
+	case pdfArray:
+		vb, ok := b.(pdfArray)
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for j := range va {
+			if !d.equal(va[j], vb[j]) {
+				return false
+			}
+		}
+		return true
+	case pdfDict:
+		vb, ok := b.(pdfDict)
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for key, val := range va {
+			if !d.equal(val, vb[key]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// lines compares two sequences of lines
+func (d *pdfDiffer) lines(where string, a, b []string) {
+	items := func(lines []string) []pdfDiffItem {
+		list := make([]pdfDiffItem, len(lines))
+		for j, line := range lines {
+			list[j] = pdfDiffItem{text: line, value: line}
+		}
+		return list
+	}
+	d.items(where, "line", items(a), items(b))
+}
+
+// items compares two sequences of items and reports each run of differing
+// items, located by its position in the first sequence
+func (d *pdfDiffer) items(where, unit string, a, b []pdfDiffItem) {
+	eq := func(i, j int) bool {
+		return d.equal(a[i].value, b[j].value)
+	}
+	// Common leading and trailing items are skipped before the longest
+	// common subsequence of the remainder is searched
+	lo := 0
+	for lo < len(a) && lo < len(b) && eq(lo, lo) {
+		lo++
+	}
+	hiA, hiB := len(a), len(b)
+	for hiA > lo && hiB > lo && eq(hiA-1, hiB-1) {
+		hiA--
+		hiB--
+	}
+	n, m := hiA-lo, hiB-lo
+	type pair struct{ i, j int }
+	var matches []pair
+	if n > 0 && m > 0 && n*m <= 4000000 {
+		lcs := make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				switch {
+				case eq(lo+i, lo+j):
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				case lcs[i+1][j] >= lcs[i][j+1]:
+					lcs[i][j] = lcs[i+1][j]
+				default:
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		for i, j := 0, 0; i < n && j < m; {
+			switch {
+			case eq(lo+i, lo+j):
+				matches = append(matches, pair{lo + i, lo + j})
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				i++
+			default:
+				j++
+			}
+		}
+	}
+	matches = append(matches, pair{hiA, hiB})
+	i, j := lo, lo
+	for _, p := range matches {
+		if p.i > i || p.j > j {
+			var old, new []string
+			for _, item := range a[i:p.i] {
+				old = append(old, item.text)
+			}
+			for _, item := range b[j:p.j] {
+				new = append(new, item.text)
+			}
+			// Items that read the same but differ, such as operators using
+			// resources with different content, are reported with the
+			// resources
+			if strings.Join(old, "\n") != strings.Join(new, "\n") {
+				loc := where
+				if unit != "" {
+					if p.i > i+1 {
+						loc = fmt.Sprintf("%s, %ss %d-%d", where, unit, i+1, p.i)
+					} else {
+						loc = fmt.Sprintf("%s, %s %d", where, unit, i+1)
+					}
+				}
+				d.add(loc, pdfDiffTrim(old), pdfDiffTrim(new))
+			}
+		}
+		i, j = p.i+1, p.j+1
+	}
+}
+
+// pdfDiffTrim limits the number of lines reported for a difference
+func pdfDiffTrim(lines []string) []string {
+	const limit = 20
+	if len(lines) > limit {
+		lines = append(lines[:limit:limit], fmt.Sprintf("... %d more", len(lines)-limit))
+	}
+	return lines
+}
+
+// info compares the document information dictionaries
+func (d *pdfDiffer) info(ignore []string) {
+	info1, _ := d.r1.resolve(d.r1.trailer["Info"]).(pdfDict)
+	info2, _ := d.r2.resolve(d.r2.trailer["Info"]).(pdfDict)
+	keys := map[pdfName]bool{}
+	for key := range info1 {
+		keys[key] = true
+	}
+	for key := range info2 {
+		keys[key] = true
+	}
+	for _, key := range ignore {
+		delete(keys, pdfName(key))
+	}
+	var names []string
+	for key := range keys {
+		names = append(names, string(key))
+	}
+	sort.Strings(names)
+	for _, key := range names {
+		v1, v2 := d.r1.resolve(info1[pdfName(key)]), d.r2.resolve(info2[pdfName(key)])
+		if !d.equal(v1, v2) {
+			var old, new []string
+			if v1 != nil {
+				old = []string{pdfDiffText(v1)}
+			}
+			if v2 != nil {
+				new = []string{pdfDiffText(v2)}
+			}
+			d.add("info "+key, old, new)
+		}
+	}
+}
+
+var pdfDiffXMPVolatile = regexp.MustCompile(`(?s)<(xmp:(CreateDate|ModifyDate|MetadataDate)|xmpMM:(DocumentID|InstanceID))>.*?</[^>]*>|` +
+	`(xmp:(CreateDate|ModifyDate|MetadataDate)|xmpMM:(DocumentID|InstanceID))="[^"]*"`)
+
+// xmp returns the lines of the XMP metadata of the document without dates and
+// identifiers
+func (d *pdfDiffer) xmp(r *PDFReader) (lines []string) {
+	root, _ := r.resolve(r.trailer["Root"]).(pdfDict)
+	stm, ok := r.resolve(root["Metadata"]).(*pdfStream)
+	if !ok {
+		return
+	}
+	data, err := r.decode(stm)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	text := pdfDiffXMPVolatile.ReplaceAllString(string(data), "")
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return
+}
+
+// outline returns a line for each outline item: its title, indented by its
+// level, and the page it leads to
+func (d *pdfDiffer) outline(r *PDFReader) (lines []string) {
+	root, _ := r.resolve(r.trailer["Root"]).(pdfDict)
+	outlines, _ := r.resolve(root["Outlines"]).(pdfDict)
+	seen := map[pdfRef]bool{}
+	var walk func(node interface{}, level int)
+	walk = func(node interface{}, level int) {
+		for node != nil && level < 64 {
+			ref, _ := node.(pdfRef)
+			if seen[ref] {
+				return
+			}
+			seen[ref] = true
+			item, ok := r.resolve(node).(pdfDict)
+			if !ok {
+				return
+			}
+			line := strings.Repeat("  ", level) + pdfDiffText(r.resolve(item["Title"]))
+			if page := d.destPage(r, item); page > 0 {
+				line += fmt.Sprintf(" -> page %d", page)
+			}
+			lines = append(lines, line)
+			walk(item["First"], level+1)
+			node = item["Next"]
+		}
+	}
+	if outlines != nil {
+		walk(outlines["First"], 0)
+	}
+	return
+}
+
+// destPage returns the page number of the destination of an outline item or
+// a link annotation, or zero
+func (d *pdfDiffer) destPage(r *PDFReader, item pdfDict) int {
+	dest := r.resolve(item["Dest"])
+	if action, ok := r.resolve(item["A"]).(pdfDict); ok && dest == nil {
+		dest = r.resolve(action["D"])
+	}
+	if arr, ok := dest.(pdfArray); ok && len(arr) > 0 {
+		if ref, ok := arr[0].(pdfRef); ok {
+			return r.pageNum[ref.num]
+		}
+	}
+	return 0
+}
+
+// usage returns a line for each distinct font and image used by the pages of
+// a document, in sorted order
+func (d *pdfDiffer) usage(r *PDFReader) (fonts, images []string) {
+	fontSet, imageSet := map[string]bool{}, map[string]bool{}
+	seen := map[pdfRef]bool{}
+	var walk func(res pdfDict, depth int)
+	walk = func(res pdfDict, depth int) {
+		if fontDict, ok := r.resolve(res["Font"]).(pdfDict); ok {
+			for _, font := range fontDict {
+				fontSet[d.summary(r, font)] = true
+			}
+		}
+		xobjects, _ := r.resolve(res["XObject"]).(pdfDict)
+		for _, obj := range xobjects {
+			if ref, ok := obj.(pdfRef); ok {
+				if seen[ref] {
+					continue
+				}
+				seen[ref] = true
+			}
+			stm, ok := r.resolve(obj).(*pdfStream)
+			if !ok {
+				continue
+			}
+			switch stm.dict["Subtype"] {
+			case pdfName("Image"):
+				imageSet[d.summary(r, obj)] = true
+			case pdfName("Form"):
+				if sub, ok := r.resolve(stm.dict["Resources"]).(pdfDict); ok && depth < 16 {
+					walk(sub, depth+1)
+				}
+			}
+		}
+	}
+	for _, page := range r.pages {
+		if res, ok := r.resolve(page["Resources"]).(pdfDict); ok {
+			walk(res, 0)
+		}
+	}
+	for line := range fontSet {
+		fonts = append(fonts, line)
+	}
+	for line := range imageSet {
+		images = append(images, line)
+	}
+	sort.Strings(fonts)
+	sort.Strings(images)
+	return
+}
+
+// summary describes a resource in a line of the report
+func (d *pdfDiffer) summary(r *PDFReader, obj interface{}) string {
+	fp := d.fingerprint(r, obj)[:12]
+	switch v := r.resolve(obj).(type) {
+	case pdfDict:
+		if v["Type"] == pdfName("Font") {
+			line := fmt.Sprintf("%s %s", pdfDiffText(v["Subtype"]), pdfDiffSubsetName(pdfDiffText(r.resolve(v["BaseFont"]))))
+			if enc, ok := r.resolve(v["Encoding"]).(pdfName); ok {
+				line += " " + string(enc)
+			}
+			return line + " " + fp
+		}
+	case *pdfStream:
+		if v.dict["Subtype"] == pdfName("Image") {
+			cs := r.resolve(v.dict["ColorSpace"])
+			if arr, ok := cs.(pdfArray); ok && len(arr) > 0 {
+				cs = arr[0]
+			}
+			if v.dict["ImageMask"] == true {
+				cs = pdfName("mask")
+			}
+			return fmt.Sprintf("image %sx%s %s %s", pdfDiffText(r.resolve(v.dict["Width"])),
+				pdfDiffText(r.resolve(v.dict["Height"])), pdfDiffText(cs), fp)
+		}
+		return pdfDiffText(v.dict["Subtype"]) + " " + fp
+	}
+	return fp
+}
+
+// pdfDiffSubset matches the tag that prefixes the name of a font subset
+var pdfDiffSubset = regexp.MustCompile(`^(/?)[A-Z]{6}\+`)
+
+// pdfDiffSubsetName removes the subset tag from a font name, since the tag
+// may change with the characters used
+func pdfDiffSubsetName(name string) string {
+	return pdfDiffSubset.ReplaceAllString(name, "$1")
+}
+
+// fingerprint returns a checksum of the content of an object, following
+// references and decoding streams, so that equal objects have equal
+// fingerprints regardless of their object numbers, names of subsets and
+// compression
+func (d *pdfDiffer) fingerprint(r *PDFReader, obj interface{}) string {
+	cache := d.fprints[r]
+	ref, isRef := obj.(pdfRef)
+	if isRef {
+		if fp, ok := cache[ref]; ok {
+			return fp
+		}
+	}
+	var b strings.Builder
+	active := map[pdfRef]bool{}
+	var write func(obj interface{}, depth int)
+	write = func(obj interface{}, depth int) {
+		if depth > 32 {
+			b.WriteString("...")
+			return
+		}
+		if ref, ok := obj.(pdfRef); ok {
+			if active[ref] {
+				b.WriteString("<cycle>")
+				return
+			}
+			if page := r.pageNum[ref.num]; page > 0 {
+				fmt.Fprintf(&b, "<page %d>", page)
+				return
+			}
+			active[ref] = true
+			defer delete(active, ref)
+			obj = r.resolve(ref)
+		}
+		switch v := obj.(type) {
+		case pdfDict:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				switch key {
+				case "Parent", "P", "StructParent", "StructParents", "Length", "Filter", "DecodeParms":
+					continue
+				}
+				keys = append(keys, string(key))
+			}
+			sort.Strings(keys)
+			b.WriteString("<<")
+			for _, key := range keys {
+				b.WriteString("/" + key + " ")
+				write(v[pdfName(key)], depth+1)
+			}
+			b.WriteString(">>")
+		case pdfArray:
+			b.WriteByte('[')
+			for _, e := range v {
+				write(e, depth+1)
+				b.WriteByte(' ')
+			}
+			b.WriteByte(']')
+		case *pdfStream:
+			write(v.dict, depth+1)
+			data, err := r.decode(v)
+			if err != nil {
+				data = v.data
+			}
+			sum := sha1.Sum(data)
+			b.WriteString("stream ")
+			b.WriteString(hex.EncodeToString(sum[:]))
+		case pdfName:
+			b.WriteString(pdfDiffSubsetName("/" + string(v)))
+		default:
+			b.WriteString(pdfDiffText(v))
+		}
+		b.WriteByte(' ')
+	}
+	write(obj, 0)
+	sum := sha1.Sum([]byte(b.String()))
+	fp := hex.EncodeToString(sum[:])
+	if isRef {
+		cache[ref] = fp
+	}
+	return fp
+}
+
+// pdfDiffResourceOps lists the operators that refer to a named resource,
+// with the resource category and the index of the name among the operands;
+// -1 indicates the last operand
+var pdfDiffResourceOps = map[string]struct {
+	category pdfName
+	index    int
+}{
+	"Tf":  {"Font", 0},
+	"Do":  {"XObject", 0},
+	"gs":  {"ExtGState", 0},
+	"cs":  {"ColorSpace", 0},
+	"CS":  {"ColorSpace", 0},
+	"sh":  {"Shading", 0},
+	"scn": {"Pattern", -1},
+	"SCN": {"Pattern", -1},
+	"BDC": {"Properties", 1},
+}
+
+// page compares the boxes, resources, content and annotations of page n
+func (d *pdfDiffer) page(n int) {
+	p1, p2 := d.r1.pages[n-1], d.r2.pages[n-1]
+	where := fmt.Sprintf("page %d", n)
+	boxes := func(r *PDFReader, page pdfDict) (items []pdfDiffItem) {
+		for _, key := range []pdfName{"MediaBox", "CropBox", "BleedBox", "TrimBox", "ArtBox", "Rotate", "UserUnit"} {
+			if v := r.resolve(page[key]); v != nil {
+				items = append(items, pdfDiffItem{text: string(key) + " " + pdfDiffText(v), value: pdfArray{key, v}})
+			}
+		}
+		return
+	}
+	d.items(where+" boxes", "", boxes(d.r1, p1), boxes(d.r2, p2))
+	res1, _ := d.r1.resolve(p1["Resources"]).(pdfDict)
+	res2, _ := d.r2.resolve(p2["Resources"]).(pdfDict)
+	d.resources(where, res1, res2)
+	d.items(where+" content", "operator", d.content(d.r1, p1, res1), d.content(d.r2, p2, res2))
+	d.items(where+" annotations", "annotation", d.annotations(d.r1, p1), d.annotations(d.r2, p2))
+}
+
+// resources reports the resources with the same name and different content
+func (d *pdfDiffer) resources(where string, res1, res2 pdfDict) {
+	var categories []string
+	for category := range res1 {
+		categories = append(categories, string(category))
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		dict1, _ := d.r1.resolve(res1[pdfName(category)]).(pdfDict)
+		dict2, _ := d.r2.resolve(res2[pdfName(category)]).(pdfDict)
+		var names []string
+		for name := range dict1 {
+			if _, ok := dict2[name]; ok {
+				names = append(names, string(name))
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			obj1, obj2 := dict1[pdfName(name)], dict2[pdfName(name)]
+			if d.fingerprint(d.r1, obj1) != d.fingerprint(d.r2, obj2) {
+				d.add(fmt.Sprintf("%s resource %s /%s", where, category, name),
+					[]string{d.summary(d.r1, obj1)}, []string{d.summary(d.r2, obj2)})
+			}
+		}
+	}
+}
+
+// content returns the operators of the content stream of a page. Names of
+// resources are compared by the fingerprint of the resource.
+func (d *pdfDiffer) content(r *PDFReader, page, res pdfDict) (items []pdfDiffItem) {
+	var contents pdfArray
+	switch v := r.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		contents = pdfArray{v}
+	case pdfArray:
+		contents = v
+	}
+	var data []byte
+	for _, c := range contents {
+		if stm, ok := r.resolve(c).(*pdfStream); ok {
+			if buf, err := r.decode(stm); err == nil {
+				data = append(data, buf...)
+				data = append(data, '\n')
+			}
+		}
+	}
+	scanContent(data, func(op string, operands []interface{}) {
+		var text strings.Builder
+		value := pdfArray{pdfName(op)}
+		for j, operand := range operands {
+			text.WriteString(pdfDiffText(operand))
+			text.WriteByte(' ')
+			if ro, ok := pdfDiffResourceOps[op]; ok && (j == ro.index || (ro.index < 0 && j == len(operands)-1)) {
+				if name, ok := operand.(pdfName); ok {
+					if dict, ok := r.resolve(res[ro.category]).(pdfDict); ok {
+						if obj, ok := dict[name]; ok {
+							operand = pdfString(d.fingerprint(r, obj))
+						}
+					}
+				}
+			}
+			if op == "BI" {
+				sum := sha1.Sum(operand.(pdfString))
+				operand = pdfString(sum[:])
+				text.Reset()
+				text.WriteString("<inline image " + hex.EncodeToString(sum[:6]) + "> ")
+			}
+			value = append(value, operand)
+		}
+		text.WriteString(op)
+		items = append(items, pdfDiffItem{text: text.String(), value: value})
+	})
+	return
+}
+
+// annotations returns the annotations of a page with their type, rectangle,
+// text and destination
+func (d *pdfDiffer) annotations(r *PDFReader, page pdfDict) (items []pdfDiffItem) {
+	annots, _ := r.resolve(page["Annots"]).(pdfArray)
+	for _, obj := range annots {
+		annot, ok := r.resolve(obj).(pdfDict)
+		if !ok {
+			continue
+		}
+		value := pdfArray{r.resolve(annot["Subtype"]), r.resolve(annot["Rect"])}
+		text := pdfDiffText(value[0]) + " " + pdfDiffText(value[1])
+		for _, key := range []pdfName{"Contents", "T", "FT", "V", "Name"} {
+			if v := r.resolve(annot[key]); v != nil {
+				value = append(value, key, v)
+				text += fmt.Sprintf(" %s=%s", key, pdfDiffText(v))
+			}
+		}
+		if action, ok := r.resolve(annot["A"]).(pdfDict); ok {
+			for _, key := range []pdfName{"URI", "F"} {
+				if v := r.resolve(action[key]); v != nil {
+					value = append(value, key, v)
+					text += fmt.Sprintf(" %s=%s", key, pdfDiffText(v))
+				}
+			}
+		}
+		if n := d.destPage(r, annot); n > 0 {
+			value = append(value, pdfName("Dest"), n)
+			text += fmt.Sprintf(" -> page %d", n)
+		}
+		items = append(items, pdfDiffItem{text: text, value: value})
+	}
+	return
+}
+
+// pdfDiffText formats an object in PDF syntax for the report. Text strings
+// are decoded and quoted.
+func pdfDiffText(obj interface{}) string {
+	switch v := obj.(type) {
+	case nil:
+		return "null"
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case pdfName:
+		return "/" + string(v)
+	case pdfString:
+		if len(v) >= 2 && v[0] == 0xfe && v[1] == 0xff {
+			u := make([]uint16, 0, len(v)/2)
+			for j := 2; j+1 < len(v); j += 2 {
+				u = append(u, uint16(v[j])<<8|uint16(v[j+1]))
+			}
+			return strconv.Quote(string(utf16.Decode(u)))
+		}
+		return strconv.Quote(string(v))
+	case pdfRef:
+		return fmt.Sprintf("%d %d R", v.num, v.gen)
+	case pdfArray:
+		parts := make([]string, len(v))
+		for j, e := range v {
+			parts[j] = pdfDiffText(e)
+		}
+		return "[" + strings.Join(parts, " ") + "]"
+	case pdfDict:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for j, key := range keys {
+			parts[j] = "/" + key + " " + pdfDiffText(v[pdfName(key)])
+		}
+		return "<<" + strings.Join(parts, " ") + ">>"
+	case *pdfStream:
+		return "<stream>"
+	}
+	return fmt.Sprint(obj)
+}
@@ -0,0 +1,203 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pdfDiffTestDoc struct {
+	compress bool
+	created  time.Time
+	textY    float64
+	title    string
+	link     string
+	gray     uint8
+}
+
+func (doc pdfDiffTestDoc) output(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	for j := range img.Pix {
+		img.Pix[j] = doc.gray
+	}
+	img.Set(0, 0, color.Gray{Y: 255})
+	var imgBuf bytes.Buffer
+	if err := png.Encode(&imgBuf, img); err != nil {
+		t.Fatal(err)
+	}
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(doc.compress)
+	pdf.SetCreationDate(doc.created)
+	pdf.SetTitle(doc.title, true)
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.AddPage()
+	pdf.Bookmark("Start", 0, -1)
+	pdf.Text(20, doc.textY, "Hello")
+	pdf.SetFont("Times", "B", 12)
+	pdf.CellFormat(40, 10, "Link", "1", 1, "", false, 0, doc.link)
+	pdf.RegisterImageOptionsReader("img", ImageOptions{ImageType: "png"}, &imgBuf)
+	pdf.Image("img", 20, 60, 20, 0, false, "", 0, "")
+	pdf.AddPage()
+	pdf.Bookmark("Second", 1, -1)
+	pdf.Rect(20, 20, 50, 50, "D")
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func pdfDiffTest(t *testing.T, doc1, doc2 pdfDiffTestDoc, options PDFDiffOptions) PDFDiff {
+	t.Helper()
+	diff, err := DiffPDFs(doc1.output(t), doc2.output(t), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return diff
+}
+
+func TestDiffPDFs(t *testing.T) {
+	base := pdfDiffTestDoc{textY: 30, title: "Test", link: "https://example.com", gray: 100,
+		created: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	other := base
+	other.compress = true
+	other.created = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	if diff := pdfDiffTest(t, base, other, PDFDiffOptions{}); len(diff) > 0 {
+		t.Errorf("unexpected differences:\n%s", diff)
+	}
+
+	other = base
+	other.textY = 30.1
+	diff := pdfDiffTest(t, base, other, PDFDiffOptions{})
+	if len(diff) != 1 || !strings.HasPrefix(diff[0].Where, "page 1 content, operator ") {
+		t.Fatalf("unexpected differences:\n%s", diff)
+	}
+	report := diff.String()
+	if !strings.Contains(report, "- 56.69 756.85 Td\n+ 56.69 756.57 Td\n") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+	if diff = pdfDiffTest(t, base, other, PDFDiffOptions{Tolerance: 0.5}); len(diff) > 0 {
+		t.Errorf("difference within tolerance:\n%s", diff)
+	}
+
+	other = base
+	other.title = "Changed"
+	other.link = "https://example.org"
+	other.gray = 101
+	report = pdfDiffTest(t, base, other, PDFDiffOptions{}).String()
+	for _, s := range []string{
+		"info Title:\n- \"Test\"\n+ \"Changed\"\n",
+		"images, line 1:\n- image 4x4 /DeviceGray ",
+		"page 1 annotations, annotation 1:\n- /Link ",
+		"URI=\"https://example.org\"",
+	} {
+		if !strings.Contains(report, s) {
+			t.Errorf("report does not contain %q:\n%s", s, report)
+		}
+	}
+	if strings.Contains(report, "CreationDate") {
+		t.Errorf("ignored entry reported:\n%s", report)
+	}
+	if !strings.Contains(report, "page 1 content") {
+		t.Errorf("image name change not reported:\n%s", report)
+	}
+}
+
+func TestDiffPDFsOutline(t *testing.T) {
+	var buf1, buf2 bytes.Buffer
+	for j, buf := range []*bytes.Buffer{&buf1, &buf2} {
+		pdf := New("P", "mm", "A4", "")
+		pdf.SetFont("Helvetica", "", 12)
+		pdf.AddPage()
+		pdf.Bookmark("One", 0, -1)
+		if j == 1 {
+			pdf.AddPage()
+		}
+		pdf.Bookmark("Two", 1, -1)
+		if err := pdf.Output(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	diff, err := DiffPDFs(&buf1, &buf2, PDFDiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := diff.String()
+	for _, s := range []string{
+		"document:\n- 1 pages\n+ 2 pages\n",
+		"outline, line 2:\n-   \"Two\" -> page 1\n+   \"Two\" -> page 2\n",
+	} {
+		if !strings.Contains(report, s) {
+			t.Errorf("report does not contain %q:\n%s", s, report)
+		}
+	}
+	buf1.Reset()
+	if err = ComparePDFStructures(&buf1, &buf2, PDFDiffOptions{}); err == nil {
+		t.Errorf("empty document accepted")
+	}
+}
+
+func TestDiffItems(t *testing.T) {
+	d := &pdfDiffer{}
+	list := func(lines ...string) (items []pdfDiffItem) {
+		for _, line := range lines {
+			items = append(items, pdfDiffItem{text: line, value: line})
+		}
+		return
+	}
+	d.items("test", "line", list("a", "b", "c", "d", "e"), list("a", "x", "c", "e", "f"))
+	want := "test, line 2:\n- b\n+ x\ntest, line 4:\n- d\ntest, line 6:\n+ f\n"
+	if got := d.diff.String(); got != want {
+		t.Errorf("got\n%s\nexpected\n%s", got, want)
+	}
+}
+
+func TestDiffPDFsMetadata(t *testing.T) {
+	output := func(date, title string) *bytes.Buffer {
+		pdf := New("P", "mm", "A4", "")
+		pdf.SetXmpMetadata([]byte("<x:xmpmeta>\n<xmp:CreateDate>" + date + "</xmp:CreateDate>\n" +
+			"<dc:title>" + title + "</dc:title>\n<rdf:Description xmpMM:InstanceID=\"" + date + "\"/>\n</x:xmpmeta>"))
+		pdf.AddPage()
+		var buf bytes.Buffer
+		if err := pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return &buf
+	}
+	if err := ComparePDFStructures(output("2020-01-01", "A"), output("2021-01-01", "A"), PDFDiffOptions{}); err != nil {
+		t.Errorf("dates are compared: %s", err)
+	}
+	diff, err := DiffPDFs(output("2020-01-01", "A"), output("2020-01-01", "B"), PDFDiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "metadata, line 2:\n- <dc:title>A</dc:title>\n+ <dc:title>B</dc:title>\n"; diff.String() != want {
+		t.Errorf("got\n%s\nexpected\n%s", diff, want)
+	}
+}
@@ -0,0 +1,369 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImportedPage is a Template holding a page of an existing PDF document. It
+// is created with ImportPage and placed with UseTemplate or
+// UseTemplateScaled like any other template.
+type ImportedPage struct {
+	reader    *PDFReader
+	page      int
+	box       [4]float64 // page box in points
+	rotate    int
+	k         float64 // scale factor of the importing document
+	content   []byte
+	resources interface{}
+	group     interface{}
+}
+
+var errImportedSerialize = errors.New("bdf: imported pages cannot be serialized")
+
+// ImportPage reads page pageNum (starting at 1) of the document of r as a
+// template. boxStr selects the page boundary used as the template's bounding
+// box: "MediaBox", "CropBox" (the default when empty), "BleedBox",
+// "TrimBox" or "ArtBox". A missing box falls back to the crop box and then
+// to the media box. The page rotation is applied, so that the template
+// appears as the page is displayed. The fonts, images and other resources
+// of the page are copied into the document once per reader, however many
+// of its pages are imported.
+func (f *Bdf) ImportPage(r *PDFReader, pageNum int, boxStr string) Template {
+	if f.err != nil {
+		return nil
+	}
+	if r == nil || pageNum < 1 || pageNum > r.NumPages() {
+		f.SetErrorf("page %d is not available for import", pageNum)
+		return nil
+	}
+	boxStr = strings.TrimPrefix(boxStr, "/")
+	if boxStr == "" {
+		boxStr = "CropBox"
+	}
+	switch boxStr {
+	case "MediaBox", "CropBox", "BleedBox", "TrimBox", "ArtBox":
+	default:
+		f.SetErrorf("unknown page box %s", boxStr)
+		return nil
+	}
+	page := r.pages[pageNum-1]
+	p := &ImportedPage{reader: r, page: pageNum, k: f.k}
+	found := false
+	for _, key := range []pdfName{pdfName(boxStr), "CropBox", "MediaBox"} {
+		if arr, ok := r.resolve(page[key]).(pdfArray); ok && len(arr) == 4 {
+			for j := range p.box {
+				p.box[j] = pdfNumber(r.resolve(arr[j]))
+			}
+			found = true
+			break
+		}
+	}
+	if !found {
+		// default to A4 when the page does not declare its size
+		p.box = [4]float64{0, 0, 595.28, 841.89}
+	}
+	if p.box[0] > p.box[2] {
+		p.box[0], p.box[2] = p.box[2], p.box[0]
+	}
+	if p.box[1] > p.box[3] {
+		p.box[1], p.box[3] = p.box[3], p.box[1]
+	}
+	if rot, ok := r.resolve(page["Rotate"]).(int); ok {
+		p.rotate = ((rot % 360) + 360) % 360
+	}
+	var contents pdfArray
+	switch v := r.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		contents = pdfArray{v}
+	case pdfArray:
+		contents = v
+	}
+	for _, c := range contents {
+		stm, ok := r.resolve(c).(*pdfStream)
+		if !ok {
+			continue
+		}
+		data, err := r.decode(stm)
+		if err != nil {
+			f.err = fmt.Errorf("page %d: %v", pageNum, err)
+			return nil
+		}
+		p.content = append(p.content, data...)
+		p.content = append(p.content, '\n')
+	}
+	p.resources = page["Resources"]
+	p.group = page["Group"]
+	return p
+}
+
+// pdfNumber converts an int or float64 object to float64
+func pdfNumber(obj interface{}) float64 {
+	switch v := obj.(type) {
+	case int:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// ID returns the global template identifier
+func (p *ImportedPage) ID() string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("%s %d %v", p.reader.id, p.page, p.box))))
+}
+
+// Size gives the dimensions of the page box, as displayed, in the unit of
+// measure of the importing document
+func (p *ImportedPage) Size() (PointType, SizeType) {
+	w, h := (p.box[2]-p.box[0])/p.k, (p.box[3]-p.box[1])/p.k
+	if p.rotate == 90 || p.rotate == 270 {
+		w, h = h, w
+	}
+	return PointType{0, 0}, SizeType{Wd: w, Ht: h}
+}
+
+// Bytes returns the decoded content stream of the page
+func (p *ImportedPage) Bytes() []byte {
+	return p.content
+}
+
+// Images returns nil; the images of an imported page are part of its own
+// resources
+func (p *ImportedPage) Images() map[string]*ImageInfoType {
+	return nil
+}
+
+// Templates returns nil
+func (p *ImportedPage) Templates() []Template {
+	return nil
+}
+
+// NumPages returns 1
+func (p *ImportedPage) NumPages() int {
+	return 1
+}
+
+// FromPage returns the template itself for page 1
+func (p *ImportedPage) FromPage(page int) (Template, error) {
+	if page != 1 {
+		return nil, fmt.Errorf("bdf: the template does not have a page %d", page)
+	}
+	return p, nil
+}
+
+// FromPages returns a slice holding the template
+func (p *ImportedPage) FromPages() []Template {
+	return []Template{p}
+}
+
+// Serialize is not supported for imported pages
+func (p *ImportedPage) Serialize() ([]byte, error) {
+	return nil, errImportedSerialize
+}
+
+// GobEncode is not supported for imported pages
+func (p *ImportedPage) GobEncode() ([]byte, error) {
+	return nil, errImportedSerialize
+}
+
+// GobDecode is not supported for imported pages
+func (p *ImportedPage) GobDecode([]byte) error {
+	return errImportedSerialize
+}
+
+// matrix maps the page box, rotated as displayed, to the origin
+func (p *ImportedPage) matrix() string {
+	m := pdfDisplayMatrix(p.box, p.rotate)
+	return fmt.Sprintf("[%s %s %s %s %.4f %.4f]", strconv.FormatFloat(m[0], 'f', -1, 64),
+		strconv.FormatFloat(m[1], 'f', -1, 64), strconv.FormatFloat(m[2], 'f', -1, 64),
+		strconv.FormatFloat(m[3], 'f', -1, 64), m[4], m[5])
+}
+
+// pdfDisplayMatrix returns the matrix that maps the page box, rotated by
+// rotate degrees as displayed, to the origin
+func pdfDisplayMatrix(box [4]float64, rotate int) [6]float64 {
+	llx, lly, urx, ury := box[0], box[1], box[2], box[3]
+	switch rotate {
+	case 90:
+		return [6]float64{0, -1, 1, 0, -lly, urx}
+	case 180:
+		return [6]float64{-1, 0, 0, -1, urx, ury}
+	case 270:
+		return [6]float64{0, 1, -1, 0, ury, -llx}
+	}
+	return [6]float64{1, 0, 0, 1, -llx, -lly}
+}
+
+// putImportedPage copies the objects used by the resources of an imported
+// page and writes the page as a form XObject
+func (f *Bdf) putImportedPage(p *ImportedPage) {
+	r := p.reader
+	if f.importedPDFs == nil {
+		f.importedPDFs = make(map[*PDFReader]map[int]int)
+	}
+	objMap := f.importedPDFs[r]
+	if objMap == nil {
+		objMap = make(map[int]int)
+		f.importedPDFs[r] = objMap
+	}
+	// Number the objects not copied yet in the order they will be written.
+	var queue []int
+	var walk func(obj interface{})
+	walk = func(obj interface{}) {
+		switch v := obj.(type) {
+		case pdfRef:
+			if _, ok := objMap[v.num]; ok {
+				return
+			}
+			target := r.object(v.num)
+			if d, ok := target.(pdfDict); target == nil || ok && (d["Type"] == pdfName("Page") || d["Type"] == pdfName("Pages")) {
+				// references to the page tree are dropped
+				objMap[v.num] = 0
+				return
+			}
+			objMap[v.num] = f.n + 1 + len(queue)
+			queue = append(queue, v.num)
+			walk(target)
+		case pdfArray:
+			for _, e := range v {
+				walk(e)
+			}
+		case pdfDict:
+			for key, e := range v {
+				if key != "Parent" {
+					walk(e)
+				}
+			}
+		case *pdfStream:
+			walk(v.dict)
+		}
+	}
+	walk(p.resources)
+	walk(p.group)
+	for _, num := range queue {
+		f.newobj()
+		switch obj := r.object(num).(type) {
+		case *pdfStream:
+			dict := pdfDict{}
+			for key, e := range obj.dict {
+				if key != "Length" {
+					dict[key] = e
+				}
+			}
+			s := f.importSerialize(dict, objMap)
+			f.outf("%s /Length %d>>", s[:len(s)-2], len(obj.data))
+			f.putstream(obj.data)
+		default:
+			f.out(f.importSerialize(obj, objMap))
+		}
+		f.out("endobj")
+	}
+	f.newobj()
+	f.templateObjects[p.ID()] = f.n
+	f.outf("<</Type /XObject /Subtype /Form /FormType 1 /BBox [%.4f %.4f %.4f %.4f] /Matrix %s",
+		p.box[0], p.box[1], p.box[2], p.box[3], p.matrix())
+	if p.resources != nil {
+		f.out("/Resources " + f.importSerialize(p.resources, objMap))
+	}
+	if p.group != nil {
+		f.out("/Group " + f.importSerialize(p.group, objMap))
+	}
+	buffer := p.content
+	var mem *membuffer
+	if f.compress {
+		mem = xmem.compress(buffer)
+		buffer = mem.bytes()
+		f.out("/Filter /FlateDecode")
+	}
+	f.outf("/Length %d>>", len(buffer))
+	f.putstream(buffer)
+	f.out("endobj")
+	if mem != nil {
+		mem.release()
+	}
+}
+
+// importSerialize returns the PDF syntax of an object read by a PDFReader,
+// renumbering indirect references with objMap. Strings are written with
+// textstring so that they are encrypted along with the document.
+func (f *Bdf) importSerialize(obj interface{}, objMap map[int]int) string {
+	var b strings.Builder
+	var write func(obj interface{})
+	write = func(obj interface{}) {
+		switch v := obj.(type) {
+		case nil:
+			b.WriteString("null")
+		case bool:
+			b.WriteString(strconv.FormatBool(v))
+		case int:
+			b.WriteString(strconv.Itoa(v))
+		case float64:
+			b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+		case pdfName:
+			b.WriteString(formName(string(v)))
+		case pdfString:
+			b.WriteString(f.textstring(string(v)))
+		case pdfRef:
+			if n := objMap[v.num]; n > 0 {
+				fmt.Fprintf(&b, "%d 0 R", n)
+			} else {
+				b.WriteString("null")
+			}
+		case pdfArray:
+			b.WriteByte('[')
+			for j, e := range v {
+				if j > 0 {
+					b.WriteByte(' ')
+				}
+				write(e)
+			}
+			b.WriteByte(']')
+		case pdfDict:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, string(key))
+			}
+			sort.Strings(keys)
+			b.WriteString("<<")
+			for _, key := range keys {
+				b.WriteString(formName(key))
+				b.WriteByte(' ')
+				write(v[pdfName(key)])
+				b.WriteByte(' ')
+			}
+			b.WriteString(">>")
+		case *pdfStream:
+			// streams are always indirect; a direct one cannot be copied
+			b.WriteString("null")
+		default:
+			b.WriteString("null")
+		}
+	}
+	write(obj)
+	return b.String()
+}
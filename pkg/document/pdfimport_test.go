@@ -0,0 +1,278 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestImportPage(t *testing.T) {
+	src := New("P", "mm", "A4", "")
+	src.SetFont("Helvetica", "B", 14)
+	src.AddPage()
+	src.Cell(40, 10, "Letterhead page one")
+	src.AddPageFormat("L", SizeType{Wd: 210, Ht: 297})
+	src.Cell(40, 10, "Letterhead page two")
+	var srcBuf bytes.Buffer
+	if err := src.Output(&srcBuf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewPDFReader(&srcBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.NumPages() != 2 {
+		t.Fatalf("expected 2 pages, got %d", r.NumPages())
+	}
+
+	pdf := New("P", "mm", "A4", "")
+	tpl := pdf.ImportPage(r, 2, "")
+	if tpl == nil {
+		t.Fatal(pdf.Error())
+	}
+	if _, size := tpl.Size(); size.Wd < 296 || size.Wd > 298 || size.Ht < 209 || size.Ht > 211 {
+		t.Errorf("unexpected template size %v", size)
+	}
+	pdf.AddPage()
+	pdf.UseTemplateScaled(tpl, PointType{X: 10, Y: 10}, SizeType{Wd: 95, Ht: 67})
+	pdf.UseTemplateScaled(pdf.ImportPage(r, 1, "MediaBox"), PointType{X: 110, Y: 10}, SizeType{Wd: 67, Ht: 95})
+	var out bytes.Buffer
+	if err = pdf.Output(&out); err != nil {
+		t.Fatal(err)
+	}
+	// Read the result back and check the template content and its font.
+	r2, err := NewPDFReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ := r2.resolve(r2.pages[0]["Resources"]).(pdfDict)
+	xobjs, _ := r2.resolve(res["XObject"]).(pdfDict)
+	if len(xobjs) != 2 {
+		t.Fatalf("expected 2 template XObjects, got %v", xobjs)
+	}
+	var texts []string
+	for _, ref := range xobjs {
+		stm, ok := r2.resolve(ref).(*pdfStream)
+		if !ok {
+			t.Fatal("template is not a stream")
+		}
+		data, err := r2.decode(stm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, string(data))
+		tres, _ := r2.resolve(stm.dict["Resources"]).(pdfDict)
+		fonts, _ := r2.resolve(tres["Font"]).(pdfDict)
+		for _, fnt := range fonts {
+			fd, _ := r2.resolve(fnt).(pdfDict)
+			if fd["BaseFont"] != pdfName("Helvetica-Bold") {
+				t.Errorf("unexpected font %v", fd)
+			}
+		}
+	}
+	all := strings.Join(texts, "")
+	for _, w := range []string{"(Letterhead page one)", "(Letterhead page two)"} {
+		if !strings.Contains(all, w) {
+			t.Errorf("imported content does not contain %q", w)
+		}
+	}
+	// both pages share the font object: copied only once
+	if n := bytes.Count(out.Bytes(), []byte("/BaseFont /Helvetica-Bold")); n != 1 {
+		t.Errorf("font copied %d times", n)
+	}
+}
+
+// xrefStreamPDF builds a document whose catalog, page tree and page are
+// stored in an object stream, indexed by a cross-reference stream that uses
+// the PNG up predictor
+func xrefStreamPDF(t *testing.T) []byte {
+	t.Helper()
+	deflate := func(b []byte) []byte {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	}
+	var doc bytes.Buffer
+	doc.WriteString("%PDF-1.5\n")
+	offsets := map[int]int{}
+	content := []byte("BT /F1 12 Tf 72 720 Td (Packed page) Tj ET")
+	offsets[4] = doc.Len()
+	fmt.Fprintf(&doc, "4 0 obj\n<</Length %d>>\nstream\n%s\nendstream\nendobj\n", len(content), content)
+	objs := []string{
+		"<</Type /Catalog /Pages 2 0 R>>",
+		"<</Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 612 792]>>",
+		"<</Type /Page /Parent 2 0 R /Contents 4 0 R /Resources <</Font <</F1 <</Type /Font /Subtype /Type1 /BaseFont /Courier>>>>>>>>",
+	}
+	var header, body strings.Builder
+	for j, o := range objs {
+		fmt.Fprintf(&header, "%d %d ", j+1, body.Len())
+		body.WriteString(o + "\n")
+	}
+	stm := deflate([]byte(header.String() + body.String()))
+	offsets[5] = doc.Len()
+	fmt.Fprintf(&doc, "5 0 obj\n<</Type /ObjStm /N 3 /First %d /Filter /FlateDecode /Length %d>>\nstream\n",
+		header.Len(), len(stm))
+	doc.Write(stm)
+	doc.WriteString("\nendstream\nendobj\n")
+	offsets[6] = doc.Len()
+	// rows of type (1 byte), field 2 (2 bytes), field 3 (1 byte)
+	rows := [][4]byte{
+		{0, 0, 0, 255},
+		{2, 0, 5, 0},
+		{2, 0, 5, 1},
+		{2, 0, 5, 2},
+		{1, byte(offsets[4] >> 8), byte(offsets[4]), 0},
+		{1, byte(offsets[5] >> 8), byte(offsets[5]), 0},
+		{1, byte(offsets[6] >> 8), byte(offsets[6]), 0},
+	}
+	var raw []byte
+	prev := [4]byte{}
+	for _, row := range rows {
+		raw = append(raw, 2)
+		for j := range row {
+			raw = append(raw, row[j]-prev[j])
+		}
+		prev = row
+	}
+	xs := deflate(raw)
+	fmt.Fprintf(&doc, "6 0 obj\n<</Type /XRef /Size 7 /W [1 2 1] /Root 1 0 R /Filter /FlateDecode "+
+		"/DecodeParms <</Predictor 12 /Columns 4>> /Length %d>>\nstream\n", len(xs))
+	doc.Write(xs)
+	fmt.Fprintf(&doc, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", offsets[6])
+	return doc.Bytes()
+}
+
+func TestPDFReaderXrefStream(t *testing.T) {
+	data := xrefStreamPDF(t)
+	r, err := NewPDFReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.NumPages() != 1 {
+		t.Fatalf("expected 1 page, got %d", r.NumPages())
+	}
+	if _, ok := r.xref[1]; !ok || r.xref[1].typ != 2 {
+		t.Error("catalog not located in the object stream")
+	}
+	pdf := New("P", "pt", "Letter", "")
+	pdf.SetCompression(false)
+	tpl := pdf.ImportPage(r, 1, "CropBox")
+	pdf.AddPage()
+	pdf.UseTemplate(tpl)
+	var out bytes.Buffer
+	if err = pdf.Output(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []string{"(Packed page) Tj", "/BaseFont /Courier", "/BBox [0.0000 0.0000 612.0000 792.0000]"} {
+		if !bytes.Contains(out.Bytes(), []byte(w)) {
+			t.Errorf("output does not contain %q", w)
+		}
+	}
+
+	// damaged cross-reference offsets are recovered by scanning
+	broken := bytes.Replace(data, []byte(fmt.Sprintf("startxref\n%d", bytes.Index(data, []byte("6 0 obj")))),
+		[]byte("startxref\n9"), 1)
+	if _, err = NewPDFReader(bytes.NewReader(broken)); err != nil {
+		t.Errorf("recovery failed: %v", err)
+	}
+}
+
+// rawPDF assembles a document from the bodies of objects 1, 2 and so on,
+// with a classic cross-reference table
+func rawPDF(objects ...string) []byte {
+	var doc bytes.Buffer
+	doc.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for j, obj := range objects {
+		offsets[j] = doc.Len()
+		fmt.Fprintf(&doc, "%d 0 obj\n%s\nendobj\n", j+1, obj)
+	}
+	xref := doc.Len()
+	fmt.Fprintf(&doc, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&doc, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&doc, "trailer\n<</Size %d /Root 1 0 R>>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return doc.Bytes()
+}
+
+func TestPDFReaderMalformed(t *testing.T) {
+	const content = "BT /F1 12 Tf (Damaged) Tj ET"
+	page := func(length string) []byte {
+		return rawPDF(
+			"<</Type /Catalog /Pages 2 0 R>>",
+			"<</Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 200 200]>>",
+			"<</Type /Page /Parent 2 0 R /Contents 4 0 R>>",
+			"<</Length "+length+">>\nstream\n"+content+"\nendstream",
+		)
+	}
+	good := page(fmt.Sprint(len(content)))
+	entry := func(doc []byte, num int) []byte {
+		pos := bytes.Index(doc, []byte("0000000000 65535 f \n")) + 20*num
+		return doc[pos : pos+10]
+	}
+	for name, data := range map[string][]byte{
+		// the length of a stream refers to the stream itself
+		"own length":      page("4 0 R"),
+		"negative length": page("-5"),
+		"huge length":     page("9223372036854775000"),
+		"negative offset": func() []byte {
+			doc := append([]byte(nil), good...)
+			copy(entry(doc, 4), "-000000009")
+			return doc
+		}(),
+		"offset past the end": func() []byte {
+			doc := append([]byte(nil), good...)
+			copy(entry(doc, 4), "9999999999")
+			return doc
+		}(),
+		"negative XRefStm": bytes.Replace(good, []byte("/Root 1 0 R"), []byte("/Root 1 0 R /XRefStm -7"), 1),
+	} {
+		r, err := NewPDFReader(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		stm, ok := r.resolve(pdfRef{num: 4}).(*pdfStream)
+		if !ok || string(stm.data) != content {
+			t.Errorf("%s: content stream not recovered", name)
+		}
+	}
+	// An offset inside an object stream that lies outside its data
+	objStm := rawPDF(
+		"<</Type /Catalog /Pages 2 0 R>>",
+		"<</Type /Pages /Kids [] /Count 0>>",
+		"<</Type /ObjStm /N 1 /First 5 /Length 12>>\nstream\n9 -40 <<>>\nendstream",
+	)
+	r, err := NewPDFReader(bytes.NewReader(objStm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.objStmObject(3, 9); err == nil {
+		t.Error("invalid offset in object stream accepted")
+	}
+}
@@ -0,0 +1,1051 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+
+	"golang.org/x/image/tiff/lzw"
+)
+
+// The PDF object model of the reader. Objects are represented by
+// nil (null), bool, int, float64, pdfName, pdfString, pdfArray, pdfDict,
+// pdfRef and *pdfStream values.
+
+type pdfName string
+
+type pdfString []byte
+
+type pdfArray []interface{}
+
+type pdfDict map[pdfName]interface{}
+
+type pdfRef struct {
+	num, gen int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	data []byte // raw, still encoded, stream data
+}
+
+type pdfKeyword string
+
+var errPDFSyntax = errors.New("pdf: syntax error")
+
+// pdfLexer tokenizes PDF data starting at an offset
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isPDFDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skipSpace moves past white space and comments
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// regular returns the run of regular characters at the current position
+func (l *pdfLexer) regular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// token returns the next token: a delimiter such as "<<" or "[", or a
+// complete name, string, number or keyword object
+func (l *pdfLexer) token() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	c := l.data[l.pos]
+	switch c {
+	case '[', ']', '{', '}':
+		l.pos++
+		return pdfKeyword(c), nil
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), nil
+		}
+		return l.hexString()
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>"), nil
+		}
+		return nil, errPDFSyntax
+	case '(':
+		return l.literalString()
+	case '/':
+		l.pos++
+		return l.name(), nil
+	case ')':
+		return nil, errPDFSyntax
+	}
+	word := l.regular()
+	if word == "" {
+		return nil, errPDFSyntax
+	}
+	if (word[0] >= '0' && word[0] <= '9') || word[0] == '-' || word[0] == '+' || word[0] == '.' {
+		if n, err := strconv.Atoi(word); err == nil {
+			return n, nil
+		}
+		if v, err := strconv.ParseFloat(word, 64); err == nil {
+			return v, nil
+		}
+	}
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+// scanContent splits a content stream into operators and calls fnc with
+// each operator and its operands. An inline image is reported as operator
+// "BI" with the bytes of the image, from its dictionary to its data, as the
+// only operand.
+func scanContent(content []byte, fnc func(op string, operands []interface{})) {
+	l := &pdfLexer{data: content}
+	var operands []interface{}
+	for {
+		tok, err := l.token()
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			// skip the offending character
+			l.pos++
+			operands = operands[:0]
+			continue
+		}
+		if kw, ok := tok.(pdfKeyword); ok && kw != "[" && kw != "<<" {
+			if kw == "BI" {
+				start := l.pos
+				l.skipInlineImage()
+				fnc("BI", []interface{}{pdfString(bytes.TrimSpace(l.data[start:l.pos]))})
+			} else {
+				fnc(string(kw), operands)
+			}
+			operands = operands[:0]
+			continue
+		}
+		obj, err := l.complete(tok)
+		if err != nil {
+			break
+		}
+		operands = append(operands, obj)
+	}
+}
+
+// skipInlineImage moves past the dictionary and data of an inline image,
+// up to and including the EI operator
+func (l *pdfLexer) skipInlineImage() {
+	pos := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if pos < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += pos + 2
+	for l.pos < len(l.data) {
+		pos = bytes.Index(l.data[l.pos:], []byte("EI"))
+		if pos < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		l.pos += pos + 2
+		if pos > 0 && isPDFSpace(l.data[l.pos-3]) && (l.pos == len(l.data) || isPDFSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
+
+func (l *pdfLexer) name() pdfName {
+	raw := l.regular()
+	if !bytes.ContainsRune([]byte(raw), '#') {
+		return pdfName(raw)
+	}
+	var b []byte
+	for j := 0; j < len(raw); j++ {
+		if raw[j] == '#' && j+2 < len(raw) {
+			if v, err := strconv.ParseUint(raw[j+1:j+3], 16, 8); err == nil {
+				b = append(b, byte(v))
+				j += 2
+				continue
+			}
+		}
+		b = append(b, raw[j])
+	}
+	return pdfName(b)
+}
+
+func (l *pdfLexer) hexString() (interface{}, error) {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	if l.pos >= len(l.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	s := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(s, digits); err != nil {
+		return nil, errPDFSyntax
+	}
+	return pdfString(s), nil
+}
+
+func (l *pdfLexer) literalString() (interface{}, error) {
+	l.pos++
+	var s []byte
+	depth := 0
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return pdfString(s), nil
+			}
+			depth--
+		case '\\':
+			if l.pos >= len(l.data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// line continuation
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for k := 0; k < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; k++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				}
+			}
+		case '\r':
+			// end of line markers are read as a line feed
+			if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+				l.pos++
+			}
+			c = '\n'
+		}
+		s = append(s, c)
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// object parses the next complete object. Indirect references are
+// recognized by looking ahead for "gen R".
+func (l *pdfLexer) object() (interface{}, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	return l.complete(tok)
+}
+
+func (l *pdfLexer) complete(tok interface{}) (interface{}, error) {
+	switch t := tok.(type) {
+	case pdfKeyword:
+		switch t {
+		case "[":
+			var arr pdfArray
+			for {
+				tok, err := l.token()
+				if err != nil {
+					return nil, err
+				}
+				if tok == pdfKeyword("]") {
+					return arr, nil
+				}
+				obj, err := l.complete(tok)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, obj)
+			}
+		case "<<":
+			dict := pdfDict{}
+			for {
+				tok, err := l.token()
+				if err != nil {
+					return nil, err
+				}
+				if tok == pdfKeyword(">>") {
+					return dict, nil
+				}
+				key, ok := tok.(pdfName)
+				if !ok {
+					return nil, errPDFSyntax
+				}
+				val, err := l.object()
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = val
+			}
+		}
+		return t, nil
+	case int:
+		// look ahead for an indirect reference
+		save := l.pos
+		if gen, err := l.token(); err == nil {
+			if g, ok := gen.(int); ok {
+				if r, err := l.token(); err == nil && r == pdfKeyword("R") {
+					return pdfRef{t, g}, nil
+				}
+			}
+		}
+		l.pos = save
+	}
+	return tok, nil
+}
+
+type xrefEntry struct {
+	typ    int // 1 for objects at offset, 2 for objects in object streams
+	offset int // byte offset, or object stream number
+	index  int // index within the object stream
+}
+
+// PDFReader gives access to the pages of an existing, unencrypted PDF
+// document. It reads cross-reference tables and streams, object streams and
+// Flate, ASCII hex and ASCII 85 encoded streams.
+type PDFReader struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	trailer pdfDict
+	cache   map[int]interface{}
+	objStms map[int]*pdfObjStm
+	pages   []pdfDict   // page dictionaries with inherited attributes
+	pageNum map[int]int // page numbers, 1-based, by object number
+	id      string
+	xrefPos int // offset of the most recent cross-reference section, 0 when recovered
+}
+
+type pdfObjStm struct {
+	data    []byte
+	offsets map[int]int // object number to offset in data
+}
+
+// NewPDFReader reads a PDF document from r
+func NewPDFReader(r io.Reader) (*PDFReader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return newPDFReader(data)
+}
+
+// NewPDFReaderFromFile reads the PDF document stored in fileStr
+func NewPDFReaderFromFile(fileStr string) (*PDFReader, error) {
+	data, err := os.ReadFile(fileStr)
+	if err != nil {
+		return nil, err
+	}
+	return newPDFReader(data)
+}
+
+func newPDFReader(data []byte) (*PDFReader, error) {
+	if !bytes.Contains(data[:minInt(len(data), 1024)], []byte("%PDF-")) {
+		return nil, errors.New("pdf: missing header")
+	}
+	r := &PDFReader{
+		data:    data,
+		xref:    make(map[int]xrefEntry),
+		cache:   make(map[int]interface{}),
+		objStms: make(map[int]*pdfObjStm),
+		pageNum: make(map[int]int),
+	}
+	if err := r.readXref(); err != nil {
+		// damaged cross-reference information; locate objects by scanning
+		r.xref = make(map[int]xrefEntry)
+		r.xrefPos = 0
+		if err = r.recoverXref(); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := r.trailer["Encrypt"]; ok {
+		return nil, errors.New("pdf: encrypted documents are not supported")
+	}
+	root, ok := r.resolve(r.trailer["Root"]).(pdfDict)
+	if !ok {
+		return nil, errors.New("pdf: document catalog not found")
+	}
+	if err := r.collectPages(root["Pages"], pdfDict{}, 0); err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(data)
+	r.id = hex.EncodeToString(sum[:8])
+	return r, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// NumPages returns the number of pages of the document
+func (r *PDFReader) NumPages() int {
+	return len(r.pages)
+}
+
+var startxrefRe = regexp.MustCompile(`startxref\s+(\d+)`)
+
+// readXref loads the cross-reference sections, starting with the last one
+func (r *PDFReader) readXref() error {
+	tail := r.data[max(0, len(r.data)-2048):]
+	all := startxrefRe.FindAllSubmatch(tail, -1)
+	if all == nil {
+		return errors.New("pdf: startxref not found")
+	}
+	offset, _ := strconv.Atoi(string(all[len(all)-1][1]))
+	r.xrefPos = offset
+	seen := map[int]bool{}
+	for offset > 0 {
+		if seen[offset] || offset >= len(r.data) {
+			return errors.New("pdf: invalid cross-reference offset")
+		}
+		seen[offset] = true
+		trailer, err := r.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		if r.trailer == nil {
+			r.trailer = trailer
+		}
+		// hybrid files keep the entries of compressed objects in a stream
+		if stm, ok := trailer["XRefStm"].(int); ok && stm > 0 && stm < len(r.data) && !seen[stm] {
+			seen[stm] = true
+			if _, err = r.readXrefSection(stm); err != nil {
+				return err
+			}
+		}
+		offset, _ = trailer["Prev"].(int)
+	}
+	return nil
+}
+
+// readXrefSection reads a cross-reference table or stream at offset and
+// returns its trailer dictionary. Entries already known from a more recent
+// section are kept.
+func (r *PDFReader) readXrefSection(offset int) (pdfDict, error) {
+	l := &pdfLexer{data: r.data, pos: offset}
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == pdfKeyword("xref") {
+		return r.readXrefTable(l)
+	}
+	// a cross-reference stream: "num gen obj << ... >> stream"
+	obj, err := r.parseIndirect(offset)
+	if err != nil {
+		return nil, err
+	}
+	stm, ok := obj.(*pdfStream)
+	if !ok || stm.dict["Type"] != pdfName("XRef") {
+		return nil, errors.New("pdf: invalid cross-reference stream")
+	}
+	data, err := r.decode(stm)
+	if err != nil {
+		return nil, err
+	}
+	w, _ := stm.dict["W"].(pdfArray)
+	if len(w) != 3 {
+		return nil, errors.New("pdf: invalid cross-reference stream widths")
+	}
+	var widths [3]int
+	for j := range widths {
+		widths[j], _ = w[j].(int)
+	}
+	index, _ := stm.dict["Index"].(pdfArray)
+	if index == nil {
+		size, _ := stm.dict["Size"].(int)
+		index = pdfArray{0, size}
+	}
+	rowLen := widths[0] + widths[1] + widths[2]
+	field := func(b []byte) int {
+		v := 0
+		for _, c := range b {
+			v = v<<8 | int(c)
+		}
+		return v
+	}
+	pos := 0
+	for j := 0; j+1 < len(index); j += 2 {
+		first, _ := index[j].(int)
+		count, _ := index[j+1].(int)
+		for k := 0; k < count; k++ {
+			if pos+rowLen > len(data) {
+				return nil, errors.New("pdf: truncated cross-reference stream")
+			}
+			row := data[pos : pos+rowLen]
+			pos += rowLen
+			typ := 1
+			if widths[0] > 0 {
+				typ = field(row[:widths[0]])
+			}
+			e := xrefEntry{typ, field(row[widths[0] : widths[0]+widths[1]]), field(row[widths[0]+widths[1]:])}
+			if typ == 1 && (e.offset < 0 || e.offset >= len(r.data)) {
+				return nil, fmt.Errorf("pdf: invalid offset of object %d", first+k)
+			}
+			if _, ok := r.xref[first+k]; !ok && typ != 0 {
+				r.xref[first+k] = e
+			} else if !ok {
+				r.xref[first+k] = xrefEntry{}
+			}
+		}
+	}
+	return stm.dict, nil
+}
+
+// readXrefTable reads the subsections of a classic cross-reference table
+// and its trailer
+func (r *PDFReader) readXrefTable(l *pdfLexer) (pdfDict, error) {
+	for {
+		tok, err := l.token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == pdfKeyword("trailer") {
+			obj, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			trailer, ok := obj.(pdfDict)
+			if !ok {
+				return nil, errPDFSyntax
+			}
+			return trailer, nil
+		}
+		first, ok := tok.(int)
+		if !ok {
+			return nil, errPDFSyntax
+		}
+		tok, err = l.token()
+		count, ok := tok.(int)
+		if err != nil || !ok {
+			return nil, errPDFSyntax
+		}
+		for k := 0; k < count; k++ {
+			off, err1 := l.token()
+			_, err2 := l.token()
+			kind, err3 := l.token()
+			if err1 != nil || err2 != nil || err3 != nil {
+				return nil, errPDFSyntax
+			}
+			n := first + k
+			if _, known := r.xref[n]; known {
+				continue
+			}
+			if kind == pdfKeyword("n") {
+				o, ok := off.(int)
+				if !ok || o < 0 || o >= len(r.data) {
+					return nil, fmt.Errorf("pdf: invalid offset of object %d", n)
+				}
+				r.xref[n] = xrefEntry{typ: 1, offset: o}
+			} else {
+				r.xref[n] = xrefEntry{}
+			}
+		}
+	}
+}
+
+var objHeaderRe = regexp.MustCompile(`(?m)(\d+)\s+(\d+)\s+obj\b`)
+
+// recoverXref rebuilds the cross-reference information by scanning the file
+// for object headers and trailer dictionaries
+func (r *PDFReader) recoverXref() error {
+	for _, m := range objHeaderRe.FindAllSubmatchIndex(r.data, -1) {
+		n, _ := strconv.Atoi(string(r.data[m[2]:m[3]]))
+		r.xref[n] = xrefEntry{typ: 1, offset: m[0]}
+	}
+	// objects stored in object streams have no header of their own
+	scanned := make(map[int]xrefEntry, len(r.xref))
+	for num, e := range r.xref {
+		scanned[num] = e
+	}
+	for num, e := range scanned {
+		obj, err := r.parseIndirect(e.offset)
+		if stm, ok := obj.(*pdfStream); err == nil && ok && stm.dict["Type"] == pdfName("ObjStm") {
+			if _, err = r.objStmObject(num, -1); err != nil && r.objStms[num] == nil {
+				continue
+			}
+			for n := range r.objStms[num].offsets {
+				if _, ok := r.xref[n]; !ok {
+					r.xref[n] = xrefEntry{typ: 2, offset: num}
+				}
+			}
+		}
+	}
+	r.trailer = nil
+	for pos := 0; ; {
+		j := bytes.Index(r.data[pos:], []byte("trailer"))
+		if j < 0 {
+			break
+		}
+		l := &pdfLexer{data: r.data, pos: pos + j + len("trailer")}
+		if obj, err := l.object(); err == nil {
+			if d, ok := obj.(pdfDict); ok {
+				r.trailer = d
+			}
+		}
+		pos += j + 1
+	}
+	if r.trailer == nil {
+		// the newest cross-reference stream carries the trailer entries
+		for _, e := range r.xref {
+			if obj, err := r.parseIndirect(e.offset); err == nil {
+				if stm, ok := obj.(*pdfStream); ok && stm.dict["Type"] == pdfName("XRef") {
+					r.trailer = stm.dict
+				}
+			}
+		}
+	}
+	if r.trailer == nil {
+		return errors.New("pdf: trailer not found")
+	}
+	return nil
+}
+
+// parseIndirect parses the indirect object "num gen obj ... endobj" at
+// offset
+func (r *PDFReader) parseIndirect(offset int) (interface{}, error) {
+	if offset < 0 || offset >= len(r.data) {
+		return nil, fmt.Errorf("pdf: invalid object offset %d", offset)
+	}
+	l := &pdfLexer{data: r.data, pos: offset}
+	for _, want := range []string{"num", "gen"} {
+		if tok, err := l.token(); err != nil {
+			return nil, err
+		} else if _, ok := tok.(int); !ok {
+			return nil, fmt.Errorf("pdf: object %s expected at offset %d", want, offset)
+		}
+	}
+	if tok, err := l.token(); err != nil || tok != pdfKeyword("obj") {
+		return nil, fmt.Errorf("pdf: object expected at offset %d", offset)
+	}
+	obj, err := l.object()
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := obj.(pdfDict)
+	if !ok {
+		return obj, nil
+	}
+	save := l.pos
+	if tok, err := l.token(); err != nil || tok != pdfKeyword("stream") {
+		l.pos = save
+		return dict, nil
+	}
+	// the stream data starts after the end of line following the keyword
+	if l.pos < len(r.data) && r.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(r.data) && r.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+	// A reference to the object itself resolves to nil while it is parsed
+	length, ok := r.resolve(dict["Length"]).(int)
+	end := start + length
+	if !ok || length < 0 || length > len(r.data)-start || !bytes.HasPrefix(bytes.TrimLeft(r.data[end:minInt(end+32, len(r.data))], "\r\n \t"), []byte("endstream")) {
+		// missing or wrong length; search for the end of the stream
+		j := bytes.Index(r.data[start:], []byte("endstream"))
+		if j < 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		end = start + j
+		for end > start && (r.data[end-1] == '\n' || r.data[end-1] == '\r') {
+			end--
+		}
+	}
+	return &pdfStream{dict: dict, data: r.data[start:end]}, nil
+}
+
+// object returns the indirect object num, nil when it does not exist
+func (r *PDFReader) object(num int) interface{} {
+	if obj, ok := r.cache[num]; ok {
+		return obj
+	}
+	e, ok := r.xref[num]
+	// Mark the object while it is parsed, so that references to itself,
+	// such as the /Length of its own stream, do not recurse
+	r.cache[num] = nil
+	var obj interface{}
+	switch {
+	case !ok:
+	case e.typ == 1:
+		obj, _ = r.parseIndirect(e.offset)
+	case e.typ == 2:
+		obj, _ = r.objStmObject(e.offset, num)
+	}
+	r.cache[num] = obj
+	return obj
+}
+
+// resolve follows indirect references
+func (r *PDFReader) resolve(obj interface{}) interface{} {
+	for j := 0; j < 32; j++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = r.object(ref.num)
+	}
+	return nil
+}
+
+// objStmObject parses object num from the object stream stmNum
+func (r *PDFReader) objStmObject(stmNum, num int) (interface{}, error) {
+	ostm, ok := r.objStms[stmNum]
+	if !ok {
+		e := r.xref[stmNum]
+		if e.typ != 1 {
+			return nil, fmt.Errorf("pdf: object stream %d not found", stmNum)
+		}
+		obj, err := r.parseIndirect(e.offset)
+		if err != nil {
+			return nil, err
+		}
+		stm, ok := obj.(*pdfStream)
+		if !ok {
+			return nil, fmt.Errorf("pdf: object %d is not an object stream", stmNum)
+		}
+		data, err := r.decode(stm)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := stm.dict["N"].(int)
+		first, _ := stm.dict["First"].(int)
+		ostm = &pdfObjStm{data: data, offsets: make(map[int]int, n)}
+		l := &pdfLexer{data: data}
+		for j := 0; j < n; j++ {
+			objNum, err1 := l.token()
+			off, err2 := l.token()
+			on, ok1 := objNum.(int)
+			o, ok2 := off.(int)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 {
+				return nil, errPDFSyntax
+			}
+			ostm.offsets[on] = first + o
+		}
+		r.objStms[stmNum] = ostm
+	}
+	off, ok := ostm.offsets[num]
+	if ok && (off < 0 || off >= len(ostm.data)) {
+		return nil, fmt.Errorf("pdf: invalid offset of object %d in object stream %d", num, stmNum)
+	}
+	if !ok {
+		return nil, fmt.Errorf("pdf: object %d not found in object stream %d", num, stmNum)
+	}
+	l := &pdfLexer{data: ostm.data, pos: off}
+	return l.object()
+}
+
+// decode returns the decoded data of a stream
+func (r *PDFReader) decode(stm *pdfStream) ([]byte, error) {
+	var filters, params pdfArray
+	switch v := r.resolve(stm.dict["Filter"]).(type) {
+	case pdfName:
+		filters = pdfArray{v}
+	case pdfArray:
+		filters = v
+	}
+	switch v := r.resolve(stm.dict["DecodeParms"]).(type) {
+	case pdfDict:
+		params = pdfArray{v}
+	case pdfArray:
+		params = v
+	}
+	data := stm.data
+	for j, flt := range filters {
+		var parm pdfDict
+		if j < len(params) {
+			parm, _ = r.resolve(params[j]).(pdfDict)
+		}
+		var err error
+		switch r.resolve(flt) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			data, err = flateDecode(data, parm)
+		case pdfName("LZWDecode"), pdfName("LZW"):
+			data, err = lzwDecode(data, parm)
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data, err = asciiHexDecode(data)
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = ascii85Decode(data)
+		default:
+			err = fmt.Errorf("pdf: unsupported filter %v", flt)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func flateDecode(data []byte, parm pdfDict) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return unpredict(out, parm), nil
+}
+
+func lzwDecode(data []byte, parm pdfDict) ([]byte, error) {
+	if early, ok := parm["EarlyChange"].(int); ok && early == 0 {
+		return nil, errors.New("pdf: LZW streams without early change are not supported")
+	}
+	zr := lzw.NewReader(bytes.NewReader(data), lzw.MSB, 8)
+	defer zr.Close()
+	out, err := io.ReadAll(zr)
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return unpredict(out, parm), nil
+}
+
+// unpredict reverses the TIFF or PNG predictor given in the decode
+// parameters of a Flate or LZW stream
+func unpredict(out []byte, parm pdfDict) []byte {
+	predictor, _ := parm["Predictor"].(int)
+	if predictor < 2 {
+		return out
+	}
+	colors, bpc, columns := 1, 8, 1
+	if v, ok := parm["Colors"].(int); ok {
+		colors = v
+	}
+	if v, ok := parm["BitsPerComponent"].(int); ok {
+		bpc = v
+	}
+	if v, ok := parm["Columns"].(int); ok {
+		columns = v
+	}
+	rowLen := (colors*bpc*columns + 7) / 8
+	if predictor == 2 {
+		tiffUndoPredictor(out, rowLen, colors, bpc)
+		return out
+	}
+	// PNG predictors, one filter type byte per row
+	bpp := max(1, colors*bpc/8)
+	return unpredictRows(out, bpp, rowLen)
+}
+
+// unpredictRows reverses the PNG filter of each row of data, where every
+// row of rowLen bytes is preceded by its filter type byte and bpp is the
+// number of bytes per complete pixel, rounded up to one. The rows are
+// returned without their filter type bytes.
+func unpredictRows(data []byte, bpp, rowLen int) []byte {
+	prev := make([]byte, rowLen)
+	res := make([]byte, 0, len(data)/(rowLen+1)*rowLen)
+	for pos := 0; pos+rowLen+1 <= len(data); pos += rowLen + 1 {
+		ft := data[pos]
+		row := data[pos+1 : pos+1+rowLen]
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch ft {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		res = append(res, row...)
+		prev = row
+	}
+	return res
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	_, err := hex.Decode(out, digits)
+	return out, err
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if j := bytes.Index(data, []byte("~>")); j >= 0 {
+		data = data[:j]
+	}
+	out := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// collectPages walks the page tree, resolving inherited attributes
+func (r *PDFReader) collectPages(node interface{}, inherited pdfDict, depth int) error {
+	dict, ok := r.resolve(node).(pdfDict)
+	if !ok || depth > 64 {
+		return errors.New("pdf: invalid page tree")
+	}
+	attrs := pdfDict{}
+	for k, v := range inherited {
+		attrs[k] = v
+	}
+	for _, key := range []pdfName{"Resources", "MediaBox", "CropBox", "Rotate"} {
+		if v, ok := dict[key]; ok {
+			attrs[key] = v
+		}
+	}
+	if dict["Type"] == pdfName("Page") || dict["Kids"] == nil {
+		page := pdfDict{}
+		for k, v := range dict {
+			page[k] = v
+		}
+		for k, v := range attrs {
+			page[k] = v
+		}
+		r.pages = append(r.pages, page)
+		if ref, ok := node.(pdfRef); ok {
+			r.pageNum[ref.num] = len(r.pages)
+		}
+		return nil
+	}
+	kids, _ := r.resolve(dict["Kids"]).(pdfArray)
+	for _, kid := range kids {
+		if err := r.collectPages(kid, attrs, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
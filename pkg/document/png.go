@@ -41,6 +41,21 @@ func (f *Bdf) pngColorSpace(ct byte) (colspace string, colorVal int) {
 	return
 }
 
+// pngBitDepthValid reports whether the bit depth is allowed for the color
+// type: gray images have 1, 2, 4, 8 or 16 bits, palette images 1, 2, 4 or 8
+// and the other types 8 or 16
+func pngBitDepthValid(ct, bpc byte) bool {
+	switch bpc {
+	case 1, 2, 4:
+		return ct == 0 || ct == 3
+	case 8:
+		return true
+	case 16:
+		return ct != 3
+	}
+	return false
+}
+
 func (f *Bdf) parsepngstream(r *rbuffer, readdpi bool) (info *ImageInfoType) {
 	info = f.newImageInfo()
 	// 	Check signature
@@ -57,9 +72,6 @@ func (f *Bdf) parsepngstream(r *rbuffer, readdpi bool) (info *ImageInfoType) {
 	w := r.i32()
 	h := r.i32()
 	bpc := r.u8()
-	if bpc > 8 {
-		f.err = fmt.Errorf("16-bit depth not supported in PNG file")
-	}
 	ct := r.u8()
 	var colspace string
 	var colorVal int
@@ -67,18 +79,19 @@ func (f *Bdf) parsepngstream(r *rbuffer, readdpi bool) (info *ImageInfoType) {
 	if f.err != nil {
 		return
 	}
-	if r.u8() != 0 {
-		f.err = fmt.Errorf("'unknown compression method in PNG buffer")
+	if !pngBitDepthValid(ct, bpc) {
+		f.err = fmt.Errorf("invalid bit depth %d for color type %d in PNG buffer", bpc, ct)
 		return
 	}
 	if r.u8() != 0 {
-		f.err = fmt.Errorf("'unknown filter method in PNG buffer")
+		f.err = fmt.Errorf("'unknown compression method in PNG buffer")
 		return
 	}
 	if r.u8() != 0 {
-		f.err = fmt.Errorf("interlacing not supported in PNG buffer")
+		f.err = fmt.Errorf("'unknown filter method in PNG buffer")
 		return
 	}
+	interlaced := r.u8() != 0
 	_ = r.Next(4)
 	dp := sprintf("/Predictor 15 /Colors %d /BitsPerComponent %d /Columns %d", colorVal, bpc, w)
 	// Scan chunks looking for palette, transparency and image data
@@ -102,11 +115,17 @@ func (f *Bdf) parsepngstream(r *rbuffer, readdpi bool) (info *ImageInfoType) {
 			// dbg("tRNS")
 			// Read transparency info
 			t := r.Next(n)
+			sample := func(pos int) int {
+				if bpc == 16 {
+					return int(t[pos])<<8 | int(t[pos+1])
+				}
+				return int(t[pos+1])
+			}
 			switch ct {
 			case 0:
-				trns = []int{int(t[1])} // ord(substr($t,1,1)));
+				trns = []int{sample(0)} // ord(substr($t,1,1)));
 			case 2:
-				trns = []int{int(t[1]), int(t[3]), int(t[5])} // array(ord(substr($t,1,1)), ord(substr($t,3,1)), ord(substr($t,5,1)));
+				trns = []int{sample(0), sample(2), sample(4)} // array(ord(substr($t,1,1)), ord(substr($t,3,1)), ord(substr($t,5,1)));
 			default:
 				pos := strings.Index(string(t), "\x00")
 				if pos >= 0 {
@@ -114,6 +133,17 @@ func (f *Bdf) parsepngstream(r *rbuffer, readdpi bool) (info *ImageInfoType) {
 				}
 			}
 			_ = r.Next(4)
+		case "iCCP":
+			// Embedded ICC profile: name, compression method and the
+			// deflated profile
+			t := r.Next(n)
+			if pos := strings.IndexByte(string(t), 0); pos >= 0 && pos+2 <= len(t) && t[pos+1] == 0 {
+				if mem, err := xmem.uncompress(t[pos+2:]); err == nil {
+					info.icc = mem.copy()
+					mem.release()
+				}
+			}
+			_ = r.Next(4)
 		case "IDAT":
 			// dbg("IDAT")
 			// Read image data block
@@ -163,80 +193,120 @@ func (f *Bdf) parsepngstream(r *rbuffer, readdpi bool) (info *ImageInfoType) {
 	info.dp = dp
 	info.pal = pal
 	info.trns = trns
+	if bpc == 16 && f.pdfVersion < "1.5" {
+		f.pdfVersion = "1.5"
+	}
 	// dbg("ct [%d]", ct)
-	if ct >= 4 {
-		// Separate alpha and color channels
+	if ct >= 4 || interlaced {
+		// Reverse the row filters and reassemble interlaced passes so
+		// that the alpha channel can be separated; both streams are
+		// written back with filter type None for each row
 		mem, err := xmem.uncompress(data)
 		if err != nil {
 			f.err = err
 			return
 		}
-		data = mem.bytes()
-		var (
-			color wbuffer
-			alpha wbuffer
-		)
-		if ct == 4 {
-			// Gray image
-			width := int(w)
-			height := int(h)
-			length := 2 * width
-			sz := height * (width + 1)
-			color.p = data[:sz] // reuse decompressed data buffer.
-			alpha.p = make([]byte, sz)
-			var pos, elPos int
-			for i := 0; i < height; i++ {
-				pos = (1 + length) * i
-				color.u8(data[pos])
-				alpha.u8(data[pos])
-				elPos = pos + 1
-				for k := 0; k < width; k++ {
-					color.u8(data[elPos])
-					alpha.u8(data[elPos+1])
-					elPos += 2
-				}
-			}
-		} else {
-			// RGB image
-			width := int(w)
-			height := int(h)
-			length := 4 * width
-			sz := width * height
-			color.p = data[:sz*3+height] // reuse decompressed data buffer.
-			alpha.p = make([]byte, sz+height)
-			var pos, elPos int
-			for i := 0; i < height; i++ {
-				pos = (1 + length) * i
-				color.u8(data[pos])
-				alpha.u8(data[pos])
-				elPos = pos + 1
-				for k := 0; k < width; k++ {
-					tmp := data[elPos : elPos+4]
-					color.u8(tmp[0])
-					color.u8(tmp[1])
-					color.u8(tmp[2])
-					alpha.u8(tmp[3])
-					elPos += 4
-				}
+		channels := colorVal
+		if ct >= 4 {
+			channels++
+		}
+		pixels := pngUnfilter(mem.bytes(), int(w), int(h), channels*int(bpc), interlaced)
+		mem.release()
+		if ct >= 4 {
+			var color []byte
+			color, info.smask = pngSplitAlpha(pixels, int(w), int(h), colorVal, int(bpc))
+			pixels = color
+			if f.pdfVersion < "1.4" {
+				f.pdfVersion = "1.4"
 			}
 		}
-
-		xc := xmem.compress(color.bytes())
+		xc := xmem.compress(pngRows(pixels, (int(w)*colorVal*int(bpc)+7)/8))
 		data = xc.copy()
 		xc.release()
+	}
+	info.data = data
+	return
+}
 
-		// release uncompressed data buffer, after the color buffer
-		// has been compressed.
-		mem.release()
-
-		xa := xmem.compress(alpha.bytes())
-		info.smask = xa.copy()
-		xa.release()
+// pngPasses lists the origin and spacing of the seven Adam7 passes
+var pngPasses = [7][4]int{{0, 0, 8, 8}, {4, 0, 8, 8}, {0, 4, 4, 8}, {2, 0, 4, 4},
+	{0, 2, 2, 4}, {1, 0, 2, 2}, {0, 1, 1, 2}}
 
-		if f.pdfVersion < "1.4" {
-			f.pdfVersion = "1.4"
+// pngUnfilter returns the decompressed PNG image data as packed rows of w
+// pixels of bitsPerPixel bits each, without the filter type bytes. The passes
+// of an Adam7 interlaced image are merged into a single image.
+func pngUnfilter(data []byte, w, h, bitsPerPixel int, interlaced bool) []byte {
+	bpp := (bitsPerPixel + 7) / 8
+	rowLen := func(width int) int { return (width*bitsPerPixel + 7) / 8 }
+	if !interlaced {
+		return unpredictRows(data, bpp, rowLen(w))
+	}
+	stride := rowLen(w)
+	out := make([]byte, stride*h)
+	pos := 0
+	for _, pass := range pngPasses {
+		x0, y0, dx, dy := pass[0], pass[1], pass[2], pass[3]
+		pw := (w - x0 + dx - 1) / dx
+		ph := (h - y0 + dy - 1) / dy
+		if pw <= 0 || ph <= 0 {
+			continue
+		}
+		n := ph * (rowLen(pw) + 1)
+		if pos+n > len(data) {
+			break
+		}
+		rows := unpredictRows(data[pos:pos+n], bpp, rowLen(pw))
+		pos += n
+		for py := 0; py < ph; py++ {
+			src := rows[py*rowLen(pw):]
+			dst := out[(y0+py*dy)*stride:]
+			for px := 0; px < pw; px++ {
+				x := x0 + px*dx
+				if bitsPerPixel >= 8 {
+					copy(dst[x*bpp:x*bpp+bpp], src[px*bpp:px*bpp+bpp])
+					continue
+				}
+				// Sub-byte pixels are moved bit by bit, most significant first
+				sbit, dbit := px*bitsPerPixel, x*bitsPerPixel
+				for b := 0; b < bitsPerPixel; b++ {
+					if src[(sbit+b)/8]&(0x80>>uint((sbit+b)%8)) != 0 {
+						dst[(dbit+b)/8] |= 0x80 >> uint((dbit+b)%8)
+					}
+				}
+			}
 		}
 	}
-	info.data = data
+	return out
+}
+
+// pngSplitAlpha separates the trailing alpha sample of each pixel from the
+// color samples in front of it. Alpha is reduced to 8 bits for the soft
+// mask, which is written with filter type bytes like the color data.
+func pngSplitAlpha(pixels []byte, w, h, colors, bpc int) (color, smask []byte) {
+	size := bpc / 8
+	color = make([]byte, 0, w*h*colors*size)
+	alpha := make([]byte, 0, w*h)
+	step := (colors + 1) * size
+	for pos := 0; pos+step <= len(pixels); pos += step {
+		color = append(color, pixels[pos:pos+colors*size]...)
+		alpha = append(alpha, pixels[pos+colors*size])
+	}
+	xa := xmem.compress(pngRows(alpha, w))
+	smask = xa.copy()
+	xa.release()
 	return
 }
+
+// pngRows prefixes every row of rowLen bytes with filter type None so that
+// the data can be decoded with the PNG predictor
+func pngRows(data []byte, rowLen int) []byte {
+	if rowLen <= 0 {
+		return data
+	}
+	out := make([]byte, 0, len(data)+len(data)/rowLen)
+	for pos := 0; pos+rowLen <= len(data); pos += rowLen {
+		out = append(out, 0)
+		out = append(out, data[pos:pos+rowLen]...)
+	}
+	return out
+}
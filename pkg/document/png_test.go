@@ -22,6 +22,11 @@ package document
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image/png"
 	"os"
 	"testing"
 )
@@ -103,3 +108,187 @@ func BenchmarkParseGIF(b *testing.B) {
 		_ = pdf.parsegif(bytes.NewReader(raw))
 	}
 }
+
+// pngTestFile encodes rows of w pixels of bitsPerPixel bits as a PNG file of
+// the given depth and color type, optionally Adam7 interlaced. Every row is
+// written with filter type None.
+func pngTestFile(w, h, depth, ct, bitsPerPixel int, raw []byte, interlaced bool, plte []byte) []byte {
+	stride := (w*bitsPerPixel + 7) / 8
+	pixel := func(x, y int, dst []byte, dx int) {
+		for b := 0; b < bitsPerPixel; b++ {
+			sb, db := x*bitsPerPixel+b, dx*bitsPerPixel+b
+			if raw[y*stride+sb/8]&(0x80>>uint(sb%8)) != 0 {
+				dst[db/8] |= 0x80 >> uint(db%8)
+			}
+		}
+	}
+	var idat []byte
+	passes := [][4]int{{0, 0, 1, 1}}
+	if interlaced {
+		passes = pngPasses[:]
+	}
+	for _, p := range passes {
+		for y := p[1]; y < h; y += p[3] {
+			pw := (w - p[0] + p[2] - 1) / p[2]
+			if pw <= 0 {
+				break
+			}
+			row := make([]byte, (pw*bitsPerPixel+7)/8)
+			for x, dx := p[0], 0; x < w; x, dx = x+p[2], dx+1 {
+				pixel(x, y, row, dx)
+			}
+			idat = append(append(idat, 0), row...)
+		}
+	}
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(idat)
+	zw.Close()
+	var out bytes.Buffer
+	out.WriteString("\x89PNG\r\n\x1a\n")
+	chunk := func(tag string, data []byte) {
+		binary.Write(&out, binary.BigEndian, uint32(len(data)))
+		body := append([]byte(tag), data...)
+		out.Write(body)
+		binary.Write(&out, binary.BigEndian, crc32.ChecksumIEEE(body))
+	}
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr, uint32(w))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(h))
+	ihdr[8], ihdr[9] = byte(depth), byte(ct)
+	if interlaced {
+		ihdr[12] = 1
+	}
+	chunk("IHDR", ihdr)
+	if plte != nil {
+		chunk("PLTE", plte)
+	}
+	chunk("IDAT", z.Bytes())
+	chunk("IEND", nil)
+	return out.Bytes()
+}
+
+// pngTestPattern returns n bytes of varying sample values
+func pngTestPattern(n int) []byte {
+	raw := make([]byte, n)
+	for j := range raw {
+		raw[j] = byte(j*37 + j/7)
+	}
+	return raw
+}
+
+func pngTestDecode(t *testing.T, data []byte, colors, bpc, w int) []byte {
+	raw, err := flateDecode(data, pdfDict{"Predictor": 15, "Colors": colors, "BitsPerComponent": bpc, "Columns": w})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestPNG16BitInterlaced(t *testing.T) {
+	const w, h = 13, 7
+	// Gray with alpha, 16 bits per sample
+	raw := pngTestPattern(w * h * 4)
+	for _, interlaced := range []bool{false, true} {
+		file := pngTestFile(w, h, 16, 4, 32, raw, interlaced, nil)
+		if _, err := png.Decode(bytes.NewReader(file)); err != nil {
+			t.Fatal(err)
+		}
+		pdf := New("P", "mm", "A4", "")
+		info := pdf.parsepng(bytes.NewReader(file), false)
+		if err := pdf.Error(); err != nil {
+			t.Fatal(err)
+		}
+		if info.bpc != 16 || info.cs != "DeviceGray" || pdf.pdfVersion < "1.5" {
+			t.Fatalf("unexpected image %s, %d bits, version %s", info.cs, info.bpc, pdf.pdfVersion)
+		}
+		gray := pngTestDecode(t, info.data, 1, 16, w)
+		alpha := pngTestDecode(t, info.smask, 1, 8, w)
+		for j := 0; j < w*h; j++ {
+			if gray[2*j] != raw[4*j] || gray[2*j+1] != raw[4*j+1] || alpha[j] != raw[4*j+2] {
+				t.Fatalf("interlaced %v: pixel %d differs", interlaced, j)
+			}
+		}
+	}
+}
+
+func TestPNGInterlacedPalette(t *testing.T) {
+	const w, h = 11, 9
+	stride := (w*2 + 7) / 8
+	raw := pngTestPattern(stride * h)
+	for y := 0; y < h; y++ {
+		// clear the padding bits of each row
+		raw[y*stride+stride-1] &= 0xFC
+	}
+	plte := []byte{0, 0, 0, 255, 0, 0, 0, 255, 0, 0, 0, 255}
+	file := pngTestFile(w, h, 2, 3, 2, raw, true, plte)
+	pdf := New("P", "mm", "A4", "")
+	info := pdf.parsepng(bytes.NewReader(file), false)
+	if err := pdf.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if info.cs != "Indexed" || !bytes.Equal(pngTestDecode(t, info.data, 1, 2, w), raw) {
+		t.Fatal("interlaced palette image not reassembled")
+	}
+}
+
+func TestPNGBitDepth(t *testing.T) {
+	for _, tc := range []struct {
+		depth, ct int
+		ok        bool
+	}{
+		{1, 0, true}, {16, 0, true}, {8, 2, true}, {16, 6, true}, {4, 3, true},
+		{2, 4, false}, {1, 6, false}, {4, 2, false}, {16, 3, false}, {3, 0, false}, {32, 6, false},
+	} {
+		plte := []byte(nil)
+		if tc.ct == 3 {
+			plte = []byte{0, 0, 0, 255, 255, 255}
+		}
+		file := pngTestFile(2, 2, tc.depth, tc.ct, 8, []byte{0, 0, 0, 0}, false, plte)
+		pdf := New("P", "mm", "A4", "")
+		pdf.RegisterImageOptionsReader("img", ImageOptions{ImageType: "png"}, bytes.NewReader(file))
+		if err := pdf.Error(); (err == nil) != tc.ok {
+			t.Errorf("depth %d, color type %d: unexpected error %v", tc.depth, tc.ct, err)
+		}
+	}
+}
+
+func TestJPEGAdobe(t *testing.T) {
+	// SOI, APP14 "Adobe" with transform 0, SOS
+	adobe := []byte{0xFF, 0xD8, 0xFF, 0xEE, 0x00, 0x0E, 'A', 'd', 'o', 'b', 'e',
+		0, 100, 0, 0, 0, 0, 0, 0xFF, 0xDA}
+	if !jpegAdobe(adobe) {
+		t.Fatal("Adobe marker not found")
+	}
+	plain := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x07, 'J', 'F', 'I', 'F', 0, 0xFF, 0xDA}
+	if jpegAdobe(plain) {
+		t.Fatal("Adobe marker reported for JFIF data")
+	}
+}
+
+func TestWebP(t *testing.T) {
+	for _, tc := range []struct {
+		data  string
+		cs    string
+		smask bool
+	}{
+		// 1x1 lossless with transparency and 1x1 lossy images
+		{"UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==", "DeviceRGB", true},
+		{"UklGRiIAAABXRUJQVlA4IBYAAAAwAQCdASoBAAEADsD+JaQAA3AAAAAA", "DeviceRGB", false},
+	} {
+		data, _ := base64.StdEncoding.DecodeString(tc.data)
+		pdf := New("P", "mm", "A4", "")
+		pdf.AddPage()
+		info := pdf.RegisterImageOptionsReader("pixel", ImageOptions{ImageType: "webp"}, bytes.NewReader(data))
+		if err := pdf.Error(); err != nil {
+			t.Fatal(err)
+		}
+		if info.w != 1 || info.h != 1 || info.cs != tc.cs || (info.smask != nil) != tc.smask {
+			t.Fatalf("unexpected WebP image %v x %v %s", info.w, info.h, info.cs)
+		}
+		pdf.ImageOptions("pixel", 10, 10, 20, 0, false, ImageOptions{}, 0, "")
+		if err := pdf.Output(new(bytes.Buffer)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -21,9 +21,16 @@ package document
 // THE SOFTWARE.
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/md5"
+	crand "crypto/rand"
 	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/binary"
+	"fmt"
+	"hash"
 	"math/rand"
 )
 
@@ -33,26 +40,84 @@ const (
 	CnProtectModify     = 8
 	CnProtectCopy       = 16
 	CnProtectAnnotForms = 32
+	// The following flags are only honored by the AES security handlers
+	CnProtectFillForms    = 256
+	CnProtectExtract      = 512
+	CnProtectAssemble     = 1024
+	CnProtectPrintHighRes = 2048
 )
 
+// cnProtectAll is the set of permission bits defined by the standard security
+// handler
+const cnProtectAll = CnProtectPrint | CnProtectModify | CnProtectCopy | CnProtectAnnotForms |
+	CnProtectFillForms | CnProtectExtract | CnProtectAssemble | CnProtectPrintHighRes
+
+// EncryptionAlgorithm selects the cipher and revision of the standard security
+// handler used to protect a document
+type EncryptionAlgorithm int
+
+const (
+	// EncryptRC4 is 40-bit RC4 (V1, R2), the algorithm used by SetProtection
+	EncryptRC4 EncryptionAlgorithm = iota
+	// EncryptAES128 is 128-bit AES in CBC mode (V4, R4); it requires PDF 1.6
+	EncryptAES128
+	// EncryptAES256 is 256-bit AES in CBC mode (V5, R6); it requires PDF 1.7
+	// with Adobe extension level 8, or PDF 2.0
+	EncryptAES256
+)
+
+// ProtectionOptions specifies the security handler applied by
+// SetProtectionOptions.
+type ProtectionOptions struct {
+	// Algorithm selects the cipher, EncryptRC4 by default
+	Algorithm EncryptionAlgorithm
+	// Permissions is a combination of the CnProtect* flags naming the
+	// operations allowed to a user who opens the document with the user
+	// password
+	Permissions int
+	// UserPassword is needed to open the document; it may be empty
+	UserPassword string
+	// OwnerPassword grants full access to the document. When empty a random
+	// value is used, effectively prohibiting full access.
+	OwnerPassword string
+}
+
 type protectType struct {
 	encrypted     bool
+	algorithm     EncryptionAlgorithm
 	uValue        []byte
 	oValue        []byte
+	ueValue       []byte
+	oeValue       []byte
+	perms         []byte
 	pValue        int
 	padding       []byte
 	encryptionKey []byte
+	fileID        []byte
 	objNum        int
-	rc4cipher     *rc4.Cipher
-	rc4n          uint32 // Object number associated with rc4 cipher
 }
 
-func (p *protectType) rc4(n uint32, buf *[]byte) {
-	if p.rc4cipher == nil || p.rc4n != n {
-		p.rc4cipher, _ = rc4.NewCipher(p.objectKey(n))
-		p.rc4n = n
+var protectPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41,
+	0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80,
+	0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+// encrypt returns the encrypted form of buf, a string or stream belonging to
+// object n. AES output is longer than its input since it carries the
+// initialization vector and padding.
+func (p *protectType) encrypt(n int, buf []byte) []byte {
+	switch p.algorithm {
+	case EncryptAES128:
+		return aesEncrypt(p.objectKeyAES(uint32(n)), buf)
+	case EncryptAES256:
+		return aesEncrypt(p.encryptionKey, buf)
 	}
-	p.rc4cipher.XORKeyStream(*buf, *buf)
+	out := make([]byte, len(buf))
+	c, _ := rc4.NewCipher(p.objectKey(uint32(n)))
+	c.XORKeyStream(out, buf)
+	return out
 }
 
 func (p *protectType) objectKey(n uint32) []byte {
@@ -65,6 +130,42 @@ func (p *protectType) objectKey(n uint32) []byte {
 	return s[0:10]
 }
 
+// objectKeyAES derives the AESV2 key of object n (algorithm 1 with the
+// "sAlT" suffix)
+func (p *protectType) objectKeyAES(n uint32) []byte {
+	b := make([]byte, 0, len(p.encryptionKey)+9)
+	b = append(b, p.encryptionKey...)
+	b = append(b, byte(n), byte(n>>8), byte(n>>16), 0, 0, 's', 'A', 'l', 'T')
+	s := md5.Sum(b)
+	return s[:]
+}
+
+// aesEncrypt encrypts buf in CBC mode with a random initialization vector,
+// which is prepended to the PKCS#7 padded cipher text
+func aesEncrypt(key, buf []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	pad := aes.BlockSize - len(buf)%aes.BlockSize
+	out := make([]byte, aes.BlockSize+len(buf)+pad)
+	iv := out[:aes.BlockSize]
+	randomBytes(iv)
+	data := out[aes.BlockSize:]
+	copy(data, buf)
+	for j := len(buf); j < len(data); j++ {
+		data[j] = byte(pad)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	return out
+}
+
+func randomBytes(b []byte) {
+	if _, err := crand.Read(b); err != nil {
+		panic(err)
+	}
+}
+
 func oValueGen(userPass, ownerPass []byte) (v []byte) {
 	var c *rc4.Cipher
 	tmp := md5.Sum(ownerPass)
@@ -84,25 +185,29 @@ func (p *protectType) uValueGen() (v []byte) {
 	return
 }
 
+// padPassword truncates or pads a password to the 32 bytes used by the RC4
+// based revisions
+func padPassword(pass string) []byte {
+	return append([]byte(pass), protectPadding...)[0:32]
+}
+
+// randomOwnerPassword replaces an empty owner password
+func randomOwnerPassword() string {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(rand.Int63()))
+	return string(b)
+}
+
 func (p *protectType) setProtection(privFlag byte, userPassStr, ownerPassStr string) {
 	privFlag = 192 | (privFlag & (CnProtectCopy | CnProtectModify | CnProtectPrint | CnProtectAnnotForms))
-	p.padding = []byte{
-		0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41,
-		0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
-		0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80,
-		0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
-	}
-	userPass := []byte(userPassStr)
-	var ownerPass []byte
+	p.padding = protectPadding
 	if ownerPassStr == "" {
-		ownerPass = make([]byte, 8)
-		binary.LittleEndian.PutUint64(ownerPass, uint64(rand.Int63()))
-	} else {
-		ownerPass = []byte(ownerPassStr)
+		ownerPassStr = randomOwnerPassword()
 	}
-	userPass = append(userPass, p.padding...)[0:32]
-	ownerPass = append(ownerPass, p.padding...)[0:32]
+	userPass := padPassword(userPassStr)
+	ownerPass := padPassword(ownerPassStr)
 	p.encrypted = true
+	p.algorithm = EncryptRC4
 	p.oValue = oValueGen(userPass, ownerPass)
 	var buf []byte
 	buf = append(buf, userPass...)
@@ -113,3 +218,244 @@ func (p *protectType) setProtection(privFlag byte, userPassStr, ownerPassStr str
 	p.uValue = p.uValueGen()
 	p.pValue = -(int(privFlag^255) + 1)
 }
+
+// permissionValue returns the signed 32-bit P entry for the given CnProtect*
+// flags; all reserved bits are set
+func permissionValue(perm int) int {
+	return int(int32(uint32(0xFFFFF0C0) | uint32(perm&cnProtectAll)))
+}
+
+// rc4Rounds applies the 20 RC4 passes of revisions 3 and 4 to buf, the key of
+// each pass being key XOR'ed with the pass number
+func rc4Rounds(key, buf []byte, reverse bool) []byte {
+	out := append([]byte(nil), buf...)
+	k := make([]byte, len(key))
+	for j := 0; j < 20; j++ {
+		r := j
+		if reverse {
+			r = 19 - j
+		}
+		for i := range key {
+			k[i] = key[i] ^ byte(r)
+		}
+		c, _ := rc4.NewCipher(k)
+		c.XORKeyStream(out, out)
+	}
+	return out
+}
+
+// md5Rounds returns the MD5 digest of b rehashed 50 times, as used by
+// revisions 3 and 4 to strengthen 128-bit keys
+func md5Rounds(b []byte) []byte {
+	sum := md5.Sum(b)
+	for j := 0; j < 50; j++ {
+		sum = md5.Sum(sum[:])
+	}
+	return sum[:]
+}
+
+// fileKeyR4 computes the document key from the padded user password
+// (algorithm 2)
+func fileKeyR4(userPass, oValue []byte, pValue int, fileID []byte) []byte {
+	var buf []byte
+	buf = append(buf, userPass...)
+	buf = append(buf, oValue...)
+	buf = append(buf, byte(pValue), byte(pValue>>8), byte(pValue>>16), byte(pValue>>24))
+	buf = append(buf, fileID...)
+	return md5Rounds(buf)
+}
+
+// uValueR4 computes the U entry from the document key (algorithm 5)
+func uValueR4(key, fileID []byte) []byte {
+	sum := md5.Sum(append(append([]byte(nil), protectPadding...), fileID...))
+	u := rc4Rounds(key, sum[:], false)
+	// the last 16 bytes are arbitrary
+	return append(u, make([]byte, 16)...)
+}
+
+// setProtectionAES128 configures the V4, R4 security handler with the AESV2
+// crypt filter
+func (p *protectType) setProtectionAES128(perm int, userPassStr, ownerPassStr string) {
+	p.encrypted = true
+	p.algorithm = EncryptAES128
+	p.padding = protectPadding
+	p.fileID = make([]byte, 16)
+	randomBytes(p.fileID)
+	userPass := padPassword(userPassStr)
+	ownerPass := padPassword(ownerPassStr)
+	// algorithm 3
+	p.oValue = rc4Rounds(md5Rounds(ownerPass)[:16], userPass, false)
+	p.pValue = permissionValue(perm)
+	p.encryptionKey = fileKeyR4(userPass, p.oValue, p.pValue, p.fileID)
+	p.uValue = uValueR4(p.encryptionKey, p.fileID)
+}
+
+// truncatePassword limits a revision 6 password to 127 bytes
+func truncatePassword(pass string) []byte {
+	b := []byte(pass)
+	if len(b) > 127 {
+		b = b[:127]
+	}
+	return b
+}
+
+// hashR6 is the hardened hash of revision 6 (algorithm 2.B); udata is the
+// 48-byte U value when hashing an owner password and nil otherwise
+func hashR6(pass, salt, udata []byte) []byte {
+	h := sha256.New()
+	h.Write(pass)
+	h.Write(salt)
+	h.Write(udata)
+	k := h.Sum(nil)
+	var seq []byte
+	for round := 0; ; round++ {
+		seq = seq[:0]
+		for j := 0; j < 64; j++ {
+			seq = append(seq, pass...)
+			seq = append(seq, k...)
+			seq = append(seq, udata...)
+		}
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(seq))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, seq)
+		sum := 0
+		for _, b := range e[:16] {
+			sum += int(b)
+		}
+		var next hash.Hash
+		switch sum % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		default:
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+		if round >= 63 && int(e[len(e)-1]) <= round+1-32 {
+			break
+		}
+	}
+	return k[:32]
+}
+
+// aesWrapKey encrypts the 32-byte document key for the UE and OE entries
+// (CBC mode, zero initialization vector, no padding)
+func aesWrapKey(key, fileKey []byte) []byte {
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, len(fileKey))
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(out, fileKey)
+	return out
+}
+
+// setProtectionAES256 configures the V5, R6 security handler with the AESV3
+// crypt filter
+func (p *protectType) setProtectionAES256(perm int, userPassStr, ownerPassStr string) {
+	p.encrypted = true
+	p.algorithm = EncryptAES256
+	p.fileID = make([]byte, 16)
+	randomBytes(p.fileID)
+	p.encryptionKey = make([]byte, 32)
+	randomBytes(p.encryptionKey)
+	salts := make([]byte, 32)
+	randomBytes(salts)
+	userPass := truncatePassword(userPassStr)
+	ownerPass := truncatePassword(ownerPassStr)
+	// algorithms 8 and 9
+	p.uValue = append(hashR6(userPass, salts[0:8], nil), salts[0:16]...)
+	p.ueValue = aesWrapKey(hashR6(userPass, salts[8:16], nil), p.encryptionKey)
+	p.oValue = append(hashR6(ownerPass, salts[16:24], p.uValue), salts[16:32]...)
+	p.oeValue = aesWrapKey(hashR6(ownerPass, salts[24:32], p.uValue), p.encryptionKey)
+	p.pValue = permissionValue(perm)
+	// algorithm 10
+	perms := make([]byte, 16)
+	binary.LittleEndian.PutUint32(perms, uint32(p.pValue))
+	copy(perms[4:], []byte{0xff, 0xff, 0xff, 0xff, 'T', 'a', 'd', 'b'})
+	randomBytes(perms[12:])
+	block, _ := aes.NewCipher(p.encryptionKey)
+	p.perms = make([]byte, 16)
+	block.Encrypt(p.perms, perms)
+}
+
+// putEncryptDict writes the body of the encryption dictionary
+func (p *protectType) putEncryptDict(f *Bdf) {
+	f.out("/Filter /Standard")
+	switch p.algorithm {
+	case EncryptAES128:
+		f.out("/V 4 /R 4 /Length 128")
+		f.out("/CF <</StdCF <</CFM /AESV2 /AuthEvent /DocOpen /Length 16>>>> /StmF /StdCF /StrF /StdCF")
+	case EncryptAES256:
+		f.out("/V 5 /R 6 /Length 256")
+		f.out("/CF <</StdCF <</CFM /AESV3 /AuthEvent /DocOpen /Length 32>>>> /StmF /StdCF /StrF /StdCF")
+		f.outf("/OE <%X>", p.oeValue)
+		f.outf("/UE <%X>", p.ueValue)
+		f.outf("/Perms <%X>", p.perms)
+	default:
+		f.out("/V 1")
+		f.out("/R 2")
+		f.outf("/O (%s)", f.escape(string(p.oValue)))
+		f.outf("/U (%s)", f.escape(string(p.uValue)))
+		f.outf("/P %d", p.pValue)
+		return
+	}
+	f.outf("/O <%X>", p.oValue)
+	f.outf("/U <%X>", p.uValue)
+	f.outf("/P %d", p.pValue)
+}
+
+// putID writes the file identifier, which takes part in the key derivation of
+// the AES-128 handler
+func (p *protectType) putID(f *Bdf) {
+	if len(p.fileID) == 0 {
+		f.out("/ID [()()]")
+		return
+	}
+	f.outf("/ID [<%X> <%X>]", p.fileID, p.fileID)
+}
+
+// SetProtectionOptions encrypts the finished PDF document with the security
+// handler described by opts. Unlike SetProtection it supports the AES
+// algorithms and the complete set of permission flags. For example:
+//
+//	pdf.SetProtectionOptions(ProtectionOptions{
+//		Algorithm:     EncryptAES256,
+//		Permissions:   CnProtectPrint | CnProtectPrintHighRes | CnProtectExtract,
+//		UserPassword:  "user",
+//		OwnerPassword: "owner",
+//	})
+//
+// The PDF version of the document is raised as required by the algorithm.
+func (f *Bdf) SetProtectionOptions(opts ProtectionOptions) {
+	if f.err != nil {
+		return
+	}
+	owner := opts.OwnerPassword
+	if owner == "" {
+		owner = randomOwnerPassword()
+	}
+	switch opts.Algorithm {
+	case EncryptRC4:
+		f.protect.setProtection(byte(opts.Permissions), opts.UserPassword, owner)
+	case EncryptAES128:
+		f.protect.setProtectionAES128(opts.Permissions, opts.UserPassword, owner)
+		if f.pdfVersion < "1.6" {
+			f.pdfVersion = "1.6"
+		}
+	case EncryptAES256:
+		f.protect.setProtectionAES256(opts.Permissions, opts.UserPassword, owner)
+		if f.pdfVersion < "1.7" {
+			f.pdfVersion = "1.7"
+		}
+	default:
+		f.err = fmt.Errorf("unknown encryption algorithm %d", opts.Algorithm)
+	}
+}
+
+// protectPutCatalog declares the Adobe extension that introduced the AES-256
+// security handler
+func (f *Bdf) protectPutCatalog() {
+	if f.protect.encrypted && f.protect.algorithm == EncryptAES256 && f.pdfVersion < "2.0" {
+		f.out("/Extensions <</ADBE <</BaseVersion /1.7 /ExtensionLevel 8>>>>")
+	}
+}
@@ -0,0 +1,185 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// encryptedDoc produces an uncompressed protected document and returns its
+// bytes
+func encryptedDoc(t *testing.T, opts ProtectionOptions) []byte {
+	t.Helper()
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetProtectionOptions(opts)
+	pdf.SetTitle("Quarterly figures", false)
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.Cell(40, 10, "Confidential")
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func hexEntry(t *testing.T, doc []byte, key string) []byte {
+	t.Helper()
+	m := regexp.MustCompile(`/` + key + ` ?<([0-9A-F]+)>`).FindSubmatch(doc)
+	if m == nil {
+		t.Fatalf("entry /%s not found", key)
+	}
+	b, err := hex.DecodeString(string(m[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// pageContent returns the object number and raw data of the first
+// uncompressed stream
+func pageContent(t *testing.T, doc []byte) (int, []byte) {
+	t.Helper()
+	m := regexp.MustCompile(`(\d+) 0 obj\n<</Length (\d+)>>\nstream\n`).FindSubmatchIndex(doc)
+	if m == nil {
+		t.Fatal("content stream not found")
+	}
+	n, _ := strconv.Atoi(string(doc[m[2]:m[3]]))
+	size, _ := strconv.Atoi(string(doc[m[4]:m[5]]))
+	data := doc[m[1] : m[1]+size]
+	if !bytes.HasPrefix(doc[m[1]+size:], []byte("\nendstream")) {
+		t.Fatalf("stream length %d does not match the stream data", size)
+	}
+	return n, data
+}
+
+func aesDecrypt(t *testing.T, key, data []byte) []byte {
+	t.Helper()
+	if len(data) < 32 || len(data)%aes.BlockSize != 0 {
+		t.Fatalf("bad cipher text length %d", len(data))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(out, data[aes.BlockSize:])
+	pad := int(out[len(out)-1])
+	if pad < 1 || pad > aes.BlockSize {
+		t.Fatalf("bad padding %d", pad)
+	}
+	return out[:len(out)-pad]
+}
+
+func TestProtectAES128(t *testing.T) {
+	doc := encryptedDoc(t, ProtectionOptions{
+		Algorithm:     EncryptAES128,
+		Permissions:   CnProtectPrint | CnProtectExtract,
+		UserPassword:  "user",
+		OwnerPassword: "owner",
+	})
+	for _, w := range []string{"%PDF-1.6", "/V 4 /R 4", "/CFM /AESV2", "/P -3388"} {
+		if !bytes.Contains(doc, []byte(w)) {
+			t.Errorf("output does not contain %q", w)
+		}
+	}
+	id := hexEntry(t, doc, "ID \\[")
+	o := hexEntry(t, doc, "O")
+	u := hexEntry(t, doc, "U")
+	// authenticate the user password (algorithms 2 and 6)
+	key := fileKeyR4(padPassword("user"), o, permissionValue(CnProtectPrint|CnProtectExtract), id)
+	if !bytes.Equal(uValueR4(key, id)[:16], u[:16]) {
+		t.Fatal("user password does not validate against /U")
+	}
+	n, data := pageContent(t, doc)
+	okey := md5.Sum(append(append([]byte(nil), key...), byte(n), byte(n>>8), byte(n>>16), 0, 0, 's', 'A', 'l', 'T'))
+	plain := aesDecrypt(t, okey[:], data)
+	if !bytes.Contains(plain, []byte("(Confidential)Tj")) {
+		t.Errorf("decrypted content stream %q does not contain the text", plain)
+	}
+}
+
+func TestProtectAES256(t *testing.T) {
+	doc := encryptedDoc(t, ProtectionOptions{
+		Algorithm:    EncryptAES256,
+		Permissions:  CnProtectPrint | CnProtectPrintHighRes,
+		UserPassword: "user",
+	})
+	for _, w := range []string{"%PDF-1.7", "/V 5 /R 6", "/CFM /AESV3", "/ExtensionLevel 8"} {
+		if !bytes.Contains(doc, []byte(w)) {
+			t.Errorf("output does not contain %q", w)
+		}
+	}
+	u := hexEntry(t, doc, "U")
+	ue := hexEntry(t, doc, "UE")
+	perms := hexEntry(t, doc, "Perms")
+	if len(u) != 48 || len(ue) != 32 || len(perms) != 16 {
+		t.Fatalf("unexpected lengths U %d, UE %d, Perms %d", len(u), len(ue), len(perms))
+	}
+	// algorithm 11 and 2.A: validate the password and unwrap the file key
+	if !bytes.Equal(hashR6([]byte("user"), u[32:40], nil), u[:32]) {
+		t.Fatal("user password does not validate against /U")
+	}
+	block, _ := aes.NewCipher(hashR6([]byte("user"), u[40:48], nil))
+	key := make([]byte, 32)
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(key, ue)
+	// algorithm 13: check the permissions
+	block, _ = aes.NewCipher(key)
+	p := make([]byte, 16)
+	block.Decrypt(p, perms)
+	want := uint32(permissionValue(CnProtectPrint | CnProtectPrintHighRes))
+	if string(p[9:12]) != "adb" || binary.LittleEndian.Uint32(p) != want {
+		t.Fatalf("bad decrypted /Perms % x", p)
+	}
+	_, data := pageContent(t, doc)
+	plain := aesDecrypt(t, key, data)
+	if !bytes.Contains(plain, []byte("(Confidential)Tj")) {
+		t.Errorf("decrypted content stream %q does not contain the text", plain)
+	}
+	title := hexEntry(t, doc, "Title")
+	if got := aesDecrypt(t, key, title); string(got) != "Quarterly figures" {
+		t.Errorf("decrypted title is %q", got)
+	}
+}
+
+func TestProtectRC4Compatible(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetProtection(CnProtectPrint, "user", "owner")
+	pdf.AddPage()
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []string{"/V 1\n/R 2\n", "/ID [()()]", "/P -60"} {
+		if !bytes.Contains(buf.Bytes(), []byte(w)) {
+			t.Errorf("output does not contain %q", w)
+		}
+	}
+}
@@ -0,0 +1,889 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+
+	d2d "github.com/bhojpur/render/pkg/g2d/draw"
+	"github.com/bhojpur/render/pkg/g2d/img"
+	"github.com/golang/freetype/raster"
+)
+
+// RasterOptions controls the rendering of PDF pages to raster images.
+//
+// DPI is the resolution of the image; it defaults to 72, which renders one
+// pixel per point. If MaxSize is positive, the resolution is chosen so that
+// neither side of the image exceeds MaxSize pixels, which is convenient for
+// thumbnails. Background is the color the page is cleared to before
+// rendering; it defaults to white.
+type RasterOptions struct {
+	DPI        float64
+	MaxSize    int
+	Background color.Color
+}
+
+// RasterizePage renders page pageNum, counting from 1, of the document to an
+// image. The content stream operators written by Bdf are executed with a
+// g2d/img.GraphicContext: paths, clipping, transformations, images, axial
+// and radial shadings, optional content, annotation appearances and text in
+// embedded TrueType fonts. The standard fonts, which are not embedded, are
+// drawn with the Go fonts and the metrics of the standard fonts, so their
+// text occupies the same place as in a PDF viewer.
+func (r *PDFReader) RasterizePage(pageNum int, options RasterOptions) (*image.RGBA, error) {
+	if pageNum < 1 || pageNum > len(r.pages) {
+		return nil, fmt.Errorf("pdf: page %d is not available", pageNum)
+	}
+	page := r.pages[pageNum-1]
+	box := [4]float64{0, 0, 595.28, 841.89}
+	for _, key := range []pdfName{"CropBox", "MediaBox"} {
+		if arr, ok := r.resolve(page[key]).(pdfArray); ok && len(arr) == 4 {
+			for j := range box {
+				box[j] = pdfNumber(r.resolve(arr[j]))
+			}
+			break
+		}
+	}
+	if box[0] > box[2] {
+		box[0], box[2] = box[2], box[0]
+	}
+	if box[1] > box[3] {
+		box[1], box[3] = box[3], box[1]
+	}
+	rotate := 0
+	if rot, ok := r.resolve(page["Rotate"]).(int); ok {
+		rotate = ((rot % 360) + 360) % 360 / 90 * 90
+	}
+	w, h := box[2]-box[0], box[3]-box[1]
+	if rotate == 90 || rotate == 270 {
+		w, h = h, w
+	}
+	scale := 1.0
+	if options.DPI > 0 {
+		scale = options.DPI / 72
+	}
+	if options.MaxSize > 0 {
+		scale = float64(options.MaxSize) / math.Max(w, h)
+	}
+	dw, dh := int(math.Ceil(w*scale-0.001)), int(math.Ceil(h*scale-0.001))
+	if dw < 1 || dh < 1 || dw*dh > 1<<28 {
+		return nil, fmt.Errorf("pdf: page %d cannot be rendered at %.0fx%.0f pixels", pageNum, w*scale, h*scale)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	bg := options.Background
+	if bg == nil {
+		bg = color.White
+	}
+	fillRGBA(dst, bg)
+
+	// user space to device space: move the page box to the origin, flip
+	// the y axis and rotate clockwise
+	pw, ph := (box[2]-box[0])*scale, (box[3]-box[1])*scale
+	device := d2d.Matrix{scale, 0, 0, -scale, -box[0] * scale, box[3] * scale}
+	switch rotate {
+	case 90:
+		device = rasterMul(device, d2d.Matrix{0, 1, -1, 0, ph, 0})
+	case 180:
+		device = rasterMul(device, d2d.Matrix{-1, 0, 0, -1, pw, ph})
+	case 270:
+		device = rasterMul(device, d2d.Matrix{0, -1, 1, 0, 0, pw})
+	}
+
+	p := newPageRasterizer(r, dst)
+	p.st.ctm = device
+	var content []byte
+	var contents pdfArray
+	switch v := r.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		contents = pdfArray{v}
+	case pdfArray:
+		contents = v
+	}
+	for _, c := range contents {
+		stm, ok := r.resolve(c).(*pdfStream)
+		if !ok {
+			continue
+		}
+		data, err := r.decode(stm)
+		if err != nil {
+			return nil, fmt.Errorf("pdf: page %d: %v", pageNum, err)
+		}
+		content = append(content, data...)
+		content = append(content, '\n')
+	}
+	res, _ := r.resolve(page["Resources"]).(pdfDict)
+	p.run(content, res)
+	p.st.ctm = device
+	p.resetState()
+	p.annotations(page)
+	return dst, nil
+}
+
+// WritePagePNG renders page pageNum of the document as described for
+// RasterizePage() and writes it to w as a PNG image.
+func (r *PDFReader) WritePagePNG(w io.Writer, pageNum int, options RasterOptions) error {
+	m, err := r.RasterizePage(pageNum, options)
+	if err == nil {
+		err = png.Encode(w, m)
+	}
+	return err
+}
+
+// RasterizePages closes the document, if needed, and renders each of its
+// pages to an image as described for PDFReader.RasterizePage(). This allows
+// a document to be previewed without an external viewer.
+func (f *Bdf) RasterizePages(options RasterOptions) (list []*image.RGBA, err error) {
+	var buf bytes.Buffer
+	if err = f.Output(&buf); err != nil {
+		return
+	}
+	var r *PDFReader
+	if r, err = NewPDFReader(&buf); err != nil {
+		return
+	}
+	for j := 1; j <= r.NumPages() && err == nil; j++ {
+		var m *image.RGBA
+		if m, err = r.RasterizePage(j, options); err == nil {
+			list = append(list, m)
+		}
+	}
+	return
+}
+
+func fillRGBA(dst *image.RGBA, c color.Color) {
+	cr, cg, cb, ca := c.RGBA()
+	px := []byte{byte(cr >> 8), byte(cg >> 8), byte(cb >> 8), byte(ca >> 8)}
+	for j := 0; j < len(dst.Pix); j += 4 {
+		copy(dst.Pix[j:j+4], px)
+	}
+}
+
+// rasterMul returns the matrix that applies a and then b
+func rasterMul(a, b d2d.Matrix) d2d.Matrix {
+	return d2d.Matrix{
+		a[0]*b[0] + a[1]*b[2],
+		a[0]*b[1] + a[1]*b[3],
+		a[2]*b[0] + a[3]*b[2],
+		a[2]*b[1] + a[3]*b[3],
+		a[4]*b[0] + a[5]*b[2] + b[4],
+		a[4]*b[1] + a[5]*b[3] + b[5],
+	}
+}
+
+// rasterPainter composites spans of the rasterizer over an RGBA image,
+// limited by the coverage of the current clipping path
+type rasterPainter struct {
+	dst            *image.RGBA
+	clip           *image.Alpha // nil if nothing is clipped
+	cr, cg, cb, ca uint32
+}
+
+func (p *rasterPainter) SetColor(c color.Color) {
+	p.cr, p.cg, p.cb, p.ca = c.RGBA()
+}
+
+func (p *rasterPainter) Paint(ss []raster.Span, done bool) {
+	const m = 1<<16 - 1
+	b := p.dst.Bounds()
+	for _, s := range ss {
+		if s.Y < b.Min.Y || s.Y >= b.Max.Y {
+			continue
+		}
+		if s.X0 < b.Min.X {
+			s.X0 = b.Min.X
+		}
+		if s.X1 > b.Max.X {
+			s.X1 = b.Max.X
+		}
+		for x := s.X0; x < s.X1; x++ {
+			ma := s.Alpha
+			if p.clip != nil {
+				ma = ma * uint32(p.clip.Pix[p.clip.PixOffset(x, s.Y)]) / 0xff
+			}
+			if ma == 0 {
+				continue
+			}
+			i := p.dst.PixOffset(x, s.Y)
+			pix := p.dst.Pix[i : i+4 : i+4]
+			a := (m - p.ca*ma/m) * 0x101
+			pix[0] = uint8((uint32(pix[0])*a + p.cr*ma) / m >> 8)
+			pix[1] = uint8((uint32(pix[1])*a + p.cg*ma) / m >> 8)
+			pix[2] = uint8((uint32(pix[2])*a + p.cb*ma) / m >> 8)
+			pix[3] = uint8((uint32(pix[3])*a + p.ca*ma) / m >> 8)
+		}
+	}
+}
+
+// rasterMaskPainter records the coverage of a path in an alpha mask
+type rasterMaskPainter struct {
+	mask *image.Alpha
+}
+
+func (p *rasterMaskPainter) SetColor(c color.Color) {}
+
+func (p *rasterMaskPainter) Paint(ss []raster.Span, done bool) {
+	b := p.mask.Bounds()
+	for _, s := range ss {
+		if s.Y < b.Min.Y || s.Y >= b.Max.Y {
+			continue
+		}
+		if s.X0 < b.Min.X {
+			s.X0 = b.Min.X
+		}
+		if s.X1 > b.Max.X {
+			s.X1 = b.Max.X
+		}
+		v := uint8(s.Alpha >> 8)
+		for x := s.X0; x < s.X1; x++ {
+			p.mask.Pix[p.mask.PixOffset(x, s.Y)] = v
+		}
+	}
+}
+
+// rasterColor is a color in a color space of the page
+type rasterColor struct {
+	space *rasterSpace
+	comps []float64
+}
+
+// rasterState is the graphics state of the PDF imaging model
+type rasterState struct {
+	ctm                    d2d.Matrix
+	fill, stroke           rasterColor
+	fillAlpha, strokeAlpha float64
+	lineWidth              float64
+	lineCap                d2d.LineCap
+	lineJoin               d2d.LineJoin
+	dash                   []float64
+	dashOffset             float64
+	clip                   *image.Alpha // shared between states; replaced, never modified
+	// text state
+	font                                  *rasterFont
+	fontSize, charSpace, wordSpace, scale float64
+	leading, rise                         float64
+	render                                int
+}
+
+// pageRasterizer executes the operators of content streams
+type pageRasterizer struct {
+	r         *PDFReader
+	dst       *image.RGBA
+	gc        *img.GraphicContext
+	painter   *rasterPainter
+	maskGC    *img.GraphicContext
+	masker    *rasterMaskPainter
+	st        rasterState
+	stack     []rasterState
+	path      *d2d.Path
+	clipRule  int // pending clip: 0 none, 1 nonzero winding, 2 even-odd
+	tm, tlm   d2d.Matrix
+	textClip  *d2d.Path // glyph outlines in device space added to the clip at ET
+	fonts     map[pdfRef]*rasterFont
+	hidden    []bool // marked content sequences, true if optional content is off
+	offGroups map[int]bool
+	depth     int // nesting of form XObjects
+}
+
+func newPageRasterizer(r *PDFReader, dst *image.RGBA) *pageRasterizer {
+	p := &pageRasterizer{r: r, dst: dst, fonts: make(map[pdfRef]*rasterFont)}
+	p.painter = &rasterPainter{dst: dst}
+	p.gc = img.NewGraphicContextWithPainter(dst, p.painter)
+	p.masker = &rasterMaskPainter{}
+	p.maskGC = img.NewGraphicContextWithPainter(image.NewAlpha(dst.Bounds()), p.masker)
+	p.path = new(d2d.Path)
+	p.st.ctm = d2d.NewIdentityMatrix()
+	p.resetState()
+	p.offGroups = make(map[int]bool)
+	if root, ok := r.resolve(r.trailer["Root"]).(pdfDict); ok {
+		if props, ok := r.resolve(root["OCProperties"]).(pdfDict); ok {
+			if d, ok := r.resolve(props["D"]).(pdfDict); ok {
+				off, _ := r.resolve(d["OFF"]).(pdfArray)
+				for _, v := range off {
+					if ref, ok := v.(pdfRef); ok {
+						p.offGroups[ref.num] = true
+					}
+				}
+			}
+		}
+	}
+	return p
+}
+
+// resetState sets the parameters of the graphics state other than the
+// transformation to their initial values
+func (p *pageRasterizer) resetState() {
+	ctm := p.st.ctm
+	p.st = rasterState{ctm: ctm, fillAlpha: 1, strokeAlpha: 1, lineWidth: 1, scale: 1,
+		lineCap: d2d.ButtCap, lineJoin: d2d.MiterJoin}
+	p.st.fill = rasterColor{space: rasterDeviceGray, comps: []float64{0}}
+	p.st.stroke = p.st.fill
+}
+
+func (p *pageRasterizer) isHidden() bool {
+	for _, h := range p.hidden {
+		if h {
+			return true
+		}
+	}
+	return false
+}
+
+// operands returns the first n operands as numbers; it fails if one of them
+// is not finite
+func operands(ops []interface{}, n int) ([]float64, bool) {
+	if len(ops) < n {
+		return nil, false
+	}
+	v := make([]float64, n)
+	for j := range v {
+		switch x := ops[len(ops)-n+j].(type) {
+		case int:
+			v[j] = float64(x)
+		case float64:
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				return nil, false
+			}
+			v[j] = x
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// rasterLimit is the largest device coordinate, in pixels, of a path that
+// is passed to the rasterizer. Paths reaching beyond it are dropped, as are
+// dash patterns that would split a path into more than rasterMaxDashes
+// pieces.
+const (
+	rasterLimit     = 1 << 20
+	rasterMaxDashes = 1 << 16
+)
+
+// rasterPathLength returns the length of the polyline through the points of
+// path transformed by tr. It returns false if a point is not finite or lies
+// beyond rasterLimit.
+func rasterPathLength(path *d2d.Path, tr d2d.Matrix) (float64, bool) {
+	pts := make([]float64, len(path.Points))
+	copy(pts, path.Points)
+	tr.Transform(pts)
+	length := 0.0
+	for j := 0; j+1 < len(pts); j += 2 {
+		if !(math.Abs(pts[j]) <= rasterLimit && math.Abs(pts[j+1]) <= rasterLimit) {
+			return 0, false
+		}
+		if j >= 2 {
+			length += math.Hypot(pts[j]-pts[j-2], pts[j+1]-pts[j-1])
+		}
+	}
+	return length, true
+}
+
+// run executes a content stream with the given resources
+func (p *pageRasterizer) run(content []byte, res pdfDict) {
+	scanContent(content, func(op string, operands []interface{}) {
+		p.op(op, operands, res)
+	})
+}
+
+func (p *pageRasterizer) op(name string, ops []interface{}, res pdfDict) {
+	if p.textOp(name, ops, res) {
+		return
+	}
+	switch name {
+	case "q":
+		p.stack = append(p.stack, p.st)
+	case "Q":
+		if n := len(p.stack); n > 0 {
+			p.st = p.stack[n-1]
+			p.stack = p.stack[:n-1]
+		}
+	case "cm":
+		if v, ok := operands(ops, 6); ok {
+			p.st.ctm = rasterMul(d2d.Matrix{v[0], v[1], v[2], v[3], v[4], v[5]}, p.st.ctm)
+		}
+	case "w":
+		if v, ok := operands(ops, 1); ok {
+			p.st.lineWidth = v[0]
+		}
+	case "J":
+		if v, ok := operands(ops, 1); ok && v[0] >= 0 && v[0] < 3 {
+			p.st.lineCap = []d2d.LineCap{d2d.ButtCap, d2d.RoundCap, d2d.SquareCap}[int(v[0])]
+		}
+	case "j":
+		if v, ok := operands(ops, 1); ok && v[0] >= 0 && v[0] < 3 {
+			p.st.lineJoin = []d2d.LineJoin{d2d.MiterJoin, d2d.RoundJoin, d2d.BevelJoin}[int(v[0])]
+		}
+	case "d":
+		if len(ops) == 2 {
+			p.setDash(p.r.resolve(ops[0]), ops[1])
+		}
+	case "gs":
+		if len(ops) == 1 {
+			if gs, ok := p.resource(res, "ExtGState", ops[0]).(pdfDict); ok {
+				p.extGState(gs)
+			}
+		}
+	case "m":
+		if v, ok := operands(ops, 2); ok {
+			p.path.MoveTo(v[0], v[1])
+		}
+	case "l":
+		if v, ok := operands(ops, 2); ok {
+			p.path.LineTo(v[0], v[1])
+		}
+	case "c":
+		if v, ok := operands(ops, 6); ok {
+			p.path.CubicCurveTo(v[0], v[1], v[2], v[3], v[4], v[5])
+		}
+	case "v":
+		if v, ok := operands(ops, 4); ok {
+			x, y := p.path.LastPoint()
+			p.path.CubicCurveTo(x, y, v[0], v[1], v[2], v[3])
+		}
+	case "y":
+		if v, ok := operands(ops, 4); ok {
+			p.path.CubicCurveTo(v[0], v[1], v[2], v[3], v[2], v[3])
+		}
+	case "h":
+		if !p.path.IsEmpty() {
+			p.path.Close()
+		}
+	case "re":
+		if v, ok := operands(ops, 4); ok {
+			p.path.MoveTo(v[0], v[1])
+			p.path.LineTo(v[0]+v[2], v[1])
+			p.path.LineTo(v[0]+v[2], v[1]+v[3])
+			p.path.LineTo(v[0], v[1]+v[3])
+			p.path.Close()
+		}
+	case "S", "s", "f", "F", "f*", "B", "B*", "b", "b*", "n":
+		p.paintPath(name)
+	case "W":
+		p.clipRule = 1
+	case "W*":
+		p.clipRule = 2
+	case "g", "G", "rg", "RG", "k", "K":
+		p.setDeviceColor(name, ops)
+	case "cs", "CS":
+		if len(ops) == 1 {
+			space := p.colorSpace(ops[0], res)
+			clr := rasterColor{space: space, comps: space.initial()}
+			if name == "cs" {
+				p.st.fill = clr
+			} else {
+				p.st.stroke = clr
+			}
+		}
+	case "sc", "scn":
+		p.st.fill.comps = colorOperands(ops, p.st.fill)
+	case "SC", "SCN":
+		p.st.stroke.comps = colorOperands(ops, p.st.stroke)
+	case "Do":
+		if len(ops) == 1 {
+			p.xobject(p.resource(res, "XObject", ops[0]))
+		}
+	case "sh":
+		if len(ops) == 1 && !p.isHidden() {
+			p.shading(p.resource(res, "Shading", ops[0]), res)
+		}
+	case "BDC":
+		hide := false
+		if len(ops) == 2 && ops[0] == pdfName("OC") {
+			hide = p.ocHidden(p.resource(res, "Properties", ops[1]), ops[1])
+		}
+		p.hidden = append(p.hidden, hide)
+	case "BMC":
+		p.hidden = append(p.hidden, false)
+	case "EMC":
+		if n := len(p.hidden); n > 0 {
+			p.hidden = p.hidden[:n-1]
+		}
+	}
+}
+
+// resource looks up the named entry of a resource category
+func (p *pageRasterizer) resource(res pdfDict, category pdfName, name interface{}) interface{} {
+	n, ok := name.(pdfName)
+	if !ok {
+		return nil
+	}
+	dict, _ := p.r.resolve(res[category]).(pdfDict)
+	return p.r.resolve(dict[n])
+}
+
+// ocHidden reports whether the optional content group or membership
+// dictionary is turned off in the default configuration
+func (p *pageRasterizer) ocHidden(obj interface{}, ref interface{}) bool {
+	dict, _ := obj.(pdfDict)
+	if dict == nil {
+		return false
+	}
+	if dict["Type"] == pdfName("OCMD") {
+		groups := dict["OCGs"]
+		list, ok := p.r.resolve(groups).(pdfArray)
+		if !ok {
+			list = pdfArray{groups}
+		}
+		// the default policy, AnyOn, hides the content if all groups are off
+		for _, g := range list {
+			if r, ok := g.(pdfRef); !ok || !p.offGroups[r.num] {
+				return false
+			}
+		}
+		return len(list) > 0
+	}
+	return p.ocRefHidden(ref)
+}
+
+func (p *pageRasterizer) ocRefHidden(ref interface{}) bool {
+	r, ok := ref.(pdfRef)
+	return ok && p.offGroups[r.num]
+}
+
+func (p *pageRasterizer) setDash(arr, phase interface{}) {
+	p.st.dash = nil
+	list, _ := arr.(pdfArray)
+	total := 0.0
+	for _, v := range list {
+		d := pdfNumber(p.r.resolve(v))
+		if d < 0 || math.IsInf(d, 0) || math.IsNaN(d) {
+			total = 0
+			break
+		}
+		p.st.dash = append(p.st.dash, d)
+		total += d
+	}
+	if total <= 0 || math.IsInf(total, 0) {
+		p.st.dash = nil
+	} else if len(p.st.dash)%2 == 1 {
+		p.st.dash = append(p.st.dash, p.st.dash...)
+	}
+	p.st.dashOffset = pdfNumber(phase)
+	if math.IsInf(p.st.dashOffset, 0) || math.IsNaN(p.st.dashOffset) {
+		p.st.dashOffset = 0
+	}
+}
+
+func (p *pageRasterizer) extGState(gs pdfDict) {
+	for key, v := range gs {
+		v = p.r.resolve(v)
+		switch key {
+		case "ca":
+			p.st.fillAlpha = pdfNumber(v)
+		case "CA":
+			p.st.strokeAlpha = pdfNumber(v)
+		case "LW":
+			p.st.lineWidth = pdfNumber(v)
+		case "LC":
+			p.op("J", []interface{}{v}, nil)
+		case "LJ":
+			p.op("j", []interface{}{v}, nil)
+		case "D":
+			if arr, ok := v.(pdfArray); ok && len(arr) == 2 {
+				p.setDash(p.r.resolve(arr[0]), p.r.resolve(arr[1]))
+			}
+		case "Font":
+			if arr, ok := v.(pdfArray); ok && len(arr) == 2 {
+				p.st.font = p.font(arr[0])
+				p.st.fontSize = pdfNumber(p.r.resolve(arr[1]))
+			}
+		}
+	}
+}
+
+// deviceColor returns the color to paint with, including the constant alpha
+func (p *pageRasterizer) deviceColor(clr rasterColor, alpha float64) color.Color {
+	r, g, b := clr.space.rgb(clr.comps)
+	return color.NRGBA{
+		R: uint8(math.Round(clamp01(r) * 255)),
+		G: uint8(math.Round(clamp01(g) * 255)),
+		B: uint8(math.Round(clamp01(b) * 255)),
+		A: uint8(math.Round(clamp01(alpha) * 255)),
+	}
+}
+
+func clamp01(v float64) float64 {
+	if v < 0 || math.IsNaN(v) {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// setStroke configures the line parameters of gc for a path of the given
+// device length transformed by the matrix tr
+func (p *pageRasterizer) setStroke(gc *img.GraphicContext, tr d2d.Matrix, length float64) {
+	width := p.st.lineWidth
+	scale := tr.GetScale()
+	// a line width of zero, or a line thinner than a pixel, is drawn one
+	// pixel wide
+	if scale > 0 && width*scale < 1 {
+		width = 1 / scale
+	}
+	if scale > 0 && width*scale > rasterLimit {
+		width = rasterLimit / scale
+	}
+	gc.SetLineWidth(width)
+	gc.SetLineCap(p.st.lineCap)
+	gc.SetLineJoin(p.st.lineJoin)
+	period := 0.0
+	for _, d := range p.st.dash {
+		period += d
+	}
+	if period*scale > 0 && length/(period*scale) <= rasterMaxDashes {
+		offset := math.Mod(p.st.dashOffset, period)
+		if offset < 0 {
+			offset += period
+		}
+		gc.SetLineDash(p.st.dash, offset)
+	} else {
+		gc.SetLineDash(nil, 0)
+	}
+	gc.SetStrokeColor(p.deviceColor(p.st.stroke, p.st.strokeAlpha))
+}
+
+func (p *pageRasterizer) paintPath(op string) {
+	path := p.path
+	p.path = new(d2d.Path)
+	if op == "s" || op == "b" || op == "b*" {
+		path.Close()
+	}
+	length, ok := rasterPathLength(path, p.st.ctm)
+	if !ok {
+		path = new(d2d.Path)
+	}
+	if !p.isHidden() && !path.IsEmpty() {
+		p.painter.clip = p.st.clip
+		p.gc.SetMatrixTransform(p.st.ctm)
+		fill := op != "S" && op != "s" && op != "n"
+		stroke := op == "S" || op == "s" || op[0] == 'B' || op[0] == 'b'
+		if fill {
+			if op == "f*" || op == "B*" || op == "b*" {
+				p.gc.SetFillRule(d2d.FillRuleEvenOdd)
+			} else {
+				p.gc.SetFillRule(d2d.FillRuleWinding)
+			}
+			p.gc.SetFillColor(p.deviceColor(p.st.fill, p.st.fillAlpha))
+			p.gc.Fill(path)
+		}
+		if stroke {
+			p.setStroke(p.gc, p.st.ctm, length)
+			p.gc.Stroke(path)
+		}
+	}
+	if p.clipRule != 0 {
+		p.clipPath(path, p.clipRule == 2, p.st.ctm)
+		p.clipRule = 0
+	}
+}
+
+// clipPath intersects the clipping region with the path transformed by tr
+func (p *pageRasterizer) clipPath(path *d2d.Path, evenOdd bool, tr d2d.Matrix) {
+	mask := image.NewAlpha(p.dst.Bounds())
+	if !path.IsEmpty() {
+		p.masker.mask = mask
+		p.maskGC.SetMatrixTransform(tr)
+		if evenOdd {
+			p.maskGC.SetFillRule(d2d.FillRuleEvenOdd)
+		} else {
+			p.maskGC.SetFillRule(d2d.FillRuleWinding)
+		}
+		p.maskGC.Fill(path)
+	}
+	if old := p.st.clip; old != nil {
+		for j, v := range mask.Pix {
+			mask.Pix[j] = uint8(uint32(v) * uint32(old.Pix[j]) / 0xff)
+		}
+	}
+	p.st.clip = mask
+}
+
+func (p *pageRasterizer) setDeviceColor(op string, ops []interface{}) {
+	var space *rasterSpace
+	switch op {
+	case "g", "G":
+		space = rasterDeviceGray
+	case "rg", "RG":
+		space = rasterDeviceRGB
+	default:
+		space = rasterDeviceCMYK
+	}
+	v, ok := operands(ops, space.n)
+	if !ok {
+		return
+	}
+	if op[0] >= 'a' {
+		p.st.fill = rasterColor{space: space, comps: v}
+	} else {
+		p.st.stroke = rasterColor{space: space, comps: v}
+	}
+}
+
+// colorOperands returns the numeric components of a color operator, keeping
+// the current ones if they are missing
+func colorOperands(ops []interface{}, clr rasterColor) []float64 {
+	n := clr.space.n
+	if n == 0 {
+		return clr.comps
+	}
+	v, ok := operands(ops, n)
+	if !ok {
+		return clr.comps
+	}
+	return v
+}
+
+// xobject draws an image or form XObject
+func (p *pageRasterizer) xobject(obj interface{}) {
+	stm, ok := obj.(*pdfStream)
+	if !ok || p.isHidden() {
+		return
+	}
+	if oc := stm.dict["OC"]; oc != nil && p.ocHidden(p.r.resolve(oc), oc) {
+		return
+	}
+	switch stm.dict["Subtype"] {
+	case pdfName("Image"):
+		p.image(stm)
+	case pdfName("Form"):
+		p.form(stm, d2d.NewIdentityMatrix(), nil)
+	}
+}
+
+// form runs the content of a form XObject. The matrix tr, applied after the
+// form matrix, places annotation appearances.
+func (p *pageRasterizer) form(stm *pdfStream, tr d2d.Matrix, parent pdfDict) {
+	if p.depth >= 16 {
+		return
+	}
+	data, err := p.r.decode(stm)
+	if err != nil {
+		return
+	}
+	save := p.st
+	saveStack := len(p.stack)
+	matrix := d2d.NewIdentityMatrix()
+	if arr, ok := p.r.resolve(stm.dict["Matrix"]).(pdfArray); ok && len(arr) == 6 {
+		for j := range matrix {
+			matrix[j] = pdfNumber(p.r.resolve(arr[j]))
+		}
+	}
+	p.st.ctm = rasterMul(rasterMul(matrix, tr), p.st.ctm)
+	if arr, ok := p.r.resolve(stm.dict["BBox"]).(pdfArray); ok && len(arr) == 4 {
+		var v [4]float64
+		for j := range v {
+			v[j] = pdfNumber(p.r.resolve(arr[j]))
+		}
+		bbox := new(d2d.Path)
+		bbox.MoveTo(v[0], v[1])
+		bbox.LineTo(v[2], v[1])
+		bbox.LineTo(v[2], v[3])
+		bbox.LineTo(v[0], v[3])
+		bbox.Close()
+		p.clipPath(bbox, false, p.st.ctm)
+	}
+	res, ok := p.r.resolve(stm.dict["Resources"]).(pdfDict)
+	if !ok {
+		res = parent
+	}
+	path, tm, tlm := p.path, p.tm, p.tlm
+	p.path = new(d2d.Path)
+	p.depth++
+	p.run(data, res)
+	p.depth--
+	p.path, p.tm, p.tlm = path, tm, tlm
+	p.st = save
+	p.stack = p.stack[:saveStack]
+}
+
+// annotations draws the normal appearance of the visible annotations of
+// the page
+func (p *pageRasterizer) annotations(page pdfDict) {
+	annots, _ := p.r.resolve(page["Annots"]).(pdfArray)
+	for _, a := range annots {
+		annot, ok := p.r.resolve(a).(pdfDict)
+		if !ok {
+			continue
+		}
+		if flags, _ := p.r.resolve(annot["F"]).(int); flags&(1|2) != 0 {
+			continue
+		}
+		ap, _ := p.r.resolve(annot["AP"]).(pdfDict)
+		var stm *pdfStream
+		switch n := p.r.resolve(ap["N"]).(type) {
+		case *pdfStream:
+			stm = n
+		case pdfDict:
+			if as, ok := p.r.resolve(annot["AS"]).(pdfName); ok {
+				stm, _ = p.r.resolve(n[as]).(*pdfStream)
+			}
+		}
+		rect, _ := p.r.resolve(annot["Rect"]).(pdfArray)
+		bbox, _ := p.r.resolve(stm.dictValue("BBox")).(pdfArray)
+		if stm == nil || len(rect) != 4 || len(bbox) != 4 {
+			continue
+		}
+		if oc := annot["OC"]; oc != nil && p.ocHidden(p.r.resolve(oc), oc) {
+			continue
+		}
+		var rc, bb [4]float64
+		for j := range rc {
+			rc[j] = pdfNumber(p.r.resolve(rect[j]))
+			bb[j] = pdfNumber(p.r.resolve(bbox[j]))
+		}
+		matrix := d2d.NewIdentityMatrix()
+		if arr, ok := p.r.resolve(stm.dict["Matrix"]).(pdfArray); ok && len(arr) == 6 {
+			for j := range matrix {
+				matrix[j] = pdfNumber(p.r.resolve(arr[j]))
+			}
+		}
+		// map the transformed bounding box onto the annotation rectangle
+		x0, y0, x1, y1 := matrix.TransformRectangle(bb[0], bb[1], bb[2], bb[3])
+		if x1-x0 == 0 || y1-y0 == 0 {
+			continue
+		}
+		sx := (math.Abs(rc[2] - rc[0])) / (x1 - x0)
+		sy := (math.Abs(rc[3] - rc[1])) / (y1 - y0)
+		fit := d2d.Matrix{sx, 0, 0, sy, math.Min(rc[0], rc[2]) - x0*sx, math.Min(rc[1], rc[3]) - y0*sy}
+		p.form(stm, fit, nil)
+	}
+}
+
+// dictValue returns an entry of the stream dictionary, or nil for a nil
+// stream
+func (stm *pdfStream) dictValue(key pdfName) interface{} {
+	if stm == nil {
+		return nil
+	}
+	return stm.dict[key]
+}
+
+var errRasterUnsupported = errors.New("pdf: unsupported image")
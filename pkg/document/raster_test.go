@@ -0,0 +1,236 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func rasterTestDoc(fillR int) *Bdf {
+	pdf := New("P", "pt", "A4", "")
+	pdf.SetCompression(false)
+	pdf.AddPage()
+	pdf.SetFillColor(fillR, 0, 0)
+	pdf.Rect(100, 100, 100, 50, "F")
+	pdf.SetFillColorCMYK(0, 100, 0, 0)
+	pdf.Rect(300, 100, 50, 50, "F")
+	pdf.ClipCircle(150, 300, 40, false)
+	pdf.SetFillColor(0, 0, 255)
+	pdf.Rect(100, 250, 100, 100, "F")
+	pdf.ClipEnd()
+	pdf.SetAlpha(0.5, "Normal")
+	pdf.SetFillColor(0, 0, 0)
+	pdf.Rect(300, 250, 50, 50, "F")
+	pdf.SetAlpha(1, "Normal")
+	pdf.SetFont("Helvetica", "", 40)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Text(100, 500, "HHHH")
+	return pdf
+}
+
+func rasterNear(c color.RGBA, r, g, b uint8) bool {
+	near := func(a, b uint8) bool {
+		return a-b < 8 || b-a < 8
+	}
+	return near(c.R, r) && near(c.G, g) && near(c.B, b)
+}
+
+func TestRasterizePage(t *testing.T) {
+	list, err := rasterTestDoc(255).RasterizePages(RasterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("got %d pages", len(list))
+	}
+	img := list[0]
+	if b := img.Bounds(); b.Dx() != 596 || b.Dy() != 842 {
+		t.Fatalf("unexpected size %v", b)
+	}
+	checks := []struct {
+		x, y    int
+		r, g, b uint8
+		what    string
+	}{
+		{150, 125, 255, 0, 0, "red rectangle"},
+		{90, 125, 255, 255, 255, "background"},
+		{325, 125, 255, 0, 255, "CMYK magenta"},
+		{150, 300, 0, 0, 255, "inside clip"},
+		{105, 255, 255, 255, 255, "outside clip"},
+		{325, 275, 127, 127, 127, "half transparent black"},
+	}
+	for _, c := range checks {
+		if px := img.RGBAAt(c.x, c.y); !rasterNear(px, c.r, c.g, c.b) {
+			t.Errorf("%s: pixel (%d, %d) is %v", c.what, c.x, c.y, px)
+		}
+	}
+	var dark int
+	for y := 465; y < 505; y++ {
+		for x := 100; x < 220; x++ {
+			if img.RGBAAt(x, y).R < 64 {
+				dark++
+			}
+		}
+	}
+	if dark < 500 {
+		t.Errorf("text is not drawn: %d dark pixels", dark)
+	}
+	for y := 505; y < 560; y++ {
+		for x := 100; x < 220; x++ {
+			if img.RGBAAt(x, y).R < 64 {
+				t.Fatalf("text drawn below baseline at (%d, %d)", x, y)
+			}
+		}
+	}
+}
+
+func TestRasterizeOptions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := rasterTestDoc(255).Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewPDFReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := r.RasterizePage(1, RasterOptions{MaxSize: 100, Background: color.RGBA{0, 255, 0, 255}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dy() != 100 || b.Dx() != 71 {
+		t.Errorf("thumbnail size is %v", b)
+	}
+	if px := img.RGBAAt(2, 2); !rasterNear(px, 0, 255, 0) {
+		t.Errorf("background is %v", px)
+	}
+	if _, err = r.RasterizePage(2, RasterOptions{}); err == nil {
+		t.Errorf("missing page was rendered")
+	}
+	var out bytes.Buffer
+	if err = r.WritePagePNG(&out, 1, RasterOptions{DPI: 36}); err != nil {
+		t.Fatal(err)
+	}
+	pngImg, err := png.Decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := pngImg.Bounds(); b.Dx() != 298 || b.Dy() != 421 {
+		t.Errorf("PNG size is %v", b)
+	}
+}
+
+func TestRasterizeAnnotations(t *testing.T) {
+	pdf := New("P", "pt", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.SetFillColor(0, 0, 255)
+	pdf.TextField("name", 100, 100, 200, 50, "", FormFieldOptions{Fill: true})
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewPDFReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := r.RasterizePage(1, RasterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if px := img.RGBAAt(200, 125); !rasterNear(px, 0, 0, 255) {
+		t.Errorf("field background is %v", px)
+	}
+}
+
+func TestComparePDFRasters(t *testing.T) {
+	output := func(pdf *Bdf) *bytes.Buffer {
+		var buf bytes.Buffer
+		if err := pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return &buf
+	}
+	pdf1 := rasterTestDoc(255)
+	pdf1.SetTitle("First", false)
+	pdf2 := rasterTestDoc(255)
+	pdf2.SetTitle("Second", false)
+	if err := ComparePDFRasters(output(pdf1), output(pdf2), RasterOptions{DPI: 36}, 0); err != nil {
+		t.Errorf("equal pages differ: %s", err)
+	}
+	err := ComparePDFRasters(output(rasterTestDoc(255)), output(rasterTestDoc(200)), RasterOptions{DPI: 36}, 16)
+	if err == nil {
+		t.Errorf("different pages compare equal")
+	}
+	if err = ComparePDFRasters(output(rasterTestDoc(255)), output(rasterTestDoc(250)), RasterOptions{DPI: 36}, 16); err != nil {
+		t.Errorf("difference within tolerance: %s", err)
+	}
+}
+
+func TestLZWDecode(t *testing.T) {
+	// Example from section 7.4.4.2 of the PDF specification
+	data := []byte{0x80, 0x0B, 0x60, 0x50, 0x22, 0x0C, 0x0C, 0x85, 0x01}
+	out, err := lzwDecode(data, pdfDict{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "-----A---B" {
+		t.Errorf("decoded %q", out)
+	}
+}
+
+func TestRasterizeMalformed(t *testing.T) {
+	for _, content := range []string{
+		"-1 J 0 0 m 10 10 l S",
+		"-2 j 0 0 m 10 10 l S",
+		"1e308 J 1e308 j 0 0 m 10 10 l S",
+		"0 0 m 1e308 1e308 l f",
+		"[1 2] 0 d 0 0 m 1e308 1e308 l S",
+		"[1e-300] 0 d 0 0 m 500 500 l S",
+		"[1 2] 1e308 d 0 0 m 500 500 l S",
+		"1e308 w 0 0 m 10 10 l S",
+		"1e308 0 0 1e308 0 0 cm 0 0 10 10 re f",
+		"BT /F1 1e308 Tf 10 10 Td (abc) Tj ET",
+		"BT /F1 10 Tf 1e308 Tc 10 10 Td (abc) Tj ET",
+		"BT /F1 10 Tf 1e308 Tw 10 10 Td (a b c) Tj ET",
+		"BT /F1 10 Tf 7 Tr 1e308 Ts 10 10 Td (abc) Tj ET 0 0 10 10 re f",
+	} {
+		pdf := New("P", "pt", "A4", "")
+		pdf.SetCompression(false)
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.Text(100, 100, "ok")
+		pdf.RawWriteStr(content)
+		var buf bytes.Buffer
+		if err := pdf.Output(&buf); err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewPDFReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.RasterizePage(1, RasterOptions{}); err != nil {
+			t.Errorf("%q: %v", content, err)
+		}
+	}
+}
@@ -0,0 +1,521 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	d2d "github.com/bhojpur/render/pkg/g2d/draw"
+	"github.com/bhojpur/render/pkg/g2d/img"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+// rasterFont holds the glyph outlines and metrics of a font resource
+type rasterFont struct {
+	ttf      *truetype.Font // embedded or substituted outlines; nil draws nothing
+	embedded bool
+	cid      bool   // two-byte codes of a Type0 font
+	gids     []byte // CIDToGIDMap; nil if CIDs are glyph indices
+	widths   map[int]float64
+	dw       float64 // width of codes without an entry, or -1 to measure the glyph
+	runes    [256]rune
+	slant    float64 // shear applied to substituted oblique fonts
+	glyphs   map[truetype.Index]*d2d.Path
+	buf      truetype.GlyphBuf
+}
+
+// glyphScale loads outlines in units of 1/1000 em, the unit of PDF glyph
+// space
+const glyphScale = fixed.Int26_6(1000 << 6)
+
+var rasterFonts = struct {
+	sync.Mutex
+	subst  map[string]*truetype.Font
+	widths map[string][]int
+	names  map[string]rune
+}{subst: make(map[string]*truetype.Font), widths: make(map[string][]int)}
+
+// substituteFont returns a Go font standing in for a font that is not
+// embedded
+func substituteFont(key string) *truetype.Font {
+	rasterFonts.Lock()
+	defer rasterFonts.Unlock()
+	if ttf, ok := rasterFonts.subst[key]; ok {
+		return ttf
+	}
+	data := map[string][]byte{
+		"sans": goregular.TTF, "sansb": gobold.TTF, "sansi": goitalic.TTF, "sansbi": gobolditalic.TTF,
+		"mono": gomono.TTF, "monob": gomonobold.TTF,
+	}[key]
+	ttf, _ := truetype.Parse(data)
+	rasterFonts.subst[key] = ttf
+	return ttf
+}
+
+// coreWidths returns the glyph widths of a standard font by WinAnsi code,
+// or nil if the font is not one of the standard fonts
+func coreWidths(baseFont string) []int {
+	name := strings.ToLower(baseFont)
+	var key string
+	for _, family := range []string{"helvetica", "arial", "times", "courier", "zapfdingbats"} {
+		if strings.HasPrefix(name, family) {
+			key = family
+			break
+		}
+	}
+	switch key {
+	case "":
+		return nil
+	case "arial":
+		key = "helvetica"
+	}
+	if key != "zapfdingbats" {
+		if strings.Contains(name, "bold") {
+			key += "b"
+		}
+		if strings.Contains(name, "italic") || strings.Contains(name, "oblique") {
+			key += "i"
+		}
+	}
+	rasterFonts.Lock()
+	defer rasterFonts.Unlock()
+	if cw, ok := rasterFonts.widths[key]; ok {
+		return cw
+	}
+	var def fontDefType
+	if emb, err := embFS.Open("font_embed/" + key + ".json"); err == nil {
+		_ = json.NewDecoder(emb).Decode(&def)
+		emb.Close()
+	}
+	rasterFonts.widths[key] = def.Cw
+	return def.Cw
+}
+
+// glyphRune returns the Unicode value of a glyph name, using the names of
+// the embedded code page maps and the uniXXXX and uXXXX conventions
+func glyphRune(name string) rune {
+	rasterFonts.Lock()
+	if rasterFonts.names == nil {
+		rasterFonts.names = make(map[string]rune)
+		for _, cp := range []string{"cp1250", "cp1252"} {
+			if emb, err := embFS.Open("font_embed/" + cp + ".map"); err == nil {
+				if list, err := readMap(emb); err == nil {
+					for _, enc := range list {
+						if enc.uv >= 0 && enc.name != ".notdef" {
+							rasterFonts.names[enc.name] = rune(enc.uv)
+						}
+					}
+				}
+				emb.Close()
+			}
+		}
+	}
+	r, ok := rasterFonts.names[name]
+	rasterFonts.Unlock()
+	if ok {
+		return r
+	}
+	for _, prefix := range []string{"uni", "u"} {
+		if strings.HasPrefix(name, prefix) && len(name) >= len(prefix)+4 {
+			if v, err := strconv.ParseUint(name[len(prefix):len(prefix)+4], 16, 32); err == nil {
+				return rune(v)
+			}
+		}
+	}
+	return 0
+}
+
+// winAnsiRunes returns the Unicode values of the WinAnsi encoding
+func winAnsiRunes() (runes [256]rune) {
+	for j := range runes {
+		runes[j] = rune(j)
+	}
+	if emb, err := embFS.Open("font_embed/cp1252.map"); err == nil {
+		if list, err := readMap(emb); err == nil {
+			for j, enc := range list {
+				if enc.uv >= 0 {
+					runes[j] = rune(enc.uv)
+				}
+			}
+		}
+		emb.Close()
+	}
+	return
+}
+
+// font returns the font of a font resource, loading it once per object
+func (p *pageRasterizer) font(obj interface{}) *rasterFont {
+	ref, isRef := obj.(pdfRef)
+	if f, ok := p.fonts[ref]; ok && isRef {
+		return f
+	}
+	dict, _ := p.r.resolve(obj).(pdfDict)
+	f := p.loadFont(dict)
+	if isRef {
+		p.fonts[ref] = f
+	}
+	return f
+}
+
+func (p *pageRasterizer) loadFont(dict pdfDict) *rasterFont {
+	f := &rasterFont{widths: make(map[int]float64), dw: -1, glyphs: make(map[truetype.Index]*d2d.Path)}
+	baseFont, _ := p.r.resolve(dict["BaseFont"]).(pdfName)
+	name := string(baseFont)
+	if pos := strings.IndexByte(name, '+'); pos == 6 {
+		name = name[pos+1:]
+	}
+	desc, _ := p.r.resolve(dict["FontDescriptor"]).(pdfDict)
+	if dict["Subtype"] == pdfName("Type0") {
+		f.cid = true
+		f.dw = 1000
+		list, _ := p.r.resolve(dict["DescendantFonts"]).(pdfArray)
+		if len(list) > 0 {
+			cidFont, _ := p.r.resolve(list[0]).(pdfDict)
+			desc, _ = p.r.resolve(cidFont["FontDescriptor"]).(pdfDict)
+			if v, ok := p.r.resolve(cidFont["DW"]).(int); ok {
+				f.dw = float64(v)
+			}
+			p.cidWidths(f, cidFont["W"])
+			if stm, ok := p.r.resolve(cidFont["CIDToGIDMap"]).(*pdfStream); ok {
+				f.gids, _ = p.r.decode(stm)
+			}
+		}
+	} else {
+		first, _ := p.r.resolve(dict["FirstChar"]).(int)
+		widths, _ := p.r.resolve(dict["Widths"]).(pdfArray)
+		for j, w := range widths {
+			f.widths[first+j] = pdfNumber(p.r.resolve(w))
+		}
+		if len(widths) == 0 {
+			for j, w := range coreWidths(name) {
+				f.widths[j] = float64(w)
+			}
+		}
+		if w, ok := p.r.resolve(desc["MissingWidth"]).(int); ok && len(widths) > 0 {
+			f.dw = float64(w)
+		}
+		p.simpleEncoding(f, dict)
+	}
+	if stm, ok := p.r.resolve(desc["FontFile2"]).(*pdfStream); ok {
+		if data, err := p.r.decode(stm); err == nil {
+			if ttf, err := truetype.Parse(data); err == nil {
+				f.ttf, f.embedded = ttf, true
+			}
+		}
+	}
+	if f.ttf == nil && dict["Subtype"] != pdfName("Type3") {
+		lower := strings.ToLower(name)
+		key := "sans"
+		if strings.Contains(lower, "courier") || strings.Contains(lower, "mono") {
+			key = "mono"
+		}
+		if strings.Contains(lower, "bold") {
+			key += "b"
+		}
+		if strings.Contains(lower, "italic") || strings.Contains(lower, "oblique") {
+			if key[0] == 'm' {
+				f.slant = 0.2
+			} else {
+				key += "i"
+			}
+		}
+		f.ttf = substituteFont(key)
+	}
+	return f
+}
+
+// cidWidths reads the W array of a CID font
+func (p *pageRasterizer) cidWidths(f *rasterFont, obj interface{}) {
+	list, _ := p.r.resolve(obj).(pdfArray)
+	for j := 0; j+1 < len(list); {
+		first, ok := p.r.resolve(list[j]).(int)
+		if !ok {
+			return
+		}
+		if arr, ok := p.r.resolve(list[j+1]).(pdfArray); ok {
+			for k, w := range arr {
+				f.widths[first+k] = pdfNumber(p.r.resolve(w))
+			}
+			j += 2
+			continue
+		}
+		if j+2 >= len(list) {
+			return
+		}
+		last, _ := p.r.resolve(list[j+1]).(int)
+		w := pdfNumber(p.r.resolve(list[j+2]))
+		for c := first; c <= last && c-first < 1<<16; c++ {
+			f.widths[c] = w
+		}
+		j += 3
+	}
+}
+
+// simpleEncoding sets the Unicode values of the codes of a single byte font
+// from its base encoding and differences
+func (p *pageRasterizer) simpleEncoding(f *rasterFont, dict pdfDict) {
+	f.runes = winAnsiRunes()
+	enc, ok := p.r.resolve(dict["Encoding"]).(pdfDict)
+	if !ok {
+		return
+	}
+	diff, _ := p.r.resolve(enc["Differences"]).(pdfArray)
+	code := 0
+	for _, v := range diff {
+		switch t := p.r.resolve(v).(type) {
+		case int:
+			code = t
+		case pdfName:
+			if code >= 0 && code < 256 {
+				if r := glyphRune(string(t)); r != 0 {
+					f.runes[code] = r
+				}
+			}
+			code++
+		}
+	}
+}
+
+// glyph returns the glyph index of a character code
+func (f *rasterFont) glyph(code int) truetype.Index {
+	if f.cid {
+		if f.gids != nil {
+			if 2*code+1 < len(f.gids) {
+				return truetype.Index(int(f.gids[2*code])<<8 | int(f.gids[2*code+1]))
+			}
+			return 0
+		}
+		if !f.embedded {
+			// Bdf uses Unicode values as CIDs
+			return f.ttf.Index(rune(code))
+		}
+		return truetype.Index(code)
+	}
+	idx := f.ttf.Index(f.runes[code&0xff])
+	if idx == 0 && f.embedded {
+		// symbolic fonts map codes to the private use area
+		if idx = f.ttf.Index(rune(0xF000 | code)); idx == 0 {
+			idx = f.ttf.Index(rune(code))
+		}
+	}
+	return idx
+}
+
+// width returns the advance width of a code in glyph space units
+func (f *rasterFont) width(code int, gid truetype.Index) float64 {
+	if w, ok := f.widths[code]; ok {
+		return w
+	}
+	if f.dw >= 0 || f.ttf == nil {
+		return f.dw
+	}
+	return float64(f.ttf.HMetric(glyphScale, gid).AdvanceWidth) / 64
+}
+
+// appendGlyph appends the outline of a glyph, transformed by tr from glyph
+// space with the y axis pointing down, to path
+func (f *rasterFont) appendGlyph(path *d2d.Path, gid truetype.Index, tr d2d.Matrix) {
+	outline, ok := f.glyphs[gid]
+	if !ok {
+		outline = new(d2d.Path)
+		if err := f.buf.Load(f.ttf, glyphScale, gid, font.HintingNone); err == nil {
+			e0 := 0
+			for _, e1 := range f.buf.Ends {
+				img.DrawContour(outline, f.buf.Points[e0:e1], 0, 0)
+				outline.Close()
+				e0 = e1
+			}
+		}
+		f.glyphs[gid] = outline
+	}
+	pts := make([]float64, len(outline.Points))
+	copy(pts, outline.Points)
+	tr.Transform(pts)
+	path.Components = append(path.Components, outline.Components...)
+	path.Points = append(path.Points, pts...)
+}
+
+// textOp executes the text operators; it returns false for other operators
+func (p *pageRasterizer) textOp(name string, ops []interface{}, res pdfDict) bool {
+	switch name {
+	case "BT":
+		p.tm = d2d.NewIdentityMatrix()
+		p.tlm = p.tm
+	case "ET":
+		if p.textClip != nil {
+			p.clipPath(p.textClip, false, d2d.NewIdentityMatrix())
+			p.textClip = nil
+		}
+	case "Tc", "Tw", "Tz", "TL", "Ts", "Tr":
+		v, ok := operands(ops, 1)
+		if !ok {
+			break
+		}
+		switch name {
+		case "Tc":
+			p.st.charSpace = v[0]
+		case "Tw":
+			p.st.wordSpace = v[0]
+		case "Tz":
+			p.st.scale = v[0] / 100
+		case "TL":
+			p.st.leading = v[0]
+		case "Ts":
+			p.st.rise = v[0]
+		case "Tr":
+			p.st.render = int(v[0])
+		}
+	case "Tf":
+		if len(ops) == 2 {
+			if fontName, ok := ops[0].(pdfName); ok {
+				fonts, _ := p.r.resolve(res["Font"]).(pdfDict)
+				p.st.font = p.font(fonts[fontName])
+			}
+			p.st.fontSize = pdfNumber(ops[1])
+		}
+	case "Td", "TD":
+		if v, ok := operands(ops, 2); ok {
+			if name == "TD" {
+				p.st.leading = -v[1]
+			}
+			p.moveText(v[0], v[1])
+		}
+	case "Tm":
+		if v, ok := operands(ops, 6); ok {
+			p.tlm = d2d.Matrix{v[0], v[1], v[2], v[3], v[4], v[5]}
+			p.tm = p.tlm
+		}
+	case "T*":
+		p.moveText(0, -p.st.leading)
+	case "Tj", "'", "\"":
+		if len(ops) == 0 {
+			break
+		}
+		if name == "\"" {
+			if v, ok := operands(ops[:len(ops)-1], 2); ok {
+				p.st.wordSpace, p.st.charSpace = v[0], v[1]
+			}
+		}
+		if name != "Tj" {
+			p.moveText(0, -p.st.leading)
+		}
+		if s, ok := ops[len(ops)-1].(pdfString); ok {
+			p.showText(s)
+		}
+	case "TJ":
+		if len(ops) == 0 {
+			break
+		}
+		list, _ := ops[0].(pdfArray)
+		for _, v := range list {
+			switch t := v.(type) {
+			case pdfString:
+				p.showText(t)
+			case int, float64:
+				tx := -pdfNumber(t) / 1000 * p.st.fontSize * p.st.scale
+				p.tm = rasterMul(d2d.Matrix{1, 0, 0, 1, tx, 0}, p.tm)
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (p *pageRasterizer) moveText(tx, ty float64) {
+	p.tlm = rasterMul(d2d.Matrix{1, 0, 0, 1, tx, ty}, p.tlm)
+	p.tm = p.tlm
+}
+
+// showText draws a string with the current font and advances the text
+// matrix
+func (p *pageRasterizer) showText(s []byte) {
+	f := p.st.font
+	if f == nil {
+		return
+	}
+	mode := p.st.render
+	visible := f.ttf != nil && mode != 3 && mode != 7 && !p.isHidden()
+	clip := mode >= 4
+	path := new(d2d.Path)
+	step := 1
+	if f.cid {
+		step = 2
+	}
+	size, scale := p.st.fontSize, p.st.scale
+	for j := 0; j+step <= len(s); j += step {
+		code := int(s[j])
+		if f.cid {
+			code = code<<8 | int(s[j+1])
+		}
+		gid := truetype.Index(0)
+		if f.ttf != nil {
+			gid = f.glyph(code)
+		}
+		if (visible || clip) && f.ttf != nil {
+			gm := d2d.Matrix{size * scale / 1000, 0, -f.slant * size * scale / 1000, -size / 1000, 0, p.st.rise}
+			f.appendGlyph(path, gid, rasterMul(rasterMul(gm, p.tm), p.st.ctm))
+		}
+		tx := f.width(code, gid)/1000*size + p.st.charSpace
+		if step == 1 && code == 32 {
+			tx += p.st.wordSpace
+		}
+		p.tm = rasterMul(d2d.Matrix{1, 0, 0, 1, tx * scale, 0}, p.tm)
+	}
+	length, ok := rasterPathLength(path, d2d.NewIdentityMatrix())
+	if !ok || path.IsEmpty() {
+		return
+	}
+	if clip {
+		if p.textClip == nil {
+			p.textClip = new(d2d.Path)
+		}
+		p.textClip.Components = append(p.textClip.Components, path.Components...)
+		p.textClip.Points = append(p.textClip.Points, path.Points...)
+	}
+	if !visible {
+		return
+	}
+	p.painter.clip = p.st.clip
+	p.gc.SetMatrixTransform(d2d.NewIdentityMatrix())
+	if mode%4 == 0 || mode%4 == 2 {
+		p.gc.SetFillRule(d2d.FillRuleWinding)
+		p.gc.SetFillColor(p.deviceColor(p.st.fill, p.st.fillAlpha))
+		p.gc.Fill(path)
+	}
+	if mode%4 == 1 || mode%4 == 2 {
+		p.setStroke(p.gc, p.st.ctm, length)
+		p.gc.SetLineWidth(math.Min(math.Max(1, p.st.lineWidth*p.st.ctm.GetScale()), rasterLimit))
+		p.gc.Stroke(path)
+	}
+}
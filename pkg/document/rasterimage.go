@@ -0,0 +1,738 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+
+	d2d "github.com/bhojpur/render/pkg/g2d/draw"
+	"golang.org/x/image/ccitt"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// rasterSpace converts colors of a PDF color space to RGB
+type rasterSpace struct {
+	n       int // number of components; zero for patterns
+	rgb     func(comps []float64) (r, g, b float64)
+	initial func() []float64
+	// ranges of the components, used to interpret image samples
+	decode  []float64
+	indexed bool
+}
+
+func newRasterSpace(n int, rgb func([]float64) (float64, float64, float64)) *rasterSpace {
+	s := &rasterSpace{n: n, rgb: rgb}
+	s.initial = func() []float64 { return make([]float64, n) }
+	for j := 0; j < n; j++ {
+		s.decode = append(s.decode, 0, 1)
+	}
+	return s
+}
+
+var (
+	rasterDeviceGray = newRasterSpace(1, func(c []float64) (float64, float64, float64) {
+		return c[0], c[0], c[0]
+	})
+	rasterDeviceRGB = newRasterSpace(3, func(c []float64) (float64, float64, float64) {
+		return c[0], c[1], c[2]
+	})
+	rasterDeviceCMYK = func() *rasterSpace {
+		s := newRasterSpace(4, cmykToRGB)
+		s.initial = func() []float64 { return []float64{0, 0, 0, 1} }
+		return s
+	}()
+	rasterPattern = &rasterSpace{
+		rgb:     func([]float64) (float64, float64, float64) { return 0, 0, 0 },
+		initial: func() []float64 { return nil },
+	}
+)
+
+func cmykToRGB(c []float64) (float64, float64, float64) {
+	k := 1 - c[3]
+	return (1 - c[0]) * k, (1 - c[1]) * k, (1 - c[2]) * k
+}
+
+// labToRGB converts CIE L*a*b* with a D50 white point to sRGB
+func labToRGB(c []float64) (float64, float64, float64) {
+	fy := (c[0] + 16) / 116
+	fx := fy + c[1]/500
+	fz := fy - c[2]/200
+	inv := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+	}
+	x, y, z := 0.9642*inv(fx), inv(fy), 0.8249*inv(fz)
+	// Bradford adapted XYZ (D50) to linear sRGB
+	r := 3.1339*x - 1.6169*y - 0.4906*z
+	g := -0.9788*x + 1.9161*y + 0.0335*z
+	b := 0.0719*x - 0.2290*y + 1.4052*z
+	gamma := func(v float64) float64 {
+		if v <= 0.0031308 {
+			return 12.92 * v
+		}
+		return 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	return gamma(r), gamma(g), gamma(b)
+}
+
+// colorSpace resolves a color space name or array, looking up names in the
+// ColorSpace resources
+func (p *pageRasterizer) colorSpace(obj interface{}, res pdfDict) *rasterSpace {
+	return p.resolveSpace(obj, res, 0)
+}
+
+func (p *pageRasterizer) resolveSpace(obj interface{}, res pdfDict, depth int) *rasterSpace {
+	obj = p.r.resolve(obj)
+	if depth > 8 {
+		return rasterDeviceGray
+	}
+	switch v := obj.(type) {
+	case pdfName:
+		switch v {
+		case "DeviceGray", "G", "CalGray":
+			return rasterDeviceGray
+		case "DeviceRGB", "RGB", "CalRGB":
+			return rasterDeviceRGB
+		case "DeviceCMYK", "CMYK":
+			return rasterDeviceCMYK
+		case "Pattern":
+			return rasterPattern
+		}
+		if named := p.resource(res, "ColorSpace", v); named != nil {
+			return p.resolveSpace(named, res, depth+1)
+		}
+	case pdfArray:
+		if len(v) == 0 {
+			break
+		}
+		family, _ := p.r.resolve(v[0]).(pdfName)
+		switch family {
+		case "CalGray", "CalRGB", "DeviceGray", "DeviceRGB", "DeviceCMYK":
+			return p.resolveSpace(family, res, depth+1)
+		case "Pattern":
+			return rasterPattern
+		case "Lab":
+			s := newRasterSpace(3, labToRGB)
+			s.decode = []float64{0, 100, -100, 100, -100, 100}
+			if dict, ok := p.r.resolve(v[len(v)-1]).(pdfDict); ok {
+				if rng, ok := p.r.resolve(dict["Range"]).(pdfArray); ok && len(rng) == 4 {
+					for j := range rng {
+						s.decode[2+j] = pdfNumber(p.r.resolve(rng[j]))
+					}
+				}
+			}
+			return s
+		case "ICCBased":
+			if len(v) < 2 {
+				break
+			}
+			stm, _ := p.r.resolve(v[1]).(*pdfStream)
+			if stm == nil {
+				break
+			}
+			if alt := stm.dict["Alternate"]; alt != nil {
+				return p.resolveSpace(alt, res, depth+1)
+			}
+			switch p.r.resolve(stm.dict["N"]) {
+			case 1:
+				return rasterDeviceGray
+			case 4:
+				return rasterDeviceCMYK
+			}
+			return rasterDeviceRGB
+		case "Indexed", "I":
+			if len(v) < 4 {
+				break
+			}
+			base := p.resolveSpace(v[1], res, depth+1)
+			hival, _ := p.r.resolve(v[2]).(int)
+			var lookup []byte
+			switch t := p.r.resolve(v[3]).(type) {
+			case pdfString:
+				lookup = t
+			case *pdfStream:
+				lookup, _ = p.r.decode(t)
+			}
+			s := newRasterSpace(1, func(c []float64) (float64, float64, float64) {
+				j := int(math.Round(c[0]))
+				if j < 0 {
+					j = 0
+				} else if j > hival {
+					j = hival
+				}
+				comps := make([]float64, base.n)
+				for k := range comps {
+					if pos := j*base.n + k; pos < len(lookup) {
+						comps[k] = float64(lookup[pos]) / 255
+					}
+				}
+				// the base space components scaled to their ranges
+				for k := range comps {
+					lo, hi := base.decode[2*k], base.decode[2*k+1]
+					comps[k] = lo + comps[k]*(hi-lo)
+				}
+				return base.rgb(comps)
+			})
+			s.indexed = true
+			return s
+		case "Separation", "DeviceN":
+			if len(v) < 4 {
+				break
+			}
+			n := 1
+			if family == "DeviceN" {
+				names, _ := p.r.resolve(v[1]).(pdfArray)
+				n = len(names)
+			}
+			if n < 1 {
+				break
+			}
+			alt := p.resolveSpace(v[2], res, depth+1)
+			fn := p.function(v[3])
+			s := newRasterSpace(n, func(c []float64) (float64, float64, float64) {
+				if out := fn(c); len(out) >= alt.n {
+					return alt.rgb(out)
+				}
+				return 1 - c[0], 1 - c[0], 1 - c[0]
+			})
+			s.initial = func() []float64 {
+				c := make([]float64, n)
+				for j := range c {
+					c[j] = 1
+				}
+				return c
+			}
+			return s
+		}
+	}
+	return rasterDeviceGray
+}
+
+// function returns an evaluator for a PDF function of type 2 (exponential
+// interpolation) or 3 (stitching), or arrays of such functions. Other types
+// yield no output.
+func (p *pageRasterizer) function(obj interface{}) func([]float64) []float64 {
+	obj = p.r.resolve(obj)
+	if arr, ok := obj.(pdfArray); ok {
+		var fns []func([]float64) []float64
+		for _, v := range arr {
+			fns = append(fns, p.function(v))
+		}
+		return func(in []float64) (out []float64) {
+			for _, fn := range fns {
+				out = append(out, fn(in)...)
+			}
+			return
+		}
+	}
+	var dict pdfDict
+	switch v := obj.(type) {
+	case pdfDict:
+		dict = v
+	case *pdfStream:
+		dict = v.dict
+	}
+	nums := func(key pdfName, def []float64) []float64 {
+		arr, ok := p.r.resolve(dict[key]).(pdfArray)
+		if !ok {
+			return def
+		}
+		list := make([]float64, len(arr))
+		for j, v := range arr {
+			list[j] = pdfNumber(p.r.resolve(v))
+		}
+		return list
+	}
+	domain := nums("Domain", []float64{0, 1})
+	if len(domain) < 2 {
+		domain = []float64{0, 1}
+	}
+	clip := func(x float64) float64 {
+		return math.Min(math.Max(x, domain[0]), domain[1])
+	}
+	switch p.r.resolve(dict["FunctionType"]) {
+	case 2:
+		c0 := nums("C0", []float64{0})
+		c1 := nums("C1", []float64{1})
+		n := pdfNumber(p.r.resolve(dict["N"]))
+		return func(in []float64) []float64 {
+			if len(in) == 0 || len(c0) != len(c1) {
+				return nil
+			}
+			x := math.Pow(clip(in[0]), n)
+			out := make([]float64, len(c0))
+			for j := range out {
+				out[j] = c0[j] + x*(c1[j]-c0[j])
+			}
+			return out
+		}
+	case 3:
+		var fns []func([]float64) []float64
+		list, _ := p.r.resolve(dict["Functions"]).(pdfArray)
+		for _, v := range list {
+			fns = append(fns, p.function(v))
+		}
+		bounds := nums("Bounds", nil)
+		encode := nums("Encode", nil)
+		return func(in []float64) []float64 {
+			if len(in) == 0 || len(fns) == 0 || len(bounds) != len(fns)-1 || len(encode) < 2*len(fns) {
+				return nil
+			}
+			x := clip(in[0])
+			k := 0
+			for k < len(bounds) && x >= bounds[k] {
+				k++
+			}
+			lo, hi := domain[0], domain[1]
+			if k > 0 {
+				lo = bounds[k-1]
+			}
+			if k < len(bounds) {
+				hi = bounds[k]
+			}
+			t := encode[2*k]
+			if hi > lo {
+				t += (x - lo) / (hi - lo) * (encode[2*k+1] - encode[2*k])
+			}
+			return fns[k]([]float64{t})
+		}
+	}
+	return func([]float64) []float64 { return nil }
+}
+
+// shading paints an axial or radial shading over the clipping region
+func (p *pageRasterizer) shading(obj interface{}, res pdfDict) {
+	var dict pdfDict
+	switch v := obj.(type) {
+	case pdfDict:
+		dict = v
+	case *pdfStream:
+		dict = v.dict
+	}
+	tp, _ := p.r.resolve(dict["ShadingType"]).(int)
+	coords, _ := p.r.resolve(dict["Coords"]).(pdfArray)
+	if (tp != 2 || len(coords) != 4) && (tp != 3 || len(coords) != 6) {
+		return
+	}
+	c := make([]float64, len(coords))
+	for j := range c {
+		c[j] = pdfNumber(p.r.resolve(coords[j]))
+	}
+	space := p.colorSpace(dict["ColorSpace"], res)
+	fn := p.function(dict["Function"])
+	t0, t1 := 0.0, 1.0
+	if arr, ok := p.r.resolve(dict["Domain"]).(pdfArray); ok && len(arr) == 2 {
+		t0, t1 = pdfNumber(p.r.resolve(arr[0])), pdfNumber(p.r.resolve(arr[1]))
+	}
+	var extend [2]bool
+	if arr, ok := p.r.resolve(dict["Extend"]).(pdfArray); ok && len(arr) == 2 {
+		extend[0], _ = p.r.resolve(arr[0]).(bool)
+		extend[1], _ = p.r.resolve(arr[1]).(bool)
+	}
+	inv := p.st.ctm
+	if inv.Determinant() == 0 {
+		return
+	}
+	inv.Inverse()
+	// parameter s in [0, 1] along the axis or between the circles, or
+	// false if the point is not covered
+	param := func(x, y float64) (float64, bool) {
+		if tp == 2 {
+			dx, dy := c[2]-c[0], c[3]-c[1]
+			den := dx*dx + dy*dy
+			if den == 0 {
+				return 0, false
+			}
+			return ((x-c[0])*dx + (y-c[1])*dy) / den, true
+		}
+		// largest s with the point on the circle interpolated at s
+		cdx, cdy, dr := c[3]-c[0], c[4]-c[1], c[5]-c[2]
+		pdx, pdy := x-c[0], y-c[1]
+		a := cdx*cdx + cdy*cdy - dr*dr
+		b := pdx*cdx + pdy*cdy + c[2]*dr
+		cc := pdx*pdx + pdy*pdy - c[2]*c[2]
+		var s float64
+		if math.Abs(a) < 1e-12 {
+			if b == 0 {
+				return 0, false
+			}
+			s = cc / (2 * b)
+		} else {
+			disc := b*b - a*cc
+			if disc < 0 {
+				return 0, false
+			}
+			s = (b + math.Sqrt(disc)) / a
+			if c[2]+s*dr < 0 {
+				s = (b - math.Sqrt(disc)) / a
+			}
+		}
+		return s, c[2]+s*dr >= 0
+	}
+	clip := p.st.clip
+	bounds := p.dst.Bounds()
+	alpha := uint32(clamp01(p.st.fillAlpha) * 255)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cov := alpha
+			if clip != nil {
+				cov = cov * uint32(clip.Pix[clip.PixOffset(x, y)]) / 0xff
+			}
+			if cov == 0 {
+				continue
+			}
+			ux, uy := inv.TransformPoint(float64(x)+0.5, float64(y)+0.5)
+			s, ok := param(ux, uy)
+			if !ok || (s < 0 && !extend[0]) || (s > 1 && !extend[1]) {
+				continue
+			}
+			out := fn([]float64{t0 + clamp01(s)*(t1-t0)})
+			if len(out) < space.n {
+				continue
+			}
+			r, g, b := space.rgb(out)
+			i := p.dst.PixOffset(x, y)
+			blendPixel(p.dst.Pix[i:i+4], clamp01(r), clamp01(g), clamp01(b), cov)
+		}
+	}
+}
+
+// blendPixel composites an opaque color with coverage cov (0 - 255) over an
+// RGBA pixel
+func blendPixel(pix []byte, r, g, b float64, cov uint32) {
+	inv := 255 - cov
+	pix[0] = uint8((uint32(pix[0])*inv + uint32(r*255+0.5)*cov) / 255)
+	pix[1] = uint8((uint32(pix[1])*inv + uint32(g*255+0.5)*cov) / 255)
+	pix[2] = uint8((uint32(pix[2])*inv + uint32(b*255+0.5)*cov) / 255)
+	pix[3] = uint8((uint32(pix[3])*inv + 255*cov) / 255)
+}
+
+// imageData returns the decoded samples of an image stream, or a decoded
+// image for the JPEG and CCITT filters
+func (p *pageRasterizer) imageData(stm *pdfStream) (data []byte, m image.Image, err error) {
+	var filters, params pdfArray
+	switch v := p.r.resolve(stm.dict["Filter"]).(type) {
+	case pdfName:
+		filters = pdfArray{v}
+	case pdfArray:
+		filters = v
+	}
+	switch v := p.r.resolve(stm.dict["DecodeParms"]).(type) {
+	case pdfDict:
+		params = pdfArray{v}
+	case pdfArray:
+		params = v
+	}
+	last := len(filters) - 1
+	var parm pdfDict
+	if last >= 0 && last < len(params) {
+		parm, _ = p.r.resolve(params[last]).(pdfDict)
+	}
+	final := pdfName("")
+	if last >= 0 {
+		final, _ = p.r.resolve(filters[last]).(pdfName)
+	}
+	switch final {
+	case "DCTDecode", "DCT", "CCITTFaxDecode", "CCF":
+		stm = &pdfStream{dict: pdfDict{"Filter": filters[:last], "DecodeParms": params}, data: stm.data}
+		if len(params) > last {
+			stm.dict["DecodeParms"] = params[:last]
+		}
+	case "JPXDecode", "JBIG2Decode":
+		return nil, nil, errRasterUnsupported
+	}
+	if data, err = p.r.decode(stm); err != nil {
+		return
+	}
+	switch final {
+	case "DCTDecode", "DCT":
+		m, err = jpeg.Decode(bytes.NewReader(data))
+	case "CCITTFaxDecode", "CCF":
+		m, err = p.faxImage(data, parm)
+	}
+	return
+}
+
+// faxImage decodes CCITT data into a gray image with 0 for black
+func (p *pageRasterizer) faxImage(data []byte, parm pdfDict) (image.Image, error) {
+	k, _ := p.r.resolve(parm["K"]).(int)
+	columns := 1728
+	if v, ok := p.r.resolve(parm["Columns"]).(int); ok {
+		columns = v
+	}
+	rows, _ := p.r.resolve(parm["Rows"]).(int)
+	blackIs1, _ := p.r.resolve(parm["BlackIs1"]).(bool)
+	align, _ := p.r.resolve(parm["EncodedByteAlign"]).(bool)
+	mode := ccitt.Group3
+	if k < 0 {
+		mode = ccitt.Group4
+	}
+	sub := ccitt.AutoDetectHeight
+	if rows > 0 {
+		sub = rows
+	}
+	opts := &ccitt.Options{Align: align, Invert: blackIs1}
+	raw, err := io.ReadAll(ccitt.NewReader(bytes.NewReader(data), ccitt.MSB, mode, columns, sub, opts))
+	if err != nil && len(raw) == 0 {
+		return nil, err
+	}
+	rowLen := (columns + 7) / 8
+	h := len(raw) / rowLen
+	m := image.NewGray(image.Rect(0, 0, columns, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < columns; x++ {
+			// the decoder yields 1 for white
+			if raw[y*rowLen+x/8]&(0x80>>uint(x%8)) != 0 {
+				m.Pix[y*m.Stride+x] = 0xff
+			}
+		}
+	}
+	return m, nil
+}
+
+// samples unpacks the components of an image row by row, scaled to 0 - 1
+// by the Decode array
+func imageSamples(data []byte, w, h, n, bpc int, decode []float64) []float64 {
+	out := make([]float64, w*h*n)
+	rowLen := (w*n*bpc + 7) / 8
+	maxVal := float64(int(1)<<uint(bpc) - 1)
+	for y := 0; y < h; y++ {
+		if (y+1)*rowLen > len(data) {
+			break
+		}
+		row := data[y*rowLen:]
+		for j := 0; j < w*n; j++ {
+			var v int
+			switch bpc {
+			case 8:
+				v = int(row[j])
+			case 16:
+				v = int(row[2*j])<<8 | int(row[2*j+1])
+			default:
+				bit := j * bpc
+				v = int(row[bit/8]>>uint(8-bpc-bit%8)) & (1<<uint(bpc) - 1)
+			}
+			k := j % n
+			lo, hi := decode[2*k], decode[2*k+1]
+			out[y*w*n+j] = lo + float64(v)/maxVal*(hi-lo)
+		}
+	}
+	return out
+}
+
+func (p *pageRasterizer) numbers(obj interface{}) []float64 {
+	arr, _ := p.r.resolve(obj).(pdfArray)
+	list := make([]float64, len(arr))
+	for j, v := range arr {
+		list[j] = pdfNumber(p.r.resolve(v))
+	}
+	return list
+}
+
+// imageOf converts an image XObject into an image with alpha; stencil masks
+// are painted with the current fill color
+func (p *pageRasterizer) imageOf(stm *pdfStream) (*image.NRGBA, error) {
+	w, _ := p.r.resolve(stm.dict["Width"]).(int)
+	h, _ := p.r.resolve(stm.dict["Height"]).(int)
+	if w <= 0 || h <= 0 || w*h > 1<<26 {
+		return nil, errRasterUnsupported
+	}
+	data, decoded, err := p.imageData(stm)
+	if err != nil {
+		return nil, err
+	}
+	bpc, _ := p.r.resolve(stm.dict["BitsPerComponent"]).(int)
+	mask, _ := p.r.resolve(stm.dict["ImageMask"]).(bool)
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	if mask {
+		decode := p.numbers(stm.dict["Decode"])
+		if len(decode) != 2 {
+			decode = []float64{0, 1}
+		}
+		var vals []float64
+		if decoded != nil {
+			vals = grayValues(decoded, w, h)
+		} else {
+			vals = imageSamples(data, w, h, 1, 1, decode)
+		}
+		fill := p.deviceColor(p.st.fill, 1).(color.NRGBA)
+		for j, v := range vals {
+			// sample value 0 paints
+			if v < 0.5 {
+				out.Pix[4*j], out.Pix[4*j+1], out.Pix[4*j+2], out.Pix[4*j+3] = fill.R, fill.G, fill.B, 0xff
+			}
+		}
+		return out, nil
+	}
+	space := p.colorSpace(stm.dict["ColorSpace"], nil)
+	switch {
+	case decoded != nil:
+		xdraw.Draw(out, out.Bounds(), decoded, decoded.Bounds().Min, xdraw.Src)
+		if space.n == 1 && len(p.numbers(stm.dict["Decode"])) == 2 && p.numbers(stm.dict["Decode"])[0] == 1 {
+			for j := 0; j < len(out.Pix); j += 4 {
+				out.Pix[j], out.Pix[j+1], out.Pix[j+2] = 255-out.Pix[j], 255-out.Pix[j+1], 255-out.Pix[j+2]
+			}
+		}
+	case space.n > 0 && bpc > 0:
+		decode := p.numbers(stm.dict["Decode"])
+		if len(decode) != 2*space.n {
+			decode = space.decode
+			if space.indexed {
+				// the samples are palette indices
+				decode = rasterRawDecode(1, bpc)
+			}
+		}
+		vals := imageSamples(data, w, h, space.n, bpc, decode)
+		cache := make(map[[4]float64]color.NRGBA)
+		for j := 0; j < w*h; j++ {
+			comps := vals[j*space.n : (j+1)*space.n]
+			var key [4]float64
+			copy(key[:], comps)
+			c, ok := cache[key]
+			if !ok {
+				r, g, b := space.rgb(comps)
+				c = color.NRGBA{uint8(clamp01(r)*255 + 0.5), uint8(clamp01(g)*255 + 0.5), uint8(clamp01(b)*255 + 0.5), 0xff}
+				if len(cache) < 4096 {
+					cache[key] = c
+				}
+			}
+			out.Pix[4*j], out.Pix[4*j+1], out.Pix[4*j+2], out.Pix[4*j+3] = c.R, c.G, c.B, 0xff
+		}
+		// color key masking
+		if ranges := p.numbers(stm.dict["Mask"]); len(ranges) == 2*space.n && decoded == nil {
+			raw := imageSamples(data, w, h, space.n, bpc, rasterRawDecode(space.n, bpc))
+			for j := 0; j < w*h; j++ {
+				inside := true
+				for k := 0; k < space.n; k++ {
+					v := raw[j*space.n+k]
+					if v < ranges[2*k] || v > ranges[2*k+1] {
+						inside = false
+						break
+					}
+				}
+				if inside {
+					out.Pix[4*j+3] = 0
+				}
+			}
+		}
+	default:
+		return nil, errRasterUnsupported
+	}
+	if smask, ok := p.r.resolve(stm.dict["SMask"]).(*pdfStream); ok {
+		p.applySoftMask(out, smask)
+	}
+	return out, nil
+}
+
+func rasterRawDecode(n, bpc int) []float64 {
+	d := make([]float64, 2*n)
+	for k := 0; k < n; k++ {
+		d[2*k+1] = float64(int(1)<<uint(bpc) - 1)
+	}
+	return d
+}
+
+func grayValues(m image.Image, w, h int) []float64 {
+	vals := make([]float64, w*h)
+	b := m.Bounds()
+	for y := 0; y < h && y < b.Dy(); y++ {
+		for x := 0; x < w && x < b.Dx(); x++ {
+			g := color.GrayModel.Convert(m.At(b.Min.X+x, b.Min.Y+y)).(color.Gray)
+			vals[y*w+x] = float64(g.Y) / 255
+		}
+	}
+	return vals
+}
+
+// applySoftMask multiplies the alpha of the image by the gray levels of the
+// soft mask image, scaled to the image size
+func (p *pageRasterizer) applySoftMask(out *image.NRGBA, smask *pdfStream) {
+	w, _ := p.r.resolve(smask.dict["Width"]).(int)
+	h, _ := p.r.resolve(smask.dict["Height"]).(int)
+	if w <= 0 || h <= 0 || w*h > 1<<26 {
+		return
+	}
+	data, decoded, err := p.imageData(smask)
+	if err != nil {
+		return
+	}
+	var vals []float64
+	if decoded != nil {
+		vals = grayValues(decoded, w, h)
+	} else {
+		bpc, _ := p.r.resolve(smask.dict["BitsPerComponent"]).(int)
+		if bpc <= 0 {
+			return
+		}
+		decode := p.numbers(smask.dict["Decode"])
+		if len(decode) != 2 {
+			decode = []float64{0, 1}
+		}
+		vals = imageSamples(data, w, h, 1, bpc, decode)
+	}
+	b := out.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		sy := y * h / b.Dy()
+		for x := 0; x < b.Dx(); x++ {
+			sx := x * w / b.Dx()
+			i := y*out.Stride + 4*x + 3
+			out.Pix[i] = uint8(float64(out.Pix[i]) * clamp01(vals[sy*w+sx]))
+		}
+	}
+}
+
+// image draws an image XObject into the unit square of user space
+func (p *pageRasterizer) image(stm *pdfStream) {
+	m, err := p.imageOf(stm)
+	if err != nil {
+		return
+	}
+	b := m.Bounds()
+	// image space to user space, then to device space
+	tr := rasterMul(d2d.Matrix{1 / float64(b.Dx()), 0, 0, -1 / float64(b.Dy()), 0, 1}, p.st.ctm)
+	if tr.Determinant() == 0 {
+		return
+	}
+	opts := &xdraw.Options{}
+	if p.st.clip != nil {
+		opts.DstMask = p.st.clip
+	}
+	if p.st.fillAlpha < 1 {
+		opts.SrcMask = image.NewUniform(color.Alpha{uint8(clamp01(p.st.fillAlpha) * 255)})
+	}
+	aff := f64.Aff3{tr[0], tr[2], tr[4], tr[1], tr[3], tr[5]}
+	var interp xdraw.Transformer = xdraw.BiLinear
+	if interpolate, _ := p.r.resolve(stm.dict["Interpolate"]).(bool); !interpolate {
+		// enlarged images keep sharp pixel edges as in most viewers
+		if sx, sy := tr.GetScaling(); math.Abs(sx) >= 2 && math.Abs(sy) >= 2 {
+			interp = xdraw.NearestNeighbor
+		}
+	}
+	interp.Transform(p.dst, aff, m, b, xdraw.Over, opts)
+}
@@ -0,0 +1,1071 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Text drawn with a UTF-8 font is shaped when it contains characters of a
+// script that needs contextual glyph selection or positioning, or when it
+// has to be laid out right to left. Lines are first split into runs by the
+// Unicode Bidirectional Algorithm and by script. Runs of complex scripts
+// are passed through the OpenType GSUB and GPOS lookups of the font, other
+// runs are mapped character by character as before. Glyphs that have no
+// code point of their own (contextual forms, conjuncts, ligatures) are
+// given CIDs from the Private Use Area, and the ToUnicode map of the font
+// maps them back to the text they were produced from.
+
+// shapingScript describes how runs of a script are shaped.
+type shapingScript struct {
+	tags   []string // OpenType script tags, most preferred first
+	arabic bool     // cursive joining
+	indic  *indicScript
+}
+
+// indicScript holds the script specific data of the Indic shaper. The
+// Unicode blocks of the Indic scripts share the ISCII layout, so
+// characters are classified by their offset in the block.
+type indicScript struct {
+	block   rune
+	reph    bool
+	preBase []rune // offsets of the pre-base matras
+}
+
+var (
+	shapingArabic = &shapingScript{tags: []string{"arab"}, arabic: true}
+	shapingNKo    = &shapingScript{tags: []string{"nko "}, arabic: true}
+	shapingHebrew = &shapingScript{tags: []string{"hebr"}}
+	shapingSyriac = &shapingScript{tags: []string{"syrc"}}
+	shapingThaana = &shapingScript{tags: []string{"thaa"}}
+	shapingThai   = &shapingScript{tags: []string{"thai"}}
+	shapingLao    = &shapingScript{tags: []string{"lao "}}
+)
+
+func newIndicScript(tags []string, block rune, reph bool, preBase ...rune) *shapingScript {
+	return &shapingScript{tags: tags, indic: &indicScript{block: block, reph: reph, preBase: preBase}}
+}
+
+var shapingRanges = []struct {
+	lo, hi rune
+	script *shapingScript
+}{
+	{0x0590, 0x05FF, shapingHebrew},
+	{0x0600, 0x06FF, shapingArabic},
+	{0x0700, 0x074F, shapingSyriac},
+	{0x0750, 0x077F, shapingArabic},
+	{0x0780, 0x07BF, shapingThaana},
+	{0x07C0, 0x07FF, shapingNKo},
+	{0x08A0, 0x08FF, shapingArabic},
+	{0x0900, 0x097F, newIndicScript([]string{"dev2", "deva"}, 0x0900, true, 0x3F, 0x4E)},
+	{0x0980, 0x09FF, newIndicScript([]string{"bng2", "beng"}, 0x0980, true, 0x3F, 0x47, 0x48)},
+	{0x0A00, 0x0A7F, newIndicScript([]string{"gur2", "guru"}, 0x0A00, false, 0x3F)},
+	{0x0A80, 0x0AFF, newIndicScript([]string{"gjr2", "gujr"}, 0x0A80, true, 0x3F)},
+	{0x0B00, 0x0B7F, newIndicScript([]string{"ory2", "orya"}, 0x0B00, true, 0x47)},
+	{0x0B80, 0x0BFF, newIndicScript([]string{"tml2", "taml"}, 0x0B80, false, 0x46, 0x47, 0x48)},
+	{0x0C00, 0x0C7F, newIndicScript([]string{"tel2", "telu"}, 0x0C00, false)},
+	{0x0C80, 0x0CFF, newIndicScript([]string{"knd2", "knda"}, 0x0C80, true)},
+	{0x0D00, 0x0D7F, newIndicScript([]string{"mlm2", "mlym"}, 0x0D00, false, 0x46, 0x47, 0x48)},
+	{0x0E00, 0x0E7F, shapingThai},
+	{0x0E80, 0x0EFF, shapingLao},
+	{0xFB1D, 0xFB4F, shapingHebrew},
+	{0xFB50, 0xFDFF, shapingArabic},
+	{0xFE70, 0xFEFF, shapingArabic},
+}
+
+// shapingScriptOf returns the complex script r belongs to, or nil.
+func shapingScriptOf(r rune) *shapingScript {
+	if r < 0x0590 {
+		return nil
+	}
+	i := sort.Search(len(shapingRanges), func(i int) bool { return shapingRanges[i].hi >= r })
+	if i < len(shapingRanges) && r >= shapingRanges[i].lo {
+		return shapingRanges[i].script
+	}
+	return nil
+}
+
+// needsShaping reports whether txtStr contains characters that have to go
+// through shaping or bidirectional reordering.
+func needsShaping(txtStr string) bool {
+	for _, r := range txtStr {
+		if r < 0x0590 {
+			continue
+		}
+		if shapingScriptOf(r) != nil || (r >= 0x200E && r <= 0x200F) ||
+			(r >= 0x202A && r <= 0x202E) || (r >= 0x2066 && r <= 0x2069) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDefaultIgnorable reports whether r is an invisible formatting character
+// that is dropped from shaped output.
+func isDefaultIgnorable(r rune) bool {
+	switch {
+	case r == 0x00AD, r == 0x034F, r == 0x061C, r == 0xFEFF:
+		return true
+	case r >= 0x200B && r <= 0x200F, r >= 0x202A && r <= 0x202E, r >= 0x2060 && r <= 0x206F:
+		return true
+	}
+	return false
+}
+
+// shapedGlyph is a glyph of shaped text. Advances and offsets are expressed
+// in thousandths of the font size.
+type shapedGlyph struct {
+	cid   int
+	width int // width of the CID in the font's W array
+	adv   float64
+	dx    float64
+	dy    float64
+	space bool
+}
+
+type shapeCacheType struct {
+	key    string
+	glyphs []shapedGlyph
+}
+
+type shapingRun struct {
+	start, end int
+	level      int8
+	script     *shapingScript
+}
+
+// SetTextShaping enables or disables shaping and bidirectional reordering
+// of text drawn with UTF-8 fonts. Shaping is enabled by default. When it is
+// disabled, right-to-left mode simply reverses the characters of each cell
+// as in earlier versions.
+func (f *Bdf) SetTextShaping(enabled bool) {
+	f.noShaping = !enabled
+}
+
+// shapedText returns the glyphs of txtStr in visual order when it is drawn
+// with the current font and needs shaping, or nil otherwise.
+func (f *Bdf) shapedText(txtStr string) []shapedGlyph {
+	if !f.isCurrentUTF8 || f.noShaping || f.currentFont.utf8File == nil || txtStr == "" ||
+		!(f.isRTL || needsShaping(txtStr)) {
+		return nil
+	}
+	key := f.currentFont.i + "\x00" + strconv.FormatBool(f.isRTL) + "\x00" + txtStr
+	if f.shapeCache.key == key {
+		return f.shapeCache.glyphs
+	}
+	runes := []rune(txtStr)
+	levels, _ := bidiLevels(runes, f.isRTL)
+
+	// split the text into runs of a single level and script
+	var runs []shapingRun
+	var prev *shapingScript
+	for i, r := range runes {
+		script := shapingScriptOf(r)
+		if script == nil && !unicode.IsLetter(r) && i > 0 && levels[i] == levels[i-1] {
+			script = prev
+		}
+		if n := len(runs); n > 0 && runs[n-1].level == levels[i] && runs[n-1].script == script {
+			runs[n-1].end = i + 1
+		} else {
+			runs = append(runs, shapingRun{start: i, end: i + 1, level: levels[i], script: script})
+		}
+		prev = script
+	}
+	runLevels := make([]int8, len(runs))
+	for i, run := range runs {
+		runLevels[i] = run.level
+	}
+	var glyphs []shapedGlyph
+	for _, i := range bidiReorder(runLevels) {
+		run := runs[i]
+		var g []shapedGlyph
+		if run.script != nil {
+			g = f.shapeRun(runes, run)
+		} else {
+			g = f.mapRun(runes, run)
+		}
+		if run.level&1 == 1 {
+			for a, b := 0, len(g)-1; a < b; a, b = a+1, b-1 {
+				g[a], g[b] = g[b], g[a]
+			}
+		}
+		glyphs = append(glyphs, g...)
+	}
+	if glyphs == nil {
+		glyphs = []shapedGlyph{}
+	}
+	f.shapeCache.key = key
+	f.shapeCache.glyphs = glyphs
+	return glyphs
+}
+
+// runeWidth returns the width of r in the current UTF-8 font.
+func (f *Bdf) runeWidth(r rune) int {
+	cw := f.currentFont.Cw
+	switch {
+	case int(r) < len(cw) && cw[r] == 65535:
+		return 0
+	case int(r) < len(cw) && cw[r] > 0:
+		return cw[r]
+	case f.currentFont.Desc.MissingWidth != 0:
+		return f.currentFont.Desc.MissingWidth
+	}
+	return 500
+}
+
+// mapRun maps the characters of a run that needs no shaping to glyphs.
+func (f *Bdf) mapRun(runes []rune, run shapingRun) []shapedGlyph {
+	glyphs := make([]shapedGlyph, 0, run.end-run.start)
+	for _, r := range runes[run.start:run.end] {
+		if isDefaultIgnorable(r) {
+			continue
+		}
+		if run.level&1 == 1 {
+			r = bidiMirror(r)
+		}
+		if r > 0xFFFF {
+			r = 0
+		}
+		f.currentFont.usedRunes[int(r)] = int(r)
+		w := f.runeWidth(r)
+		glyphs = append(glyphs, shapedGlyph{cid: int(r), width: w, adv: float64(w), space: r == ' '})
+	}
+	return glyphs
+}
+
+// otShaper applies the features of one script of a font.
+type otShaper struct {
+	t          *otLayout
+	gsubScript int
+	gposScript int
+	bits       map[string]uint32
+}
+
+func newOTShaper(t *otLayout, tags []string, manual ...string) *otShaper {
+	s := &otShaper{t: t, bits: make(map[string]uint32)}
+	s.gsubScript = t.script(t.gsub, tags...)
+	s.gposScript = t.script(t.gpos, tags...)
+	for i, tag := range manual {
+		s.bits[tag] = 2 << uint(i)
+	}
+	return s
+}
+
+// bit returns the glyph mask bit of feature tag. Features that are applied
+// to every glyph share bit 1.
+func (s *otShaper) bit(tag string) uint32 {
+	if b, ok := s.bits[tag]; ok {
+		return b
+	}
+	return 1
+}
+
+// stage applies the lookups of the given GSUB or GPOS features to b in
+// lookup order.
+func (s *otShaper) stage(b *otBuffer, gpos bool, tags ...string) {
+	table, script := s.t.gsub, s.gsubScript
+	if gpos {
+		table, script = s.t.gpos, s.gposScript
+	}
+	if script == 0 {
+		return
+	}
+	masks := make(map[int]uint32)
+	for _, tag := range tags {
+		for _, idx := range s.t.featureLookups(table, script, tag) {
+			masks[idx] |= s.bit(tag)
+		}
+	}
+	indexes := make([]int, 0, len(masks))
+	for idx := range masks {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	for _, idx := range indexes {
+		l := *s.t.lookup(gpos, idx)
+		l.mask = masks[idx]
+		b.apply(&l)
+	}
+}
+
+// wouldSubstitute reports whether the GSUB feature tag changes the glyph
+// sequence gids.
+func (s *otShaper) wouldSubstitute(tag string, gids ...int) bool {
+	key := sprintf("%d %s %v", s.gsubScript, tag, gids)
+	if v, ok := s.t.substitutes[key]; ok {
+		return v
+	}
+	b := &otBuffer{t: s.t}
+	for _, gid := range gids {
+		if gid == 0 {
+			return false
+		}
+		b.g = append(b.g, otGlyph{gid: gid, mask: ^uint32(0), class: s.t.glyphClass(gid)})
+	}
+	s.stage(b, false, tag)
+	changed := len(b.g) != len(gids)
+	for i := 0; i < len(b.g) && !changed; i++ {
+		changed = b.g[i].gid != gids[i]
+	}
+	s.t.substitutes[key] = changed
+	return changed
+}
+
+// shapeRun shapes a run of a complex script with the OpenType tables of the
+// current font.
+func (f *Bdf) shapeRun(runes []rune, run shapingRun) []shapedGlyph {
+	utf := f.currentFont.utf8File
+	t := utf.layout()
+	if t == nil {
+		return f.mapRun(runes, run)
+	}
+	b := &otBuffer{t: t, rtl: run.level&1 == 1}
+	for k := run.start; k < run.end; k++ {
+		r := runes[k]
+		if b.rtl {
+			r = bidiMirror(r)
+		}
+		parts := []rune{r}
+		if run.script.indic != nil && indicCategory(run.script.indic, r) == indicMatra {
+			if d := []rune(norm.NFD.String(string(r))); len(d) > 1 {
+				parts = d
+				for _, p := range d {
+					if t.cmap[int(p)] == 0 {
+						parts = []rune{r}
+						break
+					}
+				}
+			}
+		}
+		for _, p := range parts {
+			gid := t.cmap[int(p)]
+			g := otGlyph{gid: gid, cluster: k, mask: 1, class: t.glyphClass(gid)}
+			if t.glyphClassDef == 0 && unicode.In(p, unicode.Mn, unicode.Me) {
+				g.class = otlClassMark
+			}
+			if run.script.indic != nil {
+				g.cat = indicCategory(run.script.indic, p)
+			}
+			b.g = append(b.g, g)
+		}
+	}
+
+	switch {
+	case run.script.arabic:
+		s := newOTShaper(t, run.script.tags, "isol", "fina", "medi", "init")
+		s.arabicForms(b, runes)
+		s.stage(b, false, "ccmp", "locl")
+		for _, tag := range []string{"isol", "fina", "medi", "init", "rlig"} {
+			s.stage(b, false, tag)
+		}
+		s.stage(b, false, "calt", "rclt", "liga", "clig", "mset")
+		s.position(b, true, "curs", "kern", "mark", "mkmk")
+	case run.script.indic != nil:
+		s := newOTShaper(t, run.script.tags, "rphf", "half", "pref", "blwf", "abvf", "pstf")
+		s.indic(b, run.script.indic)
+		s.position(b, false, "dist", "kern", "abvm", "blwm", "mark", "mkmk")
+	default:
+		s := newOTShaper(t, run.script.tags)
+		s.stage(b, false, "ccmp", "locl")
+		s.stage(b, false, "rlig")
+		s.stage(b, false, "calt", "rclt", "liga", "clig")
+		s.position(b, true, "curs", "kern", "mark", "mkmk")
+	}
+
+	// clusters delimit the text each glyph stands for in the ToUnicode map
+	var clusters []int
+	for _, g := range b.g {
+		clusters = append(clusters, g.cluster)
+	}
+	sort.Ints(clusters)
+	clusterEnd := func(c int) int {
+		i := sort.SearchInts(clusters, c+1)
+		if i < len(clusters) && clusters[i] < run.end {
+			return clusters[i]
+		}
+		return run.end
+	}
+	scale := 1000 / float64(t.unitsPerEm)
+	glyphs := make([]shapedGlyph, 0, len(b.g))
+	for _, g := range b.g {
+		r := runes[g.cluster]
+		if isDefaultIgnorable(r) && !g.ligated {
+			continue
+		}
+		cid := utf.glyphCID(g.gid, string(runes[g.cluster:clusterEnd(g.cluster)]), f.currentFont.Cw, f.currentFont.usedRunes)
+		w := 0
+		if cid < len(f.currentFont.Cw) {
+			w = f.currentFont.Cw[cid]
+			if w == 65535 {
+				w = 0
+			} else if w == 0 {
+				w = f.currentFont.Desc.MissingWidth
+			}
+		}
+		glyphs = append(glyphs, shapedGlyph{
+			cid:   cid,
+			width: w,
+			adv:   float64(g.xAdv) * scale,
+			dx:    float64(g.xOff) * scale,
+			dy:    float64(g.yOff) * scale,
+			space: r == ' ' && g.gid == t.cmap[' '],
+		})
+	}
+	return glyphs
+}
+
+// position sets the default advances of the glyphs of b and applies the
+// GPOS features. When zeroMarks is set, marks lose their advance as they
+// are expected to be positioned by the font.
+func (s *otShaper) position(b *otBuffer, zeroMarks bool, tags ...string) {
+	for i := range b.g {
+		b.g[i].xAdv = s.t.advance(b.g[i].gid)
+		b.g[i].attach = -1
+	}
+	s.stage(b, true, tags...)
+	if zeroMarks {
+		for i := range b.g {
+			if g := &b.g[i]; g.class == otlClassMark {
+				if !b.rtl {
+					g.xOff -= g.xAdv
+				}
+				g.xAdv = 0
+			}
+		}
+	}
+	b.resolveAttachments()
+}
+
+// Arabic joining types
+const (
+	joinU = iota // non-joining
+	joinR        // right-joining
+	joinD        // dual-joining
+	joinC        // join-causing
+	joinT        // transparent
+)
+
+var arabicJoiningRanges = []struct {
+	lo, hi rune
+	join   int
+}{
+	{0x0620, 0x0620, joinD}, {0x0622, 0x0625, joinR}, {0x0626, 0x0626, joinD},
+	{0x0627, 0x0627, joinR}, {0x0628, 0x0628, joinD}, {0x0629, 0x0629, joinR},
+	{0x062A, 0x062E, joinD}, {0x062F, 0x0632, joinR}, {0x0633, 0x063F, joinD},
+	{0x0641, 0x0647, joinD}, {0x0648, 0x0648, joinR}, {0x0649, 0x064A, joinD},
+	{0x066E, 0x066F, joinD}, {0x0671, 0x0673, joinR}, {0x0675, 0x0677, joinR},
+	{0x0678, 0x0687, joinD}, {0x0688, 0x0699, joinR}, {0x069A, 0x06BF, joinD},
+	{0x06C0, 0x06C0, joinR}, {0x06C1, 0x06C2, joinD}, {0x06C3, 0x06CB, joinR},
+	{0x06CC, 0x06CC, joinD}, {0x06CD, 0x06CD, joinR}, {0x06CE, 0x06CE, joinD},
+	{0x06CF, 0x06CF, joinR}, {0x06D0, 0x06D1, joinD}, {0x06D2, 0x06D3, joinR},
+	{0x06D5, 0x06D5, joinR}, {0x06EE, 0x06EF, joinR}, {0x06FA, 0x06FC, joinD},
+	{0x06FF, 0x06FF, joinD}, {0x0750, 0x0758, joinD}, {0x0759, 0x075B, joinR},
+	{0x075C, 0x076A, joinD}, {0x076B, 0x076C, joinR}, {0x076D, 0x0770, joinD},
+	{0x0771, 0x0771, joinR}, {0x0772, 0x0772, joinD}, {0x0773, 0x0774, joinR},
+	{0x0775, 0x0777, joinD}, {0x0778, 0x0779, joinR}, {0x077A, 0x077F, joinD},
+	{0x07CA, 0x07EA, joinD}, {0x08A0, 0x08A9, joinD}, {0x08AA, 0x08AC, joinR},
+	{0x08AE, 0x08AE, joinR}, {0x08AF, 0x08B0, joinD}, {0x08B1, 0x08B2, joinR},
+	{0x08B3, 0x08B4, joinD}, {0x08B6, 0x08B8, joinD}, {0x08B9, 0x08B9, joinR},
+	{0x08BA, 0x08C7, joinD},
+}
+
+// arabicJoining returns the joining type of r.
+func arabicJoining(r rune) int {
+	switch {
+	case r == 0x0640 || r == 0x07FA || r == 0x200D:
+		return joinC
+	case r == 0x200C:
+		return joinU
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return joinT
+	}
+	i := sort.Search(len(arabicJoiningRanges), func(i int) bool { return arabicJoiningRanges[i].hi >= r })
+	if i < len(arabicJoiningRanges) && r >= arabicJoiningRanges[i].lo {
+		return arabicJoiningRanges[i].join
+	}
+	return joinU
+}
+
+// arabicForms runs the joining analysis over b and sets the isol, fina,
+// medi and init masks of its glyphs.
+func (s *otShaper) arabicForms(b *otBuffer, runes []rune) {
+	forms := make([]string, len(b.g))
+	prev, prevJoin := -1, joinU
+	for i, g := range b.g {
+		join := arabicJoining(runes[g.cluster])
+		if join == joinT {
+			continue
+		}
+		if prev >= 0 && (prevJoin == joinD || prevJoin == joinC) &&
+			(join == joinR || join == joinD || join == joinC) {
+			switch forms[prev] {
+			case "isol":
+				forms[prev] = "init"
+			case "fina":
+				forms[prev] = "medi"
+			}
+			forms[i] = "fina"
+		} else {
+			forms[i] = "isol"
+		}
+		prev, prevJoin = i, join
+	}
+	for i, form := range forms {
+		if form != "" {
+			b.g[i].mask |= s.bit(form)
+		}
+	}
+}
+
+// Indic character categories
+const (
+	indicOther = iota
+	indicConsonant
+	indicRa
+	indicVowel
+	indicMatra
+	indicPreMatra
+	indicNukta
+	indicHalant
+	indicModifier
+	indicZWJ
+	indicZWNJ
+	indicPlaceholder
+)
+
+// Indic glyph flags
+const (
+	indicFlagReph = 1 << iota
+	indicFlagBase
+	indicFlagPreBase
+	indicFlagPostBase
+)
+
+// indicCategory classifies r for the Indic shaper of script s.
+func indicCategory(s *indicScript, r rune) int {
+	switch r {
+	case 0x200C:
+		return indicZWNJ
+	case 0x200D:
+		return indicZWJ
+	case 0x00A0, 0x25CC:
+		return indicPlaceholder
+	}
+	if r < s.block || r >= s.block+0x80 {
+		return indicOther
+	}
+	off := r - s.block
+	for _, p := range s.preBase {
+		if off == p {
+			return indicPreMatra
+		}
+	}
+	switch {
+	case off <= 0x03:
+		return indicModifier
+	case off <= 0x14:
+		return indicVowel
+	case off == 0x30:
+		if s.reph {
+			return indicRa
+		}
+		return indicConsonant
+	case off <= 0x39:
+		return indicConsonant
+	case off <= 0x3B:
+		return indicMatra
+	case off == 0x3C:
+		return indicNukta
+	case off == 0x3D:
+		return indicOther
+	case off <= 0x4C:
+		return indicMatra
+	case off == 0x4D:
+		return indicHalant
+	case off <= 0x4F:
+		return indicMatra
+	case off == 0x50:
+		return indicOther
+	case off <= 0x54:
+		return indicModifier
+	case off <= 0x57:
+		return indicMatra
+	case off <= 0x5F:
+		return indicConsonant
+	case off <= 0x61:
+		return indicVowel
+	case off <= 0x63:
+		return indicMatra
+	}
+	switch s.block {
+	case 0x0900:
+		switch {
+		case off >= 0x72 && off <= 0x77:
+			return indicVowel
+		case off >= 0x78:
+			return indicConsonant
+		}
+	case 0x0980:
+		if off == 0x70 {
+			return indicRa
+		}
+		if off == 0x71 {
+			return indicConsonant
+		}
+	case 0x0A00:
+		if off == 0x70 || off == 0x71 {
+			return indicModifier
+		}
+		if off == 0x75 {
+			return indicMatra
+		}
+	}
+	return indicOther
+}
+
+func indicIsConsonant(cat int) bool {
+	return cat == indicConsonant || cat == indicRa || cat == indicPlaceholder
+}
+
+// indicSyllables numbers the syllables of b and returns their bounds.
+// Dependent signs that do not follow a base get a dotted circle as base
+// when the font has one.
+func (s *otShaper) indicSyllables(b *otBuffer) [][2]int {
+	var bounds [][2]int
+	n := len(b.g)
+	dependent := func(cat int) bool {
+		switch cat {
+		case indicMatra, indicPreMatra, indicNukta, indicModifier, indicZWJ, indicZWNJ, indicHalant:
+			return true
+		}
+		return false
+	}
+	for i := 0; i < n; {
+		start := i
+		cat := b.g[i].cat
+		switch {
+		case indicIsConsonant(cat) || cat == indicVowel:
+			i++
+			for {
+				for i < n && b.g[i].cat == indicNukta {
+					i++
+				}
+				if i >= n || b.g[i].cat != indicHalant {
+					break
+				}
+				j := i + 1
+				for j < n && (b.g[j].cat == indicZWJ || b.g[j].cat == indicZWNJ) {
+					j++
+				}
+				if j < n && indicIsConsonant(b.g[j].cat) {
+					i = j + 1
+					continue
+				}
+				i = j
+				break
+			}
+			for i < n && dependent(b.g[i].cat) {
+				i++
+			}
+		case dependent(cat) && cat != indicZWJ && cat != indicZWNJ:
+			if gid := s.t.cmap[0x25CC]; gid != 0 {
+				circle := b.g[i]
+				circle.gid = gid
+				circle.cat = indicPlaceholder
+				circle.class = s.t.glyphClass(gid)
+				if s.t.glyphClassDef == 0 {
+					circle.class = otlClassBase
+				}
+				b.g = append(b.g[:i], append([]otGlyph{circle}, b.g[i:]...)...)
+				n++
+				continue
+			}
+			for i++; i < n && dependent(b.g[i].cat); i++ {
+			}
+		default:
+			i++
+		}
+		for k := start; k < i; k++ {
+			b.g[k].syllable = len(bounds)
+		}
+		bounds = append(bounds, [2]int{start, i})
+	}
+	return bounds
+}
+
+// indic shapes b with the Indic shaper: it finds the base consonant of
+// every syllable, reorders reph and pre-base matras, and applies the basic
+// and presentation features around a final reordering step.
+func (s *otShaper) indic(b *otBuffer, script *indicScript) {
+	s.stage(b, false, "locl", "ccmp")
+	for _, bounds := range s.indicSyllables(b) {
+		start, end := bounds[0], bounds[1]
+		if !indicIsConsonant(b.g[start].cat) {
+			continue
+		}
+		// reph
+		limit := start
+		if b.g[start].cat == indicRa && end-start >= 3 && b.g[start+1].cat == indicHalant &&
+			b.g[start+2].cat != indicZWJ && s.wouldSubstitute("rphf", b.g[start].gid, b.g[start+1].gid) {
+			for k := start + 2; k < end; k++ {
+				if indicIsConsonant(b.g[k].cat) {
+					limit = start + 2
+					break
+				}
+			}
+		}
+		// base consonant: the last one that does not take a below-base or
+		// post-base form
+		base := -1
+		var swap []int
+		for j := end - 1; j >= limit; j-- {
+			if !indicIsConsonant(b.g[j].cat) {
+				continue
+			}
+			if j-1 > limit && b.g[j-1].cat == indicHalant {
+				if form, oldSpec := s.indicBelowOrPost(b.g[j-1].gid, b.g[j].gid); form {
+					if oldSpec {
+						swap = append(swap, j)
+					}
+					continue
+				}
+			}
+			base = j
+			break
+		}
+		if base < 0 {
+			base = limit
+			swap = nil
+		}
+		// fonts built for the old Indic specification expect the halant
+		// after a below-base or post-base consonant
+		for _, j := range swap {
+			if j > base+1 {
+				b.g[j-1], b.g[j] = b.g[j], b.g[j-1]
+			}
+		}
+		if limit > start {
+			b.g[start].flags |= indicFlagReph
+			b.g[start+1].flags |= indicFlagReph
+			b.g[start].mask |= s.bit("rphf")
+			b.g[start+1].mask |= s.bit("rphf")
+		}
+		for k := limit; k < end; k++ {
+			switch {
+			case k < base:
+				b.g[k].flags |= indicFlagPreBase
+				b.g[k].mask |= s.bit("half")
+			case k == base:
+				b.g[k].flags |= indicFlagBase
+			default:
+				b.g[k].flags |= indicFlagPostBase
+				b.g[k].mask |= s.bit("pref") | s.bit("blwf") | s.bit("abvf") | s.bit("pstf")
+			}
+			if b.g[k].cat == indicZWNJ && k-2 >= limit && b.g[k-1].cat == indicHalant {
+				b.g[k-1].mask &^= s.bit("half")
+				b.g[k-2].mask &^= s.bit("half")
+			}
+		}
+		// pre-base matras move in front of the consonants
+		var matras []otGlyph
+		rest := b.g[limit:limit]
+		for k := limit; k < end; k++ {
+			if b.g[k].cat == indicPreMatra && k > base {
+				matras = append(matras, b.g[k])
+			} else {
+				rest = append(rest, b.g[k])
+			}
+		}
+		if len(matras) > 0 {
+			copy(b.g[limit+len(matras):end], rest)
+			copy(b.g[limit:], matras)
+		}
+	}
+	for _, tag := range []string{"nukt", "akhn", "rphf", "rkrf", "pref", "blwf", "abvf", "half", "pstf", "vatu", "cjct"} {
+		s.stage(b, false, tag)
+	}
+	s.indicFinalReorder(b)
+	s.stage(b, false, "init", "pres", "abvs", "blws", "psts", "haln", "calt", "clig", "liga", "rclt")
+}
+
+// indicBelowOrPost reports whether the halant and consonant glyphs form a
+// below-base or post-base consonant in the font, and whether the font
+// expects them in the consonant, halant order of the old specification.
+func (s *otShaper) indicBelowOrPost(halant, consonant int) (form, oldSpec bool) {
+	for _, tag := range []string{"blwf", "pstf", "pref"} {
+		if s.wouldSubstitute(tag, halant, consonant) {
+			return true, false
+		}
+		if s.wouldSubstitute(tag, consonant, halant) {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// indicFinalReorder moves reph glyphs after the base and pre-base matras
+// after the last halant that did not form a half form.
+func (s *otShaper) indicFinalReorder(b *otBuffer) {
+	for start := 0; start < len(b.g); {
+		end := start + 1
+		for end < len(b.g) && b.g[end].syllable == b.g[start].syllable {
+			end++
+		}
+		base := -1
+		for k := start; k < end; k++ {
+			if b.g[k].flags&indicFlagBase != 0 {
+				base = k
+				break
+			}
+		}
+		if base >= 0 {
+			// pre-base matra
+			for k := start; k < base; k++ {
+				if b.g[k].cat != indicPreMatra {
+					continue
+				}
+				to := -1
+				for h := k + 1; h < base; h++ {
+					if b.g[h].cat == indicHalant && !b.g[h].ligated {
+						to = h
+					}
+				}
+				if to > k {
+					m := b.g[k]
+					copy(b.g[k:to], b.g[k+1:to+1])
+					b.g[to] = m
+				}
+				break
+			}
+			// reph
+			if g := b.g[start]; g.flags&indicFlagReph != 0 && g.ligated && start < base {
+				to := end - 1
+				for to > base && b.g[to].cat == indicModifier {
+					to--
+				}
+				copy(b.g[start:to], b.g[start+1:to+1])
+				b.g[to] = g
+			}
+		}
+		start = end
+	}
+}
+
+// layout returns the OpenType layout tables of the font, or nil when the
+// font has neither GSUB nor GPOS.
+func (utf *utf8FontFile) layout() *otLayout {
+	if utf.otl != nil || utf.otlMissing {
+		return utf.otl
+	}
+	gsub, okSub := utf.tableDescriptions["GSUB"]
+	gpos, okPos := utf.tableDescriptions["GPOS"]
+	hmtx, okHmtx := utf.tableDescriptions["hmtx"]
+	hhea, okHhea := utf.tableDescriptions["hhea"]
+	if (!okSub && !okPos) || !okHmtx || !okHhea || utf.fontElementSize == 0 {
+		utf.otlMissing = true
+		return nil
+	}
+	glyphRunes := utf.generateCMAP()
+	if glyphRunes == nil {
+		utf.otlMissing = true
+		return nil
+	}
+	t := &otLayout{
+		data:        utf.fileReader.array,
+		hmtx:        hmtx.position,
+		unitsPerEm:  utf.fontElementSize,
+		cmap:        utf.charSymbolDictionary,
+		glyphRunes:  glyphRunes,
+		lookups:     make(map[int]*otLookup),
+		features:    make(map[[3]string][]int),
+		substitutes: make(map[string]bool),
+	}
+	t.numHMetrics = t.u16(hhea.position + 34)
+	if okSub {
+		t.gsub = gsub.position
+	}
+	if okPos {
+		t.gpos = gpos.position
+	}
+	if gdef, ok := utf.tableDescriptions["GDEF"]; ok {
+		p := gdef.position
+		t.glyphClassDef = t.offset16(p, p+4)
+		t.markAttachClass = t.offset16(p, p+10)
+		if t.u16(p) == 1 && t.u16(p+2) >= 2 {
+			t.markGlyphSets = t.offset16(p, p+12)
+		}
+	}
+	utf.otl = t
+	utf.glyphCIDs = make(map[int]int)
+	utf.shapedCIDs = make(map[int]int)
+	utf.cidText = make(map[int]string)
+	utf.nextCID = 0xE000
+	return t
+}
+
+// glyphCID returns the CID under which glyph gid is shown. Glyphs reachable
+// through the character map keep the code point as CID; others get one
+// from the Private Use Area that maps back to text in the ToUnicode map.
+func (utf *utf8FontFile) glyphCID(gid int, text string, cw []int, usedRunes map[int]int) int {
+	t := utf.otl
+	cid, ok := utf.glyphCIDs[gid]
+	if !ok {
+		for _, r := range t.glyphRunes[gid] {
+			if r > 0 && r < 0xFFFF && t.cmap[r] == gid {
+				cid = r
+				break
+			}
+		}
+		if cid == 0 && gid != 0 {
+			for utf.nextCID < 0xF900 && cid == 0 {
+				c := utf.nextCID
+				utf.nextCID++
+				if _, mapped := t.cmap[c]; mapped {
+					continue
+				}
+				if _, used := usedRunes[c]; used {
+					continue
+				}
+				cid = c
+			}
+			if cid != 0 {
+				w := int(math.Round(float64(t.advance(gid)) * 1000 / float64(t.unitsPerEm)))
+				if w == 0 {
+					w = 65535
+				}
+				cw[cid] = w
+				utf.shapedCIDs[cid] = gid
+				if text != "" {
+					utf.cidText[cid] = text
+				}
+			}
+		}
+		utf.glyphCIDs[gid] = cid
+	}
+	usedRunes[cid] = cid
+	return cid
+}
+
+// toUnicodeCMap returns the ToUnicode CMap of the font: the identity
+// mapping, completed by the text of the glyphs that were given CIDs in the
+// Private Use Area.
+func (utf *utf8FontFile) toUnicodeCMap() string {
+	if len(utf.shapedCIDs) == 0 {
+		return toUnicode
+	}
+	var chars []string
+	for cid := 0xE000; cid < utf.nextCID; cid++ {
+		if _, shaped := utf.shapedCIDs[cid]; !shaped {
+			chars = append(chars, sprintf("<%04X> <%04X>", cid, cid))
+		} else if text, ok := utf.cidText[cid]; ok {
+			chars = append(chars, sprintf("<%04X> <%X>", cid, []byte(utf8toutf16(text, false))))
+		}
+	}
+	var s strings.Builder
+	head := toUnicode[:strings.Index(toUnicode, "1 beginbfrange")]
+	s.WriteString(head)
+	s.WriteString(sprintf("2 beginbfrange\n<0000> <DFFF> <0000>\n<%04X> <FFFF> <%04X>\nendbfrange\n", utf.nextCID, utf.nextCID))
+	for len(chars) > 0 {
+		n := len(chars)
+		if n > 100 {
+			n = 100
+		}
+		s.WriteString(sprintf("%d beginbfchar\n%s\nendbfchar\n", n, strings.Join(chars[:n], "\n")))
+		chars = chars[n:]
+	}
+	s.WriteString(toUnicode[strings.Index(toUnicode, "endcmap"):])
+	return s.String()
+}
+
+// shapedWidth returns the width of glyphs in thousandths of the font size.
+func shapedWidth(glyphs []shapedGlyph) float64 {
+	w := 0.0
+	for _, g := range glyphs {
+		w += g.adv
+	}
+	return w
+}
+
+// shapedOps returns the text showing operators that draw glyphs from the
+// current text position. wordSpacing, in thousandths of the font size, is
+// added after each space.
+func (f *Bdf) shapedOps(glyphs []shapedGlyph, wordSpacing float64) string {
+	var s fmtBuffer
+	var str []byte
+	open := false
+	rise := 0.0
+	pen, cur := 0.0, 0.0
+	flushStr := func() {
+		if len(str) > 0 {
+			s.printf("(%s)", f.escape(string(str)))
+			str = str[:0]
+		}
+	}
+	closeArray := func() {
+		if open {
+			flushStr()
+			s.printf("] TJ")
+			open = false
+		}
+	}
+	for _, g := range glyphs {
+		if dy := math.Round(g.dy); dy != rise {
+			closeArray()
+			rise = dy
+			s.printf(" %s Ts ", shapedNumber(rise*f.fontSizePt/1000))
+		}
+		if !open {
+			s.printf("[")
+			open = true
+		}
+		if adj := pen + g.dx - cur; math.Abs(adj) >= 0.5 {
+			flushStr()
+			s.printf(" %s ", shapedNumber(-adj))
+			cur += adj
+		}
+		str = append(str, byte(g.cid>>8), byte(g.cid))
+		cur += float64(g.width)
+		pen += g.adv
+		if g.space {
+			pen += wordSpacing
+		}
+	}
+	closeArray()
+	if rise != 0 {
+		s.printf(" 0 Ts")
+	}
+	return strings.TrimSpace(strings.Replace(s.String(), "[ ", "[", -1))
+}
+
+// shapedNumber formats a TJ adjustment or rise with at most two decimals.
+func shapedNumber(v float64) string {
+	str := strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+	if str == "-0" {
+		str = "0"
+	}
+	return str
+}
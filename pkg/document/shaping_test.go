@@ -0,0 +1,214 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// The fonts of the GNU FreeFont family shipped with the repository cover
+// Devanagari (FreeSans) and Arabic (FreeMono)
+const (
+	shapingDevanagariFont = "../g3d/gui/assets/fonts/FreeSans.ttf"
+	shapingArabicFont     = "../g3d/gui/assets/fonts/FreeMono.ttf"
+)
+
+func shapingDoc(t *testing.T, file string) *Bdf {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.AddUTF8FontFromBytes("shaping", "", data)
+	pdf.SetFont("shaping", "", 14)
+	pdf.AddPage()
+	if err := pdf.Error(); err != nil {
+		t.Fatal(err)
+	}
+	return pdf
+}
+
+func shapingCIDs(glyphs []shapedGlyph) []int {
+	cids := make([]int, len(glyphs))
+	for i, g := range glyphs {
+		cids[i] = g.cid
+	}
+	return cids
+}
+
+// bidiVisual returns text in display order without formatting characters.
+func bidiVisual(text string, rtl bool) string {
+	runes := []rune(text)
+	levels, _ := bidiLevels(runes, rtl)
+	var b strings.Builder
+	for _, i := range bidiReorder(levels) {
+		r := runes[i]
+		if isDefaultIgnorable(r) {
+			continue
+		}
+		if levels[i]&1 == 1 {
+			r = bidiMirror(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func TestBidiLevels(t *testing.T) {
+	for _, c := range []struct {
+		text    string
+		rtl     bool
+		visual  string
+		context string
+	}{
+		{"abc def", false, "abc def", "plain"},
+		{"abc אבג def", false, "abc גבא def", "embedded Hebrew"},
+		{"אבג abc!", false, "!abc גבא", "first strong character"},
+		{"abc!", true, "!abc", "right-to-left paragraph"},
+		{"אבג 123", false, "123 גבא", "European digits"},
+		{"بت 12", false, "12 تب", "Arabic letters with digits"},
+		{"אב(גד)", false, "(דג)בא", "mirrored brackets"},
+		{"a\u202bבג\u202cd", false, "aגבd", "explicit embedding"},
+		{"\u202eabc\u202c", false, "cba", "explicit override"},
+		{"abc ", true, " abc", "trailing whitespace"},
+	} {
+		if got := bidiVisual(c.text, c.rtl); got != c.visual {
+			t.Errorf("%s: got %q, expected %q", c.context, got, c.visual)
+		}
+	}
+}
+
+func TestShapingDevanagari(t *testing.T) {
+	pdf := shapingDoc(t, shapingDevanagariFont)
+	utf := pdf.currentFont.utf8File
+
+	// the short i matra is displayed before the consonant, the dead na
+	// takes its half form
+	glyphs := pdf.shapedText("हिन्दी")
+	cids := shapingCIDs(glyphs)
+	if len(cids) != 5 || cids[0] != 0x093F || cids[1] != 0x0939 || cids[2] < 0xE000 ||
+		cids[3] != 0x0926 || cids[4] != 0x0940 {
+		t.Fatalf("unexpected glyphs for हिन्दी: %X", cids)
+	}
+	if utf.cidText[cids[2]] != "न्" {
+		t.Fatalf("unexpected text of half form: %q", utf.cidText[cids[2]])
+	}
+	// with a half form the matra moves in front of the whole conjunct
+	if cids := shapingCIDs(pdf.shapedText("स्कि")); len(cids) != 3 || cids[0] != 0x093F || cids[2] != 0x0915 {
+		t.Fatalf("unexpected glyphs for स्कि: %X", cids)
+	}
+	// the reph is drawn after the base consonant and positioned by GPOS
+	glyphs = pdf.shapedText("र्क")
+	if len(glyphs) != 2 || glyphs[0].cid != 0x0915 || glyphs[1].cid < 0xE000 || glyphs[1].dx >= 0 {
+		t.Fatalf("unexpected glyphs for र्क: %+v", glyphs)
+	}
+	// below-base ra
+	if glyphs := pdf.shapedText("प्र"); len(glyphs) != 2 || glyphs[1].cid < 0xE000 {
+		t.Fatalf("unexpected glyphs for प्र: %+v", glyphs)
+	}
+	// conjunct ligature
+	if cids := shapingCIDs(pdf.shapedText("क्ष")); len(cids) != 1 || utf.cidText[cids[0]] != "क्ष" {
+		t.Fatalf("unexpected glyphs for क्ष: %X", cids)
+	}
+	// Latin text is left alone
+	if pdf.shapedText("Hindi") != nil {
+		t.Fatalf("Latin text should not be shaped")
+	}
+
+	pdf.MultiCell(60, 8, "नमस्ते दुनिया, यह हिन्दी में लिखा गया एक वाक्य है जो कई पंक्तियों में बँटता है।", "", "J", false)
+	pdf.Write(8, "शक्ति और प्रेम")
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// allocated glyphs are part of the subset and map back to their text
+	if _, ok := utf.CodeSymbolDictionary[cids[2]]; !ok {
+		t.Fatalf("half form missing from the font subset")
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(sprintf("<%04X> <0928094D>", cids[2]))) {
+		t.Fatalf("ToUnicode entry of the half form not found")
+	}
+	if !regexp.MustCompile(`\] TJ`).Match(buf.Bytes()) {
+		t.Fatalf("shaped text not found in content stream")
+	}
+}
+
+func TestShapingArabic(t *testing.T) {
+	pdf := shapingDoc(t, shapingArabicFont)
+
+	// joining forms in visual order: final meem ends the word on the left,
+	// lam-alef ligature, initial seen on the right
+	cids := shapingCIDs(pdf.shapedText("سلام"))
+	if len(cids) != 3 || cids[0] != 0x0645 || cids[1] != 0xFEFC || cids[2] != 0xFEB3 {
+		t.Fatalf("unexpected glyphs for سلام: %X", cids)
+	}
+	// Arabic digits keep their order inside right-to-left text
+	cids = shapingCIDs(pdf.shapedText("عدد ١٢"))
+	if len(cids) < 3 || cids[0] != 0x0661 || cids[1] != 0x0662 {
+		t.Fatalf("unexpected glyphs for digits: %X", cids)
+	}
+	// marks are attached to their base
+	glyphs := pdf.shapedText("بِ")
+	if len(glyphs) != 2 || glyphs[0].cid != 0x0650 || glyphs[0].dy >= 0 || glyphs[0].adv != 0 {
+		t.Fatalf("unexpected glyphs for kasra: %+v", glyphs)
+	}
+	w := pdf.GetStringWidth("سلام")
+	if exp := shapedWidth(pdf.shapedText("سلام")) * pdf.fontSize / 1000; w < exp-0.01 || w > exp+0.01 {
+		t.Fatalf("string width %.3f does not match shaped width %.3f", w, exp)
+	}
+
+	pdf.RTL()
+	pdf.CellFormat(0, 10, "مرحبا بالعالم", "", 1, "R", false, 0, "")
+	pdf.MultiCell(50, 8, "هذا نص عربي طويل يمتد على عدة أسطر في الخلية", "", "R", false)
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// initial meem of مرحبا is the last glyph of the line
+	if !bytes.Contains(buf.Bytes(), []byte("\xfe\xe3)] TJ")) {
+		t.Fatalf("right-to-left line not found in content stream")
+	}
+}
+
+func TestShapingDisabled(t *testing.T) {
+	pdf := shapingDoc(t, shapingDevanagariFont)
+	pdf.RTL()
+	if cids := shapingCIDs(pdf.shapedText("ab!")); len(cids) != 3 || cids[0] != '!' || cids[1] != 'a' {
+		t.Fatalf("unexpected order in right-to-left mode: %X", cids)
+	}
+	pdf.SetTextShaping(false)
+	if pdf.shapedText("ab!") != nil || pdf.shapedText("हिन्दी") != nil {
+		t.Fatalf("text shaped with shaping disabled")
+	}
+	pdf.Cell(40, 10, "abc")
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("(\x00c\x00b\x00a)Tj")) {
+		t.Fatalf("reversed text not found")
+	}
+}
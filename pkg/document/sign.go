@@ -0,0 +1,223 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SignatureOptions describes the digital signature applied by Sign
+type SignatureOptions struct {
+	// Signer holds the private key matching the first certificate
+	Signer crypto.Signer
+	// Certificates is the signer's certificate followed by the certificates
+	// of its chain
+	Certificates []*x509.Certificate
+	// Hash is the digest algorithm: SHA-256 (the default), SHA-384 or SHA-512
+	Hash crypto.Hash
+	// Timestamper, if not nil, supplies an RFC 3161 signature time-stamp
+	Timestamper Timestamper
+	// FieldName names the signature field created with SignatureField that
+	// receives the signature. When empty, or when no such field exists, an
+	// invisible field is added to the current page.
+	FieldName string
+	// Name, Reason, Location and ContactInfo are recorded in the signature
+	// dictionary when not empty
+	Name        string
+	Reason      string
+	Location    string
+	ContactInfo string
+	// SigningTime is the claimed time of signing; the current time is used
+	// when zero
+	SigningTime time.Time
+}
+
+// signByteRangeWidth is the space reserved for the /ByteRange array
+const signByteRangeWidth = 48
+
+type signRecType struct {
+	opts         SignatureOptions
+	field        *formFieldType
+	size         int // bytes reserved for the CMS signature
+	byteRangePos int // buffer offset of the /ByteRange array
+	contentsPos  int // buffer offset of the /Contents hexadecimal string
+	objNum       int
+}
+
+// Sign digitally signs the document when it is output. The signature is a
+// detached CMS signature following the PAdES baseline profile
+// (ETSI.CAdES.detached) over the whole file, optionally time-stamped. For
+// example:
+//
+//	pdf.SignatureField("signature", 20, 250, 60, 20, FormFieldOptions{Border: true})
+//	pdf.Sign(SignatureOptions{
+//		Signer:       key,
+//		Certificates: []*x509.Certificate{cert, intermediate},
+//		FieldName:    "signature",
+//		Reason:       "Invoice approval",
+//		Timestamper:  &TSAClient{URL: "http://tsa.example.com"},
+//	})
+//
+// Sign must be called after a page has been added.
+func (f *Bdf) Sign(opts SignatureOptions) {
+	if f.err != nil {
+		return
+	}
+	if err := signCheck(&opts); err != nil {
+		f.err = err
+		return
+	}
+	name := opts.FieldName
+	if name == "" {
+		name = "Signature1"
+	}
+	fld, ok := f.form.names[name]
+	if !ok {
+		f.SignatureField(name, 0, 0, 0, 0, FormFieldOptions{})
+		if f.err != nil {
+			return
+		}
+		fld = f.form.names[name]
+	} else if fld.kind != "Sig" {
+		f.err = fmt.Errorf("form field %q is not a signature field", name)
+		return
+	}
+	f.sign.opts = opts
+	f.sign.field = fld
+	f.sign.size = signSize(opts)
+}
+
+// signCheck validates the signer and certificates of opts and sets the
+// default digest algorithm
+func signCheck(opts *SignatureOptions) error {
+	if opts.Signer == nil || len(opts.Certificates) == 0 {
+		return fmt.Errorf("signing requires a signer and its certificate")
+	}
+	if opts.Hash == 0 {
+		opts.Hash = crypto.SHA256
+	}
+	if _, err := signatureAlgorithm(opts.Signer, opts.Hash); err != nil {
+		return err
+	}
+	if pub, ok := opts.Signer.Public().(interface{ Equal(crypto.PublicKey) bool }); ok &&
+		!pub.Equal(opts.Certificates[0].PublicKey) {
+		return fmt.Errorf("the signer does not match the public key of the certificate")
+	}
+	return nil
+}
+
+// signSize returns the number of bytes reserved for the CMS signature
+func signSize(opts SignatureOptions) int {
+	size := 8192
+	for _, cert := range opts.Certificates {
+		size += len(cert.Raw)
+	}
+	if opts.Timestamper != nil {
+		size += 8192
+	}
+	return size
+}
+
+// signPutDict writes the signature dictionary with placeholders for the byte
+// range and the signature
+func (f *Bdf) signPutDict() {
+	opts := f.sign.opts
+	f.newobj()
+	f.sign.objNum = f.n
+	f.out("<</Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached")
+	f.put("/ByteRange ")
+	f.sign.byteRangePos = f.buffer.Len()
+	f.out("[0 0 0 0]" + strings.Repeat(" ", signByteRangeWidth-9))
+	f.put("/Contents ")
+	f.sign.contentsPos = f.buffer.Len()
+	f.out("<" + strings.Repeat("0", 2*f.sign.size) + ">")
+	tm := opts.SigningTime
+	if tm.IsZero() {
+		tm = time.Now()
+	}
+	f.outf("/M %s", f.textstring("D:"+tm.Format("20060102150405-07'00'")))
+	utf8 := f.sign.field.utf8
+	for _, e := range []struct{ key, val string }{
+		{"Name", opts.Name},
+		{"Reason", opts.Reason},
+		{"Location", opts.Location},
+		{"ContactInfo", opts.ContactInfo},
+	} {
+		if e.val != "" {
+			f.outf("/%s %s", e.key, f.formString(e.val, utf8))
+		}
+	}
+	f.out(">>")
+	f.out("endobj")
+}
+
+// signApply fills in the byte range and the CMS signature once the document
+// is complete
+func (f *Bdf) signApply() {
+	if f.sign.field == nil || f.err != nil {
+		return
+	}
+	if err := signFill(f.buffer.Bytes(), f.sign); err != nil {
+		f.err = err
+	}
+}
+
+// signFill writes the byte range and the CMS signature over the rest of buf
+// into the placeholders of sign
+func signFill(buf []byte, sign signRecType) error {
+	start := sign.contentsPos
+	end := start + 2*sign.size + 2
+	byteRange := fmt.Sprintf("[0 %d %d %d]", start, end, len(buf)-end)
+	if len(byteRange) > signByteRangeWidth {
+		return fmt.Errorf("document too large for the signature byte range")
+	}
+	copy(buf[sign.byteRangePos:], byteRange)
+	data := make([]byte, 0, len(buf)-(end-start))
+	data = append(data, buf[:start]...)
+	data = append(data, buf[end:]...)
+	opts := sign.opts
+	s := cmsSigner{signer: opts.Signer, certs: opts.Certificates, hash: opts.Hash}
+	if opts.Timestamper != nil {
+		s.unsigned = func(signature []byte) ([][]byte, error) {
+			h := opts.Hash.New()
+			h.Write(signature)
+			token, err := opts.Timestamper.Timestamp(h.Sum(nil), opts.Hash)
+			if err != nil {
+				return nil, fmt.Errorf("unable to time-stamp signature: %v", err)
+			}
+			return [][]byte{cmsAttribute(oidAttrTimeStampToken, token)}, nil
+		}
+	}
+	sig, err := s.sign(oidData, data, true)
+	if err != nil {
+		return err
+	}
+	if len(sig) > sign.size {
+		return fmt.Errorf("signature of %d bytes exceeds the %d bytes reserved", len(sig), sign.size)
+	}
+	hex.Encode(buf[start+1:], sig)
+	return nil
+}
@@ -0,0 +1,302 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testCertificate issues a certificate for a new P-256 key, self-signed when
+// parent is nil
+func testCertificate(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey,
+	usage []x509.ExtKeyUsage) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           usage,
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+type testSignerInfo struct {
+	Version            int
+	Sid                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type testSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	}
+	Certificates asn1.RawValue    `asn1:"optional,tag:0"`
+	SignerInfos  []testSignerInfo `asn1:"set"`
+}
+
+type testAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// verifyCMS checks the signature of a DER ContentInfo over content (the
+// encapsulated content when nil) and returns the signer info
+func verifyCMS(t *testing.T, data, content []byte, pub *ecdsa.PublicKey) (testSignerInfo, []byte) {
+	t.Helper()
+	var ci struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	if _, err := asn1.Unmarshal(data, &ci); err != nil {
+		t.Fatal(err)
+	}
+	var sd testSignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatal(err)
+	}
+	if content == nil {
+		if _, err := asn1.Unmarshal(sd.EncapContentInfo.Content.Bytes, &content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	si := sd.SignerInfos[0]
+	attrs := append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	sum := sha256.Sum256(attrs)
+	if !ecdsa.VerifyASN1(pub, sum[:], si.Signature) {
+		t.Fatal("signature does not verify")
+	}
+	var list []testAttribute
+	if _, err := asn1.UnmarshalWithParams(si.SignedAttrs.FullBytes, &list, "set,tag:0"); err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(content)
+	found := false
+	for _, a := range list {
+		if a.Type.Equal(oidAttrMessageDigest) {
+			found = bytes.Equal(a.Values[0].Bytes, digest[:])
+		}
+	}
+	if !found {
+		t.Fatal("message digest attribute does not match the content")
+	}
+	return si, content
+}
+
+func TestSignDocument(t *testing.T) {
+	caKey, ca := testCertificate(t, "Test CA", nil, nil, nil)
+	key, cert := testCertificate(t, "Invoicing", ca, caKey, nil)
+	tsaKey, tsaCert := testCertificate(t, "Test TSA", ca, caKey, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping})
+	tsa := httptest.NewServer(&LocalTSA{Signer: tsaKey, Certificate: tsaCert})
+	defer tsa.Close()
+
+	pdf := New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.Cell(40, 10, "Invoice 42")
+	pdf.SignatureField("approval", 20, 40, 60, 20, FormFieldOptions{Border: true})
+	pdf.Sign(SignatureOptions{
+		Signer:       key,
+		Certificates: []*x509.Certificate{cert, ca},
+		FieldName:    "approval",
+		Reason:       "Invoice approval",
+		Timestamper:  &TSAClient{URL: tsa.URL},
+	})
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.Bytes()
+	for _, w := range []string{"/SubFilter /ETSI.CAdES.detached", "/Reason (Invoice approval)", "/SigFlags 3", "/FT /Sig /T (approval)\n/V "} {
+		if !bytes.Contains(doc, []byte(w)) {
+			t.Errorf("output does not contain %q", w)
+		}
+	}
+	m := regexp.MustCompile(`/ByteRange \[0 (\d+) (\d+) (\d+)\]`).FindSubmatch(doc)
+	if m == nil {
+		t.Fatal("byte range not found")
+	}
+	var br [3]int
+	for j := range br {
+		br[j], _ = strconv.Atoi(string(m[j+1]))
+	}
+	if br[1]+br[2] != len(doc) || doc[br[0]] != '<' || doc[br[1]-1] != '>' {
+		t.Fatalf("byte range %v does not cover the file of %d bytes", br, len(doc))
+	}
+	sig, err := hex.DecodeString(string(doc[br[0]+1 : br[1]-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := append(append([]byte(nil), doc[:br[0]]...), doc[br[1]:]...)
+	si, _ := verifyCMS(t, sig, signed, &key.PublicKey)
+
+	var unsigned []testAttribute
+	if _, err = asn1.UnmarshalWithParams(si.UnsignedAttrs.FullBytes, &unsigned, "set,tag:1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(unsigned) != 1 || !unsigned[0].Type.Equal(oidAttrTimeStampToken) {
+		t.Fatal("signature time-stamp attribute missing")
+	}
+	_, tstInfo := verifyCMS(t, unsigned[0].Values[0].FullBytes, nil, &tsaKey.PublicKey)
+	var info struct {
+		Version        int
+		Policy         asn1.ObjectIdentifier
+		MessageImprint tsaMessageImprint
+		Serial         *big.Int
+		GenTime        time.Time `asn1:"generalized"`
+		Nonce          *big.Int  `asn1:"optional"`
+	}
+	if _, err = asn1.Unmarshal(tstInfo, &info); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(si.Signature)
+	if !bytes.Equal(info.MessageImprint.HashedMessage, sum[:]) {
+		t.Error("time-stamp does not cover the signature value")
+	}
+	if info.Nonce == nil {
+		t.Error("time-stamp does not echo the request nonce")
+	}
+}
+
+func TestSignErrors(t *testing.T) {
+	caKey, ca := testCertificate(t, "Test CA", nil, nil, nil)
+	key, _ := testCertificate(t, "Other", ca, caKey, nil)
+	pdf := New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.Sign(SignatureOptions{Signer: key, Certificates: []*x509.Certificate{ca}})
+	if pdf.Error() == nil {
+		t.Error("expected an error for a certificate not matching the signer")
+	}
+	pdf = New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.TextField("name", 10, 10, 50, 8, "", FormFieldOptions{})
+	pdf.Sign(SignatureOptions{Signer: caKey, Certificates: []*x509.Certificate{ca}, FieldName: "name"})
+	if pdf.Error() == nil {
+		t.Error("expected an error for a field that is not a signature field")
+	}
+}
+
+func TestTSAClient(t *testing.T) {
+	caKey, ca := testCertificate(t, "Test CA", nil, nil, nil)
+	tsaKey, tsaCert := testCertificate(t, "Test TSA", ca, caKey, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping})
+	local := &LocalTSA{Signer: tsaKey, Certificate: tsaCert}
+	digest := sha256.Sum256([]byte("signature value"))
+
+	srv := httptest.NewServer(local)
+	defer srv.Close()
+	client := &TSAClient{URL: srv.URL}
+	if _, err := client.Timestamp(digest[:], crypto.SHA256); err != nil {
+		t.Fatal(err)
+	}
+
+	// Malformed requests are rejected with badDataFormat
+	resp, err := http.Post(srv.URL, "application/timestamp-query", bytes.NewReader([]byte("junk")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tr tsaResponse
+	body := new(bytes.Buffer)
+	body.ReadFrom(resp.Body)
+	resp.Body.Close()
+	if _, err = asn1.Unmarshal(body.Bytes(), &tr); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Status.Status != 2 || tr.Status.FailInfo.At(5) != 1 || tr.Status.FailInfo.At(2) != 0 {
+		t.Fatalf("status %d with failure information %x", tr.Status.Status, tr.Status.FailInfo.Bytes)
+	}
+
+	// Tokens that do not answer the request are refused
+	for name, fnc := range map[string]func(req tsaRequest) ([]byte, error){
+		"digest": func(req tsaRequest) ([]byte, error) {
+			other := sha256.Sum256([]byte("other"))
+			return local.token(other[:], crypto.SHA256, req.Nonce)
+		},
+		"nonce": func(req tsaRequest) ([]byte, error) {
+			return local.token(req.MessageImprint.HashedMessage, crypto.SHA256, big.NewInt(7))
+		},
+		"no nonce": func(req tsaRequest) ([]byte, error) {
+			return local.token(req.MessageImprint.HashedMessage, crypto.SHA256, nil)
+		},
+	} {
+		fnc := fnc
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body bytes.Buffer
+			body.ReadFrom(r.Body)
+			var req tsaRequest
+			if _, err := asn1.Unmarshal(body.Bytes(), &req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			token, err := fnc(req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Write(derSeq(derSeq(mustMarshal(0)), token))
+		}))
+		if _, err := (&TSAClient{URL: srv.URL}).Timestamp(digest[:], crypto.SHA256); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+		srv.Close()
+	}
+}
@@ -180,9 +180,7 @@ func (f *Bdf) putSpotColors() {
 }
 
 func (f *Bdf) spotColorPutResourceDict() {
-	f.out("/ColorSpace <<")
 	for _, clr := range f.spotColorMap {
 		f.outf("/CS%d %d 0 R", clr.id, clr.objID)
 	}
-	f.out(">>")
 }
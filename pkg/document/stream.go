@@ -0,0 +1,185 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+)
+
+// streamRecType holds the state of a document that is written to its writer
+// while it is being generated
+type streamRecType struct {
+	w       io.Writer
+	offset  int    // number of bytes written to w
+	pages   int    // number of pages written to w
+	marked  int    // number of pages whose watermarks have been drawn
+	version string // PDF version written in the header
+	hold    int    // pages are not written while greater than zero
+}
+
+// SetStreamOutput specifies that the document is written to w while it is
+// being generated. Each page, along with its content stream and links, is
+// written as soon as the next page is begun, and its buffer is released.
+// Only the positions of the objects and the shared resources, such as fonts,
+// images and templates, are kept until the document is finished; these are
+// written by Close(). This keeps the memory used by documents with many
+// thousands of pages small.
+//
+// SetStreamOutput must be called before the first page is added. The
+// document is finished with Close() rather than Output(); check Error()
+// afterward. w is not closed.
+//
+// A page cannot be changed with SetPage() once it has been written, and
+// watermarks added with AddWatermark() apply only to pages that have not yet
+// been written. Streaming cannot be combined with object streams,
+// linearization, digital signatures, form fields, file attachment
+// annotations, a table of contents or AliasNbPages().
+func (f *Bdf) SetStreamOutput(w io.Writer) {
+	if f.err != nil {
+		return
+	}
+	if f.page > 0 {
+		f.err = fmt.Errorf("streaming output must be set before the first page is added")
+		return
+	}
+	f.stream.w = w
+}
+
+// outputOffset returns the position in the output of the next byte written
+// to the buffer
+func (f *Bdf) outputOffset() int {
+	return f.stream.offset + f.buffer.Len()
+}
+
+// streamCheck reports features that cannot be used with streaming output
+func (f *Bdf) streamCheck() {
+	switch {
+	case f.objStreams || f.linearize:
+		f.err = fmt.Errorf("streaming output cannot be combined with object streams or linearization")
+	case f.sign.field != nil:
+		f.err = fmt.Errorf("streaming output cannot be combined with a digital signature")
+	case len(f.form.fields) > 0:
+		f.err = fmt.Errorf("streaming output cannot be combined with form fields")
+	case f.toc.placed:
+		f.err = fmt.Errorf("streaming output cannot be combined with a table of contents")
+	case f.aliasNbPagesStr != "":
+		f.err = fmt.Errorf("streaming output cannot be combined with an alias for the number of pages")
+	}
+}
+
+// streamPage writes the completed pages to the output when streaming. It is
+// called after a page has been closed.
+func (f *Bdf) streamPage() {
+	if f.stream.w == nil || f.stream.hold > 0 || f.err != nil {
+		return
+	}
+	f.streamCheck()
+	if f.err != nil {
+		return
+	}
+	f.state = 2
+	f.putWatermarks()
+	f.state = 1
+	if f.err != nil {
+		return
+	}
+	if f.stream.pages == 0 {
+		f.putheader()
+		f.stream.version = f.pdfVersion
+	}
+	f.replaceAliases()
+	_, hPt := f.defPageSizePt()
+	f.numberPages(f.stream.pages+1, f.page)
+	for n := f.stream.pages + 1; n <= f.page; n++ {
+		if len(f.pageAttachments[n]) > 0 {
+			f.err = fmt.Errorf("streaming output cannot be combined with file attachment annotations")
+			return
+		}
+		f.putpage(n, hPt)
+		f.pages[n] = nil
+		f.pageLinks[n] = nil
+		delete(f.pageBoxes, n)
+	}
+	f.stream.pages = f.page
+	if f.stream.marked < f.page {
+		f.stream.marked = f.page
+	}
+	f.streamFlush()
+}
+
+// streamFlush writes the buffered output to the writer when streaming
+func (f *Bdf) streamFlush() {
+	if f.stream.w == nil || f.err != nil {
+		return
+	}
+	n, err := f.buffer.WriteTo(f.stream.w)
+	f.stream.offset += int(n)
+	if err != nil {
+		f.err = err
+	}
+}
+
+// streamDestName returns the name of the destination of internal link
+// number link. Pages that are streamed refer to their links by name because
+// the target of a link may not be known until a later page.
+func streamDestName(link int) string {
+	return fmt.Sprintf("L%08d", link)
+}
+
+// streamPutDests writes the name tree of the link destinations of a
+// streamed document
+func (f *Bdf) streamPutDests() {
+	if f.stream.w == nil {
+		return
+	}
+	_, hPt := f.defPageSizePt()
+	var names fmtBuffer
+	names.printf("/Dests <</Names [")
+	for j := 1; j < len(f.links); j++ {
+		l := f.links[j]
+		if l.page < 1 || l.page >= len(f.pageObjNums) {
+			continue
+		}
+		h := hPt
+		if sz, ok := f.pageSizes[l.page]; ok {
+			h = sz.Ht
+		}
+		names.printf("%s [%d 0 R /XYZ 0 %.2f null] ", f.textstring(streamDestName(j)), f.pageObjNums[l.page], h-l.y*f.k)
+	}
+	names.printf("]>>")
+	f.out(names.String())
+}
+
+// streamPutCatalog raises the version of a streamed document in its catalog
+// when features of a later version have been used after the header was
+// written
+func (f *Bdf) streamPutCatalog() {
+	if f.stream.w == nil {
+		return
+	}
+	if len(f.blendMap) > 0 && f.pdfVersion < "1.4" {
+		f.pdfVersion = "1.4"
+	}
+	if f.pdfVersion > f.stream.version {
+		f.outf("/Version /%s", f.pdfVersion)
+	}
+}
@@ -0,0 +1,213 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const streamPages = 12
+
+// streamDoc generates a document of several pages with a footer, a
+// watermark, bookmarks, footnotes and a link to the last page
+func streamDoc(pdf *Bdf) {
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Page %d", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddWatermark(WatermarkType{Text: "COPY", Angle: 30, Color: RGBType{R: 220, G: 220, B: 220}})
+	summary := pdf.AddLink()
+	for j := 1; j <= streamPages; j++ {
+		pdf.AddPage()
+		pdf.Bookmark(fmt.Sprintf("Statement %d", j), 0, 0)
+		pdf.Write(6, strings.Repeat("Balance carried forward. ", 20))
+		pdf.Footnote(fmt.Sprintf("Note on statement %d.", j))
+		if j == 1 {
+			pdf.Ln(10)
+			pdf.WriteLinkID(6, "Summary", summary)
+		}
+	}
+	pdf.Ln(10)
+	pdf.SetLink(summary, -1, -1)
+	pdf.Cell(0, 10, "Summary")
+}
+
+// streamCheckXref verifies that each entry of the cross-reference table of
+// doc points at its object
+func streamCheckXref(t *testing.T, doc []byte) {
+	t.Helper()
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n?$`).FindSubmatch(doc)
+	if m == nil {
+		t.Fatal("startxref not found")
+	}
+	pos, _ := strconv.Atoi(string(m[1]))
+	var count int
+	if _, err := fmt.Sscanf(string(doc[pos:]), "xref\n0 %d\n", &count); err != nil {
+		t.Fatalf("no cross-reference table at %d: %v", pos, err)
+	}
+	entries := doc[bytes.Index(doc[pos:], []byte("0000000000 65535 f"))+pos:]
+	for j := 1; j < count; j++ {
+		off, _ := strconv.Atoi(string(entries[20*j : 20*j+10]))
+		if !bytes.HasPrefix(doc[off:], []byte(fmt.Sprintf("%d 0 obj", j))) {
+			t.Fatalf("object %d not found at offset %d", j, off)
+		}
+	}
+}
+
+func TestStreamOutput(t *testing.T) {
+	var stream bytes.Buffer
+	pdf := New("P", "mm", "A5", "")
+	pdf.SetStreamOutput(&stream)
+	streamDoc(pdf)
+	// The completed pages have been written and released
+	if stream.Len() == 0 {
+		t.Fatal("nothing written before Close")
+	}
+	for n := 1; n < pdf.PageCount(); n++ {
+		if pdf.pages[n] != nil {
+			t.Fatalf("page %d is still in memory", n)
+		}
+	}
+	pdf.Close()
+	if err := pdf.Error(); err != nil {
+		t.Fatal(err)
+	}
+	doc := stream.Bytes()
+	streamCheckXref(t, doc)
+	// The pages are the first objects of a streamed document
+	for n := 1; n <= pdf.PageCount(); n++ {
+		if pdf.pageObjNums[n] != 1+2*n {
+			t.Fatalf("page %d is object %d", n, pdf.pageObjNums[n])
+		}
+	}
+	// The link to the last page was set after the first page was written
+	for _, s := range []string{"/Dest (L00000001)", "/Dests <</Names [(L00000001) [25 0 R "} {
+		if !bytes.Contains(doc, []byte(s)) {
+			t.Fatalf("output does not contain %q", s)
+		}
+	}
+	r, err := NewPDFReader(bytes.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.NumPages() != streamPages {
+		t.Fatalf("got %d pages", r.NumPages())
+	}
+	// The pages look the same as those of a document kept in memory
+	ref := New("P", "mm", "A5", "")
+	streamDoc(ref)
+	var buf bytes.Buffer
+	if err := ref.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	refReader, err := NewPDFReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{1, 2, streamPages} {
+		img, err := r.RasterizePage(n, RasterOptions{DPI: 40})
+		if err != nil {
+			t.Fatal(err)
+		}
+		refImg, err := refReader.RasterizePage(n, RasterOptions{DPI: 40})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(img.Pix, refImg.Pix) {
+			t.Fatalf("page %d differs from the document kept in memory", n)
+		}
+	}
+}
+
+func TestStreamProtect(t *testing.T) {
+	var stream bytes.Buffer
+	pdf := New("P", "mm", "A5", "")
+	pdf.SetCompression(false)
+	pdf.SetProtectionOptions(ProtectionOptions{Algorithm: EncryptAES128, UserPassword: "user"})
+	pdf.SetStreamOutput(&stream)
+	streamDoc(pdf)
+	pdf.Close()
+	if err := pdf.Error(); err != nil {
+		t.Fatal(err)
+	}
+	doc := stream.Bytes()
+	streamCheckXref(t, doc)
+	// Encryption changes the length of the streams of the written pages
+	re := regexp.MustCompile(`\d+ 0 obj\n<</Length (\d+)>>\nstream\n`)
+	list := re.FindAllSubmatchIndex(doc, -1)
+	if len(list) < streamPages {
+		t.Fatalf("found %d content streams", len(list))
+	}
+	for _, m := range list {
+		size, _ := strconv.Atoi(string(doc[m[2]:m[3]]))
+		if !bytes.HasPrefix(doc[m[1]+size:], []byte("\nendstream")) {
+			t.Fatalf("stream length %d does not match the stream data", size)
+		}
+	}
+	if !bytes.Contains(doc, []byte("/Encrypt ")) {
+		t.Fatal("output is not encrypted")
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	for name, fnc := range map[string]func(pdf *Bdf){
+		"late": func(pdf *Bdf) {
+			pdf.AddPage()
+			pdf.SetStreamOutput(io.Discard)
+		},
+		"object streams": func(pdf *Bdf) {
+			pdf.SetStreamOutput(io.Discard)
+			pdf.SetObjectStreams(true)
+			pdf.AddPage()
+		},
+		"alias": func(pdf *Bdf) {
+			pdf.SetStreamOutput(io.Discard)
+			pdf.AliasNbPages("")
+			pdf.AddPage()
+		},
+		"written page": func(pdf *Bdf) {
+			pdf.SetStreamOutput(io.Discard)
+			pdf.AddPage()
+			pdf.AddPage()
+			pdf.SetPage(1)
+		},
+		"output": func(pdf *Bdf) {
+			pdf.SetStreamOutput(io.Discard)
+			pdf.AddPage()
+			_ = pdf.Output(io.Discard)
+		},
+	} {
+		pdf := New("P", "mm", "A5", "")
+		pdf.SetFont("Helvetica", "", 12)
+		fnc(pdf)
+		pdf.Close()
+		if pdf.Error() == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,602 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+)
+
+// TableColumnType describes a column of a table. Width is a fixed width in
+// user units and Percent a share of the table width. A column with neither is
+// sized automatically from its content and shares the remaining width with
+// the other automatic columns.
+type TableColumnType struct {
+	Width   float64
+	Percent float64
+	// Align is the default horizontal alignment of the column: "L", "C" or
+	// "R". It takes precedence over the alignment of the row style.
+	Align string
+}
+
+// TableStyleType holds the appearance of table cells.
+type TableStyleType struct {
+	// Padding is the space between the cell border and its text. A value of
+	// zero uses the cell margin of the document.
+	Padding float64
+	// Border is empty for no border, "1" for a full frame or a combination of
+	// "L", "T", "R" and "B" for individual sides.
+	Border      string
+	BorderColor RGBType
+	// LineWidth of the border, zero uses the current line width
+	LineWidth float64
+	// Fill is the background color, nil leaves the cell unfilled
+	Fill      *RGBType
+	TextColor RGBType
+	// FontStyle is applied to the current font family, for example "B"
+	FontStyle string
+	// FontSize in points, zero uses the current font size
+	FontSize float64
+	// Align is the horizontal alignment: "L" (default), "C" or "R"
+	Align string
+	// VAlign is the vertical alignment: "T" (default), "M" or "B"
+	VAlign string
+}
+
+// TableCellType is a cell of a table row. Text may contain newlines and is
+// wrapped to the width of the cell. A cell spans ColSpan columns and RowSpan
+// rows, values below one being treated as one. Style, when not nil, replaces
+// the header or body style for this cell.
+type TableCellType struct {
+	Text    string
+	ColSpan int
+	RowSpan int
+	Style   *TableStyleType
+}
+
+// TableType lays out rows of wrapped text in columns. The first HeaderRows
+// rows form the header, which is repeated at the top of every page the table
+// continues on. Rows joined by a row span are kept together on a page.
+type TableType struct {
+	Columns []TableColumnType
+	// Width of the table, zero extends the table to the right margin
+	Width float64
+	// HeaderRows is the number of leading rows repeated on each page
+	HeaderRows  int
+	HeaderStyle TableStyleType
+	BodyStyle   TableStyleType
+	// ZebraFill is the background of every second body row. It replaces the
+	// fill of the body style but not that of a cell with its own style.
+	ZebraFill *RGBType
+	// LineHeight is the height of a line of text, zero derives it from the
+	// font size
+	LineHeight float64
+	rows       [][]TableCellType
+}
+
+// tableCellPos is a cell placed in the grid of a table
+type tableCellPos struct {
+	cell               *TableCellType
+	row, col           int
+	rowSpan, colSpan   int
+	style              TableStyleType
+	fill               *RGBType
+	align              string
+	lines              []string
+	lineHt, pad, minHt float64
+}
+
+// NewTable returns a table with the specified columns. The header and body
+// cells are framed and the header text is set in bold.
+func NewTable(columns ...TableColumnType) *TableType {
+	return &TableType{
+		Columns:     columns,
+		HeaderStyle: TableStyleType{Border: "1", FontStyle: "B"},
+		BodyStyle:   TableStyleType{Border: "1"},
+	}
+}
+
+// AddRow appends a row of cells to the table.
+func (t *TableType) AddRow(cells ...TableCellType) {
+	t.rows = append(t.rows, cells)
+}
+
+// AddTextRow appends a row of single-span cells with the specified texts.
+func (t *TableType) AddTextRow(texts ...string) {
+	cells := make([]TableCellType, len(texts))
+	for j, txt := range texts {
+		cells[j].Text = txt
+	}
+	t.rows = append(t.rows, cells)
+}
+
+// tableApplyFont selects the font style and size of st
+func tableApplyFont(pdf *Bdf, st TableStyleType, family string, sizePt float64) {
+	if st.FontSize > 0 {
+		sizePt = st.FontSize
+	}
+	pdf.setFontIfChanged(family, st.FontStyle, sizePt)
+}
+
+// place assigns the cells of the table to grid positions
+func (t *TableType) place(pdf *Bdf) (cells []*tableCellPos, starts [][]*tableCellPos) {
+	ncol := len(t.Columns)
+	nrow := len(t.rows)
+	header := t.HeaderRows
+	if header > nrow {
+		header = nrow
+	}
+	used := make([][]bool, nrow)
+	for r := range used {
+		used[r] = make([]bool, ncol)
+	}
+	starts = make([][]*tableCellPos, nrow)
+	bodyRow := 0
+	for r := range t.rows {
+		c := 0
+		for j := range t.rows[r] {
+			for c < ncol && used[r][c] {
+				c++
+			}
+			if c >= ncol {
+				pdf.SetErrorf("table row %d has more cells than columns", r+1)
+				return
+			}
+			cell := &t.rows[r][j]
+			pos := &tableCellPos{cell: cell, row: r, col: c, rowSpan: 1, colSpan: 1}
+			if cell.ColSpan > 1 {
+				pos.colSpan = cell.ColSpan
+			}
+			if cell.RowSpan > 1 {
+				pos.rowSpan = cell.RowSpan
+			}
+			// spans are bounded by the grid and by the end of the header
+			last := nrow
+			if r < header {
+				last = header
+			}
+			if r+pos.rowSpan > last {
+				pos.rowSpan = last - r
+			}
+			for k := c; k < c+pos.colSpan; k++ {
+				if k >= ncol || used[r][k] {
+					pos.colSpan = k - c
+					break
+				}
+			}
+			for rr := r; rr < r+pos.rowSpan; rr++ {
+				for k := c; k < c+pos.colSpan; k++ {
+					used[rr][k] = true
+				}
+			}
+			st := t.BodyStyle
+			if r < header {
+				st = t.HeaderStyle
+			}
+			pos.fill = st.Fill
+			if r >= header && t.ZebraFill != nil && bodyRow%2 == 1 {
+				pos.fill = t.ZebraFill
+			}
+			pos.align = st.Align
+			if t.Columns[c].Align != "" {
+				pos.align = t.Columns[c].Align
+			}
+			if cell.Style != nil {
+				st = *cell.Style
+				pos.fill = st.Fill
+				pos.align = st.Align
+			}
+			pos.style = st
+			pos.pad = st.Padding
+			if pos.pad == 0 {
+				pos.pad = pdf.cMargin
+			}
+			cells = append(cells, pos)
+			starts[r] = append(starts[r], pos)
+			c += pos.colSpan
+		}
+		if r >= header {
+			bodyRow++
+		}
+	}
+	return
+}
+
+// columnWidths distributes width among the columns. Automatic columns share
+// the width left by the fixed and percent columns in proportion to the
+// natural width of their single-column cells.
+func (t *TableType) columnWidths(pdf *Bdf, width float64, cells []*tableCellPos) []float64 {
+	family, sizePt := pdf.fontFamily, pdf.fontSizePt
+	ncol := len(t.Columns)
+	wd := make([]float64, ncol)
+	natural := make([]float64, ncol)
+	for _, pos := range cells {
+		if pos.colSpan != 1 || t.Columns[pos.col].Width > 0 || t.Columns[pos.col].Percent > 0 {
+			continue
+		}
+		tableApplyFont(pdf, pos.style, family, sizePt)
+		for _, line := range strings.Split(pos.cell.Text, "\n") {
+			w := pdf.GetStringWidth(line) + 2*pos.pad
+			if w > natural[pos.col] {
+				natural[pos.col] = w
+			}
+		}
+	}
+	remain := width
+	autoCount := 0
+	var autoSum float64
+	for j, col := range t.Columns {
+		switch {
+		case col.Width > 0:
+			wd[j] = col.Width
+		case col.Percent > 0:
+			wd[j] = width * col.Percent / 100
+		default:
+			autoCount++
+			autoSum += natural[j]
+			continue
+		}
+		remain -= wd[j]
+	}
+	if autoCount == 0 {
+		return wd
+	}
+	if remain <= 0 {
+		pdf.SetErrorf("table columns leave no room for automatically sized columns")
+		return wd
+	}
+	for j, col := range t.Columns {
+		if col.Width > 0 || col.Percent > 0 {
+			continue
+		}
+		if autoSum > 0 {
+			wd[j] = remain * natural[j] / autoSum
+		} else {
+			wd[j] = remain / float64(autoCount)
+		}
+	}
+	return wd
+}
+
+// rowHeights wraps the text of the cells and returns the height of each row.
+// A cell spanning several rows that needs more height than the rows provide
+// enlarges the last row it spans.
+func (t *TableType) rowHeights(pdf *Bdf, wd []float64, cells []*tableCellPos) []float64 {
+	family, sizePt := pdf.fontFamily, pdf.fontSizePt
+	ht := make([]float64, len(t.rows))
+	for _, pos := range cells {
+		tableApplyFont(pdf, pos.style, family, sizePt)
+		pos.lineHt = t.LineHeight
+		if pos.lineHt <= 0 {
+			pos.lineHt = pdf.fontSize * 1.25
+		}
+		var w float64
+		for k := pos.col; k < pos.col+pos.colSpan; k++ {
+			w += wd[k]
+		}
+		pos.lines = nil
+		for _, para := range strings.Split(pos.cell.Text, "\n") {
+			var lines []string
+			if pdf.isCurrentUTF8 {
+				lines = pdf.SplitText(para, w-2*pos.pad)
+			} else {
+				// SplitText() indexes the widths by rune
+				for _, line := range pdf.SplitLines([]byte(para), w-2*pos.pad) {
+					lines = append(lines, string(line))
+				}
+			}
+			if len(lines) == 0 {
+				lines = []string{""}
+			}
+			pos.lines = append(pos.lines, lines...)
+		}
+		pos.minHt = float64(len(pos.lines))*pos.lineHt + 2*pos.pad
+		if pos.rowSpan == 1 && pos.minHt > ht[pos.row] {
+			ht[pos.row] = pos.minHt
+		}
+	}
+	for _, pos := range cells {
+		if pos.rowSpan > 1 {
+			var h float64
+			for r := pos.row; r < pos.row+pos.rowSpan; r++ {
+				h += ht[r]
+			}
+			if h < pos.minHt {
+				ht[pos.row+pos.rowSpan-1] += pos.minHt - h
+			}
+		}
+	}
+	return ht
+}
+
+// groups returns the index of the first row of each block of rows that is
+// joined by row spans and must not be split across pages. The header forms
+// a single block.
+func (t *TableType) groups(cells []*tableCellPos) (list []int) {
+	end := make([]int, len(t.rows))
+	for r := range end {
+		end[r] = r + 1
+	}
+	for _, pos := range cells {
+		if pos.row+pos.rowSpan > end[pos.row] {
+			end[pos.row] = pos.row + pos.rowSpan
+		}
+	}
+	r := 0
+	header := t.HeaderRows
+	if header > len(t.rows) {
+		header = len(t.rows)
+	}
+	if header > 0 {
+		list = append(list, 0)
+		r = header
+	}
+	for r < len(t.rows) {
+		list = append(list, r)
+		last := end[r]
+		for k := r + 1; k < last; k++ {
+			if end[k] > last {
+				last = end[k]
+			}
+		}
+		r = last
+	}
+	return
+}
+
+// Draw renders the table at the current position of pdf. The table extends to
+// the right margin unless Width is set. When automatic page breaking is
+// enabled, a block of rows that does not fit in the space left on the page is
+// moved to a new page, where the header rows are drawn again. A block that is
+// taller than a page is reported as an error. On return the
+// current position is at the left margin below the table. The graphic state of
+// pdf is preserved.
+func (t *TableType) Draw(pdf *Bdf) {
+	if pdf.err != nil {
+		return
+	}
+	if len(t.Columns) == 0 {
+		pdf.SetErrorf("table has no columns")
+		return
+	}
+	if pdf.currentFont.Name == "" {
+		pdf.SetErrorf("font has not been set; unable to render table")
+		return
+	}
+	state := StateGet(pdf)
+	family, style, sizePt := pdf.fontFamily, pdf.fontStyle, pdf.fontSizePt
+	if pdf.underline {
+		style += "U"
+	}
+	if pdf.strikeout {
+		style += "S"
+	}
+	accept := pdf.acceptPageBreak
+	pdf.acceptPageBreak = func() bool { return false }
+	defer func() {
+		pdf.acceptPageBreak = accept
+		pdf.SetFont(family, style, sizePt)
+		state.Put(pdf)
+	}()
+
+	x := pdf.x
+	width := t.Width
+	if width <= 0 {
+		width = pdf.w - pdf.rMargin - x
+	}
+	cells, starts := t.place(pdf)
+	if pdf.err != nil {
+		return
+	}
+	pdf.cMargin = 0
+	wd := t.columnWidths(pdf, width, cells)
+	ht := t.rowHeights(pdf, wd, cells)
+	if pdf.err != nil {
+		return
+	}
+	header := t.HeaderRows
+	if header > len(t.rows) {
+		header = len(t.rows)
+	}
+	fresh := pdf.y <= pdf.tMargin
+	groups := t.groups(cells)
+	tagged := pdf.structTree.enabled
+	if tagged {
+		pdf.BeginStructElem(StructTable)
+	}
+	body := false
+	for j, first := range groups {
+		last := len(t.rows)
+		if j+1 < len(groups) {
+			last = groups[j+1]
+		}
+		var gh float64
+		for r := first; r < last; r++ {
+			gh += ht[r]
+		}
+		isHeader := first < header
+		need := gh
+		if isHeader && last < len(t.rows) {
+			// keep the header with the first block of body rows
+			k := j + 1
+			next := len(t.rows)
+			if k+1 < len(groups) {
+				next = groups[k+1]
+			}
+			for r := last; r < next; r++ {
+				need += ht[r]
+			}
+		}
+		top := fresh
+		if pdf.y+need > pdf.pageBreakTrigger && !fresh && accept() {
+			top = true
+			pdf.AddPageFormat(pdf.curOrientation, pdf.curPageSize)
+			if pdf.err != nil {
+				return
+			}
+			if !isHeader && header > 0 {
+				// repeated header rows are decoration for a screen reader
+				pdf.BeginArtifact()
+				for r := 0; r < header; r++ {
+					t.drawRow(pdf, x, wd, ht, r, starts[r], true, false)
+				}
+				pdf.EndArtifact()
+			}
+		}
+		if top && pdf.autoPageBreak && pdf.y+gh > pdf.pageBreakTrigger {
+			pdf.SetErrorf("table rows %d to %d do not fit on a page", first+1, last)
+			return
+		}
+		// only a table starting at the top of a page skips the first break
+		fresh = false
+		if tagged && !isHeader && !body {
+			if header > 0 {
+				pdf.BeginStructElem(StructTBody)
+			}
+			body = true
+		}
+		if tagged && isHeader {
+			pdf.BeginStructElem(StructTHead)
+		}
+		for r := first; r < last; r++ {
+			t.drawRow(pdf, x, wd, ht, r, starts[r], isHeader, tagged)
+		}
+		if tagged && isHeader {
+			pdf.EndStructElem()
+		}
+	}
+	if tagged {
+		if body && header > 0 {
+			pdf.EndStructElem()
+		}
+		pdf.EndStructElem()
+	}
+	pdf.x = pdf.lMargin
+}
+
+// drawRow draws the cells starting in a row and advances the current
+// position to the next row
+func (t *TableType) drawRow(pdf *Bdf, x float64, wd, ht []float64, row int, cells []*tableCellPos, header, tagged bool) {
+	family, sizePt := pdf.fontFamily, pdf.fontSizePt
+	y := pdf.y
+	if tagged {
+		pdf.BeginStructElem(StructTR)
+	}
+	type frame struct {
+		x, y, w, h float64
+		st         TableStyleType
+	}
+	var frames []frame
+	for _, pos := range cells {
+		cx := x
+		for k := 0; k < pos.col; k++ {
+			cx += wd[k]
+		}
+		var w, h float64
+		for k := pos.col; k < pos.col+pos.colSpan; k++ {
+			w += wd[k]
+		}
+		for r := pos.row; r < pos.row+pos.rowSpan; r++ {
+			h += ht[r]
+		}
+		st := pos.style
+		if pos.fill != nil {
+			pdf.SetFillColor(pos.fill.R, pos.fill.G, pos.fill.B)
+			pdf.BeginArtifact()
+			pdf.Rect(cx, y, w, h, "F")
+			pdf.EndArtifact()
+		}
+		if tagged {
+			role, opts := StructTD, StructOptions{}
+			if header {
+				role, opts.Scope = StructTH, "Column"
+			}
+			if pos.rowSpan > 1 {
+				opts.RowSpan = pos.rowSpan
+			}
+			if pos.colSpan > 1 {
+				opts.ColSpan = pos.colSpan
+			}
+			pdf.BeginStructElemOptions(role, opts)
+		}
+		tableApplyFont(pdf, st, family, sizePt)
+		pdf.SetTextColor(st.TextColor.R, st.TextColor.G, st.TextColor.B)
+		textHt := float64(len(pos.lines)) * pos.lineHt
+		ty := y + pos.pad
+		switch strings.ToUpper(st.VAlign) {
+		case "M":
+			ty = y + (h-textHt)/2
+		case "B":
+			ty = y + h - pos.pad - textHt
+		}
+		align := strings.ToUpper(pos.align)
+		if align != "C" && align != "R" {
+			align = "L"
+		}
+		for _, line := range pos.lines {
+			pdf.SetXY(cx+pos.pad, ty)
+			pdf.CellFormat(w-2*pos.pad, pos.lineHt, line, "", 0, align, false, 0, "")
+			ty += pos.lineHt
+		}
+		if tagged {
+			pdf.EndStructElem()
+		}
+		if st.Border != "" {
+			frames = append(frames, frame{cx, y, w, h, st})
+		}
+	}
+	if tagged {
+		pdf.EndStructElem()
+	}
+	// borders are drawn last so that they are not covered by the fill of an
+	// adjacent cell
+	if len(frames) > 0 {
+		lineWd := pdf.lineWidth
+		pdf.BeginArtifact()
+		for _, fr := range frames {
+			pdf.SetDrawColor(fr.st.BorderColor.R, fr.st.BorderColor.G, fr.st.BorderColor.B)
+			if fr.st.LineWidth > 0 {
+				pdf.SetLineWidth(fr.st.LineWidth)
+			} else {
+				pdf.SetLineWidth(lineWd)
+			}
+			border := strings.ToUpper(fr.st.Border)
+			if border == "1" {
+				pdf.Rect(fr.x, fr.y, fr.w, fr.h, "D")
+				continue
+			}
+			if strings.Contains(border, "L") {
+				pdf.Line(fr.x, fr.y, fr.x, fr.y+fr.h)
+			}
+			if strings.Contains(border, "T") {
+				pdf.Line(fr.x, fr.y, fr.x+fr.w, fr.y)
+			}
+			if strings.Contains(border, "R") {
+				pdf.Line(fr.x+fr.w, fr.y, fr.x+fr.w, fr.y+fr.h)
+			}
+			if strings.Contains(border, "B") {
+				pdf.Line(fr.x, fr.y+fr.h, fr.x+fr.w, fr.y+fr.h)
+			}
+		}
+		pdf.SetLineWidth(lineWd)
+		pdf.EndArtifact()
+	}
+	pdf.SetXY(x, y+ht[row])
+}
@@ -0,0 +1,189 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTableColumnWidths(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 10)
+	tbl := NewTable(TableColumnType{Width: 30}, TableColumnType{Percent: 25}, TableColumnType{}, TableColumnType{})
+	tbl.AddTextRow("a", "b", "short", "a much longer text")
+	cells, _ := tbl.place(pdf)
+	wd := tbl.columnWidths(pdf, 160, cells)
+	if pdf.Err() {
+		t.Fatal(pdf.Error())
+	}
+	if wd[0] != 30 || wd[1] != 40 {
+		t.Fatalf("fixed and percent widths: got %v", wd)
+	}
+	if math.Abs(wd[2]+wd[3]-90) > 1e-9 || wd[3] <= wd[2] {
+		t.Fatalf("automatic widths: got %v", wd)
+	}
+
+	tbl = NewTable(TableColumnType{Width: 120}, TableColumnType{Percent: 40}, TableColumnType{})
+	tbl.AddTextRow("a", "b", "c")
+	cells, _ = tbl.place(pdf)
+	tbl.columnWidths(pdf, 160, cells)
+	if !pdf.Err() {
+		t.Fatal("expected error for columns wider than the table")
+	}
+}
+
+func TestTableSpans(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 10)
+	tbl := NewTable(TableColumnType{}, TableColumnType{}, TableColumnType{})
+	tbl.AddRow(TableCellType{Text: "tall", RowSpan: 2}, TableCellType{Text: "wide", ColSpan: 2})
+	tbl.AddTextRow("b", "c")
+	tbl.AddTextRow("d", "e", "f")
+	cells, starts := tbl.place(pdf)
+	if pdf.Err() {
+		t.Fatal(pdf.Error())
+	}
+	if len(cells) != 7 || starts[1][0].col != 1 || starts[1][1].col != 2 {
+		t.Fatalf("unexpected placement of second row")
+	}
+	if g := tbl.groups(cells); fmt.Sprint(g) != "[0 2]" {
+		t.Fatalf("expected row groups [0 2], got %v", g)
+	}
+
+	tbl.AddTextRow("1", "2", "3", "4")
+	tbl.Draw(pdf)
+	if !pdf.Err() {
+		t.Fatal("expected error for a row with too many cells")
+	}
+}
+
+func TestTableRowSpanHeight(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 10)
+	tbl := NewTable(TableColumnType{Width: 20}, TableColumnType{Width: 20})
+	tbl.LineHeight = 5
+	tbl.BodyStyle.Padding = 1
+	tbl.AddRow(TableCellType{Text: "one\ntwo\nthree\nfour", RowSpan: 2}, TableCellType{Text: "x"})
+	tbl.AddTextRow("y")
+	cells, _ := tbl.place(pdf)
+	pdf.SetCellMargin(0)
+	ht := tbl.rowHeights(pdf, []float64{20, 20}, cells)
+	if ht[0] != 7 || ht[1] != 15 {
+		t.Fatalf("expected row heights [7 15], got %v", ht)
+	}
+}
+
+func TestTableDraw(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.SetFillColor(1, 2, 3)
+	tbl := NewTable(TableColumnType{Percent: 20}, TableColumnType{}, TableColumnType{Width: 30, Align: "R"})
+	tbl.HeaderRows = 1
+	tbl.ZebraFill = &RGBType{R: 230, G: 230, B: 230}
+	tbl.AddTextRow("Item", "Description", "Amount")
+	for j := 0; j < 120; j++ {
+		tbl.AddTextRow(fmt.Sprintf("Item %d", j),
+			strings.Repeat("wrapped description text ", 1+j%4), fmt.Sprintf("%d.00", j*10))
+	}
+	tbl.Draw(pdf)
+	if pdf.Err() {
+		t.Fatal(pdf.Error())
+	}
+	pages := pdf.PageNo()
+	if pages < 3 {
+		t.Fatalf("expected the table to span several pages, got %d", pages)
+	}
+	if r, g, b := pdf.GetFillColor(); r != 1 || g != 2 || b != 3 {
+		t.Fatalf("fill color was not restored")
+	}
+	if math.Abs(pdf.GetX()-pdf.lMargin) > 1e-9 || pdf.GetY() > 297 {
+		t.Fatalf("unexpected position after table: %.2f, %.2f", pdf.GetX(), pdf.GetY())
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if n := strings.Count(out, "(Description)"); n != pages {
+		t.Fatalf("expected the header on each of %d pages, found %d", pages, n)
+	}
+	if !strings.Contains(out, "0.902 g") {
+		t.Fatal("zebra fill not found")
+	}
+}
+
+func TestTableRowTooTall(t *testing.T) {
+	for _, first := range []bool{true, false} {
+		pdf := New("P", "mm", "A6", "")
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "", 10)
+		tbl := NewTable(TableColumnType{})
+		tbl.HeaderRows = 1
+		tbl.AddTextRow("Header")
+		if !first {
+			tbl.AddTextRow("Short row")
+		}
+		tbl.AddTextRow(strings.Repeat("line\n", 40))
+		tbl.Draw(pdf)
+		if pdf.Error() == nil {
+			t.Fatalf("first block %v: no error for a row taller than the page", first)
+		}
+	}
+}
+
+func TestTableTagged(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetTagged(true)
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 10)
+	tbl := NewTable(TableColumnType{}, TableColumnType{})
+	tbl.HeaderRows = 1
+	tbl.AddTextRow("Name", "Value")
+	for j := 0; j < 80; j++ {
+		tbl.AddRow(TableCellType{Text: fmt.Sprintf("row %d", j)}, TableCellType{Text: "v"})
+	}
+	tbl.Draw(pdf)
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{"/S /Table", "/S /THead", "/S /TBody", "/S /TH", "/S /TD", "/Scope /Column"} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("%s not found in output", s)
+		}
+	}
+	// the repeated header must not add structure elements
+	if n := len(regexp.MustCompile(`/S /TH\b`).FindAllString(out, -1)); n != 2 {
+		t.Fatalf("expected two TH elements, found %d", n)
+	}
+}
@@ -0,0 +1,523 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Standard structure types for tagged documents, as defined in the PDF
+// specification (section 14.8.4). Custom roles can be mapped onto these with
+// AddStructRole().
+const (
+	StructDocument   = "Document"
+	StructPart       = "Part"
+	StructArt        = "Art"
+	StructSect       = "Sect"
+	StructDiv        = "Div"
+	StructBlockQuote = "BlockQuote"
+	StructCaption    = "Caption"
+	StructTOC        = "TOC"
+	StructTOCI       = "TOCI"
+	StructP          = "P"
+	StructH1         = "H1"
+	StructH2         = "H2"
+	StructH3         = "H3"
+	StructH4         = "H4"
+	StructH5         = "H5"
+	StructH6         = "H6"
+	StructL          = "L"
+	StructLI         = "LI"
+	StructLbl        = "Lbl"
+	StructLBody      = "LBody"
+	StructTable      = "Table"
+	StructTHead      = "THead"
+	StructTBody      = "TBody"
+	StructTFoot      = "TFoot"
+	StructTR         = "TR"
+	StructTH         = "TH"
+	StructTD         = "TD"
+	StructSpan       = "Span"
+	StructLink       = "Link"
+	StructNote       = "Note"
+	StructCode       = "Code"
+	StructFigure     = "Figure"
+	StructFormula    = "Formula"
+	StructForm       = "Form"
+)
+
+// groupingRoles are structure types that hold other elements rather than
+// content. Text or images written while one of them is the innermost open
+// element are wrapped in an implicit P or Figure element.
+var groupingRoles = map[string]bool{
+	StructDocument: true, StructPart: true, StructArt: true, StructSect: true,
+	StructDiv: true, StructBlockQuote: true, StructTOC: true, StructL: true,
+	StructTable: true, StructTHead: true, StructTBody: true, StructTFoot: true,
+	StructTR: true,
+}
+
+// StructOptions holds the optional attributes of a structure element.
+type StructOptions struct {
+	Alt        string // alternate description, required for figures by PDF/UA
+	ActualText string // exact replacement text of the content
+	Lang       string // language of the element, for example "hi-IN"
+	Title      string // title of the element
+	Scope      string // scope of a TH cell: "Row", "Column" or "Both"
+	RowSpan    int    // number of rows spanned by a table cell
+	ColSpan    int    // number of columns spanned by a table cell
+}
+
+type structKidType struct {
+	elem       int // index of a child element or -1 for marked content
+	page, mcid int
+	annot      int // 1-based index of an annotation, 0 for marked content
+}
+
+// structAnnotType is a link annotation that belongs to a Link element
+type structAnnotType struct {
+	elem     int
+	contents string // alternate description of the link
+	objNum   int
+}
+
+// structParentType is an entry of the parent tree, either the marked content
+// of a page or an annotation. Its key is its index.
+type structParentType struct {
+	page  int
+	annot int // 1-based
+}
+
+type structElemType struct {
+	role   string
+	parent int
+	opts   StructOptions
+	kids   []structKidType
+}
+
+type structRecType struct {
+	enabled   bool
+	ua        bool
+	lang      string
+	elems     []structElemType // elems[0] is the Document element
+	stack     []int            // open elements, innermost last
+	pageMCIDs map[int][]int    // page -> owning element of each MCID
+	roleMap   map[string]string
+	artifact  int    // nesting level of BeginArtifact
+	imageAlt  string // alternate text for the next image
+	objNum    int    // object number of StructTreeRoot
+	annots    []structAnnotType
+	parents   []structParentType // parent tree, in the order pages are written
+}
+
+// SetTagged enables or disables the generation of a logical structure tree.
+// Tagged documents can be navigated by screen readers and reflowed by
+// document readers. Once enabled, text written with Cell(), MultiCell(),
+// Write() and Text() and images placed with Image() are recorded as marked
+// content of the innermost element opened with BeginStructElem(). Content
+// written outside of any element is wrapped in an implicit paragraph or
+// figure; each call creates its own element, so a paragraph built from
+// several Write() calls should be enclosed in an explicit StructP element.
+// Cell borders and backgrounds, headers and footers are marked as
+// artifacts.
+//
+// SetTagged should be called before the first page is added.
+func (f *Bdf) SetTagged(tagged bool) {
+	f.structTree.enabled = tagged
+	if tagged && len(f.structTree.elems) == 0 {
+		f.structTree.elems = []structElemType{{role: StructDocument, parent: -1}}
+		f.structTree.stack = []int{0}
+		f.structTree.pageMCIDs = make(map[int][]int)
+		f.structTree.roleMap = make(map[string]string)
+	}
+}
+
+// SetLang sets the natural language of the document, for example "en-US".
+// It is used by screen readers to select a pronunciation.
+func (f *Bdf) SetLang(lang string) {
+	f.structTree.lang = lang
+}
+
+// SetPDFUA enables PDF/UA (ISO 14289-1) mode. This implies SetTagged(true),
+// instructs readers to display the document title rather than the file name
+// and identifies the document as PDF/UA in its XMP metadata. A title set with
+// SetTitle() and a language set with SetLang() are required, and all fonts
+// must be embedded; core fonts cannot be used. These requirements are
+// checked when the document is closed.
+func (f *Bdf) SetPDFUA(ua bool) {
+	f.structTree.ua = ua
+	if ua {
+		f.SetTagged(true)
+	}
+}
+
+// AddStructRole maps a custom structure type onto a standard one. The custom
+// name can then be passed to BeginStructElem().
+func (f *Bdf) AddStructRole(customStr, standardStr string) {
+	if !f.structTree.enabled {
+		f.SetTagged(true)
+	}
+	f.structTree.roleMap[customStr] = standardStr
+}
+
+// BeginStructElem opens a structure element of the given role as a child of
+// the innermost open element. Every call must be matched by a call to
+// EndStructElem(). See the Struct* constants for the standard roles.
+func (f *Bdf) BeginStructElem(roleStr string) {
+	f.BeginStructElemOptions(roleStr, StructOptions{})
+}
+
+// BeginStructElemOptions opens a structure element like BeginStructElem() and
+// attaches the attributes in opts to it, for example the alternate text of a
+// figure or the span of a table cell.
+func (f *Bdf) BeginStructElemOptions(roleStr string, opts StructOptions) {
+	if f.err != nil {
+		return
+	}
+	if !f.structTree.enabled {
+		f.SetTagged(true)
+	}
+	st := &f.structTree
+	parent := st.stack[len(st.stack)-1]
+	idx := len(st.elems)
+	st.elems = append(st.elems, structElemType{role: roleStr, parent: parent, opts: opts})
+	st.elems[parent].kids = append(st.elems[parent].kids, structKidType{elem: idx})
+	st.stack = append(st.stack, idx)
+}
+
+// EndStructElem closes the innermost element opened with BeginStructElem().
+func (f *Bdf) EndStructElem() {
+	if f.err != nil {
+		return
+	}
+	if len(f.structTree.stack) < 2 {
+		f.err = fmt.Errorf("EndStructElem called without a matching BeginStructElem")
+		return
+	}
+	f.structTree.stack = f.structTree.stack[:len(f.structTree.stack)-1]
+}
+
+// BeginArtifact marks the following page content as an artifact, that is,
+// decoration such as rules, backgrounds or watermarks that is not part of the
+// logical content and is skipped by screen readers. Artifacts are limited to
+// the current page and must be closed with EndArtifact() before a new page
+// is started.
+func (f *Bdf) BeginArtifact() {
+	if f.structTree.enabled {
+		if f.structTree.artifact == 0 {
+			f.out("/Artifact BMC")
+		}
+		f.structTree.artifact++
+	}
+}
+
+// EndArtifact closes an artifact started with BeginArtifact().
+func (f *Bdf) EndArtifact() {
+	if f.structTree.artifact > 0 {
+		f.structTree.artifact--
+		if f.structTree.artifact == 0 {
+			f.out("EMC")
+		}
+	}
+}
+
+// structRole resolves a custom role through the role map
+func (f *Bdf) structRole(roleStr string) string {
+	for j := 0; j < 8; j++ {
+		std, ok := f.structTree.roleMap[roleStr]
+		if !ok {
+			break
+		}
+		roleStr = std
+	}
+	return roleStr
+}
+
+// structBeginImplicit opens an element of the given role when the innermost
+// open element only groups other elements, so that the lines written by a
+// single MultiCell() or Write() call form one element. It reports whether an
+// element was opened.
+func (f *Bdf) structBeginImplicit(roleStr string) bool {
+	st := &f.structTree
+	if !st.enabled || st.artifact > 0 || f.inHeader || f.inFooter {
+		return false
+	}
+	if !groupingRoles[f.structRole(st.elems[st.stack[len(st.stack)-1]].role)] {
+		return false
+	}
+	f.BeginStructElem(roleStr)
+	return true
+}
+
+// structMarkContent wraps page content operators into a marked-content
+// sequence attached to the structure tree. implicitRole is used to create an
+// element when the innermost open element only groups other elements.
+func (f *Bdf) structMarkContent(content, implicitRole string) string {
+	st := &f.structTree
+	if !st.enabled || content == "" || st.artifact > 0 {
+		return content
+	}
+	if f.inHeader || f.inFooter {
+		return "/Artifact <</Type /Pagination>> BDC " + content + " EMC"
+	}
+	elem := st.stack[len(st.stack)-1]
+	if groupingRoles[f.structRole(st.elems[elem].role)] {
+		var opts StructOptions
+		if implicitRole == StructFigure {
+			opts.Alt = st.imageAlt
+		}
+		idx := len(st.elems)
+		st.elems = append(st.elems, structElemType{role: implicitRole, parent: elem, opts: opts})
+		st.elems[elem].kids = append(st.elems[elem].kids, structKidType{elem: idx})
+		elem = idx
+	}
+	mcid := len(st.pageMCIDs[f.page])
+	st.pageMCIDs[f.page] = append(st.pageMCIDs[f.page], elem)
+	st.elems[elem].kids = append(st.elems[elem].kids, structKidType{elem: -1, page: f.page, mcid: mcid})
+	return sprintf("/%s <</MCID %d>> BDC %s EMC", f.structRole(st.elems[elem].role), mcid, content)
+}
+
+// structLink adds a link annotation to the structure tree and returns its
+// 1-based index, or 0 when the document is not tagged or the link is part of
+// an artifact. The annotation belongs to the innermost open element if that
+// is a Link element, otherwise to a new Link element.
+func (f *Bdf) structLink() int {
+	st := &f.structTree
+	if !st.enabled || st.artifact > 0 || f.inHeader || f.inFooter {
+		return 0
+	}
+	elem := st.stack[len(st.stack)-1]
+	if f.structRole(st.elems[elem].role) != StructLink {
+		idx := len(st.elems)
+		st.elems = append(st.elems, structElemType{role: StructLink, parent: elem})
+		st.elems[elem].kids = append(st.elems[elem].kids, structKidType{elem: idx})
+		elem = idx
+	}
+	st.annots = append(st.annots, structAnnotType{elem: elem, contents: st.imageAlt})
+	st.elems[elem].kids = append(st.elems[elem].kids, structKidType{elem: -1, page: f.page, annot: len(st.annots)})
+	return len(st.annots)
+}
+
+// structEnterLink makes the Link element of the last link annotation of the
+// current page the innermost open element, so that the text of the link is
+// part of it. txtStr describes the link. It reports whether the element was
+// entered; the caller then removes it from the stack.
+func (f *Bdf) structEnterLink(txtStr string) bool {
+	links := f.pageLinks[f.page]
+	if len(links) == 0 || links[len(links)-1].annot == 0 {
+		return false
+	}
+	st := &f.structTree
+	a := &st.annots[links[len(links)-1].annot-1]
+	if a.contents == "" {
+		a.contents = txtStr
+	}
+	st.stack = append(st.stack, a.elem)
+	return true
+}
+
+// structLinkCount returns the number of tagged link annotations of page n,
+// which are written as objects after the page content
+func (f *Bdf) structLinkCount(n int) (count int) {
+	for _, pl := range f.pageLinks[n] {
+		if pl.annot > 0 {
+			count++
+		}
+	}
+	return
+}
+
+// structPutAnnot returns the entries that attach the link annotation being
+// written, whose 1-based index is annot, to the structure tree. An external
+// link without text is described by its URL linkStr.
+func (f *Bdf) structPutAnnot(annot int, linkStr string) string {
+	st := &f.structTree
+	a := &st.annots[annot-1]
+	a.objNum = f.n
+	key := len(st.parents)
+	st.parents = append(st.parents, structParentType{annot: annot})
+	contents := a.contents
+	if contents == "" {
+		contents = linkStr
+	}
+	if contents == "" {
+		contents = "Link"
+	}
+	return sprintf("/StructParent %d /Contents %s", key, f.textstring(utf8toutf16(contents)))
+}
+
+// structMarkArtifact wraps decorative page content, such as cell borders and
+// backgrounds, as an artifact
+func (f *Bdf) structMarkArtifact(content string) string {
+	if !f.structTree.enabled || content == "" || f.structTree.artifact > 0 {
+		return content
+	}
+	return "/Artifact BMC " + content + " EMC"
+}
+
+func (f *Bdf) structEndDoc() {
+	st := &f.structTree
+	if !st.enabled {
+		return
+	}
+	if len(st.stack) > 1 {
+		f.err = fmt.Errorf("structure element %s was not closed", st.elems[st.stack[len(st.stack)-1]].role)
+		return
+	}
+	if st.ua {
+		if f.title == "" {
+			f.err = fmt.Errorf("PDF/UA requires a document title")
+			return
+		}
+		if st.lang == "" {
+			f.err = fmt.Errorf("PDF/UA requires a document language")
+			return
+		}
+		for _, font := range f.fonts {
+			if font.Tp == "Core" {
+				f.err = fmt.Errorf("PDF/UA requires embedded fonts; core font %s cannot be used", font.Name)
+				return
+			}
+		}
+	}
+	if f.pdfVersion < "1.5" {
+		f.pdfVersion = "1.5"
+	}
+}
+
+func (f *Bdf) structPutPage(n int) {
+	st := &f.structTree
+	if st.enabled {
+		f.outf("/StructParents %d", len(st.parents))
+		st.parents = append(st.parents, structParentType{page: n})
+		f.out("/Tabs /S")
+	}
+}
+
+// structPutTree writes the structure elements followed by the structure
+// tree root. The page objects must already have been written.
+func (f *Bdf) structPutTree() {
+	st := &f.structTree
+	if !st.enabled {
+		return
+	}
+	first := f.n + 1
+	rootNum := first + len(st.elems)
+	for _, e := range st.elems {
+		f.newobj()
+		var s fmtBuffer
+		s.printf("<</Type /StructElem /S /%s", e.role)
+		if e.parent < 0 {
+			s.printf(" /P %d 0 R", rootNum)
+		} else {
+			s.printf(" /P %d 0 R", first+e.parent)
+		}
+		s.printf(" /K [")
+		for _, k := range e.kids {
+			if k.elem >= 0 {
+				s.printf("%d 0 R ", first+k.elem)
+			} else if k.annot > 0 {
+				s.printf("<</Type /OBJR /Obj %d 0 R /Pg %d 0 R>> ", st.annots[k.annot-1].objNum, f.pageObjNums[k.page])
+			} else {
+				s.printf("<</Type /MCR /Pg %d 0 R /MCID %d>> ", f.pageObjNums[k.page], k.mcid)
+			}
+		}
+		s.printf("]")
+		if e.opts.Alt != "" {
+			s.printf(" /Alt %s", f.textstring(utf8toutf16(e.opts.Alt)))
+		}
+		if e.opts.ActualText != "" {
+			s.printf(" /ActualText %s", f.textstring(utf8toutf16(e.opts.ActualText)))
+		}
+		if e.opts.Title != "" {
+			s.printf(" /T %s", f.textstring(utf8toutf16(e.opts.Title)))
+		}
+		if e.opts.Lang != "" {
+			s.printf(" /Lang %s", f.textstring(e.opts.Lang))
+		}
+		if e.opts.Scope != "" || e.opts.RowSpan > 1 || e.opts.ColSpan > 1 {
+			s.printf(" /A <</O /Table")
+			if e.opts.Scope != "" {
+				s.printf(" /Scope /%s", e.opts.Scope)
+			}
+			if e.opts.RowSpan > 1 {
+				s.printf(" /RowSpan %d", e.opts.RowSpan)
+			}
+			if e.opts.ColSpan > 1 {
+				s.printf(" /ColSpan %d", e.opts.ColSpan)
+			}
+			s.printf(">>")
+		}
+		s.printf(">>")
+		f.out(s.String())
+		f.out("endobj")
+	}
+	f.newobj()
+	st.objNum = f.n
+	f.out("<</Type /StructTreeRoot")
+	f.outf("/K [%d 0 R]", first)
+	var nums fmtBuffer
+	nums.printf("/ParentTree <</Nums [")
+	for key, p := range st.parents {
+		if p.annot > 0 {
+			nums.printf("%d %d 0 R ", key, first+st.annots[p.annot-1].elem)
+			continue
+		}
+		nums.printf("%d [", key)
+		for _, elem := range st.pageMCIDs[p.page] {
+			nums.printf("%d 0 R ", first+elem)
+		}
+		nums.printf("] ")
+	}
+	nums.printf("]>>")
+	f.out(nums.String())
+	f.outf("/ParentTreeNextKey %d", len(st.parents))
+	if len(st.roleMap) > 0 {
+		keys := make([]string, 0, len(st.roleMap))
+		for k := range st.roleMap {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var rm []string
+		for _, k := range keys {
+			rm = append(rm, sprintf("/%s /%s", k, st.roleMap[k]))
+		}
+		f.outf("/RoleMap <<%s>>", strings.Join(rm, " "))
+	}
+	f.out(">>")
+	f.out("endobj")
+}
+
+func (f *Bdf) structPutCatalog() {
+	st := &f.structTree
+	if st.lang != "" {
+		f.outf("/Lang %s", f.textstring(st.lang))
+	}
+	if !st.enabled {
+		return
+	}
+	f.out("/MarkInfo <</Marked true>>")
+	f.outf("/StructTreeRoot %d 0 R", st.objNum)
+	if st.ua {
+		f.out("/ViewerPreferences <</DisplayDocTitle true>>")
+	}
+}
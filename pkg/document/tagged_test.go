@@ -0,0 +1,155 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// testPNG returns a small PNG image for use by tests
+func testPNG(t *testing.T) []byte {
+	m := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for j := range m.Pix {
+		m.Pix[j] = 0x80
+	}
+	m.Set(2, 2, color.RGBA{0xff, 0, 0, 0xff})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTaggedOutput(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetPDFUA(true)
+	pdf.SetTitle("Quarterly report", true)
+	pdf.SetLang("en-IN")
+	pdf.AddUTF8FontFromBytes("go", "", goregular.TTF)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.CellFormat(0, 10, "page", "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+	pdf.SetFont("go", "", 12)
+	pdf.BeginStructElem(StructH1)
+	pdf.Cell(0, 10, "Summary")
+	pdf.EndStructElem()
+	pdf.Ln(10)
+	pdf.MultiCell(0, 6, "Plain text becomes an implicit paragraph.", "1", "L", false)
+	pdf.AddStructRole("Amount", StructSpan)
+	pdf.BeginStructElem(StructTable)
+	pdf.BeginStructElem(StructTR)
+	pdf.BeginStructElemOptions(StructTH, StructOptions{Scope: "Column"})
+	pdf.CellFormat(40, 6, "Item", "1", 0, "", false, 0, "")
+	pdf.EndStructElem()
+	pdf.BeginStructElem(StructTD)
+	pdf.BeginStructElem("Amount")
+	pdf.CellFormat(40, 6, "100", "1", 1, "", false, 0, "")
+	pdf.EndStructElem()
+	pdf.EndStructElem()
+	pdf.EndStructElem()
+	pdf.EndStructElem()
+	pdf.RegisterImageOptionsReader("dot", ImageOptions{ImageType: "png"}, bytes.NewReader(testPNG(t)))
+	pdf.ImageOptions("dot", 10, 80, 10, 10, false, ImageOptions{AltText: "A red dot"}, 0, "")
+	pdf.SetXY(10, 100)
+	pdf.BeginStructElem(StructP)
+	pdf.Write(6, "See ")
+	pdf.WriteLinkString(6, "the website", "https://example.com")
+	pdf.EndStructElem()
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"/StructTreeRoot",
+		"/MarkInfo <</Marked true>>",
+		"/Lang (en-IN)",
+		"/DisplayDocTitle true",
+		"/StructParents 0",
+		"/H1 <</MCID 0>> BDC",
+		"/S /Figure",
+		"/Alt (\xfe\xff",
+		"/A <</O /Table /Scope /Column>>",
+		"/RoleMap <</Amount /Span>>",
+		"/Artifact <</Type /Pagination>> BDC",
+		"/Artifact BMC",
+		"<pdfuaid:part>1</pdfuaid:part>",
+		"/Metadata ",
+		"/S /Link",
+		"/StructParent 1 /Contents (\xfe\xff\x00t\x00h\x00e",
+		"/ParentTreeNextKey 2",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q", want)
+		}
+	}
+	// The Link element refers to the annotation object, which is listed in
+	// the annotations of the page
+	m := regexp.MustCompile(`<</Type /OBJR /Obj (\d+) 0 R /Pg \d+ 0 R>>`).FindStringSubmatch(out)
+	if m == nil {
+		t.Fatal("object reference to the link annotation not found")
+	}
+	if !strings.Contains(out, "/Annots ["+m[1]+" 0 R ]") {
+		t.Errorf("link annotation %s is not listed by its page", m[1])
+	}
+	if !strings.Contains(out, "\n"+m[1]+" 0 obj\n<</Type /Annot /Subtype /Link") {
+		t.Errorf("object %s is not the link annotation", m[1])
+	}
+}
+
+func TestTaggedErrors(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetPDFUA(true)
+	pdf.AddPage()
+	if err := pdf.Output(&bytes.Buffer{}); err == nil {
+		t.Fatal("expected an error for a PDF/UA document without title")
+	}
+
+	pdf = New("P", "mm", "A4", "")
+	pdf.SetPDFUA(true)
+	pdf.SetTitle("Report", true)
+	pdf.SetLang("en")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 12)
+	if err := pdf.Output(&bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "embedded fonts") {
+		t.Fatalf("expected an error for a core font in a PDF/UA document, got %v", err)
+	}
+
+	pdf = New("P", "mm", "A4", "")
+	pdf.SetTagged(true)
+	pdf.AddPage()
+	pdf.BeginStructElem(StructP)
+	if err := pdf.Output(&bytes.Buffer{}); err == nil {
+		t.Fatal("expected an error for an unclosed structure element")
+	}
+}
@@ -108,7 +108,7 @@ func (f *Bdf) UseTemplateScaled(t Template, corner PointType, size SizeType) {
 	scaleX := size.Wd / templateSize.Wd
 	scaleY := size.Ht / templateSize.Ht
 	tx := corner.X * f.k
-	ty := (f.curPageSize.Ht - corner.Y - size.Ht) * f.k
+	ty := (f.h - corner.Y - size.Ht) * f.k
 
 	f.outf("q %.4f 0 0 %.4f %.4f %.4f cm", scaleX, scaleY, tx, ty) // Translate
 	f.outf("/TPL%s Do Q", t.ID())
@@ -157,6 +157,10 @@ func (f *Bdf) putTemplates() {
 	templates := sortTemplates(f.templates, f.catalogSort)
 	var t Template
 	for _, t = range templates {
+		if p, ok := t.(*ImportedPage); ok {
+			f.putImportedPage(p)
+			continue
+		}
 		corner, size := t.Size()
 
 		f.newobj()
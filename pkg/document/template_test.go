@@ -0,0 +1,45 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUseTemplateLandscape(t *testing.T) {
+	pdf := New("L", "mm", "A4", "")
+	tpl := pdf.CreateTemplateCustom(PointType{}, SizeType{Wd: 50, Ht: 30}, func(tpl *Tpl) {
+		tpl.Rect(0, 0, 50, 30, "D")
+	})
+	pdf.AddPage()
+	pdf.UseTemplateScaled(tpl, PointType{X: 10, Y: 20}, SizeType{Wd: 50, Ht: 30})
+	if err := pdf.Error(); err != nil {
+		t.Fatal(err)
+	}
+	// the position is measured from the top of the landscape page, whose
+	// height is the short side of A4
+	want := fmt.Sprintf("q 1.0000 0 0 1.0000 %.4f %.4f cm", 10*pdf.k, (pdf.defPageSize.Wd-50)*pdf.k)
+	if !strings.Contains(pdf.pages[1].String(), want) {
+		t.Fatalf("%q not found in page content", want)
+	}
+}
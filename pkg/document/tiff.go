@@ -0,0 +1,631 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// TIFF images, embedded page by page
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/image/ccitt"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/tiff/lzw"
+)
+
+// TIFF compression schemes
+const (
+	tiffNone     = 1
+	tiffHuffman  = 2
+	tiffG3       = 3
+	tiffG4       = 4
+	tiffLZW      = 5
+	tiffDeflate  = 8
+	tiffPackBits = 32773
+	tiffFlateOld = 32946
+)
+
+// tiffIFD holds the fields of a TIFF image file directory that are needed to
+// embed the image it describes
+type tiffIFD struct {
+	width, height   int
+	bps, spp        int
+	compression     int
+	photometric     int
+	predictor       int
+	planar          int
+	fillOrder       int
+	rowsPerStrip    int
+	t4Options       int
+	inkSet          int
+	resUnit         int
+	xres, yres      float64
+	offsets, counts []int
+	colorMap        []int
+	extraSamples    []int
+	tiled           bool
+	icc             []byte
+}
+
+// tiffFile is a parsed TIFF file with one directory per page
+type tiffFile struct {
+	data  []byte
+	order binary.ByteOrder
+	pages []tiffIFD
+}
+
+// tiffTypeSize gives the size in bytes of the TIFF field types used here
+var tiffTypeSize = map[int]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+func parseTIFF(data []byte) (t *tiffFile, err error) {
+	t = &tiffFile{data: data}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("not a TIFF buffer")
+	}
+	switch string(data[:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF buffer")
+	}
+	seen := make(map[int]bool)
+	for pos := int(t.order.Uint32(data[4:])); pos != 0; {
+		if seen[pos] || pos+2 > len(data) {
+			return nil, fmt.Errorf("incorrect TIFF directory offset %d", pos)
+		}
+		seen[pos] = true
+		var ifd tiffIFD
+		if pos, err = t.readIFD(pos, &ifd); err != nil {
+			return nil, err
+		}
+		t.pages = append(t.pages, ifd)
+	}
+	if len(t.pages) == 0 {
+		return nil, fmt.Errorf("TIFF buffer contains no image")
+	}
+	return t, nil
+}
+
+// readIFD reads the directory at pos into ifd and returns the offset of the
+// next directory
+func (t *tiffFile) readIFD(pos int, ifd *tiffIFD) (next int, err error) {
+	*ifd = tiffIFD{bps: 1, spp: 1, compression: tiffNone, photometric: -1, predictor: 1,
+		planar: 1, fillOrder: 1, resUnit: 2}
+	n := int(t.order.Uint16(t.data[pos:]))
+	pos += 2
+	if pos+n*12+4 > len(t.data) {
+		return 0, fmt.Errorf("TIFF directory is truncated")
+	}
+	for j := 0; j < n; j, pos = j+1, pos+12 {
+		tag := int(t.order.Uint16(t.data[pos:]))
+		if tag == 34675 {
+			// ICC profile, stored as undefined bytes
+			ifd.icc = t.bytes(pos)
+			continue
+		}
+		vals, err := t.values(pos)
+		if err != nil {
+			return 0, err
+		}
+		if len(vals) == 0 {
+			continue
+		}
+		switch tag {
+		case 256:
+			ifd.width = int(vals[0])
+		case 257:
+			ifd.height = int(vals[0])
+		case 258:
+			ifd.bps = int(vals[0])
+		case 259:
+			ifd.compression = int(vals[0])
+		case 262:
+			ifd.photometric = int(vals[0])
+		case 266:
+			ifd.fillOrder = int(vals[0])
+		case 273:
+			ifd.offsets = tiffInts(vals)
+		case 277:
+			ifd.spp = int(vals[0])
+		case 278:
+			ifd.rowsPerStrip = int(vals[0])
+		case 279:
+			ifd.counts = tiffInts(vals)
+		case 282:
+			ifd.xres = vals[0]
+		case 283:
+			ifd.yres = vals[0]
+		case 284:
+			ifd.planar = int(vals[0])
+		case 292:
+			ifd.t4Options = int(vals[0])
+		case 296:
+			ifd.resUnit = int(vals[0])
+		case 317:
+			ifd.predictor = int(vals[0])
+		case 320:
+			ifd.colorMap = tiffInts(vals)
+		case 322, 323, 324, 325:
+			ifd.tiled = true
+		case 332:
+			ifd.inkSet = int(vals[0])
+		case 338:
+			ifd.extraSamples = tiffInts(vals)
+		}
+	}
+	if ifd.rowsPerStrip <= 0 || ifd.rowsPerStrip > ifd.height {
+		ifd.rowsPerStrip = ifd.height
+	}
+	return int(t.order.Uint32(t.data[pos:])), nil
+}
+
+// values returns the numeric values of the directory entry at pos; rationals
+// are divided out
+func (t *tiffFile) values(pos int) (vals []float64, err error) {
+	tp := int(t.order.Uint16(t.data[pos+2:]))
+	count := int(t.order.Uint32(t.data[pos+4:]))
+	size, ok := tiffTypeSize[tp]
+	if !ok || tp == 2 || tp == 7 {
+		return nil, nil
+	}
+	at := pos + 8
+	if size*count > 4 {
+		at = int(t.order.Uint32(t.data[pos+8:]))
+	}
+	if count < 0 || at < 0 || at+size*count > len(t.data) {
+		return nil, fmt.Errorf("TIFF field value is out of range")
+	}
+	vals = make([]float64, count)
+	for j := range vals {
+		p := t.data[at+j*size:]
+		switch tp {
+		case 1:
+			vals[j] = float64(p[0])
+		case 6:
+			vals[j] = float64(int8(p[0]))
+		case 3:
+			vals[j] = float64(t.order.Uint16(p))
+		case 8:
+			vals[j] = float64(int16(t.order.Uint16(p)))
+		case 4:
+			vals[j] = float64(t.order.Uint32(p))
+		case 9:
+			vals[j] = float64(int32(t.order.Uint32(p)))
+		case 5:
+			if d := t.order.Uint32(p[4:]); d != 0 {
+				vals[j] = float64(t.order.Uint32(p)) / float64(d)
+			}
+		case 10:
+			if d := int32(t.order.Uint32(p[4:])); d != 0 {
+				vals[j] = float64(int32(t.order.Uint32(p))) / float64(d)
+			}
+		}
+	}
+	return
+}
+
+// bytes returns the raw value of the byte or undefined directory entry at
+// pos, or nil if it is out of range
+func (t *tiffFile) bytes(pos int) []byte {
+	tp := int(t.order.Uint16(t.data[pos+2:]))
+	count := int(t.order.Uint32(t.data[pos+4:]))
+	if (tp != 1 && tp != 7) || count < 0 {
+		return nil
+	}
+	at := pos + 8
+	if count > 4 {
+		at = int(t.order.Uint32(t.data[pos+8:]))
+	}
+	if at < 0 || at+count > len(t.data) {
+		return nil
+	}
+	return t.data[at : at+count]
+}
+
+func tiffInts(vals []float64) []int {
+	list := make([]int, len(vals))
+	for j, v := range vals {
+		list[j] = int(v)
+	}
+	return list
+}
+
+// TIFFPageCount returns the number of pages of the TIFF image read from r.
+// Each page can be placed with ImageOptions() by setting the Page field of
+// ImageOptions.
+func TIFFPageCount(r io.Reader) (n int, err error) {
+	var data []byte
+	if data, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+	var t *tiffFile
+	if t, err = parseTIFF(data); err != nil {
+		return
+	}
+	return len(t.pages), nil
+}
+
+// parsetiff extracts info from the given page of TIFF data. Bilevel pages
+// coded with CCITT Group 3 or 4 and single strip pages compressed with Flate
+// or LZW are embedded as they are; other pages are decoded and recompressed.
+func (f *Bdf) parsetiff(r io.Reader, page int, readdpi bool) (info *ImageInfoType) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		f.err = err
+		return
+	}
+	t, err := parseTIFF(data)
+	if err != nil {
+		f.err = err
+		return
+	}
+	if page < 1 {
+		page = 1
+	}
+	if page > len(t.pages) {
+		f.err = fmt.Errorf("TIFF image has no page %d, only %d", page, len(t.pages))
+		return
+	}
+	ifd := &t.pages[page-1]
+	info = f.newImageInfo()
+	if readdpi && ifd.xres > 0 && ifd.xres == ifd.yres {
+		switch ifd.resUnit {
+		case 2:
+			info.dpi = ifd.xres
+		case 3:
+			info.dpi = ifd.xres * 2.54
+		}
+	}
+	colors := 0
+	switch ifd.photometric {
+	case 0, 1:
+		info.cs, colors = "DeviceGray", 1
+	case 2:
+		info.cs, colors = "DeviceRGB", 3
+	case 3:
+		info.cs, colors = "Indexed", 1
+	case 5:
+		if ifd.inkSet <= 1 && ifd.spp >= 4 {
+			info.cs, colors = "DeviceCMYK", 4
+		}
+	}
+	supported := colors > 0 && !ifd.tiled && ifd.spp >= colors && ifd.width > 0 && ifd.height > 0 &&
+		(ifd.planar == 1 || ifd.spp == 1) && len(ifd.offsets) > 0 && len(ifd.offsets) == len(ifd.counts)
+	switch ifd.bps {
+	case 1, 2, 4, 8, 16:
+	default:
+		supported = false
+	}
+	switch ifd.compression {
+	case tiffNone, tiffHuffman, tiffG3, tiffG4, tiffLZW, tiffDeflate, tiffPackBits, tiffFlateOld:
+	default:
+		supported = false
+	}
+	if !supported {
+		// Fall back to the general decoder, which reads the first page only
+		if page > 1 {
+			f.err = fmt.Errorf("unsupported TIFF image on page %d", page)
+			return
+		}
+		var img image.Image
+		if img, err = tiff.Decode(bytes.NewReader(data)); err != nil {
+			f.err = err
+			return
+		}
+		pngBuf := new(bytes.Buffer)
+		if err = png.Encode(pngBuf, img); err != nil {
+			f.err = err
+			return
+		}
+		dpi := info.dpi
+		info = f.parsepngstream(&rbuffer{p: pngBuf.Bytes()}, false)
+		info.dpi = dpi
+		info.icc = ifd.icc
+		return
+	}
+	info.w = float64(ifd.width)
+	info.h = float64(ifd.height)
+	info.bpc = ifd.bps
+	if ifd.photometric == 3 {
+		info.pal = tiffPalette(ifd.colorMap, ifd.bps)
+		if len(info.pal) == 0 {
+			f.err = fmt.Errorf("missing color map in TIFF image")
+			return
+		}
+	}
+	info.icc = ifd.icc
+	switch ifd.compression {
+	case tiffHuffman, tiffG3, tiffG4:
+		f.tiffFax(t, ifd, info)
+	default:
+		f.tiffSamples(t, ifd, info, colors)
+	}
+	return
+}
+
+// strip returns the bytes of strip j of ifd
+func (t *tiffFile) strip(ifd *tiffIFD, j int) ([]byte, error) {
+	off, n := ifd.offsets[j], ifd.counts[j]
+	if off < 0 || n < 0 || off+n > len(t.data) {
+		return nil, fmt.Errorf("TIFF strip %d is out of range", j)
+	}
+	return t.data[off : off+n], nil
+}
+
+// tiffFax embeds a bilevel page coded with CCITT Group 3 or 4. A single strip
+// in the default bit order is passed through; otherwise the strips are decoded
+// and the bitmap is recompressed.
+func (f *Bdf) tiffFax(t *tiffFile, ifd *tiffIFD, info *ImageInfoType) {
+	if ifd.bps != 1 || ifd.spp != 1 {
+		f.err = fmt.Errorf("CCITT compressed TIFF image must be bilevel")
+		return
+	}
+	info.cs = "DeviceGray"
+	info.pal = nil
+	if len(ifd.offsets) == 1 && ifd.fillOrder != 2 {
+		data, err := t.strip(ifd, 0)
+		if err != nil {
+			f.err = err
+			return
+		}
+		info.data = data
+		info.f = "CCITTFaxDecode"
+		switch ifd.compression {
+		case tiffG4:
+			info.dp = sprintf("/K -1 /Columns %d /Rows %d", ifd.width, ifd.height)
+		case tiffG3:
+			k := 0
+			if ifd.t4Options&1 != 0 {
+				k = ifd.height
+			}
+			info.dp = sprintf("/K %d /Columns %d /Rows %d /EndOfLine true", k, ifd.width, ifd.height)
+			if ifd.t4Options&4 != 0 {
+				info.dp += " /EncodedByteAlign true"
+			}
+		default:
+			info.dp = sprintf("/K 0 /Columns %d /Rows %d /EncodedByteAlign true", ifd.width, ifd.height)
+		}
+		return
+	}
+	if ifd.compression == tiffHuffman || ifd.compression == tiffG3 && ifd.t4Options&1 != 0 {
+		f.err = fmt.Errorf("unsupported CCITT coding in multi-strip TIFF image")
+		return
+	}
+	order, sf := ccitt.MSB, ccitt.Group4
+	if ifd.fillOrder == 2 {
+		order = ccitt.LSB
+	}
+	if ifd.compression == tiffG3 {
+		sf = ccitt.Group3
+	}
+	var bitmap []byte
+	for j := range ifd.offsets {
+		data, err := t.strip(ifd, j)
+		if err != nil {
+			f.err = err
+			return
+		}
+		rows := ifd.rowsPerStrip
+		if rest := ifd.height - j*ifd.rowsPerStrip; rest < rows {
+			rows = rest
+		}
+		if rows <= 0 {
+			break
+		}
+		// The decoder writes white as 1, the default for DeviceGray
+		rd := ccitt.NewReader(bytes.NewReader(data), order, sf, ifd.width, rows, nil)
+		buf, err := ioutil.ReadAll(rd)
+		if err != nil {
+			f.err = err
+			return
+		}
+		bitmap = append(bitmap, buf...)
+	}
+	f.tiffCompress(info, bitmap, 1, (ifd.width+7)/8, ifd.height)
+}
+
+// tiffSamples embeds an uncompressed, PackBits, LZW or Flate compressed page
+func (f *Bdf) tiffSamples(t *tiffFile, ifd *tiffIFD, info *ImageInfoType, colors int) {
+	bigEndian := t.order == binary.BigEndian
+	if ifd.photometric == 0 {
+		// WhiteIsZero
+		info.dcd = "[1 0]"
+	}
+	alpha := len(ifd.extraSamples) > 0 && (ifd.extraSamples[0] == 1 || ifd.extraSamples[0] == 2)
+	if ifd.bps == 16 && f.pdfVersion < "1.5" {
+		f.pdfVersion = "1.5"
+	}
+	if len(ifd.offsets) == 1 && ifd.spp == colors && (ifd.bps < 16 || bigEndian) &&
+		(ifd.predictor == 1 || ifd.predictor == 2) {
+		filter := ""
+		switch ifd.compression {
+		case tiffLZW:
+			filter = "LZWDecode"
+		case tiffDeflate, tiffFlateOld:
+			filter = "FlateDecode"
+		}
+		data, err := t.strip(ifd, 0)
+		if err != nil {
+			f.err = err
+			return
+		}
+		if filter != "" && !(filter == "LZWDecode" && len(data) > 1 && data[0] == 0 && data[1]&1 != 0) {
+			info.data = data
+			info.f = filter
+			if ifd.predictor == 2 {
+				info.dp = sprintf("/Predictor 2 /Colors %d /BitsPerComponent %d /Columns %d",
+					colors, ifd.bps, ifd.width)
+			}
+			return
+		}
+	}
+	// Decode the strips into packed rows of samples
+	rowLen := (ifd.width*ifd.spp*ifd.bps + 7) / 8
+	var raw []byte
+	for j := range ifd.offsets {
+		data, err := t.strip(ifd, j)
+		if err != nil {
+			f.err = err
+			return
+		}
+		var rd io.Reader = bytes.NewReader(data)
+		switch ifd.compression {
+		case tiffLZW:
+			lr := lzw.NewReader(rd, lzw.MSB, 8)
+			defer lr.Close()
+			rd = lr
+		case tiffDeflate, tiffFlateOld:
+			if rd, err = zlib.NewReader(rd); err != nil {
+				f.err = err
+				return
+			}
+		case tiffPackBits:
+			rd = bytes.NewReader(unpackBits(data))
+		}
+		buf, err := ioutil.ReadAll(rd)
+		if err != nil && len(buf) == 0 {
+			f.err = err
+			return
+		}
+		// Strips are padded to complete rows
+		if rows := len(buf) / rowLen; rows > ifd.rowsPerStrip {
+			buf = buf[:ifd.rowsPerStrip*rowLen]
+		}
+		raw = append(raw, buf...)
+	}
+	if len(raw) < rowLen*ifd.height {
+		f.err = fmt.Errorf("TIFF image data is truncated")
+		return
+	}
+	raw = raw[:rowLen*ifd.height]
+	if ifd.bps == 16 && !bigEndian {
+		for j := 0; j+1 < len(raw); j += 2 {
+			raw[j], raw[j+1] = raw[j+1], raw[j]
+		}
+	}
+	if ifd.predictor == 2 {
+		tiffUndoPredictor(raw, rowLen, ifd.spp, ifd.bps)
+	}
+	if ifd.spp > colors {
+		if ifd.bps < 8 {
+			f.err = fmt.Errorf("extra samples in TIFF image need 8 or 16 bits per sample")
+			return
+		}
+		// Keep the color samples and the associated or unassociated alpha
+		size := ifd.bps / 8
+		keep := colors
+		if alpha {
+			keep++
+		}
+		pixels := make([]byte, 0, ifd.width*ifd.height*keep*size)
+		for pos := 0; pos+ifd.spp*size <= len(raw); pos += ifd.spp * size {
+			pixels = append(pixels, raw[pos:pos+keep*size]...)
+		}
+		raw = pixels
+		if alpha {
+			raw, info.smask = pngSplitAlpha(pixels, ifd.width, ifd.height, colors, ifd.bps)
+			if f.pdfVersion < "1.4" {
+				f.pdfVersion = "1.4"
+			}
+		}
+		rowLen = ifd.width * colors * size
+	}
+	f.tiffCompress(info, raw, colors, rowLen, ifd.height)
+}
+
+// tiffCompress stores decoded rows of samples in info as Flate compressed data
+// with the PNG predictor, like the color data of PNG images
+func (f *Bdf) tiffCompress(info *ImageInfoType, raw []byte, colors, rowLen, height int) {
+	if len(raw) < rowLen*height {
+		f.err = fmt.Errorf("TIFF image data is truncated")
+		return
+	}
+	mem := xmem.compress(pngRows(raw[:rowLen*height], rowLen))
+	info.data = mem.copy()
+	mem.release()
+	info.f = "FlateDecode"
+	info.dp = sprintf("/Predictor 15 /Colors %d /BitsPerComponent %d /Columns %d", colors, info.bpc, int(info.w))
+}
+
+// tiffUndoPredictor reverses horizontal differencing in rows of big-endian
+// samples
+func tiffUndoPredictor(raw []byte, rowLen, spp, bps int) {
+	for row := 0; row+rowLen <= len(raw); row += rowLen {
+		line := raw[row : row+rowLen]
+		switch bps {
+		case 8:
+			for j := spp; j < len(line); j++ {
+				line[j] += line[j-spp]
+			}
+		case 16:
+			for j := 2 * spp; j+1 < len(line); j += 2 {
+				v := binary.BigEndian.Uint16(line[j:]) + binary.BigEndian.Uint16(line[j-2*spp:])
+				binary.BigEndian.PutUint16(line[j:], v)
+			}
+		}
+	}
+}
+
+// tiffPalette converts a TIFF color map of 16-bit red, green and blue tables
+// into the RGB palette of an indexed image
+func tiffPalette(colorMap []int, bps int) []byte {
+	n := 1 << uint(bps)
+	if len(colorMap) < 3*n {
+		return nil
+	}
+	pal := make([]byte, 0, 3*n)
+	for j := 0; j < n; j++ {
+		pal = append(pal, byte(colorMap[j]>>8), byte(colorMap[n+j]>>8), byte(colorMap[2*n+j]>>8))
+	}
+	return pal
+}
+
+// unpackBits expands PackBits run-length encoded data
+func unpackBits(data []byte) []byte {
+	var out []byte
+	for pos := 0; pos < len(data); {
+		n := int(int8(data[pos]))
+		pos++
+		switch {
+		case n >= 0:
+			end := pos + n + 1
+			if end > len(data) {
+				end = len(data)
+			}
+			out = append(out, data[pos:end]...)
+			pos = end
+		case n != -128 && pos < len(data):
+			for j := 0; j < 1-n; j++ {
+				out = append(out, data[pos])
+			}
+			pos++
+		}
+	}
+	return out
+}
@@ -0,0 +1,169 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"sort"
+	"testing"
+)
+
+// tiffTestPage describes a page of a TIFF file built for testing
+type tiffTestPage struct {
+	tags   map[int][]int
+	strips [][]byte
+}
+
+// tiffTestFile builds a big-endian TIFF file with one directory per page;
+// the strip offsets and byte counts are filled in from the strips
+func tiffTestFile(pages []tiffTestPage) []byte {
+	var out bytes.Buffer
+	out.WriteString("MM\x00*")
+	u32 := func(v int) { binary.Write(&out, binary.BigEndian, uint32(v)) }
+	u16 := func(v int) { binary.Write(&out, binary.BigEndian, uint16(v)) }
+	next := out.Len()
+	u32(0)
+	for _, page := range pages {
+		var offsets, counts []int
+		for _, s := range page.strips {
+			offsets = append(offsets, out.Len())
+			counts = append(counts, len(s))
+			out.Write(s)
+		}
+		tags := map[int][]int{273: offsets, 279: counts}
+		for tag, vals := range page.tags {
+			tags[tag] = vals
+		}
+		// values that do not fit into an entry come first
+		external := make(map[int]int)
+		for tag, vals := range tags {
+			if len(vals) > 1 {
+				external[tag] = out.Len()
+				for _, v := range vals {
+					u32(v)
+				}
+			}
+		}
+		if out.Len()%2 != 0 {
+			out.WriteByte(0)
+		}
+		binary.BigEndian.PutUint32(out.Bytes()[next:], uint32(out.Len()))
+		var keys []int
+		for tag := range tags {
+			keys = append(keys, tag)
+		}
+		sort.Ints(keys)
+		u16(len(keys))
+		for _, tag := range keys {
+			u16(tag)
+			u16(4)
+			u32(len(tags[tag]))
+			if pos, ok := external[tag]; ok {
+				u32(pos)
+			} else {
+				u32(tags[tag][0])
+			}
+		}
+		next = out.Len()
+		u32(0)
+	}
+	return out.Bytes()
+}
+
+func TestTIFFPages(t *testing.T) {
+	// Group 4 coding of white rows: one V0 code per row, then EOFB
+	g4Rows4 := []byte{0xF0, 0x01, 0x00, 0x10}
+	g4Rows2 := []byte{0xC0, 0x04, 0x00, 0x40}
+	bilevel := map[int][]int{256: {16}, 257: {4}, 258: {1}, 259: {tiffG4}, 262: {0}}
+	gray16 := []byte{0x12, 0x34, 0xFF, 0xFE, 0x00, 0x01, 0x80, 0x00}
+	var cmyk bytes.Buffer
+	zw := zlib.NewWriter(&cmyk)
+	zw.Write([]byte{10, 20, 30, 40, 1, 1, 1, 1})
+	zw.Close()
+	file := tiffTestFile([]tiffTestPage{
+		{tags: bilevel, strips: [][]byte{g4Rows4}},
+		{tags: map[int][]int{256: {16}, 257: {4}, 258: {1}, 259: {tiffG4}, 262: {0}, 278: {2}},
+			strips: [][]byte{g4Rows2, g4Rows2}},
+		{tags: map[int][]int{256: {2}, 257: {2}, 258: {16}, 262: {1}, 278: {1}, 282: {300}, 283: {300}},
+			strips: [][]byte{gray16[:4], gray16[4:]}},
+		{tags: map[int][]int{256: {2}, 257: {1}, 258: {8, 8, 8, 8}, 259: {tiffDeflate}, 262: {5},
+			277: {4}, 317: {2}}, strips: [][]byte{cmyk.Bytes()}},
+	})
+	if n, err := TIFFPageCount(bytes.NewReader(file)); err != nil || n != 4 {
+		t.Fatalf("TIFFPageCount returned %d, %v", n, err)
+	}
+	pdf := New("P", "mm", "A4", "")
+	pdf.AddPage()
+	infos := make([]*ImageInfoType, 4)
+	for j := range infos {
+		opts := ImageOptions{ImageType: "tiff", Page: j + 1, ReadDpi: true}
+		infos[j] = pdf.RegisterImageOptionsReader("scan", opts, bytes.NewReader(file))
+		if err := pdf.Error(); err != nil {
+			t.Fatalf("page %d: %s", j+1, err)
+		}
+	}
+	if pdf.GetImageInfo("scan") != infos[0] || pdf.GetImageInfo("scan#3") != infos[2] {
+		t.Fatal("pages not registered under their own names")
+	}
+	// Single strip Group 4 data is embedded as it is
+	if infos[0].f != "CCITTFaxDecode" || !bytes.Equal(infos[0].data, g4Rows4) ||
+		infos[0].dp != "/K -1 /Columns 16 /Rows 4" || infos[0].dcd != "" {
+		t.Fatalf("unexpected Group 4 image: %s %s", infos[0].f, infos[0].dp)
+	}
+	// Several strips are decoded into a white bitmap
+	if infos[1].f != "FlateDecode" || !bytes.Equal(pngTestDecode(t, infos[1].data, 1, 1, 16),
+		bytes.Repeat([]byte{0xFF}, 8)) {
+		t.Fatal("multi-strip Group 4 image not decoded")
+	}
+	if infos[2].bpc != 16 || infos[2].dpi != 300 ||
+		!bytes.Equal(pngTestDecode(t, infos[2].data, 1, 16, 2), gray16) {
+		t.Fatal("16-bit gray image not decoded")
+	}
+	if infos[3].cs != "DeviceCMYK" || infos[3].f != "FlateDecode" ||
+		infos[3].dp != "/Predictor 2 /Colors 4 /BitsPerComponent 8 /Columns 2" ||
+		!bytes.Equal(infos[3].data, cmyk.Bytes()) {
+		t.Fatalf("unexpected CMYK image: %s %s", infos[3].cs, infos[3].dp)
+	}
+	for j := range infos {
+		pdf.ImageOptions("scan", 10, 10+float64(j)*30, 20, 0, false,
+			ImageOptions{ImageType: "tiff", Page: j + 1}, 0, "")
+	}
+	if err := pdf.Output(new(bytes.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+	pdf = New("P", "mm", "A4", "")
+	pdf.RegisterImageOptionsReader("scan", ImageOptions{ImageType: "tiff", Page: 5}, bytes.NewReader(file))
+	if pdf.Error() == nil {
+		t.Fatal("missing page not reported")
+	}
+}
+
+func TestUnpackBits(t *testing.T) {
+	packed := []byte{0xFE, 0xAA, 0x02, 0x80, 0x00, 0x2A, 0xFD, 0xAA, 0x03, 0x80, 0x00, 0x2A, 0x22,
+		0xF7, 0xAA}
+	want := []byte{0xAA, 0xAA, 0xAA, 0x80, 0x00, 0x2A, 0xAA, 0xAA, 0xAA, 0xAA, 0x80, 0x00, 0x2A, 0x22,
+		0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA}
+	if got := unpackBits(packed); !bytes.Equal(got, want) {
+		t.Fatalf("got % X", got)
+	}
+}
@@ -0,0 +1,275 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TOCOptions controls the appearance of a table of contents.
+type TOCOptions struct {
+	// FontFamily and FontSize, in points, of the entries. Empty values use
+	// the font that is current when TOC() is called.
+	FontFamily string
+	FontSize   float64
+	// LevelStyles holds the font style of each level, for example
+	// []string{"B", ""} for bold top level entries. Deeper levels use the
+	// last style of the slice.
+	LevelStyles []string
+	// Indent is the indentation per level in user units, zero uses twice the
+	// font size
+	Indent float64
+	// LineHeight is the height of a line of an entry, zero uses 1.5 times the
+	// font size
+	LineHeight float64
+	// Leader is repeated between the text of an entry and its page number,
+	// an empty string uses "."
+	Leader string
+	// PageNumber formats the page number of an entry, nil prints the number
+	// of the page in the document
+	PageNumber func(page int) string
+}
+
+// tocEntryType is a heading recorded with AddTOCEntry()
+type tocEntryType struct {
+	text  string
+	level int
+	page  int
+	link  int
+}
+
+// tocRecType holds the entries and the reserved pages of the table of
+// contents
+type tocRecType struct {
+	entries []tocEntryType
+	placed  bool
+	options TOCOptions
+	pages   []int     // reserved pages, in order
+	tops    []float64 // vertical position at which each reserved page starts
+	text    colorType // text color current when TOC() was called
+	family  string
+	style   string
+	sizePt  float64
+}
+
+// AddTOCEntry records a heading for the table of contents. txtStr is the text
+// of the entry and level its depth; 0 is the top level. y specifies the
+// vertical position of the heading on the current page, -1 indicates the
+// current position. The entry links to this position and shows the number of
+// the current page. AddTOCEntry does not add a bookmark; call Bookmark() as
+// well to include the heading in the outline.
+func (f *Bdf) AddTOCEntry(txtStr string, level int, y float64) {
+	if f.err != nil {
+		return
+	}
+	if f.page == 0 {
+		f.err = fmt.Errorf("a page must be added before a table of contents entry")
+		return
+	}
+	if level < 0 {
+		level = 0
+	}
+	link := f.AddLink()
+	f.SetLink(link, y, -1)
+	f.toc.entries = append(f.toc.entries, tocEntryType{text: txtStr, level: level, page: f.page, link: link})
+}
+
+// TOC reserves space for a table of contents that lists every entry added
+// with AddTOCEntry(), including the entries added after this call. The table
+// starts at the current position and continues on pages-1 additional pages,
+// which are added by this call. It is rendered when the document is closed,
+// once the page of every entry is known, so it can be placed before the
+// content it lists. Each entry shows its text, a dot leader and its page
+// number, and links to its heading.
+//
+// After TOC() returns, the last reserved page is current and its remaining
+// space is used by the table, so the content that follows should begin with
+// AddPage(). If the entries do not fit on the reserved pages, the document is
+// put into an error state when it is closed. Only one table of contents is
+// supported in a document.
+func (f *Bdf) TOC(pages int, options TOCOptions) {
+	if f.err != nil {
+		return
+	}
+	if f.toc.placed {
+		f.err = fmt.Errorf("a document can have only one table of contents")
+		return
+	}
+	if f.page == 0 {
+		f.AddPage()
+	}
+	if pages < 1 {
+		pages = 1
+	}
+	f.toc.placed = true
+	f.toc.options = options
+	f.toc.text = f.color.text
+	f.toc.family, f.toc.style, f.toc.sizePt = f.fontFamily, f.fontStyle, f.fontSizePt
+	f.toc.pages = append(f.toc.pages, f.page)
+	f.toc.tops = append(f.toc.tops, f.y)
+	for j := 1; j < pages && f.err == nil; j++ {
+		f.AddPage()
+		f.toc.pages = append(f.toc.pages, f.page)
+		f.toc.tops = append(f.toc.tops, f.y)
+	}
+	f.y = f.pageBreakTrigger
+}
+
+// tocStyle returns the font style of entries at the specified level
+func (f *Bdf) tocStyle(level int) string {
+	styles := f.toc.options.LevelStyles
+	switch {
+	case len(styles) == 0:
+		return f.toc.style
+	case level < len(styles):
+		return styles[level]
+	}
+	return styles[len(styles)-1]
+}
+
+// tocPageNumber returns the page number printed for an entry
+func (f *Bdf) tocPageNumber(page int) string {
+	if f.toc.options.PageNumber != nil {
+		return f.toc.options.PageNumber(page)
+	}
+	return strconv.Itoa(page)
+}
+
+// putTOC renders the table of contents on its reserved pages. It is called
+// before the document is closed, when the pages of all entries are known. The
+// drawing state of the document is restored afterwards.
+func (f *Bdf) putTOC() {
+	if !f.toc.placed || f.err != nil {
+		return
+	}
+	opt := f.toc.options
+	family := opt.FontFamily
+	if family == "" {
+		family = f.toc.family
+	}
+	sizePt := opt.FontSize
+	if sizePt <= 0 {
+		sizePt = f.toc.sizePt
+	}
+	leader := opt.Leader
+	if leader == "" {
+		leader = "."
+	}
+
+	// The rendered table is enclosed in q and Q
+	st := f.saveDrawState()
+	defer f.restoreDrawState(st)
+
+	// The page content may have left the fill color different from the
+	// current one, so the text color is always set explicitly
+	f.color.text = f.toc.text
+	f.colorFlag = true
+	f.cMargin = 0
+	f.autoPageBreak = false
+
+	pageIdx := 0
+	f.page = f.toc.pages[0]
+	f.y = f.toc.tops[0]
+	f.out("q")
+	// Page numbers are right aligned and the leaders of all entries end at
+	// the same position
+	var numWd float64
+	for _, e := range f.toc.entries {
+		f.SetFont(family, f.tocStyle(e.level), sizePt)
+		numWd = math.Max(numWd, f.GetStringWidth(f.tocPageNumber(e.page)))
+	}
+	indent := opt.Indent
+	if indent <= 0 {
+		indent = 2 * sizePt / f.k
+	}
+	lineHt := opt.LineHeight
+	if lineHt <= 0 {
+		lineHt = 1.5 * sizePt / f.k
+	}
+
+	for _, e := range f.toc.entries {
+		f.SetFont(family, f.tocStyle(e.level), sizePt)
+		if f.err != nil {
+			break
+		}
+		pageWd, pageHt, _ := f.PageSize(f.page)
+		right := pageWd - f.rMargin
+		left := f.lMargin + float64(e.level)*indent
+		space := f.GetStringWidth(" ")
+		num := f.tocPageNumber(e.page)
+		lines := f.tocLines(e.text, right-left-numWd-2*space)
+		ht := float64(len(lines)) * lineHt
+		if f.y+ht > pageHt-f.bMargin {
+			pageIdx++
+			if pageIdx >= len(f.toc.pages) {
+				f.out("Q")
+				f.err = fmt.Errorf("table of contents does not fit on %d reserved pages", len(f.toc.pages))
+				return
+			}
+			f.out("Q")
+			f.page = f.toc.pages[pageIdx]
+			f.y = f.toc.tops[pageIdx]
+			f.out("q")
+			f.SetFont(family, f.tocStyle(e.level), sizePt)
+		}
+		top := f.y
+		for _, line := range lines {
+			f.SetXY(left, f.y)
+			f.CellFormat(right-left, lineHt, line, "", 2, "L", false, 0, "")
+		}
+		last := lines[len(lines)-1]
+		lastY := f.y - lineHt
+		textEnd := left + f.GetStringWidth(last) + space
+		dotWd := f.GetStringWidth(leader)
+		dotsEnd := right - numWd - space
+		if dotWd > 0 && dotsEnd > textEnd {
+			count := int((dotsEnd - textEnd) / dotWd)
+			if count > 0 {
+				f.SetXY(dotsEnd-float64(count)*dotWd, lastY)
+				f.CellFormat(float64(count)*dotWd, lineHt, strings.Repeat(leader, count), "", 0, "L", false, 0, "")
+			}
+		}
+		f.SetXY(right-numWd, lastY)
+		f.CellFormat(numWd, lineHt, num, "", 0, "R", false, 0, "")
+		f.Link(left, top, right-left, f.y+lineHt-top, e.link)
+		f.y = lastY + lineHt
+	}
+	f.out("Q")
+}
+
+// tocLines wraps the text of an entry to the specified width
+func (f *Bdf) tocLines(txtStr string, wd float64) (lines []string) {
+	if f.isCurrentUTF8 {
+		lines = f.SplitText(txtStr, wd)
+	} else {
+		// SplitText() indexes the widths by rune
+		for _, line := range f.SplitLines([]byte(txtStr), wd) {
+			lines = append(lines, string(line))
+		}
+	}
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+	return
+}
@@ -0,0 +1,123 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func tocTestDoc(tocPages, chapters int) *Bdf {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.AddPage()
+	pdf.Cell(0, 10, "Contents")
+	pdf.Ln(12)
+	pdf.TOC(tocPages, TOCOptions{LevelStyles: []string{"B", ""}})
+	for j := 1; j <= chapters; j++ {
+		pdf.AddPage()
+		title := "Chapter " + strings.Repeat("I", j)
+		pdf.Bookmark(title, 0, -1)
+		pdf.AddTOCEntry(title, 0, -1)
+		pdf.Cell(0, 10, title)
+		pdf.Ln(20)
+		pdf.AddTOCEntry("Section", 1, -1)
+		if j == 2 {
+			pdf.AddPage()
+		}
+	}
+	return pdf
+}
+
+func TestTOC(t *testing.T) {
+	pdf := tocTestDoc(1, 3)
+	pdf.SetFont("Times", "I", 10)
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if pdf.PageCount() != 5 {
+		t.Fatalf("got %d pages", pdf.PageCount())
+	}
+	content := pdf.pages[1].String()
+	for _, s := range []string{"(Chapter I)Tj", "(Chapter III)Tj", "(Section)Tj", "(2)Tj", "(3)Tj", "(5)Tj", "(.....", "q\n"} {
+		if !strings.Contains(content, s) {
+			t.Errorf("table of contents does not contain %q", s)
+		}
+	}
+	if strings.Contains(content, "(4)Tj") {
+		t.Errorf("table of contents refers to page 4")
+	}
+	if n := len(pdf.pageLinks[1]); n != 6 {
+		t.Fatalf("got %d links, expected 6", n)
+	}
+	for j, want := range []int{2, 2, 3, 3, 5, 5} {
+		if page := pdf.links[pdf.pageLinks[1][j].link].page; page != want {
+			t.Errorf("link %d points to page %d, expected %d", j, page, want)
+		}
+	}
+	if family, style := pdf.fontFamily, pdf.fontStyle; family != "times" || style != "I" {
+		t.Errorf("font was changed to %s %s", family, style)
+	}
+	for p := 2; p <= 5; p++ {
+		if strings.Contains(pdf.pages[p].String(), "(.....") {
+			t.Errorf("leaders drawn on page %d", p)
+		}
+	}
+}
+
+func TestTOCPageNumber(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetCompression(false)
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.TOC(1, TOCOptions{Leader: "-", PageNumber: func(page int) string {
+		return "p. " + strings.Repeat("i", page)
+	}})
+	pdf.AddPage()
+	pdf.AddTOCEntry("Heading", 0, -1)
+	if err := pdf.Output(&bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	content := pdf.pages[1].String()
+	if !strings.Contains(content, "(p. ii)Tj") || !strings.Contains(content, "(-----") {
+		t.Errorf("unexpected table of contents:\n%s", content)
+	}
+}
+
+func TestTOCOverflow(t *testing.T) {
+	pdf := tocTestDoc(1, 40)
+	if err := pdf.Output(&bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "reserved pages") {
+		t.Errorf("expected overflow error, got %v", err)
+	}
+	pdf = tocTestDoc(3, 55)
+	if err := pdf.Output(&bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(pdf.pages[3].String(), "(Chapter ") {
+		t.Errorf("table of contents does not continue on the third page")
+	}
+	pdf.TOC(1, TOCOptions{})
+	if pdf.Error() == nil {
+		t.Errorf("second table of contents accepted")
+	}
+}
@@ -0,0 +1,266 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// Timestamper obtains RFC 3161 time-stamp tokens
+type Timestamper interface {
+	// Timestamp returns a DER encoded TimeStampToken for digest, which was
+	// computed with the hash function h
+	Timestamp(digest []byte, h crypto.Hash) ([]byte, error)
+}
+
+// TSAClient requests time-stamp tokens from a time-stamping authority over
+// HTTP
+type TSAClient struct {
+	URL string
+	// Client sends the requests; http.DefaultClient is used when nil
+	Client *http.Client
+}
+
+type tsaMessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tsaRequest struct {
+	Version        int
+	MessageImprint tsaMessageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+}
+
+type tsaStatus struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type tsaResponse struct {
+	Status tsaStatus
+	Token  asn1.RawValue `asn1:"optional"`
+}
+
+// timestampRequest encodes a TimeStampReq asking for the signing certificate
+// to be included in the token
+func timestampRequest(digest []byte, h crypto.Hash, nonce *big.Int) ([]byte, error) {
+	alg, err := digestAlgorithm(h)
+	if err != nil {
+		return nil, err
+	}
+	return derSeq(
+		mustMarshal(1),
+		derSeq(alg, derOctets(digest)),
+		mustMarshal(nonce),
+		mustMarshal(true),
+	), nil
+}
+
+// Timestamp implements Timestamper
+func (c *TSAClient) Timestamp(digest []byte, h crypto.Hash) ([]byte, error) {
+	nonce := randomSerial()
+	req, err := timestampRequest(digest, h, nonce)
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(c.URL, "application/timestamp-query", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("time-stamp request to %s failed: %s", c.URL, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var tr tsaResponse
+	if _, err = asn1.Unmarshal(body, &tr); err != nil {
+		return nil, fmt.Errorf("invalid time-stamp response: %v", err)
+	}
+	// 0 is granted, 1 granted with modifications
+	if tr.Status.Status > 1 || len(tr.Token.FullBytes) == 0 {
+		return nil, fmt.Errorf("time-stamp request rejected with status %d", tr.Status.Status)
+	}
+	imprint, tokenNonce, err := tsaTokenInfo(tr.Token.FullBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time-stamp token: %v", err)
+	}
+	if th, ok := digestHash(imprint.HashAlgorithm.Algorithm); !ok || th != h || !bytes.Equal(imprint.HashedMessage, digest) {
+		return nil, fmt.Errorf("time-stamp token does not cover the requested digest")
+	}
+	if tokenNonce == nil || tokenNonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("time-stamp token does not match the request nonce")
+	}
+	return tr.Token.FullBytes, nil
+}
+
+// tsaTokenInfo returns the message imprint and the nonce, nil if absent, of
+// the TSTInfo held by a time-stamp token
+func tsaTokenInfo(token []byte) (imprint tsaMessageImprint, nonce *big.Int, err error) {
+	var ci struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	if _, err = asn1.Unmarshal(token, &ci); err != nil {
+		return
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		err = fmt.Errorf("token is not signed data")
+		return
+	}
+	var sd struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		EncapContentInfo struct {
+			ContentType asn1.ObjectIdentifier
+			Content     asn1.RawValue `asn1:"explicit,tag:0"`
+		}
+	}
+	if _, err = asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return
+	}
+	if !sd.EncapContentInfo.ContentType.Equal(oidTSTInfo) {
+		err = fmt.Errorf("token does not hold a TSTInfo")
+		return
+	}
+	var content []byte
+	if _, err = asn1.Unmarshal(sd.EncapContentInfo.Content.Bytes, &content); err != nil {
+		return
+	}
+	var info asn1.RawValue
+	if _, err = asn1.Unmarshal(content, &info); err != nil {
+		return
+	}
+	// version, policy, messageImprint, serialNumber and genTime are followed
+	// by the optional accuracy, ordering, nonce, tsa and extensions
+	rest := info.Bytes
+	for j := 0; len(rest) > 0; j++ {
+		var elem asn1.RawValue
+		if rest, err = asn1.Unmarshal(rest, &elem); err != nil {
+			return
+		}
+		switch {
+		case j == 2:
+			if _, err = asn1.Unmarshal(elem.FullBytes, &imprint); err != nil {
+				return
+			}
+		case j > 4 && elem.Class == asn1.ClassUniversal && elem.Tag == asn1.TagInteger:
+			nonce = new(big.Int)
+			if _, err = asn1.Unmarshal(elem.FullBytes, &nonce); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// LocalTSA is a self-contained time-stamping authority. It stands in for a
+// real authority in tests and closed environments, either directly as a
+// Timestamper or over HTTP as an http.Handler used with TSAClient.
+type LocalTSA struct {
+	// Signer and Certificate sign the tokens; the certificate should carry
+	// the time stamping extended key usage
+	Signer      crypto.Signer
+	Certificate *x509.Certificate
+	// Policy is the TSA policy; the anyPolicy identifier is used when nil
+	Policy asn1.ObjectIdentifier
+	// Now returns the time recorded in tokens; time.Now is used when nil
+	Now func() time.Time
+}
+
+// Timestamp implements Timestamper
+func (t *LocalTSA) Timestamp(digest []byte, h crypto.Hash) ([]byte, error) {
+	return t.token(digest, h, nil)
+}
+
+// token returns a TimeStampToken holding a TSTInfo for digest
+func (t *LocalTSA) token(digest []byte, h crypto.Hash, nonce *big.Int) ([]byte, error) {
+	alg, err := digestAlgorithm(h)
+	if err != nil {
+		return nil, err
+	}
+	policy := t.Policy
+	if policy == nil {
+		policy = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+	}
+	now := time.Now
+	if t.Now != nil {
+		now = t.Now
+	}
+	info := [][]byte{
+		mustMarshal(1),
+		mustMarshal(policy),
+		derSeq(alg, derOctets(digest)),
+		mustMarshal(randomSerial()),
+		generalizedTime(now()),
+	}
+	if nonce != nil {
+		info = append(info, mustMarshal(nonce))
+	}
+	s := cmsSigner{signer: t.Signer, certs: []*x509.Certificate{t.Certificate}, hash: crypto.SHA256}
+	return s.sign(oidTSTInfo, derSeq(info...), false)
+}
+
+// ServeHTTP answers RFC 3161 time-stamp requests
+func (t *LocalTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<16))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req tsaRequest
+	var resp []byte
+	if _, err = asn1.Unmarshal(body, &req); err != nil {
+		// rejection, badDataFormat
+		resp = derSeq(derSeq(mustMarshal(2), mustMarshal(asn1.BitString{Bytes: []byte{0x04}, BitLength: 6})))
+	} else if h, ok := digestHash(req.MessageImprint.HashAlgorithm.Algorithm); !ok {
+		// rejection, badAlg
+		resp = derSeq(derSeq(mustMarshal(2), mustMarshal(asn1.BitString{Bytes: []byte{0x80}, BitLength: 1})))
+	} else {
+		token, err := t.token(req.MessageImprint.HashedMessage, h, req.Nonce)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp = derSeq(derSeq(mustMarshal(0)), token)
+	}
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(resp)
+}
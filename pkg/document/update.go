@@ -0,0 +1,1120 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PDFUpdate collects changes to an existing PDF document and appends them to
+// it as an incremental update. The bytes of the original document are kept
+// as they are, so that signatures applied to earlier revisions remain valid,
+// and each update can be followed by another. For example, a step of an
+// approval workflow might stamp and sign the document:
+//
+//	u, err := NewPDFUpdateFromFile("invoice.pdf", "mm")
+//	if err != nil {
+//		return err
+//	}
+//	u.Stamp(1, 140, 20, 50, 20, func(pdf *Bdf) {
+//		pdf.SetFont("Helvetica", "B", 14)
+//		pdf.SetTextColor(200, 0, 0)
+//		pdf.CellFormat(50, 20, "APPROVED", "1", 0, "C", false, 0, "")
+//	})
+//	u.Sign(SignatureOptions{Signer: key, Certificates: certs, Reason: "Approval"})
+//	err = u.OutputFile("invoice.pdf")
+//
+// Certified documents only accept the changes their certification signature
+// permits. Coordinates are measured from the upper left corner of the page as
+// displayed, in the unit of measure of the update.
+type PDFUpdate struct {
+	r       *PDFReader
+	unitStr string
+	k       float64
+	objs    map[int]interface{} // new and changed objects by number
+	size    int                 // next free object number
+	pages   []int               // page object numbers
+	info    []pdfDict           // page dictionaries with inherited attributes
+	mdp     int                 // DocMDP permissions of a certified document, 0 if not certified
+	form    pdfDict             // interactive form dictionary being edited
+	sign    *signRecType        // approval signature, also stored in objs
+	err     error
+}
+
+// Permission levels of certified documents (DocMDP)
+const (
+	updateFillForms   = 2 // filling in forms and signing
+	updateAnnotations = 3 // also adding annotations
+	updateContent     = 4 // other changes, never permitted by a certification
+)
+
+// NewPDFUpdate reads the PDF document of r for an incremental update. unitStr
+// is the unit of measure of coordinates: "pt", "mm", "cm" or "in".
+func NewPDFUpdate(r io.Reader, unitStr string) (*PDFUpdate, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return newPDFUpdate(data, unitStr)
+}
+
+// NewPDFUpdateFromFile reads the PDF document stored in fileStr for an
+// incremental update
+func NewPDFUpdateFromFile(fileStr, unitStr string) (*PDFUpdate, error) {
+	data, err := os.ReadFile(fileStr)
+	if err != nil {
+		return nil, err
+	}
+	return newPDFUpdate(data, unitStr)
+}
+
+func newPDFUpdate(data []byte, unitStr string) (*PDFUpdate, error) {
+	k, err := unitScale(unitStr)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newPDFReader(data)
+	if err != nil {
+		return nil, err
+	}
+	if r.xrefPos == 0 {
+		return nil, fmt.Errorf("pdf: damaged cross-reference information; the document cannot be updated")
+	}
+	u := &PDFUpdate{r: r, unitStr: unitStr, k: k, objs: make(map[int]interface{})}
+	u.size, _ = r.trailer["Size"].(int)
+	for num := range r.xref {
+		if num >= u.size {
+			u.size = num + 1
+		}
+	}
+	u.pages = make([]int, len(r.pages))
+	for num, p := range r.pageNum {
+		u.pages[p-1] = num
+	}
+	for _, num := range u.pages {
+		if num == 0 {
+			return nil, fmt.Errorf("pdf: page tree contains direct page objects")
+		}
+	}
+	u.info = append(u.info, r.pages...)
+	// a certification signature limits the changes permitted
+	if root, ok := u.resolve(r.trailer["Root"]).(pdfDict); ok {
+		perms, _ := u.resolve(root["Perms"]).(pdfDict)
+		sig, _ := u.resolve(perms["DocMDP"]).(pdfDict)
+		refs, _ := u.resolve(sig["Reference"]).(pdfArray)
+		for _, ref := range refs {
+			ref, _ := u.resolve(ref).(pdfDict)
+			if ref["TransformMethod"] == pdfName("DocMDP") {
+				u.mdp = updateFillForms
+				params, _ := u.resolve(ref["TransformParams"]).(pdfDict)
+				if p, ok := u.resolve(params["P"]).(int); ok && p >= 1 && p <= 3 {
+					u.mdp = p
+				}
+			}
+		}
+	}
+	return u, nil
+}
+
+// Err returns true if a processing error has occurred
+func (u *PDFUpdate) Err() bool {
+	return u.err != nil
+}
+
+// Error returns the internal error, nil if no error has occurred
+func (u *PDFUpdate) Error() error {
+	return u.err
+}
+
+// SetErrorf sets the internal error with formatted text unless an error is
+// already set
+func (u *PDFUpdate) SetErrorf(fmtStr string, args ...interface{}) {
+	if u.err == nil {
+		u.err = fmt.Errorf(fmtStr, args...)
+	}
+}
+
+// PageCount returns the number of pages of the document, including pages
+// added with AddPages
+func (u *PDFUpdate) PageCount() int {
+	return len(u.pages)
+}
+
+// PageSize returns the width and height of page pageNum (starting at 1) as
+// displayed, in the unit of measure of the update
+func (u *PDFUpdate) PageSize(pageNum int) (wd, ht float64) {
+	if pageNum < 1 || pageNum > len(u.pages) {
+		u.SetErrorf("page %d does not exist", pageNum)
+		return
+	}
+	box, rotate := u.pageBox(pageNum)
+	wd, ht = box[2]-box[0], box[3]-box[1]
+	if rotate == 90 || rotate == 270 {
+		wd, ht = ht, wd
+	}
+	return wd / u.k, ht / u.k
+}
+
+// permit sets an error unless a certification signature permits changes of
+// the given level
+func (u *PDFUpdate) permit(level int, what string) bool {
+	if u.err != nil {
+		return false
+	}
+	if u.mdp > 0 && u.mdp < level {
+		u.err = fmt.Errorf("the certification of the document does not permit %s", what)
+		return false
+	}
+	return true
+}
+
+// resolve follows indirect references, preferring objects of the update
+func (u *PDFUpdate) resolve(obj interface{}) interface{} {
+	for j := 0; j < 32; j++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		if obj, ok = u.objs[ref.num]; !ok {
+			obj = u.r.object(ref.num)
+		}
+	}
+	return nil
+}
+
+// edit returns a copy of dictionary num that is written with the update
+func (u *PDFUpdate) edit(num int) pdfDict {
+	if dict, ok := u.objs[num].(pdfDict); ok {
+		return dict
+	}
+	dict := pdfDict{}
+	if src, ok := u.r.object(num).(pdfDict); ok {
+		for key, val := range src {
+			dict[key] = val
+		}
+	}
+	u.objs[num] = dict
+	return dict
+}
+
+// add stores a new object and returns a reference to it
+func (u *PDFUpdate) add(obj interface{}) pdfRef {
+	num := u.size
+	u.size++
+	u.objs[num] = obj
+	return pdfRef{num: num}
+}
+
+// root returns the document catalog for editing
+func (u *PDFUpdate) root() pdfDict {
+	ref, _ := u.r.trailer["Root"].(pdfRef)
+	return u.edit(ref.num)
+}
+
+// formDict returns the interactive form dictionary, nil when the document
+// has no form
+func (u *PDFUpdate) formDict() pdfDict {
+	if u.form != nil {
+		return u.form
+	}
+	root, _ := u.resolve(u.r.trailer["Root"]).(pdfDict)
+	form, _ := u.resolve(root["AcroForm"]).(pdfDict)
+	return form
+}
+
+// acroForm returns the interactive form dictionary for editing, creating it
+// when the document has none
+func (u *PDFUpdate) acroForm() pdfDict {
+	if u.form != nil {
+		return u.form
+	}
+	root, _ := u.resolve(u.r.trailer["Root"]).(pdfDict)
+	switch v := root["AcroForm"].(type) {
+	case pdfRef:
+		if _, ok := u.resolve(v).(pdfDict); ok {
+			u.form = u.edit(v.num)
+			return u.form
+		}
+	case pdfDict:
+		u.form = pdfDict{}
+		for key, val := range v {
+			u.form[key] = val
+		}
+		u.root()["AcroForm"] = u.form
+		return u.form
+	}
+	u.form = pdfDict{"Fields": pdfArray{}}
+	u.root()["AcroForm"] = u.add(u.form)
+	return u.form
+}
+
+// pageBox returns the crop box of a page in default user space and its
+// rotation
+func (u *PDFUpdate) pageBox(pageNum int) (box [4]float64, rotate int) {
+	page := u.info[pageNum-1]
+	box = [4]float64{0, 0, 595.28, 841.89}
+	for _, key := range []pdfName{"CropBox", "MediaBox"} {
+		if arr, ok := u.resolve(page[key]).(pdfArray); ok && len(arr) == 4 {
+			for j := range box {
+				box[j] = pdfNumber(u.resolve(arr[j]))
+			}
+			break
+		}
+	}
+	if box[0] > box[2] {
+		box[0], box[2] = box[2], box[0]
+	}
+	if box[1] > box[3] {
+		box[1], box[3] = box[3], box[1]
+	}
+	if rot, ok := u.resolve(page["Rotate"]).(int); ok {
+		rotate = ((rot % 360) + 360) % 360
+	}
+	return
+}
+
+// rect converts the rectangle at (x, y) with width w and height h on the
+// displayed page to an annotation rectangle. It also returns the matrix that
+// keeps an appearance upright on a rotated page.
+func (u *PDFUpdate) rect(pageNum int, x, y, w, h float64) (pdfArray, pdfArray) {
+	box, rotate := u.pageBox(pageNum)
+	_, ht := u.PageSize(pageNum)
+	m := pdfDisplayMatrix(box, rotate)
+	// the inverse maps displayed coordinates to default user space
+	det := m[0]*m[3] - m[1]*m[2]
+	inv := [6]float64{m[3] / det, -m[1] / det, -m[2] / det, m[0] / det,
+		(m[2]*m[5] - m[3]*m[4]) / det, (m[1]*m[4] - m[0]*m[5]) / det}
+	llx, lly := math.Inf(1), math.Inf(1)
+	urx, ury := math.Inf(-1), math.Inf(-1)
+	for _, pt := range [][2]float64{{x, y}, {x + w, y}, {x, y + h}, {x + w, y + h}} {
+		dx, dy := pt[0]*u.k, (ht-pt[1])*u.k
+		px := inv[0]*dx + inv[2]*dy + inv[4]
+		py := inv[1]*dx + inv[3]*dy + inv[5]
+		llx, lly = math.Min(llx, px), math.Min(lly, py)
+		urx, ury = math.Max(urx, px), math.Max(ury, py)
+	}
+	round := func(v float64) float64 {
+		return math.Round(v*100) / 100
+	}
+	return pdfArray{round(llx), round(lly), round(urx), round(ury)},
+		pdfArray{inv[0], inv[1], inv[2], inv[3], 0, 0}
+}
+
+// addAnnot adds an annotation dictionary to a page
+func (u *PDFUpdate) addAnnot(pageNum int, annot pdfDict) pdfRef {
+	pageRef := pdfRef{num: u.pages[pageNum-1]}
+	annot["Type"] = pdfName("Annot")
+	annot["P"] = pageRef
+	ref := u.add(annot)
+	page := u.edit(pageRef.num)
+	annots, _ := u.resolve(page["Annots"]).(pdfArray)
+	page["Annots"] = append(append(pdfArray{}, annots...), ref)
+	return ref
+}
+
+// checkPage sets an error unless pageNum is a page of the document
+func (u *PDFUpdate) checkPage(pageNum int) bool {
+	if u.err == nil && (pageNum < 1 || pageNum > len(u.pages)) {
+		u.err = fmt.Errorf("page %d does not exist", pageNum)
+	}
+	return u.err == nil
+}
+
+// updateText returns s as a PDF text string, UTF-16 encoded when it holds
+// characters outside of the ASCII range
+func updateText(s string) pdfString {
+	for _, r := range s {
+		if r > 0x7e {
+			return pdfString(utf8toutf16(s))
+		}
+	}
+	return pdfString(s)
+}
+
+// AddLink adds a link to linkStr covering the rectangle at (x, y) with width
+// w and height h on page pageNum
+func (u *PDFUpdate) AddLink(pageNum int, x, y, w, h float64, linkStr string) {
+	if !u.permit(updateAnnotations, "adding links") || !u.checkPage(pageNum) {
+		return
+	}
+	rect, _ := u.rect(pageNum, x, y, w, h)
+	u.addAnnot(pageNum, pdfDict{"Subtype": pdfName("Link"), "Rect": rect, "Border": pdfArray{0, 0, 0},
+		"A": pdfDict{"S": pdfName("URI"), "URI": pdfString(linkStr)}})
+}
+
+// AddNote adds a text note, displayed as an icon with its upper left corner
+// at (x, y), to page pageNum. author is shown as the title of the note.
+func (u *PDFUpdate) AddNote(pageNum int, x, y float64, author, contents string) {
+	if !u.permit(updateAnnotations, "adding notes") || !u.checkPage(pageNum) {
+		return
+	}
+	rect, _ := u.rect(pageNum, x, y, 20/u.k, 20/u.k)
+	note := pdfDict{"Subtype": pdfName("Text"), "Rect": rect, "Contents": updateText(contents),
+		"M": pdfString("D:" + time.Now().Format("20060102150405-07'00'")), "F": 4}
+	if author != "" {
+		note["T"] = updateText(author)
+	}
+	u.addAnnot(pageNum, note)
+}
+
+// Stamp adds a rubber stamp annotation to page pageNum occupying the
+// rectangle at (x, y) with width w and height h. Its appearance is drawn by
+// fnc on a page of that size, with no margins and automatic page breaking
+// disabled; fonts, images and the rest of the Bdf drawing functions are
+// available. Only the first page drawn by fnc is used. The stamp is printed
+// and locked against changes in viewers. As an annotation it leaves the
+// signed content of the page untouched.
+func (u *PDFUpdate) Stamp(pageNum int, x, y, w, h float64, fnc func(pdf *Bdf)) {
+	if !u.permit(updateAnnotations, "stamps") || !u.checkPage(pageNum) {
+		return
+	}
+	pdf := New("P", u.unitStr, "A4", "")
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddPageFormat("P", SizeType{Wd: w, Ht: h})
+	fnc(pdf)
+	appearance := u.render(pdf, w*u.k, h*u.k)
+	if appearance == nil {
+		return
+	}
+	rect, matrix := u.rect(pageNum, x, y, w, h)
+	appearance.dict["Matrix"] = matrix
+	u.addAnnot(pageNum, pdfDict{"Subtype": pdfName("Stamp"), "Rect": rect, "F": 4 | 128,
+		"AP": pdfDict{"N": u.add(appearance)},
+		"M":  pdfString("D:" + time.Now().Format("20060102150405-07'00'"))})
+}
+
+// render outputs pdf and returns the content of its first page as a form
+// XObject of wd by ht points, with the resources copied into the update
+func (u *PDFUpdate) render(pdf *Bdf, wd, ht float64) *pdfStream {
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		u.err = err
+		return nil
+	}
+	r, err := newPDFReader(buf.Bytes())
+	if err != nil {
+		u.err = err
+		return nil
+	}
+	page := r.pages[0]
+	var content []byte
+	contents, ok := r.resolve(page["Contents"]).(pdfArray)
+	if !ok {
+		contents = pdfArray{page["Contents"]}
+	}
+	for _, c := range contents {
+		if stm, ok := r.resolve(c).(*pdfStream); ok {
+			data, err := r.decode(stm)
+			if err != nil {
+				u.err = err
+				return nil
+			}
+			content = append(append(content, data...), '\n')
+		}
+	}
+	mem := xmem.compress(content)
+	defer mem.release()
+	return &pdfStream{dict: pdfDict{"Type": pdfName("XObject"), "Subtype": pdfName("Form"),
+		"BBox": pdfArray{0, 0, wd, ht}, "Filter": pdfName("FlateDecode"),
+		"Resources": u.copyObject(r, page["Resources"], map[int]int{})}, data: mem.copy()}
+}
+
+// copyObject copies obj of the document of r into the update along with the
+// objects it refers to. objMap holds the numbers of objects already copied.
+// References to pages not copied and to the page tree become null.
+func (u *PDFUpdate) copyObject(r *PDFReader, obj interface{}, objMap map[int]int) interface{} {
+	switch v := obj.(type) {
+	case pdfRef:
+		if num, ok := objMap[v.num]; ok {
+			if num == 0 {
+				return nil
+			}
+			return pdfRef{num: num}
+		}
+		target := r.object(v.num)
+		if d, ok := target.(pdfDict); target == nil || ok && (d["Type"] == pdfName("Page") || d["Type"] == pdfName("Pages")) {
+			objMap[v.num] = 0
+			return nil
+		}
+		ref := u.add(nil)
+		objMap[v.num] = ref.num
+		u.objs[ref.num] = u.copyObject(r, target, objMap)
+		return ref
+	case pdfArray:
+		arr := make(pdfArray, len(v))
+		for j, e := range v {
+			arr[j] = u.copyObject(r, e, objMap)
+		}
+		return arr
+	case pdfDict:
+		dict := pdfDict{}
+		for key, e := range v {
+			dict[key] = u.copyObject(r, e, objMap)
+		}
+		return dict
+	case *pdfStream:
+		return &pdfStream{dict: u.copyObject(r, v.dict, objMap).(pdfDict), data: v.data}
+	}
+	return obj
+}
+
+// AddPages appends the pages of the document of r. Annotations other than
+// form field widgets are copied with the pages; form fields and the logical
+// structure of r are not. Certified documents do not permit adding pages.
+func (u *PDFUpdate) AddPages(r *PDFReader) {
+	if !u.permit(updateContent, "adding pages") {
+		return
+	}
+	root, _ := u.resolve(u.r.trailer["Root"]).(pdfDict)
+	treeRef, ok := root["Pages"].(pdfRef)
+	if !ok {
+		u.err = fmt.Errorf("pdf: page tree not found")
+		return
+	}
+	// pages are numbered first so that links between them are kept
+	objMap := make(map[int]int)
+	srcPages := make([]int, len(r.pages))
+	for num, p := range r.pageNum {
+		srcPages[p-1] = num
+		objMap[num] = u.add(nil).num
+	}
+	tree := u.edit(treeRef.num)
+	kids, _ := u.resolve(tree["Kids"]).(pdfArray)
+	kids = append(pdfArray{}, kids...)
+	for j, src := range r.pages {
+		page := pdfDict{}
+		for key, val := range src {
+			switch key {
+			case "Parent", "StructParents", "B":
+			case "Annots":
+				annots, _ := r.resolve(val).(pdfArray)
+				var list pdfArray
+				for _, a := range annots {
+					if d, ok := r.resolve(a).(pdfDict); ok && d["Subtype"] != pdfName("Widget") {
+						list = append(list, u.copyObject(r, a, objMap))
+					}
+				}
+				if len(list) > 0 {
+					page["Annots"] = list
+				}
+			default:
+				page[key] = u.copyObject(r, val, objMap)
+			}
+		}
+		page["Parent"] = treeRef
+		num := objMap[srcPages[j]]
+		u.objs[num] = page
+		kids = append(kids, pdfRef{num: num})
+		u.pages = append(u.pages, num)
+		u.info = append(u.info, page)
+	}
+	tree["Kids"] = kids
+	count, _ := u.resolve(tree["Count"]).(int)
+	tree["Count"] = count + len(r.pages)
+}
+
+// field returns the object number of the terminal form field with the fully
+// qualified name, 0 when there is none
+func (u *PDFUpdate) field(name string) int {
+	form := u.formDict()
+	if form == nil {
+		return 0
+	}
+	var find func(list interface{}, prefix string) int
+	find = func(list interface{}, prefix string) int {
+		arr, _ := u.resolve(list).(pdfArray)
+		for _, e := range arr {
+			ref, ok := e.(pdfRef)
+			fld, _ := u.resolve(e).(pdfDict)
+			t, named := fld["T"].(pdfString)
+			if !ok || !named {
+				continue
+			}
+			full := prefix + pdfTextString(t)
+			if full == name && !u.hasFieldKids(fld) {
+				return ref.num
+			}
+			if strings.HasPrefix(name, full+".") {
+				if num := find(fld["Kids"], full+"."); num > 0 {
+					return num
+				}
+			}
+		}
+		return 0
+	}
+	return find(form["Fields"], "")
+}
+
+// hasFieldKids reports whether a field has kids that are fields rather than
+// widgets
+func (u *PDFUpdate) hasFieldKids(fld pdfDict) bool {
+	kids, _ := u.resolve(fld["Kids"]).(pdfArray)
+	for _, kid := range kids {
+		if d, ok := u.resolve(kid).(pdfDict); ok {
+			if _, ok := d["T"]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pdfTextString decodes a PDF text string to UTF-8
+func pdfTextString(s pdfString) string {
+	if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+		var b strings.Builder
+		for j := 2; j+1 < len(s); j += 2 {
+			c := rune(s[j])<<8 | rune(s[j+1])
+			if c >= 0xD800 && c < 0xDC00 && j+3 < len(s) {
+				c = (c-0xD800)<<10 + (rune(s[j+2])<<8 | rune(s[j+3])) - 0xDC00 + 0x10000
+				j += 2
+			}
+			b.WriteRune(c)
+		}
+		return b.String()
+	}
+	return string(s)
+}
+
+// inherited returns the value of key in a field dictionary or its ancestors
+func (u *PDFUpdate) inherited(fld pdfDict, key pdfName) interface{} {
+	for j := 0; j < 32 && fld != nil; j++ {
+		if v, ok := fld[key]; ok {
+			return u.resolve(v)
+		}
+		fld, _ = u.resolve(fld["Parent"]).(pdfDict)
+	}
+	return nil
+}
+
+// locked reports whether a signature covering the field name prevents it
+// from being changed
+func (u *PDFUpdate) locked(name string) bool {
+	form := u.formDict()
+	locked := false
+	var walk func(list interface{}, prefix string)
+	walk = func(list interface{}, prefix string) {
+		arr, _ := u.resolve(list).(pdfArray)
+		for _, e := range arr {
+			fld, _ := u.resolve(e).(pdfDict)
+			full := prefix
+			if t, ok := fld["T"].(pdfString); ok {
+				full = prefix + pdfTextString(t)
+			}
+			walk(fld["Kids"], full+".")
+			if u.inherited(fld, "FT") != pdfName("Sig") || fld["V"] == nil {
+				continue
+			}
+			lock, _ := u.resolve(fld["Lock"]).(pdfDict)
+			fields, _ := u.resolve(lock["Fields"]).(pdfArray)
+			listed := false
+			for _, f := range fields {
+				if s, ok := u.resolve(f).(pdfString); ok && pdfTextString(s) == name {
+					listed = true
+				}
+			}
+			switch lock["Action"] {
+			case pdfName("All"):
+				locked = true
+			case pdfName("Include"):
+				locked = locked || listed
+			case pdfName("Exclude"):
+				locked = locked || !listed
+			}
+		}
+	}
+	if form != nil {
+		walk(form["Fields"], "")
+	}
+	return locked
+}
+
+// widgets returns the object numbers of the widgets of a terminal field
+func (u *PDFUpdate) widgets(num int, fld pdfDict) (list []int) {
+	kids, _ := u.resolve(fld["Kids"]).(pdfArray)
+	for _, kid := range kids {
+		if ref, ok := kid.(pdfRef); ok {
+			list = append(list, ref.num)
+		}
+	}
+	if len(list) == 0 {
+		list = []int{num}
+	}
+	return
+}
+
+// SetFieldValue sets the value of the form field with the fully qualified
+// name, such as "address.city", and updates its appearance. The value of a
+// checkbox or radio button group is the name of the state to select, or
+// "Off"; a checkbox with a single "on" state also accepts "Yes". The value
+// of a choice field must be one of its options unless it is editable.
+// Fields locked by a signature cannot be changed.
+func (u *PDFUpdate) SetFieldValue(name, value string) {
+	if !u.permit(updateFillForms, "filling in forms") {
+		return
+	}
+	num := u.field(name)
+	if num == 0 {
+		u.err = fmt.Errorf("form field %q not found", name)
+		return
+	}
+	if u.locked(name) {
+		u.err = fmt.Errorf("form field %q is locked by a signature", name)
+		return
+	}
+	fld := u.edit(num)
+	flags, _ := u.inherited(fld, "Ff").(int)
+	switch u.inherited(fld, "FT") {
+	case pdfName("Btn"):
+		if flags&formFlagPushButton != 0 {
+			u.err = fmt.Errorf("form field %q is a push button", name)
+			return
+		}
+		u.setButton(num, fld, name, value)
+	case pdfName("Tx"):
+		fld["V"] = updateText(value)
+		u.setTextAppearances(num, fld, value, flags)
+	case pdfName("Ch"):
+		opts, _ := u.inherited(fld, "Opt").(pdfArray)
+		found := false
+		for _, opt := range opts {
+			if pair, ok := u.resolve(opt).(pdfArray); ok && len(pair) == 2 {
+				opt = pair[0]
+			}
+			if s, ok := u.resolve(opt).(pdfString); ok && pdfTextString(s) == value {
+				found = true
+			}
+		}
+		if !found && flags&formFlagEdit == 0 {
+			u.err = fmt.Errorf("%q is not an option of form field %q", value, name)
+			return
+		}
+		fld["V"] = updateText(value)
+		delete(fld, "I")
+		u.setTextAppearances(num, fld, value, flags&^formFlagMultiline)
+	case pdfName("Sig"):
+		u.err = fmt.Errorf("form field %q is a signature field; use Sign", name)
+	default:
+		u.err = fmt.Errorf("form field %q has an unknown type", name)
+	}
+}
+
+// setButton selects the state value of the widgets of a checkbox or radio
+// button group
+func (u *PDFUpdate) setButton(num int, fld pdfDict, name, value string) {
+	widgets := u.widgets(num, fld)
+	states := make([][]string, len(widgets))
+	all := map[string]bool{}
+	for j, w := range widgets {
+		wd, _ := u.resolve(pdfRef{num: w}).(pdfDict)
+		ap, _ := u.resolve(wd["AP"]).(pdfDict)
+		normal, _ := u.resolve(ap["N"]).(pdfDict)
+		for key := range normal {
+			if key != "Off" {
+				states[j] = append(states[j], string(key))
+				all[string(key)] = true
+			}
+		}
+	}
+	if value == "Yes" && !all["Yes"] && len(all) == 1 {
+		for state := range all {
+			value = state
+		}
+	}
+	if value != "Off" && !all[value] {
+		u.err = fmt.Errorf("form field %q has no state %q", name, value)
+		return
+	}
+	fld["V"] = pdfName(value)
+	for j, w := range widgets {
+		state := "Off"
+		for _, s := range states[j] {
+			if s == value {
+				state = s
+			}
+		}
+		var wd pdfDict
+		if w == num {
+			wd = fld
+		} else {
+			wd = u.edit(w)
+		}
+		wd["AS"] = pdfName(state)
+	}
+}
+
+// setTextAppearances draws value in the widgets of a text or choice field
+// with the font, size and color of its default appearance
+func (u *PDFUpdate) setTextAppearances(num int, fld pdfDict, value string, flags int) {
+	form := u.formDict()
+	da, _ := u.inherited(fld, "DA").(pdfString)
+	if da == nil && form != nil {
+		da, _ = u.resolve(form["DA"]).(pdfString)
+	}
+	q, ok := u.inherited(fld, "Q").(int)
+	if !ok && form != nil {
+		q, _ = u.resolve(form["Q"]).(int)
+	}
+	family, style, size, color := "Helvetica", "", 0.0, "0 g"
+	var operands []string
+	for _, tok := range strings.Fields(string(da)) {
+		var v float64
+		if _, err := fmt.Sscan(tok, &v); err == nil || tok[0] == '/' {
+			operands = append(operands, tok)
+			continue
+		}
+		switch tok {
+		case "Tf":
+			if len(operands) >= 2 {
+				family, style = u.fieldFont(form, strings.TrimPrefix(operands[len(operands)-2], "/"))
+				fmt.Sscan(operands[len(operands)-1], &size)
+			}
+		case "g", "rg", "k":
+			color = strings.Join(operands, " ") + " " + tok
+		}
+		operands = operands[:0]
+	}
+	for _, w := range u.widgets(num, fld) {
+		var wd pdfDict
+		if w == num {
+			wd = fld
+		} else {
+			wd = u.edit(w)
+		}
+		rect, _ := u.resolve(wd["Rect"]).(pdfArray)
+		if len(rect) != 4 {
+			continue
+		}
+		wdPt := math.Abs(pdfNumber(u.resolve(rect[2])) - pdfNumber(u.resolve(rect[0])))
+		htPt := math.Abs(pdfNumber(u.resolve(rect[3])) - pdfNumber(u.resolve(rect[1])))
+		fontSize := size
+		if fontSize <= 0 {
+			// auto size fits a single line into the widget
+			fontSize = math.Max(4, math.Min(12, (htPt-4)/1.15))
+		}
+		pdf := New("P", "pt", "A4", "")
+		pdf.SetMargins(0, 0, 0)
+		pdf.SetAutoPageBreak(false, 0)
+		pdf.AddPageFormat("P", SizeType{Wd: wdPt, Ht: htPt})
+		pdf.SetFont(family, style, fontSize)
+		updateSetColor(updateDAColor(color), pdf.SetTextColorGray, pdf.SetTextColor, pdf.SetTextColorCMYK)
+		mk, _ := u.resolve(wd["MK"]).(pdfDict)
+		var opts FormFieldOptions
+		if clr, ok := updateMKColor(u.resolve(mk["BG"])); ok {
+			updateSetColor(clr, pdf.SetFillColorGray, pdf.SetFillColor, pdf.SetFillColorCMYK)
+			opts.Fill = true
+		}
+		if clr, ok := updateMKColor(u.resolve(mk["BC"])); ok {
+			updateSetColor(clr, pdf.SetDrawColorGray, pdf.SetDrawColor, pdf.SetDrawColorCMYK)
+			opts.Border = true
+			pdf.SetLineWidth(1)
+		}
+		var lines []string
+		switch {
+		case value == "":
+		case flags&formFlagPassword != 0:
+			lines = []string{strings.Repeat("*", len([]rune(value)))}
+		case flags&formFlagMultiline != 0:
+			lines = pdf.SplitText(value, wdPt-4)
+		default:
+			lines = []string{value}
+		}
+		pdf.out(string(pdf.formTextAppearance(lines, wdPt, htPt, q, flags&formFlagMultiline != 0, opts)))
+		appearance := u.render(pdf, wdPt, htPt)
+		if appearance == nil {
+			return
+		}
+		wd["AP"] = pdfDict{"N": u.add(appearance)}
+	}
+}
+
+// fieldFont returns the core font family and style closest to the font
+// resource name of the form's default resources
+func (u *PDFUpdate) fieldFont(form pdfDict, name string) (family, style string) {
+	base := name
+	if form != nil {
+		dr, _ := u.resolve(form["DR"]).(pdfDict)
+		fonts, _ := u.resolve(dr["Font"]).(pdfDict)
+		if font, ok := u.resolve(fonts[pdfName(name)]).(pdfDict); ok {
+			if s, ok := font["BaseFont"].(pdfName); ok {
+				base = string(s)
+			}
+		}
+	}
+	if j := strings.IndexByte(base, '+'); j >= 0 {
+		base = base[j+1:]
+	}
+	lower := strings.ToLower(base)
+	switch {
+	case strings.HasPrefix(lower, "cour"):
+		family = "Courier"
+	case strings.HasPrefix(lower, "times") || strings.HasPrefix(lower, "tiro"):
+		family = "Times"
+	default:
+		family = "Helvetica"
+	}
+	if strings.Contains(lower, "bold") {
+		style += "B"
+	}
+	if strings.Contains(lower, "italic") || strings.Contains(lower, "oblique") {
+		style += "I"
+	}
+	return
+}
+
+// updateDAColor returns the color components set by the operators of a
+// default appearance string
+func updateDAColor(s string) []float64 {
+	fields := strings.Fields(s)
+	v := make([]float64, len(fields)-1)
+	for j := range v {
+		fmt.Sscan(fields[j], &v[j])
+	}
+	return v
+}
+
+// updateMKColor returns the color components of a widget border or
+// background array
+func updateMKColor(obj interface{}) ([]float64, bool) {
+	arr, _ := obj.(pdfArray)
+	if len(arr) != 1 && len(arr) != 3 && len(arr) != 4 {
+		return nil, false
+	}
+	v := make([]float64, len(arr))
+	for j, e := range arr {
+		v[j] = pdfNumber(e)
+	}
+	return v, true
+}
+
+// updateSetColor applies a gray, RGB or CMYK color of components between 0
+// and 1 with the setters of one of the colors of a document
+func updateSetColor(v []float64, gray func(int), rgb func(r, g, b int), cmyk func(c, m, y, k byte)) {
+	level := func(j int) int {
+		return int(math.Round(math.Max(0, math.Min(1, v[j])) * 255))
+	}
+	ink := func(j int) byte {
+		return byte(math.Round(math.Max(0, math.Min(1, v[j])) * 100))
+	}
+	switch len(v) {
+	case 1:
+		gray(level(0))
+	case 3:
+		rgb(level(0), level(1), level(2))
+	case 4:
+		cmyk(ink(0), ink(1), ink(2), ink(3))
+	}
+}
+
+// Sign digitally signs the updated document with an approval signature. The
+// signature is placed in the unsigned signature field named by
+// opts.FieldName when the document has one; otherwise an invisible field is
+// added to the first page. Only one signature can be applied per update;
+// apply further signatures in later updates.
+func (u *PDFUpdate) Sign(opts SignatureOptions) {
+	if !u.permit(updateFillForms, "signing") {
+		return
+	}
+	if u.sign != nil {
+		u.err = fmt.Errorf("the update is already signed")
+		return
+	}
+	if err := signCheck(&opts); err != nil {
+		u.err = err
+		return
+	}
+	sig := &signRecType{opts: opts, size: signSize(opts)}
+	var fld pdfDict
+	if opts.FieldName != "" {
+		if num := u.field(opts.FieldName); num > 0 {
+			fld = u.edit(num)
+			if u.inherited(fld, "FT") != pdfName("Sig") {
+				u.err = fmt.Errorf("form field %q is not a signature field", opts.FieldName)
+				return
+			}
+			if fld["V"] != nil {
+				u.err = fmt.Errorf("signature field %q is already signed", opts.FieldName)
+				return
+			}
+		}
+	}
+	form := u.acroForm()
+	if fld == nil {
+		if len(u.pages) == 0 {
+			u.err = fmt.Errorf("signing requires a page")
+			return
+		}
+		name := opts.FieldName
+		for j := 1; name == "" || u.field(name) > 0; j++ {
+			name = fmt.Sprintf("Signature%d", j)
+		}
+		fld = pdfDict{"Subtype": pdfName("Widget"), "FT": pdfName("Sig"), "T": updateText(name),
+			"Rect": pdfArray{0, 0, 0, 0}, "F": 4 | 128}
+		ref := u.addAnnot(1, fld)
+		fields, _ := u.resolve(form["Fields"]).(pdfArray)
+		form["Fields"] = append(append(pdfArray{}, fields...), ref)
+	}
+	form["SigFlags"] = 3
+	fld["V"] = u.add(sig)
+	u.sign = sig
+}
+
+// putSig writes the signature dictionary with placeholders for the byte
+// range and the signature, recording their positions
+func (u *PDFUpdate) putSig(b *bytes.Buffer, num int, sig *signRecType) {
+	fmt.Fprintf(b, "%d 0 obj\n<</Type /Sig /Filter /Adobe.PPKLite /SubFilter /ETSI.CAdES.detached\n/ByteRange ", num)
+	sig.byteRangePos = b.Len()
+	b.WriteString("[0 0 0 0]" + strings.Repeat(" ", signByteRangeWidth-9) + "\n/Contents ")
+	sig.contentsPos = b.Len()
+	b.WriteString("<" + strings.Repeat("0", 2*sig.size) + ">\n")
+	tm := sig.opts.SigningTime
+	if tm.IsZero() {
+		tm = time.Now()
+	}
+	dict := pdfDict{"M": pdfString("D:" + tm.Format("20060102150405-07'00'"))}
+	for key, val := range map[pdfName]string{"Name": sig.opts.Name, "Reason": sig.opts.Reason,
+		"Location": sig.opts.Location, "ContactInfo": sig.opts.ContactInfo} {
+		if val != "" {
+			dict[key] = updateText(val)
+		}
+	}
+	var d bytes.Buffer
+	pdfWriteObject(&d, dict, pdfKeepNumber)
+	b.Write(d.Bytes()[2:])
+	b.WriteString("\nendobj\n")
+}
+
+// Output writes the original document followed by the incremental update to
+// w. The changes are not written when an error has occurred.
+func (u *PDFUpdate) Output(w io.Writer) error {
+	if u.err != nil {
+		return u.err
+	}
+	data := u.r.data
+	var b bytes.Buffer
+	b.Grow(len(data) + 4096)
+	b.Write(data)
+	if len(u.objs) == 0 {
+		_, err := w.Write(b.Bytes())
+		return err
+	}
+	if c := data[len(data)-1]; c != '\n' && c != '\r' {
+		b.WriteByte('\n')
+	}
+	nums := make([]int, 0, len(u.objs))
+	for num := range u.objs {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	offsets := make(map[int]int, len(nums)+1)
+	for _, num := range nums {
+		offsets[num] = b.Len()
+		if sig, ok := u.objs[num].(*signRecType); ok {
+			u.putSig(&b, num, sig)
+		} else {
+			pdfWriteIndirect(&b, num, u.objs[num], pdfKeepNumber)
+		}
+	}
+	trailer := pdfDict{}
+	for key, val := range u.r.trailer {
+		switch key {
+		case "Prev", "XRefStm", "Type", "W", "Index", "Filter", "DecodeParms", "Length", "DL":
+		default:
+			trailer[key] = val
+		}
+	}
+	trailer["Prev"] = u.r.xrefPos
+	xrefPos := b.Len()
+	if bytes.HasPrefix(bytes.TrimLeft(data[u.r.xrefPos:], " \t\r\n"), []byte("xref")) {
+		b.WriteString("xref\n")
+		for j := 0; j < len(nums); {
+			k := j + 1
+			for k < len(nums) && nums[k] == nums[k-1]+1 {
+				k++
+			}
+			fmt.Fprintf(&b, "%d %d\n", nums[j], k-j)
+			for _, num := range nums[j:k] {
+				fmt.Fprintf(&b, "%010d 00000 n \n", offsets[num])
+			}
+			j = k
+		}
+		trailer["Size"] = u.size
+		b.WriteString("trailer\n")
+		pdfWriteObject(&b, trailer, pdfKeepNumber)
+		b.WriteByte('\n')
+	} else {
+		// a document with a cross-reference stream is updated with another
+		xrefNum := u.size
+		offsets[xrefNum] = xrefPos
+		nums = append(nums, xrefNum)
+		w2 := pdfByteWidth(xrefPos)
+		var rows bytes.Buffer
+		var index pdfArray
+		for j := 0; j < len(nums); {
+			k := j + 1
+			for k < len(nums) && nums[k] == nums[k-1]+1 {
+				k++
+			}
+			index = append(index, nums[j], k-j)
+			for _, num := range nums[j:k] {
+				rows.WriteByte(1)
+				pdfPutBytes(&rows, offsets[num], w2)
+				rows.WriteByte(0)
+			}
+			j = k
+		}
+		trailer["Type"] = pdfName("XRef")
+		trailer["Size"] = xrefNum + 1
+		trailer["Index"] = index
+		trailer["W"] = pdfArray{1, w2, 1}
+		trailer["Filter"] = pdfName("FlateDecode")
+		mem := xmem.compress(rows.Bytes())
+		pdfWriteIndirect(&b, xrefNum, &pdfStream{dict: trailer, data: mem.copy()}, pdfKeepNumber)
+		mem.release()
+	}
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", xrefPos)
+	out := b.Bytes()
+	if u.sign != nil {
+		if err := signFill(out, *u.sign); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+// OutputFile writes the updated document to fileStr, which may be the file
+// the document was read from
+func (u *PDFUpdate) OutputFile(fileStr string) error {
+	var buf bytes.Buffer
+	if err := u.Output(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(fileStr, buf.Bytes(), 0644)
+}
@@ -0,0 +1,344 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// updateTestDoc returns a document of two pages with form fields
+func updateTestDoc(t *testing.T, setup func(pdf *Bdf)) []byte {
+	t.Helper()
+	pdf := New("P", "mm", "A4", "")
+	setup(pdf)
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.AddPage()
+	pdf.Cell(40, 10, "Invoice 42")
+	pdf.TextField("name", 20, 30, 60, 8, "", FormFieldOptions{Border: true})
+	pdf.CheckBox("paid", 20, 45, 5, false, FormFieldOptions{})
+	pdf.RadioButton("method", "card", 20, 55, 5, true, FormFieldOptions{})
+	pdf.RadioButton("method", "cash", 30, 55, 5, false, FormFieldOptions{})
+	pdf.ComboBox("currency", 20, 65, 30, 8, []string{"EUR", "USD"}, "EUR", FormFieldOptions{})
+	pdf.AddPage()
+	pdf.Cell(40, 10, "Terms")
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// updateTestOutput writes an update and checks that it keeps the original
+// bytes
+func updateTestOutput(t *testing.T, u *PDFUpdate, orig []byte) (*PDFReader, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := u.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, orig) {
+		t.Fatal("update changed the original bytes")
+	}
+	r, err := newPDFReader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, data
+}
+
+// updateTestAnnots returns the subtypes of the annotations of a page
+func updateTestAnnots(r *PDFReader, page int) (list []string) {
+	annots, _ := r.resolve(r.pages[page-1]["Annots"]).(pdfArray)
+	for _, a := range annots {
+		if d, ok := r.resolve(a).(pdfDict); ok {
+			list = append(list, string(d["Subtype"].(pdfName)))
+		}
+	}
+	return
+}
+
+func TestPDFUpdateAnnotations(t *testing.T) {
+	orig := updateTestDoc(t, func(pdf *Bdf) {})
+	u, err := NewPDFUpdate(bytes.NewReader(orig), "mm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.PageCount() != 2 {
+		t.Fatalf("%d pages", u.PageCount())
+	}
+	if wd, ht := u.PageSize(1); int(wd+0.5) != 210 || int(ht+0.5) != 297 {
+		t.Fatalf("page size %.2f by %.2f", wd, ht)
+	}
+	u.AddLink(1, 20, 100, 40, 10, "https://example.com")
+	u.AddNote(1, 100, 20, "Reviewer", "Check the total")
+	u.Stamp(1, 140, 20, 50, 20, func(pdf *Bdf) {
+		pdf.SetFont("Helvetica", "B", 14)
+		pdf.SetTextColor(200, 0, 0)
+		pdf.CellFormat(50, 20, "APPROVED", "1", 0, "C", false, 0, "")
+	})
+	r, data := updateTestOutput(t, u, orig)
+	annots := updateTestAnnots(r, 1)
+	if got := strings.Join(annots[len(annots)-3:], " "); got != "Link Text Stamp" {
+		t.Fatalf("annotations %s", got)
+	}
+	annot, _ := r.resolve(r.resolve(r.pages[0]["Annots"]).(pdfArray)[len(annots)-1]).(pdfDict)
+	rect := annot["Rect"].(pdfArray)
+	if x := pdfNumber(rect[0]); x < 396.8 || x > 396.9 {
+		t.Fatalf("stamp rectangle %v", rect)
+	}
+	ap, _ := r.resolve(annot["AP"]).(pdfDict)
+	stm, ok := r.resolve(ap["N"]).(*pdfStream)
+	if !ok {
+		t.Fatal("stamp appearance not found")
+	}
+	content, err := r.decode(stm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(content, []byte("(APPROVED)Tj")) {
+		t.Fatalf("stamp appearance %q", content)
+	}
+	res, _ := r.resolve(stm.dict["Resources"]).(pdfDict)
+	if fonts, _ := r.resolve(res["Font"]).(pdfDict); len(fonts) != 1 {
+		t.Fatal("stamp font not copied")
+	}
+	// a second update is chained to the first
+	u, err = NewPDFUpdate(bytes.NewReader(data), "mm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.AddNote(2, 20, 20, "", "Second step")
+	r, _ = updateTestOutput(t, u, data)
+	if got := updateTestAnnots(r, 2); len(got) != 1 || got[0] != "Text" {
+		t.Fatalf("page 2 annotations %v", got)
+	}
+	if len(updateTestAnnots(r, 1)) != len(annots) {
+		t.Fatal("annotations of page 1 lost")
+	}
+	u.AddLink(3, 0, 0, 10, 10, "https://example.com")
+	if u.Error() == nil {
+		t.Fatal("expected error for missing page")
+	}
+}
+
+func TestPDFUpdateForms(t *testing.T) {
+	orig := updateTestDoc(t, func(pdf *Bdf) {})
+	u, err := NewPDFUpdate(bytes.NewReader(orig), "mm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.SetFieldValue("name", "Jane Doe")
+	u.SetFieldValue("paid", "Yes")
+	u.SetFieldValue("method", "cash")
+	u.SetFieldValue("currency", "USD")
+	r, _ := updateTestOutput(t, u, orig)
+	values := map[string]interface{}{}
+	form, _ := r.resolve(r.resolve(r.trailer["Root"]).(pdfDict)["AcroForm"]).(pdfDict)
+	for _, e := range r.resolve(form["Fields"]).(pdfArray) {
+		fld := r.resolve(e).(pdfDict)
+		name := string(fld["T"].(pdfString))
+		values[name] = fld["V"]
+		if name == "method" {
+			for _, kid := range fld["Kids"].(pdfArray) {
+				w := r.resolve(kid).(pdfDict)
+				ap := r.resolve(w["AP"]).(pdfDict)
+				_, cash := r.resolve(ap["N"]).(pdfDict)["cash"]
+				if want := map[bool]pdfName{true: "cash", false: "Off"}[cash]; w["AS"] != want {
+					t.Fatalf("radio button state %v", w["AS"])
+				}
+			}
+		}
+		if name == "name" {
+			ap := r.resolve(fld["AP"]).(pdfDict)
+			content, _ := r.decode(r.resolve(ap["N"]).(*pdfStream))
+			if !bytes.Contains(content, []byte("(Jane Doe) Tj")) || !bytes.Contains(content, []byte("re S")) {
+				t.Fatalf("text field appearance %q", content)
+			}
+		}
+	}
+	want := map[string]string{"name": "Jane Doe", "paid": "Yes", "method": "cash", "currency": "USD"}
+	for name, v := range want {
+		if fmt.Sprintf("%s", values[name]) != v {
+			t.Fatalf("field %s has value %v", name, values[name])
+		}
+	}
+	for _, test := range []struct{ name, value string }{
+		{"missing", "x"}, {"currency", "GBP"}, {"method", "cheque"},
+	} {
+		u, _ = NewPDFUpdate(bytes.NewReader(orig), "mm")
+		u.SetFieldValue(test.name, test.value)
+		if u.Error() == nil {
+			t.Fatalf("expected error setting %s to %s", test.name, test.value)
+		}
+	}
+}
+
+// updateTestSignatures verifies the signatures of data in the order they
+// were applied and returns the length of the revision each covers
+func updateTestSignatures(t *testing.T, data []byte, keys ...*ecdsa.PrivateKey) (ends []int) {
+	t.Helper()
+	re := regexp.MustCompile(`/ByteRange \[0 (\d+) (\d+) (\d+)\]`)
+	all := re.FindAllSubmatch(data, -1)
+	if len(all) != len(keys) {
+		t.Fatalf("%d signatures, want %d", len(all), len(keys))
+	}
+	for j, m := range all {
+		var br [3]int
+		for k := range br {
+			br[k], _ = strconv.Atoi(string(m[k+1]))
+		}
+		end := br[1] + br[2]
+		sig, err := hex.DecodeString(string(data[br[0]+1 : br[1]-1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed := append(append([]byte(nil), data[:br[0]]...), data[br[1]:end]...)
+		verifyCMS(t, sig, signed, &keys[j].PublicKey)
+		ends = append(ends, end)
+	}
+	return
+}
+
+func TestPDFUpdateSigned(t *testing.T) {
+	caKey, ca := testCertificate(t, "Test CA", nil, nil, nil)
+	key1, cert1 := testCertificate(t, "Clerk", ca, caKey, nil)
+	key2, cert2 := testCertificate(t, "Manager", ca, caKey, nil)
+	orig := updateTestDoc(t, func(pdf *Bdf) {})
+	u, err := NewPDFUpdate(bytes.NewReader(orig), "mm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp := func(text string) func(pdf *Bdf) {
+		return func(pdf *Bdf) {
+			pdf.SetFont("Helvetica", "B", 12)
+			pdf.CellFormat(50, 15, text, "1", 0, "C", false, 0, "")
+		}
+	}
+	// each step of the workflow stamps and signs the document
+	u.Stamp(1, 140, 20, 50, 15, stamp("CHECKED"))
+	u.Sign(SignatureOptions{Signer: key1, Certificates: []*x509.Certificate{cert1, ca}, Reason: "Checked"})
+	_, step1 := updateTestOutput(t, u, orig)
+	if ends := updateTestSignatures(t, step1, key1); ends[0] != len(step1) {
+		t.Fatalf("signature covers %d of %d bytes", ends[0], len(step1))
+	}
+	u, err = NewPDFUpdate(bytes.NewReader(step1), "mm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Stamp(1, 140, 40, 50, 15, stamp("APPROVED"))
+	u.SetFieldValue("paid", "Yes")
+	u.Sign(SignatureOptions{Signer: key2, Certificates: []*x509.Certificate{cert2, ca}, Reason: "Approved"})
+	r, step2 := updateTestOutput(t, u, step1)
+	ends := updateTestSignatures(t, step2, key1, key2)
+	if ends[0] != len(step1) || ends[1] != len(step2) {
+		t.Fatalf("signatures cover %v, revisions end at %d and %d", ends, len(step1), len(step2))
+	}
+	form, _ := r.resolve(r.resolve(r.trailer["Root"]).(pdfDict)["AcroForm"]).(pdfDict)
+	var names []string
+	for _, e := range r.resolve(form["Fields"]).(pdfArray) {
+		fld := r.resolve(e).(pdfDict)
+		if fld["FT"] == pdfName("Sig") {
+			names = append(names, string(fld["T"].(pdfString)))
+		}
+	}
+	if strings.Join(names, " ") != "Signature1 Signature2" || form["SigFlags"] != 3 {
+		t.Fatalf("signature fields %v", names)
+	}
+}
+
+func TestPDFUpdateCertified(t *testing.T) {
+	orig := updateTestDoc(t, func(pdf *Bdf) {})
+	certify := func(p int) []byte {
+		u, err := NewPDFUpdate(bytes.NewReader(orig), "pt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := u.add(pdfDict{"Type": pdfName("Sig"), "Reference": pdfArray{pdfDict{"Type": pdfName("SigRef"),
+			"TransformMethod": pdfName("DocMDP"), "TransformParams": pdfDict{"P": p}}}})
+		u.root()["Perms"] = pdfDict{"DocMDP": sig}
+		_, data := updateTestOutput(t, u, orig)
+		return data
+	}
+	for _, test := range []struct {
+		p     int
+		fnc   func(u *PDFUpdate)
+		allow bool
+	}{
+		{1, func(u *PDFUpdate) { u.SetFieldValue("name", "x") }, false},
+		{2, func(u *PDFUpdate) { u.SetFieldValue("name", "x") }, true},
+		{2, func(u *PDFUpdate) { u.AddNote(1, 10, 10, "", "x") }, false},
+		{3, func(u *PDFUpdate) { u.AddNote(1, 10, 10, "", "x") }, true},
+		{3, func(u *PDFUpdate) { u.AddPages(u.r) }, false},
+	} {
+		u, err := NewPDFUpdate(bytes.NewReader(certify(test.p)), "pt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.fnc(u)
+		if (u.Error() == nil) != test.allow {
+			t.Fatalf("P %d: error %v", test.p, u.Error())
+		}
+	}
+}
+
+func TestPDFUpdatePages(t *testing.T) {
+	orig := updateTestDoc(t, func(pdf *Bdf) { pdf.SetObjectStreams(true) })
+	pdf := New("L", "mm", "A5", "")
+	pdf.SetFont("Times", "", 12)
+	pdf.AddPage()
+	pdf.CellFormat(40, 10, "Appendix", "", 0, "", false, 0, "https://example.com/appendix")
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	src, err := NewPDFReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := NewPDFUpdate(bytes.NewReader(orig), "mm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.AddPages(src)
+	u.AddNote(3, 10, 10, "", "Appendix added")
+	r, data := updateTestOutput(t, u, orig)
+	if r.NumPages() != 3 {
+		t.Fatalf("%d pages", r.NumPages())
+	}
+	if got := strings.Join(updateTestAnnots(r, 3), " "); got != "Link Text" {
+		t.Fatalf("annotations of the added page: %s", got)
+	}
+	if wd, ht := u.PageSize(3); int(wd+0.5) != 210 || int(ht+0.5) != 148 {
+		t.Fatalf("added page size %.2f by %.2f", wd, ht)
+	}
+	if !bytes.Contains(data[len(orig):], []byte("/Type /XRef")) {
+		t.Fatal("update of a document with a cross-reference stream lacks one")
+	}
+}
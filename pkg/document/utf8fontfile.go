@@ -59,6 +59,12 @@ type utf8FontFile struct {
 	DefaultWidth         float64
 	symbolData           map[int]map[string][]int
 	CodeSymbolDictionary map[int]int
+	otl                  *otLayout      // OpenType layout tables, parsed on first use
+	otlMissing           bool           // font has no layout tables
+	glyphCIDs            map[int]int    // glyph to CID used for shaped text
+	shapedCIDs           map[int]int    // CIDs allocated for glyphs without code point
+	cidText              map[int]string // text of the allocated CIDs
+	nextCID              int
 }
 
 type tableDescription struct {
@@ -543,6 +549,12 @@ func (utf *utf8FontFile) parseSymbols(usedRunes map[int]int) (map[int]int, map[i
 		}
 		utf.LastRune = max(utf.LastRune, char)
 	}
+	for cid, gid := range utf.shapedCIDs {
+		if _, OK := usedRunes[cid]; OK {
+			symbolCollection[gid] = cid
+			charSymbolPairCollection[cid] = gid
+		}
+	}
 
 	begin := utf.tableDescriptions["glyf"].position
 
@@ -0,0 +1,242 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"math"
+)
+
+// WatermarkType describes a watermark or stamp added to the pages of a
+// document with AddWatermark().
+//
+// Text is drawn with FontFamily (Helvetica when empty), FontStyle and
+// FontSize in points. A zero FontSize sizes the text to span three quarters
+// of the page along the direction of the watermark. When Border is set, a
+// frame is drawn around the text with LineWidth, as for a rubber stamp.
+//
+// Alternatively ImageName names an image, registered beforehand or loaded
+// like Image() does, drawn with Width and Height. If one of them is zero it
+// follows the proportions of the image; if both are zero the image spans half
+// the width of the page.
+//
+// The watermark is centered on Position, or on the center of the page when
+// Position is nil, and rotated by Angle degrees counter-clockwise. Color
+// applies to text and frame. Alpha is the opacity from 0 to 1, zero
+// selecting 0.3, and BlendMode a blend mode accepted by SetAlpha().
+//
+// The watermark is drawn behind the content of the page unless Above is set.
+// Pages lists the pages, counting from 1, that receive the watermark; all
+// pages do when it is empty.
+type WatermarkType struct {
+	Text       string
+	FontFamily string
+	FontStyle  string
+	FontSize   float64
+	Border     bool
+	LineWidth  float64
+	ImageName  string
+	Width      float64
+	Height     float64
+	Position   *PointType
+	Angle      float64
+	Color      RGBType
+	Alpha      float64
+	BlendMode  string
+	Above      bool
+	Pages      []int
+}
+
+// AddWatermark adds a watermark to the pages of the document. Watermarks are
+// applied when the document is closed, so they also reach pages added after
+// this call. Several watermarks are drawn in the order in which they were
+// added. In a tagged document they are marked as artifacts.
+func (f *Bdf) AddWatermark(wm WatermarkType) {
+	if f.err != nil {
+		return
+	}
+	if wm.Text == "" && wm.ImageName == "" {
+		f.SetErrorf("watermark has neither text nor image")
+		return
+	}
+	if wm.Alpha < 0 || wm.Alpha > 1 {
+		f.SetErrorf("watermark alpha value (0.0 - 1.0) is out of range: %.3f", wm.Alpha)
+		return
+	}
+	f.watermarks = append(f.watermarks, wm)
+}
+
+// pageDims returns the width and height of page n in user units
+func (f *Bdf) pageDims(n int) (wd, ht float64) {
+	if sz, ok := f.pageSizes[n]; ok {
+		return sz.Wd / f.k, sz.Ht / f.k
+	}
+	if f.defOrientation == "P" {
+		return f.defPageSize.Wd, f.defPageSize.Ht
+	}
+	return f.defPageSize.Ht, f.defPageSize.Wd
+}
+
+// putWatermarks draws the watermarks on their pages. It is called by Close()
+// while the last page is still open and, when streaming, before completed
+// pages are written.
+func (f *Bdf) putWatermarks() {
+	if len(f.watermarks) == 0 || f.err != nil {
+		return
+	}
+	// The watermarks are enclosed in q and Q
+	st := f.saveDrawState()
+	defer f.restoreDrawState(st)
+
+	// When streaming, the watermarks of earlier pages have been drawn
+	// before the pages were written
+	for n := f.stream.marked + 1; n < len(f.pages); n++ {
+		var behind, above []*WatermarkType
+		for j := range f.watermarks {
+			wm := &f.watermarks[j]
+			if !wm.onPage(n) {
+				continue
+			}
+			if wm.Above {
+				above = append(above, wm)
+			} else {
+				behind = append(behind, wm)
+			}
+		}
+		if len(behind)+len(above) == 0 {
+			continue
+		}
+		f.page = n
+		f.w, f.h = f.pageDims(n)
+		f.wPt, f.hPt = f.w*f.k, f.h*f.k
+		content := f.pages[n]
+		f.pages[n] = new(bytes.Buffer)
+		for _, wm := range behind {
+			f.watermark(wm)
+		}
+		if len(above) > 0 {
+			// The page content may leave the graphics state changed
+			f.out("q")
+			f.pages[n].Write(content.Bytes())
+			f.out("Q")
+		} else {
+			f.pages[n].Write(content.Bytes())
+		}
+		for _, wm := range above {
+			f.watermark(wm)
+		}
+		if f.err != nil {
+			return
+		}
+	}
+	f.stream.marked = len(f.pages) - 1
+}
+
+// onPage reports whether the watermark applies to page n
+func (wm *WatermarkType) onPage(n int) bool {
+	if len(wm.Pages) == 0 {
+		return true
+	}
+	for _, p := range wm.Pages {
+		if p == n {
+			return true
+		}
+	}
+	return false
+}
+
+// watermark draws a watermark on the current page
+func (f *Bdf) watermark(wm *WatermarkType) {
+	cx, cy := f.w/2, f.h/2
+	if wm.Position != nil {
+		cx, cy = wm.Position.X, wm.Position.Y
+	}
+	alpha := wm.Alpha
+	if alpha == 0 {
+		alpha = 0.3
+	}
+	f.out("q")
+	f.BeginArtifact()
+	f.SetAlpha(alpha, wm.BlendMode)
+	f.TransformBegin()
+	f.TransformRotate(wm.Angle, cx, cy)
+	if wm.ImageName != "" {
+		info := f.RegisterImageOptions(wm.ImageName, ImageOptions{})
+		if f.err == nil {
+			wd, ht := wm.Width, wm.Height
+			switch {
+			case wd == 0 && ht == 0:
+				wd = f.w / 2
+				ht = wd * info.h / info.w
+			case wd == 0:
+				wd = ht * info.w / info.h
+			case ht == 0:
+				ht = wd * info.h / info.w
+			}
+			f.ImageOptions(wm.ImageName, cx-wd/2, cy-ht/2, wd, ht, false, ImageOptions{}, 0, "")
+		}
+	} else {
+		family := wm.FontFamily
+		if family == "" {
+			family = "Helvetica"
+		}
+		sizePt := wm.FontSize
+		if sizePt <= 0 {
+			f.SetFont(family, wm.FontStyle, 100)
+			if wd := f.GetStringWidth(wm.Text); wd > 0 {
+				sizePt = 75 * f.watermarkSpan(wm.Angle) / wd
+			}
+		}
+		f.SetFont(family, wm.FontStyle, sizePt)
+		f.SetTextColor(wm.Color.R, wm.Color.G, wm.Color.B)
+		wd := f.GetStringWidth(wm.Text)
+		// The cap height of the core fonts is about 0.7 of the font size
+		capHt := 0.7 * f.fontSize
+		f.Text(cx-wd/2, cy+capHt/2, wm.Text)
+		if wm.Border {
+			lineWd := wm.LineWidth
+			if lineWd <= 0 {
+				lineWd = f.fontSize / 15
+			}
+			pad := 0.4 * f.fontSize
+			f.SetDrawColor(wm.Color.R, wm.Color.G, wm.Color.B)
+			f.SetLineWidth(lineWd)
+			f.Rect(cx-wd/2-pad, cy-capHt/2-pad, wd+2*pad, capHt+2*pad, "D")
+		}
+	}
+	f.TransformEnd()
+	f.EndArtifact()
+	f.out("Q")
+}
+
+// watermarkSpan returns the length of the line through the center of the
+// current page in the direction of angle degrees
+func (f *Bdf) watermarkSpan(angle float64) float64 {
+	a := angle * math.Pi / 180
+	span := math.Inf(1)
+	if c := math.Abs(math.Cos(a)); c > 1e-9 {
+		span = f.w / c
+	}
+	if s := math.Abs(math.Sin(a)); s > 1e-9 {
+		span = math.Min(span, f.h/s)
+	}
+	return span
+}
@@ -0,0 +1,108 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+// watermarkContents returns the decoded content stream of each page of a
+// document
+func watermarkContents(t *testing.T, data []byte) []string {
+	r, err := NewPDFReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp := New("P", "mm", "A4", "")
+	var list []string
+	for n := 1; n <= r.NumPages(); n++ {
+		tpl := imp.ImportPage(r, n, "")
+		if imp.Err() {
+			t.Fatal(imp.Error())
+		}
+		list = append(list, string(tpl.Bytes()))
+	}
+	return list
+}
+
+func TestWatermark(t *testing.T) {
+	pdf := New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.AddWatermark(WatermarkType{Text: "DRAFT", Angle: 45, Color: RGBType{R: 200}})
+	for j := 0; j < 2; j++ {
+		pdf.AddPage()
+		pdf.Cell(0, 10, "Body text")
+	}
+	pdf.AddPageFormat("L", SizeType{Wd: 100, Ht: 150})
+	pdf.Cell(0, 10, "Body text")
+	pdf.AddWatermark(WatermarkType{Text: "APPROVED", FontSize: 24, FontStyle: "B", Border: true,
+		Position: &PointType{X: 150, Y: 40}, Angle: 10, Alpha: 0.8, Above: true, Pages: []int{2}})
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	pages := watermarkContents(t, buf.Bytes())
+	for n, content := range pages {
+		draft, body := strings.Index(content, "(DRAFT)"), strings.Index(content, "(Body text)")
+		if draft < 0 || body < 0 || draft > body {
+			t.Fatalf("page %d: watermark is not behind the text", n+1)
+		}
+		stamp := strings.Index(content, "(APPROVED)")
+		if (n == 1) != (stamp > body) {
+			t.Fatalf("page %d: stamp at %d, text at %d", n+1, stamp, body)
+		}
+		fields := strings.Fields(content)
+		if watermarkCount(fields, "q") != watermarkCount(fields, "Q") {
+			t.Fatalf("page %d: unbalanced graphics state", n+1)
+		}
+	}
+	if wd, ht := pdf.pageDims(3); math.Abs(wd-150) > 0.01 || math.Abs(ht-100) > 0.01 {
+		t.Fatalf("landscape page is %.2f by %.2f", wd, ht)
+	}
+}
+
+func watermarkCount(list []string, s string) (count int) {
+	for _, str := range list {
+		if str == s {
+			count++
+		}
+	}
+	return
+}
+
+func TestWatermarkErrors(t *testing.T) {
+	for _, wm := range []WatermarkType{
+		{},
+		{Text: "X", Alpha: 1.5},
+		{Text: "X", BlendMode: "Glow"},
+		{ImageName: "missing.png"},
+	} {
+		pdf := New("P", "mm", "A4", "")
+		pdf.AddPage()
+		pdf.AddWatermark(wm)
+		if err := pdf.Output(&bytes.Buffer{}); err == nil {
+			t.Errorf("%+v: no error", wm)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package document
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/xml"
+	"strings"
+	"unicode/utf16"
+)
+
+// xmpEscape escapes s for use as XML character data
+func xmpEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// pdfStringToUTF8 converts a document information string, either UTF-16BE
+// with a byte order mark or ISO-8859-1, to UTF-8
+func pdfStringToUTF8(s string) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		u := make([]uint16, 0, len(s)/2)
+		for j := 2; j+1 < len(s); j += 2 {
+			u = append(u, uint16(s[j])<<8|uint16(s[j+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	r := make([]rune, len(s))
+	for j := 0; j < len(s); j++ {
+		r[j] = rune(s[j])
+	}
+	return string(r)
+}
+
+// xmpNeeded reports whether the document requires XMP metadata that the
+// application did not supply
+func (f *Bdf) xmpNeeded() bool {
+	return len(f.xmp) == 0 && (f.structTree.ua || f.pdfa.level != PDFANone)
+}
+
+// xmpGenerate builds an XMP packet mirroring the document information
+// dictionary, along with the conformance identifiers of the document. The
+// creation and modification dates are fixed so that both representations
+// agree.
+func (f *Bdf) xmpGenerate() []byte {
+	f.creationDate = timeOrNow(f.creationDate)
+	f.modDate = timeOrNow(f.modDate)
+	const dateFmt = "2006-01-02T15:04:05"
+	var s fmtBuffer
+	s.printf("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	s.printf("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	s.printf("<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	s.printf("<rdf:Description rdf:about=\"\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\">\n")
+	s.printf("<dc:format>application/pdf</dc:format>\n")
+	if f.title != "" {
+		s.printf("<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n",
+			xmpEscape(pdfStringToUTF8(f.title)))
+	}
+	if f.author != "" {
+		s.printf("<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n",
+			xmpEscape(pdfStringToUTF8(f.author)))
+	}
+	if f.subject != "" {
+		s.printf("<dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:description>\n",
+			xmpEscape(pdfStringToUTF8(f.subject)))
+	}
+	s.printf("</rdf:Description>\n")
+	s.printf("<rdf:Description rdf:about=\"\" xmlns:pdf=\"http://ns.adobe.com/pdf/1.3/\">\n")
+	if f.producer != "" {
+		s.printf("<pdf:Producer>%s</pdf:Producer>\n", xmpEscape(pdfStringToUTF8(f.producer)))
+	}
+	if f.keywords != "" {
+		s.printf("<pdf:Keywords>%s</pdf:Keywords>\n", xmpEscape(pdfStringToUTF8(f.keywords)))
+	}
+	s.printf("</rdf:Description>\n")
+	s.printf("<rdf:Description rdf:about=\"\" xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\">\n")
+	if f.creator != "" {
+		s.printf("<xmp:CreatorTool>%s</xmp:CreatorTool>\n", xmpEscape(pdfStringToUTF8(f.creator)))
+	}
+	s.printf("<xmp:CreateDate>%s</xmp:CreateDate>\n", f.creationDate.Format(dateFmt))
+	s.printf("<xmp:ModifyDate>%s</xmp:ModifyDate>\n", f.modDate.Format(dateFmt))
+	s.printf("</rdf:Description>\n")
+	if f.pdfa.level != PDFANone {
+		s.printf("<rdf:Description rdf:about=\"\" xmlns:pdfaid=\"http://www.aiim.org/pdfa/ns/id/\">\n")
+		s.printf("<pdfaid:part>%d</pdfaid:part>\n", f.pdfa.level)
+		s.printf("<pdfaid:conformance>B</pdfaid:conformance>\n")
+		s.printf("</rdf:Description>\n")
+	}
+	if f.structTree.ua {
+		s.printf("<rdf:Description rdf:about=\"\" xmlns:pdfuaid=\"http://www.aiim.org/pdfua/ns/id/\">\n")
+		s.printf("<pdfuaid:part>1</pdfuaid:part>\n")
+		s.printf("</rdf:Description>\n")
+	}
+	s.printf("</rdf:RDF>\n")
+	s.printf("</x:xmpmeta>\n")
+	s.printf("<?xpacket end=\"w\"?>")
+	return s.Bytes()
+}
@@ -0,0 +1,134 @@
+package anim
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/render/pkg/g2d/img"
+	"github.com/bhojpur/render/pkg/g2d/kit"
+)
+
+func record(t *testing.T) *Animation {
+	rec := NewRecorder(64, 48, 10, 6)
+	anim, err := rec.Record(func(gc *img.GraphicContext) bool {
+		if rec.Frame() == 3 {
+			// nothing moves in this frame
+			return false
+		}
+		gc.SetFillColor(color.White)
+		gc.Clear()
+		gc.SetFillColor(color.RGBA{0xc0, 0x20, 0x20, 0xff})
+		kit.Circle(gc, 8+float64(rec.Frame())*8, 24, 6)
+		gc.Fill()
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return anim
+}
+
+func TestRecord(t *testing.T) {
+	anim := record(t)
+	if len(anim.Frames) != 5 {
+		t.Fatalf("recorded %d frames, expected 5", len(anim.Frames))
+	}
+	if anim.Delays[2] != 200*time.Millisecond {
+		t.Fatalf("unchanged frame should extend the previous delay, got %v", anim.Delays[2])
+	}
+}
+
+func TestEncodeGIF(t *testing.T) {
+	anim := record(t)
+	var buf bytes.Buffer
+	if err := anim.EncodeGIF(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 5 {
+		t.Fatalf("decoded %d frames, expected 5", len(g.Image))
+	}
+	if g.Delay[2] != 20 {
+		t.Fatalf("frame delay %d, expected 20", g.Delay[2])
+	}
+	if g.Image[1].Bounds().Dx() >= 64 {
+		t.Fatalf("frame 1 not reduced to the changed region: %v", g.Image[1].Bounds())
+	}
+}
+
+func TestEncodeAPNG(t *testing.T) {
+	anim := record(t)
+	var buf bytes.Buffer
+	if err := anim.EncodeAPNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	pos := bytes.Index(data, []byte("acTL"))
+	if pos < 0 {
+		t.Fatal("acTL chunk missing")
+	}
+	if n := binary.BigEndian.Uint32(data[pos+4:]); n != 5 {
+		t.Fatalf("acTL declares %d frames, expected 5", n)
+	}
+	if n := bytes.Count(data, []byte("fdAT")); n != 4 {
+		t.Fatalf("found %d fdAT chunks, expected 4", n)
+	}
+	// the default image must be readable by a plain PNG decoder
+	m, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds().Dx() != 64 || m.Bounds().Dy() != 48 {
+		t.Fatalf("unexpected bounds %v", m.Bounds())
+	}
+}
+
+func TestEncodeAPNGAlpha(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for j := 0; j < len(frame.Pix); j += 4 {
+		// premultiplied, straight alpha is red 0xff at alpha 0x80
+		copy(frame.Pix[j:], []byte{0x80, 0, 0, 0x80})
+	}
+	anim := &Animation{Frames: []*image.RGBA{frame}, Delays: []time.Duration{time.Second}}
+	var buf bytes.Buffer
+	if err := anim.EncodeAPNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	m, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := color.NRGBAModel.Convert(m.At(1, 1)).(color.NRGBA)
+	if c != (color.NRGBA{0xff, 0, 0, 0x80}) {
+		t.Fatalf("decoded %v, expected straight red at alpha 0x80", c)
+	}
+}
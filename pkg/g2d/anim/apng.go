@@ -0,0 +1,203 @@
+package anim
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"io"
+	"time"
+)
+
+var errNoFrames = errors.New("anim: animation has no frames")
+
+// APNG dispose and blend operations, see the APNG specification
+const (
+	apngDisposeNone = 0
+	apngBlendSource = 0
+)
+
+// EncodeAPNG writes the animation as an animated PNG. Readers without APNG
+// support display the first frame. Frames are stored as 8-bit RGBA with
+// straight alpha, as PNG requires.
+func (a *Animation) EncodeAPNG(w io.Writer) error {
+	if len(a.Frames) == 0 {
+		return errNoFrames
+	}
+	bounds := a.Frames[0].Bounds()
+	width, height := uint32(bounds.Dx()), uint32(bounds.Dy())
+	enc := &apngWriter{w: w}
+	enc.write([]byte("\x89PNG\r\n\x1a\n"))
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // truecolor with alpha
+	enc.chunk("IHDR", ihdr)
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(a.Frames)))
+	binary.BigEndian.PutUint32(actl[4:], uint32(a.LoopCount))
+	enc.chunk("acTL", actl)
+
+	var seq uint32
+	for j, frame := range a.Frames {
+		num, den := delayFraction(a.Delays[j])
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], width)
+		binary.BigEndian.PutUint32(fctl[8:], height)
+		// x and y offsets stay zero
+		binary.BigEndian.PutUint16(fctl[20:], num)
+		binary.BigEndian.PutUint16(fctl[22:], den)
+		fctl[24] = apngDisposeNone
+		fctl[25] = apngBlendSource
+		enc.chunk("fcTL", fctl)
+		seq++
+
+		// image.RGBA is premultiplied, PNG samples are not
+		nrgba := image.NewNRGBA(image.Rect(0, 0, int(width), int(height)))
+		draw.Draw(nrgba, nrgba.Bounds(), frame, frame.Bounds().Min, draw.Src)
+		data, err := deflateRGBA(nrgba.Pix, nrgba.Stride, int(width), int(height))
+		if err != nil {
+			return err
+		}
+		if j == 0 {
+			enc.chunk("IDAT", data)
+		} else {
+			fdat := make([]byte, 4+len(data))
+			binary.BigEndian.PutUint32(fdat, seq)
+			copy(fdat[4:], data)
+			enc.chunk("fdAT", fdat)
+			seq++
+		}
+	}
+	enc.chunk("IEND", nil)
+	return enc.err
+}
+
+type apngWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *apngWriter) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *apngWriter) chunk(name string, data []byte) {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[0:], uint32(len(data)))
+	copy(hdr[4:], name)
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	e.write(hdr[:])
+	e.write(data)
+	e.write(sum[:])
+}
+
+// deflateRGBA filters each scanline with whichever of the None, Sub and Up
+// filters yields the smallest sum of absolute values and compresses the
+// result
+func deflateRGBA(pix []byte, stride, width, height int) ([]byte, error) {
+	const bpp = 4
+	n := width * bpp
+	var buf bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	prior := make([]byte, n)
+	candidates := [3][]byte{make([]byte, n+1), make([]byte, n+1), make([]byte, n+1)}
+	for y := 0; y < height; y++ {
+		row := pix[y*stride : y*stride+n]
+		none, sub, up := candidates[0], candidates[1], candidates[2]
+		none[0], sub[0], up[0] = 0, 1, 2
+		copy(none[1:], row)
+		for x := 0; x < n; x++ {
+			left := byte(0)
+			if x >= bpp {
+				left = row[x-bpp]
+			}
+			sub[x+1] = row[x] - left
+			up[x+1] = row[x] - prior[x]
+		}
+		best, bestSum := 0, -1
+		for j, c := range candidates {
+			sum := 0
+			for _, v := range c[1:] {
+				sum += absFiltered(v)
+			}
+			if bestSum < 0 || sum < bestSum {
+				best, bestSum = j, sum
+			}
+		}
+		if _, err = zw.Write(candidates[best]); err != nil {
+			return nil, err
+		}
+		copy(prior, row)
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// absFiltered interprets a filtered byte as a signed value, the usual
+// heuristic for choosing a PNG filter
+func absFiltered(v byte) int {
+	if v < 128 {
+		return int(v)
+	}
+	return 256 - int(v)
+}
+
+// delayFraction expresses d as a fraction of a second in 1/1000 units,
+// reduced to fit the 16 bit fields of the fcTL chunk
+func delayFraction(d time.Duration) (num, den uint16) {
+	ms := d.Milliseconds()
+	if ms < 0 {
+		ms = 0
+	}
+	if ms <= 0xffff {
+		return uint16(ms), 1000
+	}
+	cs := ms / 10
+	if cs <= 0xffff {
+		return uint16(cs), 100
+	}
+	s := ms / 1000
+	if s > 0xffff {
+		s = 0xffff
+	}
+	return uint16(s), 1
+}
@@ -0,0 +1,136 @@
+package anim
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+
+	"github.com/bhojpur/render/pkg/g2d/img"
+)
+
+// EncodeGIF writes the animation as an animated GIF. Every frame gets its own
+// palette built by opts.Quantizer (median cut by default) and, after the
+// first one, only the rectangle that changed since the previous frame is
+// stored. A nil opts selects 256 colors without dithering.
+func (a *Animation) EncodeGIF(w io.Writer, opts *img.EncodeOptions) error {
+	if len(a.Frames) == 0 {
+		return errNoFrames
+	}
+	o := img.EncodeOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	colors := 256
+	if o.Colors >= 2 && o.Colors < 256 {
+		colors = o.Colors
+	}
+	q := o.Quantizer
+	if q == nil {
+		q = img.MedianCut{}
+	}
+	var drawer draw.Drawer = draw.Src
+	if o.Dither {
+		drawer = draw.FloydSteinberg
+	}
+	bounds := a.Frames[0].Bounds()
+	g := &gif.GIF{
+		Config: image.Config{Width: bounds.Dx(), Height: bounds.Dy()},
+	}
+	switch {
+	case a.LoopCount == 0:
+		g.LoopCount = 0
+	case a.LoopCount == 1:
+		g.LoopCount = -1
+	default:
+		g.LoopCount = a.LoopCount - 1
+	}
+	var prev *image.RGBA
+	for j, frame := range a.Frames {
+		r := frame.Bounds()
+		if prev != nil {
+			r = changedRect(prev, frame)
+			if r.Empty() {
+				// GIF frames cannot be empty; keep a single pixel
+				r = image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+1, bounds.Min.Y+1)
+			}
+		}
+		sub := frame.SubImage(r)
+		pal := q.Quantize(make(color.Palette, 0, colors), sub)
+		if len(pal) > colors {
+			pal = pal[:colors]
+		}
+		pm := image.NewPaletted(r, pal)
+		drawer.Draw(pm, r, sub, r.Min)
+		g.Image = append(g.Image, pm)
+		g.Delay = append(g.Delay, centiseconds(a.Delays[j]))
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+		prev = frame
+	}
+	return gif.EncodeAll(w, g)
+}
+
+// changedRect returns the smallest rectangle containing every pixel that
+// differs between a and b
+func changedRect(a, b *image.RGBA) image.Rectangle {
+	r := b.Bounds()
+	minX, minY, maxX, maxY := r.Max.X, r.Max.Y, r.Min.X, r.Min.Y
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		rowA := a.Pix[a.PixOffset(r.Min.X, y):a.PixOffset(r.Max.X, y)]
+		rowB := b.Pix[b.PixOffset(r.Min.X, y):b.PixOffset(r.Max.X, y)]
+		if bytes.Equal(rowA, rowB) {
+			continue
+		}
+		if y < minY {
+			minY = y
+		}
+		maxY = y + 1
+		for x := 0; x < len(rowA); x += 4 {
+			if !bytes.Equal(rowA[x:x+4], rowB[x:x+4]) {
+				px := r.Min.X + x/4
+				if px < minX {
+					minX = px
+				}
+				if px+1 > maxX {
+					maxX = px + 1
+				}
+			}
+		}
+	}
+	if maxY == r.Min.Y {
+		return image.Rectangle{}
+	}
+	return image.Rect(minX, minY, maxX, maxY)
+}
+
+// centiseconds converts a frame delay to GIF units
+func centiseconds(d time.Duration) int {
+	cs := int((d + 5*time.Millisecond) / (10 * time.Millisecond))
+	if cs < 1 {
+		cs = 1
+	}
+	return cs
+}
@@ -0,0 +1,153 @@
+package anim
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/render/pkg/g2d/img"
+)
+
+// RenderFunc draws one frame on the graphic context. It has the same
+// signature as canvas.RenderFunc, so a browser render loop can be recorded
+// headless after a conversion. Returning false signals that nothing changed
+// since the previous frame, which is then displayed for longer instead of
+// being repeated.
+type RenderFunc func(gc *img.GraphicContext) bool
+
+// Recorder calls a RenderFunc for a fixed number of frames at a fixed
+// timestep on a raster graphic context.
+type Recorder struct {
+	Width, Height int
+	FPS           float64
+	Frames        int
+	LoopCount     int         // number of times the animation plays, 0 loops forever
+	Background    color.Color // used to clear the canvas before the first frame
+	DPI           int         // resolution of the graphic context, 0 keeps the default
+
+	frame int
+}
+
+// Animation holds the recorded frames and the display duration of each one
+type Animation struct {
+	Frames    []*image.RGBA
+	Delays    []time.Duration
+	LoopCount int
+}
+
+// NewRecorder returns a recorder producing frames of the given size
+func NewRecorder(width, height int, fps float64, frames int) *Recorder {
+	return &Recorder{
+		Width:      width,
+		Height:     height,
+		FPS:        fps,
+		Frames:     frames,
+		Background: color.White,
+	}
+}
+
+// Frame returns the index of the frame being rendered. It is meant to be
+// called from within the RenderFunc.
+func (r *Recorder) Frame() int {
+	return r.frame
+}
+
+// TimeStep returns the duration of a single frame
+func (r *Recorder) TimeStep() time.Duration {
+	return time.Duration(float64(time.Second) / r.FPS)
+}
+
+// Time returns the animation time of the frame being rendered
+func (r *Recorder) Time() time.Duration {
+	return time.Duration(r.frame) * r.TimeStep()
+}
+
+// Record runs the render loop and returns the resulting animation. Frames
+// for which rf reports no change extend the delay of the previous frame.
+func (r *Recorder) Record(rf RenderFunc) (*Animation, error) {
+	if r.Width <= 0 || r.Height <= 0 {
+		return nil, errors.New("anim: invalid frame size")
+	}
+	if r.FPS <= 0 || r.Frames <= 0 {
+		return nil, errors.New("anim: frame rate and frame count must be positive")
+	}
+	if rf == nil {
+		return nil, errors.New("anim: nil RenderFunc")
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, r.Width, r.Height))
+	if r.Background != nil {
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(r.Background), image.Point{}, draw.Src)
+	}
+	gc := img.NewGraphicContext(canvas)
+	if r.DPI > 0 {
+		gc.SetDPI(r.DPI)
+	}
+	anim := &Animation{LoopCount: r.LoopCount}
+	step := r.TimeStep()
+	for r.frame = 0; r.frame < r.Frames; r.frame++ {
+		changed := rf(gc)
+		if !changed && len(anim.Frames) > 0 {
+			anim.Delays[len(anim.Delays)-1] += step
+			continue
+		}
+		frame := image.NewRGBA(canvas.Bounds())
+		copy(frame.Pix, canvas.Pix)
+		anim.Frames = append(anim.Frames, frame)
+		anim.Delays = append(anim.Delays, step)
+	}
+	return anim, nil
+}
+
+// SaveToFile writes the animation to filePath, as an animated GIF for the
+// ".gif" extension and as an APNG for ".png" and ".apng". opts is only used
+// for GIF output.
+func (a *Animation) SaveToFile(filePath string, opts *img.EncodeOptions) error {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	switch ext {
+	case ".gif", ".png", ".apng":
+	default:
+		return fmt.Errorf("anim: unsupported animation format %q", ext)
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	if ext == ".gif" {
+		err = a.EncodeGIF(b, opts)
+	} else {
+		err = a.EncodeAPNG(b)
+	}
+	if err != nil {
+		return err
+	}
+	return b.Flush()
+}
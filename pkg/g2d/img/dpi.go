@@ -0,0 +1,141 @@
+package img
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// The standard library encoders do not write physical resolution metadata.
+// The helpers below patch it into freshly encoded streams.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+)
+
+var errBadStream = errors.New("img: unexpected encoder output")
+
+// dotsPerMeter converts a resolution in dots per inch to dots per meter
+func dotsPerMeter(dpi int) uint32 {
+	return uint32(math.Round(float64(dpi) / 0.0254))
+}
+
+// setPNGDPI inserts a pHYs chunk directly after the IHDR chunk
+func setPNGDPI(data []byte, dpi int) ([]byte, error) {
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+	if len(data) < ihdrEnd || string(data[12:16]) != "IHDR" {
+		return nil, errBadStream
+	}
+	ppm := dotsPerMeter(dpi)
+	chunk := make([]byte, 4+4+9+4)
+	binary.BigEndian.PutUint32(chunk[0:], 9)
+	copy(chunk[4:], "pHYs")
+	binary.BigEndian.PutUint32(chunk[8:], ppm)
+	binary.BigEndian.PutUint32(chunk[12:], ppm)
+	chunk[16] = 1 // unit is the meter
+	binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...), nil
+}
+
+// setJPEGDPI writes a JFIF APP0 segment declaring the density in dots per
+// inch, replacing an existing one if present
+func setJPEGDPI(data []byte, dpi int) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errBadStream
+	}
+	if dpi > math.MaxUint16 {
+		dpi = math.MaxUint16
+	}
+	app0 := []byte{0xff, 0xe0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 1, 1, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(app0[12:], uint16(dpi))
+	binary.BigEndian.PutUint16(app0[14:], uint16(dpi))
+	rest := data[2:]
+	if len(rest) > 9 && rest[0] == 0xff && rest[1] == 0xe0 && bytes.Equal(rest[4:9], []byte("JFIF\x00")) {
+		rest = rest[2+int(binary.BigEndian.Uint16(rest[2:])):]
+	}
+	out := make([]byte, 0, len(data)+len(app0))
+	out = append(out, data[:2]...)
+	out = append(out, app0...)
+	return append(out, rest...), nil
+}
+
+// setBMPDPI fills the pixels per meter fields of the BITMAPINFOHEADER
+func setBMPDPI(data []byte, dpi int) ([]byte, error) {
+	if len(data) < 54 || data[0] != 'B' || data[1] != 'M' {
+		return nil, errBadStream
+	}
+	ppm := dotsPerMeter(dpi)
+	binary.LittleEndian.PutUint32(data[38:], ppm)
+	binary.LittleEndian.PutUint32(data[42:], ppm)
+	return data, nil
+}
+
+// setTIFFDPI rewrites the XResolution and YResolution rationals of the first
+// IFD and sets the resolution unit to inches
+func setTIFFDPI(data []byte, dpi int) ([]byte, error) {
+	const (
+		tXResolution    = 282
+		tYResolution    = 283
+		tResolutionUnit = 296
+		dtShort         = 3
+		dtRational      = 5
+	)
+	if len(data) < 8 {
+		return nil, errBadStream
+	}
+	var order binary.ByteOrder
+	switch string(data[:4]) {
+	case "II\x2a\x00":
+		order = binary.LittleEndian
+	case "MM\x00\x2a":
+		order = binary.BigEndian
+	default:
+		return nil, errBadStream
+	}
+	ifd := int(order.Uint32(data[4:]))
+	if ifd+2 > len(data) {
+		return nil, errBadStream
+	}
+	count := int(order.Uint16(data[ifd:]))
+	if ifd+2+count*12 > len(data) {
+		return nil, errBadStream
+	}
+	for j := 0; j < count; j++ {
+		entry := data[ifd+2+j*12:]
+		tag := order.Uint16(entry)
+		dt := order.Uint16(entry[2:])
+		switch {
+		case (tag == tXResolution || tag == tYResolution) && dt == dtRational:
+			off := int(order.Uint32(entry[8:]))
+			if off+8 > len(data) {
+				return nil, errBadStream
+			}
+			order.PutUint32(data[off:], uint32(dpi))
+			order.PutUint32(data[off+4:], 1)
+		case tag == tResolutionUnit && dt == dtShort:
+			order.PutUint16(entry[8:], 2) // inch
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,343 @@
+package img
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+
+	// register the WebP decoder with image.Decode
+	_ "golang.org/x/image/webp"
+)
+
+// Format identifies a raster output format
+type Format string
+
+const (
+	// FormatPNG is the Portable Network Graphics format
+	FormatPNG Format = "png"
+	// FormatJPEG is the JPEG/JFIF format
+	FormatJPEG Format = "jpeg"
+	// FormatGIF is the Graphics Interchange Format
+	FormatGIF Format = "gif"
+	// FormatBMP is the Windows bitmap format
+	FormatBMP Format = "bmp"
+	// FormatTIFF is the Tagged Image File Format
+	FormatTIFF Format = "tiff"
+)
+
+// EncodeOptions controls how an image is written by an Encoder. The zero
+// value produces an 8-bit, full color image without resolution metadata.
+type EncodeOptions struct {
+	// Quality is the JPEG quality in the range 1-100, 0 selects the default
+	Quality int
+	// DPI is written as physical resolution metadata when greater than zero
+	DPI int
+	// Depth16 writes 16 bits per channel PNG and TIFF images
+	Depth16 bool
+	// Colors quantizes the image to a palette of at most this many colors
+	// (2-256) and writes an indexed image. GIF output is always indexed and
+	// uses 256 colors when this is zero.
+	Colors int
+	// Quantizer builds the palette for indexed output. MedianCut is used when
+	// nil.
+	Quantizer draw.Quantizer
+	// Dither applies Floyd-Steinberg error diffusion when mapping to a palette
+	Dither bool
+}
+
+// Encoder writes an image to w in a specific raster format
+type Encoder interface {
+	Encode(w io.Writer, m image.Image, opts *EncodeOptions) error
+}
+
+// EncoderFunc is an adapter to allow the use of ordinary functions as Encoder
+type EncoderFunc func(w io.Writer, m image.Image, opts *EncodeOptions) error
+
+// Encode calls fn(w, m, opts)
+func (fn EncoderFunc) Encode(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	return fn(w, m, opts)
+}
+
+var encoders = struct {
+	sync.RWMutex
+	m   map[Format]Encoder
+	ext map[string]Format
+}{
+	m:   make(map[Format]Encoder),
+	ext: make(map[string]Format),
+}
+
+func init() {
+	RegisterEncoder(FormatPNG, EncoderFunc(encodePNG), ".png")
+	RegisterEncoder(FormatJPEG, EncoderFunc(encodeJPEG), ".jpg", ".jpeg")
+	RegisterEncoder(FormatGIF, EncoderFunc(encodeGIF), ".gif")
+	RegisterEncoder(FormatBMP, EncoderFunc(encodeBMP), ".bmp")
+	RegisterEncoder(FormatTIFF, EncoderFunc(encodeTIFF), ".tif", ".tiff")
+}
+
+// RegisterEncoder makes an encoder available under the given format name.
+// The optional extensions (including the leading dot) are used by SaveToFile
+// to select the format from a file name. Registering a format a second time
+// replaces the previous encoder.
+func RegisterEncoder(format Format, enc Encoder, extensions ...string) {
+	encoders.Lock()
+	defer encoders.Unlock()
+	encoders.m[format] = enc
+	for _, ext := range extensions {
+		encoders.ext[strings.ToLower(ext)] = format
+	}
+}
+
+// Encoders returns the list of registered format names
+func Encoders() []Format {
+	encoders.RLock()
+	defer encoders.RUnlock()
+	list := make([]Format, 0, len(encoders.m))
+	for format := range encoders.m {
+		list = append(list, format)
+	}
+	return list
+}
+
+// FormatFromFilename returns the format registered for the extension of
+// filePath
+func FormatFromFilename(filePath string) (Format, bool) {
+	encoders.RLock()
+	defer encoders.RUnlock()
+	format, ok := encoders.ext[strings.ToLower(filepath.Ext(filePath))]
+	return format, ok
+}
+
+// Encode writes m to w using the encoder registered for format. A nil opts
+// is equivalent to a zero EncodeOptions.
+func Encode(w io.Writer, m image.Image, format Format, opts *EncodeOptions) error {
+	encoders.RLock()
+	enc, ok := encoders.m[format]
+	encoders.RUnlock()
+	if !ok {
+		return fmt.Errorf("img: unknown format %q", format)
+	}
+	if opts == nil {
+		opts = &EncodeOptions{}
+	}
+	return enc.Encode(w, m, opts)
+}
+
+// SaveToFile creates filePath and writes m to it, the format being selected
+// from the file extension
+func SaveToFile(filePath string, m image.Image, opts *EncodeOptions) error {
+	format, ok := FormatFromFilename(filePath)
+	if !ok {
+		return fmt.Errorf("img: no encoder registered for %q", filepath.Ext(filePath))
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	err = Encode(b, m, format, opts)
+	if err != nil {
+		return err
+	}
+	return b.Flush()
+}
+
+// LoadFromFile opens an image file in any of the registered decoding formats
+// (png, jpeg, gif, bmp, tiff and webp)
+func LoadFromFile(filePath string) (image.Image, string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	return image.Decode(bufio.NewReader(f))
+}
+
+// SaveToFile writes the image of the graphic context to filePath. When opts
+// does not specify a resolution the DPI of the graphic context is recorded.
+func (gc *GraphicContext) SaveToFile(filePath string, opts *EncodeOptions) error {
+	o := EncodeOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.DPI == 0 {
+		o.DPI = gc.GetDPI()
+	}
+	return SaveToFile(filePath, gc.img, &o)
+}
+
+// paletted maps m to a palette of at most colors entries
+func paletted(m image.Image, colors int, opts *EncodeOptions) *image.Paletted {
+	if p, ok := m.(*image.Paletted); ok && len(p.Palette) <= colors {
+		return p
+	}
+	q := opts.Quantizer
+	if q == nil {
+		q = MedianCut{}
+	}
+	pal := q.Quantize(make(color.Palette, 0, colors), m)
+	if len(pal) > colors {
+		pal = pal[:colors]
+	}
+	b := m.Bounds()
+	dst := image.NewPaletted(b, pal)
+	var drawer draw.Drawer = draw.Src
+	if opts.Dither {
+		drawer = draw.FloydSteinberg
+	}
+	drawer.Draw(dst, b, m, b.Min)
+	return dst
+}
+
+// deep converts m to a 16 bit per channel image
+func deep(m image.Image) image.Image {
+	switch m.(type) {
+	case *image.NRGBA64, *image.RGBA64, *image.Gray16:
+		return m
+	}
+	b := m.Bounds()
+	dst := image.NewNRGBA64(b)
+	draw.Draw(dst, b, m, b.Min, draw.Src)
+	return dst
+}
+
+func encodePNG(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	switch {
+	case opts.Colors > 0:
+		m = paletted(m, clampColors(opts.Colors), opts)
+	case opts.Depth16:
+		m = deep(m)
+	}
+	if opts.DPI <= 0 {
+		return png.Encode(w, m)
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, m)
+	if err != nil {
+		return err
+	}
+	data, err := setPNGDPI(buf.Bytes(), opts.DPI)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func encodeJPEG(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	o := &jpeg.Options{Quality: jpeg.DefaultQuality}
+	if opts.Quality > 0 {
+		o.Quality = opts.Quality
+	}
+	if opts.DPI <= 0 {
+		return jpeg.Encode(w, m, o)
+	}
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, m, o)
+	if err != nil {
+		return err
+	}
+	data, err := setJPEGDPI(buf.Bytes(), opts.DPI)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func encodeGIF(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	colors := 256
+	if opts.Colors > 0 {
+		colors = clampColors(opts.Colors)
+	}
+	return gif.Encode(w, paletted(m, colors, opts), &gif.Options{NumColors: colors})
+}
+
+func encodeBMP(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	if opts.Colors > 0 {
+		m = paletted(m, clampColors(opts.Colors), opts)
+	}
+	if opts.DPI <= 0 {
+		return bmp.Encode(w, m)
+	}
+	var buf bytes.Buffer
+	err := bmp.Encode(&buf, m)
+	if err != nil {
+		return err
+	}
+	data, err := setBMPDPI(buf.Bytes(), opts.DPI)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func encodeTIFF(w io.Writer, m image.Image, opts *EncodeOptions) error {
+	switch {
+	case opts.Colors > 0:
+		m = paletted(m, clampColors(opts.Colors), opts)
+	case opts.Depth16:
+		m = deep(m)
+	}
+	o := &tiff.Options{Compression: tiff.Deflate, Predictor: true}
+	if opts.DPI <= 0 {
+		return tiff.Encode(w, m, o)
+	}
+	var buf bytes.Buffer
+	err := tiff.Encode(&buf, m, o)
+	if err != nil {
+		return err
+	}
+	data, err := setTIFFDPI(buf.Bytes(), opts.DPI)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func clampColors(n int) int {
+	if n < 2 {
+		return 2
+	}
+	if n > 256 {
+		return 256
+	}
+	return n
+}
@@ -0,0 +1,112 @@
+package img
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func testImage() *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			m.Set(x, y, color.RGBA{uint8(x * 8), uint8(y * 16), 0x80, 0xff})
+		}
+	}
+	return m
+}
+
+func TestEncodeFormats(t *testing.T) {
+	m := testImage()
+	for _, format := range []Format{FormatPNG, FormatJPEG, FormatGIF, FormatBMP, FormatTIFF} {
+		var buf bytes.Buffer
+		err := Encode(&buf, m, format, &EncodeOptions{DPI: 300, Quality: 90})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got, name, err := image.Decode(&buf)
+		if err != nil {
+			t.Fatalf("%s: decoding: %v", format, err)
+		}
+		if got.Bounds() != m.Bounds() {
+			t.Fatalf("%s (%s): bounds %v, expected %v", format, name, got.Bounds(), m.Bounds())
+		}
+	}
+	if err := Encode(&bytes.Buffer{}, m, "xyz", nil); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestPNGOptions(t *testing.T) {
+	var buf bytes.Buffer
+	err := Encode(&buf, testImage(), FormatPNG, &EncodeOptions{DPI: 254})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	pos := bytes.Index(data, []byte("pHYs"))
+	if pos < 0 {
+		t.Fatal("pHYs chunk not written")
+	}
+	if ppm := binary.BigEndian.Uint32(data[pos+4:]); ppm != 10000 {
+		t.Fatalf("pixels per meter %d, expected 10000", ppm)
+	}
+	if _, err = png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	err = Encode(&buf, testImage(), FormatPNG, &EncodeOptions{Depth16: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch m.(type) {
+	case *image.NRGBA64, *image.RGBA64:
+	default:
+		t.Fatalf("16 bit PNG decoded as %T", m)
+	}
+
+	buf.Reset()
+	err = Encode(&buf, testImage(), FormatPNG, &EncodeOptions{Colors: 16, Dither: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := m.(*image.Paletted)
+	if !ok {
+		t.Fatalf("indexed PNG decoded as %T", m)
+	}
+	if len(p.Palette) > 16 {
+		t.Fatalf("palette has %d entries, expected at most 16", len(p.Palette))
+	}
+}
@@ -0,0 +1,154 @@
+package img
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// MedianCut is a draw.Quantizer building a palette by recursively splitting
+// the color cube of the image along its widest channel. Fully transparent
+// pixels are given a dedicated palette entry.
+type MedianCut struct{}
+
+type histEntry struct {
+	c     [3]uint8
+	count int
+}
+
+type colorBox []histEntry
+
+// span returns the channel with the widest range and that range
+func (b colorBox) span() (channel int, width int) {
+	for ch := 0; ch < 3; ch++ {
+		lo, hi := 255, 0
+		for _, e := range b {
+			v := int(e.c[ch])
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if hi-lo > width {
+			channel, width = ch, hi-lo
+		}
+	}
+	return
+}
+
+func (b colorBox) average() color.RGBA {
+	var r, g, bl, n int
+	for _, e := range b {
+		r += int(e.c[0]) * e.count
+		g += int(e.c[1]) * e.count
+		bl += int(e.c[2]) * e.count
+		n += e.count
+	}
+	if n == 0 {
+		return color.RGBA{A: 0xff}
+	}
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 0xff}
+}
+
+// Quantize implements draw.Quantizer. The colors are appended to p, and the
+// capacity of p bounds the size of the palette (256 when it is zero).
+func (MedianCut) Quantize(p color.Palette, m image.Image) color.Palette {
+	limit := cap(p) - len(p)
+	if cap(p) == 0 {
+		limit = 256
+	}
+	hist := make(map[[3]uint8]int)
+	transparent := false
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			if c.A < 0x80 {
+				transparent = true
+				continue
+			}
+			hist[[3]uint8{c.R, c.G, c.B}]++
+		}
+	}
+	if transparent {
+		p = append(p, color.RGBA{})
+		limit--
+	}
+	if limit <= 0 || len(hist) == 0 {
+		return p
+	}
+	box := make(colorBox, 0, len(hist))
+	for c, n := range hist {
+		box = append(box, histEntry{c, n})
+	}
+	// Map iteration is random; sort so that the palette is reproducible.
+	sort.Slice(box, func(i, j int) bool {
+		a, c := box[i].c, box[j].c
+		if a[0] != c[0] {
+			return a[0] < c[0]
+		}
+		if a[1] != c[1] {
+			return a[1] < c[1]
+		}
+		return a[2] < c[2]
+	})
+	boxes := []colorBox{box}
+	for len(boxes) < limit {
+		// split the box with the widest channel range
+		idx, ch, width := -1, 0, 0
+		for j, bx := range boxes {
+			if len(bx) < 2 {
+				continue
+			}
+			c, w := bx.span()
+			if w > width {
+				idx, ch, width = j, c, w
+			}
+		}
+		if idx < 0 {
+			break
+		}
+		bx := boxes[idx]
+		sort.SliceStable(bx, func(i, j int) bool { return bx[i].c[ch] < bx[j].c[ch] })
+		total := 0
+		for _, e := range bx {
+			total += e.count
+		}
+		median, acc := 1, 0
+		for j, e := range bx[:len(bx)-1] {
+			acc += e.count
+			if acc*2 >= total {
+				median = j + 1
+				break
+			}
+		}
+		boxes[idx] = bx[:median]
+		boxes = append(boxes, bx[median:])
+	}
+	for _, bx := range boxes {
+		p = append(p, bx.average())
+	}
+	return p
+}